@@ -0,0 +1,710 @@
+/*
+Package canary implements the automated analysis of canary deployments.
+
+A canary group consists of a baseline route and a canary route, that
+match the same requests. The Canary predicate on the canary route
+matches the share of the requests given by the current weight of the
+group. The canary filter marks the canary route and configures the
+group, and the canaryBaseline filter marks the baseline route. The
+groups are configured by Update, once for every routing table.
+
+The error rate and the latency of the routes are measured by the
+response statistics of the routes, recorded in the
+routing.EndpointRegistry, so the requests of other routes with the same
+backends don't count. Only the routes with network or load balanced
+backends are measured.
+
+In every interval of the group, the registry compares the measures with
+the configured limits. When the canary is within the limits, its weight
+is raised by a step, until it receives all the requests and it is
+promoted. When the canary exceeds the limits, and the baseline does not,
+its weight is set to 0, and it is rolled back. When both exceed the
+limits, the problem is not specific to the canary, and its weight is
+kept.
+
+The state of the groups is exposed by the registry as an http.Handler,
+on the /canary path of the support listener. When a state file is
+configured, the state is stored in it, and loaded on start, so that
+e.g. a rolled back canary doesn't receive requests again after a
+restart.
+*/
+package canary
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zalando/skipper/metrics"
+	"github.com/zalando/skipper/routing"
+)
+
+const (
+	// DefaultMinRequests is the default minimum number of the canary
+	// requests in an interval, that is required for the analysis.
+	DefaultMinRequests = 10
+
+	checkPeriod = time.Second
+
+	weightMetric    = "canary.%s.weight"
+	rollbacksMetric = "canary.%s.rollbacks"
+)
+
+// State tells the phase of a canary group.
+type State string
+
+const (
+	// StatePending means that the group is not configured by a canary
+	// filter, and the Canary predicate does not match.
+	StatePending State = "pending"
+
+	// StateProgressing means that the weight of the canary is raised
+	// after every successful interval.
+	StateProgressing State = "progressing"
+
+	// StatePromoted means that the canary receives all the requests.
+	StatePromoted State = "promoted"
+
+	// StateRolledBack means that the canary exceeded the limits, and it
+	// receives no requests.
+	StateRolledBack State = "rolledBack"
+)
+
+// Config is the configuration of the analysis of a group, set by the
+// arguments of the canary filter.
+type Config struct {
+	// StepPercent is the initial weight of the canary and the amount it
+	// is raised by after every successful interval, in percents.
+	StepPercent float64
+
+	// Interval is the duration of the measurement between the steps.
+	Interval time.Duration
+
+	// MaxErrorRate is the highest accepted ratio of the responses with
+	// 5xx status codes, between 0 and 1.
+	MaxErrorRate float64
+
+	// MaxP99 is the highest accepted 99th percentile of the latency.
+	MaxP99 time.Duration
+}
+
+// Options are used to create the registry.
+type Options struct {
+	// MinRequests is the minimum number of the canary requests in an
+	// interval, that is required for the analysis. Until it is reached,
+	// the measurement continues. Defaults to DefaultMinRequests.
+	MinRequests int
+
+	// Metrics receives the weight and the number of the rollbacks of
+	// the groups. Defaults to metrics.Default.
+	Metrics metrics.Metrics
+
+	// EndpointRegistry provides the response statistics of the canary
+	// and the baseline routes. Required.
+	EndpointRegistry *routing.EndpointRegistry
+
+	// StateFile is the path of the file, where the configuration, the
+	// state and the step of the groups are stored. When set, the groups
+	// are loaded from it on start, and the measurement of the current
+	// interval starts again. Otherwise the state is kept only in
+	// memory.
+	StateFile string
+}
+
+// Member is the canary or the baseline route of a group.
+type Member struct {
+	Group   string
+	RouteID string
+	Canary  bool
+
+	// Config is the configuration of the analysis, set only by the
+	// canary routes.
+	Config Config
+
+	// Hosts are the backend endpoints of the route. Only the routes
+	// with backend endpoints are measured.
+	Hosts []string
+}
+
+// Measure contains the results of the measurement of one of the routes
+// in an interval. The 99th percentile latency is the upper bound of its
+// bucket in routing.LatencyBuckets.
+type Measure struct {
+	Requests  int     `json:"requests"`
+	ErrorRate float64 `json:"errorRate"`
+	P99       string  `json:"p99"`
+
+	p99 time.Duration
+}
+
+// Analysis contains the results of the last completed interval.
+type Analysis struct {
+	Time     time.Time `json:"time"`
+	Baseline Measure   `json:"baseline"`
+	Canary   Measure   `json:"canary"`
+	Result   string    `json:"result"`
+}
+
+// GroupState is the exposed state of a group.
+type GroupState struct {
+	Name          string    `json:"name"`
+	State         State     `json:"state"`
+	WeightPercent float64   `json:"weightPercent"`
+	StepPercent   float64   `json:"stepPercent"`
+	Interval      string    `json:"interval"`
+	MaxErrorRate  float64   `json:"maxErrorRate"`
+	MaxP99        string    `json:"maxP99"`
+	Error         string    `json:"error,omitempty"`
+	LastAnalysis  *Analysis `json:"lastAnalysis,omitempty"`
+}
+
+// Group is the state of a canary group, shared by the predicate and the
+// registry.
+type Group struct {
+	registry *Registry
+	name     string
+
+	// math.Float64bits of the weight between 0 and 1, read on every
+	// request
+	weight atomic.Uint64
+
+	mu             sync.Mutex
+	configured     bool
+	config         Config
+	err            string
+	canaryRoutes   []string
+	baselineRoutes []string
+	state          State
+	steps          int
+	started        time.Time
+	canaryStart    routing.ResponseStats
+	baselineStart  routing.ResponseStats
+	lastAnalysis   *Analysis
+}
+
+// persistedGroup is the state of a group stored in the state file.
+type persistedGroup struct {
+	Config       Config    `json:"config"`
+	State        State     `json:"state"`
+	Steps        int       `json:"steps"`
+	LastAnalysis *Analysis `json:"lastAnalysis,omitempty"`
+}
+
+// Registry holds the canary groups, and runs their analysis.
+type Registry struct {
+	options Options
+	now     func() time.Time
+
+	mu     sync.Mutex
+	groups map[string]*Group
+
+	// set when the state of a group changes, and it needs to be stored
+	changed atomic.Bool
+
+	quit chan struct{}
+	once sync.Once
+}
+
+// sub returns the statistics since start. When the endpoint was
+// removed from the endpoint registry in the meantime, the counts start
+// from 0 again.
+func sub(current, start routing.ResponseStats) routing.ResponseStats {
+	if current.Requests < start.Requests {
+		return current
+	}
+
+	d := routing.ResponseStats{
+		Requests: current.Requests - start.Requests,
+		Errors:   current.Errors - start.Errors,
+	}
+
+	for i := range d.Latencies {
+		d.Latencies[i] = current.Latencies[i] - start.Latencies[i]
+	}
+
+	return d
+}
+
+func measure(s routing.ResponseStats) Measure {
+	var m Measure
+	m.Requests = int(s.Requests)
+	if s.Requests > 0 {
+		m.ErrorRate = float64(s.Errors) / float64(s.Requests)
+	}
+
+	var total int64
+	for _, n := range s.Latencies {
+		total += n
+	}
+
+	if total > 0 {
+		p99 := int64(math.Ceil(float64(total) * 0.99))
+		var count int64
+		for i, n := range s.Latencies {
+			count += n
+			if count >= p99 {
+				m.p99 = routing.LatencyBuckets[i]
+				break
+			}
+		}
+	}
+
+	m.P99 = m.p99.String()
+	return m
+}
+
+func (c Config) exceeded(m Measure) string {
+	var reasons []string
+	if m.ErrorRate > c.MaxErrorRate {
+		reasons = append(reasons, fmt.Sprintf("error rate %.4f exceeds %.4f", m.ErrorRate, c.MaxErrorRate))
+	}
+
+	if m.p99 > c.MaxP99 {
+		reasons = append(reasons, fmt.Sprintf("p99 latency %v exceeds %v", m.p99, c.MaxP99))
+	}
+
+	return strings.Join(reasons, ", ")
+}
+
+func newRegistry(o Options) *Registry {
+	if o.MinRequests <= 0 {
+		o.MinRequests = DefaultMinRequests
+	}
+
+	if o.Metrics == nil {
+		o.Metrics = metrics.Default
+	}
+
+	r := &Registry{
+		options: o,
+		now:     time.Now,
+		groups:  make(map[string]*Group),
+		quit:    make(chan struct{}),
+	}
+
+	if o.StateFile != "" {
+		if err := r.load(); err != nil {
+			log.Errorf("Failed to load the state of the canary groups: %v", err)
+		}
+	}
+
+	return r
+}
+
+func (r *Registry) load() error {
+	b, err := os.ReadFile(r.options.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var groups map[string]persistedGroup
+	if err := json.Unmarshal(b, &groups); err != nil {
+		return err
+	}
+
+	for name, pg := range groups {
+		g := &Group{
+			registry:     r,
+			name:         name,
+			configured:   true,
+			config:       pg.Config,
+			state:        pg.State,
+			steps:        pg.Steps,
+			started:      r.now(),
+			lastAnalysis: pg.LastAnalysis,
+		}
+
+		switch pg.State {
+		case StateRolledBack:
+			g.setWeight(0)
+		case StatePromoted:
+			g.setWeight(100)
+		default:
+			g.setWeight(float64(pg.Steps) * pg.Config.StepPercent)
+		}
+
+		r.groups[name] = g
+	}
+
+	return nil
+}
+
+// save writes the state to a temporary file, and renames it, so that
+// the state file is never partially written.
+func (r *Registry) save() error {
+	groups := make(map[string]persistedGroup)
+	for _, g := range r.snapshot() {
+		g.mu.Lock()
+		if g.configured {
+			groups[g.name] = persistedGroup{
+				Config:       g.config,
+				State:        g.state,
+				Steps:        g.steps,
+				LastAnalysis: g.lastAnalysis,
+			}
+		}
+
+		g.mu.Unlock()
+	}
+
+	b, err := json.Marshal(groups)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(r.options.StateFile), ".canary-")
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := os.Rename(f.Name(), r.options.StateFile); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return nil
+}
+
+func (r *Registry) saveChanged() {
+	if r.options.StateFile == "" || !r.changed.Swap(false) {
+		return
+	}
+
+	if err := r.save(); err != nil {
+		log.Errorf("Failed to store the state of the canary groups: %v", err)
+	}
+}
+
+// NewRegistry creates a registry, and starts the analysis of the
+// groups.
+func NewRegistry(o Options) *Registry {
+	r := newRegistry(o)
+	go r.run()
+	return r
+}
+
+func (r *Registry) run() {
+	t := time.NewTicker(checkPeriod)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			r.analyze()
+			r.saveChanged()
+		case <-r.quit:
+			return
+		}
+	}
+}
+
+// Group returns the group with the name, and creates it when it does
+// not exist yet.
+func (r *Registry) Group(name string) *Group {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	g, ok := r.groups[name]
+	if !ok {
+		g = &Group{registry: r, name: name, state: StatePending}
+		r.groups[name] = g
+	}
+
+	return g
+}
+
+func (r *Registry) snapshot() []*Group {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	groups := make([]*Group, 0, len(r.groups))
+	for _, g := range r.groups {
+		groups = append(groups, g)
+	}
+
+	sort.Slice(groups, func(i, j int) bool { return groups[i].name < groups[j].name })
+	return groups
+}
+
+func (r *Registry) analyze() {
+	now := r.now()
+	for _, g := range r.snapshot() {
+		g.analyze(now)
+	}
+}
+
+// States returns the state of the groups, sorted by their name.
+func (r *Registry) States() []GroupState {
+	groups := r.snapshot()
+	states := make([]GroupState, len(groups))
+	for i, g := range groups {
+		states[i] = g.State()
+	}
+
+	return states
+}
+
+// ServeHTTP responds with the state of the groups in JSON format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(r.States()); err != nil {
+		log.Errorf("Failed to encode the state of the canary groups: %v", err)
+	}
+}
+
+// Close stops the analysis, and stores the state of the groups when it
+// changed.
+func (r *Registry) Close() {
+	r.once.Do(func() {
+		close(r.quit)
+		r.saveChanged()
+	})
+}
+
+func (g *Group) setWeight(percent float64) {
+	w := math.Min(percent, 100) / 100
+	g.weight.Store(math.Float64bits(w))
+	g.registry.options.Metrics.UpdateGauge(fmt.Sprintf(weightMetric, g.name), w)
+}
+
+// Weight returns the share of the requests, between 0 and 1, that the
+// canary route receives.
+func (g *Group) Weight() float64 {
+	return math.Float64frombits(g.weight.Load())
+}
+
+func (r *Registry) responses(routeIDs []string) routing.ResponseStats {
+	var s routing.ResponseStats
+	for _, id := range routeIDs {
+		rs := r.options.EndpointRegistry.RouteResponses(id)
+		s.Requests += rs.Requests
+		s.Errors += rs.Errors
+		for i, n := range rs.Latencies {
+			s.Latencies[i] += n
+		}
+	}
+
+	return s
+}
+
+// Update configures the groups by the canary and the baseline routes of
+// the current routing table. The groups with conflicting configurations
+// in their canary routes, or without a measured canary route, keep their
+// weight, and they are not analyzed until the routes are fixed. The
+// problem is logged as an error, and it is exposed in the state of the
+// group.
+func (r *Registry) Update(members []Member) {
+	byGroup := make(map[string][]Member)
+	for _, m := range members {
+		byGroup[m.Group] = append(byGroup[m.Group], m)
+	}
+
+	for _, g := range r.snapshot() {
+		if _, ok := byGroup[g.name]; !ok {
+			byGroup[g.name] = nil
+		}
+	}
+
+	for name, m := range byGroup {
+		r.Group(name).update(m)
+	}
+}
+
+func idSet(ids []string) []string {
+	ids = slices.Clone(ids)
+	slices.Sort(ids)
+	return slices.Compact(ids)
+}
+
+func (g *Group) update(members []Member) {
+	var (
+		config                       *Config
+		configRoute                  string
+		canaryRoutes, baselineRoutes []string
+		err                          string
+	)
+
+	for _, m := range members {
+		// only the routes with network backends are measured
+		measured := len(m.Hosts) > 0
+		if !m.Canary {
+			if measured {
+				baselineRoutes = append(baselineRoutes, m.RouteID)
+			}
+
+			continue
+		}
+
+		if config != nil && *config != m.Config && err == "" {
+			err = fmt.Sprintf("conflicting configurations in the routes %s and %s", configRoute, m.RouteID)
+		}
+
+		config, configRoute = &m.Config, m.RouteID
+		if measured {
+			canaryRoutes = append(canaryRoutes, m.RouteID)
+		}
+	}
+
+	canaryRoutes, baselineRoutes = idSet(canaryRoutes), idSet(baselineRoutes)
+	switch {
+	case err != "":
+	case config == nil:
+		err = "no route with a canary filter"
+	case len(canaryRoutes) == 0:
+		err = "the canary route has no network backend"
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err != "" {
+		if err != g.err {
+			log.Errorf("Canary %s: %s", g.name, err)
+		}
+
+		g.err = err
+		return
+	}
+
+	g.err = ""
+	if g.configured && g.config == *config {
+		if !slices.Equal(g.canaryRoutes, canaryRoutes) || !slices.Equal(g.baselineRoutes, baselineRoutes) {
+			// the measurement of the current interval starts again
+			g.canaryRoutes, g.baselineRoutes = canaryRoutes, baselineRoutes
+			g.restartInterval(g.registry.now())
+		}
+
+		return
+	}
+
+	g.canaryRoutes, g.baselineRoutes = canaryRoutes, baselineRoutes
+	g.configure(*config)
+}
+
+func (g *Group) restartInterval(now time.Time) {
+	g.started = now
+	g.canaryStart = g.registry.responses(g.canaryRoutes)
+	g.baselineStart = g.registry.responses(g.baselineRoutes)
+}
+
+// configure sets the configuration of the group, and starts the
+// analysis again from the first step.
+func (g *Group) configure(c Config) {
+	g.configured = true
+	g.config = c
+	g.state = StateProgressing
+	g.steps = 1
+	g.lastAnalysis = nil
+	g.restartInterval(g.registry.now())
+	g.setWeight(c.StepPercent)
+	g.registry.changed.Store(true)
+	log.Infof("Canary %s: started with weight %v%%", g.name, c.StepPercent)
+}
+
+func (g *Group) analyze(now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.state != StateProgressing || g.err != "" || now.Sub(g.started) < g.config.Interval {
+		return
+	}
+
+	minRequests := g.registry.options.MinRequests
+	canaryStats := g.registry.responses(g.canaryRoutes)
+	a := &Analysis{Time: now, Canary: measure(sub(canaryStats, g.canaryStart))}
+	if a.Canary.Requests < minRequests {
+		return
+	}
+
+	baselineStats := g.registry.responses(g.baselineRoutes)
+	a.Baseline = measure(sub(baselineStats, g.baselineStart))
+	canaryExceeded := g.config.exceeded(a.Canary)
+	baselineExceeded := ""
+	if a.Baseline.Requests >= minRequests {
+		baselineExceeded = g.config.exceeded(a.Baseline)
+	}
+
+	switch {
+	case canaryExceeded != "" && baselineExceeded == "":
+		g.state = StateRolledBack
+		g.setWeight(0)
+		g.registry.options.Metrics.IncCounter(fmt.Sprintf(rollbacksMetric, g.name))
+		a.Result = "rolled back: " + canaryExceeded
+		log.Errorf("Canary %s: %s", g.name, a.Result)
+	case canaryExceeded != "":
+		a.Result = "weight kept, the baseline exceeds the limits, too: " + baselineExceeded
+		log.Warnf("Canary %s: %s", g.name, a.Result)
+	default:
+		g.steps++
+		percent := float64(g.steps) * g.config.StepPercent
+		if percent >= 100 {
+			g.state = StatePromoted
+			a.Result = "promoted"
+		} else {
+			a.Result = fmt.Sprintf("weight raised to %v%%", percent)
+		}
+
+		g.setWeight(percent)
+		log.Infof("Canary %s: %s", g.name, a.Result)
+	}
+
+	g.lastAnalysis = a
+	g.started = now
+	g.canaryStart = canaryStats
+	g.baselineStart = baselineStats
+	g.registry.changed.Store(true)
+}
+
+// State returns the exposed state of the group.
+func (g *Group) State() GroupState {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	s := GroupState{
+		Name:          g.name,
+		State:         g.state,
+		WeightPercent: g.Weight() * 100,
+		StepPercent:   g.config.StepPercent,
+		Interval:      g.config.Interval.String(),
+		MaxErrorRate:  g.config.MaxErrorRate,
+		MaxP99:        g.config.MaxP99.String(),
+		Error:         g.err,
+	}
+
+	if g.lastAnalysis != nil {
+		a := *g.lastAnalysis
+		s.LastAnalysis = &a
+	}
+
+	return s
+}
@@ -0,0 +1,373 @@
+package canary
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando/skipper/metrics/metricstest"
+	"github.com/zalando/skipper/routing"
+)
+
+var testConfig = Config{
+	StepPercent:  40,
+	Interval:     time.Minute,
+	MaxErrorRate: 0.1,
+	MaxP99:       100 * time.Millisecond,
+}
+
+const (
+	canaryHost   = "canary.test:80"
+	baselineHost = "baseline.test:80"
+)
+
+type testRegistry struct {
+	*Registry
+	metrics   *metricstest.MockMetrics
+	endpoints *routing.EndpointRegistry
+	now       time.Time
+}
+
+func newTestRegistry() *testRegistry {
+	m := &metricstest.MockMetrics{}
+	e := routing.NewEndpointRegistry(routing.RegistryOptions{})
+	r := &testRegistry{metrics: m, endpoints: e, now: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	r.Registry = newRegistry(Options{MinRequests: 10, Metrics: m, EndpointRegistry: e})
+	r.Registry.now = func() time.Time { return r.now }
+	return r
+}
+
+func members(group string, c Config) []Member {
+	return []Member{
+		{Group: group, RouteID: "baseline", Hosts: []string{baselineHost}},
+		{Group: group, RouteID: "canary", Canary: true, Config: c, Hosts: []string{canaryHost}},
+	}
+}
+
+// observe records n responses of the canary or the baseline, and the
+// first errors of them with status 500.
+func (r *testRegistry) observe(canary bool, n, errors int, latency time.Duration) {
+	routeID, host := "baseline", baselineHost
+	if canary {
+		routeID, host = "canary", canaryHost
+	}
+
+	for i := 0; i < n; i++ {
+		status := 200
+		if i < errors {
+			status = 500
+		}
+
+		o := routing.IncRequestsOptions{StatusCode: status, Duration: latency}
+		r.endpoints.GetMetrics(host).IncRequests(o)
+		r.endpoints.IncRouteResponses(routeID, o)
+	}
+}
+
+func (r *testRegistry) step() {
+	r.now = r.now.Add(testConfig.Interval)
+	r.analyze()
+}
+
+func TestProgress(t *testing.T) {
+	r := newTestRegistry()
+	g := r.Group("api")
+	assert.Equal(t, StatePending, g.State().State)
+	assert.Equal(t, 0.0, g.Weight())
+
+	r.Update(members("api", testConfig))
+	assert.Equal(t, StateProgressing, g.State().State)
+	assert.Equal(t, 0.4, g.Weight())
+
+	// not enough requests
+	r.observe(true, 5, 0, time.Millisecond)
+	r.step()
+	assert.Equal(t, 0.4, g.Weight())
+	assert.Nil(t, g.State().LastAnalysis)
+
+	r.observe(true, 5, 0, time.Millisecond)
+	r.observe(false, 10, 0, time.Millisecond)
+	r.step()
+	assert.Equal(t, 0.8, g.Weight())
+	assert.Equal(t, "weight raised to 80%", g.State().LastAnalysis.Result)
+	assert.Equal(t, 10, g.State().LastAnalysis.Canary.Requests)
+
+	// the interval is not over
+	r.observe(true, 10, 0, time.Millisecond)
+	r.analyze()
+	assert.Equal(t, 0.8, g.Weight())
+
+	r.step()
+	assert.Equal(t, 1.0, g.Weight())
+	assert.Equal(t, StatePromoted, g.State().State)
+
+	// the same configuration doesn't restart the analysis
+	r.Update(members("api", testConfig))
+	assert.Equal(t, StatePromoted, g.State().State)
+
+	r.metrics.WithGauges(func(gauges map[string]float64) {
+		assert.Equal(t, 1.0, gauges["canary.api.weight"])
+	})
+}
+
+func TestRollback(t *testing.T) {
+	for _, tt := range []struct {
+		title           string
+		canaryErrors    int
+		canaryLatency   time.Duration
+		baselineErrors  int
+		baselineLatency time.Duration
+		state           State
+		weight          float64
+		result          string
+	}{{
+		title:         "error rate",
+		canaryErrors:  2,
+		canaryLatency: time.Millisecond,
+		state:         StateRolledBack,
+		weight:        0,
+		result:        "rolled back: error rate 0.2000 exceeds 0.1000",
+	}, {
+		title:         "latency",
+		canaryLatency: time.Second,
+		state:         StateRolledBack,
+		weight:        0,
+		result:        "rolled back: p99 latency 1s exceeds 100ms",
+	}, {
+		title:           "baseline exceeds too",
+		canaryErrors:    2,
+		canaryLatency:   time.Millisecond,
+		baselineErrors:  3,
+		baselineLatency: time.Millisecond,
+		state:           StateProgressing,
+		weight:          0.4,
+		result:          "weight kept, the baseline exceeds the limits, too: error rate 0.3000 exceeds 0.1000",
+	}} {
+		t.Run(tt.title, func(t *testing.T) {
+			r := newTestRegistry()
+			g := r.Group("api")
+			r.Update(members("api", testConfig))
+
+			r.observe(true, 10, tt.canaryErrors, tt.canaryLatency)
+			r.observe(false, 10, tt.baselineErrors, tt.baselineLatency)
+			r.step()
+
+			s := g.State()
+			assert.Equal(t, tt.state, s.State)
+			assert.Equal(t, tt.weight, g.Weight())
+			assert.Equal(t, tt.result, s.LastAnalysis.Result)
+
+			// the rolled back canary is not measured anymore
+			r.observe(true, 10, 0, time.Millisecond)
+			r.step()
+			if tt.state == StateRolledBack {
+				assert.Equal(t, 0.0, g.Weight())
+				r.metrics.WithCounters(func(counters map[string]int64) {
+					assert.Equal(t, int64(1), counters["canary.api.rollbacks"])
+				})
+			}
+
+			// a new configuration restarts the analysis
+			c := testConfig
+			c.StepPercent = 10
+			r.Update(members("api", c))
+			assert.Equal(t, StateProgressing, g.State().State)
+			assert.Equal(t, 0.1, g.Weight())
+			assert.Nil(t, g.State().LastAnalysis)
+		})
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	e := routing.NewEndpointRegistry(routing.RegistryOptions{})
+	metrics := e.GetMetrics(canaryHost)
+	metrics.IncRequests(routing.IncRequestsOptions{StatusCode: 200, Duration: time.Hour})
+	start := metrics.Responses()
+
+	for i := 1; i <= 200; i++ {
+		status := 200
+		if i%20 == 0 {
+			status = 503
+		}
+
+		metrics.IncRequests(routing.IncRequestsOptions{StatusCode: status, Duration: time.Duration(i) * time.Millisecond})
+	}
+
+	m := measure(sub(metrics.Responses(), start))
+	assert.Equal(t, 200, m.Requests)
+	assert.Equal(t, 0.05, m.ErrorRate)
+	assert.Equal(t, "200ms", m.P99)
+
+	// the endpoint was removed from the registry in the meantime
+	m = measure(sub(start, metrics.Responses()))
+	assert.Equal(t, 1, m.Requests)
+	assert.Equal(t, "1m0s", m.P99)
+}
+
+func TestUpdate(t *testing.T) {
+	r := newTestRegistry()
+	g := r.Group("api")
+	r.Update(members("api", testConfig))
+	require.Equal(t, StateProgressing, g.State().State)
+
+	r.observe(true, 10, 0, time.Millisecond)
+	r.observe(false, 10, 0, time.Millisecond)
+	r.step()
+	require.Equal(t, 0.8, g.Weight())
+
+	other := testConfig
+	other.StepPercent = 10
+	conflicting := append(members("api", testConfig), Member{
+		Group:   "api",
+		RouteID: "canary2",
+		Canary:  true,
+		Config:  other,
+		Hosts:   []string{"canary2.test:80"},
+	})
+
+	r.Update(conflicting)
+	s := g.State()
+	assert.Equal(t, "conflicting configurations in the routes canary and canary2", s.Error)
+	assert.Equal(t, StateProgressing, s.State)
+	assert.Equal(t, 0.8, g.Weight())
+
+	// the analysis is paused
+	r.observe(true, 10, 0, time.Millisecond)
+	r.step()
+	assert.Equal(t, 0.8, g.Weight())
+
+	// the same configuration in every route doesn't restart the analysis
+	conflicting[2].Config = testConfig
+	r.Update(conflicting)
+	assert.Empty(t, g.State().Error)
+	assert.Equal(t, 0.8, g.Weight())
+
+	noBackend := members("api", testConfig)
+	noBackend[1].Hosts = nil
+	r.Update(noBackend)
+	assert.Equal(t, "the canary route has no network backend", g.State().Error)
+
+	r.Update(nil)
+	assert.Equal(t, "no route with a canary filter", g.State().Error)
+
+	r.Update(members("api", testConfig))
+	r.observe(true, 10, 0, time.Millisecond)
+	r.step()
+	assert.Equal(t, StatePromoted, g.State().State)
+}
+
+func TestSharedBackends(t *testing.T) {
+	r := newTestRegistry()
+	g := r.Group("api")
+	shared := members("api", testConfig)
+	shared[0].Hosts = []string{canaryHost}
+	r.Update(shared)
+	require.Empty(t, g.State().Error)
+
+	// the failing requests of the other route with the same backend
+	// don't count
+	for i := 0; i < 10; i++ {
+		o := routing.IncRequestsOptions{StatusCode: 500, Duration: time.Second}
+		r.endpoints.GetMetrics(canaryHost).IncRequests(o)
+		r.endpoints.IncRouteResponses("other", o)
+	}
+
+	r.observe(true, 10, 0, time.Millisecond)
+	r.step()
+	assert.Equal(t, 0.8, g.Weight())
+	assert.Equal(t, 10, g.State().LastAnalysis.Canary.Requests)
+}
+
+func TestStateFile(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "canary.json")
+	newRegistry := func() *testRegistry {
+		r := newTestRegistry()
+		r.Registry = newRegistry(Options{MinRequests: 10, Metrics: r.metrics, EndpointRegistry: r.endpoints, StateFile: stateFile})
+		r.Registry.now = func() time.Time { return r.now }
+		return r
+	}
+
+	other := members("other", testConfig)
+	other[0].RouteID = "other-baseline"
+	other[1].RouteID = "other-canary"
+
+	r := newRegistry()
+	r.Update(append(members("api", testConfig), other...))
+	r.observe(true, 10, 5, time.Millisecond)
+	r.step()
+	require.Equal(t, StateRolledBack, r.Group("api").State().State)
+	r.Close()
+
+	r = newRegistry()
+	require.Equal(t, StateRolledBack, r.Group("api").State().State)
+	require.Equal(t, 0.0, r.Group("api").Weight())
+	require.Equal(t, 0.4, r.Group("other").Weight())
+
+	// the same configuration keeps the canary rolled back
+	r.Update(append(members("api", testConfig), other...))
+	assert.Equal(t, StateRolledBack, r.Group("api").State().State)
+	assert.Equal(t, "rolled back: error rate 0.5000 exceeds 0.1000", r.Group("api").State().LastAnalysis.Result)
+	assert.Equal(t, StateProgressing, r.Group("other").State().State)
+
+	// the analysis continues from the stored step
+	for i := 0; i < 10; i++ {
+		r.endpoints.IncRouteResponses("other-canary", routing.IncRequestsOptions{StatusCode: 200})
+	}
+
+	r.step()
+	assert.Equal(t, 0.8, r.Group("other").Weight())
+	assert.Equal(t, StateRolledBack, r.Group("api").State().State)
+}
+
+func TestInvalidStateFile(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "canary.json")
+	require.NoError(t, os.WriteFile(stateFile, []byte("not json"), 0o600))
+
+	r := newRegistry(Options{StateFile: stateFile, Metrics: &metricstest.MockMetrics{}})
+	assert.Empty(t, r.States())
+}
+
+func TestServeHTTP(t *testing.T) {
+	r := newTestRegistry()
+	r.Update(members("b", testConfig))
+	r.Group("a")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/canary", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var states []GroupState
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &states))
+	assert.Equal(t, []GroupState{{
+		Name:     "a",
+		State:    StatePending,
+		Interval: "0s",
+		MaxP99:   "0s",
+	}, {
+		Name:          "b",
+		State:         StateProgressing,
+		WeightPercent: 40,
+		StepPercent:   40,
+		Interval:      "1m0s",
+		MaxErrorRate:  0.1,
+		MaxP99:        "100ms",
+	}}, states)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/canary", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestRegistryClose(t *testing.T) {
+	r := NewRegistry(Options{Metrics: &metricstest.MockMetrics{}})
+	r.Close()
+	r.Close()
+}
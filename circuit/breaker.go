@@ -7,7 +7,7 @@ import (
 	"time"
 )
 
-// BreakerType defines the type of the used breaker: consecutive, rate or disabled.
+// BreakerType defines the type of the used breaker: consecutive, rate, latency or disabled.
 type BreakerType int
 
 func (b *BreakerType) UnmarshalYAML(unmarshal func(interface{}) error) error {
@@ -21,10 +21,12 @@ func (b *BreakerType) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		*b = ConsecutiveFailures
 	case "rate":
 		*b = FailureRate
+	case "latency":
+		*b = HighLatency
 	case "disabled":
 		*b = BreakerDisabled
 	default:
-		return fmt.Errorf("invalid breaker type %v (allowed values are: consecutive, rate or disabled)", value)
+		return fmt.Errorf("invalid breaker type %v (allowed values are: consecutive, rate, latency or disabled)", value)
 	}
 
 	return nil
@@ -35,6 +37,7 @@ const (
 	ConsecutiveFailures
 	FailureRate
 	BreakerDisabled
+	HighLatency
 )
 
 // BreakerSettings contains the settings for individual circuit breakers.
@@ -49,6 +52,9 @@ type BreakerSettings struct {
 	Timeout          time.Duration `yaml:"timeout"`
 	HalfOpenRequests int           `yaml:"half-open-requests"`
 	IdleTTL          time.Duration `yaml:"idle-ttl"`
+	Latency          time.Duration `yaml:"latency"`
+	Percentile       float64       `yaml:"percentile"`
+	SlowRatio        float64       `yaml:"slow-ratio"`
 }
 
 type breakerImplementation interface {
@@ -78,6 +84,13 @@ func (to BreakerSettings) mergeSettings(from BreakerSettings) BreakerSettings {
 			to.Window = from.Window
 			to.Failures = from.Failures
 		}
+
+		if from.Type == HighLatency {
+			to.Window = from.Window
+			to.Latency = from.Latency
+			to.Percentile = from.Percentile
+			to.SlowRatio = from.SlowRatio
+		}
 	}
 
 	if to.Timeout == 0 {
@@ -106,6 +119,8 @@ func (s BreakerSettings) String() string {
 		ss = append(ss, "type=consecutive")
 	case FailureRate:
 		ss = append(ss, "type=rate")
+	case HighLatency:
+		ss = append(ss, "type=latency")
 	case BreakerDisabled:
 		return "disabled"
 	default:
@@ -116,7 +131,7 @@ func (s BreakerSettings) String() string {
 		ss = append(ss, "host="+s.Host)
 	}
 
-	if s.Type == FailureRate && s.Window > 0 {
+	if (s.Type == FailureRate || s.Type == HighLatency) && s.Window > 0 {
 		ss = append(ss, "window="+strconv.Itoa(s.Window))
 	}
 
@@ -124,6 +139,18 @@ func (s BreakerSettings) String() string {
 		ss = append(ss, "failures="+strconv.Itoa(s.Failures))
 	}
 
+	if s.Latency > 0 {
+		ss = append(ss, "latency="+s.Latency.String())
+	}
+
+	if s.Percentile > 0 {
+		ss = append(ss, "percentile="+strconv.FormatFloat(s.Percentile, 'f', -1, 64))
+	}
+
+	if s.SlowRatio > 0 {
+		ss = append(ss, "slow-ratio="+strconv.FormatFloat(s.SlowRatio, 'f', -1, 64))
+	}
+
 	if s.Timeout > 0 {
 		ss = append(ss, "timeout="+s.Timeout.String())
 	}
@@ -150,6 +177,8 @@ func newBreaker(s BreakerSettings) *Breaker {
 		impl = newConsecutive(s)
 	case FailureRate:
 		impl = newRate(s)
+	case HighLatency:
+		impl = newLatency(s)
 	default:
 		impl = voidBreaker{}
 	}
@@ -127,6 +127,92 @@ func TestRateBreaker(t *testing.T) {
 	})
 }
 
+func TestLatencyBreaker(t *testing.T) {
+	s := BreakerSettings{
+		Type:             HighLatency,
+		Window:           10,
+		Latency:          100 * time.Millisecond,
+		Percentile:       80,
+		HalfOpenRequests: 3,
+		Timeout:          3 * time.Millisecond,
+	}
+
+	newLatencyBreaker := func(s BreakerSettings) (*Breaker, *time.Time) {
+		b := newBreaker(s)
+		now := time.Now()
+		b.impl.(*latencyBreaker).now = func() time.Time { return now }
+		return b, &now
+	}
+
+	request := func(t *testing.T, b *Breaker, now *time.Time, latency time.Duration) func() {
+		return func() {
+			done, ok := b.Allow()
+			if !ok {
+				t.Error("breaker is unexpectedly open")
+				return
+			}
+
+			*now = now.Add(latency)
+			done(true)
+		}
+	}
+
+	t.Run("new breaker closed", func(t *testing.T) {
+		b, _ := newLatencyBreaker(s)
+		checkClosed(t, b)
+	})
+
+	t.Run("does not open when the percentile is below the threshold", func(t *testing.T) {
+		b, now := newLatencyBreaker(s)
+		times(8, request(t, b, now, 10*time.Millisecond))
+		times(2, request(t, b, now, time.Second))
+		checkClosed(t, b)
+	})
+
+	t.Run("opens when the percentile exceeds the threshold", func(t *testing.T) {
+		b, now := newLatencyBreaker(s)
+		times(7, request(t, b, now, 10*time.Millisecond))
+		times(3, request(t, b, now, time.Second))
+		checkOpen(t, b)
+	})
+
+	t.Run("opens when the slow ratio exceeds the limit", func(t *testing.T) {
+		s := s
+		s.Percentile = 0
+		s.SlowRatio = 0.5
+
+		b, now := newLatencyBreaker(s)
+		times(5, request(t, b, now, time.Second))
+		checkClosed(t, b)
+		times(1, request(t, b, now, time.Second))
+		checkOpen(t, b)
+	})
+
+	t.Run("failures count as slow", func(t *testing.T) {
+		b, _ := newLatencyBreaker(s)
+		times(3, fail(t, b))
+		checkOpen(t, b)
+	})
+
+	t.Run("go half open, close after required fast requests", func(t *testing.T) {
+		b, now := newLatencyBreaker(s)
+		times(3, request(t, b, now, time.Second))
+		*now = now.Add(s.Timeout)
+		time.Sleep(s.Timeout)
+		times(s.HalfOpenRequests, request(t, b, now, 10*time.Millisecond))
+		checkClosed(t, b)
+	})
+
+	t.Run("go half open, reopen after a slow request", func(t *testing.T) {
+		b, now := newLatencyBreaker(s)
+		times(3, request(t, b, now, time.Second))
+		time.Sleep(s.Timeout)
+		times(s.HalfOpenRequests-1, request(t, b, now, 10*time.Millisecond))
+		times(1, request(t, b, now, time.Second))
+		checkOpen(t, b)
+	})
+}
+
 // no checks, used for race detector
 func TestRateBreakerFuzzy(t *testing.T) {
 	if testing.Short() {
@@ -203,3 +289,21 @@ func TestSettingsString(t *testing.T) {
 		t.Logf("expected: %s", expect)
 	}
 }
+
+func TestLatencySettingsString(t *testing.T) {
+	s := BreakerSettings{
+		Type:       HighLatency,
+		Window:     300,
+		Latency:    500 * time.Millisecond,
+		Percentile: 99.9,
+		Timeout:    time.Minute,
+	}
+
+	ss := s.String()
+	expect := "type=latency,window=300,latency=500ms,percentile=99.9,timeout=1m0s"
+	if ss != expect {
+		t.Error("invalid breaker settings string")
+		t.Logf("got     : %s", ss)
+		t.Logf("expected: %s", expect)
+	}
+}
@@ -1,7 +1,7 @@
 /*
 Package circuit implements circuit breaker functionality for the proxy.
 
-It provides two types of circuit breakers: consecutive and failure rate based. The circuit breakers can be
+It provides three types of circuit breakers: consecutive, failure rate and latency based. The circuit breakers can be
 configured either globally, based on hosts or individual routes. The registry ensures synchronized access to the
 active breakers and the recycling of the idle ones.
 
@@ -24,6 +24,15 @@ for going open, it maintains a sliding window of the last M events, both success
 when the number of failures reaches N within the window. This way the sliding window is not time based and
 allows the same breaker characteristics for high and low rate traffic.
 
+# Breaker Type - Latency
+
+The "latency breaker" maintains a sliding window of the last M requests, like the rate breaker, but it counts the
+slow requests, whose latency exceeds a threshold, instead of the failures. It opens when the latency of the
+configured percentile exceeds the threshold, or alternatively, when the ratio of the slow requests exceeds the
+configured ratio within the window. The two conditions are equivalent: the 99th percentile exceeds the threshold
+when more than 1% of the requests are slow. Failed requests count as slow requests. In the half-open state, a
+single slow request opens the breaker again.
+
 # Usage
 
 When imported as a package, the Registry can be used to hold the circuit breakers and their settings. On a
@@ -41,6 +50,10 @@ To set only the type of the breaker globally, and the rates individually for the
 		-breaker host=foo.example.org,window=300,failures=30 \
 		-breaker host=bar.example.org,window=120,failures=45
 
+To open the breaker of a host when the 99th percentile latency of the last 1000 requests exceeds 500ms:
+
+	skipper -breaker type=latency,host=foo.example.org,window=1000,latency=500ms,percentile=99
+
 To enable circuit breakers only for specific hosts:
 
 	skipper -breaker type=disabled \
@@ -65,11 +78,11 @@ route based values happens with filters in the route definitions.
 
 # Settings - Type
 
-It can be ConsecutiveFailures, FailureRate or Disabled, where the first two values select which breaker to use,
+It can be ConsecutiveFailures, FailureRate, HighLatency or Disabled, where the first three values select which breaker to use,
 while the Disabled value can override a global or host configuration disabling the circuit breaker for the
 specific host or route.
 
-Command line name: type. Possible command line values: consecutive, rate, disabled.
+Command line name: type. Possible command line values: consecutive, rate, latency, disabled.
 
 # Settings - Host
 
@@ -80,7 +93,7 @@ Command line name: host.
 
 # Settings - Window
 
-The window value sets the size of the sliding counter window of the failure rate breaker.
+The window value sets the size of the sliding counter window of the failure rate and the latency breakers.
 
 Command line name: window. Possible command line values: any positive integer.
 
@@ -90,6 +103,26 @@ The failures value sets the max failure count for both the "consecutive" and "ra
 
 Command line name: failures. Possible command line values: any positive integer.
 
+# Settings - Latency
+
+The latency value sets the threshold of the latency breaker, above which a request counts as slow.
+
+Command line name: latency. Possible command line values: a duration string, e.g. 500ms.
+
+# Settings - Percentile
+
+The percentile value sets the percentile of the latency, which may not exceed the threshold of the latency
+breaker. Either the percentile or the slow ratio is required for the latency breaker.
+
+Command line name: percentile. Possible command line values: a number between 0 and 100, e.g. 99.9.
+
+# Settings - Slow Ratio
+
+The slow ratio sets the ratio of the requests within the window, which may exceed the threshold of the latency
+breaker.
+
+Command line name: slow-ratio. Possible command line values: a number between 0 and 1, e.g. 0.1.
+
 # Settings - Timeout
 
 With the timeout we can set how long the breaker should stay open, before becoming half-open.
@@ -112,7 +145,8 @@ string, e.g. 15m30s.
 
 # Filters
 
-The following circuit breaker filters are supported: consecutiveBreaker(), rateBreaker() and disableBreaker().
+The following circuit breaker filters are supported: consecutiveBreaker(), rateBreaker(), latencyBreaker() and
+disableBreaker().
 
 The consecutiveBreaker filter expects one mandatory parameter: the number of consecutive failures to open. It
 accepts the following optional arguments: timeout, half-open requests, idle-ttl.
@@ -124,6 +158,12 @@ of the sliding window. It accepts the following optional arguments: timeout, hal
 
 	rateBreaker(30, 300, "1m", 12, "30m")
 
+The latencyBreaker filter expects three mandatory parameters: the latency threshold, the percentile in the form of
+"p99", or the ratio of the slow requests, and the size of the sliding window. It accepts the following optional
+arguments: timeout, half-open requests, idle-ttl.
+
+	latencyBreaker("500ms", "p99", 1000, "1m", 12, "30m")
+
 The disableBreaker filter doesn't expect any arguments, and it disables the circuit breaker, if any, for the
 route that it appears in.
 
@@ -0,0 +1,96 @@
+package circuit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/sony/gobreaker"
+)
+
+// latencyBreaker counts the slow requests within the sliding window,
+// where failed requests count as slow, too. The p-th percentile latency
+// exceeds the threshold exactly when more than (100-p)% of the requests
+// are slower than the threshold, so both the percentile and the slow
+// ratio settings translate to the allowed fraction of slow requests.
+type latencyBreaker struct {
+	settings BreakerSettings
+	maxSlow  int
+	now      func() time.Time
+	mu       sync.Mutex
+	sampler  *binarySampler
+	gb       *gobreaker.TwoStepCircuitBreaker
+}
+
+func newLatency(s BreakerSettings) *latencyBreaker {
+	b := &latencyBreaker{
+		settings: s,
+		now:      time.Now,
+	}
+
+	ratio := s.SlowRatio
+	if s.Percentile > 0 {
+		ratio = (100 - s.Percentile) / 100
+	}
+
+	// the tolerance prevents that rounding errors would lower the
+	// number of the allowed slow requests, e.g. with the 99.9th percentile
+	b.maxSlow = int(math.Floor(ratio*float64(max(s.Window, 1)) + 1e-9))
+
+	b.gb = gobreaker.NewTwoStepCircuitBreaker(gobreaker.Settings{
+		Name:        s.Host,
+		MaxRequests: uint32(s.HalfOpenRequests),
+		Timeout:     s.Timeout,
+		ReadyToTrip: func(gobreaker.Counts) bool { return b.readyToTrip() },
+		OnStateChange: func(name string, from gobreaker.State, to gobreaker.State) {
+			log.Infof("circuit breaker %v went from %v to %v", name, from.String(), to.String())
+		},
+	})
+
+	return b
+}
+
+func (b *latencyBreaker) readyToTrip() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.sampler == nil {
+		return false
+	}
+
+	return b.sampler.count > b.maxSlow
+}
+
+// count the slow requests in closed and half-open state
+func (b *latencyBreaker) countSlow(slow bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.sampler == nil {
+		b.sampler = newBinarySampler(b.settings.Window)
+	}
+
+	b.sampler.tick(slow)
+}
+
+func (b *latencyBreaker) Allow() (func(bool), bool) {
+	done, err := b.gb.Allow()
+
+	// this error can only indicate that the breaker is not closed
+	closed := err == nil
+
+	if !closed {
+		return nil, false
+	}
+
+	start := b.now()
+	return func(success bool) {
+		slow := !success || b.now().Sub(start) > b.settings.Latency
+		b.countSlow(slow)
+
+		// in half-open state, a slow request opens the breaker again
+		done(!slow)
+	}, true
+}
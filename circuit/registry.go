@@ -10,6 +10,7 @@ const DefaultIdleTTL = time.Hour
 // Registry objects hold the active circuit breakers, ensure synchronized access to them, apply default settings
 // and recycle the idle breakers.
 type Registry struct {
+	settingsMu   sync.RWMutex
 	defaults     BreakerSettings
 	hostSettings map[string]BreakerSettings
 	mu           sync.Mutex
@@ -19,6 +20,27 @@ type Registry struct {
 // NewRegistry initializes a registry with the provided default settings. Settings with an empty Host field are
 // considered as defaults. Settings with the same Host field are merged together.
 func NewRegistry(settings ...BreakerSettings) *Registry {
+	defaults, hs := mergeRegistrySettings(settings)
+	return &Registry{
+		defaults:     defaults,
+		hostSettings: hs,
+		lookup:       make(map[BreakerSettings]*Breaker),
+	}
+}
+
+// UpdateSettings replaces the default and host specific settings of the registry, the same way as they are
+// initialized by NewRegistry. The breakers created with the previous settings are not used anymore, and they
+// are recycled when idle.
+func (r *Registry) UpdateSettings(settings ...BreakerSettings) {
+	defaults, hs := mergeRegistrySettings(settings)
+
+	r.settingsMu.Lock()
+	defer r.settingsMu.Unlock()
+	r.defaults = defaults
+	r.hostSettings = hs
+}
+
+func mergeRegistrySettings(settings []BreakerSettings) (BreakerSettings, map[string]BreakerSettings) {
 	var (
 		defaults     BreakerSettings
 		hostSettings []BreakerSettings
@@ -46,14 +68,13 @@ func NewRegistry(settings ...BreakerSettings) *Registry {
 		}
 	}
 
-	return &Registry{
-		defaults:     defaults,
-		hostSettings: hs,
-		lookup:       make(map[BreakerSettings]*Breaker),
-	}
+	return defaults, hs
 }
 
 func (r *Registry) mergeDefaults(s BreakerSettings) BreakerSettings {
+	r.settingsMu.RLock()
+	defer r.settingsMu.RUnlock()
+
 	defaults, ok := r.hostSettings[s.Host]
 	if !ok {
 		defaults = r.defaults
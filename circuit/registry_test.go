@@ -318,3 +318,30 @@ func TestIndividualIdle(t *testing.T) {
 		shouldBeClosed(t, "foo")
 	})
 }
+
+func TestRegistryUpdateSettings(t *testing.T) {
+	r := NewRegistry(
+		BreakerSettings{Type: ConsecutiveFailures, Failures: 5},
+		BreakerSettings{Host: "foo", Type: ConsecutiveFailures, Failures: 3},
+	)
+
+	if b := r.Get(BreakerSettings{Host: "foo"}); b == nil || b.settings.Failures != 3 {
+		t.Fatal("failed to get breaker with the initial host settings")
+	}
+
+	r.UpdateSettings(BreakerSettings{Type: ConsecutiveFailures, Failures: 7})
+
+	b := r.Get(BreakerSettings{Host: "foo"})
+	if b == nil || b.settings.Failures != 7 {
+		t.Error("failed to get breaker with the updated default settings")
+	}
+
+	if b.settings.IdleTTL != DefaultIdleTTL {
+		t.Error("failed to apply the default idle TTL")
+	}
+
+	r.UpdateSettings()
+	if r.Get(BreakerSettings{Host: "foo"}) != nil {
+		t.Error("unexpected breaker after removing the settings")
+	}
+}
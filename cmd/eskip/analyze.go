@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/apiusagemonitoring"
+	"github.com/zalando/skipper/filters/auth"
+	"github.com/zalando/skipper/filters/block"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/filters/cache"
+	canaryfilter "github.com/zalando/skipper/filters/canary"
+	geoipfilter "github.com/zalando/skipper/filters/geoip"
+	logfilter "github.com/zalando/skipper/filters/log"
+	ratelimitfilters "github.com/zalando/skipper/filters/ratelimit"
+	"github.com/zalando/skipper/filters/shedder"
+	tlsfilters "github.com/zalando/skipper/filters/tls"
+	"github.com/zalando/skipper/filters/waf"
+	"github.com/zalando/skipper/net"
+	builtinpredicates "github.com/zalando/skipper/predicates/builtin"
+	canarypredicate "github.com/zalando/skipper/predicates/canary"
+	geoippredicate "github.com/zalando/skipper/predicates/geoip"
+	"github.com/zalando/skipper/ratelimit"
+	"github.com/zalando/skipper/routing"
+)
+
+var errRouteAnalysis = errors.New("one or more problems found in the routes")
+
+// runtimeFilters returns the filters that skipper registers on startup,
+// depending on its configuration, created without their runtime
+// dependencies. Creating them validates the arguments without contacting
+// any external service.
+func runtimeFilters() []filters.Spec {
+	ratelimits := ratelimit.NewRegistry()
+	provider := ratelimitfilters.NewRatelimitProvider(ratelimits)
+
+	// the URL is not contacted when creating the filters
+	tokeninfo := auth.TokeninfoOptions{URL: "http://127.0.0.1/oauth2/tokeninfo"}
+
+	grant := &auth.OAuthConfig{}
+
+	return []filters.Spec{
+		logfilter.NewAuditLog(0),
+		block.NewBlock(0),
+		block.NewBlockHex(0),
+		waf.NewWAF(waf.Options{}),
+		auth.NewBearerInjector(nil),
+		auth.NewSetRequestHeaderFromSecret(nil),
+		auth.NewJwtMetrics(),
+		auth.NewOAuthTokeninfoAllScopeWithOptions(tokeninfo),
+		auth.NewOAuthTokeninfoAnyScopeWithOptions(tokeninfo),
+		auth.NewOAuthTokeninfoAllKVWithOptions(tokeninfo),
+		auth.NewOAuthTokeninfoAnyKVWithOptions(tokeninfo),
+		auth.NewOAuthTokeninfoValidate(tokeninfo),
+		auth.WebhookWithOptions(auth.WebhookOptions{}),
+		auth.NewOIDCQueryClaimsFilter(),
+		grant.NewGrant(),
+		grant.NewGrantCallback(),
+		grant.NewGrantClaimsQuery(),
+		grant.NewGrantLogout(),
+		grant.NewCSRFProtect(),
+		apiusagemonitoring.NewApiUsageMonitoring(true, "", "", ""),
+		shedder.NewAdmissionControl(shedder.Options{}),
+		ratelimitfilters.NewFailClosed(),
+		ratelimitfilters.NewClientRatelimit(provider),
+		ratelimitfilters.NewLocalRatelimit(provider),
+		ratelimitfilters.NewRatelimit(provider),
+		ratelimitfilters.NewShardedClusterRateLimit(provider, 1),
+		ratelimitfilters.NewClusterClientRateLimit(provider),
+		ratelimitfilters.NewDisableRatelimit(provider),
+		ratelimitfilters.NewBackendRatelimit(),
+		ratelimitfilters.NewConcurrencyLimit(),
+		ratelimitfilters.NewClusterLeakyBucketRatelimit(ratelimits),
+		ratelimitfilters.NewClusterConcurrencyLimit(ratelimits),
+		cache.NewCacheFilter(0, "", net.Options{}),
+		tlsfilters.NewMtlsAuthn(nil, nil),
+		// the database is not used for the validation of the arguments
+		geoipfilter.NewHeaders(nil),
+		// the registry is not needed for the validation of the arguments
+		canaryfilter.New(),
+		canaryfilter.NewBaseline(),
+	}
+}
+
+// unvalidatedFilters lists the filters whose arguments can be validated
+// only with their runtime dependencies: creating them contacts the
+// OpenID provider or the JWKS endpoint given in the arguments, or starts
+// an Open Policy Agent instance. The check accepts them with any
+// arguments.
+var unvalidatedFilters = []string{
+	filters.OAuthTokenintrospectionAnyClaimsName,
+	filters.OAuthTokenintrospectionAllClaimsName,
+	filters.OAuthTokenintrospectionAnyKVName,
+	filters.OAuthTokenintrospectionAllKVName,
+	filters.SecureOAuthTokenintrospectionAnyClaimsName,
+	filters.SecureOAuthTokenintrospectionAllClaimsName,
+	filters.SecureOAuthTokenintrospectionAnyKVName,
+	filters.SecureOAuthTokenintrospectionAllKVName,
+	filters.JwtValidationName,
+	filters.JwtValidationKeysName,
+	filters.OAuthOidcUserInfoName,
+	filters.OAuthOidcAnyClaimsName,
+	filters.OAuthOidcAllClaimsName,
+	filters.OpaAuthorizeRequestName,
+	filters.OpaAuthorizeRequestWithBodyName,
+	filters.OpaServeResponseName,
+	filters.OpaServeResponseWithReqBodyName,
+}
+
+type unvalidatedFilterSpec struct {
+	name string
+}
+
+type unvalidatedFilter struct{}
+
+func (s unvalidatedFilterSpec) Name() string { return s.name }
+
+func (s unvalidatedFilterSpec) CreateFilter([]interface{}) (filters.Filter, error) {
+	return unvalidatedFilter{}, nil
+}
+
+func (unvalidatedFilter) Request(filters.FilterContext)  {}
+func (unvalidatedFilter) Response(filters.FilterContext) {}
+
+func checkFilterRegistry() filters.Registry {
+	r := builtin.MakeRegistry()
+	for _, s := range runtimeFilters() {
+		r.Register(s)
+	}
+
+	for _, name := range unvalidatedFilters {
+		if _, ok := r[name]; !ok {
+			r.Register(unvalidatedFilterSpec{name: name})
+		}
+	}
+
+	return r
+}
+
+// the predicates bundled with skipper, and the ones depending on its
+// runtime configuration
+func checkPredicates() []routing.PredicateSpec {
+	return append(
+		builtinpredicates.Predicates(),
+		// the database is not used for the validation of the arguments
+		geoippredicate.New(nil),
+		// the registry is not needed for the validation of the arguments
+		canarypredicate.New(nil),
+	)
+}
+
+// analyzeRoutes prints the unknown filters and predicates, the invalid
+// arguments, and the shadowed and ambiguous routes, and returns an
+// error if there was any. When allowUnknown is set, the unknown filters
+// and predicates, e.g. custom or plugin ones, are printed as warnings.
+func analyzeRoutes(routes []*eskip.Route, allowUnknown bool) error {
+	findings := routing.Analyze(&routing.Options{
+		FilterRegistry: checkFilterRegistry(),
+		Predicates:     checkPredicates(),
+	}, routes)
+
+	var failed bool
+	for _, f := range findings {
+		if allowUnknown && (f.Type == routing.FindingUnknownFilter || f.Type == routing.FindingUnknownPredicate) {
+			printStderr("warning: " + f.String())
+			continue
+		}
+
+		failed = true
+		printStderr(f.String())
+	}
+
+	if failed {
+		return errRouteAnalysis
+	}
+
+	return nil
+}
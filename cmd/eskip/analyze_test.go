@@ -0,0 +1,58 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/zalando/skipper/filters"
+)
+
+// filters that are not meant to be used in routes
+var internalFilters = map[string]bool{
+	filters.UnknownRatelimitName: true,
+}
+
+// TestCheckFiltersComplete makes sure that eskip check knows all the
+// filters declared by the filters package, including the ones that
+// skipper creates only at runtime.
+func TestCheckFiltersComplete(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "../../filters/filters.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry := checkFilterRegistry()
+	for _, d := range f.Decls {
+		g, ok := d.(*ast.GenDecl)
+		if !ok || g.Tok != token.CONST {
+			continue
+		}
+
+		for _, s := range g.Specs {
+			vs := s.(*ast.ValueSpec)
+			for i, n := range vs.Names {
+				if i >= len(vs.Values) || !strings.HasSuffix(n.Name, "Name") && n.Name != "MtlsAuthn" {
+					continue
+				}
+
+				lit, ok := vs.Values[i].(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					continue
+				}
+
+				name, err := strconv.Unquote(lit.Value)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if _, ok := registry[name]; !ok && !internalFilters[name] {
+					t.Errorf("filter %s (filters.%s) is unknown to eskip check", name, n.Name)
+				}
+			}
+		}
+	}
+}
@@ -41,6 +41,15 @@ const (
 	prettyFlag         = "pretty"
 	indentStrFlag      = "indent"
 	jsonFlag           = "json"
+	backendFlag        = "backend"
+	formatFlag         = "format"
+	rgNameFlag         = "routegroup-name"
+	rgNamespaceFlag    = "routegroup-namespace"
+	rgHostsFlag        = "routegroup-hosts"
+	writeFlag          = "w"
+	checkFormatFlag    = "check"
+	sortFlag           = "sort"
+	allowUnknownFlag   = "allow-unknown"
 
 	defaultEtcdUrls     = "http://127.0.0.1:2379,http://127.0.0.1:4001"
 	defaultEtcdPrefix   = "/skipper"
@@ -77,6 +86,15 @@ var (
 	pretty            bool
 	indentStr         string
 	printJson         bool
+	backendArg        string
+	formatArg         string
+	rgName            string
+	rgNamespace       string
+	rgHosts           string
+	writeFormatted    bool
+	checkFormatted    bool
+	sortRoutes        bool
+	allowUnknown      bool
 )
 
 var (
@@ -112,6 +130,18 @@ func initFlags() {
 	flags.BoolVar(&pretty, prettyFlag, false, prettyUsage)
 	flags.StringVar(&indentStr, indentStrFlag, "  ", indentStrUsage)
 	flags.BoolVar(&printJson, jsonFlag, false, jsonUsage)
+
+	flags.StringVar(&backendArg, backendFlag, "", backendUsage)
+	flags.StringVar(&formatArg, formatFlag, "", formatUsage)
+	flags.StringVar(&rgName, rgNameFlag, "", rgNameUsage)
+	flags.StringVar(&rgNamespace, rgNamespaceFlag, "", rgNamespaceUsage)
+	flags.StringVar(&rgHosts, rgHostsFlag, "", rgHostsUsage)
+
+	flags.BoolVar(&writeFormatted, writeFlag, false, writeUsage)
+	flags.BoolVar(&checkFormatted, checkFormatFlag, false, checkFormatUsage)
+	flags.BoolVar(&sortRoutes, sortFlag, false, sortUsage)
+
+	flags.BoolVar(&allowUnknown, allowUnknownFlag, false, allowUnknownUsage)
 }
 
 func init() {
@@ -193,9 +223,31 @@ func processInnkeeperArgs(innkeeperUrl, oauthToken string) (*medium, error) {
 		oauthToken: oauthToken}, nil
 }
 
+// parses the flags, allowing them also after the positional
+// parameters, and returns the positional parameters.
+func parseFlags(args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+
+		rest := flags.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+
+		if len(rest) == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
 // returns file type medium if a positional parameter is defined.
-func processFileArg() (*medium, error) {
-	nonFlagArgs := flags.Args()
+func processFileArg(nonFlagArgs []string) (*medium, error) {
 	if len(nonFlagArgs) > 1 {
 		return nil, errInvalidNumberOfArgs
 	}
@@ -254,8 +306,8 @@ func processPatchArgs(pfilters, pfile, afilters, afile string) []*medium {
 }
 
 // returns media detected from the executing command.
-func processArgs() ([]*medium, error) {
-	err := flags.Parse(os.Args[2:])
+func processArgs(args []string) ([]*medium, error) {
+	nonFlagArgs, err := parseFlags(args)
 	if err != nil {
 		return nil, err
 	}
@@ -293,7 +345,7 @@ func processArgs() ([]*medium, error) {
 			ids: strings.Split(inlineRouteIds, ",")})
 	}
 
-	fileArg, err := processFileArg()
+	fileArg, err := processFileArg(nonFlagArgs)
 	if err != nil {
 		return nil, err
 	}
@@ -177,9 +177,31 @@ func TestProcessArgs(t *testing.T) {
 		[]*medium{{
 			typ:  file,
 			path: "file1"}},
+	}, {
+
+		// flags after file
+		[]string{"file1", "-routes", `* -> <shunt>`},
+		false,
+		nil,
+		[]*medium{{
+			typ:   inline,
+			eskip: `* -> <shunt>`}, {
+			typ:  file,
+			path: "file1"}},
+	}, {
+
+		// file after terminator
+		[]string{"-routes", `* -> <shunt>`, "--", "-file1"},
+		false,
+		nil,
+		[]*medium{{
+			typ:   inline,
+			eskip: `* -> <shunt>`}, {
+			typ:  file,
+			path: "-file1"}},
 	}} {
 		preserveArgs(item.args, func() {
-			media, err := processArgs()
+			media, err := processArgs(os.Args[2:])
 			if item.fail {
 				if err == nil {
 					t.Error("failed to fail", i)
@@ -14,7 +14,8 @@
 
 /*
 This utility can be used to verify, print, update or delete eskip
-formatted routes from and to different data sources.
+formatted routes from and to different data sources, to generate them
+from an OpenAPI document, or to format eskip files.
 
 For command line help, enter:
 
@@ -22,10 +23,16 @@ For command line help, enter:
 
 # Examples
 
-Check if an eskip file has valid syntax:
+Check if an eskip file has valid syntax, and has no unknown filters or
+predicates, invalid arguments, or routes shadowed by other routes:
 
 	eskip check routes.eskip
 
+Check an eskip file using custom or plugin filters and predicates, that
+are reported as warnings:
+
+	eskip check -allow-unknown routes.eskip
+
 Print routes stored in etcd:
 
 	eskip print -etcd-urls https://etcd.example.org
@@ -34,6 +41,15 @@ Print routes as JSON:
 
 	eskip print -json
 
+Generate routes from an OpenAPI document, as a RouteGroup manifest:
+
+	eskip generate openapi spec.yaml -backend http://svc -format routegroup
+
+Format an eskip file in place, or check in CI that it is formatted:
+
+	eskip fmt -w routes.eskip
+	eskip fmt -check routes.eskip
+
 Insert/update routes in etcd from an eskip file:
 
 	eskip upsert routes.eskip
@@ -85,11 +101,20 @@ const (
 	prettyUsage         = "prints routes in a more readable format"
 	indentStrUsage      = "indent string used in pretty printing. Must match regexp \\s"
 	jsonUsage           = "prints routes as JSON"
+	backendUsage        = "backend address of the generated routes"
+	formatUsage         = "output format of the generated routes: eskip, json or routegroup"
+	rgNameUsage         = "name of the generated RouteGroup, defaults to the title of the API"
+	rgNamespaceUsage    = "namespace of the generated RouteGroup"
+	rgHostsUsage        = "comma separated hosts of the generated RouteGroup"
+	writeUsage          = "fmt: write the formatted routes to the input file"
+	checkFormatUsage    = "fmt: fail when the input is not formatted"
+	sortUsage           = "fmt: sort the routes by their id"
+	allowUnknownUsage   = "check: report unknown filters and predicates, e.g. custom or plugin ones, as warnings"
 
 	// command line help (1):
 	help1 = `Usage: eskip <command> [media flags] [--] [file]
-Commands: check|print|upsert|reset|delete|patch
-Verify, print, update or delete Skipper routes.
+Commands: check|print|upsert|reset|delete|patch|generate|fmt
+Verify, print, update, delete, generate or format Skipper routes.
 See more: https://github.com/zalando/skipper
 
 Media types:
@@ -121,8 +146,13 @@ Media flags:
 	help2 = `
 Commands:
 
-check    verifies the syntax of routes. Accepts one input medium
-         of the following types: etcd (default), stdin, file, inline.
+check    verifies the syntax of routes, the names and arguments of
+         the filters and predicates, and reports the routes that are
+         shadowed by other routes, or that match the same requests with
+         the same weight. Accepts one input medium of the following
+         types: etcd (default), stdin, file, inline. With
+         -allow-unknown, the unknown filters and predicates, e.g.
+         custom or plugin ones, are reported as warnings.
          Example:
          eskip check -etcd-urls http://etcd.example.org
 
@@ -147,6 +177,22 @@ patch    takes a list of routes as input from any media except of inline
 		 route. Example:
 		 eskip patch -append 'filter1() -> filter2()'
 
+generate generates routes from an API description. The only
+         supported generator is openapi, that expects an OpenAPI 3
+         document from a file or stdin, and generates one route per
+         operation. The filters of the routes can be set with the
+         x-skipper-filters extension of the document, the path items or
+         the operations. The routes can be printed as eskip, JSON or a
+         RouteGroup manifest. Example:
+         eskip generate openapi spec.yaml -backend http://svc
+
+fmt      formats an eskip document from a file or stdin in the canonical
+         form, keeping the comments. Prints the formatted document, or
+         with -w, writes it back to the file. With -check, fails when
+         the document is not formatted. With -sort, sorts the routes by
+         their id. Example:
+         eskip fmt -w routes.eskip
+
 version  print eskip version
 `
 )
@@ -27,13 +27,15 @@ type (
 )
 
 const (
-	check  command = "check"
-	print  command = "print"
-	upsert command = "upsert"
-	reset  command = "reset"
-	delete command = "delete"
-	patch  command = "patch"
-	ver    command = "version"
+	check    command = "check"
+	print    command = "print"
+	upsert   command = "upsert"
+	reset    command = "reset"
+	delete   command = "delete"
+	patch    command = "patch"
+	generate command = "generate"
+	format   command = "fmt"
+	ver      command = "version"
 )
 
 var (
@@ -43,13 +45,15 @@ var (
 
 // map command string to command function
 var commands = map[command]commandFunc{
-	check:  checkCmd,
-	print:  printCmd,
-	upsert: upsertCmd,
-	reset:  resetCmd,
-	delete: deleteCmd,
-	patch:  patchCmd,
-	ver:    versionCmd}
+	check:    checkCmd,
+	print:    printCmd,
+	upsert:   upsertCmd,
+	reset:    resetCmd,
+	delete:   deleteCmd,
+	patch:    patchCmd,
+	generate: generateCmd,
+	format:   fmtCmd,
+	ver:      versionCmd}
 
 var (
 	errMissingCommand = errors.New("missing command")
@@ -131,8 +135,19 @@ func main() {
 		exit(nil)
 	}
 
+	args := os.Args[2:]
+	if cmd == generate {
+		// the generate command expects the name of the generator
+		// before the media flags:
+		if err := checkGenerator(args); err != nil {
+			exitHint(err)
+		}
+
+		args = args[1:]
+	}
+
 	// process arguments, not checking if they make any sense:
-	media, err := processArgs()
+	media, err := processArgs(args)
 	if err != nil {
 		exitHint(err)
 	}
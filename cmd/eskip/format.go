@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/zalando/skipper/eskip"
+)
+
+const stdinName = "<stdin>"
+
+var (
+	errNotFormatted   = errors.New("not formatted")
+	errWriteNeedsFile = errors.New("writing the formatted routes requires a file")
+	errWriteAndCheck  = errors.New("only one of -w and -check can be set")
+)
+
+func fmtCmd(a cmdArgs) error {
+	if writeFormatted && checkFormatted {
+		return errWriteAndCheck
+	}
+
+	if writeFormatted && a.in.typ != file {
+		return errWriteNeedsFile
+	}
+
+	data, err := readInput(a.in)
+	if err != nil {
+		return err
+	}
+
+	name := stdinName
+	if a.in.typ == file {
+		name = a.in.path
+	}
+
+	formatted, err := eskip.Format(string(data), eskip.FormatOptions{Name: name, SortRoutes: sortRoutes})
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case checkFormatted:
+		if formatted != string(data) {
+			return fmt.Errorf("%s: %w", name, errNotFormatted)
+		}
+
+		return nil
+	case writeFormatted:
+		if formatted == string(data) {
+			return nil
+		}
+
+		info, err := os.Stat(a.in.path)
+		if err != nil {
+			return err
+		}
+
+		return os.WriteFile(a.in.path, []byte(formatted), info.Mode().Perm())
+	default:
+		_, err := io.WriteString(stdout, formatted)
+		return err
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	testUnformatted = `r2: * -> <shunt>; r1: Path("/foo") // the path
+	-> "https://www.example.org"`
+	testFormatted = "r2: * -> <shunt>;\n\nr1: Path(\"/foo\") // the path\n  -> \"https://www.example.org\";\n"
+)
+
+func withFormatFlags(write, check, sort bool, f func()) {
+	defer func() {
+		writeFormatted, checkFormatted, sortRoutes = false, false, false
+	}()
+
+	writeFormatted, checkFormatted, sortRoutes = write, check, sort
+	f()
+}
+
+func writeTestFile(t *testing.T, content string) string {
+	t.Helper()
+
+	name := filepath.Join(t.TempDir(), "routes.eskip")
+	if err := os.WriteFile(name, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return name
+}
+
+func TestFormatPrint(t *testing.T) {
+	preserveOut := stdout
+	defer func() { stdout = preserveOut }()
+
+	buf := &bytes.Buffer{}
+	stdout = buf
+
+	name := writeTestFile(t, testUnformatted)
+	var err error
+	withFormatFlags(false, false, true, func() {
+		err = fmtCmd(cmdArgs{in: &medium{typ: file, path: name}})
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "r1: Path(\"/foo\") // the path\n  -> \"https://www.example.org\";\n\nr2: * -> <shunt>;\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected output:\n%s", buf.String())
+	}
+}
+
+func TestFormatWrite(t *testing.T) {
+	name := writeTestFile(t, testUnformatted)
+	var err error
+	withFormatFlags(true, false, false, func() {
+		err = fmtCmd(cmdArgs{in: &medium{typ: file, path: name}})
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != testFormatted {
+		t.Errorf("unexpected file content:\n%s", b)
+	}
+}
+
+func TestFormatCheck(t *testing.T) {
+	for _, tt := range []struct {
+		title   string
+		content string
+		err     error
+	}{{
+		title:   "formatted",
+		content: testFormatted,
+	}, {
+		title:   "not formatted",
+		content: testUnformatted,
+		err:     errNotFormatted,
+	}} {
+		t.Run(tt.title, func(t *testing.T) {
+			name := writeTestFile(t, tt.content)
+			var err error
+			withFormatFlags(false, true, false, func() {
+				err = fmtCmd(cmdArgs{in: &medium{typ: file, path: name}})
+			})
+
+			if !errors.Is(err, tt.err) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestFormatInvalidFlags(t *testing.T) {
+	var err error
+	withFormatFlags(true, false, false, func() {
+		err = fmtCmd(cmdArgs{in: &medium{typ: stdin}})
+	})
+
+	if err != errWriteNeedsFile {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	withFormatFlags(true, true, false, func() {
+		err = fmtCmd(cmdArgs{in: &medium{typ: file, path: "routes.eskip"}})
+	})
+
+	if err != errWriteAndCheck {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
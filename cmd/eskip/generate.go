@@ -0,0 +1,395 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/zalando/skipper/dataclients/kubernetes/definitions"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/predicates"
+)
+
+const (
+	openAPIGenerator = "openapi"
+
+	formatEskip      = "eskip"
+	formatJSON       = "json"
+	formatRouteGroup = "routegroup"
+
+	filtersExtension = "x-skipper-filters"
+)
+
+var (
+	errMissingGenerator = errors.New("missing generator")
+	errInvalidGenerator = errors.New("invalid generator")
+	errMissingBackend   = errors.New("missing backend")
+	errInvalidFormat    = errors.New("invalid format")
+	errNotOpenAPI3      = errors.New("not an OpenAPI 3 document")
+)
+
+// the methods in the order of the fields of the OpenAPI path items
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+var (
+	invalidIDChars   = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+	invalidNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+type openAPIDocument struct {
+	OpenAPI string `json:"openapi"`
+	Info    struct {
+		Title string `json:"title"`
+	} `json:"info"`
+	Servers []struct {
+		URL string `json:"url"`
+	} `json:"servers"`
+	Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	Filters json.RawMessage                       `json:"x-skipper-filters"`
+}
+
+type openAPIOperation struct {
+	OperationID string          `json:"operationId"`
+	Filters     json.RawMessage `json:"x-skipper-filters"`
+}
+
+// routeGroup is the manifest of a RouteGroup resource.
+type routeGroup struct {
+	APIVersion string                      `json:"apiVersion"`
+	Kind       string                      `json:"kind"`
+	Metadata   routeGroupMetadata          `json:"metadata"`
+	Spec       *definitions.RouteGroupSpec `json:"spec"`
+}
+
+type routeGroupMetadata struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// validate media from args for generate and fmt, expecting exactly one
+// file or stdin input.
+func validateSelectGenerate(media []*medium) (a cmdArgs, err error) {
+	if len(media) == 0 {
+		err = errMissingInput
+		return
+	}
+
+	if len(media) > 1 {
+		err = errTooManyInputs
+		return
+	}
+
+	switch media[0].typ {
+	case file, stdin:
+	default:
+		err = errInvalidInputType
+		return
+	}
+
+	a.in = media[0]
+	return
+}
+
+// checks the generator name in the arguments following the generate
+// command.
+func checkGenerator(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return errMissingGenerator
+	}
+
+	if args[0] != openAPIGenerator {
+		return errInvalidGenerator
+	}
+
+	return nil
+}
+
+func readInput(in *medium) ([]byte, error) {
+	if in.typ == stdin {
+		return io.ReadAll(os.Stdin)
+	}
+
+	return os.ReadFile(in.path)
+}
+
+// parses the filters defined by the x-skipper-filters extension. The
+// value can be a single filter chain, or a list of filters.
+func parseFilterExtension(raw json.RawMessage) ([]*eskip.Filter, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var chain string
+	if err := json.Unmarshal(raw, &chain); err != nil {
+		var list []string
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return nil, fmt.Errorf("%s must be a string or a list of strings", filtersExtension)
+		}
+
+		chain = strings.Join(list, " -> ")
+	}
+
+	return eskip.ParseFilters(chain)
+}
+
+// converts the OpenAPI path templates to the wildcards of the Path
+// predicate, e.g. /pets/{id} to /pets/:id.
+func pathTemplate(p string) (string, error) {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		if !strings.ContainsAny(s, "{}") {
+			continue
+		}
+
+		if len(s) < 3 || s[0] != '{' || s[len(s)-1] != '}' || strings.ContainsAny(s[1:len(s)-1], "{}") {
+			return "", fmt.Errorf("unsupported path template: %s", p)
+		}
+
+		segments[i] = ":" + s[1:len(s)-1]
+	}
+
+	return strings.Join(segments, "/"), nil
+}
+
+func serverPrefix(doc *openAPIDocument) (string, error) {
+	if len(doc.Servers) == 0 {
+		return "", nil
+	}
+
+	u, err := url.Parse(doc.Servers[0].URL)
+	if err != nil {
+		return "", err
+	}
+
+	return pathTemplate(strings.TrimSuffix(u.Path, "/"))
+}
+
+func routeID(operationID, method, path string) string {
+	id := operationID
+	if id == "" {
+		id = method + path
+	}
+
+	id = strings.Trim(invalidIDChars.ReplaceAllString(id, "_"), "_")
+	if id == "" || id[0] >= '0' && id[0] <= '9' {
+		id = "_" + id
+	}
+
+	return id
+}
+
+func uniqueID(ids map[string]bool, id string) string {
+	unique := id
+	for i := 2; ids[unique]; i++ {
+		unique = fmt.Sprintf("%s_%d", id, i)
+	}
+
+	ids[unique] = true
+	return unique
+}
+
+// generates one route per operation of an OpenAPI 3 document, matching
+// the path and the method of the operation. The filters are taken from
+// the x-skipper-filters extension of the document, the path item and
+// the operation, in this order.
+func generateOpenAPIRoutes(data []byte, backend string) ([]*eskip.Route, *openAPIDocument, error) {
+	var doc openAPIDocument
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, nil, errNotOpenAPI3
+	}
+
+	prefix, err := serverPrefix(&doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	docFilters, err := parseFilterExtension(doc.Filters)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	paths := make([]string, 0, len(doc.Paths))
+	for p := range doc.Paths {
+		paths = append(paths, p)
+	}
+
+	sort.Strings(paths)
+
+	var routes []*eskip.Route
+	ids := make(map[string]bool)
+	for _, p := range paths {
+		item := doc.Paths[p]
+		path, err := pathTemplate(p)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		pathFilters, err := parseFilterExtension(item[filtersExtension])
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", p, err)
+		}
+
+		for _, m := range openAPIMethods {
+			raw, ok := item[m]
+			if !ok {
+				continue
+			}
+
+			var op openAPIOperation
+			if err := json.Unmarshal(raw, &op); err != nil {
+				return nil, nil, fmt.Errorf("%s %s: %w", m, p, err)
+			}
+
+			opFilters, err := parseFilterExtension(op.Filters)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s %s: %w", m, p, err)
+			}
+
+			var filters []*eskip.Filter
+			for _, fs := range [][]*eskip.Filter{docFilters, pathFilters, opFilters} {
+				for _, f := range fs {
+					filters = append(filters, f.Copy())
+				}
+			}
+
+			routes = append(routes, &eskip.Route{
+				Id: uniqueID(ids, routeID(op.OperationID, m, p)),
+				Predicates: []*eskip.Predicate{
+					{Name: predicates.PathName, Args: []interface{}{prefix + path}},
+					{Name: predicates.MethodName, Args: []interface{}{strings.ToUpper(m)}},
+				},
+				Filters:     filters,
+				BackendType: eskip.NetworkBackend,
+				Backend:     backend,
+			})
+		}
+	}
+
+	return routes, &doc, nil
+}
+
+func routeGroupName(title string) string {
+	name := strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if name == "" {
+		return "api"
+	}
+
+	return name
+}
+
+// converts the generated routes to a RouteGroup with a single default
+// backend.
+func toRouteGroup(routes []*eskip.Route, backend, name, namespace string, hosts []string) *routeGroup {
+	const backendName = "backend"
+	spec := &definitions.RouteGroupSpec{
+		Hosts: hosts,
+		Backends: []*definitions.SkipperBackend{{
+			Name:    backendName,
+			Type:    eskip.NetworkBackend,
+			Address: backend,
+		}},
+		DefaultBackends: definitions.BackendReferences{{BackendName: backendName}},
+	}
+
+	for _, r := range routes {
+		rs := &definitions.RouteSpec{}
+		for _, p := range r.Predicates {
+			switch p.Name {
+			case predicates.PathName:
+				rs.Path = p.Args[0].(string)
+			case predicates.MethodName:
+				rs.Methods = append(rs.Methods, p.Args[0].(string))
+			}
+		}
+
+		for _, f := range r.Filters {
+			rs.Filters = append(rs.Filters, f.String())
+		}
+
+		spec.Routes = append(spec.Routes, rs)
+	}
+
+	return &routeGroup{
+		APIVersion: "zalando.org/v1",
+		Kind:       "RouteGroup",
+		Metadata:   routeGroupMetadata{Name: name, Namespace: namespace},
+		Spec:       spec,
+	}
+}
+
+func outputFormat() (string, error) {
+	switch formatArg {
+	case "":
+		if printJson {
+			return formatJSON, nil
+		}
+
+		return formatEskip, nil
+	case formatEskip, formatJSON, formatRouteGroup:
+		return formatArg, nil
+	default:
+		return "", errInvalidFormat
+	}
+}
+
+// command executed for generate.
+func generateCmd(a cmdArgs) error {
+	if backendArg == "" {
+		return errMissingBackend
+	}
+
+	format, err := outputFormat()
+	if err != nil {
+		return err
+	}
+
+	data, err := readInput(a.in)
+	if err != nil {
+		return err
+	}
+
+	routes, doc, err := generateOpenAPIRoutes(data, backendArg)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case formatJSON:
+		e := json.NewEncoder(stdout)
+		e.SetEscapeHTML(false)
+		return e.Encode(routes)
+	case formatRouteGroup:
+		name := rgName
+		if name == "" {
+			name = routeGroupName(doc.Info.Title)
+		}
+
+		var hosts []string
+		if rgHosts != "" {
+			hosts = strings.Split(rgHosts, ",")
+		}
+
+		b, err := yaml.Marshal(toRouteGroup(routes, backendArg, name, rgNamespace, hosts))
+		if err != nil {
+			return err
+		}
+
+		_, err = stdout.Write(b)
+		return err
+	default:
+		eskip.Fprint(stdout, eskip.PrettyPrintInfo{Pretty: pretty, IndentStr: indentStr}, routes...)
+		return nil
+	}
+}
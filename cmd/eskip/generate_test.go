@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/zalando/skipper/dataclients/kubernetes/definitions"
+	"github.com/zalando/skipper/eskip"
+)
+
+const testOpenAPIFile = "testdata/openapi.yaml"
+
+func withGenerateFlags(format string, f func()) {
+	defer func() {
+		backendArg, formatArg, rgName, rgNamespace, rgHosts = "", "", "", "", ""
+	}()
+
+	backendArg = "http://svc"
+	formatArg = format
+	f()
+}
+
+func generateOutput(t *testing.T, format string) string {
+	t.Helper()
+
+	preserveOut := stdout
+	defer func() { stdout = preserveOut }()
+
+	buf := &bytes.Buffer{}
+	stdout = buf
+
+	var err error
+	withGenerateFlags(format, func() {
+		err = generateCmd(cmdArgs{in: &medium{typ: file, path: testOpenAPIFile}})
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.String()
+}
+
+func TestGenerateOpenAPI(t *testing.T) {
+	expected := []string{
+		`listPets: Path("/v1/pets") && Method("GET") -> setRequestHeader("X-Api", "pets") -> "http://svc";`,
+		`create_pet: Path("/v1/pets") && Method("POST") -> setRequestHeader("X-Api", "pets") -> ratelimit(10, "1m") -> requireJSON() -> "http://svc";`,
+		`getPet: Path("/v1/pets/:id") && Method("GET") -> setRequestHeader("X-Api", "pets") -> setPath("/pet/${id}") -> "http://svc";`,
+		`delete_pets_id: Path("/v1/pets/:id") && Method("DELETE") -> setRequestHeader("X-Api", "pets") -> setPath("/pet/${id}") -> "http://svc";`,
+	}
+
+	out := generateOutput(t, "")
+	if strings.TrimSpace(out) != strings.Join(expected, "\n") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+
+	routes, err := eskip.Parse(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(routes) != len(expected) {
+		t.Errorf("expected %d routes, got: %d", len(expected), len(routes))
+	}
+}
+
+func TestGenerateOpenAPIJSON(t *testing.T) {
+	var routes []*eskip.Route
+	if err := yaml.Unmarshal([]byte(generateOutput(t, formatJSON)), &routes); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(routes) != 4 || routes[0].Id != "listPets" || routes[0].Backend != "http://svc" {
+		t.Errorf("unexpected routes: %v", routes)
+	}
+}
+
+func TestGenerateOpenAPIRouteGroup(t *testing.T) {
+	var rg struct {
+		Kind     string                      `json:"kind"`
+		Metadata definitions.Metadata        `json:"metadata"`
+		Spec     *definitions.RouteGroupSpec `json:"spec"`
+	}
+
+	if err := yaml.Unmarshal([]byte(generateOutput(t, formatRouteGroup)), &rg); err != nil {
+		t.Fatal(err)
+	}
+
+	if rg.Kind != "RouteGroup" || rg.Metadata.Name != "pet-store" {
+		t.Errorf("unexpected resource: %s %s", rg.Kind, rg.Metadata.Name)
+	}
+
+	if err := definitions.ValidateRouteGroup(&definitions.RouteGroupItem{Metadata: &rg.Metadata, Spec: rg.Spec}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rg.Spec.Routes) != 4 {
+		t.Fatalf("expected 4 routes, got: %d", len(rg.Spec.Routes))
+	}
+
+	r := rg.Spec.Routes[1]
+	if r.Path != "/v1/pets" || len(r.Methods) != 1 || r.Methods[0] != "POST" || len(r.Filters) != 3 || r.Filters[1] != `ratelimit(10, "1m")` {
+		t.Errorf("unexpected route: %+v", r)
+	}
+
+	if b := rg.Spec.Backends[0]; b.Type != eskip.NetworkBackend || b.Address != "http://svc" {
+		t.Errorf("unexpected backend: %+v", b)
+	}
+}
+
+func TestGenerateOpenAPIInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		document string
+	}{
+		{"invalid yaml", "openapi: [3"},
+		{"swagger 2", "swagger: \"2.0\"\npaths: {}"},
+		{"invalid filters", "openapi: 3.0.0\nx-skipper-filters: 'foo('\npaths: {}"},
+		{"invalid filter list", "openapi: 3.0.0\npaths:\n  /foo:\n    get:\n      x-skipper-filters: {foo: bar}"},
+		{"unsupported path template", "openapi: 3.0.0\npaths:\n  /foo/{name}.json:\n    get: {}"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, err := generateOpenAPIRoutes([]byte(tc.document), "http://svc"); err == nil {
+				t.Error("failed to fail")
+			}
+		})
+	}
+}
+
+func TestGenerateMissingBackend(t *testing.T) {
+	if err := generateCmd(cmdArgs{in: &medium{typ: file, path: testOpenAPIFile}}); err != errMissingBackend {
+		t.Errorf("expected missing backend, got: %v", err)
+	}
+}
+
+func TestCheckGenerator(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		err  error
+	}{
+		{nil, errMissingGenerator},
+		{[]string{"-backend", "http://svc"}, errMissingGenerator},
+		{[]string{"swagger"}, errInvalidGenerator},
+		{[]string{"openapi", "spec.yaml"}, nil},
+	} {
+		if err := checkGenerator(tc.args); err != tc.err {
+			t.Errorf("%v: expected %v, got: %v", tc.args, tc.err, err)
+		}
+	}
+}
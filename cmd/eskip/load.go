@@ -119,7 +119,12 @@ func checkCmd(a cmdArgs) error {
 		return err
 	}
 
-	return checkRepeatedRouteIds(routes)
+	err = checkRepeatedRouteIds(routes)
+	if err != nil {
+		return err
+	}
+
+	return analyzeRoutes(routes, allowUnknown)
 }
 
 // command executed for print.
@@ -207,6 +207,71 @@ func TestCheckDoc(t *testing.T) {
 	}
 }
 
+func TestCheckAnalysis(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		routes       string
+		allowUnknown bool
+		err          error
+	}{{
+		name:   "valid",
+		routes: `r1: Path("/foo") -> setPath("/bar") -> "https://www.example.org"; r2: Path("/foo") && Method("POST") -> <shunt>`,
+	}, {
+		name:   "runtime filter",
+		routes: `Path("/foo") -> oauthTokeninfoAnyScope("read") -> ratelimit(10, "1m") -> <shunt>`,
+	}, {
+		name:   "invalid runtime filter arguments",
+		routes: `Path("/foo") -> block() -> <shunt>`,
+		err:    errRouteAnalysis,
+	}, {
+		name:   "unvalidated filter",
+		routes: `Path("/foo") -> opaAuthorizeRequest(42, "foo", "bar") -> <shunt>`,
+	}, {
+		name:   "unknown filter",
+		routes: `Path("/foo") -> fooBar() -> <shunt>`,
+		err:    errRouteAnalysis,
+	}, {
+		name:   "unknown predicate",
+		routes: `Path("/foo") && FooBar() -> <shunt>`,
+		err:    errRouteAnalysis,
+	}, {
+		name:         "unknown filter allowed",
+		routes:       `Path("/foo") -> fooBar() -> <shunt>`,
+		allowUnknown: true,
+	}, {
+		name:         "unknown predicate allowed",
+		routes:       `Path("/foo") && FooBar() -> <shunt>`,
+		allowUnknown: true,
+	}, {
+		name:         "invalid filter arguments with unknown allowed",
+		routes:       `Path("/foo") -> setPath() -> <shunt>`,
+		allowUnknown: true,
+		err:          errRouteAnalysis,
+	}, {
+		name:   "invalid filter arguments",
+		routes: `Path("/foo") -> setPath() -> <shunt>`,
+		err:    errRouteAnalysis,
+	}, {
+		name:   "shadowed route",
+		routes: `r1: Path("/foo") && Weight(5) -> <shunt>; r2: Path("/foo") && Method("GET") -> <shunt>`,
+		err:    errRouteAnalysis,
+	}, {
+		name:   "ambiguous routes",
+		routes: `r1: Path("/foo") && Method("GET") -> <shunt>; r2: Path("/foo") && Method("GET") -> <shunt>`,
+		err:    errRouteAnalysis,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			defer func() { allowUnknown = false }()
+			allowUnknown = tc.allowUnknown
+
+			err := checkCmd(cmdArgs{in: &medium{typ: inline, eskip: tc.routes}})
+			if err != tc.err {
+				t.Errorf("expected error %v, got: %v", tc.err, err)
+			}
+		})
+	}
+}
+
 func TestPatch(t *testing.T) {
 	for _, ti := range []struct {
 		msg      string
@@ -38,12 +38,14 @@ const (
 )
 
 var commandToValidations = map[command]validateSelectFunc{
-	check:  validateSelectRead,
-	print:  validateSelectRead,
-	upsert: validateSelectWrite,
-	reset:  validateSelectWrite,
-	delete: validateSelectDelete,
-	patch:  validateSelectPatch}
+	check:    validateSelectRead,
+	print:    validateSelectRead,
+	upsert:   validateSelectWrite,
+	reset:    validateSelectWrite,
+	delete:   validateSelectDelete,
+	patch:    validateSelectPatch,
+	generate: validateSelectGenerate,
+	format:   validateSelectGenerate}
 
 type medium struct {
 	typ          mediaType
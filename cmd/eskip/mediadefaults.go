@@ -4,12 +4,14 @@ type defaultFunc func(cmdArgs) (cmdArgs, error)
 
 // map command string to defaults
 var commandToDefaultMediums = map[command]defaultFunc{
-	check:  defaultRead,
-	print:  defaultRead,
-	upsert: defaultWrite,
-	reset:  defaultWrite,
-	delete: defaultWrite,
-	patch:  defaultRead}
+	check:    defaultRead,
+	print:    defaultRead,
+	upsert:   defaultWrite,
+	reset:    defaultWrite,
+	delete:   defaultWrite,
+	patch:    defaultRead,
+	generate: defaultNone,
+	format:   defaultNone}
 
 func defaultRead(a cmdArgs) (aa cmdArgs, err error) {
 	aa = a
@@ -19,6 +21,10 @@ func defaultRead(a cmdArgs) (aa cmdArgs, err error) {
 	return
 }
 
+func defaultNone(a cmdArgs) (cmdArgs, error) {
+	return a, nil
+}
+
 func defaultWrite(a cmdArgs) (aa cmdArgs, err error) {
 	aa = a
 	if aa.out == nil {
@@ -11,10 +11,13 @@ import (
 
 const breakerUsage = `set global or host specific circuit breakers, e.g. -breaker type=rate,host=www.example.org,window=300s,failures=30
 	possible breaker properties:
-	type: consecutive/rate/disabled (defaults to consecutive)
+	type: consecutive/rate/latency/disabled (defaults to consecutive)
 	host: a host name that overrides the global for a host
 	failures: the number of failures for consecutive or rate breakers
-	window: the size of the sliding window for the rate breaker
+	window: the size of the sliding window for the rate and latency breakers
+	latency: duration string, the latency threshold for the latency breaker
+	percentile: the latency breaker opens when this percentile of the latency exceeds the threshold, e.g. 99
+	slow-ratio: alternatively, the latency breaker opens when this ratio of the requests exceeds the threshold, e.g. 0.1
 	timeout: duration string or milliseconds while the breaker stays open
 	half-open-requests: the number of requests in half-open state to succeed before getting closed again
 	idle-ttl: duration string or milliseconds after the breaker is considered idle and reset
@@ -24,7 +27,10 @@ const enableBreakersUsage = `enable breakers to be set from filters without prov
 
 type breakerFlags []circuit.BreakerSettings
 
-var errInvalidBreakerConfig = errors.New("invalid breaker config (allowed values are: consecutive, rate or disabled)")
+var (
+	errInvalidBreakerConfig        = errors.New("invalid breaker config (allowed values are: consecutive, rate, latency or disabled)")
+	errInvalidLatencyBreakerConfig = errors.New("invalid latency breaker config (latency and either percentile or slow-ratio are required)")
+)
 
 func (b breakerFlags) String() string {
 	s := make([]string, len(b))
@@ -52,6 +58,8 @@ func (b *breakerFlags) Set(value string) error {
 				s.Type = circuit.ConsecutiveFailures
 			case "rate":
 				s.Type = circuit.FailureRate
+			case "latency":
+				s.Type = circuit.HighLatency
 			case "disabled":
 				s.Type = circuit.BreakerDisabled
 			default:
@@ -94,6 +102,27 @@ func (b *breakerFlags) Set(value string) error {
 			}
 
 			s.IdleTTL = d
+		case "latency":
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return err
+			}
+
+			s.Latency = d
+		case "percentile":
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return err
+			}
+
+			s.Percentile = f
+		case "slow-ratio":
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return err
+			}
+
+			s.SlowRatio = f
 		default:
 			return errInvalidBreakerConfig
 		}
@@ -103,16 +132,32 @@ func (b *breakerFlags) Set(value string) error {
 		s.Type = circuit.ConsecutiveFailures
 	}
 
+	if s.Type == circuit.HighLatency && !validLatencyBreaker(s) {
+		return errInvalidLatencyBreakerConfig
+	}
+
 	*b = append(*b, s)
 	return nil
 }
 
+func validLatencyBreaker(s circuit.BreakerSettings) bool {
+	if s.Latency <= 0 || s.Percentile < 0 || s.SlowRatio < 0 || (s.Percentile > 0) == (s.SlowRatio > 0) {
+		return false
+	}
+
+	return s.Percentile < 100 && s.SlowRatio < 1
+}
+
 func (b *breakerFlags) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	var breakerSettings circuit.BreakerSettings
 	if err := unmarshal(&breakerSettings); err != nil {
 		return err
 	}
 
+	if breakerSettings.Type == circuit.HighLatency && !validLatencyBreaker(breakerSettings) {
+		return errInvalidLatencyBreakerConfig
+	}
+
 	*b = append(*b, breakerSettings)
 	return nil
 }
@@ -105,6 +105,54 @@ func Test_breakerFlags_Set(t *testing.T) {
 				IdleTTL:          5 * time.Second,
 			},
 		},
+		{
+			name:    "test breaker settings latency",
+			args:    "type=latency,host=example.com,window=100,latency=500ms,percentile=99.5,timeout=3s",
+			wantErr: false,
+			want: circuit.BreakerSettings{
+				Type:       circuit.HighLatency,
+				Host:       "example.com",
+				Window:     100,
+				Latency:    500 * time.Millisecond,
+				Percentile: 99.5,
+				Timeout:    3 * time.Second,
+			},
+		},
+		{
+			name:    "test breaker settings latency with slow ratio",
+			args:    "type=latency,window=100,latency=1s,slow-ratio=0.1",
+			wantErr: false,
+			want: circuit.BreakerSettings{
+				Type:      circuit.HighLatency,
+				Window:    100,
+				Latency:   time.Second,
+				SlowRatio: 0.1,
+			},
+		},
+		{
+			name:      "test breaker settings latency without threshold",
+			args:      "type=latency,window=100,percentile=99",
+			wantErr:   true,
+			errString: errInvalidLatencyBreakerConfig.Error(),
+		},
+		{
+			name:      "test breaker settings latency with percentile and slow ratio",
+			args:      "type=latency,window=100,latency=1s,percentile=99,slow-ratio=0.1",
+			wantErr:   true,
+			errString: errInvalidLatencyBreakerConfig.Error(),
+		},
+		{
+			name:      "test breaker settings latency with invalid percentile",
+			args:      "type=latency,window=100,latency=1s,percentile=100",
+			wantErr:   true,
+			errString: errInvalidLatencyBreakerConfig.Error(),
+		},
+		{
+			name:      "test breaker settings invalid slow ratio",
+			args:      "type=latency,window=100,latency=1s,slow-ratio=n",
+			wantErr:   true,
+			errString: `strconv.ParseFloat: parsing "n": invalid syntax`,
+		},
 		{
 			name:    "test breaker settings disabled",
 			args:    "type=disabled,host=example.com,timeout=3s,half-open-requests=3,idle-ttl=5s",
@@ -231,6 +279,27 @@ half-open-requests: 3
 idle-ttl: 5s`,
 			wantErr: true,
 		},
+		{
+			name: "test breaker settings latency",
+			yml: `type: latency
+window: 100
+latency: 500ms
+percentile: 99.9`,
+			wantErr: false,
+			want: circuit.BreakerSettings{
+				Type:       circuit.HighLatency,
+				Window:     100,
+				Latency:    500 * time.Millisecond,
+				Percentile: 99.9,
+			},
+		},
+		{
+			name: "test breaker settings latency without threshold",
+			yml: `type: latency
+window: 100
+slow-ratio: 0.1`,
+			wantErr: true,
+		},
 		{
 			name: "test breaker settings invalid type",
 			yml: `type: invalid
@@ -18,23 +18,40 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/zalando/skipper"
+	"github.com/zalando/skipper/canary"
 	"github.com/zalando/skipper/dataclients/kubernetes"
 	"github.com/zalando/skipper/eskip"
 	"github.com/zalando/skipper/filters/openpolicyagent"
+	"github.com/zalando/skipper/filters/waf"
+	"github.com/zalando/skipper/geoip"
 	"github.com/zalando/skipper/metrics"
 	"github.com/zalando/skipper/net"
 	"github.com/zalando/skipper/otel"
 	"github.com/zalando/skipper/proxy"
+	"github.com/zalando/skipper/secrets/acme"
+	"github.com/zalando/skipper/secrets/certregistry"
 	"github.com/zalando/skipper/swarm"
+	"github.com/zalando/skipper/tap"
 )
 
 type Config struct {
 	ConfigFile string
 	Flags      *flag.FlagSet
 
+	// config reload:
+	ConfigReload              bool          `yaml:"config-reload"`
+	ConfigReloadCheckInterval time.Duration `yaml:"config-reload-check-interval"`
+
+	// the arguments of the last parsing, used to reload the config
+	progname string
+	args     []string
+
 	// generic:
 	Address                          string         `yaml:"address"`
 	InsecureAddress                  string         `yaml:"insecure-address"`
+	EnableHTTP3                      bool           `yaml:"enable-http3"`
+	HTTP3Address                     string         `yaml:"http3-address"`
+	HTTP3UDPBufferSize               int            `yaml:"http3-udp-buffer-size"`
 	EnableTCPQueue                   bool           `yaml:"enable-tcp-queue"`
 	ExpectedBytesPerRequest          int            `yaml:"expected-bytes-per-request"`
 	MaxTCPListenerConcurrency        int            `yaml:"max-tcp-listener-concurrency"`
@@ -43,9 +60,14 @@ type Config struct {
 	IgnoreTrailingSlash              bool           `yaml:"ignore-trailing-slash"`
 	Insecure                         bool           `yaml:"insecure"`
 	ProxyPreserveHost                bool           `yaml:"proxy-preserve-host"`
+	EnableForwardProxy               bool           `yaml:"enable-forward-proxy"`
 	DevMode                          bool           `yaml:"dev-mode"`
 	SupportListener                  string         `yaml:"support-listener"`
 	DebugListener                    string         `yaml:"debug-listener"`
+	TrafficTapTokenFile              string         `yaml:"traffic-tap-token-file"`
+	TrafficTapMaxDuration            time.Duration  `yaml:"traffic-tap-max-duration"`
+	TrafficTapMaxBodySize            int            `yaml:"traffic-tap-max-body-size"`
+	TrafficTapRedactHeaders          *listFlag      `yaml:"traffic-tap-redact-headers"`
 	CertPathTLS                      string         `yaml:"tls-cert"`
 	KeyPathTLS                       string         `yaml:"tls-key"`
 	StatusChecks                     *listFlag      `yaml:"status-checks"`
@@ -59,6 +81,12 @@ type Config struct {
 	RfcPatchPath                     bool           `yaml:"rfc-patch-path"`
 	MaxAuditBody                     int            `yaml:"max-audit-body"`
 	MaxMatcherBufferSize             uint64         `yaml:"max-matcher-buffer-size"`
+	WAFMaxBodySize                   int64          `yaml:"waf-max-body-size"`
+	GeoIPDatabases                   *listFlag      `yaml:"geoip-databases"`
+	GeoIPClientIP                    string         `yaml:"geoip-client-ip"`
+	EnableCanaryAnalysis             bool           `yaml:"enable-canary-analysis"`
+	CanaryMinRequests                int            `yaml:"canary-min-requests"`
+	CanaryStateFile                  string         `yaml:"canary-state-file"`
 	EnableBreakers                   bool           `yaml:"enable-breakers"`
 	Breakers                         breakerFlags   `yaml:"breaker"`
 	EnableRatelimiters               bool           `yaml:"enable-ratelimits"`
@@ -76,6 +104,10 @@ type Config struct {
 	// logging, metrics, profiling, tracing:
 	EnablePrometheusMetrics             bool      `yaml:"enable-prometheus-metrics"`
 	EnablePrometheusStartLabel          bool      `yaml:"enable-prometheus-start-label"`
+	EnablePrometheusNativeHistograms    bool      `yaml:"enable-prometheus-native-histograms"`
+	PrometheusNativeHistogramFactor     float64   `yaml:"prometheus-native-histogram-bucket-factor"`
+	PrometheusNativeHistogramMaxBuckets uint      `yaml:"prometheus-native-histogram-max-buckets"`
+	EnablePrometheusExemplars           bool      `yaml:"enable-prometheus-exemplars"`
 	OpenTracing                         string    `yaml:"opentracing"`
 	OpenTracingInitialSpan              string    `yaml:"opentracing-initial-span"`
 	OpenTracingExcludedProxyTags        string    `yaml:"opentracing-excluded-proxy-tags"`
@@ -125,6 +157,7 @@ type Config struct {
 	AccessLogDisabled                   bool      `yaml:"access-log-disabled"`
 	AccessLogJSONEnabled                bool      `yaml:"access-log-json-enabled"`
 	AccessLogStripQuery                 bool      `yaml:"access-log-strip-query"`
+	AccessLogTemplate                   string    `yaml:"access-log-template"`
 	SuppressRouteUpdateLogs             bool      `yaml:"suppress-route-update-logs"`
 
 	OpenTelemetry *otel.Options `yaml:"open-telemetry"`
@@ -139,6 +172,8 @@ type Config struct {
 	EtcdPassword       string               `yaml:"etcd-password"`
 	RoutesFile         string               `yaml:"routes-file"`
 	RoutesURLs         *listFlag            `yaml:"routes-urls"`
+	RoutesURLsKeys     *listFlag            `yaml:"routes-urls-signature-keys"`
+	RoutesURLsSigs     *listFlag            `yaml:"routes-urls-signature-urls"`
 	InlineRoutes       string               `yaml:"inline-routes"`
 	ForwardBackendURL  string               `yaml:"forward-backend-url"`
 	AppendFilters      *defaultFiltersFlags `yaml:"default-filters-append"`
@@ -268,6 +303,25 @@ type Config struct {
 	TLSMinVersion string             `yaml:"tls-min-version"`
 	TLSClientAuth tls.ClientAuthType `yaml:"tls-client-auth"`
 
+	// Client certificate verification per SNI and revocation
+	TLSClientCAFiles            mapFlags      `yaml:"tls-client-ca"`
+	TLSClientCRLFiles           *listFlag     `yaml:"tls-client-crl"`
+	TLSClientCRLRefreshInterval time.Duration `yaml:"tls-client-crl-refresh-interval"`
+	TLSClientOCSP               bool          `yaml:"tls-client-ocsp"`
+	TLSClientOCSPCacheTTL       time.Duration `yaml:"tls-client-ocsp-cache-ttl"`
+	TLSOCSPStapling             bool          `yaml:"tls-ocsp-stapling"`
+
+	// ACME
+	EnableACME              bool          `yaml:"acme"`
+	ACMEDirectoryURL        string        `yaml:"acme-directory-url"`
+	ACMEEmail               string        `yaml:"acme-email"`
+	ACMEChallenge           string        `yaml:"acme-challenge"`
+	ACMEStore               string        `yaml:"acme-store"`
+	ACMEStorePath           string        `yaml:"acme-store-path"`
+	ACMEKubernetesNamespace string        `yaml:"acme-kubernetes-namespace"`
+	ACMERenewBefore         time.Duration `yaml:"acme-renew-before"`
+	ACMERootCAFile          string        `yaml:"acme-root-ca"`
+
 	// Exclude insecure cipher suites
 	ExcludeInsecureCipherSuites bool `yaml:"exclude-insecure-cipher-suites"`
 
@@ -365,6 +419,10 @@ type Config struct {
 
 	PassiveHealthCheck mapFlags `yaml:"passive-health-check"`
 
+	LBDNSDiscoveryNameservers *listFlag     `yaml:"lb-dns-discovery-nameservers"`
+	LBDNSDiscoveryMinTTL      time.Duration `yaml:"lb-dns-discovery-min-ttl"`
+	LBDNSDiscoveryMaxTTL      time.Duration `yaml:"lb-dns-discovery-max-ttl"`
+
 	EnableProxyProtocol bool      `yaml:"enable-proxy-protocol"`
 	ProxyAllowListCIDRs *listFlag `yaml:"proxy-allow-cidrs"`
 	ProxyDenyListCIDRs  *listFlag `yaml:"proxy-deny-cidrs"`
@@ -399,6 +457,8 @@ func NewConfig() *Config {
 	cfg.EditRoute = routeChangerConfig{}
 	cfg.KubernetesEastWestRangeDomains = commaListFlag()
 	cfg.RoutesURLs = commaListFlag()
+	cfg.RoutesURLsKeys = commaListFlag()
+	cfg.RoutesURLsSigs = commaListFlag()
 	cfg.ForwardedHeadersList = commaListFlag()
 	cfg.ForwardedHeadersExcludeCIDRList = commaListFlag()
 	cfg.CompressEncodings = commaListFlag("gzip", "deflate", "br", "zstd")
@@ -406,16 +466,25 @@ func NewConfig() *Config {
 	cfg.LuaSources = commaListFlag()
 	cfg.Oauth2GrantTokeninfoKeys = commaListFlag()
 	cfg.ProxyAllowListCIDRs = commaListFlag()
+	cfg.LBDNSDiscoveryNameservers = commaListFlag()
+	cfg.TrafficTapRedactHeaders = commaListFlag()
 	cfg.ProxyDenyListCIDRs = commaListFlag()
 	cfg.ProxySkipListCIDRs = commaListFlag()
+	cfg.TLSClientCRLFiles = commaListFlag()
 	cfg.EnsureDataClients = commaListFlag()
+	cfg.GeoIPDatabases = commaListFlag()
 
 	flag := flag.NewFlagSet("", flag.ExitOnError)
 	flag.StringVar(&cfg.ConfigFile, "config-file", "", "if provided the flags will be loaded/overwritten by the values on the file (yaml)")
+	flag.BoolVar(&cfg.ConfigReload, "config-reload", false, "when set, the config file is reloaded on changes and on SIGHUP, and the options that can change at runtime are applied without restart")
+	flag.DurationVar(&cfg.ConfigReloadCheckInterval, "config-reload-check-interval", 10*time.Second, "how often the config file is checked for changes when -config-reload is set")
 
 	// generic:
 	flag.StringVar(&cfg.Address, "address", ":9090", "network address that skipper should listen on")
 	flag.StringVar(&cfg.InsecureAddress, "insecure-address", "", "insecure network address that skipper should listen on when TLS is enabled")
+	flag.BoolVar(&cfg.EnableHTTP3, "enable-http3", false, "enables an additional QUIC/HTTP/3 listener when TLS is enabled, advertised via the Alt-Svc header on the TCP listener")
+	flag.StringVar(&cfg.HTTP3Address, "http3-address", "", "UDP network address of the HTTP/3 listener, defaults to the value of -address")
+	flag.IntVar(&cfg.HTTP3UDPBufferSize, "http3-udp-buffer-size", 0, "sets the receive and send buffer size in bytes of the HTTP/3 UDP socket, the QUIC library defaults are used when not set")
 	flag.BoolVar(&cfg.EnableTCPQueue, "enable-tcp-queue", false, "enable the TCP listener queue")
 	flag.IntVar(&cfg.ExpectedBytesPerRequest, "expected-bytes-per-request", 50*1024, "bytes per request, that is used to calculate concurrency limits to buffer connection spikes")
 	flag.IntVar(&cfg.MaxTCPListenerConcurrency, "max-tcp-listener-concurrency", 0, "sets hardcoded max for TCP listener concurrency, normally calculated based on available memory cgroups with max TODO")
@@ -424,9 +493,14 @@ func NewConfig() *Config {
 	flag.BoolVar(&cfg.IgnoreTrailingSlash, "ignore-trailing-slash", false, "flag indicating to ignore trailing slashes in paths when routing")
 	flag.BoolVar(&cfg.Insecure, "insecure", false, "flag indicating to ignore the verification of the TLS certificates of the backend services")
 	flag.BoolVar(&cfg.ProxyPreserveHost, "proxy-preserve-host", false, "flag indicating to preserve the incoming request 'Host' header in the outgoing requests")
+	flag.BoolVar(&cfg.EnableForwardProxy, "enable-forward-proxy", false, "enables forward proxy mode: CONNECT requests routed to a <dynamic> backend are tunnelled to the requested destination")
 	flag.BoolVar(&cfg.DevMode, "dev-mode", false, "enables developer time behavior, like unbuffered routing updates")
 	flag.StringVar(&cfg.SupportListener, "support-listener", ":9911", "network address used for exposing the /metrics endpoint. An empty value disables support endpoint.")
 	flag.StringVar(&cfg.DebugListener, "debug-listener", "", "when this address is set, skipper starts an additional listener returning the original and transformed requests")
+	flag.StringVar(&cfg.TrafficTapTokenFile, "traffic-tap-token-file", "", "path to a file containing the bearer token for the /tap endpoint of the support listener. The endpoint is enabled only when set")
+	flag.DurationVar(&cfg.TrafficTapMaxDuration, "traffic-tap-max-duration", tap.DefaultMaxDuration, "maximum duration of a traffic tap session")
+	flag.IntVar(&cfg.TrafficTapMaxBodySize, "traffic-tap-max-body-size", tap.DefaultMaxBodySize, "maximum number of request and response body bytes captured by a traffic tap session")
+	flag.Var(cfg.TrafficTapRedactHeaders, "traffic-tap-redact-headers", "comma separated list of headers redacted in the traffic tap records in addition to Authorization, Proxy-Authorization, Cookie and Set-Cookie")
 	flag.StringVar(&cfg.CertPathTLS, "tls-cert", "", "the path on the local filesystem to the certificate file(s) (including any intermediates), multiple may be given comma separated")
 	flag.StringVar(&cfg.KeyPathTLS, "tls-key", "", "the path on the local filesystem to the certificate's private key file(s), multiple keys may be given comma separated - the order must match the certs")
 	flag.Var(cfg.StatusChecks, "status-checks", "experimental URLs to check before reporting healthy on startup")
@@ -440,6 +514,12 @@ func NewConfig() *Config {
 	flag.BoolVar(&cfg.RfcPatchPath, "rfc-patch-path", false, "patches the incoming request path to preserve uncoded reserved characters according to RFC 2616 and RFC 3986")
 	flag.IntVar(&cfg.MaxAuditBody, "max-audit-body", 1024, "sets the max body to read to log in the audit log body")
 	flag.Uint64Var(&cfg.MaxMatcherBufferSize, "max-matcher-buffer-size", 2097152, "sets the maximum read size of the body read by the block filter, default is 2MiB")
+	flag.Int64Var(&cfg.WAFMaxBodySize, "waf-max-body-size", waf.DefaultMaxBodySize, "sets the maximum number of bytes of the request body inspected by the waf filter")
+	flag.Var(cfg.GeoIPDatabases, "geoip-databases", "comma separated list of MaxMind DB files, e.g. GeoLite2 Country and ASN, that enable the GeoIP predicate and the geoipHeaders filter. The files are reloaded when they change")
+	flag.StringVar(&cfg.GeoIPClientIP, "geoip-client-ip", geoip.SourceFromLast, "address of the requests looked up in the GeoIP databases: source, sourceFromLast or clientIP, like the Source, SourceFromLast and ClientIP predicates")
+	flag.BoolVar(&cfg.EnableCanaryAnalysis, "enable-canary-analysis", false, "enables the Canary predicate and the canary and canaryBaseline filters, that shift the traffic to the canary routes step by step, or roll them back, based on their error rate and latency. The state is exposed on the /canary path of the support listener")
+	flag.IntVar(&cfg.CanaryMinRequests, "canary-min-requests", canary.DefaultMinRequests, "minimum number of the canary requests in an interval, that is required for the canary analysis")
+	flag.StringVar(&cfg.CanaryStateFile, "canary-state-file", "", "file where the state of the canary groups is stored, and loaded from on start. By default, the state is kept only in memory")
 	flag.BoolVar(&cfg.EnableBreakers, "enable-breakers", false, enableBreakersUsage)
 	flag.Var(&cfg.Breakers, "breaker", breakerUsage)
 	flag.BoolVar(&cfg.EnableRatelimiters, "enable-ratelimits", false, enableRatelimitsUsage)
@@ -471,6 +551,10 @@ func NewConfig() *Config {
 	flag.IntVar(&cfg.MutexProfileFraction, "mutex-profile-fraction", 0, "mutex profile fraction rate, see runtime.SetMutexProfileFraction")
 	flag.IntVar(&cfg.MemProfileRate, "memory-profile-rate", 0, "memory profile rate, see runtime.MemProfileRate, keeps default 512 kB")
 	flag.BoolVar(&cfg.EnablePrometheusStartLabel, "enable-prometheus-start-label", false, "adds start label to each prometheus counter with the value of counter creation timestamp as unix nanoseconds")
+	flag.BoolVar(&cfg.EnablePrometheusNativeHistograms, "enable-prometheus-native-histograms", false, "makes the prometheus latency histograms native histograms with sparse, exponential buckets instead of the -histogram-metric-buckets")
+	flag.Float64Var(&cfg.PrometheusNativeHistogramFactor, "prometheus-native-histogram-bucket-factor", 1.1, "maximum growth factor between two consecutive buckets of the prometheus native histograms")
+	flag.UintVar(&cfg.PrometheusNativeHistogramMaxBuckets, "prometheus-native-histogram-max-buckets", 160, "maximum number of buckets of a prometheus native histogram, the resolution is reduced when exceeded")
+	flag.BoolVar(&cfg.EnablePrometheusExemplars, "enable-prometheus-exemplars", false, "attaches the trace ID of the request as exemplar to the prometheus backend, response and serve latency metrics")
 	flag.BoolVar(&cfg.DebugGcMetrics, "debug-gc-metrics", false, "enables reporting of the Go garbage collector statistics exported in debug.GCStats")
 	flag.BoolVar(&cfg.RuntimeMetrics, "runtime-metrics", true, "enables reporting of the Go runtime statistics exported in runtime and specifically runtime.MemStats")
 	flag.BoolVar(&cfg.ServeRouteMetrics, "serve-route-metrics", false, "enables reporting total serve time metrics for each route")
@@ -502,6 +586,7 @@ func NewConfig() *Config {
 	flag.BoolVar(&cfg.AccessLogDisabled, "access-log-disabled", false, "when this flag is set, no access log is printed")
 	flag.BoolVar(&cfg.AccessLogJSONEnabled, "access-log-json-enabled", false, "when this flag is set, log in JSON format is used")
 	flag.BoolVar(&cfg.AccessLogStripQuery, "access-log-strip-query", false, "when this flag is set, the access log strips the query strings from the access log")
+	flag.StringVar(&cfg.AccessLogTemplate, "access-log-template", "", "custom access log format with ${...} placeholders, e.g. '${request.method} ${request.path} ${response.status} ${route.id}', takes precedence over -access-log-json-enabled")
 	flag.BoolVar(&cfg.SuppressRouteUpdateLogs, "suppress-route-update-logs", false, "print only summaries on route updates/deletes")
 
 	flag.Var(newYamlFlag(&cfg.OpenTelemetry), "open-telemetry", "OpenTelemetry configuration in YAML format, use flow-style for convenience")
@@ -516,6 +601,8 @@ func NewConfig() *Config {
 	flag.StringVar(&cfg.EtcdPassword, "etcd-password", "", "optional password for basic authentication with etcd")
 	flag.StringVar(&cfg.RoutesFile, "routes-file", "", "file containing route definitions")
 	flag.Var(cfg.RoutesURLs, "routes-urls", "comma separated URLs to route definitions in eskip format")
+	flag.Var(cfg.RoutesURLsKeys, "routes-urls-signature-keys", "comma separated files with PEM encoded public keys, that verify the signatures of the -routes-urls files, downloaded from the URLs with the .sig suffix. When set, only the routes with a valid signature are applied")
+	flag.Var(cfg.RoutesURLsSigs, "routes-urls-signature-urls", "comma separated URLs of the signatures of the -routes-urls files, in the same order, e.g. when the files are downloaded with presigned URLs. Defaults to the URLs of the files with the .sig suffix")
 	flag.StringVar(&cfg.InlineRoutes, "inline-routes", "", "inline routes in eskip format")
 	flag.StringVar(&cfg.ForwardBackendURL, "forward-backend-url", "", "target url of the <forward> backend")
 	flag.Int64Var(&cfg.SourcePollTimeout, "source-poll-timeout", int64(3000), "polling timeout of the routing data sources, in milliseconds")
@@ -650,6 +737,23 @@ func NewConfig() *Config {
 	flag.Func("tls-client-auth", "TLS client authentication policy for server, one of: "+
 		"NoClientCert, RequestClientCert, RequireAnyClientCert, VerifyClientCertIfGiven or RequireAndVerifyClientCert. "+
 		"See https://pkg.go.dev/crypto/tls#ClientAuthType for details.", cfg.setTLSClientAuth)
+	flag.Var(&cfg.TLSClientCAFiles, "tls-client-ca", "sets PEM encoded CA bundle files per SNI host name to verify the client certificates with, e.g. www.example.org=/path/to/ca.pem,api.example.org=/path/to/api-ca.pem")
+	flag.Var(cfg.TLSClientCRLFiles, "tls-client-crl", "PEM or DER encoded certificate revocation list files, the TLS handshakes with revoked client certificates are rejected, multiple files may be given comma separated")
+	flag.DurationVar(&cfg.TLSClientCRLRefreshInterval, "tls-client-crl-refresh-interval", certregistry.DefaultCRLRefreshInterval, "sets how often the -tls-client-crl files are reloaded")
+	flag.BoolVar(&cfg.TLSClientOCSP, "tls-client-ocsp", false, "enables checking the revocation of the client certificates with the OCSP responders listed in the certificates. When the responder cannot be reached, the certificate is accepted")
+	flag.DurationVar(&cfg.TLSClientOCSPCacheTTL, "tls-client-ocsp-cache-ttl", certregistry.DefaultOCSPCacheTTL, "sets how long the OCSP responses are cached, unless they require an earlier update")
+	flag.BoolVar(&cfg.TLSOCSPStapling, "tls-ocsp-stapling", false, "enables fetching the OCSP responses of the certificates of -kubernetes-enable-tls, -tls-cert and ACME, and stapling them to the TLS handshakes")
+
+	// ACME
+	flag.BoolVar(&cfg.EnableACME, "acme", false, "enables obtaining and renewing TLS certificates from an ACME server for the hostnames of the Host predicates of the routes")
+	flag.StringVar(&cfg.ACMEDirectoryURL, "acme-directory-url", acme.DefaultDirectoryURL, "sets the directory URL of the ACME server")
+	flag.StringVar(&cfg.ACMEEmail, "acme-email", "", "sets the contact email address of the ACME account")
+	flag.StringVar(&cfg.ACMEChallenge, "acme-challenge", acme.ChallengeTLSALPN01, "sets the ACME challenge type, tls-alpn-01, answered on the TLS listener, or http-01, answered on the proxy listener")
+	flag.StringVar(&cfg.ACMEStore, "acme-store", "file", "sets where the ACME account and certificates are stored, file or kubernetes")
+	flag.StringVar(&cfg.ACMEStorePath, "acme-store-path", "", "sets the directory of the ACME file store, shared by the replicas e.g. via a shared volume")
+	flag.StringVar(&cfg.ACMEKubernetesNamespace, "acme-kubernetes-namespace", acme.DefaultKubernetesNamespace, "sets the namespace of the secrets of the ACME kubernetes store")
+	flag.DurationVar(&cfg.ACMERenewBefore, "acme-renew-before", acme.DefaultRenewBefore, "sets how long before their expiry the ACME certificates are renewed")
+	flag.StringVar(&cfg.ACMERootCAFile, "acme-root-ca", "", "sets a PEM encoded CA bundle file to verify the ACME server with, e.g. of a local test server")
 
 	// Exclude insecure cipher suites
 	flag.BoolVar(&cfg.ExcludeInsecureCipherSuites, "exclude-insecure-cipher-suites", false, "excludes insecure cipher suites")
@@ -733,6 +837,11 @@ func NewConfig() *Config {
 	// Passive Health Checks
 	flag.Var(&cfg.PassiveHealthCheck, "passive-health-check", "sets the parameters for passive health check feature")
 
+	// DNS discovery of load balancer endpoints
+	flag.Var(cfg.LBDNSDiscoveryNameservers, "lb-dns-discovery-nameservers", "comma separated list of nameservers (host:port) used to resolve the endpoints of <dns, ...> and <srv, ...> backends, defaults to the nameservers in /etc/resolv.conf")
+	flag.DurationVar(&cfg.LBDNSDiscoveryMinTTL, "lb-dns-discovery-min-ttl", 5*time.Second, "minimum interval between two resolutions of the endpoints of <dns, ...> and <srv, ...> backends, shorter record TTLs are ignored")
+	flag.DurationVar(&cfg.LBDNSDiscoveryMaxTTL, "lb-dns-discovery-max-ttl", 5*time.Minute, "maximum interval between two resolutions of the endpoints of <dns, ...> and <srv, ...> backends, longer record TTLs are ignored")
+
 	// PROXY protocol
 	flag.BoolVar(&cfg.EnableProxyProtocol, "enable-proxy-protocol", false, "enable the haproxy PROXY protocol v1 and v2. Default is false and if enabled the default will reject all connections. Please check allow, deny and skip list.")
 	flag.Var(cfg.ProxyAllowListCIDRs, "proxy-allow-cidrs", `comma separated list of CIDRs that are allowed to use the PROXY protocol v1/v2. To allow all ipv6 and ipv4 addresses use: "::/0,0.0.0.0/0"`)
@@ -793,6 +902,10 @@ func validate(c *Config) error {
 	if err != nil {
 		return err
 	}
+	if c.ConfigReload && c.ConfigFile == "" {
+		return fmt.Errorf("config-reload requires config-file")
+	}
+
 	return c.parseForwardedHeaders()
 }
 
@@ -801,7 +914,14 @@ func (c *Config) Parse() error {
 }
 
 func (c *Config) ParseArgs(progname string, args []string) error {
-	c.Flags.Init(progname, flag.ExitOnError)
+	return c.parseArgs(progname, args, flag.ExitOnError)
+}
+
+func (c *Config) parseArgs(progname string, args []string, errorHandling flag.ErrorHandling) error {
+	c.progname = progname
+	c.args = args
+
+	c.Flags.Init(progname, errorHandling)
 	err := c.Flags.Parse(args)
 	if err != nil {
 		return err
@@ -923,6 +1043,9 @@ func (c *Config) ToOptions() skipper.Options {
 		// generic:
 		Address:                          c.Address,
 		InsecureAddress:                  c.InsecureAddress,
+		EnableHTTP3:                      c.EnableHTTP3,
+		HTTP3Address:                     c.HTTP3Address,
+		HTTP3UDPBufferSize:               c.HTTP3UDPBufferSize,
 		StatusChecks:                     c.StatusChecks.values,
 		EnableTCPQueue:                   c.EnableTCPQueue,
 		ExpectedBytesPerRequest:          c.ExpectedBytesPerRequest,
@@ -933,9 +1056,28 @@ func (c *Config) ToOptions() skipper.Options {
 		DevMode:                          c.DevMode,
 		SupportListener:                  c.SupportListener,
 		DebugListener:                    c.DebugListener,
+		TrafficTapTokenFile:              c.TrafficTapTokenFile,
+		TrafficTapMaxDuration:            c.TrafficTapMaxDuration,
+		TrafficTapMaxBodySize:            c.TrafficTapMaxBodySize,
+		TrafficTapRedactHeaders:          c.TrafficTapRedactHeaders.values,
 		CertPathTLS:                      c.CertPathTLS,
 		KeyPathTLS:                       c.KeyPathTLS,
 		TLSClientAuth:                    c.TLSClientAuth,
+		TLSClientCAFiles:                 c.TLSClientCAFiles.values,
+		TLSClientCRLFiles:                c.TLSClientCRLFiles.values,
+		TLSClientCRLRefreshInterval:      c.TLSClientCRLRefreshInterval,
+		TLSClientOCSP:                    c.TLSClientOCSP,
+		TLSClientOCSPCacheTTL:            c.TLSClientOCSPCacheTTL,
+		TLSOCSPStapling:                  c.TLSOCSPStapling,
+		EnableACME:                       c.EnableACME,
+		ACMEDirectoryURL:                 c.ACMEDirectoryURL,
+		ACMEEmail:                        c.ACMEEmail,
+		ACMEChallenge:                    c.ACMEChallenge,
+		ACMEStore:                        c.ACMEStore,
+		ACMEStorePath:                    c.ACMEStorePath,
+		ACMEKubernetesNamespace:          c.ACMEKubernetesNamespace,
+		ACMERenewBefore:                  c.ACMERenewBefore,
+		ACMERootCAFile:                   c.ACMERootCAFile,
 		TLSMinVersion:                    c.getMinTLSVersion(),
 		CipherSuites:                     c.filterCipherSuites(),
 		MaxLoopbacks:                     c.MaxLoopbacks,
@@ -943,6 +1085,12 @@ func (c *Config) ToOptions() skipper.Options {
 		ReverseSourcePredicate:           c.ReverseSourcePredicate,
 		MaxAuditBody:                     c.MaxAuditBody,
 		MaxMatcherBufferSize:             c.MaxMatcherBufferSize,
+		WAFMaxBodySize:                   c.WAFMaxBodySize,
+		GeoIPDatabases:                   c.GeoIPDatabases.values,
+		GeoIPClientIP:                    c.GeoIPClientIP,
+		EnableCanaryAnalysis:             c.EnableCanaryAnalysis,
+		CanaryMinRequests:                c.CanaryMinRequests,
+		CanaryStateFile:                  c.CanaryStateFile,
 		EnableBreakers:                   c.EnableBreakers,
 		BreakerSettings:                  c.Breakers,
 		EnableRatelimiters:               c.EnableRatelimiters,
@@ -961,6 +1109,10 @@ func (c *Config) ToOptions() skipper.Options {
 		// logging, metrics, profiling, tracing:
 		EnablePrometheusMetrics:             c.EnablePrometheusMetrics,
 		EnablePrometheusStartLabel:          c.EnablePrometheusStartLabel,
+		EnablePrometheusNativeHistograms:    c.EnablePrometheusNativeHistograms,
+		PrometheusNativeHistogramFactor:     c.PrometheusNativeHistogramFactor,
+		PrometheusNativeHistogramMaxBuckets: uint32(c.PrometheusNativeHistogramMaxBuckets),
+		EnablePrometheusExemplars:           c.EnablePrometheusExemplars,
 		OpenTracing:                         strings.Split(c.OpenTracing, " "),
 		OpenTracingInitialSpan:              c.OpenTracingInitialSpan,
 		OpenTracingExcludedProxyTags:        strings.Split(c.OpenTracingExcludedProxyTags, ","),
@@ -1003,6 +1155,7 @@ func (c *Config) ToOptions() skipper.Options {
 		AccessLogDisabled:                   c.AccessLogDisabled,
 		AccessLogJSONEnabled:                c.AccessLogJSONEnabled,
 		AccessLogStripQuery:                 c.AccessLogStripQuery,
+		AccessLogTemplate:                   c.AccessLogTemplate,
 		SuppressRouteUpdateLogs:             c.SuppressRouteUpdateLogs,
 
 		OpenTelemetry: c.OpenTelemetry,
@@ -1017,6 +1170,8 @@ func (c *Config) ToOptions() skipper.Options {
 		EtcdPassword:      c.EtcdPassword,
 		WatchRoutesFile:   c.RoutesFile,
 		RoutesURLs:        c.RoutesURLs.values,
+		RoutesURLsKeys:    c.RoutesURLsKeys.values,
+		RoutesURLsSigs:    c.RoutesURLsSigs.values,
 		InlineRoutes:      c.InlineRoutes,
 		ForwardBackendURL: c.ForwardBackendURL,
 		DefaultFilters: &eskip.DefaultFilters{
@@ -1200,6 +1355,10 @@ func (c *Config) ToOptions() skipper.Options {
 
 		PassiveHealthCheck: c.PassiveHealthCheck.values,
 
+		LBDNSDiscoveryNameservers: c.LBDNSDiscoveryNameservers.values,
+		LBDNSDiscoveryMinTTL:      c.LBDNSDiscoveryMinTTL,
+		LBDNSDiscoveryMaxTTL:      c.LBDNSDiscoveryMaxTTL,
+
 		EnableProxyProtocol: c.EnableProxyProtocol,
 		ProxyAllowListCIDRs: c.ProxyAllowListCIDRs.values,
 		ProxyDenyListCIDRs:  c.ProxyDenyListCIDRs.values,
@@ -1234,6 +1393,10 @@ func (c *Config) ToOptions() skipper.Options {
 		options.ProxyFlags |= proxy.PatchPath
 	}
 
+	if c.EnableForwardProxy {
+		options.ProxyFlags |= proxy.ForwardProxy
+	}
+
 	// static client certs
 	if len(c.Certificates) > 0 {
 		options.ClientTLS = &tls.Config{
@@ -1309,9 +1472,25 @@ func (c *Config) ToOptions() skipper.Options {
 		})
 	}
 
+	if c.ConfigReload && c.ConfigFile != "" {
+		options.ConfigReloader = c.reload
+		options.ConfigReloadFile = c.ConfigFile
+		options.ConfigReloadCheckInterval = c.ConfigReloadCheckInterval
+	}
+
 	return options
 }
 
+// reload parses the original arguments and the config file again.
+func (c *Config) reload() (skipper.Options, error) {
+	nc := NewConfig()
+	if err := nc.parseArgs(c.progname, c.args, flag.ContinueOnError); err != nil {
+		return skipper.Options{}, err
+	}
+
+	return nc.ToOptions(), nil
+}
+
 func (c *Config) getMinTLSVersion() uint16 {
 	tlsVersionTable := map[string]uint16{
 		"1.3": tls.VersionTLS13,
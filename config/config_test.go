@@ -21,6 +21,7 @@ import (
 	"github.com/zalando/skipper/metrics"
 	"github.com/zalando/skipper/net"
 	"github.com/zalando/skipper/proxy"
+	"github.com/zalando/skipper/tap"
 	"gopkg.in/yaml.v2"
 
 	"github.com/google/go-cmp/cmp"
@@ -73,14 +74,22 @@ func TestEnvOverrides_SwarmRedisPassword(t *testing.T) {
 func defaultConfig(with func(*Config)) *Config {
 	cfg := &Config{
 		Flags:                                   nil,
+		ConfigReloadCheckInterval:               10 * time.Second,
 		Address:                                 ":9090",
 		StatusChecks:                            commaListFlag(),
 		ExpectedBytesPerRequest:                 50 * 1024,
 		SupportListener:                         ":9911",
+		TrafficTapMaxDuration:                   tap.DefaultMaxDuration,
+		TrafficTapMaxBodySize:                   tap.DefaultMaxBodySize,
+		TrafficTapRedactHeaders:                 commaListFlag(),
 		MaxLoopbacks:                            proxy.DefaultMaxLoopbacks,
 		DefaultHTTPStatus:                       404,
 		MaxAuditBody:                            1024,
 		MaxMatcherBufferSize:                    2097152,
+		WAFMaxBodySize:                          131072,
+		GeoIPDatabases:                          commaListFlag(),
+		GeoIPClientIP:                           "sourceFromLast",
+		CanaryMinRequests:                       10,
 		MetricsFlavour:                          commaListFlag("codahale", "prometheus", "otel"),
 		FilterPlugins:                           newPluginFlag(),
 		PredicatePlugins:                        newPluginFlag(),
@@ -94,6 +103,8 @@ func defaultConfig(with func(*Config)) *Config {
 		MetricsListener:                         ":9911",
 		MetricsPrefix:                           "skipper.",
 		RuntimeMetrics:                          true,
+		PrometheusNativeHistogramFactor:         1.1,
+		PrometheusNativeHistogramMaxBuckets:     160,
 		HistogramMetricBuckets:                  []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
 		ResponseSizeBuckets:                     metrics.DefaultResponseSizeBuckets,
 		RequestSizeBuckets:                      metrics.DefaultRequestSizeBuckets,
@@ -174,6 +185,8 @@ func defaultConfig(with func(*Config)) *Config {
 		SwarmLeaveTimeout:                       5 * time.Second,
 		TLSMinVersion:                           defaultMinTLSVersion,
 		RoutesURLs:                              commaListFlag(),
+		RoutesURLsKeys:                          commaListFlag(),
+		RoutesURLsSigs:                          commaListFlag(),
 		ForwardedHeadersList:                    commaListFlag(),
 		ForwardedHeadersExcludeCIDRList:         commaListFlag(),
 		ClusterRatelimitMaxGroupShards:          1,
@@ -192,6 +205,17 @@ func defaultConfig(with func(*Config)) *Config {
 		ProxyAllowListCIDRs:                     commaListFlag(),
 		ProxyDenyListCIDRs:                      commaListFlag(),
 		ProxySkipListCIDRs:                      commaListFlag(),
+		TLSClientCRLFiles:                       commaListFlag(),
+		TLSClientCRLRefreshInterval:             time.Minute,
+		TLSClientOCSPCacheTTL:                   time.Hour,
+		ACMEDirectoryURL:                        "https://acme-v02.api.letsencrypt.org/directory",
+		ACMEChallenge:                           "tls-alpn-01",
+		ACMEStore:                               "file",
+		ACMEKubernetesNamespace:                 "kube-system",
+		ACMERenewBefore:                         30 * 24 * time.Hour,
+		LBDNSDiscoveryNameservers:               commaListFlag(),
+		LBDNSDiscoveryMinTTL:                    5 * time.Second,
+		LBDNSDiscoveryMaxTTL:                    5 * time.Minute,
 		MtlsAuthnAppendCA:                       false,
 		MtlsAuthnCaFile:                         "",
 		MtlsAuthnCA:                             x509.NewCertPool(),
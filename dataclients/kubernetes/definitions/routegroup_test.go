@@ -1,6 +1,9 @@
 package definitions
 
-import "testing"
+import (
+	"encoding/json"
+	"testing"
+)
 
 func TestSkipperBackendNil(t *testing.T) {
 	skipperBackend := `
@@ -16,3 +19,26 @@ func TestSkipperBackendNil(t *testing.T) {
 		t.Fatalf("Failed to get nil: %q", skipperBackend)
 	}
 }
+
+func TestSkipperBackendMarshalRoundtrip(t *testing.T) {
+	for _, backend := range []string{
+		`{"address":"http://example","name":"network","type":"network"}`,
+		`{"name":"service","serviceName":"my-service","servicePort":8080,"type":"service"}`,
+		`{"algorithm":"consistentHash","endpoints":["http://10.0.0.1","http://10.0.0.2"],"name":"lb","type":"lb"}`,
+		`{"name":"shunt","type":"shunt"}`,
+	} {
+		var sb SkipperBackend
+		if err := json.Unmarshal([]byte(backend), &sb); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := json.Marshal(&sb)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(b) != backend {
+			t.Errorf("expected %s, got: %s", backend, b)
+		}
+	}
+}
@@ -255,6 +255,31 @@ func (sb *SkipperBackend) UnmarshalJSON(value []byte) error {
 	return nil
 }
 
+// MarshalJSON encodes the backend in the same format as it is parsed
+// by UnmarshalJSON, omitting the fields not used by its type.
+func (sb *SkipperBackend) MarshalJSON() ([]byte, error) {
+	p := make(map[string]any)
+	p["name"] = sb.Name
+	if sb.Type == ServiceBackend {
+		p["type"] = "service"
+		p["serviceName"] = sb.ServiceName
+		p["servicePort"] = sb.ServicePort
+	} else {
+		p["type"] = sb.Type.String()
+	}
+
+	if sb.Address != "" {
+		p["address"] = sb.Address
+	}
+
+	if sb.Type == eskip.LBBackend {
+		p["algorithm"] = sb.Algorithm.String()
+		p["endpoints"] = sb.Endpoints
+	}
+
+	return json.Marshal(p)
+}
+
 func (rg *RouteGroupSpec) UniqueHosts() []string {
 	return uniqueStrings(rg.Hosts)
 }
@@ -29,6 +29,7 @@ const (
 	tlsSecretType                       = "kubernetes.io/tls"
 	tlsSecretDataCrt                    = "tls.crt"
 	tlsSecretDataKey                    = "tls.key"
+	tlsSecretDataClientCA               = "client-ca.crt"
 )
 
 type ingressContext struct {
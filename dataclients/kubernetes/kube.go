@@ -1,6 +1,7 @@
 package kubernetes
 
 import (
+	b64 "encoding/base64"
 	"fmt"
 	"net"
 	"net/http"
@@ -464,6 +465,10 @@ func (c *Client) loadAndConvert() ([]*eskip.Route, error) {
 		return nil, err
 	}
 
+	if c.ClusterClient.certificateRegistry != nil {
+		c.ClusterClient.certificateRegistry.RemoveUnsyncedClientCAs()
+	}
+
 	r := append(ri, rg...)
 
 	if c.provideHealthcheck {
@@ -641,7 +646,8 @@ func compareStringList(a, b []string) []string {
 }
 
 // addTLSCertToRegistry adds a TLS certificate to the certificate registry per host using the provided
-// Kubernetes TLS secret
+// Kubernetes TLS secret. When the secret contains a client CA bundle, it is used to verify the client
+// certificates of the hosts, until a synchronization without it.
 func addTLSCertToRegistry(cr *certregistry.CertRegistry, logger *logger, hosts []string, secret *secret) {
 	cert, err := generateTLSCertFromSecret(secret)
 	if err != nil {
@@ -654,4 +660,20 @@ func addTLSCertToRegistry(cr *certregistry.CertRegistry, logger *logger, hosts [
 			logger.Errorf("Failed to configure certificate: %v", err)
 		}
 	}
+
+	if secret.Data[tlsSecretDataClientCA] == "" {
+		return
+	}
+
+	ca, err := b64.StdEncoding.DecodeString(secret.Data[tlsSecretDataClientCA])
+	if err != nil {
+		logger.Errorf("Failed to decode %s from secret %s", tlsSecretDataClientCA, secret.Metadata.Name)
+		return
+	}
+	for _, host := range hosts {
+		err := cr.SyncClientCA(host, ca)
+		if err != nil {
+			logger.Errorf("Failed to configure client CA: %v", err)
+		}
+	}
 }
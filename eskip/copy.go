@@ -65,6 +65,7 @@ func Copy(r *Route) *Route {
 	c.BackendType = r.BackendType
 	c.Backend = r.Backend
 	c.LBAlgorithm = r.LBAlgorithm
+	c.LBDiscovery = r.LBDiscovery
 	c.LBEndpoints = make([]*LBEndpoint, len(r.LBEndpoints))
 	copy(c.LBEndpoints, r.LBEndpoints)
 	return c
@@ -0,0 +1,216 @@
+package eskip
+
+import "slices"
+
+const (
+	letKeyword     = "let"
+	includeKeyword = "include"
+
+	maxIncludeDepth = 16
+)
+
+// definition is the value of a name defined by a let statement. A
+// string can be used both as an argument and as a backend, and a single
+// call both as a filter and as a predicate.
+type definition struct {
+	literal    interface{}
+	backend    *parsedRoute
+	filters    []*Filter
+	predicates []*Predicate
+}
+
+// parseContext is shared by a document and the documents included by
+// it.
+type parseContext struct {
+	options     ParseOptions
+	definitions map[string]*definition
+
+	// names of the documents being parsed, to detect the include cycles
+	includes []string
+
+	// names of all the documents parsed, so that a document included
+	// more than once, e.g. by two included documents, is parsed only once
+	included map[string]bool
+
+	// when set, only the syntax is checked and recorded, e.g. for
+	// formatting
+	syntax *syntaxTree
+}
+
+func newParseContext(o ParseOptions) *parseContext {
+	return &parseContext{
+		options:     o,
+		definitions: make(map[string]*definition),
+		includes:    []string{o.Name},
+		included:    map[string]bool{o.Name: true},
+	}
+}
+
+func (l *eskipLex) define(keyword, name string, d *definition) {
+	if keyword != letKeyword {
+		l.failf("unexpected %s, expected %s", keyword, letKeyword)
+		return
+	}
+
+	if d == nil || l.context.syntax != nil {
+		// the value failed, or only the syntax is checked
+		return
+	}
+
+	if _, exists := l.context.definitions[name]; exists {
+		l.failf("%s already defined", name)
+		return
+	}
+
+	l.context.definitions[name] = d
+}
+
+// reference returns the definition of a name. References are accepted
+// only in routing documents, otherwise they are syntax errors.
+func (l *eskipLex) reference(name string) *definition {
+	if l.context == nil {
+		l.failf("syntax error")
+		return nil
+	}
+
+	if l.context.syntax != nil {
+		// any use of the name is accepted
+		return &definition{
+			literal:    name,
+			backend:    &parsedRoute{backend: name},
+			filters:    []*Filter{{Name: name}},
+			predicates: []*Predicate{{Name: name}},
+		}
+	}
+
+	d, ok := l.context.definitions[name]
+	if !ok {
+		l.failf("undefined: %s", name)
+		return nil
+	}
+
+	return d
+}
+
+func (l *eskipLex) argReference(name string) interface{} {
+	d := l.reference(name)
+	if d == nil {
+		return nil
+	}
+
+	if d.literal == nil {
+		l.failf("%s is not a string, number or regular expression", name)
+		return nil
+	}
+
+	return d.literal
+}
+
+func (l *eskipLex) backendReference(name string) *parsedRoute {
+	d := l.reference(name)
+	if d == nil {
+		return &parsedRoute{}
+	}
+
+	if d.backend == nil {
+		l.failf("%s is not a backend", name)
+		return &parsedRoute{}
+	}
+
+	b := *d.backend
+	b.lbEndpoints = slices.Clone(b.lbEndpoints)
+	return &b
+}
+
+func (l *eskipLex) filtersReference(name string) []*Filter {
+	d := l.reference(name)
+	if d == nil {
+		return nil
+	}
+
+	if len(d.filters) == 0 {
+		l.failf("%s is not a filter", name)
+		return nil
+	}
+
+	filters := make([]*Filter, len(d.filters))
+	for i, f := range d.filters {
+		filters[i] = f.Copy()
+	}
+
+	return filters
+}
+
+func (l *eskipLex) predicatesReference(name string) []*Predicate {
+	d := l.reference(name)
+	if d == nil {
+		return nil
+	}
+
+	if len(d.predicates) == 0 {
+		l.failf("%s is not a predicate", name)
+		return nil
+	}
+
+	predicates := make([]*Predicate, len(d.predicates))
+	for i, p := range d.predicates {
+		predicates[i] = p.Copy()
+	}
+
+	return predicates
+}
+
+// include parses the included document. The included document shares
+// the definitions with the including one. A document is parsed only on
+// its first include.
+func (l *eskipLex) include(keyword, path string) []*parsedRoute {
+	if keyword != includeKeyword {
+		l.failf("unexpected %s, expected %s", keyword, includeKeyword)
+		return nil
+	}
+
+	ctx := l.context
+	if ctx.syntax != nil {
+		return nil
+	}
+
+	if ctx.options.Include == nil {
+		l.failf("include not supported: %s", path)
+		return nil
+	}
+
+	if len(ctx.includes) > maxIncludeDepth {
+		l.failf("too many nested includes: %s", path)
+		return nil
+	}
+
+	name, content, err := ctx.options.Include(l.name, path)
+	if err != nil {
+		l.failf("include failed: %v", err)
+		return nil
+	}
+
+	if slices.Contains(ctx.includes, name) {
+		l.failf("include cycle: %s", name)
+		return nil
+	}
+
+	if ctx.included[name] {
+		// the definitions and the routes of the document are already
+		// known
+		return nil
+	}
+
+	ctx.included[name] = true
+	ctx.includes = append(ctx.includes, name)
+	defer func() { ctx.includes = ctx.includes[:len(ctx.includes)-1] }()
+
+	routes, _, _, err := parseWithContext(start_document, content, name, ctx)
+	if err != nil {
+		// the error of the included document tells its own position
+		l.fail(err)
+		return nil
+	}
+
+	return routes
+}
@@ -0,0 +1,301 @@
+package eskip
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefinitions(t *testing.T) {
+	for _, tt := range []struct {
+		title    string
+		input    string
+		expected []*Route
+	}{{
+		title: "backend and argument",
+		input: `
+			let backend = "https://api.example.org";
+			let header = "X-Foo";
+			r1: Path("/foo") -> setRequestHeader(header, "bar") -> backend;
+			r2: Path("/bar") -> backend;
+		`,
+		expected: []*Route{{
+			Id:      "r1",
+			Path:    "/foo",
+			Filters: []*Filter{{Name: "setRequestHeader", Args: []interface{}{"X-Foo", "bar"}}},
+			Backend: "https://api.example.org",
+		}, {
+			Id:      "r2",
+			Path:    "/bar",
+			Backend: "https://api.example.org",
+		}},
+	}, {
+		title: "filter chain",
+		input: `
+			let authChain = oauthTokeninfoAnyScope("x") -> flowId();
+			let timeout = 3;
+			r: * -> authChain -> backendTimeout(timeout) -> <shunt>;
+		`,
+		expected: []*Route{{
+			Id: "r",
+			Filters: []*Filter{
+				{Name: "oauthTokeninfoAnyScope", Args: []interface{}{"x"}},
+				{Name: "flowId", Args: []interface{}{}},
+				{Name: "backendTimeout", Args: []interface{}{float64(3)}},
+			},
+			BackendType: ShuntBackend,
+			Shunt:       true,
+		}},
+	}, {
+		title: "predicates and nested references",
+		input: `
+			let api = Host(/^api[.]/) && Method("GET");
+			let users = api && Path("/users");
+			let status = Status();
+			r: users && status && Header("X-Foo", "bar") -> status -> <shunt>;
+		`,
+		expected: []*Route{{
+			Id:          "r",
+			HostRegexps: []string{"^api[.]"},
+			Method:      "GET",
+			Path:        "/users",
+			Headers:     map[string]string{"X-Foo": "bar"},
+			Predicates:  []*Predicate{{Name: "Status", Args: []interface{}{}}},
+			Filters:     []*Filter{{Name: "Status", Args: []interface{}{}}},
+			BackendType: ShuntBackend,
+			Shunt:       true,
+		}},
+	}, {
+		title: "load balanced backend alias",
+		input: `
+			let lb = <roundRobin, "http://10.2.0.1", "http://10.2.0.2">;
+			let pool = lb;
+			r: * -> pool;
+		`,
+		expected: []*Route{{
+			Id:          "r",
+			BackendType: LBBackend,
+			LBAlgorithm: "roundRobin",
+			LBEndpoints: []*LBEndpoint{{Address: "http://10.2.0.1"}, {Address: "http://10.2.0.2"}},
+		}},
+	}, {
+		title: "route id let",
+		input: `let: * -> "https://www.example.org"`,
+		expected: []*Route{{
+			Id:      "let",
+			Backend: "https://www.example.org",
+		}},
+	}} {
+		t.Run(tt.title, func(t *testing.T) {
+			routes, err := Parse(tt.input)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expected, normalizeArgs(routes))
+		})
+	}
+}
+
+// normalizeArgs makes the empty argument lists comparable.
+func normalizeArgs(routes []*Route) []*Route {
+	for _, r := range routes {
+		for _, f := range r.Filters {
+			if f.Args == nil {
+				f.Args = []interface{}{}
+			}
+		}
+
+		for _, p := range r.Predicates {
+			if p.Args == nil {
+				p.Args = []interface{}{}
+			}
+		}
+	}
+
+	return routes
+}
+
+func TestDefinitionsCopied(t *testing.T) {
+	routes, err := Parse(`
+		let chain = setPath("/foo");
+		r1: * -> chain -> <shunt>;
+		r2: * -> chain -> <shunt>;
+	`)
+	require.NoError(t, err)
+
+	routes[0].Filters[0].Args[0] = "/bar"
+	assert.Equal(t, "/foo", routes[1].Filters[0].Args[0])
+}
+
+func TestDefinitionErrors(t *testing.T) {
+	for _, tt := range []struct {
+		title string
+		input string
+		err   string
+	}{{
+		title: "undefined",
+		input: `r: * -> backend`,
+		err:   "parse failed after token backend, last route id: r, position 15: undefined: backend",
+	}, {
+		title: "used before defined",
+		input: `r: * -> backend; let backend = "https://www.example.org"`,
+		err:   "parse failed after token ;, last route id: r, position 16: undefined: backend",
+	}, {
+		title: "redefined",
+		input: `let a = "foo"; let a = "bar"`,
+		err:   "parse failed after token bar, position 28: a already defined",
+	}, {
+		title: "not a backend",
+		input: `let chain = flowId() -> status(); r: * -> chain`,
+		err:   "parse failed after token chain, last route id: r, position 47: chain is not a backend",
+	}, {
+		title: "not a filter",
+		input: `let p = Path("/foo") && Method("GET"); r: * -> p -> <shunt>`,
+		err:   "parse failed after token ->, last route id: r, position 51: p is not a filter",
+	}, {
+		title: "not a predicate",
+		input: `let b = "https://www.example.org"; r: b -> <shunt>`,
+		err:   "parse failed after token ->, last route id: r, position 42: b is not a predicate",
+	}, {
+		title: "not an argument",
+		input: `let f = flowId(); r: * -> setPath(f) -> <shunt>`,
+		err:   "parse failed after token f, last route id: r, position 35: f is not a string, number or regular expression",
+	}, {
+		title: "invalid keyword",
+		input: `var a = "foo"`,
+		err:   "parse failed after token foo, position 13: unexpected var, expected let",
+	}, {
+		title: "include not supported",
+		input: `include "other.eskip"`,
+		err:   "parse failed after token other.eskip, position 21: include not supported: other.eskip",
+	}} {
+		t.Run(tt.title, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestReferencesInFiltersAndPredicates(t *testing.T) {
+	_, err := ParseFilters("foo -> bar()")
+	assert.EqualError(t, err, "parse failed after token ->, position 6: syntax error")
+
+	_, err = ParsePredicates("Foo() && bar")
+	assert.EqualError(t, err, "parse failed after token bar, position 12: syntax error")
+}
+
+func TestParseWithOptions(t *testing.T) {
+	documents := map[string]string{
+		"main.eskip": `
+			let backend = "https://www.example.org";
+			include "common.eskip";
+			r1: Path("/foo") -> common -> backend;
+		`,
+		"common.eskip": `
+			let common = flowId();
+			include "health.eskip";
+		`,
+		"health.eskip": `health: Path("/health") -> status(200) -> <shunt>`,
+		"cycle.eskip":  `include "cycle.eskip"`,
+		"diamond.eskip": `
+			include "a.eskip";
+			include "b.eskip";
+			r: Path("/foo") -> a -> b -> backend;
+		`,
+		"a.eskip": `
+			include "defs.eskip";
+			let a = setPath("/a");
+		`,
+		"b.eskip": `
+			include "defs.eskip";
+			let b = setQuery("b", "1");
+		`,
+		"defs.eskip": `
+			let backend = "https://www.example.org";
+			defs: Path("/defs") -> backend;
+		`,
+		"invalid.eskip": `
+			let foo = "bar";
+			r: * -> foo -> #`,
+		"main-invalid.eskip": `
+			// includes an invalid document
+			include "invalid.eskip"`,
+	}
+
+	include := func(from, path string) (string, string, error) {
+		d, ok := documents[path]
+		if !ok {
+			return "", "", errors.New("not found")
+		}
+
+		return path, d, nil
+	}
+
+	t.Run("include", func(t *testing.T) {
+		routes, err := ParseWithOptions(documents["main.eskip"], ParseOptions{Name: "main.eskip", Include: include})
+		require.NoError(t, err)
+		assert.Equal(t, []*Route{{
+			Id:          "health",
+			Path:        "/health",
+			Filters:     []*Filter{{Name: "status", Args: []interface{}{float64(200)}}},
+			BackendType: ShuntBackend,
+			Shunt:       true,
+		}, {
+			Id:      "r1",
+			Path:    "/foo",
+			Filters: []*Filter{{Name: "flowId", Args: []interface{}{}}},
+			Backend: "https://www.example.org",
+		}}, normalizeArgs(routes))
+	})
+
+	t.Run("diamond include", func(t *testing.T) {
+		routes, err := ParseWithOptions(documents["diamond.eskip"], ParseOptions{Name: "diamond.eskip", Include: include})
+		require.NoError(t, err)
+		assert.Equal(t, []*Route{{
+			Id:      "defs",
+			Path:    "/defs",
+			Backend: "https://www.example.org",
+		}, {
+			Id:   "r",
+			Path: "/foo",
+			Filters: []*Filter{
+				{Name: "setPath", Args: []interface{}{"/a"}},
+				{Name: "setQuery", Args: []interface{}{"b", "1"}},
+			},
+			Backend: "https://www.example.org",
+		}}, normalizeArgs(routes))
+	})
+
+	for _, tt := range []struct {
+		title string
+		name  string
+		err   string
+	}{{
+		title: "error with line and column",
+		name:  "invalid.eskip",
+		err:   "invalid.eskip:3:18: parse failed after token ->, last route id: r, position 38: foo is not a filter",
+	}, {
+		title: "error in included document",
+		name:  "main-invalid.eskip",
+		err:   "invalid.eskip:3:18: parse failed after token ->, last route id: r, position 38: foo is not a filter",
+	}, {
+		title: "include cycle",
+		name:  "cycle.eskip",
+		err:   "cycle.eskip:1:22: parse failed after token cycle.eskip, position 21: include cycle: cycle.eskip",
+	}, {
+		title: "include failed",
+		name:  "missing.eskip",
+		err:   "missing.eskip:1:24: parse failed after token missing.eskip, position 23: include failed: not found",
+	}} {
+		t.Run(tt.title, func(t *testing.T) {
+			doc, ok := documents[tt.name]
+			if !ok {
+				doc = `include "missing.eskip"`
+			}
+
+			_, err := ParseWithOptions(doc, ParseOptions{Name: tt.name, Include: include})
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
@@ -229,6 +229,40 @@ Example with comments:
 	route1: Path("/api") -> "https://api.example.org";
 	route2: * -> <shunt> // everything else 404
 
+# Definitions
+
+A routing document can define names with the let statement, for
+strings, numbers, regular expressions, backends, filter chains and
+predicates combined by '&&'. The names can be used in the routes and in
+the later definitions, where a value of that kind is expected. A string
+can be used both as an argument and as a backend, and a single filter or
+predicate both as a filter and as a predicate. The names must be defined
+before they are used, and they can be defined only once.
+
+Example with definitions:
+
+	let backend = "https://api.example.org";
+	let authChain = oauthTokeninfoAnyScope("uid") -> flowId("reuse");
+	let api = Host(/^api[.]example[.]org$/) && Method("GET");
+
+	users: api && Path("/users") -> authChain -> backend;
+	orders: api && Path("/orders") -> authChain -> setPath("/v2/orders") -> backend;
+
+# Include
+
+A routing document can include other documents with the include
+directive. The routes of the included document are added to the
+routing table, and its definitions can be used after the directive:
+
+	include "common.eskip";
+
+	users: Path("/users") -> authChain -> backend;
+
+The include directives are supported only when the document is parsed
+with the ParseWithOptions function, and the Include option is set. The
+eskipfile package resolves the included files relative to the including
+file.
+
 # Regular expressions
 
 The matching predicates and the built-in filters that use regular
@@ -246,12 +280,20 @@ without the matcher and backend part of a full route expression.
 Parsing a routing table or a route expression happens with the
 eskip.Parse function. In case of grammar error, it returns an error with
 the approximate position of the invalid syntax element; otherwise, it
-returns a list of structured, in-memory route definitions.
+returns a list of structured, in-memory route definitions. When the
+document is parsed with ParseWithOptions and a name, the errors report
+the name, the line and the column, too.
 
 The eskip parser does not validate the routes against all semantic rules,
 e.g., whether a filter or a custom predicate implementation is available.
 This validation happens during processing the parsed definitions.
 
+# Formatting
+
+The Format function formats a routing document in a canonical form,
+keeping the comments, the definitions and the include directives. It is
+used by the eskip fmt command.
+
 # Serializing
 
 Serializing a single route happens by calling its String method.
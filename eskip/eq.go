@@ -103,6 +103,10 @@ func eq2(left, right *Route) bool {
 		return false
 	}
 
+	if lc.LBDiscovery != rc.LBDiscovery {
+		return false
+	}
+
 	if !eqLBEndpoints(lc.LBEndpoints, rc.LBEndpoints) {
 		return false
 	}
@@ -255,6 +259,7 @@ func Canonical(r *Route) *Route {
 	case LBBackend:
 		// using the LB fields only when apply:
 		c.LBAlgorithm = r.LBAlgorithm
+		c.LBDiscovery = r.LBDiscovery
 		c.LBEndpoints = make([]*LBEndpoint, len(r.LBEndpoints))
 		copy(c.LBEndpoints, r.LBEndpoints)
 		sort.Slice(c.LBEndpoints, func(i, j int) bool {
@@ -236,8 +236,23 @@ func (fb *fwdBackend) Do(routes []*Route) []*Route {
 	return routes
 }
 
+// Service discovery mechanisms of load balanced backends.
+const (
+	// DNSDiscovery resolves the hostnames of the endpoint URLs to
+	// their A and AAAA records, e.g. <dns, "http://service.internal:8080">.
+	DNSDiscovery = "dns"
+
+	// SRVDiscovery resolves the endpoints from SRV records, e.g.
+	// <srv, "_http._tcp.service.internal">.
+	SRVDiscovery = "srv"
+)
+
 var errMixedProtocols = errors.New("loadbalancer endpoints cannot have mixed protocols")
 
+func isLBDiscovery(s string) bool {
+	return s == DNSDiscovery || s == SRVDiscovery
+}
+
 // Route definition used during the parser processes the raw routing
 // document.
 type parsedRoute struct {
@@ -251,6 +266,7 @@ type parsedRoute struct {
 	forward     bool
 	backend     string
 	lbAlgorithm string
+	lbDiscovery string
 	lbEndpoints []string
 }
 
@@ -343,6 +359,12 @@ type Route struct {
 	// in case of load balancing backends.
 	LBAlgorithm string
 
+	// LBDiscovery stores the name of the service discovery
+	// mechanism, DNSDiscovery or SRVDiscovery, in case of load
+	// balancing backends whose endpoints are resolved at runtime.
+	// In this case, LBEndpoints contains the names to resolve.
+	LBDiscovery string
+
 	// LBEndpoints stores one or more backend endpoint in case of
 	// load balancing backends.
 	LBEndpoints []*LBEndpoint
@@ -610,7 +632,16 @@ func applyPredicates(route *Route, proute *parsedRoute) error {
 // Converts a parsing route objects to the exported route definition with
 // pre-processed but not validated matchers.
 func newRouteDefinition(r *parsedRoute) (*Route, error) {
-	if len(r.lbEndpoints) > 0 {
+	lbAlgorithm, lbDiscovery := r.lbAlgorithm, r.lbDiscovery
+	if lbDiscovery == "" && isLBDiscovery(lbAlgorithm) {
+		lbAlgorithm, lbDiscovery = "", lbAlgorithm
+	}
+
+	if lbDiscovery != "" && !isLBDiscovery(lbDiscovery) {
+		return nil, fmt.Errorf("unsupported service discovery: %s", lbDiscovery)
+	}
+
+	if len(r.lbEndpoints) > 0 && lbDiscovery != SRVDiscovery {
 		scheme := ""
 		for _, e := range r.lbEndpoints {
 			eu, err := url.ParseRequestURI(e)
@@ -631,7 +662,8 @@ func newRouteDefinition(r *parsedRoute) (*Route, error) {
 	rd.Filters = r.filters
 	rd.Shunt = r.shunt
 	rd.Backend = r.backend
-	rd.LBAlgorithm = r.lbAlgorithm
+	rd.LBAlgorithm = lbAlgorithm
+	rd.LBDiscovery = lbDiscovery
 	rd.LBEndpoints = NewLBEndpoints(r.lbEndpoints)
 
 	switch {
@@ -670,6 +702,11 @@ func parseDocument(code string) ([]*parsedRoute, error) {
 	return routes, err
 }
 
+func parseDocumentWithOptions(code string, o ParseOptions) ([]*parsedRoute, error) {
+	routes, _, _, err := parseWithContext(start_document, code, o.Name, newParseContext(o))
+	return routes, err
+}
+
 func parsePredicates(code string) ([]*Predicate, error) {
 	_, predicates, _, err := parse(start_predicates, code)
 	return predicates, err
@@ -681,6 +718,15 @@ func parseFilters(code string) ([]*Filter, error) {
 }
 
 func parse(start int, code string) ([]*parsedRoute, []*Predicate, []*Filter, error) {
+	var ctx *parseContext
+	if start == start_document {
+		ctx = newParseContext(ParseOptions{})
+	}
+
+	return parseWithContext(start, code, "", ctx)
+}
+
+func parseWithContext(start int, code, name string, ctx *parseContext) ([]*parsedRoute, []*Predicate, []*Filter, error) {
 	lp := parserPool.Get().(*eskipLexParser)
 	defer func() {
 		*lp = eskipLexParser{}
@@ -689,6 +735,8 @@ func parse(start int, code string) ([]*parsedRoute, []*Predicate, []*Filter, err
 
 	lexer := &lp.lexer
 	lexer.init(start, code)
+	lexer.name = name
+	lexer.context = ctx
 
 	lp.parser.Parse(lexer)
 
@@ -697,6 +745,20 @@ func parse(start int, code string) ([]*parsedRoute, []*Predicate, []*Filter, err
 	return lexer.routes, lexer.predicates, lexer.filters, lexer.err
 }
 
+// ParseOptions are used by ParseWithOptions.
+type ParseOptions struct {
+	// Name identifies the parsed document in the error messages, e.g.
+	// the name of the file. When set, the errors tell the line and the
+	// column, too.
+	Name string
+
+	// Include loads the documents referenced by the include directives.
+	// It receives the name of the including document and the path in the
+	// directive, and returns the name and the content of the included
+	// document. When not set, the include directives fail.
+	Include func(from, path string) (name, content string, err error)
+}
+
 // Parse a route expression or a routing document to a set of route definitions.
 func Parse(code string) ([]*Route, error) {
 	parsedRoutes, err := parseDocument(code)
@@ -704,6 +766,21 @@ func Parse(code string) ([]*Route, error) {
 		return nil, err
 	}
 
+	return newRouteDefinitions(parsedRoutes)
+}
+
+// ParseWithOptions parses a routing document like Parse, and loads the
+// documents of the include directives with the options.
+func ParseWithOptions(code string, o ParseOptions) ([]*Route, error) {
+	parsedRoutes, err := parseDocumentWithOptions(code, o)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRouteDefinitions(parsedRoutes)
+}
+
+func newRouteDefinitions(parsedRoutes []*parsedRoute) ([]*Route, error) {
 	routeDefinitions := make([]*Route, len(parsedRoutes))
 	for i, r := range parsedRoutes {
 		rd, err := newRouteDefinition(r)
@@ -0,0 +1,476 @@
+package eskip
+
+import (
+	"sort"
+	"strings"
+)
+
+const maxFormattedLineLength = 100
+
+type syntaxKind int
+
+const (
+	predicateSyntax syntaxKind = iota
+	filterSyntax
+	backendSyntax
+	valueSyntax
+)
+
+type statementKind int
+
+const (
+	routeStatement statementKind = iota
+	letStatement
+	includeStatement
+)
+
+type span struct {
+	pos, end int
+}
+
+// syntaxElement is a predicate, a filter or a backend of a route, or the
+// value, or an item in the chain of a let statement.
+type syntaxElement struct {
+	span
+	kind     syntaxKind
+	isCall   bool
+	name     string
+	args     []span
+	leading  []span
+	trailing []span
+}
+
+// syntaxStatement is a route, a let statement or an include directive.
+// The head is the route id with the colon, the let keyword with the name
+// and the equal sign, or the whole include directive.
+type syntaxStatement struct {
+	span
+	kind     statementKind
+	name     string
+	head     span
+	elements []*syntaxElement
+	leading  []span
+	trailing []span
+}
+
+// syntaxTree records the statements and the comments of a routing
+// document with their positions, when parsing for formatting.
+type syntaxTree struct {
+	comments   []span
+	args       []span
+	call       *syntaxElement
+	elements   []*syntaxElement
+	statements []*syntaxStatement
+
+	// comments not followed by any statement
+	endComments []span
+}
+
+// FormatOptions are used by Format.
+type FormatOptions struct {
+	// Name identifies the formatted document in the error messages.
+	Name string
+
+	// SortRoutes sorts the routes by their id. The let statements and the
+	// include directives are placed before the routes, in their original
+	// order.
+	SortRoutes bool
+}
+
+type anchor struct {
+	span
+	leading  *[]span
+	trailing *[]span
+}
+
+type formatter struct {
+	input string
+}
+
+func (l *eskipLex) syntax() *syntaxTree {
+	if l.context == nil {
+		return nil
+	}
+
+	return l.context.syntax
+}
+
+func (l *eskipLex) syntaxComment(pos, end int) {
+	if t := l.syntax(); t != nil {
+		t.comments = append(t.comments, span{pos, end})
+	}
+}
+
+func (l *eskipLex) syntaxArg(pos, end int) {
+	if t := l.syntax(); t != nil {
+		t.args = append(t.args, span{pos, end})
+	}
+}
+
+func (l *eskipLex) syntaxCall(name string, pos, end int) {
+	if t := l.syntax(); t != nil {
+		t.call = &syntaxElement{span: span{pos, end}, isCall: true, name: name, args: t.args}
+		t.args = nil
+	}
+}
+
+func (l *eskipLex) syntaxCallElement(kind syntaxKind) {
+	if t := l.syntax(); t != nil && t.call != nil {
+		t.call.kind = kind
+		t.elements = append(t.elements, t.call)
+		t.call = nil
+	}
+}
+
+func (l *eskipLex) syntaxElement(kind syntaxKind, pos, end int) {
+	if t := l.syntax(); t != nil {
+		t.elements = append(t.elements, &syntaxElement{span: span{pos, end}, kind: kind})
+	}
+}
+
+func (l *eskipLex) syntaxStatement(kind statementKind, name string, pos, headEnd, end int) {
+	t := l.syntax()
+	if t == nil {
+		return
+	}
+
+	elements := t.elements
+	t.elements = nil
+	sort.SliceStable(elements, func(i, j int) bool { return elements[i].pos < elements[j].pos })
+	t.statements = append(t.statements, &syntaxStatement{
+		span:     span{pos, end},
+		kind:     kind,
+		name:     name,
+		head:     span{pos, headEnd},
+		elements: elements,
+	})
+}
+
+func (l *eskipLex) syntaxRoute(id string, pos, headEnd, end int) {
+	l.syntaxStatement(routeStatement, id, pos, headEnd, end)
+}
+
+func (l *eskipLex) syntaxLet(name string, pos, headEnd, end int) {
+	l.syntaxStatement(letStatement, name, pos, headEnd, end)
+}
+
+func (l *eskipLex) syntaxInclude(pos, pathPos, pathEnd int) {
+	l.syntaxStatement(includeStatement, l.input[pathPos:pathEnd], pos, pathEnd, pathEnd)
+}
+
+// attachComments assigns the comments to the statements and the
+// elements. A comment inside an element, or on its own line before it,
+// precedes the element. A comment on the same line after an element
+// follows it.
+func (t *syntaxTree) attachComments(input string) {
+	var anchors []anchor
+	for _, s := range t.statements {
+		if s.head.end > s.head.pos {
+			anchors = append(anchors, anchor{s.head, &s.leading, &s.trailing})
+		}
+
+		for _, e := range s.elements {
+			anchors = append(anchors, anchor{e.span, &e.leading, &e.trailing})
+		}
+	}
+
+	for _, c := range t.comments {
+		next := sort.Search(len(anchors), func(i int) bool { return anchors[i].end > c.pos })
+		switch {
+		case next < len(anchors) && anchors[next].pos < c.pos:
+			*anchors[next].leading = append(*anchors[next].leading, c)
+		case next > 0 && !strings.Contains(input[anchors[next-1].end:c.pos], "\n"):
+			*anchors[next-1].trailing = append(*anchors[next-1].trailing, c)
+		case next < len(anchors):
+			*anchors[next].leading = append(*anchors[next].leading, c)
+		default:
+			t.endComments = append(t.endComments, c)
+		}
+	}
+}
+
+// blankLineBefore tells if there is an empty line between a position
+// and the preceding code.
+func blankLineBefore(input string, pos int) bool {
+	newlines := 0
+	for i := pos - 1; i >= 0; i-- {
+		switch input[i] {
+		case '\n':
+			newlines++
+		case ' ', '\t', '\r', '\v', '\f':
+		default:
+			return newlines > 1
+		}
+	}
+
+	return false
+}
+
+func (f *formatter) text(s span) string {
+	return strings.TrimRight(f.input[s.pos:s.end], " \t\r")
+}
+
+// normalizeTokens removes the comments and the line breaks from an
+// expression, and separates the tokens only after the commas.
+func normalizeTokens(code string) string {
+	var b strings.Builder
+	for {
+		code = scanWhitespace(code)
+		if code == "" {
+			return b.String()
+		}
+
+		_, rest, err := scan(code)
+		if err != nil && err != errVoid {
+			return b.String() + code
+		}
+
+		if err == nil {
+			t := code[:len(code)-len(rest)]
+			b.WriteString(t)
+			if t == "," {
+				b.WriteByte(' ')
+			}
+		}
+
+		code = rest
+	}
+}
+
+func (f *formatter) element(e *syntaxElement) string {
+	if !e.isCall {
+		return normalizeTokens(f.input[e.pos:e.end])
+	}
+
+	args := make([]string, len(e.args))
+	for i, a := range e.args {
+		args[i] = f.text(a)
+	}
+
+	return e.name + "(" + strings.Join(args, ", ") + ")"
+}
+
+func (f *formatter) trailing(comments []span) string {
+	if len(comments) == 0 {
+		return ""
+	}
+
+	texts := make([]string, len(comments))
+	for i, c := range comments {
+		texts[i] = f.text(c)
+	}
+
+	return " " + strings.Join(texts, " ")
+}
+
+// comments returns the lines of the comments, keeping the empty lines
+// between them.
+func (f *formatter) comments(comments []span, indent string) []string {
+	var lines []string
+	for i, c := range comments {
+		if i > 0 && blankLineBefore(f.input, c.pos) {
+			lines = append(lines, "")
+		}
+
+		lines = append(lines, indent+f.text(c))
+	}
+
+	return lines
+}
+
+// chain formats a route or a let statement. The first line contains the
+// head and the first item, and the rest of the items are placed on
+// separate lines, unless the whole statement fits in a single line and
+// contains no comments other than the trailing one.
+func (f *formatter) chain(head string, first []*syntaxElement, firstSeparator string, rest []*syntaxElement, restSeparator, terminator string) []string {
+	all := append(append([]*syntaxElement(nil), first...), rest...)
+
+	inline := func(elements []*syntaxElement, allowTrailing bool) bool {
+		for i, e := range elements {
+			if i > 0 && len(e.leading) > 0 {
+				return false
+			}
+
+			if len(e.trailing) > 0 && (!allowTrailing || i < len(elements)-1) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	join := func(elements []*syntaxElement, separator string) string {
+		texts := make([]string, len(elements))
+		for i, e := range elements {
+			texts[i] = f.element(e)
+		}
+
+		return strings.Join(texts, separator)
+	}
+
+	last := all[len(all)-1]
+	if inline(all, true) {
+		line := head + join(first, " "+firstSeparator+" ")
+		if len(rest) > 0 {
+			line += " " + restSeparator + " " + join(rest, " "+restSeparator+" ")
+		}
+
+		line += terminator
+		if len(line) <= maxFormattedLineLength {
+			return []string{line + f.trailing(last.trailing)}
+		}
+	}
+
+	var lines []string
+	lineOf := func(e *syntaxElement, separator string) {
+		lines = append(lines, f.comments(e.leading, "  ")...)
+		line := "  " + separator + " " + f.element(e)
+		if e == last {
+			line += terminator
+		}
+
+		lines = append(lines, line+f.trailing(e.trailing))
+	}
+
+	if inline(first, false) && (len(rest) > 0 || len(first) == 1) {
+		line := head + join(first, " "+firstSeparator+" ")
+		if len(rest) == 0 {
+			line += terminator
+		}
+
+		lines = append(lines, line)
+	} else {
+		line := head + f.element(first[0])
+		if first[0] == last {
+			line += terminator
+		}
+
+		lines = append(lines, line+f.trailing(first[0].trailing))
+		for _, e := range first[1:] {
+			lineOf(e, firstSeparator)
+		}
+	}
+
+	for _, e := range rest {
+		lineOf(e, restSeparator)
+	}
+
+	return lines
+}
+
+// statement returns the leading comment lines and the code lines of a
+// statement.
+func (f *formatter) statement(s *syntaxStatement) ([]string, []string) {
+	leading := append([]span(nil), s.leading...)
+	if s.kind == includeStatement {
+		return f.comments(leading, ""), []string{"include " + s.name + ";" + f.trailing(s.trailing)}
+	}
+
+	leading = append(leading, s.trailing...)
+	if len(s.elements) > 0 {
+		leading = append(leading, s.elements[0].leading...)
+	}
+
+	comments := f.comments(leading, "")
+	if len(s.leading) > 0 && blankLineBefore(f.input, s.pos) {
+		comments = append(comments, "")
+	}
+
+	if s.kind == letStatement {
+		head := "let " + s.name + " = "
+		separator := "->"
+		if s.elements[0].kind == predicateSyntax {
+			separator = "&&"
+		}
+
+		return comments, f.chain(head, s.elements[:1], separator, s.elements[1:], separator, ";")
+	}
+
+	var head, terminator string
+	if s.name != "" {
+		head, terminator = s.name+": ", ";"
+	}
+
+	var predicates, rest []*syntaxElement
+	for _, e := range s.elements {
+		if e.kind == predicateSyntax {
+			predicates = append(predicates, e)
+		} else {
+			rest = append(rest, e)
+		}
+	}
+
+	return comments, f.chain(head, predicates, "&&", rest, "->", terminator)
+}
+
+func (f *formatter) firstPosition(s *syntaxStatement) int {
+	if len(s.leading) > 0 {
+		return s.leading[0].pos
+	}
+
+	return s.pos
+}
+
+// Format formats a routing document in the canonical form. It keeps the
+// comments, the let statements and the include directives, and preserves
+// the single empty lines between the statements. The references and the
+// included documents are not resolved.
+func Format(code string, o FormatOptions) (string, error) {
+	ctx := newParseContext(ParseOptions{Name: o.Name})
+	ctx.syntax = &syntaxTree{}
+	if _, _, _, err := parseWithContext(start_document, code, o.Name, ctx); err != nil {
+		return "", err
+	}
+
+	t := ctx.syntax
+	t.attachComments(code)
+
+	statements := t.statements
+	if o.SortRoutes {
+		statements = append([]*syntaxStatement(nil), statements...)
+		sort.SliceStable(statements, func(i, j int) bool {
+			si, sj := statements[i], statements[j]
+			if (si.kind == routeStatement) != (sj.kind == routeStatement) {
+				return sj.kind == routeStatement
+			}
+
+			return si.kind == routeStatement && si.name < sj.name
+		})
+	}
+
+	f := &formatter{input: code}
+	var (
+		b            strings.Builder
+		previous     *syntaxStatement
+		previousMany bool
+	)
+
+	for _, s := range statements {
+		comments, lines := f.statement(s)
+		many := len(lines) > 1
+		if previous != nil && (blankLineBefore(code, f.firstPosition(s)) ||
+			many || previousMany || (previous.kind == routeStatement) != (s.kind == routeStatement)) {
+			b.WriteByte('\n')
+		}
+
+		for _, l := range append(comments, lines...) {
+			b.WriteString(l)
+			b.WriteByte('\n')
+		}
+
+		previous, previousMany = s, many
+	}
+
+	if len(t.endComments) > 0 {
+		if previous != nil && blankLineBefore(code, t.endComments[0].pos) {
+			b.WriteByte('\n')
+		}
+
+		for _, l := range f.comments(t.endComments, "") {
+			b.WriteString(l)
+			b.WriteByte('\n')
+		}
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,193 @@
+package eskip
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	for _, tt := range []struct {
+		title    string
+		input    string
+		options  FormatOptions
+		expected string
+	}{{
+		title:    "empty",
+		input:    "",
+		expected: "",
+	}, {
+		title:    "comments only",
+		input:    "// foo\n\n  // bar",
+		expected: "// foo\n\n// bar\n",
+	}, {
+		title:    "single route without id",
+		input:    `Path("/foo")->"https://www.example.org"`,
+		expected: "Path(\"/foo\") -> \"https://www.example.org\"\n",
+	}, {
+		title: "normalized spacing",
+		input: `r1:Path("/foo")&&Method("GET")->setPath("/bar",  "baz")-><roundRobin,"http://a",
+				"http://b">;r2: * -> <shunt>`,
+		expected: `r1: Path("/foo") && Method("GET") -> setPath("/bar", "baz") -> <roundRobin, "http://a", "http://b">;
+r2: * -> <shunt>;
+`,
+	}, {
+		title:    "literals kept",
+		input:    "r: PathRegexp(/^\\/foo/) && Weight(1.5) -> setPath(`/bar`) -> \"https://www.example.org\";",
+		expected: "r: PathRegexp(/^\\/foo/) && Weight(1.5) -> setPath(`/bar`) -> \"https://www.example.org\";\n",
+	}, {
+		title: "long filter chain",
+		input: `r: Path("/foo") && Method("GET") -> setRequestHeader("X-Foo", "foo") -> setRequestHeader("X-Bar", "bar") -> <shunt>;`,
+		expected: `r: Path("/foo") && Method("GET")
+  -> setRequestHeader("X-Foo", "foo")
+  -> setRequestHeader("X-Bar", "bar")
+  -> <shunt>;
+`,
+	}, {
+		title: "comments",
+		input: `
+			// routes of the foo service
+
+			// the foo route
+			foo: Path("/foo") // matches foo
+				&& Method("GET")
+				-> setPath("/bar") // rewrites the path
+				// the backend
+				-> "https://foo.example.org";
+
+			bar: Path("/bar") -> <shunt>; // bar
+			// end
+		`,
+		expected: `// routes of the foo service
+
+// the foo route
+foo: Path("/foo") // matches foo
+  && Method("GET")
+  -> setPath("/bar") // rewrites the path
+  // the backend
+  -> "https://foo.example.org";
+
+bar: Path("/bar") -> <shunt>; // bar
+// end
+`,
+	}, {
+		title: "comment inside an element",
+		input: `r: Header("X-Foo", // the header
+			"bar") -> <shunt>`,
+		expected: `// the header
+r: Header("X-Foo", "bar") -> <shunt>;
+`,
+	}, {
+		title: "empty lines",
+		input: `r1: * -> <shunt>;
+
+
+			r2: * -> <shunt>;
+			r3: * -> <shunt>;`,
+		expected: `r1: * -> <shunt>;
+
+r2: * -> <shunt>;
+r3: * -> <shunt>;
+`,
+	}, {
+		title: "definitions and includes",
+		input: `
+			include "common.eskip";
+			let backend="https://www.example.org"; // the backend
+			let auth = oauthTokeninfoAnyScope("uid") -> // tracing
+				flowId();
+			let api = Host(/^api[.]/)&&Method("GET");
+			r: api && Path("/foo") -> auth -> backend;
+		`,
+		expected: `include "common.eskip";
+let backend = "https://www.example.org"; // the backend
+
+let auth = oauthTokeninfoAnyScope("uid") // tracing
+  -> flowId();
+
+let api = Host(/^api[.]/) && Method("GET");
+
+r: api && Path("/foo") -> auth -> backend;
+`,
+	}, {
+		title:   "sorted",
+		options: FormatOptions{SortRoutes: true},
+		input: `
+			// c
+			c: * -> <shunt>;
+			let backend = "https://www.example.org";
+			a: * -> backend;
+			b: * -> <shunt>;
+		`,
+		expected: `let backend = "https://www.example.org";
+
+a: * -> backend;
+b: * -> <shunt>;
+// c
+c: * -> <shunt>;
+`,
+	}} {
+		t.Run(tt.title, func(t *testing.T) {
+			formatted, err := Format(tt.input, tt.options)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, formatted)
+
+			again, err := Format(formatted, tt.options)
+			require.NoError(t, err)
+			assert.Equal(t, formatted, again, "not idempotent")
+		})
+	}
+}
+
+func TestFormatKeepsRoutes(t *testing.T) {
+	const doc = `
+		// the backend
+		let backend = <roundRobin, "http://10.2.0.1", "http://10.2.0.2">;
+		let chain = setRequestHeader("X-Foo", "foo") -> setRequestHeader("X-Bar", "bar");
+		r1: Path("/foo") && Header("X-Foo", "foo") && Header("X-Bar", "bar") -> chain -> setPath("/baz") -> backend;
+		r2: PathSubtree("/") -> status(404) -> inlineContent("not found") -> <shunt>;
+	`
+
+	formatted, err := Format(doc, FormatOptions{SortRoutes: true})
+	require.NoError(t, err)
+
+	expected, err := Parse(doc)
+	require.NoError(t, err)
+
+	routes, err := Parse(formatted)
+	require.NoError(t, err)
+
+	assert.Equal(t, expected, routes)
+}
+
+func TestFormatErrors(t *testing.T) {
+	for _, tt := range []struct {
+		title string
+		input string
+		err   string
+	}{{
+		title: "syntax error",
+		input: "r: * -> ",
+		err:   "test.eskip:1:9: parse failed after token ->, last route id: r, position 8: syntax error",
+	}, {
+		title: "invalid keyword",
+		input: `var a = "foo"`,
+		err:   "test.eskip:1:14: parse failed after token foo, position 13: unexpected var, expected let",
+	}} {
+		t.Run(tt.title, func(t *testing.T) {
+			_, err := Format(tt.input, FormatOptions{Name: "test.eskip"})
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestFormatUnresolved(t *testing.T) {
+	// the references are not resolved, and the names can be defined
+	// more than once
+	const doc = "let a = \"foo\";\nlet a = \"bar\";\nr: * -> undefined -> a;\n"
+	formatted, err := Format(doc, FormatOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, strings.Replace(doc, ";\nr:", ";\n\nr:", 1), formatted)
+}
@@ -14,6 +14,7 @@ type jsonBackend struct {
 	Type      string   `json:"type"`
 	Address   string   `json:"address,omitempty"`
 	Algorithm string   `json:"algorithm,omitempty"`
+	Discovery string   `json:"discovery,omitempty"`
 	Endpoints []string `json:"endpoints,omitempty"`
 }
 
@@ -37,6 +38,7 @@ func newJSONRoute(r *Route) *jsonRoute {
 			Type:      cr.BackendType.String(),
 			Address:   cr.Backend,
 			Algorithm: cr.LBAlgorithm,
+			Discovery: cr.LBDiscovery,
 			Endpoints: LBEndpointString(cr.LBEndpoints),
 		}
 	}
@@ -94,6 +96,7 @@ func (r *Route) UnmarshalJSON(b []byte) error {
 		}
 	case LBBackend:
 		r.LBAlgorithm = jr.Backend.Algorithm
+		r.LBDiscovery = jr.Backend.Discovery
 		r.LBEndpoints = NewLBEndpoints(jr.Backend.Endpoints)
 		if len(r.LBEndpoints) == 0 {
 			r.LBEndpoints = nil
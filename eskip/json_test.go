@@ -91,6 +91,11 @@ func TestMarshalUnmarshalJSON(t *testing.T) {
 			[]*Route{{Id: "beef", BackendType: LBBackend, LBAlgorithm: "yolo", LBEndpoints: []*LBEndpoint{{Address: "localhost"}}}},
 			`[{"id":"beef","backend":{"type":"lb","algorithm":"yolo","endpoints":["localhost"]}}]`,
 		},
+		{
+			"lb backend with discovery",
+			[]*Route{{Id: "beef", BackendType: LBBackend, LBDiscovery: SRVDiscovery, LBEndpoints: []*LBEndpoint{{Address: "_http._tcp.localhost"}}}},
+			`[{"id":"beef","backend":{"type":"lb","discovery":"srv","endpoints":["_http._tcp.localhost"]}}]`,
+		},
 		{
 			"shunt backend",
 			[]*Route{{Id: "shunty", BackendType: ShuntBackend}},
@@ -16,9 +16,15 @@ type charPredicate func(byte) bool
 type eskipLex struct {
 	start         int
 	code          string
+	input         string
+	name          string
+	context       *parseContext
 	lastToken     string
+	tokenPos      int
+	tokenEnd      int
 	lastRouteID   string
 	err           error
+	aborted       bool
 	initialLength int
 	routes        []*parsedRoute
 	predicates    []*Predicate
@@ -53,6 +59,7 @@ var (
 	semicolonToken  = &fixedScanner{semicolon, ";"}
 	openarrowToken  = &fixedScanner{openarrow, "<"}
 	closearrowToken = &fixedScanner{closearrow, ">"}
+	equalsToken     = &fixedScanner{equals, "="}
 )
 
 var openarrowPrefixedTokens = []*fixedScanner{
@@ -69,6 +76,7 @@ func (fs *fixedScanner) scan(code string) (t token, rest string, err error) {
 func (l *eskipLex) init(start int, code string) {
 	l.start = start
 	l.code = code
+	l.input = code
 	l.initialLength = len(code)
 }
 
@@ -301,6 +309,8 @@ func scan(code string) (token, string, error) {
 		return closearrowToken.scan(code)
 	case '*':
 		return anyToken.scan(code)
+	case '=':
+		return equalsToken.scan(code)
 	case '&':
 		if len(code) >= 2 && code[1] == '&' {
 			return andToken.scan(code)
@@ -345,14 +355,19 @@ func (l *eskipLex) next() (token, error) {
 	if err == errUnexpectedToken {
 		return token{}, err
 	}
+
+	pos := l.initialLength - len(l.code)
 	l.code = rest
+	end := l.initialLength - len(l.code)
 
 	if err == errVoid {
+		l.syntaxComment(pos, end)
 		return l.next()
 	}
 
 	if err == nil {
 		l.lastToken = t.val
+		l.tokenPos, l.tokenEnd = pos, end
 	}
 
 	return t, err
@@ -366,6 +381,11 @@ func (l *eskipLex) Lex(lval *eskipSymType) int {
 		return start
 	}
 
+	// stop parsing after an error in a semantic action
+	if l.aborted {
+		return -1
+	}
+
 	t, err := l.next()
 	if err == errEOF {
 		return -1
@@ -377,15 +397,48 @@ func (l *eskipLex) Lex(lval *eskipSymType) int {
 	}
 
 	lval.token = t.val
+	lval.pos, lval.end = l.tokenPos, l.tokenEnd
 	return t.id
 }
 
 func (l *eskipLex) Error(err string) {
+	// keep the error of the semantic action instead of the syntax error
+	// caused by the aborted input
+	if l.aborted {
+		return
+	}
+
+	l.err = l.error(err)
+}
+
+func (l *eskipLex) error(err string) error {
 	lastRouteID := ""
 	if l.lastRouteID != "" {
 		lastRouteID = ", last route id: " + l.lastRouteID
 	}
-	l.err = fmt.Errorf(
+
+	position := l.initialLength - len(l.code)
+	e := fmt.Errorf(
 		"parse failed after token %s%s, position %d: %s",
-		l.lastToken, lastRouteID, l.initialLength-len(l.code), err)
+		l.lastToken, lastRouteID, position, err)
+	if l.name == "" {
+		return e
+	}
+
+	consumed := l.input[:position]
+	line := strings.Count(consumed, "\n") + 1
+	column := position - strings.LastIndexByte(consumed, '\n')
+	return fmt.Errorf("%s:%d:%d: %w", l.name, line, column, e)
+}
+
+// fail aborts the parsing with an error from a semantic action.
+func (l *eskipLex) fail(err error) {
+	if !l.aborted {
+		l.err = err
+		l.aborted = true
+	}
+}
+
+func (l *eskipLex) failf(format string, args ...interface{}) {
+	l.fail(l.error(fmt.Sprintf(format, args...)))
 }
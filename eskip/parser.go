@@ -19,6 +19,8 @@ func convertNumber(s string) float64 {
 type eskipSymType struct {
 	yys         int
 	token       string
+	pos         int
+	end         int
 	route       *parsedRoute
 	routes      []*parsedRoute
 	predicates  []*Predicate
@@ -36,7 +38,9 @@ type eskipSymType struct {
 	numval      float64
 	stringvals  []string
 	lbAlgorithm string
+	lbDiscovery string
 	lbEndpoints []string
+	definition  *definition
 }
 
 const and = 57346
@@ -57,9 +61,10 @@ const stringliteral = 57360
 const symbol = 57361
 const openarrow = 57362
 const closearrow = 57363
-const start_document = 57364
-const start_predicates = 57365
-const start_filters = 57366
+const equals = 57364
+const start_document = 57365
+const start_predicates = 57366
+const start_filters = 57367
 
 var eskipToknames = [...]string{
 	"$end",
@@ -83,6 +88,7 @@ var eskipToknames = [...]string{
 	"symbol",
 	"openarrow",
 	"closearrow",
+	"equals",
 	"start_document",
 	"start_predicates",
 	"start_filters",
@@ -94,78 +100,104 @@ const eskipEofCode = 1
 const eskipErrCode = 2
 const eskipInitialStackSize = 16
 
-//line parser.y:315
+//line parser.y:479
 
 //line yacctab:1
 var eskipExca = [...]int8{
 	-1, 1,
 	1, -1,
 	-2, 0,
+	-1, 43,
+	6, 41,
+	-2, 62,
+	-1, 69,
+	4, 37,
+	6, 41,
+	-2, 25,
+	-1, 70,
+	4, 36,
+	6, 40,
+	-2, 26,
 }
 
 const eskipPrivate = 57344
 
-const eskipLast = 69
+const eskipLast = 104
 
 var eskipAct = [...]int8{
-	49, 40, 17, 29, 39, 32, 33, 34, 36, 31,
-	18, 37, 2, 3, 4, 11, 56, 16, 44, 13,
-	43, 51, 50, 8, 18, 13, 42, 51, 45, 28,
-	60, 46, 19, 15, 26, 24, 7, 38, 30, 12,
-	57, 23, 23, 27, 24, 58, 54, 22, 53, 47,
-	45, 55, 52, 25, 53, 59, 21, 21, 20, 61,
-	9, 35, 48, 41, 14, 10, 6, 5, 1,
+	57, 17, 20, 9, 21, 48, 22, 18, 35, 13,
+	16, 41, 49, 46, 76, 53, 23, 63, 16, 64,
+	65, 66, 67, 62, 69, 44, 34, 22, 36, 2,
+	3, 4, 19, 59, 22, 82, 45, 54, 38, 39,
+	40, 42, 37, 43, 44, 8, 59, 84, 70, 59,
+	58, 71, 7, 53, 16, 51, 72, 22, 68, 61,
+	54, 50, 52, 30, 75, 30, 31, 27, 15, 24,
+	33, 31, 77, 29, 28, 29, 28, 87, 78, 83,
+	81, 22, 85, 73, 86, 74, 32, 26, 88, 25,
+	79, 55, 26, 80, 56, 47, 14, 60, 12, 11,
+	10, 6, 5, 1,
 }
 
 var eskipPact = [...]int16{
-	-10, -1000, 20, 14, 5, -1000, 19, -1000, -1000, 52,
-	14, -1000, 33, -1000, 53, 24, 47, -1000, 23, 10,
-	-9, 14, -1000, -1000, 8, 5, 8, -1000, 34, -1000,
-	43, -1000, -1000, -1000, -1000, -1000, -1000, 3, -1000, 45,
-	-1000, -1000, -1000, -1000, -1000, -1000, 39, -9, -5, 31,
-	36, -1000, -1000, 8, -1000, -1000, -1000, 12, 9, -1000,
-	-1000, 31,
+	6, -1000, 49, 13, -3, -1000, 56, -1000, -1000, 83,
+	-1000, -1000, -1000, -1000, 13, 55, -1000, -1000, 88, 60,
+	80, -1000, -1000, 60, 7, 24, 13, -1000, -9, -1000,
+	-1000, 43, -3, -1000, 57, -1000, 85, -1000, -1000, -1000,
+	-1000, -1000, -1000, 60, 31, -1000, 5, 76, -1000, -1000,
+	-1000, -1000, -1000, -1000, -1000, 24, -7, 63, 69, -1000,
+	-1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, 60,
+	-1000, 84, 89, -1000, 43, -1000, -1000, 17, 28, -3,
+	13, -1000, -1000, 63, 68, 80, 88, 15, 63,
 }
 
 var eskipPgo = [...]int8{
-	0, 68, 67, 60, 17, 66, 36, 23, 65, 3,
-	15, 4, 2, 1, 63, 0, 62, 61,
+	0, 103, 102, 3, 2, 101, 52, 45, 100, 99,
+	98, 97, 12, 11, 1, 4, 9, 96, 8, 95,
+	5, 0, 94,
 }
 
 var eskipR1 = [...]int8{
 	0, 1, 1, 1, 1, 1, 2, 2, 5, 5,
-	5, 5, 7, 8, 6, 6, 3, 3, 10, 10,
-	4, 4, 12, 11, 11, 11, 13, 13, 13, 15,
-	15, 16, 16, 17, 9, 9, 9, 9, 9, 9,
-	14,
+	5, 5, 7, 7, 7, 9, 10, 11, 11, 11,
+	11, 11, 11, 11, 11, 11, 11, 11, 11, 8,
+	17, 6, 6, 3, 3, 16, 16, 16, 4, 4,
+	15, 15, 14, 19, 19, 19, 20, 20, 20, 20,
+	21, 21, 22, 22, 22, 13, 18, 18, 18, 18,
+	18, 18, 18, 12,
 }
 
 var eskipR2 = [...]int8{
 	0, 2, 1, 2, 1, 2, 1, 1, 0, 1,
-	3, 2, 2, 2, 3, 5, 1, 3, 1, 4,
-	1, 3, 4, 0, 1, 3, 1, 1, 1, 1,
-	3, 1, 3, 3, 1, 1, 1, 1, 1, 1,
-	1,
+	3, 2, 1, 1, 1, 4, 2, 1, 1, 1,
+	1, 1, 1, 1, 1, 1, 1, 3, 3, 2,
+	2, 3, 5, 1, 3, 1, 1, 1, 1, 3,
+	1, 1, 4, 0, 1, 3, 1, 1, 1, 1,
+	1, 3, 1, 3, 5, 3, 1, 1, 1, 1,
+	1, 1, 1, 1,
 }
 
 var eskipChk = [...]int16{
-	-1000, -1, 22, 23, 24, -2, -5, -6, -7, -3,
-	-8, -10, 19, 5, -3, 19, -4, -12, 19, 13,
-	6, 4, -6, 8, 11, 6, 11, -7, 19, -9,
-	-4, 18, 14, 15, 16, -17, 17, 20, -10, -11,
-	-13, -14, 18, 12, 10, -12, -11, 6, -16, -15,
-	19, 18, 7, 9, 7, -9, 21, 9, 9, -13,
-	18, -15,
+	-1000, -1, 23, 24, 25, -2, -5, -6, -7, -3,
+	-8, -9, -10, -16, -17, 19, 5, -14, -3, 19,
+	-4, -15, -14, 19, 13, 6, 4, -6, 19, 18,
+	8, 11, 6, -7, 19, -18, -4, 18, 14, 15,
+	16, -13, 17, 19, 20, -16, 22, -19, -20, -12,
+	18, 12, 19, 10, -15, 6, -22, -21, 19, 18,
+	-11, -12, 18, 12, 14, 15, 16, 17, -13, 19,
+	-14, -15, -16, 7, 9, -18, 21, 9, 9, 6,
+	4, -20, 18, -21, 19, -4, -3, 9, -21,
 }
 
 var eskipDef = [...]int8{
 	0, -2, 8, 2, 4, 1, 6, 7, 9, 0,
-	0, 16, 0, 18, 3, 0, 5, 20, 0, 11,
-	0, 0, 12, 13, 23, 0, 23, 10, 0, 14,
-	0, 34, 35, 36, 37, 38, 39, 0, 17, 0,
-	24, 26, 27, 28, 40, 21, 0, 0, 0, 31,
-	0, 29, 19, 0, 22, 15, 33, 0, 0, 25,
-	30, 32,
+	12, 13, 14, 33, 0, 37, 35, 36, 3, 37,
+	5, 38, 40, 41, 11, 0, 0, 29, 0, 16,
+	30, 43, 0, 10, 0, 31, 0, 56, 57, 58,
+	59, 60, 61, -2, 0, 34, 0, 0, 44, 46,
+	47, 48, 49, 63, 39, 0, 0, 52, 0, 50,
+	15, 17, 18, 19, 20, 21, 22, 23, 24, -2,
+	-2, 0, 0, 42, 0, 32, 55, 0, 0, 0,
+	0, 45, 51, 53, 0, 27, 28, 0, 54,
 }
 
 var eskipTok1 = [...]int8{
@@ -175,7 +207,7 @@ var eskipTok1 = [...]int8{
 var eskipTok2 = [...]int8{
 	2, 3, 4, 5, 6, 7, 8, 9, 10, 11,
 	12, 13, 14, 15, 16, 17, 18, 19, 20, 21,
-	22, 23, 24,
+	22, 23, 24, 25,
 }
 
 var eskipTok3 = [...]int8{
@@ -521,85 +553,217 @@ eskipdefault:
 
 	case 1:
 		eskipDollar = eskipS[eskippt-2 : eskippt+1]
-//line parser.y:76
+//line parser.y:81
 		{
 			eskiplex.(*eskipLex).routes = eskipDollar[2].routes
 		}
 	case 2:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:80
+//line parser.y:85
 		{
 			// allow empty or comments only
 			eskiplex.(*eskipLex).predicates = nil
 		}
 	case 3:
 		eskipDollar = eskipS[eskippt-2 : eskippt+1]
-//line parser.y:85
+//line parser.y:90
 		{
 			eskiplex.(*eskipLex).predicates = eskipDollar[2].predicates
 		}
 	case 4:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:89
+//line parser.y:94
 		{
 			// allow empty or comments only
 			eskiplex.(*eskipLex).filters = nil
 		}
 	case 5:
 		eskipDollar = eskipS[eskippt-2 : eskippt+1]
-//line parser.y:94
+//line parser.y:99
 		{
 			eskiplex.(*eskipLex).filters = eskipDollar[2].filters
 		}
 	case 6:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:99
+//line parser.y:104
 		{
 			eskipVAL.routes = eskipDollar[1].routes
 		}
 	case 7:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:103
+//line parser.y:108
 		{
 			eskipVAL.routes = []*parsedRoute{eskipDollar[1].route}
+			eskiplex.(*eskipLex).syntaxRoute("", eskipDollar[1].pos, eskipDollar[1].pos, eskipDollar[1].end)
 		}
 	case 9:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:109
+//line parser.y:115
 		{
-			eskipVAL.routes = []*parsedRoute{eskipDollar[1].route}
+			eskipVAL.routes = eskipDollar[1].routes
 		}
 	case 10:
 		eskipDollar = eskipS[eskippt-3 : eskippt+1]
-//line parser.y:113
+//line parser.y:119
 		{
 			eskipVAL.routes = eskipDollar[1].routes
-			eskipVAL.routes = append(eskipVAL.routes, eskipDollar[3].route)
+			eskipVAL.routes = append(eskipVAL.routes, eskipDollar[3].routes...)
 		}
 	case 11:
 		eskipDollar = eskipS[eskippt-2 : eskippt+1]
-//line parser.y:118
+//line parser.y:124
 		{
 			eskipVAL.routes = eskipDollar[1].routes
 		}
 	case 12:
+		eskipDollar = eskipS[eskippt-1 : eskippt+1]
+//line parser.y:129
+		{
+			eskipVAL.routes = []*parsedRoute{eskipDollar[1].route}
+		}
+	case 13:
+		eskipDollar = eskipS[eskippt-1 : eskippt+1]
+//line parser.y:133
+		{
+			eskipVAL.routes = nil
+		}
+	case 14:
+		eskipDollar = eskipS[eskippt-1 : eskippt+1]
+//line parser.y:137
+		{
+			eskipVAL.routes = eskipDollar[1].routes
+		}
+	case 15:
+		eskipDollar = eskipS[eskippt-4 : eskippt+1]
+//line parser.y:142
+		{
+			eskiplex.(*eskipLex).define(eskipDollar[1].token, eskipDollar[2].token, eskipDollar[4].definition)
+			eskiplex.(*eskipLex).syntaxLet(eskipDollar[2].token, eskipDollar[1].pos, eskipDollar[3].end, eskipDollar[4].end)
+		}
+	case 16:
+		eskipDollar = eskipS[eskippt-2 : eskippt+1]
+//line parser.y:148
+		{
+			eskipVAL.routes = eskiplex.(*eskipLex).include(eskipDollar[1].token, eskipDollar[2].token)
+			eskiplex.(*eskipLex).syntaxInclude(eskipDollar[1].pos, eskipDollar[2].pos, eskipDollar[2].end)
+		}
+	case 17:
+		eskipDollar = eskipS[eskippt-1 : eskippt+1]
+//line parser.y:154
+		{
+			eskipVAL.definition = &definition{literal: eskipDollar[1].numval}
+			eskiplex.(*eskipLex).syntaxElement(valueSyntax, eskipDollar[1].pos, eskipDollar[1].end)
+		}
+	case 18:
+		eskipDollar = eskipS[eskippt-1 : eskippt+1]
+//line parser.y:159
+		{
+			eskipVAL.definition = &definition{literal: eskipDollar[1].token, backend: &parsedRoute{backend: eskipDollar[1].token}}
+			eskiplex.(*eskipLex).syntaxElement(valueSyntax, eskipDollar[1].pos, eskipDollar[1].end)
+		}
+	case 19:
+		eskipDollar = eskipS[eskippt-1 : eskippt+1]
+//line parser.y:164
+		{
+			eskipVAL.definition = &definition{literal: eskipDollar[1].token}
+			eskiplex.(*eskipLex).syntaxElement(valueSyntax, eskipDollar[1].pos, eskipDollar[1].end)
+		}
+	case 20:
+		eskipDollar = eskipS[eskippt-1 : eskippt+1]
+//line parser.y:169
+		{
+			eskipVAL.definition = &definition{backend: &parsedRoute{shunt: true}}
+			eskiplex.(*eskipLex).syntaxElement(valueSyntax, eskipDollar[1].pos, eskipDollar[1].end)
+		}
+	case 21:
+		eskipDollar = eskipS[eskippt-1 : eskippt+1]
+//line parser.y:174
+		{
+			eskipVAL.definition = &definition{backend: &parsedRoute{loopback: true}}
+			eskiplex.(*eskipLex).syntaxElement(valueSyntax, eskipDollar[1].pos, eskipDollar[1].end)
+		}
+	case 22:
+		eskipDollar = eskipS[eskippt-1 : eskippt+1]
+//line parser.y:179
+		{
+			eskipVAL.definition = &definition{backend: &parsedRoute{dynamic: true}}
+			eskiplex.(*eskipLex).syntaxElement(valueSyntax, eskipDollar[1].pos, eskipDollar[1].end)
+		}
+	case 23:
+		eskipDollar = eskipS[eskippt-1 : eskippt+1]
+//line parser.y:184
+		{
+			eskipVAL.definition = &definition{backend: &parsedRoute{forward: true}}
+			eskiplex.(*eskipLex).syntaxElement(valueSyntax, eskipDollar[1].pos, eskipDollar[1].end)
+		}
+	case 24:
+		eskipDollar = eskipS[eskippt-1 : eskippt+1]
+//line parser.y:189
+		{
+			eskipVAL.definition = &definition{backend: &parsedRoute{
+				lbBackend:   true,
+				lbAlgorithm: eskipDollar[1].lbAlgorithm,
+				lbDiscovery: eskipDollar[1].lbDiscovery,
+				lbEndpoints: eskipDollar[1].lbEndpoints,
+			}}
+			eskipDollar[1].lbEndpoints = nil
+			eskiplex.(*eskipLex).syntaxElement(valueSyntax, eskipDollar[1].pos, eskipDollar[1].end)
+		}
+	case 25:
+		eskipDollar = eskipS[eskippt-1 : eskippt+1]
+//line parser.y:200
+		{
+			eskipVAL.definition = eskiplex.(*eskipLex).reference(eskipDollar[1].token)
+			eskiplex.(*eskipLex).syntaxElement(valueSyntax, eskipDollar[1].pos, eskipDollar[1].end)
+		}
+	case 26:
+		eskipDollar = eskipS[eskippt-1 : eskippt+1]
+//line parser.y:205
+		{
+			eskipVAL.definition = &definition{
+				filters:    []*Filter{eskipDollar[1].filter},
+				predicates: []*Predicate{{Name: eskipDollar[1].filter.Name, Args: eskipDollar[1].filter.Args}},
+			}
+			eskiplex.(*eskipLex).syntaxCallElement(valueSyntax)
+		}
+	case 27:
+		eskipDollar = eskipS[eskippt-3 : eskippt+1]
+//line parser.y:213
+		{
+			eskipVAL.definition = &definition{filters: append(eskipDollar[1].filters, eskipDollar[3].filters...)}
+			eskipVAL.end = eskipDollar[3].end
+			eskipDollar[1].filters = nil
+			eskipDollar[3].filters = nil
+		}
+	case 28:
+		eskipDollar = eskipS[eskippt-3 : eskippt+1]
+//line parser.y:220
+		{
+			eskipVAL.definition = &definition{predicates: append(eskipDollar[1].predicates, eskipDollar[3].predicates...)}
+			eskipVAL.end = eskipDollar[3].end
+			eskipDollar[1].predicates = nil
+			eskipDollar[3].predicates = nil
+		}
+	case 29:
 		eskipDollar = eskipS[eskippt-2 : eskippt+1]
-//line parser.y:123
+//line parser.y:228
 		{
 			eskipVAL.route = eskipDollar[2].route
 			eskipVAL.route.id = eskipDollar[1].token
+			eskiplex.(*eskipLex).syntaxRoute(eskipDollar[1].token, eskipDollar[1].pos, eskipDollar[1].end, eskipDollar[2].end)
 		}
-	case 13:
+	case 30:
 		eskipDollar = eskipS[eskippt-2 : eskippt+1]
-//line parser.y:129
+//line parser.y:235
 		{
 			// match symbol and colon to get route id early even if route parsing fails later
 			eskipVAL.token = eskipDollar[1].token
+			eskipVAL.end = eskipDollar[2].end
 			eskiplex.(*eskipLex).lastRouteID = eskipDollar[1].token
 		}
-	case 14:
+	case 31:
 		eskipDollar = eskipS[eskippt-3 : eskippt+1]
-//line parser.y:136
+//line parser.y:243
 		{
 			eskipVAL.route = &parsedRoute{
 				predicates:  eskipDollar[1].predicates,
@@ -609,15 +773,18 @@ eskipdefault:
 				dynamic:     eskipDollar[3].dynamic,
 				lbBackend:   eskipDollar[3].lbBackend,
 				lbAlgorithm: eskipDollar[3].lbAlgorithm,
+				lbDiscovery: eskipDollar[3].lbDiscovery,
 				lbEndpoints: eskipDollar[3].lbEndpoints,
 				forward:     eskipDollar[3].forward,
 			}
+			eskipVAL.end = eskipDollar[3].end
 			eskipDollar[1].predicates = nil
 			eskipDollar[3].lbEndpoints = nil
+			eskiplex.(*eskipLex).syntaxElement(backendSyntax, eskipDollar[3].pos, eskipDollar[3].end)
 		}
-	case 15:
+	case 32:
 		eskipDollar = eskipS[eskippt-5 : eskippt+1]
-//line parser.y:152
+//line parser.y:262
 		{
 			eskipVAL.route = &parsedRoute{
 				predicates:  eskipDollar[1].predicates,
@@ -628,128 +795,177 @@ eskipdefault:
 				dynamic:     eskipDollar[5].dynamic,
 				lbBackend:   eskipDollar[5].lbBackend,
 				lbAlgorithm: eskipDollar[5].lbAlgorithm,
+				lbDiscovery: eskipDollar[5].lbDiscovery,
 				lbEndpoints: eskipDollar[5].lbEndpoints,
 				forward:     eskipDollar[5].forward,
 			}
+			eskipVAL.end = eskipDollar[5].end
 			eskipDollar[1].predicates = nil
 			eskipDollar[3].filters = nil
 			eskipDollar[5].lbEndpoints = nil
+			eskiplex.(*eskipLex).syntaxElement(backendSyntax, eskipDollar[5].pos, eskipDollar[5].end)
 		}
-	case 16:
+	case 33:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:171
+//line parser.y:284
 		{
-			eskipVAL.predicates = []*Predicate{eskipDollar[1].predicate}
+			eskipVAL.predicates = eskipDollar[1].predicates
 		}
-	case 17:
+	case 34:
 		eskipDollar = eskipS[eskippt-3 : eskippt+1]
-//line parser.y:175
+//line parser.y:288
 		{
 			eskipVAL.predicates = eskipDollar[1].predicates
-			eskipVAL.predicates = append(eskipVAL.predicates, eskipDollar[3].predicate)
+			eskipVAL.predicates = append(eskipVAL.predicates, eskipDollar[3].predicates...)
+			eskipVAL.end = eskipDollar[3].end
 		}
-	case 18:
+	case 35:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:181
+//line parser.y:295
 		{
-			eskipVAL.predicate = &Predicate{"*", nil}
+			eskipVAL.predicates = []*Predicate{{"*", nil}}
+			eskiplex.(*eskipLex).syntaxElement(predicateSyntax, eskipDollar[1].pos, eskipDollar[1].end)
 		}
-	case 19:
-		eskipDollar = eskipS[eskippt-4 : eskippt+1]
-//line parser.y:185
+	case 36:
+		eskipDollar = eskipS[eskippt-1 : eskippt+1]
+//line parser.y:300
 		{
-			eskipVAL.predicate = &Predicate{eskipDollar[1].token, eskipDollar[3].args}
-			eskipDollar[3].args = nil
+			eskipVAL.predicates = []*Predicate{{eskipDollar[1].filter.Name, eskipDollar[1].filter.Args}}
+			eskiplex.(*eskipLex).syntaxCallElement(predicateSyntax)
 		}
-	case 20:
+	case 37:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:191
+//line parser.y:305
 		{
-			eskipVAL.filters = []*Filter{eskipDollar[1].filter}
+			eskipVAL.predicates = eskiplex.(*eskipLex).predicatesReference(eskipDollar[1].token)
+			eskiplex.(*eskipLex).syntaxElement(predicateSyntax, eskipDollar[1].pos, eskipDollar[1].end)
 		}
-	case 21:
+	case 38:
+		eskipDollar = eskipS[eskippt-1 : eskippt+1]
+//line parser.y:311
+		{
+			eskipVAL.filters = eskipDollar[1].filters
+		}
+	case 39:
 		eskipDollar = eskipS[eskippt-3 : eskippt+1]
-//line parser.y:195
+//line parser.y:315
 		{
 			eskipVAL.filters = eskipDollar[1].filters
-			eskipVAL.filters = append(eskipVAL.filters, eskipDollar[3].filter)
+			eskipVAL.filters = append(eskipVAL.filters, eskipDollar[3].filters...)
+			eskipVAL.end = eskipDollar[3].end
 		}
-	case 22:
+	case 40:
+		eskipDollar = eskipS[eskippt-1 : eskippt+1]
+//line parser.y:322
+		{
+			eskipVAL.filters = []*Filter{eskipDollar[1].filter}
+			eskiplex.(*eskipLex).syntaxCallElement(filterSyntax)
+		}
+	case 41:
+		eskipDollar = eskipS[eskippt-1 : eskippt+1]
+//line parser.y:327
+		{
+			eskipVAL.filters = eskiplex.(*eskipLex).filtersReference(eskipDollar[1].token)
+			eskiplex.(*eskipLex).syntaxElement(filterSyntax, eskipDollar[1].pos, eskipDollar[1].end)
+		}
+	case 42:
 		eskipDollar = eskipS[eskippt-4 : eskippt+1]
-//line parser.y:201
+//line parser.y:333
 		{
 			eskipVAL.filter = &Filter{
 				Name: eskipDollar[1].token,
 				Args: eskipDollar[3].args}
+			eskipVAL.end = eskipDollar[4].end
 			eskipDollar[3].args = nil
+			eskiplex.(*eskipLex).syntaxCall(eskipDollar[1].token, eskipDollar[1].pos, eskipDollar[4].end)
 		}
-	case 24:
+	case 44:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:210
+//line parser.y:344
 		{
 			eskipVAL.args = []interface{}{eskipDollar[1].arg}
 		}
-	case 25:
+	case 45:
 		eskipDollar = eskipS[eskippt-3 : eskippt+1]
-//line parser.y:214
+//line parser.y:348
 		{
 			eskipVAL.args = eskipDollar[1].args
 			eskipVAL.args = append(eskipVAL.args, eskipDollar[3].arg)
 		}
-	case 26:
+	case 46:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:220
+//line parser.y:354
 		{
 			eskipVAL.arg = eskipDollar[1].numval
+			eskiplex.(*eskipLex).syntaxArg(eskipDollar[1].pos, eskipDollar[1].end)
 		}
-	case 27:
+	case 47:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:224
+//line parser.y:359
 		{
 			eskipVAL.arg = eskipDollar[1].token
+			eskiplex.(*eskipLex).syntaxArg(eskipDollar[1].pos, eskipDollar[1].end)
 		}
-	case 28:
+	case 48:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:228
+//line parser.y:364
 		{
 			eskipVAL.arg = eskipDollar[1].token
+			eskiplex.(*eskipLex).syntaxArg(eskipDollar[1].pos, eskipDollar[1].end)
 		}
-	case 29:
+	case 49:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:233
+//line parser.y:369
+		{
+			eskipVAL.arg = eskiplex.(*eskipLex).argReference(eskipDollar[1].token)
+			eskiplex.(*eskipLex).syntaxArg(eskipDollar[1].pos, eskipDollar[1].end)
+		}
+	case 50:
+		eskipDollar = eskipS[eskippt-1 : eskippt+1]
+//line parser.y:375
 		{
 			eskipVAL.stringvals = []string{eskipDollar[1].token}
 		}
-	case 30:
+	case 51:
 		eskipDollar = eskipS[eskippt-3 : eskippt+1]
-//line parser.y:237
+//line parser.y:379
 		{
 			eskipVAL.stringvals = eskipDollar[1].stringvals
 			eskipVAL.stringvals = append(eskipVAL.stringvals, eskipDollar[3].token)
 		}
-	case 31:
+	case 52:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:243
+//line parser.y:385
 		{
 			eskipVAL.lbEndpoints = eskipDollar[1].stringvals
 		}
-	case 32:
+	case 53:
 		eskipDollar = eskipS[eskippt-3 : eskippt+1]
-//line parser.y:247
+//line parser.y:389
 		{
 			eskipVAL.lbAlgorithm = eskipDollar[1].token
 			eskipVAL.lbEndpoints = eskipDollar[3].stringvals
 		}
-	case 33:
+	case 54:
+		eskipDollar = eskipS[eskippt-5 : eskippt+1]
+//line parser.y:394
+		{
+			eskipVAL.lbDiscovery = eskipDollar[1].token
+			eskipVAL.lbAlgorithm = eskipDollar[3].token
+			eskipVAL.lbEndpoints = eskipDollar[5].stringvals
+		}
+	case 55:
 		eskipDollar = eskipS[eskippt-3 : eskippt+1]
-//line parser.y:253
+//line parser.y:401
 		{
+			eskipVAL.end = eskipDollar[3].end
 			eskipVAL.lbAlgorithm = eskipDollar[2].lbAlgorithm
+			eskipVAL.lbDiscovery = eskipDollar[2].lbDiscovery
 			eskipVAL.lbEndpoints = eskipDollar[2].lbEndpoints
 		}
-	case 34:
+	case 56:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:259
+//line parser.y:409
 		{
 			eskipVAL.backend = eskipDollar[1].token
 			eskipVAL.shunt = false
@@ -758,9 +974,9 @@ eskipdefault:
 			eskipVAL.lbBackend = false
 			eskipVAL.forward = false
 		}
-	case 35:
+	case 57:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:268
+//line parser.y:418
 		{
 			eskipVAL.shunt = true
 			eskipVAL.loopback = false
@@ -768,9 +984,9 @@ eskipdefault:
 			eskipVAL.lbBackend = false
 			eskipVAL.forward = false
 		}
-	case 36:
+	case 58:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:276
+//line parser.y:426
 		{
 			eskipVAL.shunt = false
 			eskipVAL.loopback = true
@@ -778,9 +994,9 @@ eskipdefault:
 			eskipVAL.lbBackend = false
 			eskipVAL.forward = false
 		}
-	case 37:
+	case 59:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:284
+//line parser.y:434
 		{
 			eskipVAL.shunt = false
 			eskipVAL.loopback = false
@@ -788,21 +1004,22 @@ eskipdefault:
 			eskipVAL.lbBackend = false
 			eskipVAL.forward = false
 		}
-	case 38:
+	case 60:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:292
+//line parser.y:442
 		{
 			eskipVAL.shunt = false
 			eskipVAL.loopback = false
 			eskipVAL.dynamic = false
 			eskipVAL.lbBackend = true
 			eskipVAL.lbAlgorithm = eskipDollar[1].lbAlgorithm
+			eskipVAL.lbDiscovery = eskipDollar[1].lbDiscovery
 			eskipVAL.lbEndpoints = eskipDollar[1].lbEndpoints
 			eskipVAL.forward = false
 		}
-	case 39:
+	case 61:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:302
+//line parser.y:453
 		{
 			eskipVAL.shunt = false
 			eskipVAL.loopback = false
@@ -810,9 +1027,24 @@ eskipdefault:
 			eskipVAL.lbBackend = false
 			eskipVAL.forward = true
 		}
-	case 40:
+	case 62:
 		eskipDollar = eskipS[eskippt-1 : eskippt+1]
-//line parser.y:311
+//line parser.y:461
+		{
+			b := eskiplex.(*eskipLex).backendReference(eskipDollar[1].token)
+			eskipVAL.backend = b.backend
+			eskipVAL.shunt = b.shunt
+			eskipVAL.loopback = b.loopback
+			eskipVAL.dynamic = b.dynamic
+			eskipVAL.lbBackend = b.lbBackend
+			eskipVAL.lbAlgorithm = b.lbAlgorithm
+			eskipVAL.lbDiscovery = b.lbDiscovery
+			eskipVAL.lbEndpoints = b.lbEndpoints
+			eskipVAL.forward = b.forward
+		}
+	case 63:
+		eskipDollar = eskipS[eskippt-1 : eskippt+1]
+//line parser.y:475
 		{
 			eskipVAL.numval = convertNumber(eskipDollar[1].token)
 		}
@@ -27,6 +27,8 @@ func convertNumber(s string) float64 {
 
 %union {
 	token string
+	pos int
+	end int
 	route *parsedRoute
 	routes []*parsedRoute
 	predicates []*Predicate
@@ -44,7 +46,9 @@ func convertNumber(s string) float64 {
 	numval float64
 	stringvals []string
 	lbAlgorithm string
+	lbDiscovery string
 	lbEndpoints []string
+	definition *definition
 }
 
 %token and
@@ -65,6 +69,7 @@ func convertNumber(s string) float64 {
 %token symbol
 %token openarrow
 %token closearrow
+%token equals
 
 %token start_document;
 %token start_predicates;
@@ -102,33 +107,135 @@ document:
 	|
 	route {
 		$$.routes = []*parsedRoute{$1.route}
+		eskiplex.(*eskipLex).syntaxRoute("", $1.pos, $1.pos, $1.end)
 	}
 
 routes:
 	|
-	routedef {
-		$$.routes = []*parsedRoute{$1.route}
+	statement {
+		$$.routes = $1.routes
 	}
 	|
-	routes semicolon routedef {
+	routes semicolon statement {
 		$$.routes = $1.routes
-		$$.routes = append($$.routes, $3.route)
+		$$.routes = append($$.routes, $3.routes...)
 	}
 	|
 	routes semicolon {
 		$$.routes = $1.routes
 	}
 
+statement:
+	routedef {
+		$$.routes = []*parsedRoute{$1.route}
+	}
+	|
+	definition {
+		$$.routes = nil
+	}
+	|
+	include {
+		$$.routes = $1.routes
+	}
+
+definition:
+	symbol symbol equals value {
+		eskiplex.(*eskipLex).define($1.token, $2.token, $4.definition)
+		eskiplex.(*eskipLex).syntaxLet($2.token, $1.pos, $3.end, $4.end)
+	}
+
+include:
+	symbol stringliteral {
+		$$.routes = eskiplex.(*eskipLex).include($1.token, $2.token)
+		eskiplex.(*eskipLex).syntaxInclude($1.pos, $2.pos, $2.end)
+	}
+
+value:
+	numval {
+		$$.definition = &definition{literal: $1.numval}
+		eskiplex.(*eskipLex).syntaxElement(valueSyntax, $1.pos, $1.end)
+	}
+	|
+	stringliteral {
+		$$.definition = &definition{literal: $1.token, backend: &parsedRoute{backend: $1.token}}
+		eskiplex.(*eskipLex).syntaxElement(valueSyntax, $1.pos, $1.end)
+	}
+	|
+	regexpliteral {
+		$$.definition = &definition{literal: $1.token}
+		eskiplex.(*eskipLex).syntaxElement(valueSyntax, $1.pos, $1.end)
+	}
+	|
+	shunt {
+		$$.definition = &definition{backend: &parsedRoute{shunt: true}}
+		eskiplex.(*eskipLex).syntaxElement(valueSyntax, $1.pos, $1.end)
+	}
+	|
+	loopback {
+		$$.definition = &definition{backend: &parsedRoute{loopback: true}}
+		eskiplex.(*eskipLex).syntaxElement(valueSyntax, $1.pos, $1.end)
+	}
+	|
+	dynamic {
+		$$.definition = &definition{backend: &parsedRoute{dynamic: true}}
+		eskiplex.(*eskipLex).syntaxElement(valueSyntax, $1.pos, $1.end)
+	}
+	|
+	forward {
+		$$.definition = &definition{backend: &parsedRoute{forward: true}}
+		eskiplex.(*eskipLex).syntaxElement(valueSyntax, $1.pos, $1.end)
+	}
+	|
+	lbbackend {
+		$$.definition = &definition{backend: &parsedRoute{
+			lbBackend: true,
+			lbAlgorithm: $1.lbAlgorithm,
+			lbDiscovery: $1.lbDiscovery,
+			lbEndpoints: $1.lbEndpoints,
+		}}
+		$1.lbEndpoints = nil
+		eskiplex.(*eskipLex).syntaxElement(valueSyntax, $1.pos, $1.end)
+	}
+	|
+	symbol {
+		$$.definition = eskiplex.(*eskipLex).reference($1.token)
+		eskiplex.(*eskipLex).syntaxElement(valueSyntax, $1.pos, $1.end)
+	}
+	|
+	call {
+		$$.definition = &definition{
+			filters: []*Filter{$1.filter},
+			predicates: []*Predicate{{Name: $1.filter.Name, Args: $1.filter.Args}},
+		}
+		eskiplex.(*eskipLex).syntaxCallElement(valueSyntax)
+	}
+	|
+	filter arrow filters {
+		$$.definition = &definition{filters: append($1.filters, $3.filters...)}
+		$$.end = $3.end
+		$1.filters = nil
+		$3.filters = nil
+	}
+	|
+	predicate and predicates {
+		$$.definition = &definition{predicates: append($1.predicates, $3.predicates...)}
+		$$.end = $3.end
+		$1.predicates = nil
+		$3.predicates = nil
+	}
+
 routedef:
 	routeid route {
 		$$.route = $2.route
 		$$.route.id = $1.token
+		eskiplex.(*eskipLex).syntaxRoute($1.token, $1.pos, $1.end, $2.end)
 	}
 
 routeid:
 	symbol colon {
 		// match symbol and colon to get route id early even if route parsing fails later
 		$$.token = $1.token
+		$$.end = $2.end
 		eskiplex.(*eskipLex).lastRouteID = $1.token
 	}
 
@@ -142,11 +249,14 @@ route:
 			dynamic: $3.dynamic,
 			lbBackend: $3.lbBackend,
 			lbAlgorithm: $3.lbAlgorithm,
+			lbDiscovery: $3.lbDiscovery,
 			lbEndpoints: $3.lbEndpoints,
 			forward: $3.forward,
 		}
+		$$.end = $3.end
 		$1.predicates = nil
 		$3.lbEndpoints = nil
+		eskiplex.(*eskipLex).syntaxElement(backendSyntax, $3.pos, $3.end)
 	}
 	|
 	predicates arrow filters arrow backend {
@@ -159,50 +269,74 @@ route:
 			dynamic: $5.dynamic,
 			lbBackend: $5.lbBackend,
 			lbAlgorithm: $5.lbAlgorithm,
+			lbDiscovery: $5.lbDiscovery,
 			lbEndpoints: $5.lbEndpoints,
 			forward: $5.forward,
 		}
+		$$.end = $5.end
 		$1.predicates = nil
 		$3.filters = nil
 		$5.lbEndpoints = nil
+		eskiplex.(*eskipLex).syntaxElement(backendSyntax, $5.pos, $5.end)
 	}
 
 predicates:
 	predicate {
-		$$.predicates = []*Predicate{$1.predicate}
+		$$.predicates = $1.predicates
 	}
 	|
 	predicates and predicate {
 		$$.predicates = $1.predicates
-		$$.predicates = append($$.predicates, $3.predicate)
+		$$.predicates = append($$.predicates, $3.predicates...)
+		$$.end = $3.end
 	}
 
 predicate:
 	any {
-		$$.predicate = &Predicate{"*", nil}
+		$$.predicates = []*Predicate{{"*", nil}}
+		eskiplex.(*eskipLex).syntaxElement(predicateSyntax, $1.pos, $1.end)
 	}
 	|
-	symbol openparen args closeparen {
-		$$.predicate = &Predicate{$1.token, $3.args}
-		$3.args = nil
+	call {
+		$$.predicates = []*Predicate{{$1.filter.Name, $1.filter.Args}}
+		eskiplex.(*eskipLex).syntaxCallElement(predicateSyntax)
+	}
+	|
+	symbol {
+		$$.predicates = eskiplex.(*eskipLex).predicatesReference($1.token)
+		eskiplex.(*eskipLex).syntaxElement(predicateSyntax, $1.pos, $1.end)
 	}
 
 filters:
 	filter {
-		$$.filters = []*Filter{$1.filter}
+		$$.filters = $1.filters
 	}
 	|
 	filters arrow filter {
 		$$.filters = $1.filters
-		$$.filters = append($$.filters, $3.filter)
+		$$.filters = append($$.filters, $3.filters...)
+		$$.end = $3.end
 	}
 
 filter:
+	call {
+		$$.filters = []*Filter{$1.filter}
+		eskiplex.(*eskipLex).syntaxCallElement(filterSyntax)
+	}
+	|
+	symbol {
+		$$.filters = eskiplex.(*eskipLex).filtersReference($1.token)
+		eskiplex.(*eskipLex).syntaxElement(filterSyntax, $1.pos, $1.end)
+	}
+
+call:
 	symbol openparen args closeparen {
 		$$.filter = &Filter{
 			Name: $1.token,
 			Args: $3.args}
+		$$.end = $4.end
 		$3.args = nil
+		eskiplex.(*eskipLex).syntaxCall($1.token, $1.pos, $4.end)
 	}
 
 args:
@@ -219,14 +353,22 @@ args:
 arg:
 	numval {
 		$$.arg = $1.numval
+		eskiplex.(*eskipLex).syntaxArg($1.pos, $1.end)
 	}
 	|
 	stringliteral {
 		$$.arg = $1.token
+		eskiplex.(*eskipLex).syntaxArg($1.pos, $1.end)
 	}
 	|
 	regexpliteral {
 		$$.arg = $1.token
+		eskiplex.(*eskipLex).syntaxArg($1.pos, $1.end)
+	}
+	|
+	symbol {
+		$$.arg = eskiplex.(*eskipLex).argReference($1.token)
+		eskiplex.(*eskipLex).syntaxArg($1.pos, $1.end)
 	}
 
 stringvals:
@@ -248,10 +390,18 @@ lbbackendbody:
 		$$.lbAlgorithm = $1.token
 		$$.lbEndpoints = $3.stringvals
 	}
+	|
+	symbol comma symbol comma stringvals {
+		$$.lbDiscovery = $1.token
+		$$.lbAlgorithm = $3.token
+		$$.lbEndpoints = $5.stringvals
+	}
 
 lbbackend:
 	openarrow lbbackendbody closearrow {
+		$$.end = $3.end
 		$$.lbAlgorithm = $2.lbAlgorithm
+		$$.lbDiscovery = $2.lbDiscovery
 		$$.lbEndpoints = $2.lbEndpoints
 	}
 
@@ -295,6 +445,7 @@ backend:
 		$$.dynamic = false
 		$$.lbBackend = true
 		$$.lbAlgorithm = $1.lbAlgorithm
+		$$.lbDiscovery = $1.lbDiscovery
 		$$.lbEndpoints = $1.lbEndpoints
 		$$.forward = false
 	}
@@ -306,6 +457,19 @@ backend:
 		$$.lbBackend = false
 		$$.forward = true
 	}
+	|
+	symbol {
+		b := eskiplex.(*eskipLex).backendReference($1.token)
+		$$.backend = b.backend
+		$$.shunt = b.shunt
+		$$.loopback = b.loopback
+		$$.dynamic = b.dynamic
+		$$.lbBackend = b.lbBackend
+		$$.lbAlgorithm = b.lbAlgorithm
+		$$.lbDiscovery = b.lbDiscovery
+		$$.lbEndpoints = b.lbEndpoints
+		$$.forward = b.forward
+	}
 
 numval:
 	number {
@@ -309,6 +309,31 @@ func TestLBBackend(t *testing.T) {
 				{Address: "https://example3.org"},
 			},
 		}},
+	}, {
+		title: "dns discovery, default algorithm",
+		code:  `* -> <dns, "http://service.internal:8080">`,
+		expectedResult: []*Route{{
+			BackendType: LBBackend,
+			LBDiscovery: DNSDiscovery,
+			LBEndpoints: []*LBEndpoint{{Address: "http://service.internal:8080"}},
+		}},
+	}, {
+		title: "srv discovery, with algorithm",
+		code:  `* -> <srv, algFoo, "_http._tcp.service.internal">`,
+		expectedResult: []*Route{{
+			BackendType: LBBackend,
+			LBDiscovery: SRVDiscovery,
+			LBAlgorithm: "algFoo",
+			LBEndpoints: []*LBEndpoint{{Address: "_http._tcp.service.internal"}},
+		}},
+	}, {
+		title: "dns discovery, invalid endpoint",
+		code:  `* -> <dns, "service.internal">`,
+		fail:  true,
+	}, {
+		title: "unsupported discovery",
+		code:  `* -> <foo, algFoo, "https://example.org">`,
+		fail:  true,
 	}} {
 		t.Run(test.title, func(t *testing.T) {
 			r, err := Parse(test.code)
@@ -158,6 +158,10 @@ func (r *Route) backendString() string {
 func lbBackendString(r *Route) string {
 	var b strings.Builder
 	b.WriteByte('<')
+	if r.LBDiscovery != "" {
+		b.WriteString(r.LBDiscovery)
+		b.WriteString(", ")
+	}
 	if r.LBAlgorithm != "" {
 		b.WriteString(r.LBAlgorithm)
 		b.WriteString(", ")
@@ -123,6 +123,9 @@ func TestRouteString(t *testing.T) {
 			{Address: "http://127.0.0.1:9998"},
 		}},
 		`Method("GET") -> <random, "http://127.0.0.1:9997", "http://127.0.0.1:9998">`,
+	}, {
+		&Route{Method: "GET", LBDiscovery: "dns", LBAlgorithm: "random", BackendType: LBBackend, LBEndpoints: []*LBEndpoint{{Address: "http://service.internal:9997"}}},
+		`Method("GET") -> <dns, random, "http://service.internal:9997">`,
 	}, {
 		// test slash escaping
 		&Route{Path: `/`, PathRegexps: []string{`/`}, Filters: []*Filter{{"afilter", []interface{}{`/`}}}, BackendType: ShuntBackend},
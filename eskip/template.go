@@ -56,7 +56,14 @@ func (t *Template) Apply(get TemplateGetter) string {
 // ApplyContext evaluates the template using template context to resolve the
 // placeholders. Returns true if all placeholders resolved to non-empty values.
 func (t *Template) ApplyContext(ctx TemplateContext) (string, bool) {
-	return t.apply(func(key string) string {
+	return t.apply(ContextGetter(ctx))
+}
+
+// ContextGetter returns the TemplateGetter resolving the placeholders from
+// the template context, as used by ApplyContext. Unknown placeholders are
+// resolved as path parameters.
+func ContextGetter(ctx TemplateContext) TemplateGetter {
+	return func(key string) string {
 		if h := strings.TrimPrefix(key, "request.header."); h != key {
 			return ctx.Request().Header.Get(h)
 		}
@@ -93,7 +100,7 @@ func (t *Template) ApplyContext(ctx TemplateContext) (string, bool) {
 			}
 		}
 		return ctx.PathParam(key)
-	})
+	}
 }
 
 // apply evaluates the template using a TemplateGetter function to resolve the
@@ -2,6 +2,7 @@ package eskipfile
 
 import (
 	"os"
+	"path/filepath"
 
 	"github.com/zalando/skipper/eskip"
 )
@@ -20,7 +21,7 @@ func Open(path string) (*Client, error) {
 		return nil, err
 	}
 
-	routes, err := eskip.Parse(string(content))
+	routes, _, err := parseFile(path, content, true)
 	if err != nil {
 		return nil, err
 	}
@@ -28,6 +29,34 @@ func Open(path string) (*Client, error) {
 	return &Client{routes}, nil
 }
 
+// parseFile parses the content of an eskip file, and reads the files of its include directives, when enabled.
+// The relative paths of the included files are resolved from the directory of the including file. It returns the
+// content of the included files by their path.
+func parseFile(path string, content []byte, enableInclude bool) ([]*eskip.Route, map[string][]byte, error) {
+	included := make(map[string][]byte)
+	o := eskip.ParseOptions{Name: path}
+	if enableInclude {
+		o.Include = func(from, p string) (string, string, error) {
+			if filepath.IsAbs(p) {
+				p = filepath.Clean(p)
+			} else {
+				p = filepath.Join(filepath.Dir(from), p)
+			}
+
+			b, err := os.ReadFile(p)
+			if err != nil {
+				return "", "", err
+			}
+
+			included[p] = b
+			return p, string(b), nil
+		}
+	}
+
+	routes, err := eskip.ParseWithOptions(string(content), o)
+	return routes, included, err
+}
+
 func (Client) Name() string {
 	return "eskipfile"
 }
@@ -3,9 +3,15 @@ package eskipfile
 import (
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando/skipper/eskip"
 	"github.com/zalando/skipper/filters/builtin"
 	"github.com/zalando/skipper/logging/loggingtest"
 	"github.com/zalando/skipper/routing"
@@ -53,3 +59,39 @@ func TestOpenSucceeds(t *testing.T) {
 	check("foo", "/foo")
 	check("bar", "/bar")
 }
+
+func TestOpenInclude(t *testing.T) {
+	f, err := Open("fixtures/include.eskip")
+	require.NoError(t, err)
+
+	routes, err := f.LoadAll()
+	require.NoError(t, err)
+	require.Len(t, routes, 2)
+
+	assert.Equal(t, "foo", routes[0].Id)
+	assert.Equal(t, "https://foo.example.org", routes[0].Backend)
+	assert.Equal(t, []string{"flowId", "preserveHost", "setPath"}, filterNames(routes[0]))
+	assert.Equal(t, "bar", routes[1].Id)
+	assert.Equal(t, "https://bar.example.org", routes[1].Backend)
+}
+
+func TestOpenIncludeFails(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "routes.eskip")
+	require.NoError(t, os.WriteFile(path, []byte(`
+		include "missing.eskip";
+	`), 0o644))
+
+	_, err := Open(path)
+	assert.ErrorContains(t, err, path+":2:26: ")
+	assert.ErrorContains(t, err, "include failed: ")
+}
+
+func filterNames(r *eskip.Route) []string {
+	var names []string
+	for _, f := range r.Filters {
+		names = append(names, f.Name)
+	}
+
+	return names
+}
@@ -1,6 +1,7 @@
 package eskipfile
 
 import (
+	"crypto"
 	"errors"
 	"fmt"
 	"io"
@@ -11,12 +12,20 @@ import (
 	"time"
 
 	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/metrics"
 	"github.com/zalando/skipper/net"
 	"github.com/zalando/skipper/routing"
 
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	remoteUpdatesMetric           = "eskipfile.remote.updates"
+	remoteNotModifiedMetric       = "eskipfile.remote.not_modified"
+	remoteDownloadFailuresMetric  = "eskipfile.remote.download_failures"
+	remoteInvalidSignaturesMetric = "eskipfile.remote.invalid_signatures"
+)
+
 var errContentNotChanged = errors.New("content in cache did not change, 304 response status code")
 
 type remoteEskipFile struct {
@@ -29,6 +38,10 @@ type remoteEskipFile struct {
 	verbose         bool
 	http            *net.Client
 	etag            string
+	signatureKeys   []crypto.PublicKey
+	signatureURL    string
+	version         uint64
+	metrics         metrics.Metrics
 }
 
 type RemoteWatchOptions struct {
@@ -46,6 +59,26 @@ type RemoteWatchOptions struct {
 
 	// HTTPTimeout is the generic timeout for any phase of a single HTTP request to RemoteFile.
 	HTTPTimeout time.Duration
+
+	// SignatureKeys enables the verification of the detached signature
+	// of the remote file, downloaded from the URL of the file with the
+	// .sig suffix. The routes are applied only when the signature is
+	// valid with one of the keys, otherwise the last valid routes are
+	// kept. See ParsePublicKeys.
+	//
+	// The signed file needs to start with its version, e.g.
+	// // version: 42, and a version older than the last applied one is
+	// rejected.
+	SignatureKeys []crypto.PublicKey
+
+	// SignatureURL overrides the URL of the detached signature, e.g.
+	// when the route file is downloaded with a presigned URL.
+	SignatureURL string
+
+	// Metrics receives the number of the updates, the unmodified
+	// responses, the failed downloads and the invalid signatures.
+	// Defaults to metrics.Default.
+	Metrics metrics.Metrics
 }
 
 // RemoteWatch creates a route configuration client with (remote) file watching. Watch doesn't follow file system nodes,
@@ -62,13 +95,26 @@ func RemoteWatch(o *RemoteWatchOptions) (routing.DataClient, error) {
 		return nil, err
 	}
 
+	mtr := o.Metrics
+	if mtr == nil {
+		mtr = metrics.Default
+	}
+
+	sigURL := o.SignatureURL
+	if sigURL == "" {
+		sigURL = signatureURL(o.RemoteFile)
+	}
+
 	dataClient := &remoteEskipFile{
-		once:       sync.Once{},
-		remotePath: o.RemoteFile,
-		localPath:  tempFilename.Name(),
-		threshold:  o.Threshold,
-		verbose:    o.Verbose,
-		http:       net.NewClient(net.Options{Timeout: o.HTTPTimeout}),
+		once:          sync.Once{},
+		remotePath:    o.RemoteFile,
+		localPath:     tempFilename.Name(),
+		threshold:     o.Threshold,
+		verbose:       o.Verbose,
+		http:          net.NewClient(net.Options{Timeout: o.HTTPTimeout}),
+		signatureKeys: o.SignatureKeys,
+		signatureURL:  sigURL,
+		metrics:       mtr,
 	}
 
 	if o.FailOnStartup {
@@ -91,7 +137,8 @@ func RemoteWatch(o *RemoteWatchOptions) (routing.DataClient, error) {
 		dataClient.preloaded = true
 	}
 
-	dataClient.eskipFileClient = Watch(tempFilename.Name())
+	// the downloaded file is not allowed to include local files
+	dataClient.eskipFileClient = watch(tempFilename.Name(), false)
 
 	return dataClient, nil
 }
@@ -163,57 +210,90 @@ func isFileRemote(remotePath string) bool {
 	return strings.HasPrefix(remotePath, "http://") || strings.HasPrefix(remotePath, "https://")
 }
 
+// DownloadRemoteFile downloads the remote file, and when the signature
+// verification is enabled, its signature. The local copy of the file is
+// updated only when the signature is valid. The ETag of the file is
+// stored only after a successful update, so that a rejected version is
+// downloaded and verified again on the next poll.
 func (client *remoteEskipFile) DownloadRemoteFile() error {
-	resBody, err := client.getRemoteData()
+	content, etag, err := client.getRemoteData(client.remotePath, client.etag)
+	if errors.Is(err, errContentNotChanged) {
+		client.metrics.IncCounter(remoteNotModifiedMetric)
+		return nil
+	}
+
 	if err != nil {
-		if errors.Is(err, errContentNotChanged) {
-			return nil
+		client.metrics.IncCounter(remoteDownloadFailuresMetric)
+		return err
+	}
+
+	var version uint64
+	if len(client.signatureKeys) > 0 {
+		if version, err = client.verifySignature(content); err != nil {
+			return err
 		}
+	}
+
+	if err := os.WriteFile(client.localPath, content, 0600); err != nil {
 		return err
 	}
-	defer resBody.Close()
 
-	outFile, err := os.OpenFile(client.localPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	client.etag = etag
+	client.version = version
+	client.metrics.IncCounter(remoteUpdatesMetric)
+	return nil
+}
+
+// verifySignature verifies the signature of the content, and returns
+// its version. Versions older than the applied one are rejected.
+func (client *remoteEskipFile) verifySignature(content []byte) (uint64, error) {
+	signature, _, err := client.getRemoteData(client.signatureURL, "")
 	if err != nil {
-		return err
+		client.metrics.IncCounter(remoteDownloadFailuresMetric)
+		return 0, err
 	}
-	defer outFile.Close()
 
-	if _, err = io.Copy(outFile, resBody); err != nil {
-		_ = outFile.Close()
-		return err
+	version, err := verifyVersion(client.signatureKeys, content, signature, client.version)
+	if err != nil {
+		client.metrics.IncCounter(remoteInvalidSignaturesMetric)
+		log.Errorf("Rejected remote routes file %s: %v", client.remotePath, err)
+		return 0, fmt.Errorf("failed to verify remote file %s: %w", client.remotePath, err)
 	}
 
-	return outFile.Close()
+	return version, nil
 }
 
-func (client *remoteEskipFile) getRemoteData() (io.ReadCloser, error) {
-	req, err := http.NewRequest("GET", client.remotePath, nil)
+// getRemoteData downloads a remote file, and returns its content and
+// ETag.
+func (client *remoteEskipFile) getRemoteData(remotePath, etag string) ([]byte, string, error) {
+	req, err := http.NewRequest("GET", remotePath, nil)
 
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	if client.etag != "" {
-		req.Header.Set("If-None-Match", client.etag)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
 	}
 
 	resp, err := client.http.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
+	defer resp.Body.Close()
 
-	if client.etag != "" && resp.StatusCode == 304 {
-		resp.Body.Close()
-		return nil, errContentNotChanged
+	if etag != "" && resp.StatusCode == 304 {
+		return nil, "", errContentNotChanged
 	}
 
 	if resp.StatusCode != 200 {
-		resp.Body.Close()
-		return nil, fmt.Errorf("failed to download remote file %s, status code: %d", client.remotePath, resp.StatusCode)
+		return nil, "", fmt.Errorf("failed to download remote file %s, status code: %d", remotePath, resp.StatusCode)
 	}
 
-	client.etag = resp.Header.Get("ETag")
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
 
-	return resp.Body, err
+	return content, resp.Header.Get("ETag"), nil
 }
@@ -0,0 +1,147 @@
+package eskipfile
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	signatureSuffix = ".sig"
+	versionPrefix   = "// version:"
+)
+
+var (
+	errNoPublicKeys       = errors.New("no public keys found")
+	errInvalidSignature   = errors.New("invalid signature")
+	errUnsupportedKeyType = errors.New("unsupported public key type")
+	errMissingVersion     = errors.New("missing or invalid version")
+	errOutdatedVersion    = errors.New("outdated version")
+)
+
+// ParsePublicKeys parses the PEM encoded public keys, that verify the
+// signatures of the remote route files. Ed25519 and ECDSA keys are
+// supported, e.g. the keys generated by cosign.
+func ParsePublicKeys(data []byte) ([]crypto.PublicKey, error) {
+	var keys []crypto.PublicKey
+	for {
+		var b *pem.Block
+		b, data = pem.Decode(data)
+		if b == nil {
+			break
+		}
+
+		if b.Type != "PUBLIC KEY" {
+			continue
+		}
+
+		k, err := x509.ParsePKIXPublicKey(b.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		switch k.(type) {
+		case ed25519.PublicKey, *ecdsa.PublicKey:
+		default:
+			return nil, fmt.Errorf("%w: %T", errUnsupportedKeyType, k)
+		}
+
+		keys = append(keys, k)
+	}
+
+	if len(keys) == 0 {
+		return nil, errNoPublicKeys
+	}
+
+	return keys, nil
+}
+
+// signatureURL returns the URL of the detached signature of a remote
+// file, inserting the suffix after the path. The rest of the URL is
+// kept as it is, without changing its escaping.
+func signatureURL(remotePath string) string {
+	if i := strings.IndexAny(remotePath, "?#"); i >= 0 {
+		return remotePath[:i] + signatureSuffix + remotePath[i:]
+	}
+
+	return remotePath + signatureSuffix
+}
+
+// parseVersion returns the version of a signed route file, from its first
+// line, e.g. // version: 42. The version is covered by the signature, and
+// it prevents applying an older, validly signed route file again.
+func parseVersion(content []byte) (uint64, error) {
+	line, _, _ := bytes.Cut(content, []byte("\n"))
+	v, ok := strings.CutPrefix(strings.TrimSpace(string(line)), versionPrefix)
+	if !ok {
+		return 0, errMissingVersion
+	}
+
+	version, err := strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", errMissingVersion, err)
+	}
+
+	return version, nil
+}
+
+// decodeSignature accepts the base64 encoded signatures, like the ones
+// created by cosign, and the raw signatures.
+func decodeSignature(signature []byte) []byte {
+	if decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(signature))); err == nil {
+		return decoded
+	}
+
+	return signature
+}
+
+// verifySignature checks if the signature of the content is valid with
+// any of the keys. The ECDSA signatures are expected in ASN.1 format,
+// over the SHA-256 digest of the content.
+func verifySignature(keys []crypto.PublicKey, content, signature []byte) error {
+	signature = decodeSignature(signature)
+	digest := sha256.Sum256(content)
+	for _, k := range keys {
+		switch k := k.(type) {
+		case ed25519.PublicKey:
+			if ed25519.Verify(k, content, signature) {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			if ecdsa.VerifyASN1(k, digest[:], signature) {
+				return nil
+			}
+		}
+	}
+
+	return errInvalidSignature
+}
+
+// verifyVersion verifies the signature of the content, and returns the
+// signed version of the content. It rejects the versions older than the
+// applied one.
+func verifyVersion(keys []crypto.PublicKey, content, signature []byte, applied uint64) (uint64, error) {
+	if err := verifySignature(keys, content, signature); err != nil {
+		return 0, err
+	}
+
+	version, err := parseVersion(content)
+	if err != nil {
+		return 0, err
+	}
+
+	if version < applied {
+		return 0, fmt.Errorf("%w: %d, the applied version is %d", errOutdatedVersion, version, applied)
+	}
+
+	return version, nil
+}
@@ -0,0 +1,308 @@
+package eskipfile
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/metrics/metricstest"
+)
+
+func encodePublicKey(t *testing.T, k crypto.PublicKey) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(k)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestParsePublicKeys(t *testing.T) {
+	edPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	data := append(encodePublicKey(t, edPublic), encodePublicKey(t, &ecKey.PublicKey)...)
+	keys, err := ParsePublicKeys(data)
+	require.NoError(t, err)
+	assert.Equal(t, []crypto.PublicKey{edPublic, &ecKey.PublicKey}, keys)
+
+	_, err = ParsePublicKeys([]byte("foo"))
+	assert.ErrorIs(t, err, errNoPublicKeys)
+
+	_, err = ParsePublicKeys(encodePublicKey(t, &rsaKey.PublicKey))
+	assert.ErrorIs(t, err, errUnsupportedKeyType)
+}
+
+func TestVerifySignature(t *testing.T) {
+	content := []byte(`r: * -> <shunt>;`)
+
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	otherPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	edSignature := ed25519.Sign(edPrivate, content)
+	digest := sha256.Sum256(content)
+	ecSignature, err := ecdsa.SignASN1(rand.Reader, ecKey, digest[:])
+	require.NoError(t, err)
+
+	keys := []crypto.PublicKey{otherPublic, edPublic, &ecKey.PublicKey}
+	for _, tt := range []struct {
+		title     string
+		keys      []crypto.PublicKey
+		content   []byte
+		signature []byte
+		valid     bool
+	}{{
+		title:     "raw ed25519",
+		keys:      keys,
+		content:   content,
+		signature: edSignature,
+		valid:     true,
+	}, {
+		title:     "base64 ed25519",
+		keys:      keys,
+		content:   content,
+		signature: []byte(base64.StdEncoding.EncodeToString(edSignature) + "\n"),
+		valid:     true,
+	}, {
+		title:     "base64 ecdsa, cosign style",
+		keys:      keys,
+		content:   content,
+		signature: []byte(base64.StdEncoding.EncodeToString(ecSignature)),
+		valid:     true,
+	}, {
+		title:     "modified content",
+		keys:      keys,
+		content:   []byte(`r: * -> "https://www.example.org";`),
+		signature: edSignature,
+	}, {
+		title:     "unknown key",
+		keys:      []crypto.PublicKey{otherPublic},
+		content:   content,
+		signature: edSignature,
+	}, {
+		title:   "empty signature",
+		keys:    keys,
+		content: content,
+	}} {
+		t.Run(tt.title, func(t *testing.T) {
+			err := verifySignature(tt.keys, tt.content, tt.signature)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, errInvalidSignature)
+			}
+		})
+	}
+}
+
+func TestRemoteSignature(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	valid := fmt.Sprintf("// version: 1\nvalid: %v;", routeBody)
+	forged := fmt.Sprintf("// version: 2\nforged: %v;", routeBody)
+
+	var (
+		content     atomic.Value
+		signature   atomic.Value
+		count304s   atomic.Int32
+		sigRequests atomic.Int32
+	)
+
+	content.Store(valid)
+	signature.Store(ed25519.Sign(private, []byte(valid)))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/routes.eskip.sig" {
+			sigRequests.Add(1)
+			w.Write(signature.Load().([]byte))
+			return
+		}
+
+		c := content.Load().(string)
+		etag := fmt.Sprintf("%x", sha256.Sum256([]byte(c)))
+		if r.Header.Get("If-None-Match") == etag {
+			count304s.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("ETag", etag)
+		io.WriteString(w, c)
+	}))
+	defer server.Close()
+
+	m := &metricstest.MockMetrics{}
+	client, err := RemoteWatch(&RemoteWatchOptions{
+		RemoteFile:    server.URL + "/routes.eskip",
+		FailOnStartup: true,
+		SignatureKeys: []crypto.PublicKey{public},
+		Metrics:       m,
+	})
+	require.NoError(t, err)
+	defer client.(*remoteEskipFile).Close()
+
+	routes, err := client.LoadAll()
+	require.NoError(t, err)
+	assert.Equal(t, eskip.MustParse(valid), routes)
+
+	// not modified, the signature is not downloaded again
+	_, _, err = client.LoadUpdate()
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), count304s.Load())
+	assert.Equal(t, int32(1), sigRequests.Load())
+
+	// the forged routes are rejected
+	content.Store(forged)
+	_, _, err = client.LoadUpdate()
+	assert.ErrorIs(t, err, errInvalidSignature)
+
+	_, err = client.LoadAll()
+	assert.ErrorIs(t, err, errInvalidSignature)
+	assert.Equal(t, int32(2), count304s.Load(), "the etag of the rejected version stored")
+
+	// the valid routes are kept
+	routes, err = client.(*remoteEskipFile).eskipFileClient.LoadAll()
+	require.NoError(t, err)
+	assert.Equal(t, eskip.MustParse(valid), routes)
+
+	// the signed update is applied
+	signature.Store([]byte(base64.StdEncoding.EncodeToString(ed25519.Sign(private, []byte(forged)))))
+	routes, err = client.LoadAll()
+	require.NoError(t, err)
+	assert.Equal(t, eskip.MustParse(forged), routes)
+
+	// the older, validly signed version is rejected
+	content.Store(valid)
+	signature.Store(ed25519.Sign(private, []byte(valid)))
+	_, err = client.LoadAll()
+	assert.ErrorIs(t, err, errOutdatedVersion)
+
+	routes, err = client.(*remoteEskipFile).eskipFileClient.LoadAll()
+	require.NoError(t, err)
+	assert.Equal(t, eskip.MustParse(forged), routes)
+
+	m.WithCounters(func(counters map[string]int64) {
+		assert.Equal(t, int64(2), counters[remoteUpdatesMetric])
+		assert.Equal(t, int64(2), counters[remoteNotModifiedMetric])
+		assert.Equal(t, int64(3), counters[remoteInvalidSignaturesMetric])
+	})
+}
+
+func TestRemoteSignatureURL(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	content := fmt.Sprintf("// version: 1\n%v", routeBody)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.RequestURI() {
+		case "/routes.eskip?X-Amz-Signature=a%2Fb":
+			io.WriteString(w, content)
+		case "/signatures/routes.eskip?X-Amz-Signature=c%2Fd":
+			w.Write(ed25519.Sign(private, []byte(content)))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	client, err := RemoteWatch(&RemoteWatchOptions{
+		RemoteFile:    server.URL + "/routes.eskip?X-Amz-Signature=a%2Fb",
+		FailOnStartup: true,
+		SignatureKeys: []crypto.PublicKey{public},
+		SignatureURL:  server.URL + "/signatures/routes.eskip?X-Amz-Signature=c%2Fd",
+		Metrics:       &metricstest.MockMetrics{},
+	})
+	require.NoError(t, err)
+	defer client.(*remoteEskipFile).Close()
+
+	routes, err := client.LoadAll()
+	require.NoError(t, err)
+	assert.Equal(t, eskip.MustParse(routeBody), routes)
+}
+
+func TestSignatureURL(t *testing.T) {
+	for _, tt := range []struct {
+		remote, signature string
+	}{
+		{"https://example.org/routes.eskip", "https://example.org/routes.eskip.sig"},
+		{"https://example.org/a%2Fb/routes.eskip", "https://example.org/a%2Fb/routes.eskip.sig"},
+		{"https://example.org/routes.eskip?v=a%2Fb", "https://example.org/routes.eskip.sig?v=a%2Fb"},
+		{"https://example.org/routes.eskip#foo", "https://example.org/routes.eskip.sig#foo"},
+	} {
+		assert.Equal(t, tt.signature, signatureURL(tt.remote))
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	v, err := parseVersion([]byte("// version: 42\nr: * -> <shunt>;"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(42), v)
+
+	v, err = parseVersion([]byte("// version:7 \r\n"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(7), v)
+
+	for _, content := range []string{
+		"",
+		"r: * -> <shunt>;",
+		"r: * -> <shunt>;\n// version: 42",
+		"// version: -1",
+		"// version: latest",
+	} {
+		_, err := parseVersion([]byte(content))
+		assert.ErrorIs(t, err, errMissingVersion, content)
+	}
+}
+
+func TestRemoteSignatureMissing(t *testing.T) {
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/routes.eskip.sig" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		io.WriteString(w, routeBody)
+	}))
+	defer server.Close()
+
+	_, err = RemoteWatch(&RemoteWatchOptions{
+		RemoteFile:    server.URL + "/routes.eskip",
+		FailOnStartup: true,
+		SignatureKeys: []crypto.PublicKey{public},
+		Metrics:       &metricstest.MockMetrics{},
+	})
+	assert.EqualError(t, err, fmt.Sprintf("failed to download remote file %s/routes.eskip.sig, status code: 404", server.URL))
+}
@@ -18,20 +18,28 @@ type watchResponse struct {
 // WatchClient implements a route configuration client with file watching. Use the Watch function to initialize
 // instances of it.
 type WatchClient struct {
-	fileName    string
-	lastContent []byte
-	routes      map[string]*eskip.Route
-	getAll      chan (chan<- watchResponse)
-	getUpdates  chan (chan<- watchResponse)
-	quit        chan struct{}
-	once        sync.Once
+	fileName     string
+	lastContent  []byte
+	lastIncluded map[string][]byte
+	include      bool
+	routes       map[string]*eskip.Route
+	getAll       chan (chan<- watchResponse)
+	getUpdates   chan (chan<- watchResponse)
+	quit         chan struct{}
+	once         sync.Once
 }
 
 // Watch creates a route configuration client with file watching. Watch doesn't follow file system nodes, it
-// always reads from the file identified by the initially provided file name.
+// always reads from the file identified by the initially provided file name. The files included by the include
+// directives are watched, too.
 func Watch(name string) *WatchClient {
+	return watch(name, true)
+}
+
+func watch(name string, include bool) *WatchClient {
 	c := &WatchClient{
 		fileName:   name,
+		include:    include,
 		getAll:     make(chan (chan<- watchResponse)),
 		getUpdates: make(chan (chan<- watchResponse)),
 		quit:       make(chan struct{}),
@@ -100,6 +108,18 @@ func cloneRoutes(r []*eskip.Route) []*eskip.Route {
 	return c
 }
 
+// includedChanged tells whether any of the included files changed since the last successful parsing.
+func (c *WatchClient) includedChanged() bool {
+	for path, last := range c.lastIncluded {
+		content, err := os.ReadFile(path)
+		if err != nil || !bytes.Equal(content, last) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (c *WatchClient) loadAll() watchResponse {
 	content, err := os.ReadFile(c.fileName)
 	if err != nil {
@@ -107,7 +127,7 @@ func (c *WatchClient) loadAll() watchResponse {
 		return watchResponse{err: err}
 	}
 
-	r, err := eskip.Parse(string(content))
+	r, included, err := parseFile(c.fileName, content, c.include)
 	if err != nil {
 		c.lastContent = nil
 		return watchResponse{err: err}
@@ -115,6 +135,7 @@ func (c *WatchClient) loadAll() watchResponse {
 
 	c.storeRoutes(r)
 	c.lastContent = content
+	c.lastIncluded = included
 	return watchResponse{routes: cloneRoutes(r)}
 }
 
@@ -129,11 +150,11 @@ func (c *WatchClient) loadUpdates() watchResponse {
 		return watchResponse{err: err}
 	}
 
-	if bytes.Equal(content, c.lastContent) {
+	if bytes.Equal(content, c.lastContent) && !c.includedChanged() {
 		return watchResponse{}
 	}
 
-	r, err := eskip.Parse(string(content))
+	r, included, err := parseFile(c.fileName, content, c.include)
 	if err != nil {
 		c.lastContent = nil
 		return watchResponse{err: err}
@@ -141,6 +162,7 @@ func (c *WatchClient) loadUpdates() watchResponse {
 
 	upsert, del := c.diffStoreRoutes(r)
 	c.lastContent = content
+	c.lastIncluded = included
 	return watchResponse{routes: cloneRoutes(upsert), deletedIDs: del}
 }
 
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -269,3 +270,89 @@ func BenchmarkWatchLoadUpdate(b *testing.B) {
 		w.LoadUpdate()
 	}
 }
+
+func TestWatchIncluded(t *testing.T) {
+	dir := t.TempDir()
+	mainFile := filepath.Join(dir, "routes.eskip")
+	includedFile := filepath.Join(dir, "backends.eskip")
+
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(includedFile, `let backend = "https://foo.example.org"`)
+	write(mainFile, `include "backends.eskip"; foo: Path("/foo") -> backend`)
+
+	c := Watch(mainFile)
+	defer c.Close()
+
+	routes, err := c.LoadAll()
+	require.NoError(t, err)
+	require.Len(t, routes, 1)
+	require.Equal(t, "https://foo.example.org", routes[0].Backend)
+
+	routes, deleted, err := c.LoadUpdate()
+	require.NoError(t, err)
+	require.Empty(t, routes)
+	require.Empty(t, deleted)
+
+	write(includedFile, `let backend = "https://bar.example.org"`)
+
+	routes, deleted, err = c.LoadUpdate()
+	require.NoError(t, err)
+	require.Len(t, routes, 1)
+	require.Equal(t, "https://bar.example.org", routes[0].Backend)
+	require.Empty(t, deleted)
+
+	require.NoError(t, os.Remove(includedFile))
+
+	_, _, err = c.LoadUpdate()
+	require.ErrorContains(t, err, mainFile+":1:25: ")
+}
+
+func TestWatchIncludedTwice(t *testing.T) {
+	dir := t.TempDir()
+	mainFile := filepath.Join(dir, "routes.eskip")
+	defsFile := filepath.Join(dir, "defs.eskip")
+
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// both a.eskip and b.eskip include the same defs.eskip, with
+	// different relative paths
+	write(defsFile, `let backend = "https://foo.example.org"`)
+	write(filepath.Join(dir, "a", "a.eskip"), `include "../defs.eskip"; a: Path("/a") -> backend`)
+	write(filepath.Join(dir, "b", "b.eskip"), `include "`+defsFile+`"; b: Path("/b") -> backend`)
+	write(mainFile, `include "a/a.eskip"; include "b/b.eskip";`)
+
+	c := Watch(mainFile)
+	defer c.Close()
+
+	routes, err := c.LoadAll()
+	require.NoError(t, err)
+	require.Len(t, routes, 2)
+	for _, r := range routes {
+		require.Equal(t, "https://foo.example.org", r.Backend)
+	}
+
+	write(defsFile, `let backend = "https://bar.example.org"`)
+
+	routes, deleted, err := c.LoadUpdate()
+	require.NoError(t, err)
+	require.Len(t, routes, 2)
+	for _, r := range routes {
+		require.Equal(t, "https://bar.example.org", r.Backend)
+	}
+	require.Empty(t, deleted)
+}
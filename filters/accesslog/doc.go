@@ -13,6 +13,12 @@ Usage
 	enableAccessLog()
 	disableAccessLog()
 
+The "sampleAccessLog" filter logs only a fraction of the requests of a route, optionally only for the
+given response code prefixes:
+
+	sampleAccessLog(0.01)
+	sampleAccessLog(0.01, 2, 3)
+
 Note: accessLogDisabled("true") filter is deprecated in favor of "disableAccessLog" and "enableAccessLog"
 */
 package accesslog
@@ -0,0 +1,68 @@
+package accesslog
+
+import (
+	"github.com/zalando/skipper/filters"
+)
+
+// AccessLogSampleKey is the key used in the state bag to pass the access log sampling rules to the proxy.
+const AccessLogSampleKey = "statebag:access_log:sample"
+
+// AccessLogSample stores an access log sampling rule.
+type AccessLogSample struct {
+	// Rate is the fraction of the matching requests that are logged, between 0 and 1.
+	Rate float64
+	// Prefixes contains the list of response code prefixes the rule applies to. When empty,
+	// the rule applies to all response codes.
+	Prefixes []int
+}
+
+type sampleAccessLog struct{}
+
+// NewSampleAccessLog creates a filter spec to log only a fraction of the requests of a specific route.
+// Optionally takes in response code prefixes as arguments. When provided, the sampling rate applies
+// only if the response code matches one of the arguments. When the filter is used multiple times in
+// a route, the first rule matching the response code is applied, and responses that match none of
+// the rules are always logged.
+//
+//	sampleAccessLog(0.01)        to log 1% of the requests
+//	sampleAccessLog(0.01, 2, 30) to log 1% of the 2xx and 30x responses and all the others
+func NewSampleAccessLog() filters.Spec {
+	return &sampleAccessLog{}
+}
+
+func (*sampleAccessLog) Name() string { return filters.SampleAccessLogName }
+
+func (*sampleAccessLog) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) == 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	var rate float64
+	switch r := args[0].(type) {
+	case float64:
+		rate = r
+	case int:
+		rate = float64(r)
+	default:
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	if rate < 0 || rate > 1 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f, err := extractFilterValues(args[1:], true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AccessLogSample{Rate: rate, Prefixes: f.(*AccessLogFilter).Prefixes}, nil
+}
+
+func (s *AccessLogSample) Request(ctx filters.FilterContext) {
+	bag := ctx.StateBag()
+	samples, _ := bag[AccessLogSampleKey].([]*AccessLogSample)
+	bag[AccessLogSampleKey] = append(samples, s)
+}
+
+func (*AccessLogSample) Response(filters.FilterContext) {}
@@ -0,0 +1,76 @@
+package accesslog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando/skipper/filters/filtertest"
+)
+
+func TestSampleAccessLog(t *testing.T) {
+	for _, ti := range []struct {
+		msg     string
+		args    []interface{}
+		result  *AccessLogSample
+		isError bool
+	}{{
+		msg:    "sample all responses",
+		args:   []interface{}{0.01},
+		result: &AccessLogSample{Rate: 0.01, Prefixes: []int{}},
+	}, {
+		msg:    "sample selected responses",
+		args:   []interface{}{0.5, 2, 30.0, 404},
+		result: &AccessLogSample{Rate: 0.5, Prefixes: []int{2, 30, 404}},
+	}, {
+		msg:    "integer rate",
+		args:   []interface{}{1},
+		result: &AccessLogSample{Rate: 1, Prefixes: []int{}},
+	}, {
+		msg:     "no args",
+		isError: true,
+	}, {
+		msg:     "rate too large",
+		args:    []interface{}{1.5},
+		isError: true,
+	}, {
+		msg:     "negative rate",
+		args:    []interface{}{-0.1},
+		isError: true,
+	}, {
+		msg:     "invalid rate",
+		args:    []interface{}{"0.1"},
+		isError: true,
+	}, {
+		msg:     "invalid prefix",
+		args:    []interface{}{0.1, "5xx"},
+		isError: true,
+	}} {
+		t.Run(ti.msg, func(t *testing.T) {
+			f, err := NewSampleAccessLog().CreateFilter(ti.args)
+			if ti.isError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, ti.result, f)
+		})
+	}
+}
+
+func TestSampleAccessLogAppendsRules(t *testing.T) {
+	f1, err := NewSampleAccessLog().CreateFilter([]interface{}{1.0, 5})
+	require.NoError(t, err)
+	f2, err := NewSampleAccessLog().CreateFilter([]interface{}{0.01})
+	require.NoError(t, err)
+
+	ctx := &filtertest.Context{FStateBag: make(map[string]interface{})}
+	f1.Request(ctx)
+	f2.Request(ctx)
+
+	assert.Equal(t, []*AccessLogSample{
+		{Rate: 1, Prefixes: []int{5}},
+		{Rate: 0.01, Prefixes: []int{}},
+	}, ctx.FStateBag[AccessLogSampleKey])
+}
@@ -0,0 +1,419 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+	snet "github.com/zalando/skipper/net"
+)
+
+const (
+	// CSRFDoubleSubmitCookie pattern stores the token in a cookie, and
+	// expects the same token in the header or the form field of the
+	// requests with unsafe methods.
+	CSRFDoubleSubmitCookie = "doubleSubmitCookie"
+
+	// CSRFSynchronizerToken pattern binds the token to the session
+	// cookie, and expects it in the header or the form field of the
+	// requests with unsafe methods. The token is passed to the backend,
+	// that embeds it in the pages.
+	CSRFSynchronizerToken = "synchronizerToken"
+
+	defaultCSRFHeaderName = "X-CSRF-Token"
+	defaultCSRFFormField  = "csrf_token"
+	defaultCSRFCookieName = "csrf-token"
+	defaultCSRFTokenTTL   = 12 * time.Hour
+
+	// maximum size of the form body read to look up the token
+	csrfMaxFormSize = 1 << 20
+
+	csrfCookieStateKey = "filter." + filters.CSRFProtectName + ".cookie"
+)
+
+var (
+	errCSRFMissingToken  = errors.New("missing token")
+	errCSRFInvalidToken  = errors.New("invalid token")
+	errCSRFExpiredToken  = errors.New("expired token")
+	errCSRFTokenMismatch = errors.New("token does not match")
+	errCSRFInvalidOrigin = errors.New("origin not allowed")
+)
+
+type (
+	csrfSpec struct {
+		config *OAuthConfig
+		parser yamlConfigParser[csrfOptions]
+	}
+
+	// csrfOptions implements [yamlConfig],
+	// make sure it is not modified after initialization.
+	csrfOptions struct {
+		Pattern            string   `json:"pattern,omitempty"`
+		AllowedOrigins     []string `json:"allowedOrigins,omitempty"`
+		HeaderName         string   `json:"headerName,omitempty"`
+		FormField          string   `json:"formField,omitempty"`
+		CookieName         string   `json:"cookieName,omitempty"`
+		SessionCookieName  string   `json:"sessionCookieName,omitempty"`
+		TokenTTL           string   `json:"tokenTTL,omitempty"`
+		ExemptPaths        []string `json:"exemptPaths,omitempty"`
+		ExemptContentTypes []string `json:"exemptContentTypes,omitempty"`
+
+		ttl     time.Duration
+		origins map[string]bool
+	}
+
+	csrfFilter struct {
+		config  *OAuthConfig
+		options *csrfOptions
+	}
+
+	csrfToken struct {
+		Validity int64  `json:"validity"`
+		Nonce    string `json:"nonce"`
+		Session  string `json:"session,omitempty"`
+	}
+)
+
+// NewCSRFProtect creates the specification of the csrfProtect filter.
+// The tokens are encrypted with the same secrets as the token cookies
+// of the oauthGrant filter.
+func (c *OAuthConfig) NewCSRFProtect() filters.Spec {
+	return &csrfSpec{
+		config: c,
+		parser: newYamlConfigParser[csrfOptions](64),
+	}
+}
+
+func (*csrfSpec) Name() string { return filters.CSRFProtectName }
+
+func (s *csrfSpec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) == 0 {
+		args = []interface{}{"{}"}
+	}
+
+	o, err := s.parser.parseSingleArg(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filters.CSRFProtectName, err)
+	}
+
+	return &csrfFilter{config: s.config, options: o}, nil
+}
+
+func (o *csrfOptions) initialize() error {
+	switch o.Pattern {
+	case "":
+		o.Pattern = CSRFDoubleSubmitCookie
+	case CSRFDoubleSubmitCookie, CSRFSynchronizerToken:
+	default:
+		return fmt.Errorf("invalid pattern: %q", o.Pattern)
+	}
+
+	if o.HeaderName == "" {
+		o.HeaderName = defaultCSRFHeaderName
+	}
+
+	if o.FormField == "" {
+		o.FormField = defaultCSRFFormField
+	}
+
+	if o.CookieName == "" {
+		o.CookieName = defaultCSRFCookieName
+	}
+
+	o.ttl = defaultCSRFTokenTTL
+	if o.TokenTTL != "" {
+		ttl, err := time.ParseDuration(o.TokenTTL)
+		if err != nil || ttl <= 0 {
+			return fmt.Errorf("invalid token TTL: %q", o.TokenTTL)
+		}
+
+		o.ttl = ttl
+	}
+
+	o.origins = make(map[string]bool)
+	for _, origin := range o.AllowedOrigins {
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid allowed origin: %q", origin)
+		}
+
+		o.origins[strings.ToLower(u.Scheme+"://"+u.Host)] = true
+	}
+
+	for i, ct := range o.ExemptContentTypes {
+		o.ExemptContentTypes[i] = strings.ToLower(ct)
+	}
+
+	return nil
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+func (f *csrfFilter) sessionCookieName() string {
+	if f.options.SessionCookieName != "" {
+		return f.options.SessionCookieName
+	}
+
+	return f.config.TokenCookieName
+}
+
+// session returns the hash of the session cookie, that the synchronizer
+// tokens are bound to.
+func (f *csrfFilter) session(req *http.Request) string {
+	if f.options.Pattern != CSRFSynchronizerToken {
+		return ""
+	}
+
+	c, err := req.Cookie(f.sessionCookieName())
+	if err != nil || c.Value == "" {
+		return ""
+	}
+
+	h := sha256.Sum256([]byte(c.Value))
+	return hex.EncodeToString(h[:16])
+}
+
+func (f *csrfFilter) createToken(session string) (string, error) {
+	encrypter, err := f.config.Secrets.GetEncrypter(secretsRefreshInternal, f.config.SecretFile)
+	if err != nil {
+		return "", err
+	}
+
+	nonce, err := encrypter.CreateNonce()
+	if err != nil {
+		return "", err
+	}
+
+	jb, err := json.Marshal(csrfToken{
+		Validity: time.Now().Add(f.options.ttl).Unix(),
+		Nonce:    hex.EncodeToString(nonce),
+		Session:  session,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	eb, err := encrypter.Encrypt(jb)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(eb), nil
+}
+
+func (f *csrfFilter) verifyToken(token, session string) error {
+	encrypter, err := f.config.Secrets.GetEncrypter(secretsRefreshInternal, f.config.SecretFile)
+	if err != nil {
+		return err
+	}
+
+	eb, err := hex.DecodeString(token)
+	if err != nil {
+		return errCSRFInvalidToken
+	}
+
+	jb, err := encrypter.Decrypt(eb)
+	if err != nil {
+		return errCSRFInvalidToken
+	}
+
+	var t csrfToken
+	if err := json.Unmarshal(jb, &t); err != nil {
+		return errCSRFInvalidToken
+	}
+
+	if time.Unix(t.Validity, 0).Before(time.Now()) {
+		return errCSRFExpiredToken
+	}
+
+	if subtle.ConstantTimeCompare([]byte(t.Session), []byte(session)) != 1 {
+		return errCSRFTokenMismatch
+	}
+
+	return nil
+}
+
+func (f *csrfFilter) exempt(req *http.Request) bool {
+	for _, p := range f.options.ExemptPaths {
+		// whole path segments only, /api doesn't exempt /apifoo
+		p = strings.TrimSuffix(p, "/")
+		if req.URL.Path == p || strings.HasPrefix(req.URL.Path, p+"/") {
+			return true
+		}
+	}
+
+	if len(f.options.ExemptContentTypes) > 0 {
+		mt, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		for _, ct := range f.options.ExemptContentTypes {
+			if mt == ct {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// checkOrigin verifies the Origin header, or the Referer header when the
+// Origin is missing, against the allowed origins. Without configured
+// origins, the host of the origin needs to match the host of the request.
+// When both headers are missing, only the token is checked.
+func (f *csrfFilter) checkOrigin(req *http.Request) error {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		referer := req.Header.Get("Referer")
+		if referer == "" {
+			return nil
+		}
+
+		origin = referer
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return errCSRFInvalidOrigin
+	}
+
+	if len(f.options.origins) > 0 {
+		if f.options.origins[strings.ToLower(u.Scheme+"://"+u.Host)] {
+			return nil
+		}
+
+		return errCSRFInvalidOrigin
+	}
+
+	if strings.EqualFold(u.Host, req.Host) {
+		return nil
+	}
+
+	return errCSRFInvalidOrigin
+}
+
+// requestToken returns the token from the header, or from the form field
+// of URL encoded form bodies. The body is restored after reading it.
+func (f *csrfFilter) requestToken(req *http.Request) string {
+	if t := req.Header.Get(f.options.HeaderName); t != "" {
+		return t
+	}
+
+	mt, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mt != "application/x-www-form-urlencoded" || req.Body == nil || req.Body == http.NoBody {
+		return ""
+	}
+
+	var b []byte
+	b, req.Body, _ = snet.PeekBody(req.Body, csrfMaxFormSize)
+	values, err := url.ParseQuery(string(b))
+	if err != nil {
+		return ""
+	}
+
+	return values.Get(f.options.FormField)
+}
+
+// validate checks the origin and the token of the requests with unsafe
+// methods.
+func (f *csrfFilter) validate(req *http.Request) (string, error) {
+	if err := f.checkOrigin(req); err != nil {
+		return "", err
+	}
+
+	token := f.requestToken(req)
+	if token == "" {
+		return "", errCSRFMissingToken
+	}
+
+	if f.options.Pattern == CSRFDoubleSubmitCookie {
+		c, err := req.Cookie(f.options.CookieName)
+		if err != nil {
+			return "", errCSRFMissingToken
+		}
+
+		if subtle.ConstantTimeCompare([]byte(c.Value), []byte(token)) != 1 {
+			return "", errCSRFTokenMismatch
+		}
+	}
+
+	return token, f.verifyToken(token, f.session(req))
+}
+
+// issue forwards a valid token to the backend, and creates a new one,
+// when the double submit cookie is missing or invalid, or for every
+// request with the synchronizer pattern.
+func (f *csrfFilter) issue(ctx filters.FilterContext) error {
+	req := ctx.Request()
+	if f.options.Pattern == CSRFDoubleSubmitCookie {
+		if c, err := req.Cookie(f.options.CookieName); err == nil && f.verifyToken(c.Value, "") == nil {
+			req.Header.Set(f.options.HeaderName, c.Value)
+			return nil
+		}
+	}
+
+	token, err := f.createToken(f.session(req))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(f.options.HeaderName, token)
+	if f.options.Pattern == CSRFDoubleSubmitCookie {
+		ctx.StateBag()[csrfCookieStateKey] = &http.Cookie{
+			Name:     f.options.CookieName,
+			Value:    token,
+			Path:     "/",
+			MaxAge:   int(f.options.ttl.Seconds()),
+			Secure:   !f.config.Insecure,
+			SameSite: http.SameSiteLaxMode,
+			// the cookie needs to be readable by the scripts of the page
+			HttpOnly: false,
+		}
+	}
+
+	return nil
+}
+
+func (f *csrfFilter) Request(ctx filters.FilterContext) {
+	req := ctx.Request()
+	if isSafeMethod(req.Method) {
+		if err := f.issue(ctx); err != nil {
+			ctx.Logger().Errorf("%s: failed to create token: %v", filters.CSRFProtectName, err)
+		}
+
+		return
+	}
+
+	if f.exempt(req) {
+		return
+	}
+
+	token, err := f.validate(req)
+	if err != nil {
+		ctx.Logger().Debugf("%s: rejected request: %v", filters.CSRFProtectName, err)
+		ctx.Serve(&http.Response{StatusCode: http.StatusForbidden})
+		return
+	}
+
+	// the valid token is passed to the backend like for the safe methods
+	req.Header.Set(f.options.HeaderName, token)
+}
+
+func (f *csrfFilter) Response(ctx filters.FilterContext) {
+	if c, ok := ctx.StateBag()[csrfCookieStateKey].(*http.Cookie); ok {
+		ctx.Response().Header.Add("Set-Cookie", c.String())
+	}
+}
@@ -0,0 +1,280 @@
+package auth_test
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/auth"
+	"github.com/zalando/skipper/filters/filtertest"
+	"github.com/zalando/skipper/secrets"
+)
+
+func newCSRFFilter(t *testing.T, args ...interface{}) filters.Filter {
+	t.Helper()
+
+	config := &auth.OAuthConfig{
+		Secrets:         secrets.NewRegistry(),
+		SecretFile:      testSecretFile,
+		TokenCookieName: testCookieName,
+	}
+	t.Cleanup(config.Secrets.Close)
+
+	spec := config.NewCSRFProtect()
+	assert.Equal(t, filters.CSRFProtectName, spec.Name())
+
+	f, err := spec.CreateFilter(args)
+	require.NoError(t, err)
+	return f
+}
+
+// csrfRequest runs the request through the filter, and returns the
+// context and whether the request was rejected.
+func csrfRequest(f filters.Filter, req *http.Request) (*filtertest.Context, bool) {
+	ctx := &filtertest.Context{FRequest: req, FStateBag: make(map[string]interface{})}
+	f.Request(ctx)
+	if ctx.FServed {
+		return ctx, ctx.FResponse.StatusCode == http.StatusForbidden
+	}
+
+	ctx.FResponse = &http.Response{StatusCode: http.StatusOK, Header: make(http.Header)}
+	f.Response(ctx)
+	return ctx, false
+}
+
+// issueCSRFToken makes a safe request, and returns the token passed to
+// the backend and the cookie set on the response, if any.
+func issueCSRFToken(t *testing.T, f filters.Filter, cookies ...*http.Cookie) (string, *http.Cookie) {
+	t.Helper()
+
+	req, _ := http.NewRequest("GET", "https://www.example.org/form", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+
+	ctx, rejected := csrfRequest(f, req)
+	require.False(t, rejected)
+
+	token := req.Header.Get("X-CSRF-Token")
+	require.NotEmpty(t, token)
+
+	var cookie *http.Cookie
+	for _, c := range ctx.FResponse.Cookies() {
+		if c.Name == "csrf-token" {
+			cookie = c
+		}
+	}
+
+	return token, cookie
+}
+
+func TestCSRFInvalidConfig(t *testing.T) {
+	config := &auth.OAuthConfig{Secrets: secrets.NewRegistry(), SecretFile: testSecretFile}
+	defer config.Secrets.Close()
+
+	spec := config.NewCSRFProtect()
+	for _, args := range [][]interface{}{
+		{42},
+		{"pattern: foo"},
+		{"tokenTTL: foo"},
+		{"allowedOrigins: [example.org]"},
+		{"{}", "{}"},
+	} {
+		_, err := spec.CreateFilter(args)
+		assert.Error(t, err, "%v", args)
+	}
+}
+
+func TestCSRFDoubleSubmitCookie(t *testing.T) {
+	f := newCSRFFilter(t)
+
+	token, cookie := issueCSRFToken(t, f)
+	require.NotNil(t, cookie)
+	assert.Equal(t, token, cookie.Value)
+	assert.True(t, cookie.Secure)
+	assert.False(t, cookie.HttpOnly)
+
+	t.Run("valid cookie is reused", func(t *testing.T) {
+		reused, newCookie := issueCSRFToken(t, f, cookie)
+		assert.Equal(t, token, reused)
+		assert.Nil(t, newCookie)
+	})
+
+	t.Run("invalid cookie is replaced", func(t *testing.T) {
+		replaced, newCookie := issueCSRFToken(t, f, &http.Cookie{Name: "csrf-token", Value: "foo"})
+		assert.NotEqual(t, "foo", replaced)
+		require.NotNil(t, newCookie)
+		assert.Equal(t, replaced, newCookie.Value)
+	})
+
+	for _, tc := range []struct {
+		name     string
+		cookie   string
+		header   string
+		form     string
+		origin   string
+		referer  string
+		rejected bool
+	}{{
+		name:   "token in header",
+		cookie: token,
+		header: token,
+	}, {
+		name:   "token in form",
+		cookie: token,
+		form:   token,
+	}, {
+		name:   "same origin",
+		cookie: token,
+		header: token,
+		origin: "https://www.example.org",
+	}, {
+		name:    "same origin referer",
+		cookie:  token,
+		header:  token,
+		referer: "https://www.example.org/form",
+	}, {
+		name:     "missing token",
+		cookie:   token,
+		rejected: true,
+	}, {
+		name:     "missing cookie",
+		header:   token,
+		rejected: true,
+	}, {
+		name:     "token does not match cookie",
+		cookie:   token,
+		header:   "foo",
+		rejected: true,
+	}, {
+		name:     "forged token",
+		cookie:   "foo",
+		header:   "foo",
+		rejected: true,
+	}, {
+		name:     "cross origin",
+		cookie:   token,
+		header:   token,
+		origin:   "https://evil.example.com",
+		rejected: true,
+	}, {
+		name:     "cross origin referer",
+		cookie:   token,
+		header:   token,
+		referer:  "https://evil.example.com/form",
+		rejected: true,
+	}, {
+		name:     "null origin",
+		cookie:   token,
+		header:   token,
+		origin:   "null",
+		rejected: true,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			var body io.Reader
+			if tc.form != "" {
+				body = strings.NewReader(url.Values{"csrf_token": {tc.form}, "name": {"value"}}.Encode())
+			}
+
+			req, _ := http.NewRequest("POST", "https://www.example.org/form", body)
+			if tc.form != "" {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+
+			if tc.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "csrf-token", Value: tc.cookie})
+			}
+
+			if tc.header != "" {
+				req.Header.Set("X-CSRF-Token", tc.header)
+			}
+
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+
+			if tc.referer != "" {
+				req.Header.Set("Referer", tc.referer)
+			}
+
+			_, rejected := csrfRequest(f, req)
+			assert.Equal(t, tc.rejected, rejected)
+
+			if !rejected && tc.form != "" {
+				b, err := io.ReadAll(req.Body)
+				require.NoError(t, err)
+				assert.Contains(t, string(b), "name=value")
+			}
+		})
+	}
+}
+
+func TestCSRFSynchronizerToken(t *testing.T) {
+	f := newCSRFFilter(t, `{pattern: synchronizerToken}`)
+
+	session := &http.Cookie{Name: testCookieName, Value: "session-1"}
+	token, cookie := issueCSRFToken(t, f, session)
+	assert.Nil(t, cookie)
+
+	post := func(token string, session *http.Cookie) bool {
+		req, _ := http.NewRequest("DELETE", "https://www.example.org/items/1", nil)
+		req.Header.Set("X-CSRF-Token", token)
+		req.AddCookie(session)
+		_, rejected := csrfRequest(f, req)
+		return rejected
+	}
+
+	assert.False(t, post(token, session))
+	assert.True(t, post(token, &http.Cookie{Name: testCookieName, Value: "session-2"}))
+	assert.True(t, post("", session))
+}
+
+func TestCSRFAllowedOrigins(t *testing.T) {
+	f := newCSRFFilter(t, `{allowedOrigins: ["https://app.example.org"]}`)
+	token, _ := issueCSRFToken(t, f)
+
+	for origin, rejected := range map[string]bool{
+		"https://app.example.org": false,
+		"https://APP.example.org": false,
+		"http://app.example.org":  true,
+		"https://www.example.org": true,
+	} {
+		req, _ := http.NewRequest("PUT", "https://www.example.org/items/1", nil)
+		req.AddCookie(&http.Cookie{Name: "csrf-token", Value: token})
+		req.Header.Set("X-CSRF-Token", token)
+		req.Header.Set("Origin", origin)
+
+		_, r := csrfRequest(f, req)
+		assert.Equal(t, rejected, r, origin)
+	}
+}
+
+func TestCSRFExemptions(t *testing.T) {
+	f := newCSRFFilter(t, `{exemptPaths: ["/webhooks/", "/hooks"], exemptContentTypes: ["application/json"]}`)
+
+	for _, tc := range []struct {
+		path, contentType string
+		rejected          bool
+	}{
+		{path: "/webhooks/github", contentType: "text/plain"},
+		{path: "/webhooks", contentType: "text/plain"},
+		{path: "/hooks", contentType: "text/plain"},
+		{path: "/hooks/github", contentType: "text/plain"},
+		{path: "/hooksfoo", contentType: "text/plain", rejected: true},
+		{path: "/webhooksfoo/github", contentType: "text/plain", rejected: true},
+		{path: "/api", contentType: "application/json; charset=utf-8"},
+		{path: "/api", contentType: "text/plain", rejected: true},
+	} {
+		req, _ := http.NewRequest("POST", "https://www.example.org"+tc.path, strings.NewReader("x"))
+		req.Header.Set("Content-Type", tc.contentType)
+
+		_, rejected := csrfRequest(f, req)
+		assert.Equal(t, tc.rejected, rejected, tc.path)
+	}
+}
@@ -16,7 +16,9 @@ import (
 	"github.com/zalando/skipper/filters/diag"
 	"github.com/zalando/skipper/filters/fadein"
 	"github.com/zalando/skipper/filters/flowid"
+	"github.com/zalando/skipper/filters/graphql"
 	logfilter "github.com/zalando/skipper/filters/log"
+	"github.com/zalando/skipper/filters/openapi"
 	"github.com/zalando/skipper/filters/rfc"
 	"github.com/zalando/skipper/filters/scheduler"
 	"github.com/zalando/skipper/filters/sed"
@@ -215,6 +217,7 @@ func Filters() []filters.Spec {
 		cookie.NewJSCookie(),
 		circuit.NewConsecutiveBreaker(),
 		circuit.NewRateBreaker(),
+		circuit.NewLatencyBreaker(),
 		circuit.NewDisableBreaker(),
 		script.NewLuaScript(),
 		cors.NewOrigin(),
@@ -230,10 +233,12 @@ func Filters() []filters.Spec {
 		accesslog.NewDisableAccessLog(),
 		accesslog.NewMaskAccessLogQuery(),
 		accesslog.NewEnableAccessLog(),
+		accesslog.NewSampleAccessLog(),
 		auth.NewForwardToken(),
 		auth.NewForwardTokenField(),
 		scheduler.NewFifo(),
 		scheduler.NewFifoWithBody(),
+		scheduler.NewAdaptiveConcurrency(),
 		scheduler.NewLIFO(),
 		scheduler.NewLIFOGroup(),
 		rfc.NewPath(),
@@ -242,6 +247,8 @@ func Filters() []filters.Spec {
 		fadein.NewEndpointCreated(),
 		consistenthash.NewConsistentHashKey(),
 		consistenthash.NewConsistentHashBalanceFactor(),
+		openapi.NewOpenApiValidate(),
+		graphql.NewLimits(),
 		tls.New(),
 		tls.NewMtlsCN(),
 		tls.NewMtlsIssuerDN(),
@@ -0,0 +1,190 @@
+/*
+Package canary implements the canary and the canaryBaseline filters,
+that mark the canary and the baseline routes of a canary group, for the
+automated analysis of the canary package.
+
+The canary filter configures the analysis of the group:
+
+	canary(group, stepPercent, interval, maxErrorRate, maxP99)
+
+The canary route starts with the weight of stepPercent, and after every
+interval, when its error rate and 99th percentile latency are within
+maxErrorRate and maxP99, its weight is raised by stepPercent. When the
+limits are exceeded by the canary, but not by the baseline, the weight
+is set to 0. Changing any of the arguments starts the analysis again.
+
+The filters don't process the requests. The groups are configured by
+the post processor, once for every routing table, from the filters of
+all the routes, and the responses of the routes are measured by the
+endpoint registry. The responses with 5xx status codes count as errors, and so
+do the failed round trips, e.g. when the backend cannot be reached.
+
+The filters are available when the canary analysis is enabled with
+-enable-canary-analysis.
+
+Example:
+
+	baseline: Path("/api") -> canaryBaseline("api-v2") -> "https://api-v1.example.org";
+	canary: Path("/api") && Canary("api-v2") -> canary("api-v2", 10, "5m", 0.01, "500ms") -> "https://api-v2.example.org";
+*/
+package canary
+
+import (
+	"time"
+
+	"github.com/zalando/skipper/canary"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/routing"
+)
+
+type spec struct {
+	baseline bool
+}
+
+type filter struct {
+	group  string
+	canary bool
+	config canary.Config
+}
+
+type postProcessor struct {
+	registry *canary.Registry
+}
+
+// New creates the specification of the canary filter.
+func New() filters.Spec {
+	return &spec{}
+}
+
+// NewBaseline creates the specification of the canaryBaseline filter.
+func NewBaseline() filters.Spec {
+	return &spec{baseline: true}
+}
+
+// NewPostProcessor creates the post processor, that configures the
+// groups of the registry by the canary and the canaryBaseline filters
+// of the routes.
+func NewPostProcessor(r *canary.Registry) routing.PostProcessor {
+	return &postProcessor{registry: r}
+}
+
+func (s *spec) Name() string {
+	if s.baseline {
+		return filters.CanaryBaselineName
+	}
+
+	return filters.CanaryName
+}
+
+func durationArg(a interface{}) (time.Duration, error) {
+	s, ok := a.(string)
+	if !ok {
+		return 0, filters.ErrInvalidFilterParameters
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, filters.ErrInvalidFilterParameters
+	}
+
+	return d, nil
+}
+
+func (s *spec) config(args []interface{}) (canary.Config, error) {
+	var c canary.Config
+	if len(args) != 5 {
+		return c, filters.ErrInvalidFilterParameters
+	}
+
+	var ok bool
+	c.StepPercent, ok = args[1].(float64)
+	if !ok || c.StepPercent <= 0 || c.StepPercent > 100 {
+		return c, filters.ErrInvalidFilterParameters
+	}
+
+	var err error
+	if c.Interval, err = durationArg(args[2]); err != nil {
+		return c, err
+	}
+
+	c.MaxErrorRate, ok = args[3].(float64)
+	if !ok || c.MaxErrorRate < 0 || c.MaxErrorRate > 1 {
+		return c, filters.ErrInvalidFilterParameters
+	}
+
+	if c.MaxP99, err = durationArg(args[4]); err != nil {
+		return c, err
+	}
+
+	return c, nil
+}
+
+func (s *spec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) == 0 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	name, ok := args[0].(string)
+	if !ok || name == "" {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f := &filter{group: name, canary: !s.baseline}
+	if s.baseline {
+		if len(args) != 1 {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+	} else {
+		c, err := s.config(args)
+		if err != nil {
+			return nil, err
+		}
+
+		f.config = c
+	}
+
+	return f, nil
+}
+
+func (*filter) Request(filters.FilterContext)  {}
+func (*filter) Response(filters.FilterContext) {}
+
+func routeHosts(r *routing.Route) []string {
+	switch r.BackendType {
+	case eskip.NetworkBackend:
+		return []string{r.Host}
+	case eskip.LBBackend:
+		hosts := make([]string, len(r.LBEndpoints))
+		for i, ep := range r.LBEndpoints {
+			hosts[i] = ep.Host
+		}
+
+		return hosts
+	default:
+		return nil
+	}
+}
+
+func (p *postProcessor) Do(routes []*routing.Route) []*routing.Route {
+	var members []canary.Member
+	for _, r := range routes {
+		for _, rf := range r.Filters {
+			f, ok := rf.Filter.(*filter)
+			if !ok {
+				continue
+			}
+
+			members = append(members, canary.Member{
+				Group:   f.group,
+				RouteID: r.Id,
+				Canary:  f.canary,
+				Config:  f.config,
+				Hosts:   routeHosts(r),
+			})
+		}
+	}
+
+	p.registry.Update(members)
+	return routes
+}
@@ -0,0 +1,85 @@
+package canary
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando/skipper/canary"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/metrics/metricstest"
+	"github.com/zalando/skipper/routing"
+)
+
+func TestArgs(t *testing.T) {
+	for _, tt := range []struct {
+		spec filters.Spec
+		args []interface{}
+	}{
+		{New(), []interface{}{}},
+		{New(), []interface{}{"api"}},
+		{New(), []interface{}{"", 10.0, "5m", 0.01, "500ms"}},
+		{New(), []interface{}{42, 10.0, "5m", 0.01, "500ms"}},
+		{New(), []interface{}{"api", 0.0, "5m", 0.01, "500ms"}},
+		{New(), []interface{}{"api", 101.0, "5m", 0.01, "500ms"}},
+		{New(), []interface{}{"api", "10", "5m", 0.01, "500ms"}},
+		{New(), []interface{}{"api", 10.0, "5", 0.01, "500ms"}},
+		{New(), []interface{}{"api", 10.0, "-5m", 0.01, "500ms"}},
+		{New(), []interface{}{"api", 10.0, "5m", 1.5, "500ms"}},
+		{New(), []interface{}{"api", 10.0, "5m", -0.1, "500ms"}},
+		{New(), []interface{}{"api", 10.0, "5m", 0.01, 500.0}},
+		{New(), []interface{}{"api", 10.0, "5m", 0.01, "500ms", "foo"}},
+		{NewBaseline(), []interface{}{}},
+		{NewBaseline(), []interface{}{""}},
+		{NewBaseline(), []interface{}{"api", 10.0}},
+	} {
+		if _, err := tt.spec.CreateFilter(tt.args); err == nil {
+			t.Errorf("expected error for %s arguments: %v", tt.spec.Name(), tt.args)
+		}
+	}
+}
+
+func TestPostProcessor(t *testing.T) {
+	r := canary.NewRegistry(canary.Options{
+		Metrics:          &metricstest.MockMetrics{},
+		EndpointRegistry: routing.NewEndpointRegistry(routing.RegistryOptions{}),
+	})
+	defer r.Close()
+
+	c, err := New().CreateFilter([]interface{}{"api", 10.0, "5m", 0.01, "500ms"})
+	require.NoError(t, err)
+
+	b, err := NewBaseline().CreateFilter([]interface{}{"api"})
+	require.NoError(t, err)
+
+	routes := []*routing.Route{{
+		Route:   eskip.Route{Id: "baseline", BackendType: eskip.LBBackend},
+		Filters: []*routing.RouteFilter{{Filter: b, Name: filters.CanaryBaselineName}},
+		LBEndpoints: []routing.LBEndpoint{
+			{Scheme: "http", Host: "10.0.0.1:8080"},
+			{Scheme: "http", Host: "10.0.0.2:8080"},
+		},
+	}, {
+		Route:   eskip.Route{Id: "canary", BackendType: eskip.NetworkBackend},
+		Filters: []*routing.RouteFilter{{Filter: c, Name: filters.CanaryName}},
+		Host:    "api-v2.example.org:443",
+	}}
+
+	assert.Equal(t, routes, NewPostProcessor(r).Do(routes))
+	assert.Equal(t, canary.GroupState{
+		Name:          "api",
+		State:         canary.StateProgressing,
+		WeightPercent: 10,
+		StepPercent:   10,
+		Interval:      "5m0s",
+		MaxErrorRate:  0.01,
+		MaxP99:        "500ms",
+	}, r.Group("api").State())
+
+	// a canary route without network backend
+	routes[1].BackendType = eskip.ShuntBackend
+	NewPostProcessor(r).Do(routes)
+	assert.Equal(t, "the canary route has no network backend", r.Group("api").State().Error)
+}
@@ -6,6 +6,9 @@ For detailed documentation of the circuit breakers, see https://pkg.go.dev/githu
 package circuit
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/zalando/skipper/circuit"
@@ -78,6 +81,25 @@ func NewRateBreaker() filters.Spec {
 	return &spec{typ: circuit.FailureRate}
 }
 
+// NewLatencyBreaker creates a filter specification to instantiate latencyBreaker() filters.
+//
+// These filters set a breaker for the current route that open if the latency of the backend exceeds a threshold
+// for too many requests within a window of the last M requests. The threshold, the limit and the window are
+// mandatory arguments of the filter. The limit is either a percentile, when the latency of the 99th percentile
+// should not exceed 500ms:
+//
+//	latencyBreaker("500ms", "p99", 1000)
+//
+// or the ratio of the slow requests, when not more than 10% of the requests should be slower than 1s:
+//
+//	latencyBreaker("1s", 0.1, 1000)
+//
+// Failed requests count as slow requests. The filter accepts the following optional arguments: timeout
+// (milliseconds or duration string), half-open-requests (integer), idle-ttl (milliseconds or duration string).
+func NewLatencyBreaker() filters.Spec {
+	return &spec{typ: circuit.HighLatency}
+}
+
 // NewDisableBreaker disables the circuit breaker for a route. It doesn't accept any arguments.
 func NewDisableBreaker() filters.Spec {
 	return &spec{}
@@ -89,6 +111,8 @@ func (s *spec) Name() string {
 		return filters.ConsecutiveBreakerName
 	case circuit.FailureRate:
 		return filters.RateBreakerName
+	case circuit.HighLatency:
+		return filters.LatencyBreakerName
 	default:
 		return filters.DisableBreakerName
 	}
@@ -190,6 +214,92 @@ func rateFilter(args []interface{}) (filters.Filter, error) {
 	}, nil
 }
 
+// getLatencyLimitArg accepts either a percentile in the form of p99 or
+// p99.9, or the ratio of the slow requests, e.g. 0.1.
+func getLatencyLimitArg(a interface{}) (percentile, slowRatio float64, err error) {
+	if s, ok := a.(string); ok {
+		ps, found := strings.CutPrefix(s, "p")
+		if !found {
+			return 0, 0, filters.ErrInvalidFilterParameters
+		}
+
+		percentile, err = strconv.ParseFloat(ps, 64)
+		if err != nil || percentile <= 0 || percentile >= 100 {
+			return 0, 0, fmt.Errorf("percentile requires value between 0 and 100, %w", filters.ErrInvalidFilterParameters)
+		}
+
+		return percentile, 0, nil
+	}
+
+	if f, ok := a.(float64); ok && f > 0 && f < 1 {
+		return 0, f, nil
+	}
+
+	return 0, 0, fmt.Errorf("slow ratio requires value between 0 and 1, %w", filters.ErrInvalidFilterParameters)
+}
+
+func latencyFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) < 3 || len(args) > 6 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	latency, err := getDurationArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if latency <= 0 {
+		return nil, fmt.Errorf("latency requires value >0, %w", filters.ErrInvalidFilterParameters)
+	}
+
+	percentile, slowRatio, err := getLatencyLimitArg(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	window, err := getIntArg(args[2])
+	if err != nil {
+		return nil, err
+	}
+
+	var timeout time.Duration
+	if len(args) > 3 {
+		timeout, err = getDurationArg(args[3])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var halfOpenRequests int
+	if len(args) > 4 {
+		halfOpenRequests, err = getIntArg(args[4])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var idleTTL time.Duration
+	if len(args) > 5 {
+		idleTTL, err = getDurationArg(args[5])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &filter{
+		settings: circuit.BreakerSettings{
+			Type:             circuit.HighLatency,
+			Latency:          latency,
+			Percentile:       percentile,
+			SlowRatio:        slowRatio,
+			Window:           window,
+			Timeout:          timeout,
+			HalfOpenRequests: halfOpenRequests,
+			IdleTTL:          idleTTL,
+		},
+	}, nil
+}
+
 func disableFilter(args []interface{}) (filters.Filter, error) {
 	if len(args) != 0 {
 		return nil, filters.ErrInvalidFilterParameters
@@ -208,6 +318,8 @@ func (s *spec) CreateFilter(args []interface{}) (filters.Filter, error) {
 		return consecutiveFilter(args)
 	case circuit.FailureRate:
 		return rateFilter(args)
+	case circuit.HighLatency:
+		return latencyFilter(args)
 	default:
 		return disableFilter(args)
 	}
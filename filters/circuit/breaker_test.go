@@ -53,6 +53,21 @@ func TestArgs(t *testing.T) {
 		t.Run("with idle ttl", testOK(s, 30, 300, 60000, 12, "30m"))
 	})
 
+	t.Run("latency", func(t *testing.T) {
+		s := NewLatencyBreaker()
+		t.Run("missing window", testErr(s, "500ms", "p99"))
+		t.Run("too many", testErr(s, "500ms", "p99", 300, "1m", 45, "30m", 42))
+		t.Run("wrong latency", testErr(s, "foo", "p99", 300))
+		t.Run("zero latency", testErr(s, 0, "p99", 300))
+		t.Run("wrong percentile", testErr(s, "500ms", "99", 300))
+		t.Run("percentile out of range", testErr(s, "500ms", "p100", 300))
+		t.Run("slow ratio out of range", testErr(s, "500ms", 1.5, 300))
+		t.Run("wrong window", testErr(s, "500ms", "p99", "300"))
+		t.Run("only latency, percentile and window", testOK(s, "500ms", "p99.9", 300))
+		t.Run("latency as milliseconds with slow ratio", testOK(s, 500, 0.1, 300))
+		t.Run("full", testOK(s, "500ms", "p99", 300, "1m", 45, "30m"))
+	})
+
 	t.Run("disable", func(t *testing.T) {
 		s := NewDisableBreaker()
 		t.Run("with args fail", testErr(s, 6))
@@ -121,6 +136,23 @@ func TestBreaker(t *testing.T) {
 		12,
 	))
 
+	t.Run("latency breaker", test(
+		NewLatencyBreaker,
+		circuit.BreakerSettings{
+			Type:             circuit.HighLatency,
+			Latency:          500 * time.Millisecond,
+			Percentile:       99,
+			Window:           300,
+			Timeout:          time.Minute,
+			HalfOpenRequests: 12,
+		},
+		"500ms",
+		"p99",
+		300,
+		"1m",
+		12,
+	))
+
 	t.Run("disable breaker", test(
 		NewDisableBreaker,
 		circuit.BreakerSettings{
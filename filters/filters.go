@@ -314,6 +314,7 @@ const (
 	GrantCallbackName                          = "grantCallback"
 	GrantLogoutName                            = "grantLogout"
 	GrantClaimsQueryName                       = "grantClaimsQuery"
+	CSRFProtectName                            = "csrfProtect"
 	JwtValidationName                          = "jwtValidation"
 	JwtValidationKeysName                      = "jwtValidationKeys"
 	JwtMetricsName                             = "jwtMetrics"
@@ -328,6 +329,7 @@ const (
 	JsCookieName                               = "jsCookie"
 	ConsecutiveBreakerName                     = "consecutiveBreaker"
 	RateBreakerName                            = "rateBreaker"
+	LatencyBreakerName                         = "latencyBreaker"
 	DisableBreakerName                         = "disableBreaker"
 	AdmissionControlName                       = "admissionControl"
 	ClientRatelimitName                        = "clientRatelimit"
@@ -335,6 +337,8 @@ const (
 	ClusterClientRatelimitName                 = "clusterClientRatelimit"
 	ClusterRatelimitName                       = "clusterRatelimit"
 	ClusterLeakyBucketRatelimitName            = "clusterLeakyBucketRatelimit"
+	ClusterConcurrencyLimitName                = "clusterConcurrencyLimit"
+	ConcurrencyLimitName                       = "concurrencyLimit"
 	BackendRateLimitName                       = "backendRatelimit"
 	RatelimitFailClosedName                    = "ratelimitFailClosed"
 	LuaName                                    = "lua"
@@ -344,6 +348,7 @@ const (
 	DisableAccessLogName                       = "disableAccessLog"
 	MaskAccessLogQueryName                     = "maskAccessLogQuery"
 	EnableAccessLogName                        = "enableAccessLog"
+	SampleAccessLogName                        = "sampleAccessLog"
 	AuditLogName                               = "auditLog"
 	UnverifiedAuditLogName                     = "unverifiedAuditLog"
 	SetDynamicBackendHostFromHeader            = "setDynamicBackendHostFromHeader"
@@ -353,9 +358,16 @@ const (
 	SetDynamicBackendScheme                    = "setDynamicBackendScheme"
 	SetDynamicBackendUrl                       = "setDynamicBackendUrl"
 	ApiUsageMonitoringName                     = "apiUsageMonitoring"
+	OpenApiValidateName                        = "openApiValidate"
+	WAFName                                    = "waf"
+	GeoIPHeadersName                           = "geoipHeaders"
+	GraphQLLimitsName                          = "graphqlLimits"
+	CanaryName                                 = "canary"
+	CanaryBaselineName                         = "canaryBaseline"
 	FifoName                                   = "fifo"
 	FifoWithBodyName                           = "fifoWithBody"
 	LifoName                                   = "lifo"
+	AdaptiveConcurrencyName                    = "adaptiveConcurrency"
 	LifoGroupName                              = "lifoGroup"
 	RfcPathName                                = "rfcPath"
 	RfcHostName                                = "rfcHost"
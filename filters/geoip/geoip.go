@@ -0,0 +1,132 @@
+/*
+Package geoip implements the geoipHeaders filter, that adds the country,
+the continent and the autonomous system of the client to the request
+headers and to the access log, looked up in the GeoIP databases
+configured with -geoip-databases.
+
+The headers sent by the client with the same names are removed, so that
+the backends can trust them.
+
+Examples:
+
+	// sets X-Geoip-Country, X-Geoip-Continent, X-Geoip-Asn and
+	// X-Geoip-As-Organization
+	* -> geoipHeaders() -> "https://www.example.org";
+
+	// sets X-Client-Country etc.
+	* -> geoipHeaders("X-Client-") -> "https://www.example.org";
+*/
+package geoip
+
+import (
+	"net/http"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/accesslog"
+	"github.com/zalando/skipper/geoip"
+)
+
+const (
+	// DefaultHeaderPrefix is the prefix of the request headers, when
+	// the filter has no arguments.
+	DefaultHeaderPrefix = "X-Geoip-"
+
+	// AccessLogCountryKey is the key of the country in the access log.
+	AccessLogCountryKey = "geoip-country"
+
+	// AccessLogContinentKey is the key of the continent in the access
+	// log.
+	AccessLogContinentKey = "geoip-continent"
+
+	// AccessLogASNKey is the key of the autonomous system number in
+	// the access log.
+	AccessLogASNKey = "geoip-asn"
+)
+
+type spec struct {
+	db *geoip.Database
+}
+
+type filter struct {
+	db             *geoip.Database
+	country        string
+	continent      string
+	asn            string
+	asOrganization string
+}
+
+// NewHeaders creates the specification of the geoipHeaders filter,
+// using the database for the lookups.
+func NewHeaders(db *geoip.Database) filters.Spec {
+	return &spec{db: db}
+}
+
+func (*spec) Name() string { return filters.GeoIPHeadersName }
+
+func (s *spec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	prefix := DefaultHeaderPrefix
+	switch len(args) {
+	case 0:
+	case 1:
+		p, ok := args[0].(string)
+		if !ok || p == "" {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		prefix = p
+	default:
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	return &filter{
+		db:             s.db,
+		country:        http.CanonicalHeaderKey(prefix + "Country"),
+		continent:      http.CanonicalHeaderKey(prefix + "Continent"),
+		asn:            http.CanonicalHeaderKey(prefix + "Asn"),
+		asOrganization: http.CanonicalHeaderKey(prefix + "As-Organization"),
+	}, nil
+}
+
+func setOrDelete(h http.Header, name, value string) {
+	if value == "" {
+		h.Del(name)
+	} else {
+		h.Set(name, value)
+	}
+}
+
+func (f *filter) Request(ctx filters.FilterContext) {
+	req := ctx.Request()
+	rec := f.db.LookupRequest(req)
+	asn := rec.ASNString()
+
+	setOrDelete(req.Header, f.country, rec.Country)
+	setOrDelete(req.Header, f.continent, rec.Continent)
+	setOrDelete(req.Header, f.asn, asn)
+	setOrDelete(req.Header, f.asOrganization, rec.ASOrganization)
+
+	if rec == (geoip.Record{}) {
+		return
+	}
+
+	bag := ctx.StateBag()
+	additional, ok := bag[accesslog.AccessLogAdditionalDataKey].(map[string]interface{})
+	if !ok {
+		additional = make(map[string]interface{})
+		bag[accesslog.AccessLogAdditionalDataKey] = additional
+	}
+
+	if rec.Country != "" {
+		additional[AccessLogCountryKey] = rec.Country
+	}
+
+	if rec.Continent != "" {
+		additional[AccessLogContinentKey] = rec.Continent
+	}
+
+	if asn != "" {
+		additional[AccessLogASNKey] = asn
+	}
+}
+
+func (*filter) Response(filters.FilterContext) {}
@@ -0,0 +1,115 @@
+package geoip_test
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando/skipper/filters/accesslog"
+	"github.com/zalando/skipper/filters/filtertest"
+	geoipfilter "github.com/zalando/skipper/filters/geoip"
+	"github.com/zalando/skipper/geoip"
+	"github.com/zalando/skipper/geoip/geoiptest"
+)
+
+func testDatabase(t *testing.T) *geoip.Database {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	require.NoError(t, geoiptest.Database{
+		Networks: map[string]map[string]any{
+			"1.2.3.0/24": {
+				"country":                        map[string]any{"iso_code": "DE"},
+				"continent":                      map[string]any{"code": "EU"},
+				"autonomous_system_number":       uint32(3320),
+				"autonomous_system_organization": "Deutsche Telekom AG",
+			},
+			"5.6.7.0/24": {
+				"country": map[string]any{"iso_code": "AT"},
+			},
+		},
+	}.Write(path))
+
+	db, err := geoip.New(geoip.Options{Files: []string{path}, ClientIP: geoip.SourceFromLast})
+	require.NoError(t, err)
+	t.Cleanup(db.Close)
+	return db
+}
+
+func TestArgs(t *testing.T) {
+	s := geoipfilter.NewHeaders(nil)
+	for _, args := range [][]interface{}{
+		{""},
+		{42},
+		{"X-Geo-", "X-Other-"},
+	} {
+		if _, err := s.CreateFilter(args); err == nil {
+			t.Errorf("expected error for arguments: %v", args)
+		}
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	s := geoipfilter.NewHeaders(testDatabase(t))
+
+	t.Run("default prefix", func(t *testing.T) {
+		f, err := s.CreateFilter(nil)
+		require.NoError(t, err)
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Forwarded-For", "9.9.9.9, 1.2.3.4")
+		ctx := &filtertest.Context{FRequest: req, FStateBag: map[string]interface{}{
+			accesslog.AccessLogAdditionalDataKey: map[string]interface{}{"foo": "bar"},
+		}}
+
+		f.Request(ctx)
+
+		assert.Equal(t, "DE", req.Header.Get("X-Geoip-Country"))
+		assert.Equal(t, "EU", req.Header.Get("X-Geoip-Continent"))
+		assert.Equal(t, "3320", req.Header.Get("X-Geoip-Asn"))
+		assert.Equal(t, "Deutsche Telekom AG", req.Header.Get("X-Geoip-As-Organization"))
+		assert.Equal(t, map[string]interface{}{
+			"foo":                             "bar",
+			geoipfilter.AccessLogCountryKey:   "DE",
+			geoipfilter.AccessLogContinentKey: "EU",
+			geoipfilter.AccessLogASNKey:       "3320",
+		}, ctx.FStateBag[accesslog.AccessLogAdditionalDataKey])
+	})
+
+	t.Run("custom prefix and partial record", func(t *testing.T) {
+		f, err := s.CreateFilter([]interface{}{"X-Client-"})
+		require.NoError(t, err)
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Forwarded-For", "5.6.7.8")
+		req.Header.Set("X-Client-Asn", "15169")
+		ctx := &filtertest.Context{FRequest: req, FStateBag: make(map[string]interface{})}
+
+		f.Request(ctx)
+
+		assert.Equal(t, "AT", req.Header.Get("X-Client-Country"))
+		assert.NotContains(t, req.Header, "X-Client-Asn", "header sent by the client is removed")
+		assert.NotContains(t, req.Header, "X-Client-Continent")
+		assert.Equal(t, map[string]interface{}{
+			geoipfilter.AccessLogCountryKey: "AT",
+		}, ctx.FStateBag[accesslog.AccessLogAdditionalDataKey])
+	})
+
+	t.Run("unknown address", func(t *testing.T) {
+		f, err := s.CreateFilter(nil)
+		require.NoError(t, err)
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Forwarded-For", "9.9.9.9")
+		req.Header.Set("X-Geoip-Country", "US")
+		ctx := &filtertest.Context{FRequest: req, FStateBag: make(map[string]interface{})}
+
+		f.Request(ctx)
+
+		assert.NotContains(t, req.Header, "X-Geoip-Country")
+		assert.NotContains(t, ctx.FStateBag, accesslog.AccessLogAdditionalDataKey)
+	})
+}
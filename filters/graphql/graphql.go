@@ -0,0 +1,293 @@
+/*
+Package graphql implements the graphqlLimits filter, that rejects the
+GraphQL requests exceeding the configured maximum depth, number of
+aliases or complexity, and records the operations in the metrics and
+the access log.
+
+The depth is the nesting level of the selected fields, where the top
+level fields have depth 1. The complexity is the number of selected
+fields, where the subselections of the fields with a first, last or
+limit argument are counted as many times as the argument tells. The
+fragments are included in the measures. A limit of 0 disables the
+check.
+
+The requests, that are not valid GraphQL requests, are rejected, except
+for the GET requests without a query, e.g. for a GraphiQL page.
+
+Examples:
+
+	// rejects the queries deeper than 10, with more than 20 aliases, or
+	// more complex than 1000
+	graphql: Path("/graphql") -> graphqlLimits(10, 20, 1000) -> "https://api.example.org";
+
+	// only records the operations
+	graphql: Path("/graphql") -> graphqlLimits(0) -> "https://api.example.org";
+*/
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/accesslog"
+	"github.com/zalando/skipper/graphql"
+)
+
+const (
+	// AccessLogOperationKey is the key of the operation name in the
+	// access log.
+	AccessLogOperationKey = "graphql-operation"
+
+	// AccessLogOperationTypeKey is the key of the operation type in the
+	// access log.
+	AccessLogOperationTypeKey = "graphql-operation-type"
+
+	// DefaultMaxOperationMetrics is the default maximum number of the
+	// operation names, that are recorded in the metrics.
+	DefaultMaxOperationMetrics = 1000
+
+	metricCountAll          = "http_count"
+	metricCountUnknownClass = "httpxxx_count"
+	metricCount100s         = "http1xx_count"
+	metricCount200s         = "http2xx_count"
+	metricCount300s         = "http3xx_count"
+	metricCount400s         = "http4xx_count"
+	metricCount500s         = "http5xx_count"
+	metricLatency           = "latency"
+
+	anonymousPlaceholder    = "{anonymous}"
+	otherPlaceholder        = "{other}"
+	unknownRoutePlaceholder = "{unknown}"
+
+	stateBagKey = "filter." + filters.GraphQLLimitsName
+)
+
+// Options configures the graphqlLimits filter specification.
+type Options struct {
+	// MaxOperationMetrics is the maximum number of the operation names
+	// recorded in the metrics, counted across all the routes. As the
+	// operation names are chosen by the clients, the operations above
+	// the limit are recorded as {other}.
+	// Defaults to DefaultMaxOperationMetrics.
+	MaxOperationMetrics int
+}
+
+type spec struct {
+	options Options
+
+	mu      sync.Mutex
+	metrics map[string]*metricNames
+}
+
+type filter struct {
+	spec          *spec
+	maxDepth      int
+	maxAliases    int
+	maxComplexity int
+}
+
+type metricNames struct {
+	countAll                string
+	countPerStatusCodeRange [6]string
+	latency                 string
+}
+
+type stateBag struct {
+	metrics *metricNames
+	begin   time.Time
+}
+
+type graphqlError struct {
+	Message string `json:"message"`
+}
+
+type errorResponse struct {
+	Errors []graphqlError `json:"errors"`
+}
+
+// NewLimits creates the specification of the graphqlLimits filter.
+func NewLimits() filters.Spec {
+	return NewLimitsWithOptions(Options{})
+}
+
+// NewLimitsWithOptions creates the specification of the graphqlLimits
+// filter with the options.
+func NewLimitsWithOptions(o Options) filters.Spec {
+	if o.MaxOperationMetrics <= 0 {
+		o.MaxOperationMetrics = DefaultMaxOperationMetrics
+	}
+
+	return &spec{options: o, metrics: make(map[string]*metricNames)}
+}
+
+func (*spec) Name() string { return filters.GraphQLLimitsName }
+
+func limitArg(a interface{}) (int, error) {
+	var v int
+	switch n := a.(type) {
+	case int:
+		v = n
+	case float64:
+		v = int(n)
+		if float64(v) != n {
+			return 0, filters.ErrInvalidFilterParameters
+		}
+	default:
+		return 0, filters.ErrInvalidFilterParameters
+	}
+
+	if v < 0 {
+		return 0, filters.ErrInvalidFilterParameters
+	}
+
+	return v, nil
+}
+
+func (s *spec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) < 1 || len(args) > 3 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	var limits [3]int
+	for i, a := range args {
+		l, err := limitArg(a)
+		if err != nil {
+			return nil, err
+		}
+
+		limits[i] = l
+	}
+
+	return &filter{
+		spec:          s,
+		maxDepth:      limits[0],
+		maxAliases:    limits[1],
+		maxComplexity: limits[2],
+	}, nil
+}
+
+// metricNames returns the names of the metrics of the operation,
+// prefixed by the route ID. The names are cached, and the operations
+// above the maximum number are recorded as {other}.
+func (s *spec) metricNames(routeID, operationType, name string) *metricNames {
+	if routeID == "" {
+		routeID = unknownRoutePlaceholder
+	}
+
+	if name == "" {
+		name = anonymousPlaceholder
+	}
+
+	key := routeID + "." + operationType + "." + name
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if m, ok := s.metrics[key]; ok {
+		return m
+	}
+
+	if len(s.metrics) >= s.options.MaxOperationMetrics {
+		key = routeID + "." + operationType + "." + otherPlaceholder
+		if m, ok := s.metrics[key]; ok {
+			return m
+		}
+	}
+
+	prefix := key + "."
+	m := &metricNames{
+		countAll: prefix + metricCountAll,
+		countPerStatusCodeRange: [6]string{
+			prefix + metricCountUnknownClass,
+			prefix + metricCount100s,
+			prefix + metricCount200s,
+			prefix + metricCount300s,
+			prefix + metricCount400s,
+			prefix + metricCount500s,
+		},
+		latency: prefix + metricLatency,
+	}
+
+	s.metrics[key] = m
+	return m
+}
+
+func reject(ctx filters.FilterContext, status int, message string) {
+	b, _ := json.Marshal(errorResponse{Errors: []graphqlError{{Message: message}}})
+	ctx.Serve(&http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(b)),
+	})
+}
+
+func (f *filter) Request(ctx filters.FilterContext) {
+	r := ctx.Request()
+	req, err := graphql.ParseRequest(r, graphql.DefaultMaxBodySize)
+	switch {
+	case errors.Is(err, graphql.ErrNotGraphQL) && r.Method == http.MethodGet:
+		return
+	case errors.Is(err, graphql.ErrBodyTooLarge):
+		reject(ctx, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	case err != nil:
+		reject(ctx, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx.StateBag()[stateBagKey] = &stateBag{
+		metrics: f.spec.metricNames(ctx.RouteId(), req.OperationType(), req.Name()),
+		begin:   time.Now(),
+	}
+
+	bag := ctx.StateBag()
+	additional, ok := bag[accesslog.AccessLogAdditionalDataKey].(map[string]interface{})
+	if !ok {
+		additional = make(map[string]interface{})
+		bag[accesslog.AccessLogAdditionalDataKey] = additional
+	}
+
+	additional[AccessLogOperationTypeKey] = req.OperationType()
+	if name := req.Name(); name != "" {
+		additional[AccessLogOperationKey] = name
+	}
+
+	a := req.Analyze()
+	switch {
+	case f.maxDepth > 0 && a.Depth > f.maxDepth:
+		reject(ctx, http.StatusBadRequest, fmt.Sprintf("query depth %d exceeds the limit of %d", a.Depth, f.maxDepth))
+	case f.maxAliases > 0 && a.Aliases > f.maxAliases:
+		reject(ctx, http.StatusBadRequest, fmt.Sprintf("number of aliases %d exceeds the limit of %d", a.Aliases, f.maxAliases))
+	case f.maxComplexity > 0 && a.Complexity > f.maxComplexity:
+		reject(ctx, http.StatusBadRequest, fmt.Sprintf("query complexity %d exceeds the limit of %d", a.Complexity, f.maxComplexity))
+	}
+}
+
+// HandleErrorResponse is to opt-in for filters to get called
+// Response(ctx) in case of errors via proxy. It has to return true to
+// opt-in.
+func (*filter) HandleErrorResponse() bool { return true }
+
+func (*filter) Response(ctx filters.FilterContext) {
+	sb, ok := ctx.StateBag()[stateBagKey].(*stateBag)
+	if !ok {
+		return
+	}
+
+	class := ctx.Response().StatusCode / 100
+	if class < 1 || class > 5 {
+		class = 0
+	}
+
+	m := ctx.Metrics()
+	m.IncCounter(sb.metrics.countAll)
+	m.IncCounter(sb.metrics.countPerStatusCodeRange[class])
+	m.MeasureSince(sb.metrics.latency, sb.begin)
+}
@@ -0,0 +1,236 @@
+package graphql
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando/skipper/filters/accesslog"
+	"github.com/zalando/skipper/filters/filtertest"
+	"github.com/zalando/skipper/metrics/metricstest"
+)
+
+func newContext(method, body string) (*filtertest.Context, *metricstest.MockMetrics) {
+	r := httptest.NewRequest(method, "/graphql", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	m := &metricstest.MockMetrics{}
+	return &filtertest.Context{
+		FRequest:  r,
+		FStateBag: make(map[string]interface{}),
+		FMetrics:  m,
+		FRouteId:  "graphql",
+	}, m
+}
+
+func TestArgs(t *testing.T) {
+	for _, args := range [][]interface{}{
+		nil,
+		{-1},
+		{1.5},
+		{"10"},
+		{1, 2, 3, 4},
+	} {
+		if _, err := NewLimits().CreateFilter(args); err == nil {
+			t.Errorf("expected error for arguments: %v", args)
+		}
+	}
+
+	for _, args := range [][]interface{}{
+		{0},
+		{10.0, 5},
+		{10, 5, 1000},
+	} {
+		if _, err := NewLimits().CreateFilter(args); err != nil {
+			t.Errorf("unexpected error for arguments %v: %v", args, err)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		args    []interface{}
+		method  string
+		body    string
+		status  int
+		message string
+	}{{
+		name:   "within the limits",
+		args:   []interface{}{3, 1, 10},
+		method: "POST",
+		body:   `{"query": "{ a: user { friends { id } } }"}`,
+	}, {
+		name:    "too deep",
+		args:    []interface{}{2},
+		method:  "POST",
+		body:    `{"query": "{ user { friends { id } } }"}`,
+		status:  http.StatusBadRequest,
+		message: "query depth 3 exceeds the limit of 2",
+	}, {
+		name:    "too many aliases",
+		args:    []interface{}{0, 1},
+		method:  "POST",
+		body:    `{"query": "{ a: user { id } b: user { id } }"}`,
+		status:  http.StatusBadRequest,
+		message: "number of aliases 2 exceeds the limit of 1",
+	}, {
+		name:    "too complex",
+		args:    []interface{}{0, 0, 100},
+		method:  "POST",
+		body:    `{"query": "{ users(first: 100) { id } }"}`,
+		status:  http.StatusBadRequest,
+		message: "query complexity 101 exceeds the limit of 100",
+	}, {
+		name:   "invalid query",
+		args:   []interface{}{0},
+		method: "POST",
+		body:   `{"query": "{ user "}`,
+		status: http.StatusBadRequest,
+	}, {
+		name:   "not a GraphQL request",
+		args:   []interface{}{0},
+		method: "POST",
+		body:   `{}`,
+		status: http.StatusBadRequest,
+	}, {
+		name:   "GET without query",
+		args:   []interface{}{0},
+		method: "GET",
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewLimits().CreateFilter(tt.args)
+			require.NoError(t, err)
+
+			ctx, _ := newContext(tt.method, tt.body)
+			f.Request(ctx)
+
+			if tt.status == 0 {
+				assert.False(t, ctx.FServed)
+				return
+			}
+
+			require.True(t, ctx.FServed)
+			assert.Equal(t, tt.status, ctx.FResponse.StatusCode)
+			assert.Equal(t, "application/json", ctx.FResponse.Header.Get("Content-Type"))
+
+			var body errorResponse
+			require.NoError(t, json.NewDecoder(ctx.FResponse.Body).Decode(&body))
+			require.Len(t, body.Errors, 1)
+			if tt.message != "" {
+				assert.Equal(t, tt.message, body.Errors[0].Message)
+			}
+		})
+	}
+}
+
+func TestBodyTooLarge(t *testing.T) {
+	f, err := NewLimits().CreateFilter([]interface{}{0})
+	require.NoError(t, err)
+
+	ctx, _ := newContext("POST", `{"query": "{ a }", "x": "`+strings.Repeat("x", 2<<20)+`"}`)
+	f.Request(ctx)
+
+	require.True(t, ctx.FServed)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, ctx.FResponse.StatusCode)
+}
+
+func TestMetricsAndAccessLog(t *testing.T) {
+	f, err := NewLimits().CreateFilter([]interface{}{1})
+	require.NoError(t, err)
+
+	for _, tt := range []struct {
+		body       string
+		routeID    string
+		status     int
+		prefix     string
+		additional map[string]interface{}
+	}{{
+		body:    `{"query": "query GetUser { user }"}`,
+		routeID: "graphql",
+		status:  http.StatusOK,
+		prefix:  "graphql.query.GetUser.",
+		additional: map[string]interface{}{
+			AccessLogOperationKey:     "GetUser",
+			AccessLogOperationTypeKey: "query",
+		},
+	}, {
+		body:    `{"query": "mutation { addUser { id } }"}`,
+		routeID: "graphql",
+		status:  http.StatusBadRequest,
+		prefix:  "graphql.mutation.{anonymous}.",
+		additional: map[string]interface{}{
+			AccessLogOperationTypeKey: "mutation",
+		},
+	}, {
+		body:   `{"query": "query GetUser { user }"}`,
+		status: http.StatusOK,
+		prefix: "{unknown}.query.GetUser.",
+		additional: map[string]interface{}{
+			AccessLogOperationKey:     "GetUser",
+			AccessLogOperationTypeKey: "query",
+		},
+	}} {
+		ctx, m := newContext("POST", tt.body)
+		ctx.FRouteId = tt.routeID
+		f.Request(ctx)
+
+		if !ctx.FServed {
+			ctx.FResponse = &http.Response{StatusCode: tt.status}
+		}
+
+		f.Response(ctx)
+
+		assert.Equal(t, tt.additional, ctx.FStateBag[accesslog.AccessLogAdditionalDataKey])
+		m.WithCounters(func(counters map[string]int64) {
+			assert.Equal(t, map[string]int64{
+				tt.prefix + "http_count":                                 1,
+				tt.prefix + fmt.Sprintf("http%dxx_count", tt.status/100): 1,
+			}, counters)
+		})
+		m.WithMeasures(func(measures map[string][]time.Duration) {
+			assert.Len(t, measures[tt.prefix+"latency"], 1)
+		})
+	}
+}
+
+func TestMaxOperationMetrics(t *testing.T) {
+	f, err := NewLimitsWithOptions(Options{MaxOperationMetrics: 2}).CreateFilter([]interface{}{0})
+	require.NoError(t, err)
+
+	m := &metricstest.MockMetrics{}
+	for _, name := range []string{"A", "B", "C", "D", "A"} {
+		ctx, _ := newContext("POST", `{"query": "query `+name+` { a }"}`)
+		ctx.FMetrics = m
+		f.Request(ctx)
+		ctx.FResponse = &http.Response{StatusCode: http.StatusOK}
+		f.Response(ctx)
+	}
+
+	m.WithCounters(func(counters map[string]int64) {
+		assert.Equal(t, int64(2), counters["graphql.query.A.http_count"])
+		assert.Equal(t, int64(1), counters["graphql.query.B.http_count"])
+		assert.Equal(t, int64(2), counters["graphql.query.{other}.http_count"])
+		assert.NotContains(t, counters, "graphql.query.C.http_count")
+	})
+}
+
+func TestResponseWithoutRequest(t *testing.T) {
+	f, err := NewLimits().CreateFilter([]interface{}{0})
+	require.NoError(t, err)
+
+	ctx, m := newContext("GET", "")
+	f.Request(ctx)
+	ctx.FResponse = &http.Response{StatusCode: http.StatusOK}
+	f.Response(ctx)
+
+	m.WithCounters(func(counters map[string]int64) {
+		assert.Empty(t, counters)
+	})
+}
@@ -0,0 +1,37 @@
+/*
+Package openapi provides the openApiValidate filter, that validates the
+requests against an OpenAPI 3 document, before they reach the backend.
+
+The filter matches the request to an operation of the document by its
+path and method, and validates the path, query, header and cookie
+parameters, and the JSON request body against their schemas. The paths
+of the servers of the document are accepted as prefixes of the request
+path. Requests that don't conform to the document are answered with a
+problem response, listing the violations:
+
+	HTTP/1.1 400 Bad Request
+	Content-Type: application/problem+json
+
+	{
+	  "title": "Bad Request",
+	  "status": 400,
+	  "operationId": "listPets",
+	  "violations": [
+	    {"in": "query", "name": "limit", "message": "invalid integer: \"ten\""}
+	  ]
+	}
+
+Requests not matching any path of the document are rejected with 404,
+and requests with a method not defined for the path with 405.
+
+With the optional validateResponses argument, the JSON responses are
+validated, too, and the violations are logged, without changing the
+response:
+
+	openApiValidate("/etc/skipper/openapi/pets.yaml", "validateResponses")
+
+The documents are loaded once, and shared between all the routes
+referencing the same file. They are loaded again, when the routes are
+updated after the file was modified.
+*/
+package openapi
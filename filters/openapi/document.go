@@ -0,0 +1,523 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xeipuuv/gojsonschema"
+	"sigs.k8s.io/yaml"
+)
+
+// the raw structure of the used parts of an OpenAPI 3 document
+type rawDocument struct {
+	OpenAPI    string                                `json:"openapi"`
+	Servers    []rawServer                           `json:"servers"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components rawComponents                         `json:"components"`
+}
+
+type rawServer struct {
+	URL string `json:"url"`
+}
+
+type rawComponents struct {
+	Schemas       map[string]any          `json:"schemas"`
+	Parameters    map[string]rawParameter `json:"parameters"`
+	RequestBodies map[string]rawBody      `json:"requestBodies"`
+	Responses     map[string]rawBody      `json:"responses"`
+}
+
+type rawParameter struct {
+	Ref      string         `json:"$ref"`
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required"`
+	Explode  *bool          `json:"explode"`
+	Schema   map[string]any `json:"schema"`
+}
+
+type rawBody struct {
+	Ref      string                  `json:"$ref"`
+	Required bool                    `json:"required"`
+	Content  map[string]rawMediaType `json:"content"`
+}
+
+type rawMediaType struct {
+	Schema map[string]any `json:"schema"`
+}
+
+type rawOperation struct {
+	OperationID string             `json:"operationId"`
+	Parameters  []rawParameter     `json:"parameters"`
+	RequestBody *rawBody           `json:"requestBody"`
+	Responses   map[string]rawBody `json:"responses"`
+}
+
+// document is an OpenAPI document compiled for validation.
+type document struct {
+	file     string
+	modified time.Time
+	prefixes []string
+	paths    []*pathTemplate
+}
+
+type pathTemplate struct {
+	template   string
+	segments   []string
+	literals   int
+	operations map[string]*operation
+}
+
+type operation struct {
+	id          string
+	method      string
+	path        *pathTemplate
+	parameters  []*parameter
+	body        *body
+	responses   map[string]*body
+	hasResponse bool
+}
+
+type parameter struct {
+	name     string
+	in       string
+	required bool
+	explode  bool
+	typ      string
+	itemType string
+	schema   *gojsonschema.Schema
+}
+
+type body struct {
+	required bool
+	content  map[string]*gojsonschema.Schema
+}
+
+var methods = []string{
+	http.MethodGet,
+	http.MethodPut,
+	http.MethodPost,
+	http.MethodDelete,
+	http.MethodOptions,
+	http.MethodHead,
+	http.MethodPatch,
+	http.MethodTrace,
+}
+
+func loadDocument(file string) (*document, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is a subset of YAML, the conversion handles both
+	jb, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+
+	var raw rawDocument
+	if err := json.Unmarshal(jb, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+
+	if !strings.HasPrefix(raw.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported OpenAPI version in %s: %q", file, raw.OpenAPI)
+	}
+
+	d := &document{file: file, modified: info.ModTime()}
+	for _, s := range raw.Servers {
+		u, err := url.Parse(s.URL)
+		if err != nil {
+			continue
+		}
+
+		if p := strings.TrimSuffix(u.Path, "/"); p != "" {
+			d.prefixes = append(d.prefixes, p)
+		}
+	}
+
+	c := &compiler{components: &raw.Components}
+	for template, item := range raw.Paths {
+		pt, err := c.compilePath(template, item)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile %s: path %s: %w", file, template, err)
+		}
+
+		d.paths = append(d.paths, pt)
+	}
+
+	// the templates with more literal segments take precedence, e.g.
+	// /users/me over /users/{id}
+	sort.SliceStable(d.paths, func(i, j int) bool {
+		if d.paths[i].literals != d.paths[j].literals {
+			return d.paths[i].literals > d.paths[j].literals
+		}
+
+		return d.paths[i].template < d.paths[j].template
+	})
+
+	return d, nil
+}
+
+type compiler struct {
+	components *rawComponents
+}
+
+func (c *compiler) compilePath(template string, item map[string]json.RawMessage) (*pathTemplate, error) {
+	pt := &pathTemplate{
+		template:   template,
+		segments:   strings.Split(strings.Trim(template, "/"), "/"),
+		operations: make(map[string]*operation),
+	}
+
+	for _, s := range pt.segments {
+		if !isTemplateParam(s) {
+			pt.literals++
+		}
+	}
+
+	var common []rawParameter
+	if p, ok := item["parameters"]; ok {
+		if err := json.Unmarshal(p, &common); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, m := range methods {
+		rawOp, ok := item[strings.ToLower(m)]
+		if !ok {
+			continue
+		}
+
+		var ro rawOperation
+		if err := json.Unmarshal(rawOp, &ro); err != nil {
+			return nil, err
+		}
+
+		op, err := c.compileOperation(m, pt, common, &ro)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", m, err)
+		}
+
+		pt.operations[m] = op
+	}
+
+	return pt, nil
+}
+
+func (c *compiler) compileOperation(method string, pt *pathTemplate, common []rawParameter, ro *rawOperation) (*operation, error) {
+	op := &operation{
+		id:        ro.OperationID,
+		method:    method,
+		path:      pt,
+		responses: make(map[string]*body),
+	}
+
+	// the operation parameters override the path item parameters with
+	// the same name and location
+	params := make(map[string]*parameter)
+	var order []string
+	for _, rp := range slices.Concat(common, ro.Parameters) {
+		p, err := c.compileParameter(rp)
+		if err != nil {
+			return nil, err
+		}
+
+		key := p.in + ":" + p.name
+		if _, ok := params[key]; !ok {
+			order = append(order, key)
+		}
+
+		params[key] = p
+	}
+
+	for _, key := range order {
+		op.parameters = append(op.parameters, params[key])
+	}
+
+	if ro.RequestBody != nil {
+		b, err := c.compileBody(*ro.RequestBody, "requestBodies")
+		if err != nil {
+			return nil, fmt.Errorf("request body: %w", err)
+		}
+
+		op.body = b
+	}
+
+	for status, rr := range ro.Responses {
+		b, err := c.compileBody(rr, "responses")
+		if err != nil {
+			return nil, fmt.Errorf("response %s: %w", status, err)
+		}
+
+		op.responses[strings.ToUpper(status)] = b
+		op.hasResponse = op.hasResponse || len(b.content) > 0
+	}
+
+	return op, nil
+}
+
+func componentName(ref, kind string) (string, error) {
+	prefix := "#/components/" + kind + "/"
+	if !strings.HasPrefix(ref, prefix) {
+		return "", fmt.Errorf("unsupported reference: %s", ref)
+	}
+
+	return strings.TrimPrefix(ref, prefix), nil
+}
+
+func (c *compiler) compileParameter(rp rawParameter) (*parameter, error) {
+	if rp.Ref != "" {
+		name, err := componentName(rp.Ref, "parameters")
+		if err != nil {
+			return nil, err
+		}
+
+		ref := rp.Ref
+		var ok bool
+		if rp, ok = c.components.Parameters[name]; !ok {
+			return nil, fmt.Errorf("parameter not found: %s", ref)
+		}
+	}
+
+	p := &parameter{
+		name:     rp.Name,
+		in:       rp.In,
+		required: rp.Required || rp.In == "path",
+		explode:  rp.Explode == nil || *rp.Explode,
+	}
+
+	if p.in == "header" {
+		p.name = http.CanonicalHeaderKey(p.name)
+	}
+
+	if rp.Schema == nil {
+		return p, nil
+	}
+
+	resolved := c.resolveSchema(rp.Schema)
+	p.typ, _ = resolved["type"].(string)
+	if items, ok := resolved["items"].(map[string]any); ok {
+		p.itemType, _ = c.resolveSchema(items)["type"].(string)
+	}
+
+	s, err := c.compileSchema(rp.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("parameter %s: %w", rp.Name, err)
+	}
+
+	p.schema = s
+	return p, nil
+}
+
+func (c *compiler) compileBody(rb rawBody, kind string) (*body, error) {
+	if rb.Ref != "" {
+		name, err := componentName(rb.Ref, kind)
+		if err != nil {
+			return nil, err
+		}
+
+		ref := rb.Ref
+		var ok bool
+		if rb, ok = c.getBody(kind, name); !ok {
+			return nil, fmt.Errorf("%s not found: %s", kind, ref)
+		}
+	}
+
+	b := &body{required: rb.Required, content: make(map[string]*gojsonschema.Schema)}
+	for mt, m := range rb.Content {
+		mt = strings.ToLower(mt)
+		if m.Schema == nil || !isJSON(mt) {
+			b.content[mt] = nil
+			continue
+		}
+
+		s, err := c.compileSchema(m.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", mt, err)
+		}
+
+		b.content[mt] = s
+	}
+
+	return b, nil
+}
+
+func (c *compiler) getBody(kind, name string) (rawBody, bool) {
+	var b rawBody
+	var ok bool
+	switch kind {
+	case "requestBodies":
+		b, ok = c.components.RequestBodies[name]
+	case "responses":
+		b, ok = c.components.Responses[name]
+	}
+
+	return b, ok
+}
+
+// resolveSchema follows the references of a schema to the component
+// schemas, to find the type of the parameters.
+func (c *compiler) resolveSchema(s map[string]any) map[string]any {
+	for range 32 {
+		ref, ok := s["$ref"].(string)
+		if !ok {
+			return s
+		}
+
+		name, err := componentName(ref, "schemas")
+		if err != nil {
+			return s
+		}
+
+		next, ok := c.components.Schemas[name].(map[string]any)
+		if !ok {
+			return s
+		}
+
+		s = next
+	}
+
+	return s
+}
+
+// compileSchema compiles an OpenAPI schema object as JSON schema. The
+// component schemas are added to the compiled document, so that the
+// local references resolve.
+func (c *compiler) compileSchema(s map[string]any) (*gojsonschema.Schema, error) {
+	doc := convertSchema(s).(map[string]any)
+	if len(c.components.Schemas) > 0 {
+		doc["components"] = map[string]any{"schemas": convertSchema(c.components.Schemas)}
+	}
+
+	return gojsonschema.NewSchema(gojsonschema.NewGoLoader(doc))
+}
+
+// convertSchema copies a schema, and converts the OpenAPI 3.0 nullable
+// keyword to its JSON schema equivalent.
+func convertSchema(v any) any {
+	switch vt := v.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(vt))
+		for k, vi := range vt {
+			c[k] = convertSchema(vi)
+		}
+
+		if nullable, _ := c["nullable"].(bool); nullable {
+			delete(c, "nullable")
+			if t, ok := c["type"].(string); ok {
+				c["type"] = []any{t, "null"}
+			}
+		}
+
+		return c
+	case []any:
+		c := make([]any, len(vt))
+		for i, vi := range vt {
+			c[i] = convertSchema(vi)
+		}
+
+		return c
+	default:
+		return v
+	}
+}
+
+func isTemplateParam(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// match returns the path template matching the escaped request path,
+// and the values of the path parameters.
+func (d *document) match(escapedPath string) (*pathTemplate, map[string]string) {
+	// the escaped path is split first, so that the escaped slashes
+	// don't separate the segments, and each segment is unescaped once
+	segments := strings.Split(strings.Trim(escapedPath, "/"), "/")
+	for i, s := range segments {
+		v, err := url.PathUnescape(s)
+		if err != nil {
+			return nil, nil
+		}
+
+		segments[i] = v
+	}
+
+	candidates := [][]string{segments}
+	for _, p := range d.prefixes {
+		prefix := strings.Split(strings.Trim(p, "/"), "/")
+		if len(prefix) <= len(segments) && slices.Equal(segments[:len(prefix)], prefix) {
+			rest := segments[len(prefix):]
+			if len(rest) == 0 {
+				rest = []string{""}
+			}
+
+			candidates = append(candidates, rest)
+		}
+	}
+
+	for _, c := range candidates {
+		for _, pt := range d.paths {
+			if params, ok := pt.match(c); ok {
+				return pt, params
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+func (pt *pathTemplate) match(segments []string) (map[string]string, bool) {
+	if len(segments) != len(pt.segments) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, s := range pt.segments {
+		if isTemplateParam(s) {
+			if segments[i] == "" {
+				return nil, false
+			}
+
+			params[s[1:len(s)-1]] = segments[i]
+			continue
+		}
+
+		if s != segments[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+// response returns the response definition of a status code, looking
+// up the exact code, the range, e.g. 2XX, and the default response.
+func (op *operation) response(status int) *body {
+	code := fmt.Sprint(status)
+	if b, ok := op.responses[code]; ok {
+		return b
+	}
+
+	if b, ok := op.responses[code[:1]+"XX"]; ok {
+		return b
+	}
+
+	return op.responses["DEFAULT"]
+}
@@ -0,0 +1,409 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xeipuuv/gojsonschema"
+
+	"github.com/zalando/skipper/filters"
+	snet "github.com/zalando/skipper/net"
+)
+
+const (
+	// ValidateResponses enables logging the responses, that don't
+	// conform to the OpenAPI document.
+	ValidateResponses = "validateResponses"
+
+	// DefaultMaxBodySize is the maximum size of the request and
+	// response bodies, that are validated.
+	DefaultMaxBodySize = 1 << 20
+
+	operationStateBagKey = "filter." + filters.OpenApiValidateName + ".operation"
+)
+
+// Violation is a single reason, why a request doesn't conform to the
+// OpenAPI document.
+type Violation struct {
+	In      string `json:"in"`
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message"`
+}
+
+type problem struct {
+	Title      string      `json:"title"`
+	Status     int         `json:"status"`
+	Operation  string      `json:"operationId,omitempty"`
+	Violations []Violation `json:"violations"`
+}
+
+type spec struct {
+	mu        sync.Mutex
+	documents map[string]*document
+}
+
+type filter struct {
+	document          *document
+	validateResponses bool
+}
+
+// NewOpenApiValidate creates the filter specification of
+// openApiValidate. The OpenAPI documents are loaded once, and shared by
+// all the routes referencing them, until the file is modified.
+func NewOpenApiValidate() filters.Spec {
+	return &spec{documents: make(map[string]*document)}
+}
+
+func (*spec) Name() string { return filters.OpenApiValidateName }
+
+func (s *spec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	file, ok := args[0].(string)
+	if !ok || file == "" {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f := &filter{}
+	if len(args) == 2 {
+		if opt, ok := args[1].(string); !ok || opt != ValidateResponses {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		f.validateResponses = true
+	}
+
+	d, err := s.load(file)
+	if err != nil {
+		return nil, err
+	}
+
+	f.document = d
+	return f, nil
+}
+
+// load returns the cached document, or loads it when it was not loaded
+// yet or the file was modified since.
+func (s *spec) load(file string) (*document, error) {
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if d, ok := s.documents[file]; ok && d.modified.Equal(info.ModTime()) {
+		return d, nil
+	}
+
+	d, err := loadDocument(file)
+	if err != nil {
+		return nil, err
+	}
+
+	s.documents[file] = d
+	return d, nil
+}
+
+func (f *filter) Request(ctx filters.FilterContext) {
+	req := ctx.Request()
+	pt, pathParams := f.document.match(req.URL.EscapedPath())
+	if pt == nil {
+		serveProblem(ctx, http.StatusNotFound, "", []Violation{{In: "path", Message: "no operation found for the path"}})
+		return
+	}
+
+	op, ok := pt.operations[req.Method]
+	if !ok {
+		serveProblem(ctx, http.StatusMethodNotAllowed, "", []Violation{{In: "method", Message: fmt.Sprintf("method %s not allowed for %s", req.Method, pt.template)}})
+		return
+	}
+
+	violations := validateParameters(op, req, pathParams)
+	bodyViolations, tooLarge := validateRequestBody(op, req)
+	violations = append(violations, bodyViolations...)
+	switch {
+	case tooLarge:
+		serveProblem(ctx, http.StatusRequestEntityTooLarge, op.id, violations)
+	case len(violations) > 0:
+		serveProblem(ctx, http.StatusBadRequest, op.id, violations)
+	case f.validateResponses && op.hasResponse:
+		ctx.StateBag()[operationStateBagKey] = op
+	}
+}
+
+func (f *filter) Response(ctx filters.FilterContext) {
+	op, ok := ctx.StateBag()[operationStateBagKey].(*operation)
+	if !ok {
+		return
+	}
+
+	rsp := ctx.Response()
+	b := op.response(rsp.StatusCode)
+	if b == nil {
+		ctx.Logger().Warnf("%s: response status %d is not defined for operation %s", filters.OpenApiValidateName, rsp.StatusCode, op.name())
+		return
+	}
+
+	// the response is only validated and logged, not changed
+	var body []byte
+	body, rsp.Body = readBody(rsp.Body)
+	if body == nil {
+		return
+	}
+
+	for _, v := range validateBody(b, rsp.Header.Get("Content-Type"), body, "response") {
+		msg := v.Message
+		if v.Name != "" {
+			msg = v.Name + ": " + msg
+		}
+
+		ctx.Logger().Warnf("%s: invalid response of operation %s: %s", filters.OpenApiValidateName, op.name(), msg)
+	}
+}
+
+func (op *operation) name() string {
+	if op.id != "" {
+		return op.id
+	}
+
+	return op.method + " " + op.path.template
+}
+
+func serveProblem(ctx filters.FilterContext, status int, operationID string, violations []Violation) {
+	b, _ := json.Marshal(problem{
+		Title:      http.StatusText(status),
+		Status:     status,
+		Operation:  operationID,
+		Violations: violations,
+	})
+
+	ctx.Serve(&http.Response{
+		StatusCode:    status,
+		Header:        http.Header{"Content-Type": []string{"application/problem+json"}},
+		ContentLength: int64(len(b)),
+		Body:          io.NopCloser(bytes.NewReader(b)),
+	})
+}
+
+func validateParameters(op *operation, req *http.Request, pathParams map[string]string) []Violation {
+	var (
+		violations []Violation
+		query      = req.URL.Query()
+	)
+
+	for _, p := range op.parameters {
+		var values []string
+		switch p.in {
+		case "path":
+			if v, ok := pathParams[p.name]; ok {
+				values = []string{v}
+			}
+		case "query":
+			values = query[p.name]
+		case "header":
+			values = req.Header.Values(p.name)
+		case "cookie":
+			if c, err := req.Cookie(p.name); err == nil {
+				values = []string{c.Value}
+			}
+		default:
+			continue
+		}
+
+		if len(values) == 0 {
+			if p.required {
+				violations = append(violations, Violation{In: p.in, Name: p.name, Message: "required parameter is missing"})
+			}
+
+			continue
+		}
+
+		if p.schema == nil {
+			continue
+		}
+
+		v, err := p.coerce(values)
+		if err != nil {
+			violations = append(violations, Violation{In: p.in, Name: p.name, Message: err.Error()})
+			continue
+		}
+
+		violations = append(violations, validateSchema(p.schema, gojsonschema.NewGoLoader(v), p.in, p.name)...)
+	}
+
+	return violations
+}
+
+// coerce converts the string values of a parameter to the type of its
+// schema.
+func (p *parameter) coerce(values []string) (any, error) {
+	if p.typ != "array" {
+		return coerceValue(p.typ, values[0])
+	}
+
+	if len(values) == 1 && (!p.explode || p.in != "query") {
+		values = strings.Split(values[0], ",")
+	}
+
+	a := make([]any, 0, len(values))
+	for _, s := range values {
+		v, err := coerceValue(p.itemType, s)
+		if err != nil {
+			return nil, err
+		}
+
+		a = append(a, v)
+	}
+
+	return a, nil
+}
+
+func coerceValue(typ, s string) (any, error) {
+	switch typ {
+	case "integer":
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer: %q", s)
+		}
+
+		return i, nil
+	case "number":
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number: %q", s)
+		}
+
+		return f, nil
+	case "boolean":
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid boolean: %q", s)
+		}
+
+		return b, nil
+	default:
+		return s, nil
+	}
+}
+
+// readBody reads a body up to DefaultMaxBodySize, and returns a body
+// that reads the same content again. The returned content is nil, if
+// the body is larger.
+func readBody(r io.ReadCloser) ([]byte, io.ReadCloser) {
+	b, body, complete := snet.PeekBody(r, DefaultMaxBodySize)
+	if !complete {
+		return nil, body
+	}
+
+	if b == nil {
+		b = []byte{}
+	}
+
+	return b, body
+}
+
+func validateRequestBody(op *operation, req *http.Request) ([]Violation, bool) {
+	if op.body == nil {
+		return nil, false
+	}
+
+	var body []byte
+	body, req.Body = readBody(req.Body)
+	if body == nil {
+		return []Violation{{In: "body", Message: fmt.Sprintf("body is larger than %d bytes", DefaultMaxBodySize)}}, true
+	}
+
+	if len(body) == 0 {
+		if op.body.required {
+			return []Violation{{In: "body", Message: "required body is missing"}}, false
+		}
+
+		return nil, false
+	}
+
+	return validateBody(op.body, req.Header.Get("Content-Type"), body, "body"), false
+}
+
+func validateBody(b *body, contentType string, content []byte, in string) []Violation {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return []Violation{{In: in, Message: fmt.Sprintf("invalid content type: %q", contentType)}}
+	}
+
+	s, ok := findContent(b, mediaType)
+	if !ok {
+		return []Violation{{In: in, Message: fmt.Sprintf("unsupported content type: %q", mediaType)}}
+	}
+
+	if s == nil {
+		return nil
+	}
+
+	if !json.Valid(content) {
+		return []Violation{{In: in, Message: "invalid JSON"}}
+	}
+
+	return validateSchema(s, gojsonschema.NewBytesLoader(content), in, "")
+}
+
+// findContent finds the schema for a media type, looking up the exact
+// type, the type range, e.g. application/*, and any type.
+func findContent(b *body, mediaType string) (*gojsonschema.Schema, bool) {
+	if len(b.content) == 0 {
+		return nil, true
+	}
+
+	if s, ok := b.content[mediaType]; ok {
+		return s, true
+	}
+
+	if i := strings.IndexByte(mediaType, '/'); i > 0 {
+		if s, ok := b.content[mediaType[:i]+"/*"]; ok {
+			return s, true
+		}
+	}
+
+	s, ok := b.content["*/*"]
+	return s, ok
+}
+
+func validateSchema(s *gojsonschema.Schema, l gojsonschema.JSONLoader, in, name string) []Violation {
+	result, err := s.Validate(l)
+	if err != nil {
+		return []Violation{{In: in, Name: name, Message: err.Error()}}
+	}
+
+	var violations []Violation
+	for _, e := range result.Errors() {
+		field := name
+		if f := e.Field(); f != gojsonschema.STRING_ROOT_SCHEMA_PROPERTY {
+			if field == "" {
+				field = f
+			} else {
+				field += "." + f
+			}
+		}
+
+		violations = append(violations, Violation{In: in, Name: field, Message: e.Description()})
+	}
+
+	return violations
+}
@@ -0,0 +1,365 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"github.com/zalando/skipper/filters/openapi"
+)
+
+const petsSpec = "testdata/pets.yaml"
+
+type problem struct {
+	Status     int                 `json:"status"`
+	Operation  string              `json:"operationId"`
+	Violations []openapi.Violation `json:"violations"`
+}
+
+func createFilter(t *testing.T, args ...interface{}) filters.Filter {
+	t.Helper()
+
+	f, err := openapi.NewOpenApiValidate().CreateFilter(args)
+	require.NoError(t, err)
+	return f
+}
+
+func TestCreateFilter(t *testing.T) {
+	spec := openapi.NewOpenApiValidate()
+	assert.Equal(t, filters.OpenApiValidateName, spec.Name())
+
+	for _, tc := range []struct {
+		name string
+		args []interface{}
+	}{
+		{"no args", nil},
+		{"not a string", []interface{}{1}},
+		{"empty file", []interface{}{""}},
+		{"missing file", []interface{}{"testdata/missing.yaml"}},
+		{"invalid option", []interface{}{petsSpec, "foo"}},
+		{"too many args", []interface{}{petsSpec, openapi.ValidateResponses, "foo"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := spec.CreateFilter(tc.args)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := spec.CreateFilter([]interface{}{petsSpec, openapi.ValidateResponses})
+	assert.NoError(t, err)
+}
+
+func TestCreateFilterInvalidDocument(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		document string
+	}{
+		{"invalid yaml", "openapi: [3"},
+		{"swagger 2", "swagger: \"2.0\"\npaths: {}"},
+		{"missing reference", "openapi: 3.0.0\npaths:\n  /foo:\n    get:\n      parameters:\n        - $ref: \"#/components/parameters/Foo\""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "spec.yaml")
+			require.NoError(t, os.WriteFile(file, []byte(tc.document), 0o644))
+
+			_, err := openapi.NewOpenApiValidate().CreateFilter([]interface{}{file})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestValidateRequest(t *testing.T) {
+	const requestID = "5c2a3b9e-2f0e-4a4e-9c3d-2b1f0d6c7a8e"
+
+	for _, tc := range []struct {
+		name       string
+		method     string
+		path       string
+		header     http.Header
+		body       string
+		status     int
+		operation  string
+		violations []openapi.Violation
+	}{{
+		name:   "valid query",
+		method: "GET",
+		path:   "/pets?limit=10&tags=cat&tags=dog",
+		header: http.Header{"X-Request-Id": []string{requestID}},
+	}, {
+		name:   "valid with server prefix",
+		method: "GET",
+		path:   "/v1/pets?limit=10",
+		header: http.Header{"X-Request-Id": []string{requestID}},
+	}, {
+		name:      "invalid query",
+		method:    "GET",
+		path:      "/pets?limit=ten&tags=bird",
+		header:    http.Header{"X-Request-Id": []string{requestID}},
+		status:    http.StatusBadRequest,
+		operation: "listPets",
+		violations: []openapi.Violation{
+			{In: "query", Name: "limit", Message: `invalid integer: "ten"`},
+			{In: "query", Name: "tags.0", Message: `0 must be one of the following: "cat", "dog"`},
+		},
+	}, {
+		name:      "query out of range and missing header",
+		method:    "GET",
+		path:      "/pets?limit=1000",
+		status:    http.StatusBadRequest,
+		operation: "listPets",
+		violations: []openapi.Violation{
+			{In: "query", Name: "limit", Message: "Must be less than or equal to 100"},
+			{In: "header", Name: "X-Request-Id", Message: "required parameter is missing"},
+		},
+	}, {
+		name:   "valid path parameter",
+		method: "GET",
+		path:   "/pets/42",
+	}, {
+		name:   "path with server prefix",
+		method: "GET",
+		path:   "/v1/pets/42",
+	}, {
+		name:      "escaped slash in path parameter",
+		method:    "GET",
+		path:      "/v1/pets/4%2F2",
+		status:    http.StatusBadRequest,
+		operation: "getPet",
+		violations: []openapi.Violation{
+			{In: "path", Name: "id", Message: `invalid integer: "4/2"`},
+		},
+	}, {
+		name:      "path parameter is unescaped once",
+		method:    "GET",
+		path:      "/pets/%2534",
+		status:    http.StatusBadRequest,
+		operation: "getPet",
+		violations: []openapi.Violation{
+			{In: "path", Name: "id", Message: `invalid integer: "%34"`},
+		},
+	}, {
+		name:   "literal path takes precedence",
+		method: "GET",
+		path:   "/pets/mine",
+	}, {
+		name:      "invalid path parameter",
+		method:    "GET",
+		path:      "/pets/foo",
+		status:    http.StatusBadRequest,
+		operation: "getPet",
+		violations: []openapi.Violation{
+			{In: "path", Name: "id", Message: `invalid integer: "foo"`},
+		},
+	}, {
+		name:   "valid body",
+		method: "POST",
+		path:   "/pets",
+		header: http.Header{"Content-Type": []string{"application/json; charset=utf-8"}},
+		body:   `{"name": "Tom", "tag": null}`,
+	}, {
+		name:      "invalid body",
+		method:    "POST",
+		path:      "/pets",
+		header:    http.Header{"Content-Type": []string{"application/json"}},
+		body:      `{"name": "", "tag": 1}`,
+		status:    http.StatusBadRequest,
+		operation: "createPet",
+		violations: []openapi.Violation{
+			{In: "body", Name: "name", Message: "String length must be greater than or equal to 1"},
+			{In: "body", Name: "tag", Message: "Invalid type. Expected: [string,null], given: integer"},
+		},
+	}, {
+		name:      "malformed body",
+		method:    "POST",
+		path:      "/pets",
+		header:    http.Header{"Content-Type": []string{"application/json"}},
+		body:      `{"name": `,
+		status:    http.StatusBadRequest,
+		operation: "createPet",
+		violations: []openapi.Violation{
+			{In: "body", Message: "invalid JSON"},
+		},
+	}, {
+		name:      "missing body",
+		method:    "POST",
+		path:      "/pets",
+		status:    http.StatusBadRequest,
+		operation: "createPet",
+		violations: []openapi.Violation{
+			{In: "body", Message: "required body is missing"},
+		},
+	}, {
+		name:      "unsupported content type",
+		method:    "POST",
+		path:      "/pets",
+		header:    http.Header{"Content-Type": []string{"text/plain"}},
+		body:      "Tom",
+		status:    http.StatusBadRequest,
+		operation: "createPet",
+		violations: []openapi.Violation{
+			{In: "body", Message: `unsupported content type: "text/plain"`},
+		},
+	}, {
+		name:   "unknown path",
+		method: "GET",
+		path:   "/owners",
+		status: http.StatusNotFound,
+		violations: []openapi.Violation{
+			{In: "path", Message: "no operation found for the path"},
+		},
+	}, {
+		name:   "method not allowed",
+		method: "DELETE",
+		path:   "/pets/42",
+		status: http.StatusMethodNotAllowed,
+		violations: []openapi.Violation{
+			{In: "method", Message: "method DELETE not allowed for /pets/{id}"},
+		},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := createFilter(t, petsSpec)
+
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			for k, v := range tc.header {
+				req.Header[k] = v
+			}
+
+			ctx := &filtertest.Context{FRequest: req, FStateBag: make(map[string]interface{})}
+			f.Request(ctx)
+
+			if tc.status == 0 {
+				require.False(t, ctx.FServed, "the request should be valid")
+
+				// the body is still available for the backend
+				b, err := io.ReadAll(ctx.FRequest.Body)
+				require.NoError(t, err)
+				assert.Equal(t, tc.body, string(b))
+				return
+			}
+
+			require.True(t, ctx.FServed, "the request should be rejected")
+			rsp := ctx.FResponse
+			assert.Equal(t, tc.status, rsp.StatusCode)
+			assert.Equal(t, "application/problem+json", rsp.Header.Get("Content-Type"))
+
+			var p problem
+			require.NoError(t, json.NewDecoder(rsp.Body).Decode(&p))
+			assert.Equal(t, tc.status, p.Status)
+			assert.Equal(t, tc.operation, p.Operation)
+			assert.ElementsMatch(t, tc.violations, p.Violations)
+		})
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		status   int
+		body     string
+		expected []string
+	}{{
+		name:   "valid response",
+		status: http.StatusOK,
+		body:   `{"name": "Tom"}`,
+	}, {
+		name:     "invalid response",
+		status:   http.StatusOK,
+		body:     `{"tag": "cat"}`,
+		expected: []string{"openApiValidate: invalid response of operation getPet: name is required"},
+	}, {
+		name:     "undefined status",
+		status:   http.StatusNotFound,
+		body:     `{}`,
+		expected: []string{"openApiValidate: response status 404 is not defined for operation getPet"},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			hook := logtest.NewGlobal()
+			defer hook.Reset()
+
+			f := createFilter(t, petsSpec, openapi.ValidateResponses)
+
+			ctx := &filtertest.Context{
+				FRequest:  httptest.NewRequest("GET", "/pets/42", nil),
+				FStateBag: make(map[string]interface{}),
+			}
+			f.Request(ctx)
+			require.False(t, ctx.FServed)
+
+			ctx.FResponse = &http.Response{
+				StatusCode: tc.status,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(tc.body)),
+			}
+			f.Response(ctx)
+
+			var messages []string
+			for _, e := range hook.AllEntries() {
+				if e.Level == logrus.WarnLevel {
+					messages = append(messages, e.Message)
+				}
+			}
+
+			assert.Equal(t, tc.expected, messages)
+
+			// the response is not changed
+			b, err := io.ReadAll(ctx.FResponse.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tc.body, string(b))
+		})
+	}
+}
+
+func TestDocumentIsShared(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "spec.yaml")
+	write := func(path string, mtime time.Time) {
+		doc := "openapi: 3.0.0\npaths:\n  " + path + ":\n    get:\n      responses: {}\n"
+		require.NoError(t, os.WriteFile(file, []byte(doc), 0o644))
+		require.NoError(t, os.Chtimes(file, mtime, mtime))
+	}
+
+	status := func(f filters.Filter, path string) int {
+		ctx := &filtertest.Context{FRequest: httptest.NewRequest("GET", path, nil), FStateBag: make(map[string]interface{})}
+		f.Request(ctx)
+		if ctx.FServed {
+			return ctx.FResponse.StatusCode
+		}
+
+		return http.StatusOK
+	}
+
+	spec := openapi.NewOpenApiValidate()
+	now := time.Now()
+	write("/foo", now)
+
+	f1, err := spec.CreateFilter([]interface{}{file})
+	require.NoError(t, err)
+
+	// changing the content without changing the modification time
+	// keeps using the loaded document
+	write("/bar", now)
+	f2, err := spec.CreateFilter([]interface{}{file})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status(f2, "/foo"))
+
+	write("/bar", now.Add(time.Second))
+	f3, err := spec.CreateFilter([]interface{}{file})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status(f3, "/bar"))
+	assert.Equal(t, http.StatusNotFound, status(f3, "/foo"))
+
+	// the previous filters keep their document
+	assert.Equal(t, http.StatusOK, status(f1, "/foo"))
+}
@@ -104,6 +104,9 @@ type OpenPolicyAgentRegistry struct {
 	instances map[string]*OpenPolicyAgentInstance
 	lastused  map[*OpenPolicyAgentInstance]time.Time
 
+	// instances replaced by UpdateInstanceConfig, closed by the cleaner
+	retired map[*OpenPolicyAgentInstance]struct{}
+
 	once                   sync.Once
 	closed                 bool
 	quit                   chan struct{}
@@ -255,26 +258,34 @@ func WithPrometheusRegisterer(registerer prometheus.Registerer) func(*OpenPolicy
 }
 
 func (registry *OpenPolicyAgentRegistry) initializeCache() error {
+	valueCache, err := newValueCache(registry.configTemplate)
+	if err != nil {
+		return err
+	}
+
+	registry.valueCache = valueCache
+	return nil
+}
+
+func newValueCache(cfg *OpenPolicyAgentInstanceConfig) (iCache.InterQueryValueCache, error) {
 	// This line interpolates the config template with a dummy bundle name to make sure the config is parseable.
 	// It is safe in production because the result is not used for anything except caching configuration.
-	configBytes, err := registry.configTemplate.interpolateConfigTemplate("dummy-bundle-name")
+	configBytes, err := cfg.interpolateConfigTemplate("dummy-bundle-name")
 	if err != nil {
-		return fmt.Errorf("failed to interpolate opa config template: %w", err)
+		return nil, fmt.Errorf("failed to interpolate opa config template: %w", err)
 	}
 
 	id := uuid.New().String()
 	parsedConfig, err := config.ParseConfig(configBytes, id)
 	if err != nil {
-		return fmt.Errorf("failed to parse opa config template: %w", err)
+		return nil, fmt.Errorf("failed to parse opa config template: %w", err)
 	}
 	interQueryBuiltinValueCache, err := iCache.ParseCachingConfig(parsedConfig.Caching)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	registry.valueCache = iCache.NewInterQueryValueCache(context.Background(), interQueryBuiltinValueCache)
-
-	return nil
+	return iCache.NewInterQueryValueCache(context.Background(), interQueryBuiltinValueCache), nil
 }
 
 func WithPreloadingEnabled(enabled bool) func(*OpenPolicyAgentRegistry) error {
@@ -305,6 +316,7 @@ func NewOpenPolicyAgentRegistry(opts ...func(*OpenPolicyAgentRegistry) error) (*
 		instanceStartupTimeout:   DefaultOpaStartupTimeout,
 		instances:                make(map[string]*OpenPolicyAgentInstance),
 		lastused:                 make(map[*OpenPolicyAgentInstance]time.Time),
+		retired:                  make(map[*OpenPolicyAgentInstance]struct{}),
 		quit:                     make(chan struct{}),
 		maxRequestBodyBytes:      DefaultMaxMemoryBodyParsing,
 		bodyReadBufferSize:       DefaultRequestBodyBufferSize,
@@ -436,6 +448,10 @@ func (registry *OpenPolicyAgentRegistry) Close() {
 			instance.Close(ctx)
 		}
 
+		for instance := range registry.retired {
+			instance.Close(ctx)
+		}
+
 		registry.closed = true
 		close(registry.quit)
 
@@ -467,6 +483,15 @@ func (registry *OpenPolicyAgentRegistry) cleanUnusedInstances(t time.Time) {
 			delete(registry.lastused, inst)
 		}
 	}
+
+	for inst := range registry.retired {
+		if t.Sub(registry.lastused[inst]) > registry.reuseDuration {
+			inst.Close(ctx)
+
+			delete(registry.retired, inst)
+			delete(registry.lastused, inst)
+		}
+	}
 }
 
 func (registry *OpenPolicyAgentRegistry) startCleanerDaemon() {
@@ -627,6 +652,104 @@ func (registry *OpenPolicyAgentRegistry) newOpenPolicyAgentInstance(bundleName s
 	return engine, nil
 }
 
+// UpdateInstanceConfig replaces the config of the OPA instances, e.g. the
+// config template with the bundles, when the config of Skipper is
+// reloaded. It returns false, when the config didn't change.
+//
+// The instances of the current bundles are created and started with the
+// new config before they replace the current instances, so that the
+// filters created afterwards, e.g. by refreshing the routes, use the new
+// instances. The replaced instances are closed after the reuse duration.
+// When an instance fails to start with the new config, the current
+// config and instances are kept.
+func (registry *OpenPolicyAgentRegistry) UpdateInstanceConfig(opts ...func(*OpenPolicyAgentInstanceConfig) error) (bool, error) {
+	cfg, err := NewOpenPolicyAgentConfig(opts...)
+	if err != nil {
+		return false, err
+	}
+
+	valueCache, err := newValueCache(cfg)
+	if err != nil {
+		return false, err
+	}
+
+	registry.mu.Lock()
+	current := registry.configTemplate
+	bundles := slices.Collect(maps.Keys(registry.instances))
+	registry.mu.Unlock()
+
+	if bytes.Equal(current.configTemplate, cfg.configTemplate) && proto.Equal(current.envoyMetadata, cfg.envoyMetadata) {
+		return false, nil
+	}
+
+	instances := make(map[string]*OpenPolicyAgentInstance, len(bundles))
+	for _, bundleName := range bundles {
+		inst, err := registry.newWithConfig(cfg, valueCache, inmem.NewWithOpts(inmem.OptReturnASTValuesOnRead(registry.enableDataPreProcessingOptimization)), bundleName,
+			registry.maxRequestBodyBytes, registry.bodyReadBufferSize)
+		if err != nil {
+			closeInstances(instances)
+			return false, fmt.Errorf("failed to create OPA instance for bundle %q: %w", bundleName, err)
+		}
+
+		instances[bundleName] = inst
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		startErr error
+	)
+
+	for bundleName, inst := range instances {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := inst.Start(); err != nil {
+				mu.Lock()
+				startErr = errors.Join(startErr, fmt.Errorf("failed to start OPA instance for bundle %q: %w", bundleName, err))
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	if startErr != nil {
+		closeInstances(instances)
+		return false, startErr
+	}
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if registry.closed {
+		closeInstances(instances)
+		return false, fmt.Errorf("open policy agent registry is already closed")
+	}
+
+	now := time.Now()
+	for bundleName, inst := range instances {
+		if replaced, ok := registry.instances[bundleName]; ok {
+			registry.retired[replaced] = struct{}{}
+			registry.lastused[replaced] = now
+		}
+
+		registry.instances[bundleName] = inst
+	}
+
+	registry.configTemplate = cfg
+	registry.valueCache = valueCache
+	return true, nil
+}
+
+func closeInstances(instances map[string]*OpenPolicyAgentInstance) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultShutdownGracePeriod)
+	defer cancel()
+
+	for _, inst := range instances {
+		inst.Close(ctx)
+	}
+}
+
 // decisionLogTask holds everything needed to call logDecision off the hot path.
 type decisionLogTask struct {
 	input  interface{}
@@ -713,13 +836,21 @@ func (registry *OpenPolicyAgentRegistry) withTracingOptions(bundleName string) f
 
 // new returns a new OPA object.
 func (registry *OpenPolicyAgentRegistry) new(store storage.Store, bundleName string, maxBodyBytes int64, bodyReadBufferSize int64) (*OpenPolicyAgentInstance, error) {
+	registry.mu.Lock()
+	instanceConfig, valueCache := registry.configTemplate, registry.valueCache
+	registry.mu.Unlock()
+
+	return registry.newWithConfig(instanceConfig, valueCache, store, bundleName, maxBodyBytes, bodyReadBufferSize)
+}
+
+func (registry *OpenPolicyAgentRegistry) newWithConfig(instanceConfig *OpenPolicyAgentInstanceConfig, valueCache iCache.InterQueryValueCache, store storage.Store, bundleName string, maxBodyBytes int64, bodyReadBufferSize int64) (*OpenPolicyAgentInstance, error) {
 	id := uuid.New().String()
 	uniqueIDGenerator, err := flowid.NewStandardGenerator(32)
 	if err != nil {
 		return nil, err
 	}
 
-	configBytes, err := registry.configTemplate.interpolateConfigTemplate(bundleName)
+	configBytes, err := instanceConfig.interpolateConfigTemplate(bundleName)
 	if err != nil {
 		return nil, err
 	}
@@ -783,7 +914,7 @@ func (registry *OpenPolicyAgentRegistry) new(store storage.Store, bundleName str
 
 	opa := &OpenPolicyAgentInstance{
 		registry:       registry,
-		instanceConfig: *registry.configTemplate,
+		instanceConfig: *instanceConfig,
 		manager:        manager,
 		opaConfig:      opaConfig,
 		bundleName:     bundleName,
@@ -793,7 +924,7 @@ func (registry *OpenPolicyAgentRegistry) new(store storage.Store, bundleName str
 
 		preparedQueryDoOnce:         new(sync.Once),
 		interQueryBuiltinCache:      iCache.NewInterQueryCache(manager.InterQueryBuiltinCacheConfig()),
-		interQueryBuiltinValueCache: registry.valueCache,
+		interQueryBuiltinValueCache: valueCache,
 
 		idGenerator: uniqueIDGenerator,
 		logger:      logging.Get().WithFields(map[string]any{"bundle-name": bundleName}),
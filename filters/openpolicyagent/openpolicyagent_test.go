@@ -349,6 +349,53 @@ func TestRegistry(t *testing.T) {
 		})
 }
 
+func TestUpdateInstanceConfig(t *testing.T) {
+	d := 50 * time.Millisecond
+	_, config := mockControlPlaneWithResourceBundle()
+
+	registry, err := NewOpenPolicyAgentRegistry(WithReuseDuration(d), WithCleanInterval(d), WithInstanceStartupTimeout(time.Second), WithOpenPolicyAgentInstanceConfig(WithConfigTemplate(config)))
+	require.NoError(t, err)
+	defer registry.Close()
+
+	inst1, err := registry.GetOrStartInstance("test")
+	require.NoError(t, err)
+	require.False(t, inst1.EnvoyPluginConfig().DryRun)
+
+	updated, err := registry.UpdateInstanceConfig(WithConfigTemplate(config))
+	require.NoError(t, err)
+	assert.False(t, updated, "unchanged config")
+
+	missingBundle := bytes.Replace(config, []byte("/bundles/{{ .bundlename }}"), []byte("/bundles/missing-{{ .bundlename }}"), 1)
+	_, err = registry.UpdateInstanceConfig(WithConfigTemplate(missingBundle))
+	assert.ErrorContains(t, err, `failed to start OPA instance for bundle "test"`)
+
+	inst, err := registry.GetOrStartInstance("test")
+	require.NoError(t, err)
+	assert.Same(t, inst1, inst, "current instance is kept after failed update")
+
+	dryRun := bytes.Replace(config, []byte(`"dry-run": false`), []byte(`"dry-run": true`), 1)
+	updated, err = registry.UpdateInstanceConfig(WithConfigTemplate(dryRun))
+	require.NoError(t, err)
+	assert.True(t, updated)
+
+	inst2, err := registry.GetOrStartInstance("test")
+	require.NoError(t, err)
+	assert.NotSame(t, inst1, inst2, "instance is replaced")
+	assert.True(t, inst2.Healthy())
+	assert.True(t, inst2.EnvoyPluginConfig().DryRun)
+
+	inst3, err := registry.GetOrStartInstance("anotherbundlename")
+	require.NoError(t, err)
+	assert.True(t, inst3.EnvoyPluginConfig().DryRun, "new instances use the updated config")
+
+	// the replaced instance is closed after the reuse duration
+	assert.Eventually(t, func() bool {
+		registry.mu.Lock()
+		defer registry.mu.Unlock()
+		return len(registry.retired) == 0
+	}, time.Second, d)
+}
+
 func assertTriggerMode(t *testing.T, expectedMode plugins.TriggerMode, plgn plugins.Plugin) {
 	if discoveryPlugin, ok := plgn.(*discovery.Discovery); ok {
 		assert.Equal(t, expectedMode, *discoveryPlugin.TriggerMode())
@@ -0,0 +1,347 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/ratelimit"
+	"github.com/zalando/skipper/scheduler"
+)
+
+type concurrencyLimiter interface {
+	// acquire returns a function to release the acquired slot, or an
+	// error, when no slot could be acquired.
+	acquire(ctx context.Context, key string) (release func(), err error)
+}
+
+type errConcurrencyLimit struct{ cause error }
+
+func (err errConcurrencyLimit) Error() string {
+	if err.cause != nil {
+		return fmt.Sprintf("concurrency limit reached: %v", err.cause)
+	}
+	return "concurrency limit reached"
+}
+
+type concurrencyLimitSpec struct {
+	name   string
+	create func(group string, max int, args []interface{}) (concurrencyLimiter, error)
+}
+
+type concurrencyLimitFilter struct {
+	name       string
+	lookuper   ratelimit.Lookuper
+	limiter    concurrencyLimiter
+	failClosed bool
+}
+
+// NewClusterConcurrencyLimit creates a filter Spec, whose instances
+// limit the number of the concurrent in-flight requests per key
+// across all instances, using leases stored in Redis or Valkey. The
+// leases expire after the optional lease TTL, by default after one
+// minute, when they are not released, e.g. due to a crashed instance.
+//
+// Example to allow 10 concurrent requests per Authorization header
+// to the backend:
+//
+//	clusterConcurrencyLimit("reports", 10, "Authorization")
+//
+// Example with a 5 minutes lease TTL for long running requests:
+//
+//	clusterConcurrencyLimit("exports", 2, "Authorization", "5m")
+func NewClusterConcurrencyLimit(registry *ratelimit.Registry) filters.Spec {
+	return &concurrencyLimitSpec{
+		name: filters.ClusterConcurrencyLimitName,
+		create: func(group string, max int, args []interface{}) (concurrencyLimiter, error) {
+			if len(args) > 1 {
+				return nil, filters.ErrInvalidFilterParameters
+			}
+
+			var ttl time.Duration
+			if len(args) == 1 {
+				var err error
+				ttl, err = getDurationArg(args[0])
+				if err != nil {
+					return nil, err
+				}
+				if ttl <= 0 {
+					return nil, filters.ErrInvalidFilterParameters
+				}
+			}
+
+			return &clusterConcurrencyLimiter{ratelimit.NewClusterConcurrencyLimiter(registry, group, max, ttl)}, nil
+		},
+	}
+}
+
+// NewConcurrencyLimit creates a filter Spec, whose instances limit
+// the number of the concurrent in-flight requests per key on the
+// local instance, using FIFO queues. Optionally, the requests above
+// the limit can wait in a queue of a maximum size, up to a timeout.
+//
+// Example to allow 10 concurrent requests per Authorization header
+// to the backend:
+//
+//	concurrencyLimit("reports", 10, "Authorization")
+//
+// Example to queue up to 20 further requests for at most one second:
+//
+//	concurrencyLimit("reports", 10, "Authorization", 20, "1s")
+func NewConcurrencyLimit() filters.Spec {
+	groups := &localConcurrencyGroups{groups: make(map[localConcurrencyGroupId]*localConcurrencyLimiter)}
+	return &concurrencyLimitSpec{
+		name: filters.ConcurrencyLimitName,
+		create: func(group string, max int, args []interface{}) (concurrencyLimiter, error) {
+			c := scheduler.Config{MaxConcurrency: max, Timeout: time.Millisecond}
+			switch len(args) {
+			case 0:
+			case 2:
+				qs, err := getIntArg(args[0])
+				if err != nil {
+					return nil, err
+				}
+				if qs < 0 {
+					return nil, fmt.Errorf("maxqueuesize requires value >=0, %w", filters.ErrInvalidFilterParameters)
+				}
+
+				timeout, err := getDurationArg(args[1])
+				if err != nil {
+					return nil, err
+				}
+				if timeout < time.Millisecond {
+					return nil, fmt.Errorf("timeout requires value >=1ms, %w", filters.ErrInvalidFilterParameters)
+				}
+
+				c.MaxQueueSize = qs
+				c.Timeout = timeout
+			default:
+				return nil, filters.ErrInvalidFilterParameters
+			}
+
+			return groups.get(group, c), nil
+		},
+	}
+}
+
+func (s *concurrencyLimitSpec) Name() string { return s.name }
+
+// CreateFilter expects the group, the maximum number of concurrent
+// requests per key and the lookuper used to find the key of the
+// requests, by default the X-Forwarded-For header. The rest of the
+// arguments are specific to the cluster and the local variant.
+func (s *concurrencyLimitSpec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) < 2 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	group, err := getStringArg(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	max, err := natural(args[1])
+	if err != nil {
+		return nil, err
+	}
+
+	var lookuper ratelimit.Lookuper = ratelimit.NewXForwardedForLookuper()
+	if len(args) > 2 {
+		lookuperString, err := getStringArg(args[2])
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.Contains(lookuperString, ",") {
+			var lookupers []ratelimit.Lookuper
+			for ls := range strings.SplitSeq(lookuperString, ",") {
+				lookupers = append(lookupers, getLookuper(ls))
+			}
+			lookuper = ratelimit.NewTupleLookuper(lookupers...)
+		} else {
+			lookuper = getLookuper(lookuperString)
+		}
+
+		args = args[3:]
+	} else {
+		args = nil
+	}
+
+	limiter, err := s.create(group, max, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &concurrencyLimitFilter{
+		name:     s.name,
+		lookuper: lookuper,
+		limiter:  limiter,
+	}, nil
+}
+
+// Request acquires a slot for the key of the request, and serves
+// `429 Too Many Requests` when the limit of the key is reached.
+func (f *concurrencyLimitFilter) Request(ctx filters.FilterContext) {
+	key := f.lookuper.Lookup(ctx.Request())
+	if key == "" {
+		return // allow without key
+	}
+
+	release, err := f.limiter.acquire(ctx.Request().Context(), key)
+	if err != nil {
+		if _, ok := err.(errConcurrencyLimit); ok {
+			ctx.Serve(&http.Response{StatusCode: http.StatusTooManyRequests})
+			return
+		}
+
+		if err == scheduler.ErrClientCanceled {
+			// This case is handled in the proxy with status code 499
+			return
+		}
+
+		ctx.Logger().Errorf("%s: failed to acquire: %v", f.name, err)
+		if f.failClosed {
+			header := http.Header{}
+			header.Set("Retry-After", "60")
+			fail(ctx, header)
+		}
+
+		return
+	}
+
+	pending, _ := ctx.StateBag()[f.name].([]func())
+	ctx.StateBag()[f.name] = append(pending, release)
+}
+
+// Response releases the slot acquired for the request.
+func (f *concurrencyLimitFilter) Response(ctx filters.FilterContext) {
+	pending, ok := ctx.StateBag()[f.name].([]func())
+	if !ok {
+		return
+	}
+
+	last := len(pending) - 1
+	if last < 0 {
+		return
+	}
+
+	pending[last]()
+	ctx.StateBag()[f.name] = pending[:last]
+}
+
+// HandleErrorResponse is to opt-in for filters to get called
+// Response(ctx) in case of errors via proxy. It has to return true to opt-in.
+func (f *concurrencyLimitFilter) HandleErrorResponse() bool {
+	return true
+}
+
+type clusterConcurrencyLimiter struct {
+	limiter ratelimit.ConcurrencyLimiter
+}
+
+func (l *clusterConcurrencyLimiter) acquire(ctx context.Context, key string) (func(), error) {
+	lease, acquired, err := l.limiter.Acquire(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if !acquired {
+		return nil, errConcurrencyLimit{}
+	}
+
+	return func() {
+		// release even when the client has gone
+		if err := l.limiter.Release(context.WithoutCancel(ctx), key, lease); err != nil {
+			// the lease expires after its TTL
+			log.Errorf("Failed to release concurrency lease: %v", err)
+		}
+	}, nil
+}
+
+type localConcurrencyGroupId struct {
+	group  string
+	config scheduler.Config
+}
+
+// localConcurrencyGroups shares the limiters of the same group and
+// configuration across the routes and the route updates.
+type localConcurrencyGroups struct {
+	mu     sync.Mutex
+	groups map[localConcurrencyGroupId]*localConcurrencyLimiter
+}
+
+func (g *localConcurrencyGroups) get(group string, c scheduler.Config) *localConcurrencyLimiter {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	id := localConcurrencyGroupId{group: group, config: c}
+	l, ok := g.groups[id]
+	if !ok {
+		l = &localConcurrencyLimiter{config: c, queues: make(map[string]*keyQueue)}
+		g.groups[id] = l
+	}
+
+	return l
+}
+
+// localConcurrencyLimiter maintains a FIFO queue per key. The queues
+// are removed when no request is waiting or active for the key.
+type localConcurrencyLimiter struct {
+	config scheduler.Config
+
+	mu     sync.Mutex
+	queues map[string]*keyQueue
+}
+
+type keyQueue struct {
+	queue *scheduler.FifoQueue
+	refs  int
+}
+
+func (l *localConcurrencyLimiter) get(key string) *scheduler.FifoQueue {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	q, ok := l.queues[key]
+	if !ok {
+		q = &keyQueue{queue: scheduler.NewFifoQueue(l.config)}
+		l.queues[key] = q
+	}
+
+	q.refs++
+	return q.queue
+}
+
+func (l *localConcurrencyLimiter) put(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	q := l.queues[key]
+	q.refs--
+	if q.refs == 0 {
+		delete(l.queues, key)
+	}
+}
+
+func (l *localConcurrencyLimiter) acquire(ctx context.Context, key string) (func(), error) {
+	done, err := l.get(key).Wait(ctx)
+	if err != nil {
+		l.put(key)
+		switch err {
+		case scheduler.ErrQueueFull, scheduler.ErrQueueTimeout:
+			return nil, errConcurrencyLimit{cause: err}
+		default:
+			return nil, err
+		}
+	}
+
+	return func() {
+		done()
+		l.put(key)
+	}, nil
+}
@@ -0,0 +1,206 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"github.com/zalando/skipper/ratelimit"
+	"github.com/zalando/skipper/routing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeConcurrencyLimiter struct {
+	mu     sync.Mutex
+	max    int
+	leases map[string]int
+	err    error
+}
+
+func (l *fakeConcurrencyLimiter) Acquire(_ context.Context, key string) (string, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.err != nil {
+		return "", false, l.err
+	}
+
+	if l.leases[key] >= l.max {
+		return "", false, nil
+	}
+
+	l.leases[key]++
+	return key, true, nil
+}
+
+func (l *fakeConcurrencyLimiter) Release(_ context.Context, key, lease string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.leases[key]--
+	return nil
+}
+
+func newFakeClusterConcurrencyLimit(l *fakeConcurrencyLimiter) filters.Spec {
+	return &concurrencyLimitSpec{
+		name: filters.ClusterConcurrencyLimitName,
+		create: func(_ string, max int, _ []interface{}) (concurrencyLimiter, error) {
+			l.max = max
+			return &clusterConcurrencyLimiter{l}, nil
+		},
+	}
+}
+
+func concurrencyRequest(f filters.Filter, key string) *filtertest.Context {
+	req := &http.Request{Header: http.Header{"Authorization": []string{key}}}
+	ctx := &filtertest.Context{FRequest: req, FStateBag: make(map[string]interface{})}
+	f.Request(ctx)
+	return ctx
+}
+
+func TestConcurrencyLimitInvalidArgs(t *testing.T) {
+	for _, spec := range []filters.Spec{NewConcurrencyLimit(), NewClusterConcurrencyLimit(ratelimit.NewRegistry())} {
+		for _, args := range [][]interface{}{
+			{},
+			{"agroup"},
+			{1, 1},
+			{"agroup", 0},
+			{"agroup", "1"},
+			{"agroup", 1, 1},
+			{"agroup", 1, "Authorization", "foo"},
+			{"agroup", 1, "Authorization", 1, "1s", 1},
+		} {
+			_, err := spec.CreateFilter(args)
+			assert.Error(t, err, "%s%v", spec.Name(), args)
+		}
+	}
+
+	for _, args := range [][]interface{}{
+		{"agroup", 1, "Authorization", -1, "1s"},
+		{"agroup", 1, "Authorization", 1, "1us"},
+	} {
+		_, err := NewConcurrencyLimit().CreateFilter(args)
+		assert.Error(t, err, "%v", args)
+	}
+}
+
+func TestClusterConcurrencyLimit(t *testing.T) {
+	l := &fakeConcurrencyLimiter{leases: make(map[string]int)}
+	f, err := newFakeClusterConcurrencyLimit(l).CreateFilter([]interface{}{"agroup", 2, "Authorization"})
+	require.NoError(t, err)
+
+	ctx1 := concurrencyRequest(f, "akey")
+	ctx2 := concurrencyRequest(f, "akey")
+	assert.False(t, ctx1.FServed)
+	assert.False(t, ctx2.FServed)
+
+	ctx3 := concurrencyRequest(f, "akey")
+	require.True(t, ctx3.FServed)
+	assert.Equal(t, http.StatusTooManyRequests, ctx3.FResponse.StatusCode)
+
+	assert.False(t, concurrencyRequest(f, "otherkey").FServed, "other key has its own limit")
+	assert.False(t, concurrencyRequest(f, "").FServed, "allowed without key")
+
+	f.Response(ctx1)
+	assert.Equal(t, 1, l.leases["akey"])
+	f.Response(ctx1)
+	assert.Equal(t, 1, l.leases["akey"], "released once")
+
+	assert.False(t, concurrencyRequest(f, "akey").FServed)
+}
+
+func TestClusterConcurrencyLimitFailure(t *testing.T) {
+	l := &fakeConcurrencyLimiter{leases: make(map[string]int), err: errors.New("oops")}
+	spec := newFakeClusterConcurrencyLimit(l)
+
+	f, err := spec.CreateFilter([]interface{}{"agroup", 1, "Authorization"})
+	require.NoError(t, err)
+	assert.False(t, concurrencyRequest(f, "akey").FServed, "fails open")
+
+	f, err = spec.CreateFilter([]interface{}{"agroup", 1, "Authorization"})
+	require.NoError(t, err)
+	NewFailClosedPostProcessor().Do([]*routing.Route{{
+		Filters: []*routing.RouteFilter{
+			{Filter: &failClosed{}, Name: filters.RatelimitFailClosedName},
+			{Filter: f, Name: filters.ClusterConcurrencyLimitName},
+		},
+	}})
+
+	ctx := concurrencyRequest(f, "akey")
+	require.True(t, ctx.FServed, "fails closed")
+	assert.Equal(t, http.StatusTooManyRequests, ctx.FResponse.StatusCode)
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	spec := NewConcurrencyLimit()
+	f, err := spec.CreateFilter([]interface{}{"agroup", 1, "Authorization"})
+	require.NoError(t, err)
+
+	ctx1 := concurrencyRequest(f, "akey")
+	assert.False(t, ctx1.FServed)
+
+	ctx2 := concurrencyRequest(f, "akey")
+	require.True(t, ctx2.FServed)
+	assert.Equal(t, http.StatusTooManyRequests, ctx2.FResponse.StatusCode)
+
+	// the same group is shared across filter instances
+	other, err := spec.CreateFilter([]interface{}{"agroup", 1, "Authorization"})
+	require.NoError(t, err)
+	assert.True(t, concurrencyRequest(other, "akey").FServed)
+
+	assert.False(t, concurrencyRequest(f, "otherkey").FServed, "other key has its own limit")
+
+	f.Response(ctx1)
+	assert.False(t, concurrencyRequest(f, "akey").FServed)
+}
+
+func TestConcurrencyLimitQueue(t *testing.T) {
+	f, err := NewConcurrencyLimit().CreateFilter([]interface{}{"agroup", 1, "Authorization", 1, "1s"})
+	require.NoError(t, err)
+
+	ctx1 := concurrencyRequest(f, "akey")
+	require.False(t, ctx1.FServed)
+
+	queued := make(chan *filtertest.Context)
+	go func() { queued <- concurrencyRequest(f, "akey") }()
+
+	// wait for the request to be queued, then the queue is full
+	l := f.(*concurrencyLimitFilter).limiter.(*localConcurrencyLimiter)
+	require.Eventually(t, func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.queues["akey"].refs == 2
+	}, time.Second, time.Millisecond)
+
+	assert.True(t, concurrencyRequest(f, "akey").FServed, "queue full")
+
+	f.Response(ctx1)
+	ctx2 := <-queued
+	assert.False(t, ctx2.FServed)
+
+	f.Response(ctx2)
+	l.mu.Lock()
+	assert.Empty(t, l.queues, "unused queues are removed")
+	l.mu.Unlock()
+}
+
+func TestConcurrencyLimitQueueTimeout(t *testing.T) {
+	f, err := NewConcurrencyLimit().CreateFilter([]interface{}{"agroup", 1, "Authorization", 1, "10ms"})
+	require.NoError(t, err)
+
+	ctx1 := concurrencyRequest(f, "akey")
+	require.False(t, ctx1.FServed)
+
+	ctx2 := concurrencyRequest(f, "akey")
+	require.True(t, ctx2.FServed)
+	assert.Equal(t, http.StatusTooManyRequests, ctx2.FResponse.StatusCode)
+
+	f.Response(ctx1)
+}
@@ -41,6 +41,12 @@ func (*FailClosedPostProcessor) Do(routes []*routing.Route) []*routing.Route {
 					lf.failClosed = true
 				}
 
+			case filters.ClusterConcurrencyLimitName, filters.ConcurrencyLimitName:
+				cf, ok := f.Filter.(*concurrencyLimitFilter)
+				if ok {
+					cf.failClosed = true
+				}
+
 			case filters.BackendRateLimitName:
 				bf, ok := f.Filter.(*BackendRatelimit)
 				if ok {
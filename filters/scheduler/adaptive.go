@@ -0,0 +1,350 @@
+package scheduler
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/scheduler"
+)
+
+const (
+	// GradientAlgorithm adjusts the limit by the gradient between the
+	// minimum and the measured latency, plus an allowance for queuing.
+	GradientAlgorithm = "gradient"
+
+	// VegasAlgorithm estimates the number of queued requests from the
+	// minimum and the measured latency, like TCP Vegas, and increases or
+	// decreases the limit by logarithmic steps.
+	VegasAlgorithm = "vegas"
+
+	defaultAdaptiveInitialLimit = 20
+	defaultAdaptiveMaxLimit     = 1000
+	defaultAdaptiveTimeout      = time.Second
+
+	// the minimum latency is measured in windows of samples, and the
+	// minimum of the current and the previous window is used, so that
+	// it follows the changes of the backend
+	adaptiveMinRTTWindow = 500
+
+	gradientTolerance = 1.5
+	gradientSmoothing = 0.2
+	backoffRatio      = 0.9
+)
+
+type (
+	adaptiveSpec struct {
+		mu       sync.Mutex
+		limiters map[*scheduler.FifoQueue]*adaptiveLimiter
+	}
+
+	adaptiveFilter struct {
+		spec         *adaptiveSpec
+		algorithm    string
+		initialLimit int
+		config       scheduler.Config
+		queue        *scheduler.FifoQueue
+		limiter      *adaptiveLimiter
+	}
+
+	// adaptiveLimiter estimates the limit of a queue. It is preserved
+	// with the queue across the route updates.
+	adaptiveLimiter struct {
+		mu        sync.Mutex
+		algorithm string
+		queue     *scheduler.FifoQueue
+		limit     float64
+		maxLimit  float64
+		minRTT    time.Duration
+		prevMin   time.Duration
+		samples   int
+	}
+
+	adaptiveRequest struct {
+		done  func()
+		start time.Time
+	}
+)
+
+// NewAdaptiveConcurrency creates the specification of the
+// adaptiveConcurrency filter, that limits the concurrency of a route,
+// like the fifo filter, but adjusts the limit continuously based on
+// the measured latency of the backend.
+func NewAdaptiveConcurrency() filters.Spec {
+	return &adaptiveSpec{limiters: make(map[*scheduler.FifoQueue]*adaptiveLimiter)}
+}
+
+func (*adaptiveSpec) Name() string { return filters.AdaptiveConcurrencyName }
+
+// CreateFilter creates an adaptiveFilter. All parameters are optional:
+// the algorithm, gradient or vegas, the initial limit, the maximum
+// limit, the maximum queue size and the timeout of the queue.
+func (s *adaptiveSpec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) > 5 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f := &adaptiveFilter{
+		spec:         s,
+		algorithm:    GradientAlgorithm,
+		initialLimit: defaultAdaptiveInitialLimit,
+		config: scheduler.Config{
+			MaxConcurrency: defaultAdaptiveMaxLimit,
+			Timeout:        defaultAdaptiveTimeout,
+		},
+	}
+
+	if len(args) > 0 {
+		algorithm, ok := args[0].(string)
+		if !ok || algorithm != GradientAlgorithm && algorithm != VegasAlgorithm {
+			return nil, fmt.Errorf("algorithm requires gradient or vegas, %w", filters.ErrInvalidFilterParameters)
+		}
+		f.algorithm = algorithm
+	}
+
+	if len(args) > 1 {
+		limit, err := intArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		if limit < 1 {
+			return nil, fmt.Errorf("initial limit requires value >0, %w", filters.ErrInvalidFilterParameters)
+		}
+		f.initialLimit = limit
+	}
+
+	if len(args) > 2 {
+		maxLimit, err := intArg(args[2])
+		if err != nil {
+			return nil, err
+		}
+		if maxLimit < f.initialLimit {
+			return nil, fmt.Errorf("max limit requires value >=initial limit, %w", filters.ErrInvalidFilterParameters)
+		}
+		f.config.MaxConcurrency = maxLimit
+	} else if f.initialLimit > f.config.MaxConcurrency {
+		f.config.MaxConcurrency = f.initialLimit
+	}
+
+	if len(args) > 3 {
+		qs, err := intArg(args[3])
+		if err != nil {
+			return nil, err
+		}
+		if qs < 0 {
+			return nil, fmt.Errorf("maxqueuesize requires value >=0, %w", filters.ErrInvalidFilterParameters)
+		}
+		f.config.MaxQueueSize = qs
+	}
+
+	if len(args) > 4 {
+		d, err := durationArg(args[4])
+		if err != nil {
+			return nil, err
+		}
+		if d < time.Millisecond {
+			return nil, fmt.Errorf("timeout requires value >=1ms, %w", filters.ErrInvalidFilterParameters)
+		}
+		f.config.Timeout = d
+	}
+
+	return f, nil
+}
+
+// limiter returns the limiter of the queue, or creates one starting
+// with the initial limit. The limiters of the closed queues are
+// removed.
+func (s *adaptiveSpec) limiter(q *scheduler.FifoQueue, algorithm string, initialLimit int) *adaptiveLimiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for qi := range s.limiters {
+		if qi.Status().Closed {
+			delete(s.limiters, qi)
+		}
+	}
+
+	if l, ok := s.limiters[q]; ok && l.algorithm == algorithm && l.maxLimit == float64(q.Config().MaxConcurrency) {
+		// the queue may have been reconfigured
+		l.mu.Lock()
+		q.SetMaxConcurrency(int(l.limit))
+		l.mu.Unlock()
+		return l
+	}
+
+	l := &adaptiveLimiter{
+		algorithm: algorithm,
+		queue:     q,
+		limit:     float64(initialLimit),
+		maxLimit:  float64(q.Config().MaxConcurrency),
+	}
+
+	q.SetMaxConcurrency(initialLimit)
+	s.limiters[q] = l
+	return l
+}
+
+func (f *adaptiveFilter) Config() scheduler.Config {
+	return f.config
+}
+
+func (f *adaptiveFilter) GetQueue() *scheduler.FifoQueue {
+	return f.queue
+}
+
+func (f *adaptiveFilter) SetQueue(q *scheduler.FifoQueue) {
+	f.queue = q
+	f.limiter = f.spec.limiter(q, f.algorithm, f.initialLimit)
+}
+
+// Request waits for the queue like the fifo filter, and responds with
+// 503, when the queue is full, and with 502, when it times out.
+func (f *adaptiveFilter) Request(ctx filters.FilterContext) {
+	c := ctx.Request().Context()
+	done, err := f.queue.Wait(c)
+	if err != nil {
+		if span := opentracing.SpanFromContext(c); span != nil {
+			ext.Error.Set(span, true)
+			span.LogKV("adaptiveConcurrency error", fmt.Sprintf("Failed to wait for queue: %v", err))
+		}
+		ctx.Logger().Debugf("Failed to wait for adaptiveConcurrency queue: %v", err)
+
+		switch err {
+		case scheduler.ErrQueueFull:
+			ctx.Serve(&http.Response{
+				StatusCode: http.StatusServiceUnavailable,
+				Status:     "Queue Full - https://opensource.zalando.com/skipper/operation/operation/#scheduler",
+			})
+		case scheduler.ErrQueueTimeout:
+			ctx.Serve(&http.Response{
+				StatusCode: http.StatusBadGateway,
+				Status:     "Queue Timeout - https://opensource.zalando.com/skipper/operation/operation/#scheduler",
+			})
+		case scheduler.ErrClientCanceled:
+			// This case is handled in the proxy with status code 499
+		default:
+			ctx.Logger().Errorf("Unknown error in adaptiveConcurrency(): %v", err)
+			ctx.Serve(&http.Response{StatusCode: http.StatusInternalServerError})
+		}
+
+		return
+	}
+
+	pending, _ := ctx.StateBag()[filters.AdaptiveConcurrencyName].([]adaptiveRequest)
+	ctx.StateBag()[filters.AdaptiveConcurrencyName] = append(pending, adaptiveRequest{done: done, start: time.Now()})
+}
+
+// Response releases the queue, and updates the limit with the latency
+// of the request. Gateway errors and timeouts count as dropped requests.
+func (f *adaptiveFilter) Response(ctx filters.FilterContext) {
+	pending, ok := ctx.StateBag()[filters.AdaptiveConcurrencyName].([]adaptiveRequest)
+	if !ok || len(pending) == 0 {
+		return
+	}
+
+	last := len(pending) - 1
+	r := pending[last]
+	ctx.StateBag()[filters.AdaptiveConcurrencyName] = pending[:last]
+
+	inflight := f.queue.Status().ActiveRequests
+	r.done()
+
+	var dropped bool
+	if rsp := ctx.Response(); rsp == nil {
+		dropped = true
+	} else {
+		switch rsp.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			dropped = true
+		}
+	}
+
+	f.limiter.sample(time.Since(r.start), inflight, dropped)
+}
+
+// HandleErrorResponse is to opt-in for filters to get called
+// Response(ctx) in case of errors via proxy. It has to return true to opt-in.
+func (f *adaptiveFilter) HandleErrorResponse() bool {
+	return true
+}
+
+// sample updates the limit with the latency of a request, and the
+// number of the requests in flight when it finished.
+func (l *adaptiveLimiter) sample(rtt time.Duration, inflight int, dropped bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if rtt <= 0 {
+		rtt = time.Microsecond
+	}
+
+	if l.minRTT == 0 || rtt < l.minRTT {
+		l.minRTT = rtt
+	}
+
+	l.samples++
+	if l.samples >= adaptiveMinRTTWindow {
+		l.prevMin, l.minRTT, l.samples = l.minRTT, 0, 0
+	}
+
+	minRTT := l.minRTT
+	if l.prevMin > 0 && (minRTT == 0 || l.prevMin < minRTT) {
+		minRTT = l.prevMin
+	}
+
+	// the limit is only increased, when it is used, to avoid growing it
+	// without bounds when the traffic is low
+	appLimited := float64(inflight)*2 < l.limit
+
+	var limit float64
+	switch l.algorithm {
+	case VegasAlgorithm:
+		limit = l.vegas(rtt, minRTT, dropped, appLimited)
+	default:
+		limit = l.gradient(rtt, minRTT, dropped, appLimited)
+	}
+
+	l.limit = math.Max(1, math.Min(limit, l.maxLimit))
+	l.queue.SetMaxConcurrency(int(l.limit))
+}
+
+func (l *adaptiveLimiter) gradient(rtt, minRTT time.Duration, dropped, appLimited bool) float64 {
+	if dropped {
+		return l.limit * backoffRatio
+	}
+
+	gradient := math.Max(0.5, math.Min(1, gradientTolerance*float64(minRTT)/float64(rtt)))
+	limit := l.limit*gradient + math.Sqrt(l.limit)
+	if appLimited && limit > l.limit {
+		return l.limit
+	}
+
+	return l.limit*(1-gradientSmoothing) + limit*gradientSmoothing
+}
+
+func (l *adaptiveLimiter) vegas(rtt, minRTT time.Duration, dropped, appLimited bool) float64 {
+	step := math.Max(1, math.Log10(l.limit))
+	if dropped {
+		return l.limit - step
+	}
+
+	queued := l.limit * (1 - float64(minRTT)/float64(rtt))
+	alpha, beta := 3*step, 6*step
+	switch {
+	case queued > beta:
+		return l.limit - step
+	case appLimited:
+		return l.limit
+	case queued <= step:
+		return l.limit + beta
+	case queued < alpha:
+		return l.limit + step
+	default:
+		return l.limit
+	}
+}
@@ -0,0 +1,221 @@
+package scheduler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/filtertest"
+	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/scheduler"
+)
+
+func TestCreateAdaptiveConcurrencyFilter(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		args          []interface{}
+		wantParseErr  bool
+		wantAlgorithm string
+		wantInitial   int
+		wantConfig    scheduler.Config
+	}{{
+		name:          "no args",
+		wantAlgorithm: GradientAlgorithm,
+		wantInitial:   20,
+		wantConfig:    scheduler.Config{MaxConcurrency: 1000, Timeout: time.Second},
+	}, {
+		name:          "all args",
+		args:          []interface{}{"vegas", 10, 100, 50, "2s"},
+		wantAlgorithm: VegasAlgorithm,
+		wantInitial:   10,
+		wantConfig:    scheduler.Config{MaxConcurrency: 100, MaxQueueSize: 50, Timeout: 2 * time.Second},
+	}, {
+		name:          "initial limit above default max limit",
+		args:          []interface{}{"gradient", 2000},
+		wantAlgorithm: GradientAlgorithm,
+		wantInitial:   2000,
+		wantConfig:    scheduler.Config{MaxConcurrency: 2000, Timeout: time.Second},
+	}, {
+		name:         "unknown algorithm",
+		args:         []interface{}{"aimd"},
+		wantParseErr: true,
+	}, {
+		name:         "zero initial limit",
+		args:         []interface{}{"vegas", 0},
+		wantParseErr: true,
+	}, {
+		name:         "max limit below initial limit",
+		args:         []interface{}{"vegas", 10, 5},
+		wantParseErr: true,
+	}, {
+		name:         "negative queue size",
+		args:         []interface{}{"vegas", 10, 100, -1},
+		wantParseErr: true,
+	}, {
+		name:         "too small timeout",
+		args:         []interface{}{"vegas", 10, 100, 1, "1ns"},
+		wantParseErr: true,
+	}, {
+		name:         "too many args",
+		args:         []interface{}{"vegas", 10, 100, 1, "1s", 1},
+		wantParseErr: true,
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := NewAdaptiveConcurrency()
+			if spec.Name() != filters.AdaptiveConcurrencyName {
+				t.Fatalf("got name %q", spec.Name())
+			}
+
+			ff, err := spec.CreateFilter(tt.args)
+			if tt.wantParseErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f := ff.(*adaptiveFilter)
+			if f.algorithm != tt.wantAlgorithm || f.initialLimit != tt.wantInitial || f.Config() != tt.wantConfig {
+				t.Fatalf("got %s %d %+v", f.algorithm, f.initialLimit, f.Config())
+			}
+		})
+	}
+}
+
+func newAdaptiveTestFilter(t *testing.T, reg *scheduler.Registry, spec filters.Spec, args ...interface{}) *adaptiveFilter {
+	t.Helper()
+
+	f, err := spec.CreateFilter(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reg.Do([]*routing.Route{{
+		Filters: []*routing.RouteFilter{{Filter: f, Name: filters.AdaptiveConcurrencyName}},
+	}})
+
+	return f.(*adaptiveFilter)
+}
+
+func TestAdaptiveConcurrencyLimit(t *testing.T) {
+	for _, algorithm := range []string{GradientAlgorithm, VegasAlgorithm} {
+		t.Run(algorithm, func(t *testing.T) {
+			reg := scheduler.NewRegistry()
+			defer reg.Close()
+
+			f := newAdaptiveTestFilter(t, reg, NewAdaptiveConcurrency(), algorithm, 20, 100)
+			q := f.GetQueue()
+			if q.MaxConcurrency() != 20 {
+				t.Fatalf("expected initial limit, got: %d", q.MaxConcurrency())
+			}
+
+			// establish the baseline, and grow with the used limit
+			for range 50 {
+				f.limiter.sample(10*time.Millisecond, q.MaxConcurrency(), false)
+			}
+
+			grown := q.MaxConcurrency()
+			if grown <= 20 {
+				t.Fatalf("expected the limit to grow, got: %d", grown)
+			}
+
+			// latency increases, the backend is saturated
+			for range 50 {
+				f.limiter.sample(100*time.Millisecond, q.MaxConcurrency(), false)
+			}
+
+			if q.MaxConcurrency() >= grown {
+				t.Fatalf("expected the limit to decrease from %d, got: %d", grown, q.MaxConcurrency())
+			}
+
+			// dropped requests
+			for range 200 {
+				f.limiter.sample(10*time.Millisecond, q.MaxConcurrency(), true)
+			}
+
+			if q.MaxConcurrency() != 1 {
+				t.Fatalf("expected the minimum limit, got: %d", q.MaxConcurrency())
+			}
+		})
+	}
+}
+
+func TestAdaptiveConcurrencyAppLimited(t *testing.T) {
+	reg := scheduler.NewRegistry()
+	defer reg.Close()
+
+	f := newAdaptiveTestFilter(t, reg, NewAdaptiveConcurrency(), VegasAlgorithm, 20, 100)
+	for range 50 {
+		f.limiter.sample(10*time.Millisecond, 1, false)
+	}
+
+	if f.GetQueue().MaxConcurrency() != 20 {
+		t.Fatalf("expected unchanged limit, got: %d", f.GetQueue().MaxConcurrency())
+	}
+}
+
+func TestAdaptiveConcurrencyPreservedLimit(t *testing.T) {
+	reg := scheduler.NewRegistry()
+	defer reg.Close()
+
+	spec := NewAdaptiveConcurrency()
+	f := newAdaptiveTestFilter(t, reg, spec, VegasAlgorithm, 20, 100)
+	for range 10 {
+		f.limiter.sample(10*time.Millisecond, 20, true)
+	}
+
+	limit := f.GetQueue().MaxConcurrency()
+	if limit >= 20 {
+		t.Fatalf("expected lower limit, got: %d", limit)
+	}
+
+	// route update
+	updated := newAdaptiveTestFilter(t, reg, spec, VegasAlgorithm, 20, 100)
+	if updated.GetQueue() != f.GetQueue() || updated.limiter != f.limiter {
+		t.Fatal("expected the same queue and limiter")
+	}
+
+	if updated.GetQueue().MaxConcurrency() != limit {
+		t.Fatalf("expected preserved limit %d, got: %d", limit, updated.GetQueue().MaxConcurrency())
+	}
+}
+
+func TestAdaptiveConcurrencyRequest(t *testing.T) {
+	reg := scheduler.NewRegistry()
+	defer reg.Close()
+
+	f := newAdaptiveTestFilter(t, reg, NewAdaptiveConcurrency(), GradientAlgorithm, 1, 1)
+
+	newContext := func() *filtertest.Context {
+		req, _ := http.NewRequest("GET", "http://www.example.org", nil)
+		return &filtertest.Context{FRequest: req, FStateBag: make(map[string]interface{})}
+	}
+
+	ctx1 := newContext()
+	f.Request(ctx1)
+	if ctx1.FServed {
+		t.Fatal("unexpected rejection")
+	}
+
+	ctx2 := newContext()
+	f.Request(ctx2)
+	if !ctx2.FServed || ctx2.FResponse.StatusCode != http.StatusServiceUnavailable {
+		t.Fatal("expected queue full")
+	}
+
+	ctx1.FResponse = &http.Response{StatusCode: http.StatusOK}
+	f.Response(ctx1)
+	if s := f.GetQueue().Status(); s.ActiveRequests != 0 {
+		t.Fatalf("expected released queue, got: %+v", s)
+	}
+
+	ctx3 := newContext()
+	f.Request(ctx3)
+	if ctx3.FServed {
+		t.Fatal("unexpected rejection")
+	}
+}
@@ -18,6 +18,11 @@
 // scheduler group and lifo will get a per route unique scheduler
 // group.
 //
+// The fifo filters use a first in first out queue with a static maximum
+// concurrency. The adaptiveConcurrency filter uses the same queue, but
+// adjusts its maximum concurrency continuously, based on the measured
+// latency of the backend.
+//
 // Bounded schedulers were tested in Kubernetes with 3 proxy instances
 // with 500m CPU and 500Mi memory resources. The load test was done
 // with 500 requests per second to backends with 25 seconds latency
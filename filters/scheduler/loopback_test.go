@@ -60,3 +60,49 @@ func TestFifoLoopback(t *testing.T) {
 
 	assert.Equal(t, "ok", string(content))
 }
+
+func TestFifoWithAdaptiveConcurrency(t *testing.T) {
+	// both filters use the queue of the route, only the last one is kept
+	dc, err := testdataclient.NewDoc(`
+		main: Path("/") -> fifo(1, 1, "100ms") -> adaptiveConcurrency("gradient", 1, 1, 1, "100ms") -> inlineContent("ok") -> <shunt>;
+	`)
+	require.NoError(t, err)
+	defer dc.Close()
+
+	filterRegistry := make(filters.Registry)
+	filterRegistry.Register(fifo.NewFifo())
+	filterRegistry.Register(fifo.NewAdaptiveConcurrency())
+	filterRegistry.Register(builtin.NewInlineContent())
+
+	schedulerRegistry := scheduler.RegistryWith(scheduler.Options{})
+	defer schedulerRegistry.Close()
+
+	rt := routing.New(routing.Options{
+		DataClients:     []routing.DataClient{dc},
+		FilterRegistry:  filterRegistry,
+		PreProcessors:   []routing.PreProcessor{schedulerRegistry.PreProcessor()},
+		PostProcessors:  []routing.PostProcessor{schedulerRegistry},
+		SignalFirstLoad: true,
+	})
+	defer rt.Close()
+
+	<-rt.FirstLoad()
+
+	pr := proxy.WithParams(proxy.Params{Routing: rt})
+	defer pr.Close()
+
+	tsp := httptest.NewServer(pr)
+	defer tsp.Close()
+
+	for range 3 {
+		resp, err := http.Get(tsp.URL + "/")
+		require.NoError(t, err)
+
+		content, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "ok", string(content))
+	}
+}
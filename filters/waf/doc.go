@@ -0,0 +1,21 @@
+/*
+Package waf provides the waf filter, a web application firewall, that
+inspects the requests with SecLang rules, like the OWASP Core Rule Set.
+
+The filter loads the rules from the files matching a glob pattern, and
+evaluates them on the request line, the headers, the cookies, the query
+and the body, up to a configured size:
+
+	waf("/etc/skipper/crs/rules/*.conf", "block", 2)
+
+In blocking mode, the requests matching a denying rule, or reaching the
+anomaly threshold with the blocking rules, are rejected. In detection
+only mode, the matching rules are only reported. Every request matching
+any rule is reported in a JSON audit log entry, in the access log and in
+the tracing span.
+
+The engine implements the subset of SecLang, that is required by the
+rules of the request phases. The rules using features outside of this
+subset, e.g. transaction variables, are skipped with a warning.
+*/
+package waf
@@ -0,0 +1,278 @@
+package waf
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type operator struct {
+	name   string
+	negate bool
+	match  func(string) bool
+}
+
+type operatorFactory func(dir, arg string) (func(string) bool, error)
+
+var operators = map[string]operatorFactory{
+	"rx":                   rxOperator,
+	"pm":                   pmOperator,
+	"pmFromFile":           pmFromFileOperator,
+	"pmf":                  pmFromFileOperator,
+	"streq":                stringOperator(func(v, arg string) bool { return v == arg }),
+	"contains":             stringOperator(strings.Contains),
+	"containsWord":         containsWordOperator,
+	"beginsWith":           stringOperator(strings.HasPrefix),
+	"endsWith":             stringOperator(strings.HasSuffix),
+	"within":               stringOperator(func(v, arg string) bool { return strings.Contains(arg, v) }),
+	"eq":                   numberOperator(func(v, arg int) bool { return v == arg }),
+	"gt":                   numberOperator(func(v, arg int) bool { return v > arg }),
+	"ge":                   numberOperator(func(v, arg int) bool { return v >= arg }),
+	"lt":                   numberOperator(func(v, arg int) bool { return v < arg }),
+	"le":                   numberOperator(func(v, arg int) bool { return v <= arg }),
+	"ipMatch":              ipMatchOperator,
+	"validateByteRange":    validateByteRangeOperator,
+	"validateUrlEncoding":  func(string, string) (func(string) bool, error) { return invalidURLEncoding, nil },
+	"validateUtf8Encoding": func(string, string) (func(string) bool, error) { return invalidUTF8, nil },
+	"unconditionalMatch":   func(string, string) (func(string) bool, error) { return func(string) bool { return true }, nil },
+	"noMatch":              func(string, string) (func(string) bool, error) { return func(string) bool { return false }, nil },
+}
+
+// parseOperator parses the operator of a rule, e.g. "@rx ^foo" or
+// "!@streq bar". Without an explicit operator, the argument is a regular
+// expression.
+func parseOperator(dir, s string) (*operator, error) {
+	op := &operator{}
+	if strings.HasPrefix(s, "!") {
+		op.negate = true
+		s = s[1:]
+	}
+
+	name, arg := "rx", s
+	if strings.HasPrefix(s, "@") {
+		name, arg, _ = strings.Cut(s[1:], " ")
+		arg = strings.TrimSpace(arg)
+	}
+
+	// macros refer to the transaction variables, that are not
+	// supported
+	if strings.Contains(arg, "%{") {
+		return nil, unsupportedError{"macro in operator: " + arg}
+	}
+
+	create, ok := operators[name]
+	if !ok {
+		return nil, unsupportedError{"operator: @" + name}
+	}
+
+	m, err := create(dir, arg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid argument of @%s: %w", name, err)
+	}
+
+	op.name = name
+	op.match = m
+	return op, nil
+}
+
+func (op *operator) matches(v string) bool {
+	return op.match(v) != op.negate
+}
+
+func rxOperator(_, arg string) (func(string) bool, error) {
+	rx, err := regexp.Compile(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	return rx.MatchString, nil
+}
+
+func phraseMatch(phrases []string) func(string) bool {
+	for i := range phrases {
+		phrases[i] = strings.ToLower(phrases[i])
+	}
+
+	return func(v string) bool {
+		v = strings.ToLower(v)
+		for _, p := range phrases {
+			if strings.Contains(v, p) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+func pmOperator(_, arg string) (func(string) bool, error) {
+	return phraseMatch(strings.Fields(arg)), nil
+}
+
+// pmFromFileOperator matches the phrases listed in files, relative to the
+// directory of the rule file.
+func pmFromFileOperator(dir, arg string) (func(string) bool, error) {
+	var phrases []string
+	for _, name := range strings.Fields(arg) {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			l := strings.TrimSpace(s.Text())
+			if l != "" && !strings.HasPrefix(l, "#") {
+				phrases = append(phrases, l)
+			}
+		}
+
+		err = s.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return phraseMatch(phrases), nil
+}
+
+func stringOperator(m func(v, arg string) bool) operatorFactory {
+	return func(_, arg string) (func(string) bool, error) {
+		return func(v string) bool { return m(v, arg) }, nil
+	}
+}
+
+func containsWordOperator(_, arg string) (func(string) bool, error) {
+	rx, err := regexp.Compile(`\b` + regexp.QuoteMeta(arg) + `\b`)
+	if err != nil {
+		return nil, err
+	}
+
+	return rx.MatchString, nil
+}
+
+func numberOperator(m func(v, arg int) bool) operatorFactory {
+	return func(_, arg string) (func(string) bool, error) {
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(v string) bool {
+			i, err := strconv.Atoi(strings.TrimSpace(v))
+			return err == nil && m(i, n)
+		}, nil
+	}
+}
+
+func ipMatchOperator(_, arg string) (func(string) bool, error) {
+	var nets []*net.IPNet
+	for _, s := range strings.Split(arg, ",") {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			if strings.Contains(s, ":") {
+				s += "/128"
+			} else {
+				s += "/32"
+			}
+		}
+
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+
+		nets = append(nets, n)
+	}
+
+	return func(v string) bool {
+		ip := net.ParseIP(v)
+		if ip == nil {
+			return false
+		}
+
+		for _, n := range nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+
+		return false
+	}, nil
+}
+
+// validateByteRangeOperator matches the values containing bytes outside
+// of the ranges, e.g. "9,10,13,32-126".
+func validateByteRangeOperator(_, arg string) (func(string) bool, error) {
+	var allowed [256]bool
+	for _, r := range strings.Split(arg, ",") {
+		from, to, isRange := strings.Cut(strings.TrimSpace(r), "-")
+		if !isRange {
+			to = from
+		}
+
+		f, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, err
+		}
+
+		t, err := strconv.Atoi(to)
+		if err != nil {
+			return nil, err
+		}
+
+		if f < 0 || t > 255 || f > t {
+			return nil, fmt.Errorf("invalid byte range: %s", r)
+		}
+
+		for i := f; i <= t; i++ {
+			allowed[i] = true
+		}
+	}
+
+	return func(v string) bool {
+		for i := 0; i < len(v); i++ {
+			if !allowed[v[i]] {
+				return true
+			}
+		}
+
+		return false
+	}, nil
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// invalidURLEncoding matches the values with invalid percent encoding.
+func invalidURLEncoding(v string) bool {
+	for i := 0; i < len(v); i++ {
+		if v[i] != '%' {
+			continue
+		}
+
+		if i+2 >= len(v) || !isHex(v[i+1]) || !isHex(v[i+2]) {
+			return true
+		}
+
+		i += 2
+	}
+
+	return false
+}
+
+func invalidUTF8(v string) bool {
+	return !utf8.ValidString(v)
+}
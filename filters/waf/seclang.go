@@ -0,0 +1,571 @@
+package waf
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const paranoiaTagPrefix = "paranoia-level/"
+
+var chainAction = regexp.MustCompile(`(^|[",\s])chain([",\s]|$)`)
+
+// the severity levels of ModSecurity, from 0 to 7
+var severities = []string{"EMERGENCY", "ALERT", "CRITICAL", "ERROR", "WARNING", "NOTICE", "INFO", "DEBUG"}
+
+// the anomaly score added by the matching blocking rules, by their
+// severity, like in the Core Rule Set
+var severityScores = []int{5, 5, 5, 4, 3, 2, 0, 0}
+
+type action int
+
+const (
+	actionPass action = iota
+	actionBlock
+	actionDeny
+)
+
+type rule struct {
+	id         int
+	phase      int
+	variables  []*variable
+	operator   *operator
+	transforms []transformation
+	action     action
+	status     int
+	msg        string
+	severity   int
+	paranoia   int
+
+	// chained is set when the next rule continues this one, and the
+	// rule matches only when chain matches, too
+	chained bool
+	chain   *rule
+}
+
+type ruleSet struct {
+	rules    []*rule
+	modified map[string]int64
+
+	// the rules that were not loaded, because they use features that
+	// are not supported, e.g. transaction variables
+	skipped []string
+}
+
+// unsupportedError is returned for rules using a feature that is not
+// implemented. These rules are skipped.
+type unsupportedError struct {
+	feature string
+}
+
+func (err unsupportedError) Error() string {
+	return "unsupported " + err.feature
+}
+
+// actions, that don't change how the rule is evaluated
+var ignoredActions = map[string]bool{
+	"accuracy":   true,
+	"auditlog":   true,
+	"capture":    true,
+	"log":        true,
+	"logdata":    true,
+	"maturity":   true,
+	"multiMatch": true,
+	"noauditlog": true,
+	"nolog":      true,
+	"rev":        true,
+	"ver":        true,
+}
+
+// directives, that configure the engine in ModSecurity. The filter
+// arguments and the options of the filter are used instead.
+var ignoredDirectives = map[string]bool{
+	"SecAction":                     true,
+	"SecArgumentSeparator":          true,
+	"SecAuditEngine":                true,
+	"SecAuditLog":                   true,
+	"SecAuditLogFormat":             true,
+	"SecAuditLogParts":              true,
+	"SecAuditLogRelevantStatus":     true,
+	"SecAuditLogType":               true,
+	"SecCollectionTimeout":          true,
+	"SecComponentSignature":         true,
+	"SecDebugLog":                   true,
+	"SecDebugLogLevel":              true,
+	"SecDefaultAction":              true,
+	"SecMarker":                     true,
+	"SecRequestBodyAccess":          true,
+	"SecRequestBodyInMemoryLimit":   true,
+	"SecRequestBodyLimit":           true,
+	"SecRequestBodyLimitAction":     true,
+	"SecRequestBodyNoFilesLimit":    true,
+	"SecResponseBodyAccess":         true,
+	"SecResponseBodyLimit":          true,
+	"SecResponseBodyLimitAction":    true,
+	"SecResponseBodyMimeType":       true,
+	"SecRuleEngine":                 true,
+	"SecTmpDir":                     true,
+	"SecDataDir":                    true,
+	"SecUnicodeMapFile":             true,
+	"SecRuleRemoveById":             true,
+	"SecRuleUpdateTargetById":       true,
+	"SecRuleUpdateActionById":       true,
+	"SecResponseBodyMimeTypesClear": true,
+}
+
+// loadRuleSet loads the rules from the files matching a glob pattern,
+// in the lexical order of their names.
+func loadRuleSet(pattern string) (*ruleSet, error) {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no rule files found: %s", pattern)
+	}
+
+	sort.Strings(files)
+	rs := &ruleSet{modified: make(map[string]int64)}
+	for _, f := range files {
+		if err := rs.loadFile(f); err != nil {
+			return nil, err
+		}
+	}
+
+	slices.SortStableFunc(rs.rules, func(a, b *rule) int { return a.phase - b.phase })
+	return rs, nil
+}
+
+func (rs *ruleSet) loadFile(file string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+
+	rs.modified[file] = info.ModTime().UnixNano()
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	var (
+		scanner    = bufio.NewScanner(f)
+		line       strings.Builder
+		lineNo     int
+		start      int
+		head, tail *rule
+		skipChain  bool
+	)
+
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		lineNo++
+		l := strings.TrimSpace(scanner.Text())
+		if line.Len() == 0 {
+			start = lineNo
+			if l == "" || strings.HasPrefix(l, "#") {
+				continue
+			}
+		}
+
+		if strings.HasSuffix(l, "\\") {
+			line.WriteString(strings.TrimSuffix(l, "\\"))
+			line.WriteByte(' ')
+			continue
+		}
+
+		line.WriteString(l)
+		directive := line.String()
+		line.Reset()
+
+		r, err := rs.parseDirective(filepath.Dir(file), directive)
+		var uerr unsupportedError
+		switch {
+		case errors.As(err, &uerr):
+			// the whole chain is skipped, when any of its rules is
+			// not supported
+			rs.skipped = append(rs.skipped, fmt.Sprintf("%s:%d: %v", file, start, err))
+			if head != nil {
+				rs.skipped = append(rs.skipped, fmt.Sprintf("%s: rule %d: chained to a skipped rule", file, head.id))
+				head = nil
+			}
+
+			skipChain = chainAction.MatchString(directive)
+			continue
+		case err != nil:
+			return fmt.Errorf("%s:%d: %w", file, start, err)
+		case r == nil:
+			continue
+		case skipChain:
+			rs.skipped = append(rs.skipped, fmt.Sprintf("%s:%d: chained to a skipped rule", file, start))
+			skipChain = r.chained
+			continue
+		}
+
+		if head == nil {
+			head = r
+		} else {
+			tail.chain = r
+		}
+
+		tail = r
+		if !r.chained {
+			rs.rules = append(rs.rules, head)
+			head = nil
+		}
+	}
+
+	return scanner.Err()
+}
+
+// parseDirective parses a single directive, and returns the rule, if it
+// is a SecRule.
+func (rs *ruleSet) parseDirective(dir, directive string) (*rule, error) {
+	args, err := splitArgs(directive)
+	if err != nil {
+		return nil, err
+	}
+
+	switch args[0] {
+	case "SecRule":
+		if len(args) != 3 && len(args) != 4 {
+			return nil, fmt.Errorf("invalid number of arguments for SecRule: %d", len(args)-1)
+		}
+
+		var actions string
+		if len(args) == 4 {
+			actions = args[3]
+		}
+
+		return parseRule(dir, args[1], args[2], actions)
+	case "Include":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("invalid number of arguments for Include: %d", len(args)-1)
+		}
+
+		pattern := args[1]
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		sort.Strings(files)
+		for _, f := range files {
+			if err := rs.loadFile(f); err != nil {
+				return nil, err
+			}
+		}
+
+		return nil, nil
+	default:
+		if ignoredDirectives[args[0]] {
+			return nil, nil
+		}
+
+		return nil, unsupportedError{"directive: " + args[0]}
+	}
+}
+
+// splitArgs splits a directive to its arguments, separated by
+// whitespace, and optionally double quoted.
+func splitArgs(directive string) ([]string, error) {
+	var (
+		args    []string
+		current strings.Builder
+		quoted  bool
+		inArg   bool
+	)
+
+	for i := 0; i < len(directive); i++ {
+		c := directive[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(directive) && directive[i+1] == '"':
+			current.WriteByte('"')
+			i++
+		case c == '"':
+			quoted = !quoted
+			inArg = true
+		case !quoted && (c == ' ' || c == '\t'):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteByte(c)
+			inArg = true
+		}
+	}
+
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in: %s", directive)
+	}
+
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
+
+func parseRule(dir, variables, op, actions string) (*rule, error) {
+	r := &rule{phase: 2, severity: -1}
+
+	var err error
+	if r.variables, err = parseVariables(variables); err != nil {
+		return nil, err
+	}
+
+	if r.operator, err = parseOperator(dir, op); err != nil {
+		return nil, err
+	}
+
+	if err := r.parseActions(actions); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *rule) parseActions(actions string) error {
+	for _, a := range splitActions(actions) {
+		name, value, _ := strings.Cut(a, ":")
+		name = strings.TrimSpace(name)
+		value = unquoteAction(strings.TrimSpace(value))
+		switch name {
+		case "id":
+			id, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid rule id: %q", value)
+			}
+
+			r.id = id
+		case "phase":
+			switch value {
+			case "1", "request":
+				r.phase = 1
+			case "2":
+				r.phase = 2
+			case "3", "4", "5", "response", "logging":
+				return unsupportedError{"phase: " + value}
+			default:
+				return fmt.Errorf("invalid phase: %q", value)
+			}
+		case "t":
+			if value == "none" {
+				r.transforms = nil
+				continue
+			}
+
+			t, ok := transformations[value]
+			if !ok {
+				return unsupportedError{"transformation: " + value}
+			}
+
+			r.transforms = append(r.transforms, t)
+		case "pass":
+			r.action = actionPass
+		case "block":
+			r.action = actionBlock
+		case "deny", "drop":
+			r.action = actionDeny
+		case "status":
+			status, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid status: %q", value)
+			}
+
+			r.status = status
+		case "msg":
+			r.msg = value
+		case "severity":
+			s, err := parseSeverity(value)
+			if err != nil {
+				return err
+			}
+
+			r.severity = s
+		case "tag":
+			if level, ok := strings.CutPrefix(value, paranoiaTagPrefix); ok {
+				p, err := strconv.Atoi(level)
+				if err != nil {
+					return fmt.Errorf("invalid paranoia level tag: %q", value)
+				}
+
+				r.paranoia = p
+			}
+		case "chain":
+			r.chained = true
+		case "":
+		default:
+			if ignoredActions[name] {
+				continue
+			}
+
+			return unsupportedError{"action: " + name}
+		}
+	}
+
+	return nil
+}
+
+func parseSeverity(s string) (int, error) {
+	if i, err := strconv.Atoi(s); err == nil && i >= 0 && i < len(severities) {
+		return i, nil
+	}
+
+	for i, name := range severities {
+		if strings.EqualFold(name, s) {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid severity: %q", s)
+}
+
+// splitActions splits the comma separated actions, respecting the single
+// quoted values.
+func splitActions(actions string) []string {
+	var (
+		result []string
+		quoted bool
+		start  int
+	)
+
+	for i := 0; i < len(actions); i++ {
+		switch actions[i] {
+		case '\\':
+			i++
+		case '\'':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				result = append(result, strings.TrimSpace(actions[start:i]))
+				start = i + 1
+			}
+		}
+	}
+
+	return append(result, strings.TrimSpace(actions[start:]))
+}
+
+func unquoteAction(v string) string {
+	if len(v) >= 2 && v[0] == '\'' && v[len(v)-1] == '\'' {
+		v = v[1 : len(v)-1]
+	}
+
+	return strings.ReplaceAll(v, `\'`, `'`)
+}
+
+// parseVariables parses the | separated variables of a rule. The regular
+// expression selectors, e.g. ARGS:/^id_/, may contain |, too.
+func parseVariables(s string) ([]*variable, error) {
+	var (
+		vars  []*variable
+		start int
+		inRx  bool
+	)
+
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) {
+			switch {
+			case s[i] == '/' && i > 0 && s[i-1] == ':':
+				inRx = true
+				continue
+			case inRx && s[i] == '/' && s[i-1] != '\\':
+				inRx = false
+				continue
+			case inRx || s[i] != '|':
+				continue
+			}
+		}
+
+		v, err := parseVariable(strings.TrimSpace(s[start:i]))
+		if err != nil {
+			return nil, err
+		}
+
+		vars = append(vars, v)
+		start = i + 1
+	}
+
+	// exclusions apply to the selection of the same collection
+	var result []*variable
+	for _, v := range vars {
+		if !v.exclude {
+			result = append(result, v)
+			continue
+		}
+
+		for _, r := range result {
+			if r.name == v.name {
+				r.exclusions = append(r.exclusions, v.selector)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func parseVariable(s string) (*variable, error) {
+	v := &variable{}
+	switch {
+	case strings.HasPrefix(s, "!"):
+		v.exclude = true
+		s = s[1:]
+	case strings.HasPrefix(s, "&"):
+		v.count = true
+		s = s[1:]
+	}
+
+	name, key, hasKey := strings.Cut(s, ":")
+	v.name = strings.ToUpper(name)
+	if _, ok := collections[v.name]; !ok {
+		if _, ok := emptyCollections[v.name]; !ok {
+			return nil, unsupportedError{"variable: " + v.name}
+		}
+	}
+
+	if hasKey {
+		sel, err := parseSelector(key)
+		if err != nil {
+			return nil, err
+		}
+
+		v.selector = sel
+	}
+
+	if v.exclude && v.selector == nil {
+		return nil, fmt.Errorf("exclusion without key: %s", s)
+	}
+
+	return v, nil
+}
+
+func parseSelector(key string) (*selector, error) {
+	if len(key) >= 2 && key[0] == '/' && key[len(key)-1] == '/' {
+		rx, err := regexp.Compile(key[1 : len(key)-1])
+		if err != nil {
+			return nil, err
+		}
+
+		return &selector{rx: rx}, nil
+	}
+
+	return &selector{key: strings.ToLower(strings.Trim(key, "'"))}, nil
+}
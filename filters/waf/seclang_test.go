@@ -0,0 +1,134 @@
+package waf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadRuleSet(t *testing.T) {
+	rs, err := loadRuleSet("testdata/rules/*.conf")
+	require.NoError(t, err)
+
+	var ids []int
+	for _, r := range rs.rules {
+		ids = append(ids, r.id)
+	}
+
+	// phase 1 rules first, in the order of their definition
+	assert.Equal(t, []int{913100, 100001, 100002, 930110, 941110, 942190, 942400}, ids)
+	assert.Len(t, rs.skipped, 2)
+
+	chain := rs.rules[1].chain
+	require.NotNil(t, chain)
+	assert.Equal(t, "beginsWith", chain.operator.name)
+	assert.Nil(t, chain.chain)
+}
+
+func TestSkipUnsupportedChain(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rules.conf")
+	require.NoError(t, os.WriteFile(file, []byte(`
+SecRule ARGS "@rx foo" "id:1,deny,chain"
+    SecRule TX:FOO "@eq 1" "chain"
+    SecRule ARGS "@rx bar"
+
+SecRule ARGS "@detectXSS" "id:2,deny,chain"
+    SecRule ARGS "@rx bar"
+
+SecRule ARGS "@rx baz" "id:3,deny"
+`), 0o644))
+
+	rs, err := loadRuleSet(file)
+	require.NoError(t, err)
+	require.Len(t, rs.rules, 1)
+	assert.Equal(t, 3, rs.rules[0].id)
+	assert.Len(t, rs.skipped, 5)
+}
+
+func TestParseVariables(t *testing.T) {
+	vars, err := parseVariables("REQUEST_COOKIES|!REQUEST_COOKIES:/__utm|_ga/|ARGS:ID|&REQUEST_HEADERS:Host")
+	require.NoError(t, err)
+	require.Len(t, vars, 3)
+
+	assert.Equal(t, "REQUEST_COOKIES", vars[0].name)
+	require.Len(t, vars[0].exclusions, 1)
+	assert.True(t, vars[0].exclusions[0].matches("_ga"))
+	assert.True(t, vars[0].exclusions[0].matches("__utmz"))
+
+	assert.Equal(t, "ARGS", vars[1].name)
+	assert.True(t, vars[1].selector.matches("id"))
+
+	assert.True(t, vars[2].count)
+
+	_, err = parseVariables("ARGS|TX:foo")
+	assert.ErrorAs(t, err, &unsupportedError{})
+}
+
+func TestSplitActions(t *testing.T) {
+	assert.Equal(t,
+		[]string{"id:1", "msg:'a, b'", "tag:'c\\'d'", "block"},
+		splitActions("id:1, msg:'a, b',tag:'c\\'d',block"),
+	)
+}
+
+func TestTransformations(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"urlDecode", "a%2fb+c%zz", "a/b c%zz"},
+		{"urlDecodeUni", "%u003cscript%3e", "<script>"},
+		{"htmlEntityDecode", "&lt;script&gt;", "<script>"},
+		{"compressWhitespace", "a \t\n b", "a b"},
+		{"removeWhitespace", "a \t b", "ab"},
+		{"normalizePath", "/a/./b/../c//d/", "/a/c/d/"},
+		{"normalizePathWin", `\a\..\b`, "/b"},
+		{"replaceComments", "union/**/select", "union select"},
+		{"removeComments", "select 1 -- foo", "select 1 "},
+		{"cmdLine", `C^A"T /etc/passwd`, "cat/etc/passwd"},
+		{"base64Decode", "Zm9v", "foo"},
+		{"hexDecode", "666f6f", "foo"},
+		{"length", "foo", "3"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, transformations[tc.name](tc.input))
+		})
+	}
+}
+
+func TestOperators(t *testing.T) {
+	for _, tc := range []struct {
+		operator string
+		value    string
+		match    bool
+	}{
+		{"foo.*bar", "foo-bar", true},
+		{"!@rx ^foo", "bar", true},
+		{"@pm Foo bar", "xFOOx", true},
+		{"@streq foo", "foox", false},
+		{"@within GET POST", "POST", true},
+		{"@containsWord select", "selected", false},
+		{"@gt 3", "4", true},
+		{"@ipMatch 10.0.0.0/8,192.168.1.1", "192.168.1.1", true},
+		{"@ipMatch 10.0.0.0/8", "11.0.0.1", false},
+		{"@validateByteRange 32-126", "foo\x01", true},
+		{"@validateUrlEncoding", "foo%zz", true},
+		{"@validateUtf8Encoding", "foo\xff", true},
+	} {
+		t.Run(tc.operator, func(t *testing.T) {
+			op, err := parseOperator(".", tc.operator)
+			require.NoError(t, err)
+			assert.Equal(t, tc.match, op.matches(tc.value))
+		})
+	}
+
+	_, err := parseOperator(".", "@detectSQLi")
+	assert.ErrorAs(t, err, &unsupportedError{})
+
+	_, err = parseOperator(".", "@rx %{tx.foo}")
+	assert.ErrorAs(t, err, &unsupportedError{})
+}
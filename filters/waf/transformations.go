@@ -0,0 +1,180 @@
+package waf
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"html"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type transformation func(string) string
+
+// the supported transformations, applied in the order of the t: actions
+// of the rule
+var transformations = map[string]transformation{
+	"lowercase":          strings.ToLower,
+	"uppercase":          strings.ToUpper,
+	"urlDecode":          urlDecode,
+	"urlDecodeUni":       urlDecodeUni,
+	"htmlEntityDecode":   html.UnescapeString,
+	"base64Decode":       base64Decode,
+	"hexDecode":          hexDecode,
+	"removeNulls":        func(s string) string { return strings.ReplaceAll(s, "\x00", "") },
+	"replaceNulls":       func(s string) string { return strings.ReplaceAll(s, "\x00", " ") },
+	"compressWhitespace": compressWhitespace,
+	"removeWhitespace":   removeWhitespace,
+	"trim":               strings.TrimSpace,
+	"trimLeft":           func(s string) string { return strings.TrimLeftFunc(s, unicode.IsSpace) },
+	"trimRight":          func(s string) string { return strings.TrimRightFunc(s, unicode.IsSpace) },
+	"normalisePath":      normalizePath,
+	"normalizePath":      normalizePath,
+	"normalisePathWin":   normalizePathWin,
+	"normalizePathWin":   normalizePathWin,
+	"removeComments":     removeComments,
+	"replaceComments":    replaceComments,
+	"cmdLine":            cmdLine,
+	"length":             func(s string) string { return strconv.Itoa(len(s)) },
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0'
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+// urlDecode decodes the percent encoded bytes and the + signs, keeping
+// the invalid encodings unchanged.
+func urlDecode(s string) string {
+	if !strings.ContainsAny(s, "%+") {
+		return s
+	}
+
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '+':
+			b = append(b, ' ')
+		case s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]):
+			b = append(b, unhex(s[i+1])<<4|unhex(s[i+2]))
+			i += 2
+		default:
+			b = append(b, s[i])
+		}
+	}
+
+	return string(b)
+}
+
+// urlDecodeUni decodes the %uXXXX encoding, too.
+func urlDecodeUni(s string) string {
+	if !strings.Contains(s, "%u") && !strings.Contains(s, "%U") {
+		return urlDecode(s)
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+5 < len(s) && (s[i+1] == 'u' || s[i+1] == 'U') &&
+			isHex(s[i+2]) && isHex(s[i+3]) && isHex(s[i+4]) && isHex(s[i+5]) {
+			r, _ := strconv.ParseUint(s[i+2:i+6], 16, 32)
+			b.WriteRune(rune(r))
+			i += 5
+			continue
+		}
+
+		b.WriteByte(s[i])
+	}
+
+	return urlDecode(b.String())
+}
+
+func base64Decode(s string) string {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		b, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+		if err != nil {
+			return s
+		}
+	}
+
+	return string(b)
+}
+
+func hexDecode(s string) string {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return s
+	}
+
+	return string(b)
+}
+
+func compressWhitespace(s string) string {
+	return strings.Join(strings.FieldsFunc(s, unicode.IsSpace), " ")
+}
+
+func removeWhitespace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+
+		return r
+	}, s)
+}
+
+// normalizePath removes the . and .. segments and the repeated slashes,
+// keeping the trailing slash.
+func normalizePath(s string) string {
+	if s == "" {
+		return s
+	}
+
+	n := path.Clean(s)
+	if strings.HasSuffix(s, "/") && n != "/" {
+		n += "/"
+	}
+
+	if !strings.HasPrefix(s, "/") {
+		n = strings.TrimPrefix(n, "/")
+	}
+
+	return n
+}
+
+func normalizePathWin(s string) string {
+	return normalizePath(strings.ReplaceAll(s, "\\", "/"))
+}
+
+var (
+	commentExpression  = regexp.MustCompile(`(?s)/\*.*?(\*/|$)|<!--.*?(-->|$)|--[^\r\n]*|#[^\r\n]*`)
+	cCommentExpression = regexp.MustCompile(`(?s)/\*.*?(\*/|$)`)
+	cmdLineEscapes     = strings.NewReplacer(`\`, "", `"`, "", `'`, "", `^`, "")
+	cmdLineSpaces      = regexp.MustCompile(`[\s,;]+`)
+	cmdLineOperators   = regexp.MustCompile(`\s*([/(])`)
+)
+
+func removeComments(s string) string {
+	return commentExpression.ReplaceAllString(s, "")
+}
+
+func replaceComments(s string) string {
+	return cCommentExpression.ReplaceAllString(s, " ")
+}
+
+// cmdLine normalizes command line arguments, like ModSecurity does, to
+// detect the evasions of command injections.
+func cmdLine(s string) string {
+	s = cmdLineEscapes.Replace(s)
+	s = cmdLineSpaces.ReplaceAllString(s, " ")
+	s = cmdLineOperators.ReplaceAllString(s, "$1")
+	return strings.ToLower(s)
+}
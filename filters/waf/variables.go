@@ -0,0 +1,247 @@
+package waf
+
+import (
+	"encoding/json"
+	"maps"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// field is a single value of a variable. The key is empty for the
+// variables with a single value, e.g. REQUEST_URI.
+type field struct {
+	key   string
+	value string
+}
+
+type transaction struct {
+	method      string
+	uri         string
+	filename    string
+	protocol    string
+	queryString string
+	remoteAddr  string
+	body        string
+	argsGet     []field
+	argsPost    []field
+	headers     []field
+	cookies     []field
+}
+
+type selector struct {
+	key string
+	rx  *regexp.Regexp
+}
+
+type variable struct {
+	name       string
+	selector   *selector
+	exclusions []*selector
+	exclude    bool
+	count      bool
+}
+
+func scalar(v string) []field { return []field{{value: v}} }
+
+func names(fields []field) []field {
+	n := make([]field, len(fields))
+	for i, f := range fields {
+		n[i] = field{key: f.key, value: f.key}
+	}
+
+	return n
+}
+
+// the supported variables
+var collections = map[string]func(*transaction) []field{
+	"ARGS":                  func(t *transaction) []field { return append(append([]field(nil), t.argsGet...), t.argsPost...) },
+	"ARGS_GET":              func(t *transaction) []field { return t.argsGet },
+	"ARGS_POST":             func(t *transaction) []field { return t.argsPost },
+	"ARGS_NAMES":            func(t *transaction) []field { return names(append(append([]field(nil), t.argsGet...), t.argsPost...)) },
+	"ARGS_GET_NAMES":        func(t *transaction) []field { return names(t.argsGet) },
+	"ARGS_POST_NAMES":       func(t *transaction) []field { return names(t.argsPost) },
+	"REQUEST_HEADERS":       func(t *transaction) []field { return t.headers },
+	"REQUEST_HEADERS_NAMES": func(t *transaction) []field { return names(t.headers) },
+	"REQUEST_COOKIES":       func(t *transaction) []field { return t.cookies },
+	"REQUEST_COOKIES_NAMES": func(t *transaction) []field { return names(t.cookies) },
+	"REQUEST_METHOD":        func(t *transaction) []field { return scalar(t.method) },
+	"REQUEST_URI":           func(t *transaction) []field { return scalar(t.uri) },
+	"REQUEST_URI_RAW":       func(t *transaction) []field { return scalar(t.uri) },
+	"REQUEST_FILENAME":      func(t *transaction) []field { return scalar(t.filename) },
+	"REQUEST_BASENAME":      func(t *transaction) []field { return scalar(path.Base(t.filename)) },
+	"REQUEST_LINE":          func(t *transaction) []field { return scalar(t.method + " " + t.uri + " " + t.protocol) },
+	"REQUEST_PROTOCOL":      func(t *transaction) []field { return scalar(t.protocol) },
+	"QUERY_STRING":          func(t *transaction) []field { return scalar(t.queryString) },
+	"REQUEST_BODY":          func(t *transaction) []field { return scalar(t.body) },
+	"REQUEST_BODY_LENGTH":   func(t *transaction) []field { return scalar(strconv.Itoa(len(t.body))) },
+	"REMOTE_ADDR":           func(t *transaction) []field { return scalar(t.remoteAddr) },
+}
+
+// the variables, that are accepted in the rules, but are always empty,
+// because the filter doesn't parse the content they refer to
+var emptyCollections = map[string]struct{}{
+	"FILES":                  {},
+	"FILES_NAMES":            {},
+	"MULTIPART_FILENAME":     {},
+	"MULTIPART_NAME":         {},
+	"MULTIPART_PART_HEADERS": {},
+	"XML":                    {},
+}
+
+func (s *selector) matches(key string) bool {
+	if s.rx != nil {
+		return s.rx.MatchString(key)
+	}
+
+	return strings.ToLower(key) == s.key
+}
+
+// values returns the values of the variable in a transaction.
+func (v *variable) values(t *transaction) []field {
+	get, ok := collections[v.name]
+	if !ok {
+		return nil
+	}
+
+	var values []field
+	for _, f := range get(t) {
+		if v.selector != nil && !v.selector.matches(f.key) {
+			continue
+		}
+
+		excluded := false
+		for _, e := range v.exclusions {
+			if e.matches(f.key) {
+				excluded = true
+				break
+			}
+		}
+
+		if !excluded {
+			values = append(values, f)
+		}
+	}
+
+	if v.count {
+		return scalar(strconv.Itoa(len(values)))
+	}
+
+	return values
+}
+
+// fieldName returns the name of the matched value, as reported in the
+// audit log, e.g. ARGS:id.
+func (v *variable) fieldName(f field) string {
+	if f.key == "" || v.count {
+		return v.name
+	}
+
+	return v.name + ":" + f.key
+}
+
+func newTransaction(req *http.Request, body []byte) *transaction {
+	t := &transaction{
+		method:      req.Method,
+		uri:         req.URL.RequestURI(),
+		filename:    req.URL.EscapedPath(),
+		protocol:    req.Proto,
+		queryString: req.URL.RawQuery,
+		body:        string(body),
+		argsGet:     queryFields(req.URL.RawQuery),
+	}
+
+	if req.RequestURI != "" {
+		t.uri = req.RequestURI
+	}
+
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		t.remoteAddr = host
+	} else {
+		t.remoteAddr = req.RemoteAddr
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(req.Header)) {
+		for _, v := range req.Header[name] {
+			t.headers = append(t.headers, field{key: name, value: v})
+		}
+	}
+
+	if req.Host != "" && req.Header.Get("Host") == "" {
+		t.headers = append(t.headers, field{key: "Host", value: req.Host})
+	}
+
+	for _, c := range req.Cookies() {
+		t.cookies = append(t.cookies, field{key: c.Name, value: c.Value})
+	}
+
+	if len(body) > 0 {
+		mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		switch {
+		case mediaType == "application/x-www-form-urlencoded":
+			t.argsPost = queryFields(string(body))
+		case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+			var v any
+			if json.Unmarshal(body, &v) == nil {
+				t.argsPost = jsonFields("json", v, nil)
+			}
+		}
+	}
+
+	return t
+}
+
+// queryFields parses the query in the order of the parameters.
+func queryFields(query string) []field {
+	var fields []field
+	for query != "" {
+		var kv string
+		kv, query, _ = strings.Cut(query, "&")
+		if kv == "" {
+			continue
+		}
+
+		k, v, _ := strings.Cut(kv, "=")
+		if uk, err := url.QueryUnescape(k); err == nil {
+			k = uk
+		}
+
+		if uv, err := url.QueryUnescape(v); err == nil {
+			v = uv
+		}
+
+		fields = append(fields, field{key: k, value: v})
+	}
+
+	return fields
+}
+
+// jsonFields flattens a JSON document to arguments, named by the path of
+// the values, e.g. json.user.name, like ModSecurity does.
+func jsonFields(prefix string, v any, fields []field) []field {
+	switch v := v.(type) {
+	case map[string]any:
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			fields = jsonFields(prefix+"."+k, v[k], fields)
+		}
+	case []any:
+		for i, vv := range v {
+			fields = jsonFields(prefix+"."+strconv.Itoa(i), vv, fields)
+		}
+	case string:
+		fields = append(fields, field{key: prefix, value: v})
+	case nil:
+		fields = append(fields, field{key: prefix})
+	default:
+		b, _ := json.Marshal(v)
+		fields = append(fields, field{key: prefix, value: string(b)})
+	}
+
+	return fields
+}
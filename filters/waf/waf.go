@@ -0,0 +1,402 @@
+package waf
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/accesslog"
+	"github.com/zalando/skipper/filters/flowid"
+	snet "github.com/zalando/skipper/net"
+)
+
+const (
+	// DetectionOnly mode only reports the matching rules, without
+	// blocking the requests.
+	DetectionOnly = "detect"
+
+	// Blocking mode rejects the requests, that match a denying rule, or
+	// reach the anomaly threshold.
+	Blocking = "block"
+
+	// DefaultMaxBodySize is the default maximum size of the request
+	// body, that is inspected.
+	DefaultMaxBodySize = 128 << 10
+
+	// AnomalyThreshold is the anomaly score, from which the requests
+	// are blocked. The matching blocking rules add a score based on
+	// their severity: 5 for critical, 4 for error, 3 for warning and 2
+	// for notice, like in the Core Rule Set.
+	AnomalyThreshold = 5
+
+	// AccessLogRuleIDsKey is the key of the matching rule IDs in the
+	// access log.
+	AccessLogRuleIDsKey = "waf-rule-ids"
+
+	// AccessLogBlockedKey is the key of the access log entry field,
+	// that tells whether the request was blocked.
+	AccessLogBlockedKey = "waf-blocked"
+
+	maxMatchedData = 128
+)
+
+// Options configures the waf filter specification.
+type Options struct {
+
+	// MaxBodySize is the maximum number of bytes inspected from the
+	// request bodies. The rest of the body is forwarded without
+	// inspection. Defaults to DefaultMaxBodySize.
+	MaxBodySize int64
+
+	// AuditLog receives a JSON entry for every request, that matched
+	// any rule. Defaults to os.Stderr.
+	AuditLog io.Writer
+}
+
+type spec struct {
+	options Options
+
+	mu       sync.Mutex
+	ruleSets map[string]*ruleSet
+}
+
+type filter struct {
+	rules       *ruleSet
+	mode        string
+	paranoia    int
+	maxBodySize int64
+	auditLog    io.Writer
+}
+
+type match struct {
+	rule     *rule
+	variable string
+	data     string
+}
+
+type evaluation struct {
+	matches []*match
+	score   int
+	deny    *rule
+}
+
+type auditRule struct {
+	ID       int    `json:"id"`
+	Message  string `json:"message,omitempty"`
+	Severity string `json:"severity,omitempty"`
+	Variable string `json:"variable"`
+	Data     string `json:"data,omitempty"`
+}
+
+type auditEntry struct {
+	Method       string      `json:"method"`
+	Host         string      `json:"host"`
+	Path         string      `json:"path"`
+	FlowID       string      `json:"flowId,omitempty"`
+	Mode         string      `json:"mode"`
+	Blocked      bool        `json:"blocked"`
+	AnomalyScore int         `json:"anomalyScore"`
+	Rules        []auditRule `json:"rules"`
+}
+
+// NewWAF creates the specification of the waf filter. The rule sets are
+// loaded once, and shared by the routes referencing the same rule files,
+// until any of the files is modified.
+func NewWAF(o Options) filters.Spec {
+	if o.MaxBodySize <= 0 {
+		o.MaxBodySize = DefaultMaxBodySize
+	}
+
+	if o.AuditLog == nil {
+		o.AuditLog = os.Stderr
+	}
+
+	return &spec{options: o, ruleSets: make(map[string]*ruleSet)}
+}
+
+func (*spec) Name() string { return filters.WAFName }
+
+func (s *spec) CreateFilter(args []interface{}) (filters.Filter, error) {
+	if len(args) < 1 || len(args) > 3 {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	pattern, ok := args[0].(string)
+	if !ok || pattern == "" {
+		return nil, filters.ErrInvalidFilterParameters
+	}
+
+	f := &filter{
+		mode:        Blocking,
+		paranoia:    1,
+		maxBodySize: s.options.MaxBodySize,
+		auditLog:    s.options.AuditLog,
+	}
+
+	if len(args) > 1 {
+		mode, ok := args[1].(string)
+		if !ok || mode != DetectionOnly && mode != Blocking {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		f.mode = mode
+	}
+
+	if len(args) > 2 {
+		var p int
+		switch v := args[2].(type) {
+		case int:
+			p = v
+		case float64:
+			p = int(v)
+		default:
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		if p < 1 || p > 4 {
+			return nil, filters.ErrInvalidFilterParameters
+		}
+
+		f.paranoia = p
+	}
+
+	rs, err := s.load(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	f.rules = rs
+	return f, nil
+}
+
+// load returns the cached rule set, or loads it when it was not loaded
+// yet or any of its files was modified since.
+func (s *spec) load(pattern string) (*ruleSet, error) {
+	pattern, err := filepath.Abs(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rs, ok := s.ruleSets[pattern]; ok && !rs.changed(pattern) {
+		return rs, nil
+	}
+
+	rs, err := loadRuleSet(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rs.skipped) > 0 {
+		log.Warnf("%s: skipped %d unsupported rules of %s", filters.WAFName, len(rs.skipped), pattern)
+		for _, sk := range rs.skipped {
+			log.Debugf("%s: skipped rule: %s", filters.WAFName, sk)
+		}
+	}
+
+	s.ruleSets[pattern] = rs
+	return rs, nil
+}
+
+// changed tells whether the files of the rule set were modified, or the
+// pattern matches different files.
+func (rs *ruleSet) changed(pattern string) bool {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return true
+	}
+
+	for _, f := range files {
+		if _, ok := rs.modified[f]; !ok {
+			return true
+		}
+	}
+
+	for f, modified := range rs.modified {
+		info, err := os.Stat(f)
+		if err != nil || info.ModTime().UnixNano() != modified {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *filter) Request(ctx filters.FilterContext) {
+	req := ctx.Request()
+
+	var body []byte
+	body, req.Body, _ = snet.PeekBody(req.Body, f.maxBodySize)
+
+	e := f.rules.evaluate(newTransaction(req, body), f.paranoia, f.mode == Blocking)
+	if len(e.matches) == 0 {
+		return
+	}
+
+	blocked := f.mode == Blocking && e.blocks()
+	f.report(ctx, e, blocked)
+	if !blocked {
+		return
+	}
+
+	status := http.StatusForbidden
+	if e.deny != nil && e.deny.status != 0 {
+		status = e.deny.status
+	}
+
+	ctx.Serve(&http.Response{StatusCode: status})
+}
+
+func (*filter) Response(filters.FilterContext) {}
+
+func (e *evaluation) blocks() bool {
+	return e.deny != nil || e.score >= AnomalyThreshold
+}
+
+// evaluate evaluates the rules up to the paranoia level, in the order
+// of their phase and their definition. In blocking mode, the evaluation
+// stops at the first matching denying rule.
+func (rs *ruleSet) evaluate(t *transaction, paranoia int, blocking bool) *evaluation {
+	e := &evaluation{}
+	for _, r := range rs.rules {
+		if r.paranoia > paranoia {
+			continue
+		}
+
+		m := r.evaluate(t)
+		if m == nil {
+			continue
+		}
+
+		e.matches = append(e.matches, m)
+		switch r.action {
+		case actionDeny:
+			if e.deny == nil {
+				e.deny = r
+			}
+
+			if blocking {
+				return e
+			}
+		case actionBlock:
+			if r.severity < 0 {
+				e.score += AnomalyThreshold
+			} else {
+				e.score += severityScores[r.severity]
+			}
+		}
+	}
+
+	return e
+}
+
+// evaluate returns the first match of the rule, when all the rules of
+// its chain match, too.
+func (r *rule) evaluate(t *transaction) *match {
+	m := r.match(t)
+	if m == nil {
+		return nil
+	}
+
+	for c := r.chain; c != nil; c = c.chain {
+		if c.match(t) == nil {
+			return nil
+		}
+	}
+
+	return m
+}
+
+func (r *rule) match(t *transaction) *match {
+	for _, v := range r.variables {
+		for _, f := range v.values(t) {
+			value := f.value
+			for _, tr := range r.transforms {
+				value = tr(value)
+			}
+
+			if r.operator.matches(value) {
+				return &match{rule: r, variable: v.fieldName(f), data: truncate(f.value)}
+			}
+		}
+	}
+
+	return nil
+}
+
+func truncate(s string) string {
+	if len(s) <= maxMatchedData {
+		return s
+	}
+
+	return s[:maxMatchedData] + "..."
+}
+
+func (e *evaluation) ruleIDs() []string {
+	var ids []string
+	for _, m := range e.matches {
+		id := strconv.Itoa(m.rule.id)
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+// report writes the audit log entry, and adds the matched rules to the
+// access log and the tracing span.
+func (f *filter) report(ctx filters.FilterContext, e *evaluation, blocked bool) {
+	req := ctx.Request()
+	entry := auditEntry{
+		Method:       req.Method,
+		Host:         req.Host,
+		Path:         req.URL.Path,
+		FlowID:       req.Header.Get(flowid.HeaderName),
+		Mode:         f.mode,
+		Blocked:      blocked,
+		AnomalyScore: e.score,
+	}
+
+	for _, m := range e.matches {
+		ar := auditRule{ID: m.rule.id, Message: m.rule.msg, Variable: m.variable, Data: m.data}
+		if m.rule.severity >= 0 {
+			ar.Severity = severities[m.rule.severity]
+		}
+
+		entry.Rules = append(entry.Rules, ar)
+	}
+
+	if err := json.NewEncoder(f.auditLog).Encode(&entry); err != nil {
+		ctx.Logger().Errorf("%s: failed to write audit log: %v", filters.WAFName, err)
+	}
+
+	ids := strings.Join(e.ruleIDs(), " ")
+
+	bag := ctx.StateBag()
+	additional, ok := bag[accesslog.AccessLogAdditionalDataKey].(map[string]interface{})
+	if !ok {
+		additional = make(map[string]interface{})
+		bag[accesslog.AccessLogAdditionalDataKey] = additional
+	}
+
+	additional[AccessLogRuleIDsKey] = ids
+	additional[AccessLogBlockedKey] = blocked
+
+	if span := ctx.ParentSpan(); span != nil {
+		span.SetTag("waf.rule_ids", ids)
+		span.SetTag("waf.anomaly_score", e.score)
+		span.SetTag("waf.blocked", blocked)
+	}
+}
@@ -0,0 +1,311 @@
+package waf_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/accesslog"
+	"github.com/zalando/skipper/filters/filtertest"
+	"github.com/zalando/skipper/filters/waf"
+)
+
+const testRules = "testdata/rules/*.conf"
+
+type auditEntry struct {
+	Method       string `json:"method"`
+	Path         string `json:"path"`
+	Mode         string `json:"mode"`
+	Blocked      bool   `json:"blocked"`
+	AnomalyScore int    `json:"anomalyScore"`
+	Rules        []struct {
+		ID       int    `json:"id"`
+		Message  string `json:"message"`
+		Severity string `json:"severity"`
+		Variable string `json:"variable"`
+		Data     string `json:"data"`
+	} `json:"rules"`
+}
+
+func TestCreateFilter(t *testing.T) {
+	spec := waf.NewWAF(waf.Options{})
+	assert.Equal(t, filters.WAFName, spec.Name())
+
+	for _, tc := range []struct {
+		name string
+		args []interface{}
+	}{
+		{"no args", nil},
+		{"not a string", []interface{}{1}},
+		{"empty pattern", []interface{}{""}},
+		{"no files", []interface{}{"testdata/missing/*.conf"}},
+		{"invalid mode", []interface{}{testRules, "foo"}},
+		{"invalid paranoia level", []interface{}{testRules, waf.Blocking, 5}},
+		{"paranoia level not a number", []interface{}{testRules, waf.Blocking, "2"}},
+		{"too many args", []interface{}{testRules, waf.Blocking, 1, 2}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := spec.CreateFilter(tc.args)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := spec.CreateFilter([]interface{}{testRules, waf.DetectionOnly, 2.0})
+	assert.NoError(t, err)
+}
+
+func TestCreateFilterInvalidRules(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		rules string
+	}{
+		{"unterminated quote", `SecRule ARGS "@rx foo`},
+		{"invalid regexp", `SecRule ARGS "@rx (" "id:1,block"`},
+		{"invalid id", `SecRule ARGS "@rx foo" "id:foo,block"`},
+		{"invalid severity", `SecRule ARGS "@rx foo" "id:1,block,severity:'FOO'"`},
+		{"missing data file", `SecRule ARGS "@pmFromFile missing.data" "id:1,block"`},
+		{"missing arguments", `SecRule ARGS`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "rules.conf")
+			require.NoError(t, os.WriteFile(file, []byte(tc.rules), 0o644))
+
+			_, err := waf.NewWAF(waf.Options{}).CreateFilter([]interface{}{file})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestWAF(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		args     []interface{}
+		method   string
+		url      string
+		header   http.Header
+		body     string
+		status   int
+		blocked  bool
+		score    int
+		rules    []int
+		variable string
+	}{{
+		name: "clean request",
+		url:  "/pets?name=Tom",
+	}, {
+		name:     "path traversal in the query",
+		url:      "/files?name=..%2f..%2fetc%2fpasswd",
+		status:   http.StatusForbidden,
+		blocked:  true,
+		score:    5,
+		rules:    []int{930110},
+		variable: "REQUEST_URI",
+	}, {
+		name:   "excluded header",
+		url:    "/pets",
+		header: http.Header{"Referer": []string{"https://example.org/a/../b"}},
+	}, {
+		name:     "scanner user agent",
+		url:      "/pets",
+		header:   http.Header{"User-Agent": []string{"Mozilla/5.00 (Nikto/2.1.6)"}},
+		status:   http.StatusForbidden,
+		blocked:  true,
+		score:    5,
+		rules:    []int{913100},
+		variable: "REQUEST_HEADERS:User-Agent",
+	}, {
+		name:     "xss in json body",
+		method:   "POST",
+		url:      "/pets",
+		header:   http.Header{"Content-Type": []string{"application/json"}},
+		body:     `{"pet": {"name": "&lt;script&gt;alert(1)&lt;/script&gt;"}}`,
+		status:   http.StatusForbidden,
+		blocked:  true,
+		score:    5,
+		rules:    []int{941110},
+		variable: "ARGS:json.pet.name",
+	}, {
+		name:     "sql injection in form body",
+		method:   "POST",
+		url:      "/login",
+		header:   http.Header{"Content-Type": []string{"application/x-www-form-urlencoded"}},
+		body:     "user=" + url.QueryEscape("' UNION/**/SELECT password FROM users --"),
+		status:   http.StatusForbidden,
+		blocked:  true,
+		score:    5,
+		rules:    []int{942190},
+		variable: "ARGS:user",
+	}, {
+		name:    "detection only",
+		args:    []interface{}{testRules, waf.DetectionOnly},
+		url:     "/files?name=../../etc/passwd",
+		blocked: false,
+		score:   5,
+		rules:   []int{930110},
+	}, {
+		name: "paranoia level 1 ignores higher level rules",
+		url:  "/search?q=select+a+pet",
+	}, {
+		name:  "paranoia level 2 below the anomaly threshold",
+		args:  []interface{}{testRules, waf.Blocking, 2},
+		url:   "/search?q=select+a+pet",
+		score: 3,
+		rules: []int{942400},
+	}, {
+		name:     "deny chain",
+		method:   "DELETE",
+		url:      "/admin//users/1",
+		status:   http.StatusMethodNotAllowed,
+		blocked:  true,
+		rules:    []int{100001},
+		variable: "REQUEST_METHOD",
+	}, {
+		name:   "partial chain",
+		method: "DELETE",
+		url:    "/pets/1",
+	}, {
+		name:     "pass rule",
+		url:      "/pets",
+		header:   http.Header{"X-Debug": []string{"1"}},
+		rules:    []int{100002},
+		variable: "REQUEST_HEADERS",
+	}, {
+		name:   "body beyond the limit is not inspected",
+		method: "POST",
+		url:    "/pets",
+		header: http.Header{"Content-Type": []string{"application/x-www-form-urlencoded"}},
+		body:   "name=" + strings.Repeat("a", 64) + "&tag=<script>",
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			var audit bytes.Buffer
+			args := tc.args
+			if args == nil {
+				args = []interface{}{testRules}
+			}
+
+			f, err := waf.NewWAF(waf.Options{MaxBodySize: 64, AuditLog: &audit}).CreateFilter(args)
+			require.NoError(t, err)
+
+			method := tc.method
+			if method == "" {
+				method = "GET"
+			}
+
+			req := httptest.NewRequest(method, tc.url, strings.NewReader(tc.body))
+			for k, v := range tc.header {
+				req.Header[k] = v
+			}
+
+			ctx := &filtertest.Context{FRequest: req, FStateBag: make(map[string]interface{})}
+			f.Request(ctx)
+
+			if tc.status == 0 {
+				require.False(t, ctx.FServed, "the request should not be blocked")
+
+				// the complete body is forwarded
+				b, err := io.ReadAll(ctx.FRequest.Body)
+				require.NoError(t, err)
+				assert.Equal(t, tc.body, string(b))
+			} else {
+				require.True(t, ctx.FServed, "the request should be blocked")
+				assert.Equal(t, tc.status, ctx.FResponse.StatusCode)
+			}
+
+			if len(tc.rules) == 0 {
+				assert.Empty(t, audit.String())
+				assert.Nil(t, ctx.FStateBag[accesslog.AccessLogAdditionalDataKey])
+				return
+			}
+
+			var entry auditEntry
+			require.NoError(t, json.Unmarshal(audit.Bytes(), &entry))
+			assert.Equal(t, tc.blocked, entry.Blocked)
+			assert.Equal(t, tc.score, entry.AnomalyScore)
+			assert.Equal(t, method, entry.Method)
+
+			var ids []int
+			for _, r := range entry.Rules {
+				ids = append(ids, r.ID)
+				assert.NotEmpty(t, r.Message)
+			}
+
+			assert.Equal(t, tc.rules, ids)
+			if tc.variable != "" {
+				assert.Equal(t, tc.variable, entry.Rules[0].Variable)
+			}
+
+			additional := ctx.FStateBag[accesslog.AccessLogAdditionalDataKey].(map[string]interface{})
+			assert.Equal(t, tc.blocked, additional[waf.AccessLogBlockedKey])
+			assert.NotEmpty(t, additional[waf.AccessLogRuleIDsKey])
+		})
+	}
+}
+
+func TestAccessLogData(t *testing.T) {
+	f, err := waf.NewWAF(waf.Options{AuditLog: io.Discard}).CreateFilter([]interface{}{testRules})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/files?a=../etc/passwd&b=<script>", nil)
+	ctx := &filtertest.Context{FRequest: req, FStateBag: map[string]interface{}{
+		accesslog.AccessLogAdditionalDataKey: map[string]interface{}{"foo": "bar"},
+	}}
+
+	f.Request(ctx)
+
+	assert.Equal(t, map[string]interface{}{
+		"foo":                   "bar",
+		waf.AccessLogRuleIDsKey: "930110 941110",
+		waf.AccessLogBlockedKey: true,
+	}, ctx.FStateBag[accesslog.AccessLogAdditionalDataKey])
+}
+
+func TestRulesAreShared(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "rules.conf")
+	write := func(pattern string, mtime time.Time) {
+		rule := `SecRule ARGS "@contains ` + pattern + `" "id:1,phase:1,deny,msg:'test'"`
+		require.NoError(t, os.WriteFile(file, []byte(rule), 0o644))
+		require.NoError(t, os.Chtimes(file, mtime, mtime))
+	}
+
+	blocked := func(f filters.Filter, query string) bool {
+		ctx := &filtertest.Context{FRequest: httptest.NewRequest("GET", "/?q="+query, nil), FStateBag: make(map[string]interface{})}
+		f.Request(ctx)
+		return ctx.FServed
+	}
+
+	spec := waf.NewWAF(waf.Options{AuditLog: io.Discard})
+	now := time.Now()
+	write("foo", now)
+
+	f1, err := spec.CreateFilter([]interface{}{filepath.Join(dir, "*.conf")})
+	require.NoError(t, err)
+
+	// changing the content without changing the modification time
+	// keeps using the loaded rules
+	write("bar", now)
+	f2, err := spec.CreateFilter([]interface{}{filepath.Join(dir, "*.conf")})
+	require.NoError(t, err)
+	assert.True(t, blocked(f2, "foo"))
+
+	write("bar", now.Add(time.Second))
+	f3, err := spec.CreateFilter([]interface{}{filepath.Join(dir, "*.conf")})
+	require.NoError(t, err)
+	assert.True(t, blocked(f3, "bar"))
+	assert.False(t, blocked(f3, "foo"))
+
+	// the previous filters keep their rules
+	assert.True(t, blocked(f1, "foo"))
+}
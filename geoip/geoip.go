@@ -0,0 +1,302 @@
+/*
+Package geoip looks up the country, the continent and the autonomous
+system of IP addresses in databases of the MaxMind DB format, like the
+GeoLite2 and GeoIP2 Country, City and ASN databases.
+
+More than one database can be used, e.g. a country and an ASN
+database. The fields of the lookup result are taken from the first
+database containing them. The databases are reloaded in the background,
+when their files change.
+
+The address of a request is determined the same way as by the Source,
+SourceFromLast and ClientIP predicates, depending on the ClientIP
+option. By default, it is the last address of the X-Forwarded-For
+header, appended by the closest proxy, or the remote address, because
+the other addresses of the header can be set by the clients.
+*/
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	log "github.com/sirupsen/logrus"
+
+	snet "github.com/zalando/skipper/net"
+)
+
+const (
+	// Source uses the first address of the X-Forwarded-For header, or
+	// the remote address, like the Source predicate.
+	Source = "source"
+
+	// SourceFromLast uses the last address of the X-Forwarded-For
+	// header, or the remote address, like the SourceFromLast predicate.
+	SourceFromLast = "sourceFromLast"
+
+	// ClientIP uses the remote address of the connection, like the
+	// ClientIP predicate.
+	ClientIP = "clientIP"
+
+	// DefaultCheckInterval is used when Options.CheckInterval is not
+	// set.
+	DefaultCheckInterval = time.Minute
+)
+
+// Options configures the GeoIP databases.
+type Options struct {
+	// Files are the paths of the database files.
+	Files []string
+
+	// ClientIP tells which address of a request is looked up: Source,
+	// SourceFromLast or ClientIP. Defaults to SourceFromLast.
+	ClientIP string
+
+	// CheckInterval sets how often the files are checked for changes.
+	CheckInterval time.Duration
+}
+
+// Record contains the result of a lookup. The fields not found in the
+// databases are empty.
+type Record struct {
+	// Country is the ISO 3166-1 code of the country, e.g. DE. When the
+	// location of the address is not known, it is the country, where
+	// the network is registered.
+	Country string
+
+	// Continent is the code of the continent, e.g. EU.
+	Continent string
+
+	// ASN is the number of the autonomous system.
+	ASN uint
+
+	// ASOrganization is the organization of the autonomous system.
+	ASOrganization string
+}
+
+// ASNString returns the autonomous system number, or an empty string,
+// when it is not known.
+func (r Record) ASNString() string {
+	if r.ASN == 0 {
+		return ""
+	}
+
+	return strconv.FormatUint(uint64(r.ASN), 10)
+}
+
+// mmdbRecord contains the used fields of the data records of the
+// databases. The other fields of the records are not decoded.
+type mmdbRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+
+	Continent struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"continent"`
+
+	ASN            uint   `maxminddb:"autonomous_system_number"`
+	ASOrganization string `maxminddb:"autonomous_system_organization"`
+}
+
+type file struct {
+	path     string
+	modified time.Time
+	size     int64
+	reader   *maxminddb.Reader
+}
+
+// Database looks up the addresses in the configured database files.
+type Database struct {
+	options Options
+	files   atomic.Pointer[[]*file]
+	quit    chan struct{}
+	once    sync.Once
+	done    sync.WaitGroup
+}
+
+// New loads the database files, and starts checking them for changes.
+// It fails when any of the files can't be loaded. Close stops checking
+// the files.
+func New(o Options) (*Database, error) {
+	if len(o.Files) == 0 {
+		return nil, fmt.Errorf("no GeoIP database files")
+	}
+
+	switch o.ClientIP {
+	case "":
+		o.ClientIP = SourceFromLast
+	case Source, SourceFromLast, ClientIP:
+	default:
+		return nil, fmt.Errorf("invalid GeoIP client IP: %s", o.ClientIP)
+	}
+
+	if o.CheckInterval <= 0 {
+		o.CheckInterval = DefaultCheckInterval
+	}
+
+	var files []*file
+	for _, p := range o.Files {
+		f, err := load(p)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Infof("Loaded GeoIP database %s: %s", p, f.reader.Metadata.DatabaseType)
+		files = append(files, f)
+	}
+
+	db := &Database{options: o, quit: make(chan struct{})}
+	db.files.Store(&files)
+
+	db.done.Add(1)
+	go db.checkFiles()
+
+	return db, nil
+}
+
+func load(path string) (*file, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load GeoIP database: %w", err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load GeoIP database: %w", err)
+	}
+
+	r, err := maxminddb.FromBytes(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load GeoIP database %s: %w", path, err)
+	}
+
+	return &file{path: path, modified: info.ModTime(), size: info.Size(), reader: r}, nil
+}
+
+func (db *Database) checkFiles() {
+	defer db.done.Done()
+
+	ticker := time.NewTicker(db.options.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-db.quit:
+			return
+		case <-ticker.C:
+			db.reload()
+		}
+	}
+}
+
+// reload loads the changed files. A file that fails to load is used
+// in its previous version.
+func (db *Database) reload() {
+	current := *db.files.Load()
+	files := make([]*file, len(current))
+	changed := false
+	for i, f := range current {
+		files[i] = f
+
+		info, err := os.Stat(f.path)
+		if err != nil || info.ModTime().Equal(f.modified) && info.Size() == f.size {
+			continue
+		}
+
+		loaded, err := load(f.path)
+		if err != nil {
+			log.Errorf("Failed to reload GeoIP database: %v", err)
+			continue
+		}
+
+		log.Infof("Reloaded GeoIP database %s", f.path)
+		files[i] = loaded
+		changed = true
+	}
+
+	if changed {
+		db.files.Store(&files)
+	}
+}
+
+// Close stops checking the files for changes.
+func (db *Database) Close() {
+	db.once.Do(func() {
+		close(db.quit)
+		db.done.Wait()
+	})
+}
+
+// Lookup returns the record of the address.
+func (db *Database) Lookup(addr netip.Addr) Record {
+	var rec Record
+	if !addr.IsValid() {
+		return rec
+	}
+
+	ip := net.IP(addr.Unmap().AsSlice())
+	for _, f := range *db.files.Load() {
+		var mr mmdbRecord
+		if err := f.reader.Lookup(ip, &mr); err != nil {
+			// e.g. an IPv6 address in an IPv4 database
+			continue
+		}
+
+		if rec.Country == "" {
+			rec.Country = mr.Country.ISOCode
+		}
+
+		if rec.Country == "" {
+			rec.Country = mr.RegisteredCountry.ISOCode
+		}
+
+		if rec.Continent == "" {
+			rec.Continent = mr.Continent.Code
+		}
+
+		if rec.ASN == 0 {
+			rec.ASN = mr.ASN
+		}
+
+		if rec.ASOrganization == "" {
+			rec.ASOrganization = mr.ASOrganization
+		}
+	}
+
+	rec.Country = strings.ToUpper(rec.Country)
+	rec.Continent = strings.ToUpper(rec.Continent)
+	return rec
+}
+
+// Addr returns the address of the request, that is looked up.
+func (db *Database) Addr(r *http.Request) netip.Addr {
+	switch db.options.ClientIP {
+	case SourceFromLast:
+		return snet.RemoteAddrFromLast(r)
+	case ClientIP:
+		h, _, _ := net.SplitHostPort(r.RemoteAddr)
+		addr, _ := netip.ParseAddr(h)
+		return addr
+	default:
+		return snet.RemoteAddr(r)
+	}
+}
+
+// LookupRequest returns the record of the address of the request.
+func (db *Database) LookupRequest(r *http.Request) Record {
+	return db.Lookup(db.Addr(r))
+}
@@ -0,0 +1,209 @@
+package geoip_test
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando/skipper/geoip"
+	"github.com/zalando/skipper/geoip/geoiptest"
+)
+
+func country(iso, continent string) map[string]any {
+	return map[string]any{
+		"continent": map[string]any{
+			"code":       continent,
+			"geoname_id": uint32(6255148),
+			"names":      map[string]any{"en": "Europe", "de": "Europa"},
+		},
+		"country": map[string]any{
+			"iso_code":             iso,
+			"is_in_european_union": true,
+			"names":                map[string]any{"en": "Germany", "de": "Deutschland"},
+		},
+		"location": map[string]any{"accuracy_radius": uint16(100)},
+	}
+}
+
+func writeDatabase(t *testing.T, db geoiptest.Database) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	require.NoError(t, db.Write(path))
+	return path
+}
+
+func newDatabase(t *testing.T, files ...string) *geoip.Database {
+	t.Helper()
+
+	db, err := geoip.New(geoip.Options{Files: files})
+	require.NoError(t, err)
+	t.Cleanup(db.Close)
+	return db
+}
+
+func TestLookup(t *testing.T) {
+	networks := map[string]map[string]any{
+		"1.2.3.0/24":     country("DE", "EU"),
+		"5.6.0.0/16":     country("at", "eu"),
+		"2001:db8::/32":  country("US", "NA"),
+		"192.0.2.128/25": {"registered_country": map[string]any{"iso_code": "NL"}},
+	}
+
+	for _, recordSize := range []int{24, 28, 32} {
+		path := writeDatabase(t, geoiptest.Database{RecordSize: recordSize, Networks: networks})
+		db := newDatabase(t, path)
+
+		for _, tc := range []struct {
+			addr      string
+			country   string
+			continent string
+		}{
+			{addr: "1.2.3.4", country: "DE", continent: "EU"},
+			{addr: "1.2.3.255", country: "DE", continent: "EU"},
+			{addr: "::ffff:1.2.3.4", country: "DE", continent: "EU"},
+			{addr: "5.6.7.8", country: "AT", continent: "EU"},
+			{addr: "2001:db8::1", country: "US", continent: "NA"},
+			{addr: "192.0.2.200", country: "NL"},
+			{addr: "192.0.2.1"},
+			{addr: "1.2.4.1"},
+			{addr: "2001:db9::1"},
+		} {
+			rec := db.Lookup(netip.MustParseAddr(tc.addr))
+			assert.Equal(t, tc.country, rec.Country, "record size %d, %s", recordSize, tc.addr)
+			assert.Equal(t, tc.continent, rec.Continent, "record size %d, %s", recordSize, tc.addr)
+		}
+
+		assert.Equal(t, geoip.Record{}, db.Lookup(netip.Addr{}))
+	}
+}
+
+func TestLookupIPv4Database(t *testing.T) {
+	path := writeDatabase(t, geoiptest.Database{
+		IPVersion: 4,
+		Networks:  map[string]map[string]any{"1.2.3.0/24": country("DE", "EU")},
+	})
+
+	db := newDatabase(t, path)
+	assert.Equal(t, "DE", db.Lookup(netip.MustParseAddr("1.2.3.4")).Country)
+	assert.Equal(t, "", db.Lookup(netip.MustParseAddr("2001:db8::1")).Country)
+}
+
+func TestLookupMultipleDatabases(t *testing.T) {
+	countries := writeDatabase(t, geoiptest.Database{
+		DatabaseType: "GeoLite2-Country",
+		Networks:     map[string]map[string]any{"1.2.3.0/24": country("DE", "EU")},
+	})
+
+	asns := writeDatabase(t, geoiptest.Database{
+		DatabaseType: "GeoLite2-ASN",
+		Networks: map[string]map[string]any{
+			"1.2.0.0/16": {
+				"autonomous_system_number":       uint32(3320),
+				"autonomous_system_organization": "Deutsche Telekom AG",
+			},
+		},
+	})
+
+	db := newDatabase(t, countries, asns)
+	rec := db.Lookup(netip.MustParseAddr("1.2.3.4"))
+	assert.Equal(t, geoip.Record{Country: "DE", Continent: "EU", ASN: 3320, ASOrganization: "Deutsche Telekom AG"}, rec)
+	assert.Equal(t, "3320", rec.ASNString())
+
+	rec = db.Lookup(netip.MustParseAddr("1.2.4.4"))
+	assert.Equal(t, geoip.Record{ASN: 3320, ASOrganization: "Deutsche Telekom AG"}, rec)
+	assert.Equal(t, "", geoip.Record{}.ASNString())
+}
+
+func TestLookupLongValues(t *testing.T) {
+	for _, n := range []int{28, 29, 284, 285, 65820, 65821, 70000} {
+		org := strings.Repeat("x", n)
+		path := writeDatabase(t, geoiptest.Database{
+			Networks: map[string]map[string]any{
+				"1.2.3.0/24": {
+					"autonomous_system_organization": org,
+					"autonomous_system_number":       uint32(3320),
+				},
+			},
+		})
+
+		db := newDatabase(t, path)
+		rec := db.Lookup(netip.MustParseAddr("1.2.3.4"))
+		assert.Equal(t, org, rec.ASOrganization, "length %d", n)
+		assert.Equal(t, uint(3320), rec.ASN, "length %d", n)
+	}
+}
+
+func TestLookupRequest(t *testing.T) {
+	path := writeDatabase(t, geoiptest.Database{
+		Networks: map[string]map[string]any{
+			"1.2.3.0/24": country("DE", "EU"),
+			"5.6.7.0/24": country("AT", "EU"),
+			"9.9.9.0/24": country("CH", "EU"),
+		},
+	})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "9.9.9.9:1234"
+	r.Header.Set("X-Forwarded-For", "1.2.3.4, 5.6.7.8")
+
+	for _, tc := range []struct {
+		clientIP string
+		country  string
+	}{
+		{clientIP: "", country: "AT"},
+		{clientIP: geoip.Source, country: "DE"},
+		{clientIP: geoip.SourceFromLast, country: "AT"},
+		{clientIP: geoip.ClientIP, country: "CH"},
+	} {
+		db, err := geoip.New(geoip.Options{Files: []string{path}, ClientIP: tc.clientIP})
+		require.NoError(t, err)
+		defer db.Close()
+
+		assert.Equal(t, tc.country, db.LookupRequest(r).Country, tc.clientIP)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	valid := writeDatabase(t, geoiptest.Database{Networks: map[string]map[string]any{"1.2.3.0/24": country("DE", "EU")}})
+	invalid := filepath.Join(t.TempDir(), "invalid.mmdb")
+	require.NoError(t, os.WriteFile(invalid, []byte("not a database"), 0o644))
+
+	for _, o := range []geoip.Options{
+		{},
+		{Files: []string{valid}, ClientIP: "header"},
+		{Files: []string{valid, filepath.Join(t.TempDir(), "missing.mmdb")}},
+		{Files: []string{invalid}},
+	} {
+		_, err := geoip.New(o)
+		assert.Error(t, err, "%v", o)
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := writeDatabase(t, geoiptest.Database{Networks: map[string]map[string]any{"1.2.3.0/24": country("DE", "EU")}})
+
+	db, err := geoip.New(geoip.Options{Files: []string{path}, CheckInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+	defer db.Close()
+
+	addr := netip.MustParseAddr("1.2.3.4")
+	assert.Equal(t, "DE", db.Lookup(addr).Country)
+
+	// invalid content keeps the previous version
+	require.NoError(t, os.WriteFile(path, []byte("not a database"), 0o644))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, "DE", db.Lookup(addr).Country)
+
+	require.NoError(t, geoiptest.Database{Networks: map[string]map[string]any{"1.2.3.0/24": country("FR", "EU")}}.Write(path))
+	assert.Eventually(t, func() bool {
+		return db.Lookup(addr).Country == "FR"
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,290 @@
+// Package geoiptest writes databases in the MaxMind DB format for
+// testing.
+package geoiptest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"os"
+	"slices"
+	"time"
+)
+
+// Database describes the content of a test database.
+type Database struct {
+	// IPVersion is 4 or 6. Defaults to 6.
+	IPVersion int
+
+	// RecordSize is 24, 28 or 32. Defaults to 24.
+	RecordSize int
+
+	// DatabaseType defaults to Test.
+	DatabaseType string
+
+	// Networks maps the networks in CIDR notation to their data. The
+	// networks must not overlap. The data can contain strings, unsigned
+	// integers, bools, maps with string keys and slices.
+	Networks map[string]map[string]any
+}
+
+type node struct {
+	children [2]*node
+	data     *uint
+}
+
+// Write writes the database to the file.
+func (db Database) Write(path string) error {
+	b, err := db.Bytes()
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, b, 0o644)
+}
+
+// Bytes returns the encoded database.
+func (db Database) Bytes() ([]byte, error) {
+	if db.IPVersion == 0 {
+		db.IPVersion = 6
+	}
+
+	if db.RecordSize == 0 {
+		db.RecordSize = 24
+	}
+
+	if db.DatabaseType == "" {
+		db.DatabaseType = "Test"
+	}
+
+	data := &encoder{strings: make(map[string]int)}
+	root := &node{}
+	var prefixes []string
+	for p := range db.Networks {
+		prefixes = append(prefixes, p)
+	}
+
+	slices.Sort(prefixes)
+	for _, p := range prefixes {
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			return nil, err
+		}
+
+		bits, addr := prefix.Bits(), prefix.Addr().AsSlice()
+		if db.IPVersion == 6 && prefix.Addr().Is4() {
+			addr = append(make([]byte, 12), addr...)
+			bits += 96
+		} else if db.IPVersion == 4 && !prefix.Addr().Is4() {
+			return nil, fmt.Errorf("IPv6 network in IPv4 database: %s", p)
+		}
+
+		if bits == 0 {
+			return nil, fmt.Errorf("unsupported network: %s", p)
+		}
+
+		offset := uint(len(data.b))
+		data.encode(db.Networks[p], true)
+
+		n := root
+		for i := 0; i < bits; i++ {
+			bit := addr[i/8] >> (7 - i%8) & 1
+			if n.children[bit] == nil {
+				n.children[bit] = &node{}
+			}
+
+			n = n.children[bit]
+			if n.data != nil {
+				return nil, fmt.Errorf("overlapping network: %s", p)
+			}
+		}
+
+		if n.children[0] != nil || n.children[1] != nil {
+			return nil, fmt.Errorf("overlapping network: %s", p)
+		}
+
+		n.data = &offset
+	}
+
+	// number the inner nodes in breadth first order
+	var nodes []*node
+	index := make(map[*node]uint)
+	for queue := []*node{root}; len(queue) > 0; queue = queue[1:] {
+		n := queue[0]
+		index[n] = uint(len(nodes))
+		nodes = append(nodes, n)
+		for _, c := range n.children {
+			if c != nil && c.data == nil {
+				queue = append(queue, c)
+			}
+		}
+	}
+
+	nodeCount := uint(len(nodes))
+	var tree []byte
+	for _, n := range nodes {
+		var records [2]uint
+		for i, c := range n.children {
+			switch {
+			case c == nil:
+				records[i] = nodeCount
+			case c.data != nil:
+				records[i] = nodeCount + 16 + *c.data
+			default:
+				records[i] = index[c]
+			}
+		}
+
+		tree = appendNode(tree, db.RecordSize, records)
+	}
+
+	metadata := &encoder{}
+	metadata.encode(map[string]any{
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(db.RecordSize),
+		"ip_version":                  uint16(db.IPVersion),
+		"database_type":               db.DatabaseType,
+		"languages":                   []any{"en"},
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(time.Now().Unix()),
+		"description":                 map[string]any{"en": "test database"},
+	}, false)
+
+	b := append(tree, make([]byte, 16)...)
+	b = append(b, data.b...)
+	b = append(b, "\xab\xcd\xefMaxMind.com"...)
+	return append(b, metadata.b...), nil
+}
+
+func appendNode(b []byte, recordSize int, r [2]uint) []byte {
+	switch recordSize {
+	case 24:
+		return append(b, byte(r[0]>>16), byte(r[0]>>8), byte(r[0]), byte(r[1]>>16), byte(r[1]>>8), byte(r[1]))
+	case 28:
+		return append(b,
+			byte(r[0]>>16), byte(r[0]>>8), byte(r[0]),
+			byte(r[0]>>20)&0xf0|byte(r[1]>>24)&0x0f,
+			byte(r[1]>>16), byte(r[1]>>8), byte(r[1]),
+		)
+	default:
+		b = binary.BigEndian.AppendUint32(b, uint32(r[0]))
+		return binary.BigEndian.AppendUint32(b, uint32(r[1]))
+	}
+}
+
+type encoder struct {
+	b       []byte
+	strings map[string]int
+}
+
+func (e *encoder) control(typ int, size int) {
+	var ext []byte
+	if typ > 7 {
+		ext = []byte{byte(typ - 7)}
+		typ = 0
+	}
+
+	c := byte(typ << 5)
+	var sizeBytes []byte
+	switch {
+	case size < 29:
+		c |= byte(size)
+	case size < 285:
+		c |= 29
+		sizeBytes = []byte{byte(size - 29)}
+	case size < 65821:
+		c |= 30
+		s := size - 285
+		sizeBytes = []byte{byte(s >> 8), byte(s)}
+	default:
+		c |= 31
+		s := size - 65821
+		sizeBytes = []byte{byte(s >> 16), byte(s >> 8), byte(s)}
+	}
+
+	e.b = append(e.b, c)
+	e.b = append(e.b, ext...)
+	e.b = append(e.b, sizeBytes...)
+}
+
+func (e *encoder) pointer(p int) {
+	switch {
+	case p < 2048:
+		e.b = append(e.b, 0x20|byte(p>>8), byte(p))
+	case p < 526336:
+		p -= 2048
+		e.b = append(e.b, 0x28|byte(p>>16), byte(p>>8), byte(p))
+	case p < 134744064:
+		p -= 526336
+		e.b = append(e.b, 0x30|byte(p>>24), byte(p>>16), byte(p>>8), byte(p))
+	default:
+		e.b = append(e.b, 0x38)
+		e.b = binary.BigEndian.AppendUint32(e.b, uint32(p))
+	}
+}
+
+func (e *encoder) uint(typ int, v uint64) {
+	var b []byte
+	for ; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+
+	e.control(typ, len(b))
+	e.b = append(e.b, b...)
+}
+
+// encode appends the value. When dedup is set, the repeated strings
+// are encoded as pointers, like in the real databases.
+func (e *encoder) encode(v any, dedup bool) {
+	switch v := v.(type) {
+	case string:
+		if p, ok := e.strings[v]; ok && dedup {
+			e.pointer(p)
+			return
+		}
+
+		if dedup {
+			e.strings[v] = len(e.b)
+		}
+
+		e.control(2, len(v))
+		e.b = append(e.b, v...)
+	case uint16:
+		e.uint(5, uint64(v))
+	case uint32:
+		e.uint(6, uint64(v))
+	case uint:
+		e.uint(6, uint64(v))
+	case int:
+		e.uint(6, uint64(v))
+	case uint64:
+		e.uint(9, v)
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+
+		e.control(14, size)
+	case map[string]any:
+		var keys []string
+		for k := range v {
+			keys = append(keys, k)
+		}
+
+		slices.Sort(keys)
+		e.control(7, len(keys))
+		for _, k := range keys {
+			e.encode(k, dedup)
+			e.encode(v[k], dedup)
+		}
+	case []any:
+		e.control(11, len(v))
+		for _, vi := range v {
+			e.encode(vi, dedup)
+		}
+	default:
+		panic(fmt.Sprintf("geoiptest: unsupported type %T", v))
+	}
+}
@@ -0,0 +1,308 @@
+/*
+Package graphql parses the GraphQL requests sent over HTTP, and
+analyzes their operations, for the GraphQLOperation predicate and the
+graphqlLimits filter.
+
+The requests are accepted in the formats of the GraphQL over HTTP
+specification: the GET requests with the query in the query parameters,
+and the POST requests with an application/json body, or with an
+application/graphql body containing only the query. Batched requests
+are not supported.
+*/
+package graphql
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+
+	snet "github.com/zalando/skipper/net"
+)
+
+const (
+	// DefaultMaxBodySize is the default maximum size of the request
+	// body, that is parsed.
+	DefaultMaxBodySize = 1 << 20
+
+	// MaxTokens is the maximum number of tokens of the parsed queries.
+	MaxTokens = 15000
+)
+
+var (
+	// ErrNotGraphQL is returned for the requests without a GraphQL
+	// query.
+	ErrNotGraphQL = errors.New("not a GraphQL request")
+
+	// ErrBodyTooLarge is returned when the body exceeds the maximum
+	// size, or it cannot be read completely.
+	ErrBodyTooLarge = errors.New("GraphQL request body too large")
+)
+
+// Request is a parsed GraphQL request.
+type Request struct {
+	// Query is the GraphQL document of the request.
+	Query string
+
+	// OperationName is the name of the operation to execute, when the
+	// document has more than one.
+	OperationName string
+
+	// Variables are the variables of the request.
+	Variables map[string]interface{}
+
+	// Operation is the executed operation of the document.
+	Operation *ast.OperationDefinition
+
+	document *ast.QueryDocument
+}
+
+type requestBody struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// cachedBody replaces the body of the parsed POST requests. It reads
+// the original content, and holds the result of the parsing, so that
+// the body is parsed only once, when more than one route or filter
+// checks the request.
+type cachedBody struct {
+	io.ReadCloser
+	request *Request
+	err     error
+}
+
+// ParseRequest parses the GraphQL request. The body of the request is
+// read up to the maximum size, and it remains available for the
+// backend. It returns ErrNotGraphQL, when the request has no query.
+func ParseRequest(r *http.Request, maxBodySize int64) (*Request, error) {
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		var variables map[string]interface{}
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &variables); err != nil {
+				return nil, fmt.Errorf("invalid GraphQL variables: %w", err)
+			}
+		}
+
+		return parseQuery(q.Get("query"), q.Get("operationName"), variables)
+	case http.MethodPost:
+		if cb, ok := r.Body.(*cachedBody); ok {
+			return cb.request, cb.err
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType != "application/json" && mediaType != "application/graphql" ||
+			r.Body == nil || r.Body == http.NoBody {
+			return nil, ErrNotGraphQL
+		}
+
+		content, body, complete := snet.PeekBody(r.Body, maxBodySize)
+		cb := &cachedBody{ReadCloser: body}
+		r.Body = cb
+		if complete {
+			cb.request, cb.err = parseBody(mediaType, content)
+		} else {
+			cb.err = ErrBodyTooLarge
+		}
+
+		return cb.request, cb.err
+	default:
+		return nil, ErrNotGraphQL
+	}
+}
+
+func parseBody(mediaType string, content []byte) (*Request, error) {
+	if mediaType == "application/graphql" {
+		return parseQuery(string(content), "", nil)
+	}
+
+	var b requestBody
+	if err := json.Unmarshal(content, &b); err != nil {
+		return nil, fmt.Errorf("invalid GraphQL request body: %w", err)
+	}
+
+	return parseQuery(b.Query, b.OperationName, b.Variables)
+}
+
+func parseQuery(query, operationName string, variables map[string]interface{}) (*Request, error) {
+	if query == "" {
+		return nil, ErrNotGraphQL
+	}
+
+	return Parse(query, operationName, variables)
+}
+
+// Parse parses the query, and selects the operation by its name, or
+// the only operation of the document, when the name is empty.
+func Parse(query, operationName string, variables map[string]interface{}) (*Request, error) {
+	doc, err := parser.ParseQueryWithTokenLimit(&ast.Source{Input: query}, MaxTokens)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GraphQL query: %w", err)
+	}
+
+	req := &Request{
+		Query:         query,
+		OperationName: operationName,
+		Variables:     variables,
+		document:      doc,
+	}
+
+	switch {
+	case operationName != "":
+		req.Operation = doc.Operations.ForName(operationName)
+		if req.Operation == nil {
+			return nil, fmt.Errorf("GraphQL operation not found: %s", operationName)
+		}
+	case len(doc.Operations) == 1:
+		req.Operation = doc.Operations[0]
+	default:
+		return nil, fmt.Errorf("GraphQL operation name required for %d operations", len(doc.Operations))
+	}
+
+	return req, nil
+}
+
+// OperationType returns the type of the operation: query, mutation or
+// subscription.
+func (r *Request) OperationType() string {
+	return string(r.Operation.Operation)
+}
+
+// Name returns the name of the operation, or an empty string for
+// anonymous operations.
+func (r *Request) Name() string {
+	return r.Operation.Name
+}
+
+// Analysis contains the measures of an operation used to limit the
+// cost of the queries.
+type Analysis struct {
+	// Depth is the maximum nesting level of the selected fields. The
+	// top level fields have depth 1.
+	Depth int
+
+	// Aliases is the number of aliased fields.
+	Aliases int
+
+	// Complexity is the number of the selected fields, where the
+	// subselections of the fields with a first, last or limit argument
+	// are counted as many times as the argument tells.
+	Complexity int
+}
+
+var listArguments = []string{"first", "last", "limit"}
+
+type analyzer struct {
+	request   *Request
+	fragments map[string]*Analysis
+}
+
+// Analyze computes the depth, the number of aliases and the complexity
+// of the operation, including the selections of the fragments.
+func (r *Request) Analyze() Analysis {
+	a := &analyzer{request: r, fragments: make(map[string]*Analysis)}
+	return a.selectionSet(r.Operation.SelectionSet)
+}
+
+// selectionSet returns the analysis of the selection set, with the
+// depth relative to the selection set. The analysis of the fragments
+// is computed only once, so that the fragments spread many times don't
+// make the analysis expensive.
+func (a *analyzer) selectionSet(set ast.SelectionSet) Analysis {
+	var result Analysis
+	for _, s := range set {
+		var sub Analysis
+		switch s := s.(type) {
+		case *ast.Field:
+			sub = a.selectionSet(s.SelectionSet)
+			sub.Depth++
+			sub.Complexity = saturatingAdd(1, saturatingMul(sub.Complexity, a.multiplier(s)))
+			if s.Alias != s.Name {
+				sub.Aliases++
+			}
+		case *ast.InlineFragment:
+			sub = a.selectionSet(s.SelectionSet)
+		case *ast.FragmentSpread:
+			sub = a.fragment(s.Name)
+		}
+
+		result.Depth = max(result.Depth, sub.Depth)
+		result.Aliases = saturatingAdd(result.Aliases, sub.Aliases)
+		result.Complexity = saturatingAdd(result.Complexity, sub.Complexity)
+	}
+
+	return result
+}
+
+func (a *analyzer) fragment(name string) Analysis {
+	if f, ok := a.fragments[name]; ok {
+		// nil while the fragment is analyzed, in case of invalid cycles
+		if f == nil {
+			return Analysis{}
+		}
+
+		return *f
+	}
+
+	f := a.request.document.Fragments.ForName(name)
+	if f == nil {
+		return Analysis{}
+	}
+
+	a.fragments[name] = nil
+	result := a.selectionSet(f.SelectionSet)
+	a.fragments[name] = &result
+	return result
+}
+
+// maxComplexity caps the measures of the queries requesting nested
+// large lists, or spreading fragments many times, to avoid overflows.
+const maxComplexity = math.MaxInt32
+
+func saturatingAdd(a, b int) int {
+	return min(a+b, maxComplexity)
+}
+
+func saturatingMul(a, b int) int {
+	if a != 0 && b > maxComplexity/a {
+		return maxComplexity
+	}
+
+	return min(a*b, maxComplexity)
+}
+
+// multiplier returns the size of the list requested by the field, or 1.
+func (a *analyzer) multiplier(f *ast.Field) int {
+	for _, name := range listArguments {
+		arg := f.Arguments.ForName(name)
+		if arg == nil || arg.Value == nil {
+			continue
+		}
+
+		var n int
+		switch arg.Value.Kind {
+		case ast.IntValue:
+			n, _ = strconv.Atoi(arg.Value.Raw)
+		case ast.Variable:
+			if v, ok := a.request.Variables[arg.Value.Raw].(float64); ok {
+				n = int(v)
+			}
+		}
+
+		if n > 1 {
+			return n
+		}
+	}
+
+	return 1
+}
@@ -0,0 +1,236 @@
+package graphql
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingReader struct {
+	io.Reader
+	reads  int
+	closed bool
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	r.reads++
+	return r.Reader.Read(p)
+}
+
+func (r *countingReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestParseRequest(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		method        string
+		url           string
+		contentType   string
+		body          string
+		err           error
+		operationType string
+		operation     string
+	}{{
+		name:          "GET query",
+		method:        "GET",
+		url:           "/graphql?query=" + url.QueryEscape("{ user { id } }"),
+		operationType: "query",
+	}, {
+		name:          "GET named operation",
+		method:        "GET",
+		url:           "/graphql?operationName=B&query=" + url.QueryEscape("query A { a } mutation B { b }"),
+		operationType: "mutation",
+		operation:     "B",
+	}, {
+		name:   "GET without query",
+		method: "GET",
+		url:    "/graphql",
+		err:    ErrNotGraphQL,
+	}, {
+		name:          "POST json",
+		method:        "POST",
+		url:           "/graphql",
+		contentType:   "application/json; charset=utf-8",
+		body:          `{"query": "subscription OnEvent { event { id } }"}`,
+		operationType: "subscription",
+		operation:     "OnEvent",
+	}, {
+		name:          "POST graphql",
+		method:        "POST",
+		url:           "/graphql",
+		contentType:   "application/graphql",
+		body:          "mutation AddUser { addUser { id } }",
+		operationType: "mutation",
+		operation:     "AddUser",
+	}, {
+		name:        "POST other content type",
+		method:      "POST",
+		url:         "/graphql",
+		contentType: "text/plain",
+		body:        "{ a }",
+		err:         ErrNotGraphQL,
+	}, {
+		name:   "PUT",
+		method: "PUT",
+		url:    "/graphql",
+		err:    ErrNotGraphQL,
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+
+			r := httptest.NewRequest(tt.method, tt.url, body)
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+
+			req, err := ParseRequest(r, DefaultMaxBodySize)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.operationType, req.OperationType())
+			assert.Equal(t, tt.operation, req.Name())
+		})
+	}
+}
+
+func TestParseRequestErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		body string
+	}{
+		{"invalid json", `{"query":`},
+		{"invalid query", `{"query": "{ a "}`},
+		{"missing operation", `{"query": "query A { a }", "operationName": "B"}`},
+		{"ambiguous operation", `{"query": "query A { a } query B { b }"}`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/graphql", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+
+			_, err := ParseRequest(r, DefaultMaxBodySize)
+			assert.Error(t, err)
+			assert.NotErrorIs(t, err, ErrNotGraphQL)
+		})
+	}
+}
+
+func TestParseRequestBody(t *testing.T) {
+	const content = `{"query": "query GetUser { user { id } }"}`
+
+	t.Run("cached", func(t *testing.T) {
+		original := &countingReader{Reader: strings.NewReader(content)}
+		r, err := http.NewRequest("POST", "/graphql", original)
+		require.NoError(t, err)
+		r.Header.Set("Content-Type", "application/json")
+
+		req1, err := ParseRequest(r, DefaultMaxBodySize)
+		require.NoError(t, err)
+
+		reads := original.reads
+		req2, err := ParseRequest(r, DefaultMaxBodySize)
+		require.NoError(t, err)
+
+		assert.Same(t, req1, req2)
+		assert.Equal(t, reads, original.reads, "body read again")
+		assert.True(t, original.closed)
+
+		b, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(b))
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		r := httptest.NewRequest("POST", "/graphql", strings.NewReader(content))
+		r.Header.Set("Content-Type", "application/json")
+
+		_, err := ParseRequest(r, 10)
+		assert.ErrorIs(t, err, ErrBodyTooLarge)
+
+		_, err = ParseRequest(r, 10)
+		assert.ErrorIs(t, err, ErrBodyTooLarge)
+
+		b, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(b), "body forwarded unchanged")
+	})
+}
+
+func TestAnalyze(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		expected  Analysis
+	}{{
+		name:     "flat",
+		query:    "{ a b c }",
+		expected: Analysis{Depth: 1, Complexity: 3},
+	}, {
+		name:     "nested",
+		query:    "{ a { b { c } d } e }",
+		expected: Analysis{Depth: 3, Complexity: 5},
+	}, {
+		name:     "aliases",
+		query:    "{ x: a y: a { z: b } }",
+		expected: Analysis{Depth: 2, Aliases: 3, Complexity: 3},
+	}, {
+		name:     "list arguments",
+		query:    "{ users(first: 10) { id friends(limit: 5) { id } } }",
+		expected: Analysis{Depth: 3, Complexity: 1 + 10*(1+1+5*1)},
+	}, {
+		name:      "list argument variable",
+		query:     "query Q($n: Int) { users(last: $n) { id name } }",
+		variables: map[string]interface{}{"n": float64(100)},
+		expected:  Analysis{Depth: 2, Complexity: 1 + 100*2},
+	}, {
+		name:     "fragments",
+		query:    "{ a { ...F ... on T { d } } } fragment F on T { b { c } }",
+		expected: Analysis{Depth: 3, Complexity: 4},
+	}, {
+		name:     "fragment cycle",
+		query:    "{ ...A } fragment A on T { a ...B } fragment B on T { b ...A }",
+		expected: Analysis{Depth: 1, Complexity: 2},
+	}, {
+		name:     "saturated",
+		query:    "{ a(first: 100000) { b(first: 100000) { c(first: 100000) { d } } } }",
+		expected: Analysis{Depth: 4, Complexity: maxComplexity},
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := Parse(tt.query, "", tt.variables)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, req.Analyze())
+		})
+	}
+}
+
+func TestAnalyzeRepeatedFragments(t *testing.T) {
+	// every fragment spreads the previous one ten times
+	var b strings.Builder
+	b.WriteString("{ ...F19 } fragment F0 on T { a }")
+	for i := 1; i < 20; i++ {
+		fmt.Fprintf(&b, " fragment F%d on T {", i)
+		for j := 0; j < 10; j++ {
+			fmt.Fprintf(&b, " ...F%d", i-1)
+		}
+		b.WriteString(" }")
+	}
+
+	req, err := Parse(b.String(), "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, Analysis{Depth: 1, Complexity: maxComplexity}, req.Analyze())
+}
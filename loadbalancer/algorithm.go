@@ -328,10 +328,10 @@ func parseEndpoints(r *routing.Route) error {
 	return nil
 }
 
-func setAlgorithm(r *routing.Route) error {
-	t, err := AlgorithmFromString(r.Route.LBAlgorithm)
+func newAlgorithm(name string, endpoints []string) (routing.LBAlgorithm, error) {
+	t, err := AlgorithmFromString(name)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	initialize := defaultAlgorithm
@@ -339,7 +339,16 @@ func setAlgorithm(r *routing.Route) error {
 		initialize = algorithms[t]
 	}
 
-	r.LBAlgorithm = initialize(eskip.LBEndpointString(r.Route.LBEndpoints))
+	return initialize(endpoints), nil
+}
+
+func setAlgorithm(r *routing.Route) error {
+	a, err := newAlgorithm(r.Route.LBAlgorithm, eskip.LBEndpointString(r.Route.LBEndpoints))
+	if err != nil {
+		return err
+	}
+
+	r.LBAlgorithm = a
 	return nil
 }
 
@@ -352,6 +361,22 @@ func (p *algorithmProvider) Do(r []*routing.Route) []*routing.Route {
 			continue
 		}
 
+		if ri.Route.LBDiscovery != "" {
+			// the endpoints are set by the discovery
+			if ri.LBEndpointSource == nil {
+				log.Errorf("failed to post-process LB route: %s, %s discovery not available", ri.Id, ri.Route.LBDiscovery)
+				continue
+			}
+
+			if _, err := AlgorithmFromString(ri.Route.LBAlgorithm); err != nil {
+				log.Errorf("failed to set LB algorithm implementation for route %s: %v", ri.Id, err)
+				continue
+			}
+
+			rr = append(rr, ri)
+			continue
+		}
+
 		if len(ri.Route.LBEndpoints) == 0 {
 			log.Errorf("failed to post-process LB route: %s, no endpoints defined", ri.Id)
 			continue
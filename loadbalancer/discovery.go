@@ -0,0 +1,565 @@
+package loadbalancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/routing"
+)
+
+const (
+	defaultDiscoveryMinTTL  = 5 * time.Second
+	defaultDiscoveryMaxTTL  = 5 * time.Minute
+	defaultDiscoveryTimeout = 2 * time.Second
+
+	resolvConf = "/etc/resolv.conf"
+
+	// maxSRVWeightedEndpoints limits the number of endpoints created
+	// to represent the weights of the SRV records.
+	maxSRVWeightedEndpoints = 256
+)
+
+// DNSDiscoveryOptions are used to initialize the discovery of the
+// endpoints of load balanced routes from DNS.
+type DNSDiscoveryOptions struct {
+
+	// Nameservers to query, in host:port format. Defaults to the
+	// nameservers configured in /etc/resolv.conf.
+	Nameservers []string
+
+	// MinTTL is the minimum interval between two resolutions of the
+	// same name. Defaults to 5s.
+	MinTTL time.Duration
+
+	// MaxTTL is the maximum interval between two resolutions of the
+	// same name. Defaults to 5m.
+	MaxTTL time.Duration
+
+	// Timeout of a single DNS query. Defaults to 2s.
+	Timeout time.Duration
+
+	// EndpointRegistry stores the metrics of the discovered
+	// endpoints, used e.g. by the fade-in and the passive health
+	// check.
+	EndpointRegistry *routing.EndpointRegistry
+}
+
+// DNSDiscovery is a routing.PostProcessor that resolves the endpoints
+// of load balanced routes with the dns or srv discovery, e.g.
+// <dns, "http://service.internal:8080"> or <srv, "_http._tcp.service.internal">.
+//
+// The names are resolved periodically, honoring the TTL of the DNS
+// records, and the endpoints of the routes are updated without a route
+// table update. It needs to be applied before the algorithm provider.
+type DNSDiscovery struct {
+	options     DNSDiscoveryOptions
+	nameservers []string
+	configErr   error
+	client      *dns.Client
+	tcpClient   *dns.Client
+
+	mu      sync.Mutex
+	targets map[string]*discoveryTarget
+	closed  bool
+}
+
+// endpointSet holds the result of a resolution.
+type endpointSet struct {
+	endpoints []routing.LBEndpoint
+}
+
+// discoveryTarget resolves the names of one or more routes with the same
+// LB backend.
+type discoveryTarget struct {
+	discovery *DNSDiscovery
+	kind      string
+	names     []string
+	current   atomic.Pointer[endpointSet]
+	quit      chan struct{}
+}
+
+type discoveredRoute struct {
+	set   *endpointSet
+	route *routing.Route
+}
+
+// discoveredEndpoints implements routing.LBEndpointSource for a route.
+type discoveredEndpoints struct {
+	route   *routing.Route
+	target  *discoveryTarget
+	current atomic.Pointer[discoveredRoute]
+}
+
+var _ routing.PostProcessor = &DNSDiscovery{}
+
+// NewDNSDiscovery creates the post-processor resolving the endpoints of
+// the load balanced routes with dns or srv discovery.
+func NewDNSDiscovery(o DNSDiscoveryOptions) *DNSDiscovery {
+	if o.MinTTL <= 0 {
+		o.MinTTL = defaultDiscoveryMinTTL
+	}
+
+	if o.MaxTTL <= 0 {
+		o.MaxTTL = defaultDiscoveryMaxTTL
+	}
+
+	if o.MaxTTL < o.MinTTL {
+		o.MaxTTL = o.MinTTL
+	}
+
+	if o.Timeout <= 0 {
+		o.Timeout = defaultDiscoveryTimeout
+	}
+
+	if o.EndpointRegistry == nil {
+		o.EndpointRegistry = routing.NewEndpointRegistry(routing.RegistryOptions{})
+	}
+
+	var configErr error
+	nameservers := o.Nameservers
+	if len(nameservers) == 0 {
+		// the error is reported only when names need to be resolved
+		cc, err := dns.ClientConfigFromFile(resolvConf)
+		if err != nil {
+			configErr = fmt.Errorf("failed to read nameservers: %w", err)
+		} else {
+			for _, s := range cc.Servers {
+				nameservers = append(nameservers, net.JoinHostPort(s, cc.Port))
+			}
+		}
+	}
+
+	return &DNSDiscovery{
+		options:     o,
+		nameservers: nameservers,
+		configErr:   configErr,
+		client:      &dns.Client{Net: "udp", Timeout: o.Timeout},
+		tcpClient:   &dns.Client{Net: "tcp", Timeout: o.Timeout},
+		targets:     make(map[string]*discoveryTarget),
+	}
+}
+
+// Do implements routing.PostProcessor. It sets the endpoint source of
+// the LB routes with service discovery. Names seen for the first time
+// are resolved before Do returns, without holding the lock of the
+// discovery.
+func (d *DNSDiscovery) Do(routes []*routing.Route) []*routing.Route {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return routes
+	}
+
+	var created []*discoveryTarget
+	active := make(map[string]*discoveryTarget)
+	sources := make(map[*routing.Route]*discoveryTarget)
+	for _, r := range routes {
+		if r.BackendType != eskip.LBBackend || r.Route.LBDiscovery == "" {
+			continue
+		}
+
+		names := eskip.LBEndpointString(r.Route.LBEndpoints)
+		key := r.Route.LBDiscovery + " " + strings.Join(names, " ")
+		t, ok := active[key]
+		if !ok {
+			if t, ok = d.targets[key]; !ok {
+				t = d.newTarget(r.Route.LBDiscovery, names)
+				created = append(created, t)
+			}
+
+			active[key] = t
+		}
+
+		sources[r] = t
+	}
+
+	d.mu.Unlock()
+
+	for _, t := range created {
+		t.start()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		for _, t := range created {
+			close(t.quit)
+		}
+
+		return routes
+	}
+
+	now := time.Now()
+	for r, t := range sources {
+		// keeping the endpoints alive in the registry, in case the
+		// resolution interval is longer than its cleanup interval
+		t.touch(now)
+		r.LBEndpointSource = &discoveredEndpoints{route: r, target: t}
+	}
+
+	for key, t := range d.targets {
+		if _, ok := active[key]; !ok {
+			close(t.quit)
+		}
+	}
+
+	d.targets = active
+	return routes
+}
+
+// Close stops resolving the names.
+func (d *DNSDiscovery) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return
+	}
+
+	d.closed = true
+	for _, t := range d.targets {
+		close(t.quit)
+	}
+
+	d.targets = nil
+}
+
+func (d *DNSDiscovery) newTarget(kind string, names []string) *discoveryTarget {
+	return &discoveryTarget{
+		discovery: d,
+		kind:      kind,
+		names:     names,
+		quit:      make(chan struct{}),
+	}
+}
+
+func (d *DNSDiscovery) query(name string, qtype uint16) ([]dns.RR, error) {
+	if d.configErr != nil {
+		return nil, d.configErr
+	}
+
+	if len(d.nameservers) == 0 {
+		return nil, errors.New("no nameservers configured")
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+
+	var lastErr error
+	for _, ns := range d.nameservers {
+		ctx, cancel := context.WithTimeout(context.Background(), d.options.Timeout)
+		rsp, _, err := d.client.ExchangeContext(ctx, m, ns)
+		if err == nil && rsp.Truncated {
+			rsp, _, err = d.tcpClient.ExchangeContext(ctx, m, ns)
+		}
+
+		cancel()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if rsp.Rcode != dns.RcodeSuccess {
+			return nil, fmt.Errorf("failed to resolve %s %s: %s", dns.TypeToString[qtype], name, dns.RcodeToString[rsp.Rcode])
+		}
+
+		return rsp.Answer, nil
+	}
+
+	return nil, fmt.Errorf("failed to resolve %s %s: %w", dns.TypeToString[qtype], name, lastErr)
+}
+
+// start resolves the names for the first time, and then periodically
+// until the target is closed.
+func (t *discoveryTarget) start() {
+	ttl := t.refresh()
+	go t.run(ttl)
+}
+
+func (t *discoveryTarget) run(ttl time.Duration) {
+	timer := time.NewTimer(ttl)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-t.quit:
+			return
+		case <-timer.C:
+			timer.Reset(t.refresh())
+		}
+	}
+}
+
+func (t *discoveryTarget) touch(now time.Time) {
+	set := t.current.Load()
+	if set == nil {
+		return
+	}
+
+	for _, ep := range set.endpoints {
+		ep.Metrics.SetLastSeen(now)
+	}
+}
+
+// refresh resolves the names and stores the endpoints. On failure,
+// the previous endpoints are kept. It returns the time until the next
+// resolution.
+func (t *discoveryTarget) refresh() time.Duration {
+	o := t.discovery.options
+
+	var (
+		addresses []string
+		ttl       uint32
+		err       error
+	)
+
+	switch t.kind {
+	case eskip.SRVDiscovery:
+		addresses, ttl, err = t.resolveSRV()
+	default:
+		addresses, ttl, err = t.resolveDNS()
+	}
+
+	if err != nil {
+		log.Errorf("Failed to discover the endpoints of <%s, %s>: %v", t.kind, strings.Join(t.names, ", "), err)
+		return o.MinTTL
+	}
+
+	now := time.Now()
+	endpoints := make([]routing.LBEndpoint, 0, len(addresses))
+	for _, a := range addresses {
+		u, err := url.Parse(a)
+		if err != nil {
+			log.Errorf("Failed to parse the discovered endpoint %s: %v", a, err)
+			continue
+		}
+
+		m := o.EndpointRegistry.GetMetrics(u.Host)
+		if m.DetectedTime().IsZero() {
+			m.SetDetected(now)
+		}
+
+		m.SetLastSeen(now)
+		endpoints = append(endpoints, routing.LBEndpoint{
+			Scheme:  u.Scheme,
+			Host:    u.Host,
+			Metrics: m,
+		})
+	}
+
+	if !sameEndpoints(t.current.Load(), endpoints) {
+		log.Infof("Discovered %d endpoints for <%s, %s>", len(endpoints), t.kind, strings.Join(t.names, ", "))
+		t.current.Store(&endpointSet{endpoints: endpoints})
+	}
+
+	return min(max(time.Duration(ttl)*time.Second, o.MinTTL), o.MaxTTL)
+}
+
+// sameEndpoints compares the endpoints regardless of their order. The
+// same endpoint can appear multiple times, representing the SRV weights.
+func sameEndpoints(set *endpointSet, endpoints []routing.LBEndpoint) bool {
+	if set == nil || len(set.endpoints) != len(endpoints) {
+		return false
+	}
+
+	return slices.Equal(endpointAddresses(set.endpoints), endpointAddresses(endpoints))
+}
+
+// endpointAddresses returns the sorted addresses of the endpoints.
+func endpointAddresses(endpoints []routing.LBEndpoint) []string {
+	addresses := make([]string, len(endpoints))
+	for i, ep := range endpoints {
+		addresses[i] = ep.Scheme + "://" + ep.Host
+	}
+
+	slices.Sort(addresses)
+	return addresses
+}
+
+// resolveDNS resolves the hostnames of the endpoint URLs to their A and
+// AAAA records.
+func (t *discoveryTarget) resolveDNS() ([]string, uint32, error) {
+	var (
+		addresses []string
+		ttl       uint32 = math.MaxUint32
+	)
+
+	for _, name := range t.names {
+		u, err := url.Parse(name)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		host, port := u.Hostname(), u.Port()
+		if net.ParseIP(host) != nil {
+			addresses = append(addresses, name)
+			continue
+		}
+
+		for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			answer, err := t.discovery.query(host, qtype)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			for _, rr := range answer {
+				var ip net.IP
+				switch a := rr.(type) {
+				case *dns.A:
+					ip = a.A
+				case *dns.AAAA:
+					ip = a.AAAA
+				default:
+					// e.g. CNAME records in front of the addresses
+					ttl = min(ttl, rr.Header().Ttl)
+					continue
+				}
+
+				ttl = min(ttl, rr.Header().Ttl)
+				host := ip.String()
+				if port != "" {
+					host = net.JoinHostPort(host, port)
+				} else if ip.To4() == nil {
+					host = "[" + host + "]"
+				}
+
+				addresses = append(addresses, u.Scheme+"://"+host)
+			}
+		}
+	}
+
+	return addresses, ttl, nil
+}
+
+// resolveSRV resolves the endpoints from the SRV records with the lowest
+// priority. The scheme is https for the _https service, and http
+// otherwise. The weights of the records are applied by repeating the
+// endpoints proportionally.
+func (t *discoveryTarget) resolveSRV() ([]string, uint32, error) {
+	var (
+		addresses []string
+		ttl       uint32 = math.MaxUint32
+	)
+
+	for _, name := range t.names {
+		answer, err := t.discovery.query(name, dns.TypeSRV)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var records []*dns.SRV
+		for _, rr := range answer {
+			ttl = min(ttl, rr.Header().Ttl)
+			srv, ok := rr.(*dns.SRV)
+			// the target "." means that the service is not available
+			if !ok || srv.Target == "." {
+				continue
+			}
+
+			if len(records) > 0 && srv.Priority > records[0].Priority {
+				continue
+			}
+
+			if len(records) > 0 && srv.Priority < records[0].Priority {
+				records = records[:0]
+			}
+
+			records = append(records, srv)
+		}
+
+		scheme := "http"
+		if strings.HasPrefix(name, "_https.") {
+			scheme = "https"
+		}
+
+		weights := srvWeights(records)
+		for i, srv := range records {
+			host := net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), fmt.Sprint(srv.Port))
+			for range weights[i] {
+				addresses = append(addresses, scheme+"://"+host)
+			}
+		}
+	}
+
+	return addresses, ttl, nil
+}
+
+// srvWeights returns how many times the endpoint of each record needs
+// to be repeated. Records with zero weight are only used when all the
+// records have zero weight.
+func srvWeights(records []*dns.SRV) []int {
+	weights := make([]int, len(records))
+	var sum, d int
+	for i, srv := range records {
+		weights[i] = int(srv.Weight)
+		sum += weights[i]
+		d = gcd(d, weights[i])
+	}
+
+	if sum == 0 {
+		for i := range weights {
+			weights[i] = 1
+		}
+
+		return weights
+	}
+
+	sum /= d
+	for i := range weights {
+		weights[i] /= d
+		if sum > maxSRVWeightedEndpoints && weights[i] > 0 {
+			weights[i] = max(1, weights[i]*maxSRVWeightedEndpoints/sum)
+		}
+	}
+
+	return weights
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+
+	return a
+}
+
+// Route implements routing.LBEndpointSource.
+func (s *discoveredEndpoints) Route() *routing.Route {
+	set := s.target.current.Load()
+	if set == nil || len(set.endpoints) == 0 {
+		return nil
+	}
+
+	if c := s.current.Load(); c != nil && c.set == set {
+		return c.route
+	}
+
+	r := *s.route
+	r.LBEndpointSource = nil
+	r.LBEndpoints = set.endpoints
+
+	addresses := make([]string, len(set.endpoints))
+	for i, ep := range set.endpoints {
+		addresses[i] = ep.Scheme + "://" + ep.Host
+	}
+
+	// the algorithm was validated by the algorithm provider
+	r.LBAlgorithm, _ = newAlgorithm(s.route.Route.LBAlgorithm, addresses)
+
+	s.current.Store(&discoveredRoute{set: set, route: &r})
+	return &r
+}
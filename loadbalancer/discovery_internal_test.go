@@ -0,0 +1,33 @@
+package loadbalancer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zalando/skipper/routing"
+)
+
+func TestSameEndpoints(t *testing.T) {
+	endpoints := func(hosts ...string) []routing.LBEndpoint {
+		var eps []routing.LBEndpoint
+		for _, h := range hosts {
+			eps = append(eps, routing.LBEndpoint{Scheme: "http", Host: h})
+		}
+
+		return eps
+	}
+
+	set := &endpointSet{endpoints: endpoints("10.0.0.1:80", "10.0.0.2:80", "10.0.0.1:80")}
+
+	assert.False(t, sameEndpoints(nil, endpoints("10.0.0.1:80")))
+	assert.True(t, sameEndpoints(set, endpoints("10.0.0.1:80", "10.0.0.2:80", "10.0.0.1:80")))
+	assert.True(t, sameEndpoints(set, endpoints("10.0.0.2:80", "10.0.0.1:80", "10.0.0.1:80")))
+	assert.False(t, sameEndpoints(set, endpoints("10.0.0.2:80", "10.0.0.2:80", "10.0.0.1:80")))
+	assert.False(t, sameEndpoints(set, endpoints("10.0.0.1:80", "10.0.0.2:80")))
+	assert.False(t, sameEndpoints(set, []routing.LBEndpoint{
+		{Scheme: "https", Host: "10.0.0.1:80"},
+		{Scheme: "http", Host: "10.0.0.2:80"},
+		{Scheme: "http", Host: "10.0.0.1:80"},
+	}))
+}
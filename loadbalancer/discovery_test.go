@@ -0,0 +1,142 @@
+package loadbalancer_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/loadbalancer"
+	"github.com/zalando/skipper/net/dnstest"
+	"github.com/zalando/skipper/proxy"
+	"github.com/zalando/skipper/proxy/proxytest"
+	"github.com/zalando/skipper/routing"
+)
+
+func startNamedBackend(t *testing.T, name string) (*httptest.Server, string) {
+	t.Helper()
+
+	b := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte(name))
+	}))
+	t.Cleanup(b.Close)
+
+	u, err := url.Parse(b.URL)
+	require.NoError(t, err)
+
+	return b, u.Port()
+}
+
+func startDiscoveryProxy(t *testing.T, dnsServer *dnstest.Server, routes string) *proxytest.TestProxy {
+	t.Helper()
+
+	r, err := eskip.Parse(routes)
+	require.NoError(t, err)
+
+	d := loadbalancer.NewDNSDiscovery(loadbalancer.DNSDiscoveryOptions{
+		Nameservers: []string{dnsServer.Addr()},
+		MinTTL:      10 * time.Millisecond,
+		MaxTTL:      10 * time.Millisecond,
+	})
+	t.Cleanup(d.Close)
+
+	p := proxytest.Config{
+		RoutingOptions: routing.Options{
+			FilterRegistry: builtin.MakeRegistry(),
+			PostProcessors: []routing.PostProcessor{d},
+		},
+		ProxyParams: proxy.Params{CloseIdleConnsPeriod: -time.Second},
+		Routes:      r,
+	}.Create()
+	t.Cleanup(func() { p.Close() })
+
+	return p
+}
+
+func getBody(t *testing.T, u string) (int, string) {
+	t.Helper()
+
+	rsp, err := http.Get(u)
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+
+	b, err := io.ReadAll(rsp.Body)
+	require.NoError(t, err)
+
+	return rsp.StatusCode, string(b)
+}
+
+func TestDNSDiscovery(t *testing.T) {
+	_, port := startNamedBackend(t, "backend")
+	s := dnstest.NewServer(t, "service.test. 30 IN A 127.0.0.1")
+
+	p := startDiscoveryProxy(t, s, fmt.Sprintf(`
+		discovered: Path("/discovered") -> <dns, "http://service.test:%s">;
+		missing: Path("/missing") -> <dns, "http://missing.test:%s">;
+	`, port, port))
+
+	code, body := getBody(t, p.URL+"/discovered")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "backend", body)
+
+	code, _ = getBody(t, p.URL+"/missing")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+}
+
+func TestSRVDiscoveryUpdatesEndpoints(t *testing.T) {
+	_, port1 := startNamedBackend(t, "backend1")
+	_, port2 := startNamedBackend(t, "backend2")
+	s := dnstest.NewServer(t, "_http._tcp.service.test. 30 IN SRV 10 1 "+port1+" localhost.")
+
+	p := startDiscoveryProxy(t, s, `* -> <srv, "_http._tcp.service.test">`)
+
+	_, body := getBody(t, p.URL)
+	assert.Equal(t, "backend1", body)
+
+	s.SetRecords(t, "_http._tcp.service.test. 30 IN SRV 10 1 "+port2+" localhost.")
+	assert.Eventually(t, func() bool {
+		_, body := getBody(t, p.URL)
+		return body == "backend2"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSRVDiscoveryWeights(t *testing.T) {
+	_, port1 := startNamedBackend(t, "backend1")
+	_, port2 := startNamedBackend(t, "backend2")
+	_, port3 := startNamedBackend(t, "backend3")
+	s := dnstest.NewServer(
+		t,
+		"_http._tcp.service.test. 30 IN SRV 10 30 "+port1+" localhost.",
+		"_http._tcp.service.test. 30 IN SRV 10 10 "+port2+" localhost.",
+		// only the records with the lowest priority are used
+		"_http._tcp.service.test. 30 IN SRV 20 10 "+port3+" localhost.",
+	)
+
+	p := startDiscoveryProxy(t, s, `* -> <srv, roundRobin, "_http._tcp.service.test">`)
+
+	counts := make(map[string]int)
+	for range 40 {
+		code, body := getBody(t, p.URL)
+		require.Equal(t, http.StatusOK, code)
+		counts[body]++
+	}
+
+	assert.Equal(t, map[string]int{"backend1": 30, "backend2": 10}, counts)
+}
+
+func TestDNSDiscoveryWithoutPostProcessor(t *testing.T) {
+	r, err := eskip.Parse(`* -> <dns, "http://service.test:8080">`)
+	require.NoError(t, err)
+
+	// without the discovery, the algorithm provider drops the route
+	rr := loadbalancer.NewAlgorithmProvider().Do([]*routing.Route{{Route: *r[0]}})
+	assert.Empty(t, rr)
+}
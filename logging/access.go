@@ -55,9 +55,12 @@ type AccessEntry struct {
 
 type AccessLogger struct {
 	log        *logrus.Logger
+	lineLog    *logrus.Logger
 	stripQuery bool
 }
 
+type lineFormatter struct{}
+
 // strip port from addresses with hostname, ipv4 or ipv6
 func stripPort(address string) string {
 	if h, _, err := net.SplitHostPort(address); err == nil {
@@ -110,6 +113,10 @@ func (f *accessLogFormatter) Format(e *logrus.Entry) ([]byte, error) {
 	return fmt.Appendf(nil, f.format, values...), nil
 }
 
+func (*lineFormatter) Format(e *logrus.Entry) ([]byte, error) {
+	return append([]byte(e.Message), '\n'), nil
+}
+
 func stripQueryString(u string) string {
 	if i := strings.IndexRune(u, '?'); i < 0 {
 		return u
@@ -171,12 +178,7 @@ func (alog *AccessLogger) LogAccess(entry *AccessEntry, additional map[string]an
 		requestedHost = entry.Request.Host
 		flowID = entry.Request.Header.Get(flowidFilter.HeaderName)
 
-		uri = entry.Request.RequestURI
-		if alog.stripQuery {
-			uri = stripQueryString(uri)
-		} else if keys, ok := additional[al.KeyMaskedQueryParams].(map[string]struct{}); ok && len(keys) > 0 {
-			uri = maskQueryParams(entry.Request, keys)
-		}
+		uri = alog.RequestURI(entry.Request, additional)
 
 		auditHeader = entry.Request.Header.Get(logFilter.UnverifiedAuditHeader)
 	}
@@ -208,3 +210,28 @@ func (alog *AccessLogger) LogAccess(entry *AccessEntry, additional map[string]an
 	}
 	logEntry.Infoln()
 }
+
+// RequestURI returns the request URI as logged, without the query string,
+// when the query is stripped, or with the query parameters masked by the
+// filters in the additional data.
+func (alog *AccessLogger) RequestURI(r *http.Request, additional map[string]any) string {
+	if alog.stripQuery {
+		return stripQueryString(r.RequestURI)
+	}
+
+	if keys, ok := additional[al.KeyMaskedQueryParams].(map[string]struct{}); ok && len(keys) > 0 {
+		return maskQueryParams(r, keys)
+	}
+
+	return r.RequestURI
+}
+
+// LogAccessLine logs a preformatted access log line, e.g. one rendered from a
+// custom access log template, as is.
+func (alog *AccessLogger) LogAccessLine(r *http.Request, line string) {
+	logEntry := logrus.NewEntry(alog.lineLog)
+	if r != nil {
+		logEntry = logEntry.WithContext(r.Context())
+	}
+	logEntry.Info(line)
+}
@@ -344,3 +344,18 @@ func TestAccessLogStripQuery(t *testing.T) {
 	entry.Request.RequestURI += "?foo=bar"
 	testAccessLog(t, entry, logOutput, Options{AccessLogStripQuery: true})
 }
+
+func TestAccessLogLine(t *testing.T) {
+	var buf bytes.Buffer
+	lg := NewAccessLogger(Options{
+		AccessLogOutput:      &buf,
+		AccessLogJSONEnabled: true,
+	})
+
+	lg.LogAccessLine(testRequest(nil), `GET /foo 200 route1`)
+	lg.LogAccessLine(nil, `GET /bar 404 -`)
+
+	if got, expected := buf.String(), "GET /foo 200 route1\nGET /bar 404 -\n"; got != expected {
+		t.Errorf("got wrong access log lines: %q, expected: %q", got, expected)
+	}
+}
@@ -92,9 +92,15 @@ func createAccessLog(o Options) *AccessLogger {
 	l.Out = o.AccessLogOutput
 	l.Level = logrus.InfoLevel
 
+	ll := logrus.New()
+	ll.Formatter = &lineFormatter{}
+	ll.Out = o.AccessLogOutput
+	ll.Level = logrus.InfoLevel
+
 	return &AccessLogger{
 		stripQuery: o.AccessLogStripQuery,
 		log:        l,
+		lineLog:    ll,
 	}
 }
 
@@ -197,6 +197,29 @@ func (a *All) ScopedPrometheusRegisterer(subsystem string) prometheus.Registerer
 	return a.prometheus.ScopedPrometheusRegisterer(subsystem)
 }
 
+// WithTraceID implements the ExemplarMetrics interface
+func (a *All) WithTraceID(traceID string) Metrics {
+	if a.prometheus == nil {
+		return a
+	}
+
+	pm := a.prometheus.WithTraceID(traceID)
+	if pm == Metrics(a.prometheus) {
+		return a
+	}
+
+	c := *a
+	c.providers = make([]Metrics, len(a.providers))
+	for i, p := range a.providers {
+		if p == Metrics(a.prometheus) {
+			p = pm
+		}
+		c.providers[i] = p
+	}
+
+	return &c
+}
+
 func (a *All) RegisterHandler(path string, handler *http.ServeMux) {
 	if a.prometheus != nil {
 		a.prometheusHandler = a.prometheus.getHandler()
@@ -59,6 +59,18 @@ type Metrics interface {
 	String() string
 }
 
+// ExemplarMetrics is an optional interface that a Metrics flavour can
+// implement to attach the trace ID of a request as an exemplar to the
+// latency observations of the request.
+type ExemplarMetrics interface {
+	Metrics
+
+	// WithTraceID returns the metrics used to measure the request
+	// with the trace ID. It returns the receiver when exemplars are
+	// disabled or the trace ID is empty.
+	WithTraceID(traceID string) Metrics
+}
+
 // PrometheusMetrics is an optional interface that a Metrics flavour can implement.
 // This can only credibly be implemented with Prometheus as a backend and can also be removed if Prometheus
 // is the only supported backend and Codahale support is dropped
@@ -209,6 +221,27 @@ type Options struct {
 
 	// DisableCompression defaults to enable compression on the metrics endpoint, can be disabled if set to true
 	DisableCompression bool
+
+	// EnablePrometheusNativeHistograms makes the Prometheus latency
+	// histograms native histograms with sparse, exponential buckets,
+	// instead of the classic histograms with the HistogramBuckets.
+	EnablePrometheusNativeHistograms bool
+
+	// PrometheusNativeHistogramBucketFactor is the maximum growth
+	// factor between two consecutive buckets of the native
+	// histograms. Defaults to 1.1.
+	PrometheusNativeHistogramBucketFactor float64
+
+	// PrometheusNativeHistogramMaxBuckets limits the number of
+	// buckets of a native histogram. When exceeded, the resolution
+	// of the histogram is reduced. Defaults to 160.
+	PrometheusNativeHistogramMaxBuckets uint32
+
+	// EnablePrometheusExemplars attaches the trace ID of the request
+	// as an exemplar to the Prometheus latency observations of the
+	// backend, response and serve metrics. Exemplars are exposed in
+	// the OpenMetrics and the protobuf formats.
+	EnablePrometheusExemplars bool
 }
 
 var (
@@ -25,6 +25,14 @@ const (
 	promCustomSubsystem    = "custom"
 )
 
+const (
+	defaultNativeHistogramBucketFactor = 1.1
+	defaultNativeHistogramMaxBuckets   = 160
+	nativeHistogramMinResetDuration    = time.Hour
+
+	exemplarTraceIDLabel = "trace_id"
+)
+
 const (
 	KiB = 1024
 	MiB = 1024 * KiB
@@ -79,6 +87,15 @@ type Prometheus struct {
 	namespace string
 }
 
+// prometheusExemplar measures the latencies of a request with the trace
+// ID of the request as exemplar.
+type prometheusExemplar struct {
+	*Prometheus
+	traceID string
+}
+
+var _ ExemplarMetrics = &Prometheus{}
+
 // NewPrometheus returns a new Prometheus metric backend.
 func NewPrometheus(opts Options) *Prometheus {
 	opts = applyCompatibilityDefaults(opts)
@@ -108,13 +125,13 @@ func NewPrometheus(opts Options) *Prometheus {
 	}
 	p.namespace = namespace
 
-	p.routeLookupM = register(p, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	p.routeLookupM = register(p, prometheus.NewHistogramVec(latencyHistogramOpts(opts, prometheus.HistogramOpts{
 		Namespace: namespace,
 		Subsystem: promRouteSubsystem,
 		Name:      "lookup_duration_seconds",
 		Help:      "Duration in seconds of a route lookup.",
 		Buckets:   opts.HistogramBuckets,
-	}, []string{}))
+	}), []string{}))
 
 	p.routeErrorsM = register(p, prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: namespace,
@@ -123,13 +140,13 @@ func NewPrometheus(opts Options) *Prometheus {
 		Help:      "The total of route lookup errors.",
 	}, []string{}))
 
-	p.responseM = register(p, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	p.responseM = register(p, prometheus.NewHistogramVec(latencyHistogramOpts(opts, prometheus.HistogramOpts{
 		Namespace: namespace,
 		Subsystem: promResponseSubsystem,
 		Name:      "duration_seconds",
 		Help:      "Duration in seconds of a response.",
 		Buckets:   opts.HistogramBuckets,
-	}, []string{"code", "method", "route"}))
+	}), []string{"code", "method", "route"}))
 
 	p.responseSizeM = register(p, prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace: namespace,
@@ -139,37 +156,37 @@ func NewPrometheus(opts Options) *Prometheus {
 		Buckets:   responseSizeBuckets,
 	}, []string{"host"}))
 
-	p.filterCreateM = register(p, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	p.filterCreateM = register(p, prometheus.NewHistogramVec(latencyHistogramOpts(opts, prometheus.HistogramOpts{
 		Namespace: namespace,
 		Subsystem: promFilterSubsystem,
 		Name:      "create_duration_seconds",
 		Help:      "Duration in seconds of filter creation.",
 		Buckets:   opts.HistogramBuckets,
-	}, []string{"filter"}))
+	}), []string{"filter"}))
 
-	p.filterRequestM = register(p, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	p.filterRequestM = register(p, prometheus.NewHistogramVec(latencyHistogramOpts(opts, prometheus.HistogramOpts{
 		Namespace: namespace,
 		Subsystem: promFilterSubsystem,
 		Name:      "request_duration_seconds",
 		Help:      "Duration in seconds of a filter request.",
 		Buckets:   opts.HistogramBuckets,
-	}, []string{"filter"}))
+	}), []string{"filter"}))
 
-	p.filterAllRequestM = register(p, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	p.filterAllRequestM = register(p, prometheus.NewHistogramVec(latencyHistogramOpts(opts, prometheus.HistogramOpts{
 		Namespace: namespace,
 		Subsystem: promFilterSubsystem,
 		Name:      "all_request_duration_seconds",
 		Help:      "Duration in seconds of a filter request by all filters.",
 		Buckets:   opts.HistogramBuckets,
-	}, []string{"route"}))
+	}), []string{"route"}))
 
-	p.filterAllCombinedRequestM = register(p, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	p.filterAllCombinedRequestM = register(p, prometheus.NewHistogramVec(latencyHistogramOpts(opts, prometheus.HistogramOpts{
 		Namespace: namespace,
 		Subsystem: promFilterSubsystem,
 		Name:      "all_combined_request_duration_seconds",
 		Help:      "Duration in seconds of a filter request combined by all filters.",
 		Buckets:   opts.HistogramBuckets,
-	}, []string{}))
+	}), []string{}))
 
 	p.backendRequestHeadersM = register(p, prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace: namespace,
@@ -179,45 +196,45 @@ func NewPrometheus(opts Options) *Prometheus {
 		Buckets:   requestSizeBuckets,
 	}, []string{"host"}))
 
-	p.backendM = register(p, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	p.backendM = register(p, prometheus.NewHistogramVec(latencyHistogramOpts(opts, prometheus.HistogramOpts{
 		Namespace: namespace,
 		Subsystem: promBackendSubsystem,
 		Name:      "duration_seconds",
 		Help:      "Duration in seconds of a proxy backend.",
 		Buckets:   opts.HistogramBuckets,
-	}, []string{"route", "host"}))
+	}), []string{"route", "host"}))
 
-	p.backendCombinedM = register(p, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	p.backendCombinedM = register(p, prometheus.NewHistogramVec(latencyHistogramOpts(opts, prometheus.HistogramOpts{
 		Namespace: namespace,
 		Subsystem: promBackendSubsystem,
 		Name:      "combined_duration_seconds",
 		Help:      "Duration in seconds of a proxy backend combined.",
 		Buckets:   opts.HistogramBuckets,
-	}, []string{}))
+	}), []string{}))
 
-	p.filterResponseM = register(p, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	p.filterResponseM = register(p, prometheus.NewHistogramVec(latencyHistogramOpts(opts, prometheus.HistogramOpts{
 		Namespace: namespace,
 		Subsystem: promFilterSubsystem,
 		Name:      "response_duration_seconds",
 		Help:      "Duration in seconds of a filter request.",
 		Buckets:   opts.HistogramBuckets,
-	}, []string{"filter"}))
+	}), []string{"filter"}))
 
-	p.filterAllResponseM = register(p, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	p.filterAllResponseM = register(p, prometheus.NewHistogramVec(latencyHistogramOpts(opts, prometheus.HistogramOpts{
 		Namespace: namespace,
 		Subsystem: promFilterSubsystem,
 		Name:      "all_response_duration_seconds",
 		Help:      "Duration in seconds of a filter response by all filters.",
 		Buckets:   opts.HistogramBuckets,
-	}, []string{"route"}))
+	}), []string{"route"}))
 
-	p.filterAllCombinedResponseM = register(p, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	p.filterAllCombinedResponseM = register(p, prometheus.NewHistogramVec(latencyHistogramOpts(opts, prometheus.HistogramOpts{
 		Namespace: namespace,
 		Subsystem: promFilterSubsystem,
 		Name:      "all_combined_response_duration_seconds",
 		Help:      "Duration in seconds of a filter response combined by all filters.",
 		Buckets:   opts.HistogramBuckets,
-	}, []string{}))
+	}), []string{}))
 
 	metrics := []string{}
 	if opts.EnableServeStatusCodeMetric {
@@ -226,13 +243,13 @@ func NewPrometheus(opts Options) *Prometheus {
 	if opts.EnableServeMethodMetric {
 		metrics = append(metrics, "method")
 	}
-	p.serveRouteM = register(p, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	p.serveRouteM = register(p, prometheus.NewHistogramVec(latencyHistogramOpts(opts, prometheus.HistogramOpts{
 		Namespace: namespace,
 		Subsystem: promServeSubsystem,
 		Name:      "route_duration_seconds",
 		Help:      "Duration in seconds of serving a route.",
 		Buckets:   opts.HistogramBuckets,
-	}, append(metrics, "route")))
+	}), append(metrics, "route")))
 	p.serveRouteCounterM = register(p, prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: namespace,
 		Subsystem: promServeSubsystem,
@@ -240,13 +257,13 @@ func NewPrometheus(opts Options) *Prometheus {
 		Help:      "Total number of requests of serving a route.",
 	}, []string{"code", "method", "route"}))
 
-	p.serveHostM = register(p, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	p.serveHostM = register(p, prometheus.NewHistogramVec(latencyHistogramOpts(opts, prometheus.HistogramOpts{
 		Namespace: namespace,
 		Subsystem: promServeSubsystem,
 		Name:      "host_duration_seconds",
 		Help:      "Duration in seconds of serving a host.",
 		Buckets:   opts.HistogramBuckets,
-	}, append(metrics, "host")))
+	}), append(metrics, "host")))
 	p.serveHostCounterM = register(p, prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: namespace,
 		Subsystem: promServeSubsystem,
@@ -254,37 +271,37 @@ func NewPrometheus(opts Options) *Prometheus {
 		Help:      "Total number of requests of serving a host.",
 	}, []string{"code", "method", "host"}))
 
-	p.proxyTotalM = register(p, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	p.proxyTotalM = register(p, prometheus.NewHistogramVec(latencyHistogramOpts(opts, prometheus.HistogramOpts{
 		Namespace: namespace,
 		Subsystem: promProxySubsystem,
 		Name:      "total_duration_seconds",
 		Help:      "Total duration in seconds of skipper latency.",
 		Buckets:   opts.HistogramBuckets,
-	}, []string{}))
+	}), []string{}))
 
-	p.proxyRequestM = register(p, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	p.proxyRequestM = register(p, prometheus.NewHistogramVec(latencyHistogramOpts(opts, prometheus.HistogramOpts{
 		Namespace: namespace,
 		Subsystem: promProxySubsystem,
 		Name:      "request_duration_seconds",
 		Help:      "Duration in seconds of skipper latency for request.",
 		Buckets:   opts.HistogramBuckets,
-	}, []string{}))
+	}), []string{}))
 
-	p.proxyResponseM = register(p, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	p.proxyResponseM = register(p, prometheus.NewHistogramVec(latencyHistogramOpts(opts, prometheus.HistogramOpts{
 		Namespace: namespace,
 		Subsystem: promProxySubsystem,
 		Name:      "response_duration_seconds",
 		Help:      "Duration in seconds of skipper latency for response.",
 		Buckets:   opts.HistogramBuckets,
-	}, []string{}))
+	}), []string{}))
 
-	p.backend5xxM = register(p, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	p.backend5xxM = register(p, prometheus.NewHistogramVec(latencyHistogramOpts(opts, prometheus.HistogramOpts{
 		Namespace: namespace,
 		Subsystem: promBackendSubsystem,
 		Name:      "5xx_duration_seconds",
 		Help:      "Duration in seconds of backend 5xx.",
 		Buckets:   opts.HistogramBuckets,
-	}, []string{}))
+	}), []string{}))
 	p.backendErrorsM = register(p, prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: namespace,
 		Subsystem: promBackendSubsystem,
@@ -311,13 +328,13 @@ func NewPrometheus(opts Options) *Prometheus {
 		Name:      "gauges",
 		Help:      "Gauges number of custom metrics.",
 	}, []string{"key"}))
-	p.customHistogramM = register(p, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	p.customHistogramM = register(p, prometheus.NewHistogramVec(latencyHistogramOpts(opts, prometheus.HistogramOpts{
 		Namespace: namespace,
 		Subsystem: promCustomSubsystem,
 		Name:      "duration_seconds",
 		Help:      "Duration in seconds of custom metrics.",
 		Buckets:   opts.HistogramBuckets,
-	}, []string{"key"}))
+	}), []string{"key"}))
 
 	p.invalidRouteM = register(p, prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: namespace,
@@ -335,6 +352,41 @@ func NewPrometheus(opts Options) *Prometheus {
 	return p
 }
 
+// latencyHistogramOpts replaces the classic buckets of a latency histogram
+// with native histogram buckets when enabled.
+func latencyHistogramOpts(opts Options, ho prometheus.HistogramOpts) prometheus.HistogramOpts {
+	if !opts.EnablePrometheusNativeHistograms {
+		return ho
+	}
+
+	ho.Buckets = nil
+	ho.NativeHistogramBucketFactor = opts.PrometheusNativeHistogramBucketFactor
+	if ho.NativeHistogramBucketFactor <= 1 {
+		ho.NativeHistogramBucketFactor = defaultNativeHistogramBucketFactor
+	}
+
+	ho.NativeHistogramMaxBucketNumber = opts.PrometheusNativeHistogramMaxBuckets
+	if ho.NativeHistogramMaxBucketNumber == 0 {
+		ho.NativeHistogramMaxBucketNumber = defaultNativeHistogramMaxBuckets
+	}
+
+	ho.NativeHistogramMinResetDuration = nativeHistogramMinResetDuration
+	return ho
+}
+
+// observe records the observation with the trace ID as exemplar when it
+// is set.
+func observe(o prometheus.Observer, v float64, traceID string) {
+	if traceID != "" {
+		if eo, ok := o.(prometheus.ExemplarObserver); ok {
+			eo.ObserveWithExemplar(v, prometheus.Labels{exemplarTraceIDLabel: traceID})
+			return
+		}
+	}
+
+	o.Observe(v)
+}
+
 // sinceS returns the seconds passed since the start time until now.
 func (p *Prometheus) sinceS(start time.Time) float64 {
 	return time.Since(start).Seconds()
@@ -352,6 +404,7 @@ func (p *Prometheus) CreateHandler() http.Handler {
 	}
 	return promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{
 		DisableCompression: p.opts.DisableCompression,
+		EnableOpenMetrics:  p.opts.EnablePrometheusExemplars,
 	})
 }
 
@@ -429,18 +482,26 @@ func (p *Prometheus) MeasureBackendRequestHeader(host string, size int) {
 
 // MeasureBackend satisfies Metrics interface.
 func (p *Prometheus) MeasureBackend(routeID string, start time.Time) {
+	p.measureBackend(routeID, start, "")
+}
+
+func (p *Prometheus) measureBackend(routeID string, start time.Time, traceID string) {
 	t := p.sinceS(start)
-	p.backendCombinedM.WithLabelValues().Observe(t)
+	observe(p.backendCombinedM.WithLabelValues(), t, traceID)
 	if p.opts.EnableRouteBackendMetrics {
-		p.backendM.WithLabelValues(routeID, "").Observe(t)
+		observe(p.backendM.WithLabelValues(routeID, ""), t, traceID)
 	}
 }
 
 // MeasureBackendHost satisfies Metrics interface.
 func (p *Prometheus) MeasureBackendHost(routeBackendHost string, start time.Time) {
+	p.measureBackendHost(routeBackendHost, start, "")
+}
+
+func (p *Prometheus) measureBackendHost(routeBackendHost string, start time.Time, traceID string) {
 	t := p.sinceS(start)
 	if p.opts.EnableBackendHostMetrics {
-		p.backendM.WithLabelValues("", routeBackendHost).Observe(t)
+		observe(p.backendM.WithLabelValues("", routeBackendHost), t, traceID)
 	}
 }
 
@@ -461,13 +522,17 @@ func (p *Prometheus) MeasureAllFiltersResponse(routeID string, start time.Time)
 
 // MeasureResponse satisfies Metrics interface.
 func (p *Prometheus) MeasureResponse(code int, method string, routeID string, start time.Time) {
+	p.measureResponse(code, method, routeID, start, "")
+}
+
+func (p *Prometheus) measureResponse(code int, method string, routeID string, start time.Time, traceID string) {
 	method = measuredMethod(method)
 	t := p.sinceS(start)
 	if p.opts.EnableCombinedResponseMetrics {
-		p.responseM.WithLabelValues(fmt.Sprint(code), method, "").Observe(t)
+		observe(p.responseM.WithLabelValues(fmt.Sprint(code), method, ""), t, traceID)
 	}
 	if p.opts.EnableRouteResponseMetrics {
-		p.responseM.WithLabelValues(fmt.Sprint(code), method, routeID).Observe(t)
+		observe(p.responseM.WithLabelValues(fmt.Sprint(code), method, routeID), t, traceID)
 	}
 }
 
@@ -488,6 +553,10 @@ func (p *Prometheus) MeasureProxy(requestDuration, responseDuration time.Duratio
 
 // MeasureServe satisfies Metrics interface.
 func (p *Prometheus) MeasureServe(routeID, host, method string, code int, start time.Time) {
+	p.measureServe(routeID, host, method, code, start, "")
+}
+
+func (p *Prometheus) measureServe(routeID, host, method string, code int, start time.Time, traceID string) {
 	method = measuredMethod(method)
 	t := p.sinceS(start)
 
@@ -500,10 +569,10 @@ func (p *Prometheus) MeasureServe(routeID, host, method string, code int, start
 			metrics = append(metrics, method)
 		}
 		if p.opts.EnableServeRouteMetrics {
-			p.serveRouteM.WithLabelValues(append(metrics, routeID)...).Observe(t)
+			observe(p.serveRouteM.WithLabelValues(append(metrics, routeID)...), t, traceID)
 		}
 		if p.opts.EnableServeHostMetrics {
-			p.serveHostM.WithLabelValues(append(metrics, hostForKey(host))...).Observe(t)
+			observe(p.serveHostM.WithLabelValues(append(metrics, hostForKey(host))...), t, traceID)
 		}
 	}
 
@@ -546,6 +615,31 @@ func (p *Prometheus) Close() {}
 
 func (p *Prometheus) String() string { return "prometheus" }
 
+// WithTraceID implements the ExemplarMetrics interface.
+func (p *Prometheus) WithTraceID(traceID string) Metrics {
+	if !p.opts.EnablePrometheusExemplars || traceID == "" {
+		return p
+	}
+
+	return &prometheusExemplar{Prometheus: p, traceID: traceID}
+}
+
+func (e *prometheusExemplar) MeasureBackend(routeID string, start time.Time) {
+	e.measureBackend(routeID, start, e.traceID)
+}
+
+func (e *prometheusExemplar) MeasureBackendHost(routeBackendHost string, start time.Time) {
+	e.measureBackendHost(routeBackendHost, start, e.traceID)
+}
+
+func (e *prometheusExemplar) MeasureResponse(code int, method string, routeID string, start time.Time) {
+	e.measureResponse(code, method, routeID, start, e.traceID)
+}
+
+func (e *prometheusExemplar) MeasureServe(routeID, host, method string, code int, start time.Time) {
+	e.measureServe(routeID, host, method, code, start, e.traceID)
+}
+
 // ScopedPrometheusRegisterer implements the PrometheusMetrics interface
 func (p *Prometheus) ScopedPrometheusRegisterer(subsystem string) prometheus.Registerer {
 	return prometheus.WrapRegistererWithPrefix(p.namespace+"_"+subsystem+"_", p.registry)
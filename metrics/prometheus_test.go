@@ -1339,3 +1339,82 @@ func TestScopedPrometheusRegistererPrefix(t *testing.T) {
 		t.Errorf("expected metric with name 'customprefix_mysubsystem_mycounter' to be registered")
 	}
 }
+
+func TestPrometheusNativeHistograms(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	pm := metrics.NewPrometheus(metrics.Options{
+		PrometheusRegistry:               reg,
+		EnablePrometheusNativeHistograms: true,
+	})
+
+	pm.MeasureRouteLookup(time.Now().Add(-15 * time.Millisecond))
+
+	metricsFamilies, err := reg.Gather()
+	require.NoError(t, err)
+
+	var found bool
+	for _, mf := range metricsFamilies {
+		if mf.GetName() != "skipper_route_lookup_duration_seconds" {
+			continue
+		}
+
+		found = true
+		require.Len(t, mf.GetMetric(), 1)
+
+		h := mf.GetMetric()[0].GetHistogram()
+		assert.Empty(t, h.GetBucket(), "expected no classic buckets")
+		assert.NotEmpty(t, h.GetPositiveSpan(), "expected native histogram spans")
+		assert.Equal(t, int32(3), h.GetSchema())
+		assert.Equal(t, uint64(1), h.GetSampleCount())
+	}
+	assert.True(t, found, "expected route lookup histogram")
+}
+
+func TestPrometheusExemplars(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		enableExemplars  bool
+		traceID          string
+		expectedExemplar string
+	}{{
+		name:             "exemplar with trace id",
+		enableExemplars:  true,
+		traceID:          "4bf92f3577b34da6a3ce929d0e0e4736",
+		expectedExemplar: "4bf92f3577b34da6a3ce929d0e0e4736",
+	}, {
+		name:            "no exemplar without trace id",
+		enableExemplars: true,
+	}, {
+		name:    "no exemplar when disabled",
+		traceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			pm := metrics.NewPrometheus(metrics.Options{
+				PrometheusRegistry:        reg,
+				EnablePrometheusExemplars: tc.enableExemplars,
+			})
+
+			pm.WithTraceID(tc.traceID).MeasureBackend("route1", time.Now().Add(-15*time.Millisecond))
+
+			metricsFamilies, err := reg.Gather()
+			require.NoError(t, err)
+
+			var exemplar string
+			for _, mf := range metricsFamilies {
+				if mf.GetName() != "skipper_backend_duration_seconds" {
+					continue
+				}
+
+				for _, b := range mf.GetMetric()[0].GetHistogram().GetBucket() {
+					for _, l := range b.GetExemplar().GetLabel() {
+						if l.GetName() == "trace_id" {
+							exemplar = l.GetValue()
+						}
+					}
+				}
+			}
+			assert.Equal(t, tc.expectedExemplar, exemplar)
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package net
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+)
+
+type multiReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// PeekBody reads a request or response body up to the limit, and returns
+// the read content, and a body that reads the complete content again. The
+// returned flag is true, when the content is the complete body. Otherwise
+// the original body is closed only by closing the returned body.
+func PeekBody(body io.ReadCloser, limit int64) ([]byte, io.ReadCloser, bool) {
+	if body == nil || body == http.NoBody {
+		return nil, body, true
+	}
+
+	b, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil || int64(len(b)) > limit {
+		return b[:min(int64(len(b)), limit)], &multiReadCloser{Reader: io.MultiReader(bytes.NewReader(b), body), Closer: body}, false
+	}
+
+	body.Close()
+	return b, io.NopCloser(bytes.NewReader(b)), true
+}
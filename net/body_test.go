@@ -0,0 +1,57 @@
+package net
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type closeTracker struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeTracker) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestPeekBody(t *testing.T) {
+	for _, tc := range []struct {
+		content  string
+		limit    int64
+		peeked   string
+		complete bool
+	}{
+		{content: "", limit: 3, peeked: "", complete: true},
+		{content: "foo", limit: 3, peeked: "foo", complete: true},
+		{content: "foobar", limit: 3, peeked: "foo", complete: false},
+	} {
+		t.Run(tc.content, func(t *testing.T) {
+			original := &closeTracker{Reader: strings.NewReader(tc.content)}
+			peeked, body, complete := PeekBody(original, tc.limit)
+			if string(peeked) != tc.peeked || complete != tc.complete {
+				t.Fatalf("got %q, %v, expected %q, %v", peeked, complete, tc.peeked, tc.complete)
+			}
+
+			if original.closed != complete {
+				t.Errorf("original body closed: %v", original.closed)
+			}
+
+			b, err := io.ReadAll(body)
+			if err != nil || string(b) != tc.content {
+				t.Errorf("failed to read the complete body again: %q, %v", b, err)
+			}
+
+			body.Close()
+			if !original.closed {
+				t.Error("original body not closed")
+			}
+		})
+	}
+
+	if _, body, complete := PeekBody(http.NoBody, 3); body != http.NoBody || !complete {
+		t.Error("unexpected body for http.NoBody")
+	}
+}
@@ -0,0 +1,439 @@
+package net
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// ClientHelloStateBagKey is the key of the *ClientHello of the TLS
+// connection of the request in the filter state bag.
+const ClientHelloStateBagKey = "tls:clientHello"
+
+const (
+	extensionServerName        = 0x0000
+	extensionALPN              = 0x0010
+	extensionSupportedVersions = 0x002b
+)
+
+// ClientHello contains the details of the TLS ClientHello message of a
+// connection, and its JA3 and JA4 fingerprints.
+type ClientHello struct {
+	// ServerName is the SNI sent by the client.
+	ServerName string
+
+	// SupportedProtos are the ALPN protocols offered by the client.
+	SupportedProtos []string
+
+	// SupportedVersions are the TLS versions offered by the client.
+	SupportedVersions []uint16
+
+	// CipherSuites are the cipher suites offered by the client.
+	CipherSuites []uint16
+
+	extensions       []uint16
+	curves           []tls.CurveID
+	points           []uint8
+	signatureSchemes []tls.SignatureScheme
+	quic             bool
+
+	once sync.Once
+	ja3  string
+	ja4  string
+}
+
+func newClientHello(hello *tls.ClientHelloInfo) *ClientHello {
+	return &ClientHello{
+		ServerName:        hello.ServerName,
+		SupportedProtos:   slices.Clone(hello.SupportedProtos),
+		SupportedVersions: slices.Clone(hello.SupportedVersions),
+		CipherSuites:      slices.Clone(hello.CipherSuites),
+		extensions:        slices.Clone(hello.Extensions),
+		curves:            slices.Clone(hello.SupportedCurves),
+		points:            slices.Clone(hello.SupportedPoints),
+		signatureSchemes:  slices.Clone(hello.SignatureSchemes),
+	}
+}
+
+// JA3 returns the MD5 hash of the JA3 fingerprint of the ClientHello.
+//
+// The ClientHello doesn't expose the legacy version field, that is
+// approximated with TLS 1.2, when the client sent the supported
+// versions extension, like all TLS 1.3 clients do, and otherwise with
+// its highest version.
+func (h *ClientHello) JA3() string {
+	h.fingerprint()
+	return h.ja3
+}
+
+// JA4 returns the JA4 fingerprint of the ClientHello, e.g.
+// t13d1516h2_8daaf6152771_e5627efa2ab1.
+func (h *ClientHello) JA4() string {
+	h.fingerprint()
+	return h.ja4
+}
+
+func (h *ClientHello) fingerprint() {
+	h.once.Do(func() {
+		h.ja3 = h.computeJA3()
+		h.ja4 = h.computeJA4()
+	})
+}
+
+// isGREASE tells whether the value is one of the reserved GREASE
+// values of RFC 8701, that are ignored by the fingerprints.
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+func withoutGREASE[T ~uint16](values []T) []T {
+	var result []T
+	for _, v := range values {
+		if !isGREASE(uint16(v)) {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+func joinInts[T ~uint8 | ~uint16](values []T, sep string) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = strconv.Itoa(int(v))
+	}
+
+	return strings.Join(s, sep)
+}
+
+func joinHex[T ~uint16](values []T) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = fmt.Sprintf("%04x", uint16(v))
+	}
+
+	return strings.Join(s, ",")
+}
+
+func (h *ClientHello) maxVersion() uint16 {
+	var version uint16
+	for _, v := range withoutGREASE(h.SupportedVersions) {
+		version = max(version, v)
+	}
+
+	return version
+}
+
+func (h *ClientHello) computeJA3() string {
+	version := h.maxVersion()
+	if slices.Contains(h.extensions, extensionSupportedVersions) {
+		version = tls.VersionTLS12
+	}
+
+	s := strings.Join([]string{
+		strconv.Itoa(int(version)),
+		joinInts(withoutGREASE(h.CipherSuites), "-"),
+		joinInts(withoutGREASE(h.extensions), "-"),
+		joinInts(withoutGREASE(h.curves), "-"),
+		joinInts(h.points, "-"),
+	}, ",")
+
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func truncatedHash(s string) string {
+	if s == "" {
+		return "000000000000"
+	}
+
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func ja4Version(v uint16) string {
+	switch v {
+	case tls.VersionTLS13:
+		return "13"
+	case tls.VersionTLS12:
+		return "12"
+	case tls.VersionTLS11:
+		return "11"
+	case tls.VersionTLS10:
+		return "10"
+	case tls.VersionSSL30: //nolint:staticcheck // fingerprint of legacy clients
+		return "s3"
+	default:
+		return "00"
+	}
+}
+
+func isAlphanumeric(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func ja4ALPN(protos []string) string {
+	if len(protos) == 0 || protos[0] == "" {
+		return "00"
+	}
+
+	p := protos[0]
+	first, last := p[0], p[len(p)-1]
+	if !isAlphanumeric(first) || !isAlphanumeric(last) {
+		return fmt.Sprintf("%x%x", first>>4, last&0x0f)
+	}
+
+	return string([]byte{first, last})
+}
+
+func (h *ClientHello) computeJA4() string {
+	sni := "i"
+	if h.ServerName != "" {
+		sni = "d"
+	}
+
+	ciphers := withoutGREASE(h.CipherSuites)
+	extensions := withoutGREASE(h.extensions)
+
+	protocol := "t"
+	if h.quic {
+		protocol = "q"
+	}
+
+	a := fmt.Sprintf("%s%s%s%02d%02d%s",
+		protocol,
+		ja4Version(h.maxVersion()),
+		sni,
+		min(len(ciphers), 99),
+		min(len(extensions), 99),
+		ja4ALPN(h.SupportedProtos),
+	)
+
+	sortedCiphers := slices.Clone(ciphers)
+	slices.Sort(sortedCiphers)
+	b := truncatedHash(joinHex(sortedCiphers))
+
+	var sortedExtensions []uint16
+	for _, e := range extensions {
+		if e != extensionServerName && e != extensionALPN {
+			sortedExtensions = append(sortedExtensions, e)
+		}
+	}
+
+	slices.Sort(sortedExtensions)
+	c := joinHex(sortedExtensions)
+	if schemes := withoutGREASE(h.signatureSchemes); len(schemes) > 0 && c != "" {
+		c += "_" + joinHex(schemes)
+	}
+
+	return a + "_" + b + "_" + truncatedHash(c)
+}
+
+const quicHelloTTL = time.Minute
+
+type clientHelloKey struct{}
+
+type quicClientHelloKey struct{}
+
+type quicClientHello struct {
+	hello   *ClientHello
+	created time.Time
+}
+
+type clientHelloConn struct {
+	recorder *ClientHelloRecorder
+	conn     net.Conn
+}
+
+// ClientHelloRecorder captures the ClientHello messages of the TLS
+// connections of an [http.Server] and of the QUIC connections of an
+// [http3.Server], and makes them available to the requests with
+// [TLSClientHello]. Use [ClientHelloRecorder.Configure] and
+// [ClientHelloRecorder.ConfigureHTTP3] to set it up.
+type ClientHelloRecorder struct {
+	hellos sync.Map
+
+	// the ClientHellos of the QUIC handshakes in progress, by the
+	// addresses of the connection
+	mu          sync.Mutex
+	quicHellos  map[string]quicClientHello
+	quicCleanup time.Time
+}
+
+// Configure sets up the recorder for the server. It needs to be called
+// after the TLS config of the server is set. It doesn't change the
+// original TLS config.
+func (cr *ClientHelloRecorder) Configure(server *http.Server) {
+	if server.TLSConfig == nil {
+		return
+	}
+
+	config := server.TLSConfig.Clone()
+	next := config.GetConfigForClient
+	config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		cr.hellos.Store(hello.Conn, newClientHello(hello))
+		if next != nil {
+			return next(hello)
+		}
+
+		return nil, nil
+	}
+
+	server.TLSConfig = config
+
+	if cc := server.ConnContext; cc != nil {
+		server.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+			ctx = cc(ctx, c)
+			return cr.connContext(ctx, c)
+		}
+	} else {
+		server.ConnContext = cr.connContext
+	}
+
+	if cs := server.ConnState; cs != nil {
+		server.ConnState = func(c net.Conn, state http.ConnState) {
+			cs(c, state)
+			cr.connState(c, state)
+		}
+	} else {
+		server.ConnState = cr.connState
+	}
+}
+
+// ConfigureHTTP3 sets up the recorder for the HTTP/3 server. It needs to
+// be called after the TLS config of the server is set. It doesn't change
+// the original TLS config.
+func (cr *ClientHelloRecorder) ConfigureHTTP3(server *http3.Server) {
+	if server.TLSConfig == nil {
+		return
+	}
+
+	config := server.TLSConfig.Clone()
+	next := config.GetConfigForClient
+	config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		// quic-go sets a connection with the addresses only
+		if hello.Conn != nil {
+			h := newClientHello(hello)
+			h.quic = true
+			cr.storeQUIC(quicConnKey(hello.Conn.LocalAddr(), hello.Conn.RemoteAddr()), h)
+		}
+
+		if next != nil {
+			return next(hello)
+		}
+
+		return nil, nil
+	}
+
+	server.TLSConfig = config
+
+	cc := server.ConnContext
+	server.ConnContext = func(ctx context.Context, c *quic.Conn) context.Context {
+		if cc != nil {
+			ctx = cc(ctx, c)
+		}
+
+		if h := cr.loadQUIC(quicConnKey(c.LocalAddr(), c.RemoteAddr())); h != nil {
+			ctx = context.WithValue(ctx, quicClientHelloKey{}, h)
+		}
+
+		return ctx
+	}
+}
+
+func quicConnKey(local, remote net.Addr) string {
+	return local.String() + " " + remote.String()
+}
+
+// storeQUIC stores the ClientHello until the handshake completes. The
+// ClientHellos of the failed handshakes are removed after a timeout.
+func (cr *ClientHelloRecorder) storeQUIC(key string, h *ClientHello) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	now := time.Now()
+	if cr.quicHellos == nil {
+		cr.quicHellos = make(map[string]quicClientHello)
+	}
+
+	if now.Sub(cr.quicCleanup) > quicHelloTTL {
+		for k, qh := range cr.quicHellos {
+			if now.Sub(qh.created) > quicHelloTTL {
+				delete(cr.quicHellos, k)
+			}
+		}
+
+		cr.quicCleanup = now
+	}
+
+	cr.quicHellos[key] = quicClientHello{hello: h, created: now}
+}
+
+// loadQUIC returns and removes the ClientHello of a completed handshake.
+// It is kept in the context of the connection.
+func (cr *ClientHelloRecorder) loadQUIC(key string) *ClientHello {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	qh, ok := cr.quicHellos[key]
+	if !ok {
+		return nil
+	}
+
+	delete(cr.quicHellos, key)
+	return qh.hello
+}
+
+// netConn returns the connection passed to the TLS handshake.
+func netConn(c net.Conn) net.Conn {
+	if tc, ok := c.(*tls.Conn); ok {
+		return tc.NetConn()
+	}
+
+	return c
+}
+
+func (cr *ClientHelloRecorder) connContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, clientHelloKey{}, &clientHelloConn{recorder: cr, conn: netConn(c)})
+}
+
+func (cr *ClientHelloRecorder) connState(c net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateClosed, http.StateHijacked:
+		cr.hellos.Delete(netConn(c))
+	}
+}
+
+// TLSClientHello returns the ClientHello of the TLS connection of the
+// request, or nil, when the request was not received by a server
+// configured with a ClientHelloRecorder, or not via TLS.
+func TLSClientHello(r *http.Request) *ClientHello {
+	if h, ok := r.Context().Value(quicClientHelloKey{}).(*ClientHello); ok {
+		return h
+	}
+
+	hc, ok := r.Context().Value(clientHelloKey{}).(*clientHelloConn)
+	if !ok {
+		return nil
+	}
+
+	h, ok := hc.recorder.hellos.Load(hc.conn)
+	if !ok {
+		return nil
+	}
+
+	return h.(*ClientHello)
+}
@@ -0,0 +1,181 @@
+package net
+
+import (
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testHello is the ClientHello of the JA4 reference fingerprint
+// t13d1516h2_8daaf6152771_e5627efa2ab1, with GREASE values added.
+func testHello() *tls.ClientHelloInfo {
+	return &tls.ClientHelloInfo{
+		ServerName:        "example.org",
+		SupportedProtos:   []string{"h2", "http/1.1"},
+		SupportedVersions: []uint16{0x0a0a, tls.VersionTLS13, tls.VersionTLS12},
+		CipherSuites:      []uint16{0x1a1a, 0x1301, 0x1302, 0x1303, 0xc02b, 0xc02f, 0xc02c, 0xc030, 0xcca9, 0xcca8, 0xc013, 0xc014, 0x009c, 0x009d, 0x002f, 0x0035},
+		Extensions:        []uint16{0x2a2a, 0x0000, 0x0010, 0x0005, 0x000a, 0x000b, 0x000d, 0x0012, 0x0015, 0x0017, 0x001b, 0x0023, 0x002b, 0x002d, 0x0033, 0x4469, 0xff01},
+		SupportedCurves:   []tls.CurveID{0x3a3a, tls.X25519, tls.CurveP256, tls.CurveP384},
+		SupportedPoints:   []uint8{0},
+		SignatureSchemes:  []tls.SignatureScheme{0x0403, 0x0804, 0x0401, 0x0503, 0x0805, 0x0501, 0x0806, 0x0601},
+	}
+}
+
+func TestClientHelloJA4(t *testing.T) {
+	h := newClientHello(testHello())
+	assert.Equal(t, "t13d1516h2_8daaf6152771_e5627efa2ab1", h.JA4())
+
+	for _, tt := range []struct {
+		name   string
+		modify func(*tls.ClientHelloInfo)
+		prefix string
+	}{{
+		name:   "no SNI",
+		modify: func(h *tls.ClientHelloInfo) { h.ServerName = "" },
+		prefix: "t13i1516h2_",
+	}, {
+		name:   "no ALPN",
+		modify: func(h *tls.ClientHelloInfo) { h.SupportedProtos = nil },
+		prefix: "t13d151600_",
+	}, {
+		name:   "non-alphanumeric ALPN",
+		modify: func(h *tls.ClientHelloInfo) { h.SupportedProtos = []string{"\xabx\xcd"} },
+		prefix: "t13d1516ad_",
+	}, {
+		name:   "TLS 1.2",
+		modify: func(h *tls.ClientHelloInfo) { h.SupportedVersions = []uint16{tls.VersionTLS12, tls.VersionTLS11} },
+		prefix: "t12d1516h2_",
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			hello := testHello()
+			tt.modify(hello)
+			assert.Regexp(t, "^"+tt.prefix+"[0-9a-f]{12}_[0-9a-f]{12}$", newClientHello(hello).JA4())
+		})
+	}
+}
+
+func TestClientHelloJA3(t *testing.T) {
+	expected := md5.Sum([]byte(
+		"771," +
+			"4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53," +
+			"0-16-5-10-11-13-18-21-23-27-35-43-45-51-17513-65281," +
+			"29-23-24," +
+			"0",
+	))
+
+	assert.Equal(t, hex.EncodeToString(expected[:]), newClientHello(testHello()).JA3())
+}
+
+func TestIsGREASE(t *testing.T) {
+	for _, v := range []uint16{0x0a0a, 0x1a1a, 0xfafa} {
+		assert.True(t, isGREASE(v), "%04x", v)
+	}
+
+	for _, v := range []uint16{0x0a1a, 0x1301, 0x0000, 0xaaab} {
+		assert.False(t, isGREASE(v), "%04x", v)
+	}
+}
+
+func TestClientHelloRecorder(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		hellos []*ClientHello
+	)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hellos = append(hellos, TLSClientHello(r))
+		mu.Unlock()
+	}))
+
+	ts.Config.TLSConfig = &tls.Config{NextProtos: []string{"http/1.1"}}
+	cr := &ClientHelloRecorder{}
+	cr.Configure(ts.Config)
+	ts.TLS = ts.Config.TLSConfig
+	ts.StartTLS()
+	defer ts.Close()
+
+	client := ts.Client()
+	client.Transport.(*http.Transport).TLSClientConfig.ServerName = "example.com"
+	for i := 0; i < 2; i++ {
+		rsp, err := client.Get(ts.URL)
+		require.NoError(t, err)
+		rsp.Body.Close()
+	}
+
+	mu.Lock()
+	require.Len(t, hellos, 2)
+	require.NotNil(t, hellos[0])
+	assert.Same(t, hellos[0], hellos[1], "requests of the same connection share the ClientHello")
+	assert.Equal(t, "example.com", hellos[0].ServerName)
+	assert.Regexp(t, "^t13d", hellos[0].JA4())
+	assert.Len(t, hellos[0].JA3(), 32)
+	mu.Unlock()
+
+	client.CloseIdleConnections()
+	assert.Eventually(t, func() bool {
+		n := 0
+		cr.hellos.Range(func(any, any) bool { n++; return true })
+		return n == 0
+	}, time.Second, 10*time.Millisecond, "ClientHello is deleted when the connection is closed")
+}
+
+func TestClientHelloRecorderHTTP3(t *testing.T) {
+	// the certificate of the test server
+	ts := httptest.NewTLSServer(nil)
+	cert := ts.TLS.Certificates[0]
+	ts.Close()
+
+	hellos := make(chan *ClientHello, 2)
+	server := &http3.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hellos <- TLSClientHello(r)
+		}),
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}),
+	}
+
+	cr := &ClientHelloRecorder{}
+	cr.ConfigureHTTP3(server)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(conn)
+	defer server.Close()
+
+	client := &http.Client{Transport: &http3.Transport{TLSClientConfig: &tls.Config{
+		InsecureSkipVerify: true,
+		ServerName:         "example.com",
+	}}}
+	defer client.Transport.(*http3.Transport).Close()
+
+	for i := 0; i < 2; i++ {
+		rsp, err := client.Get("https://" + conn.LocalAddr().String())
+		require.NoError(t, err)
+		rsp.Body.Close()
+	}
+
+	h1, h2 := <-hellos, <-hellos
+	require.NotNil(t, h1)
+	assert.Same(t, h1, h2, "requests of the same connection share the ClientHello")
+	assert.Equal(t, "example.com", h1.ServerName)
+	assert.Regexp(t, "^q13d", h1.JA4())
+
+	cr.mu.Lock()
+	assert.Empty(t, cr.quicHellos, "ClientHello is kept only in the connection context")
+	cr.mu.Unlock()
+}
+
+func TestTLSClientHelloWithoutRecorder(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	assert.Nil(t, TLSClientHello(r))
+}
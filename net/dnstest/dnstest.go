@@ -6,6 +6,7 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"sync"
 	"testing"
 	"time"
 
@@ -84,6 +85,91 @@ func (h *dnsHandler) nameError(w dns.ResponseWriter, r *dns.Msg) {
 	w.WriteMsg(reply)
 }
 
+// Server is a DNS server answering the queries from a configurable
+// set of resource records.
+type Server struct {
+	server  *dns.Server
+	mu      sync.Mutex
+	records []dns.RR
+}
+
+// NewServer starts a DNS server answering with the records provided
+// in zone file format, e.g. "service.test. 30 IN A 127.0.0.1".
+// Uses t.Cleanup to shut down the server after the test.
+func NewServer(t *testing.T, records ...string) *Server {
+	s := &Server{}
+	s.SetRecords(t, records...)
+
+	mux := dns.NewServeMux()
+	mux.HandleFunc(".", s.handle)
+
+	server, err := startServer(mux)
+	if err != nil {
+		t.Fatal(err)
+		return nil
+	}
+
+	s.server = server
+	t.Cleanup(func() { server.Shutdown() })
+	return s
+}
+
+// Addr returns the UDP address of the server.
+func (s *Server) Addr() string {
+	return s.server.PacketConn.LocalAddr().String()
+}
+
+// SetRecords replaces the records of the server.
+func (s *Server) SetRecords(t *testing.T, records ...string) {
+	rrs := make([]dns.RR, 0, len(records))
+	for _, r := range records {
+		rr, err := dns.NewRR(r)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		rrs = append(rrs, rr)
+	}
+
+	s.mu.Lock()
+	s.records = rrs
+	s.mu.Unlock()
+}
+
+func (s *Server) handle(w dns.ResponseWriter, r *dns.Msg) {
+	reply := new(dns.Msg)
+	if r.MsgHdr.Opcode != dns.OpcodeQuery || len(r.Question) != 1 {
+		reply.SetRcode(r, dns.RcodeNameError)
+		w.WriteMsg(reply)
+		return
+	}
+
+	q := r.Question[0]
+	qname := dns.CanonicalName(q.Name)
+
+	s.mu.Lock()
+	found := false
+	for _, rr := range s.records {
+		h := rr.Header()
+		if dns.CanonicalName(h.Name) != qname {
+			continue
+		}
+
+		found = true
+		if h.Rrtype == q.Qtype {
+			reply.Answer = append(reply.Answer, dns.Copy(rr))
+		}
+	}
+	s.mu.Unlock()
+
+	if found {
+		reply.SetRcode(r, dns.RcodeSuccess)
+	} else {
+		reply.SetRcode(r, dns.RcodeNameError)
+	}
+	w.WriteMsg(reply)
+}
+
 func startServer(handler dns.Handler) (*dns.Server, error) {
 	ready := make(chan error, 1)
 	server := &dns.Server{
@@ -0,0 +1,63 @@
+// Package builtin provides the predicates bundled with skipper, that
+// don't depend on its runtime configuration.
+//
+// The predicates depending on the runtime configuration, e.g. GeoIP and
+// Canary, are added by skipper on startup, when they are enabled.
+package builtin
+
+import (
+	"github.com/zalando/skipper/predicates/auth"
+	"github.com/zalando/skipper/predicates/content"
+	"github.com/zalando/skipper/predicates/cookie"
+	"github.com/zalando/skipper/predicates/cron"
+	"github.com/zalando/skipper/predicates/forwarded"
+	"github.com/zalando/skipper/predicates/graphql"
+	"github.com/zalando/skipper/predicates/host"
+	"github.com/zalando/skipper/predicates/interval"
+	"github.com/zalando/skipper/predicates/methods"
+	"github.com/zalando/skipper/predicates/otel"
+	"github.com/zalando/skipper/predicates/primitive"
+	"github.com/zalando/skipper/predicates/query"
+	"github.com/zalando/skipper/predicates/source"
+	"github.com/zalando/skipper/predicates/tee"
+	"github.com/zalando/skipper/predicates/tlsconn"
+	"github.com/zalando/skipper/predicates/traffic"
+	"github.com/zalando/skipper/routing"
+)
+
+// Predicates returns the specifications of the predicates bundled with
+// skipper, in addition to the ones provided by the routing package.
+func Predicates() []routing.PredicateSpec {
+	return []routing.PredicateSpec{
+		source.New(),
+		source.NewFromLast(),
+		source.NewClientIP(),
+		interval.NewBetween(),
+		interval.NewBefore(),
+		interval.NewAfter(),
+		cron.New(),
+		cookie.New(),
+		query.New(),
+		traffic.New(),
+		traffic.NewSegment(),
+		primitive.NewTrue(),
+		primitive.NewFalse(),
+		primitive.NewShutdown(),
+		auth.NewJWTPayloadAllKV(),
+		auth.NewJWTPayloadAnyKV(),
+		auth.NewJWTPayloadAllKVRegexp(),
+		auth.NewJWTPayloadAnyKVRegexp(),
+		auth.NewHeaderSHA256(),
+		methods.New(),
+		tee.New(),
+		forwarded.NewForwardedHost(),
+		forwarded.NewForwardedProto(),
+		host.NewAny(),
+		content.NewContentLengthBetween(),
+		otel.NewBaggage(),
+		tlsconn.NewTLSVersion(),
+		tlsconn.NewSNI(),
+		tlsconn.NewJA4(),
+		graphql.NewOperation(),
+	}
+}
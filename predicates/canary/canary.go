@@ -0,0 +1,63 @@
+/*
+Package canary implements a predicate to shift the traffic to a canary
+route, by the weight of its canary group, that is raised step by step
+or set to 0 by the automated analysis of the canary filter. See the
+canary package for the details of the analysis.
+
+The predicate is available when the canary analysis is enabled with
+-enable-canary-analysis. Until the group is configured by a canary
+filter, the predicate doesn't match.
+
+Example:
+
+	baseline: Path("/api") -> canaryBaseline("api-v2") -> "https://api-v1.example.org";
+	canary: Path("/api") && Canary("api-v2") -> canary("api-v2", 10, "5m", 0.01, "500ms") -> "https://api-v2.example.org";
+*/
+package canary
+
+import (
+	"math/rand/v2"
+	"net/http"
+
+	"github.com/zalando/skipper/canary"
+	"github.com/zalando/skipper/predicates"
+	"github.com/zalando/skipper/routing"
+)
+
+type spec struct {
+	registry *canary.Registry
+}
+
+type predicate struct {
+	group *canary.Group
+}
+
+// New creates the Canary predicate specification, using the registry
+// of the canary groups.
+func New(r *canary.Registry) routing.PredicateSpec {
+	return &spec{registry: r}
+}
+
+func (*spec) Name() string { return predicates.CanaryName }
+
+func (s *spec) Create(args []interface{}) (routing.Predicate, error) {
+	if len(args) != 1 {
+		return nil, predicates.ErrInvalidPredicateParameters
+	}
+
+	name, ok := args[0].(string)
+	if !ok || name == "" {
+		return nil, predicates.ErrInvalidPredicateParameters
+	}
+
+	p := &predicate{}
+	if s.registry != nil {
+		p.group = s.registry.Group(name)
+	}
+
+	return p, nil
+}
+
+func (p *predicate) Match(*http.Request) bool {
+	return p.group != nil && rand.Float64() < p.group.Weight() // #nosec
+}
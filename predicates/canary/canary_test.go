@@ -0,0 +1,66 @@
+package canary
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando/skipper/canary"
+	"github.com/zalando/skipper/metrics/metricstest"
+	"github.com/zalando/skipper/routing"
+)
+
+func TestArgs(t *testing.T) {
+	s := New(nil)
+	for _, args := range [][]interface{}{
+		{},
+		{""},
+		{42},
+		{"api", "v2"},
+	} {
+		if _, err := s.Create(args); err == nil {
+			t.Errorf("expected error for arguments: %v", args)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	r := canary.NewRegistry(canary.Options{
+		Metrics:          &metricstest.MockMetrics{},
+		EndpointRegistry: routing.NewEndpointRegistry(routing.RegistryOptions{}),
+	})
+	defer r.Close()
+
+	s := New(r)
+	pending, err := s.Create([]interface{}{"pending"})
+	require.NoError(t, err)
+
+	r.Update([]canary.Member{{
+		Group:   "promoted",
+		RouteID: "canary",
+		Canary:  true,
+		Config: canary.Config{
+			StepPercent:  100,
+			Interval:     time.Minute,
+			MaxErrorRate: 0.01,
+			MaxP99:       time.Second,
+		},
+		Hosts: []string{"canary.test:80"},
+	}})
+
+	promoted, err := s.Create([]interface{}{"promoted"})
+	require.NoError(t, err)
+
+	withoutRegistry, err := New(nil).Create([]interface{}{"promoted"})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	for i := 0; i < 100; i++ {
+		assert.False(t, pending.Match(req))
+		assert.True(t, promoted.Match(req))
+		assert.False(t, withoutRegistry.Match(req))
+	}
+}
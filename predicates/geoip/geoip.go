@@ -0,0 +1,133 @@
+/*
+Package geoip implements a predicate to match the country, the
+continent or the autonomous system of the client of the request, looked
+up in the GeoIP databases configured with -geoip-databases.
+
+The address of the client is determined like by the SourceFromLast
+predicate, or, depending on -geoip-client-ip, like by the Source or the
+ClientIP predicates. The requests with unknown location don't match.
+
+Examples:
+
+	// matches the requests from Germany or Austria
+	dach: GeoIP("country", "DE", "AT") -> "https://dach.example.org";
+
+	// matches the requests from Europe
+	eu: GeoIP("continent", "EU") -> "https://eu.example.org";
+
+	// matches the requests from the autonomous systems
+	blocked: GeoIP("asn", "AS64496", "64511") -> status(403) -> <shunt>;
+*/
+package geoip
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/zalando/skipper/geoip"
+	"github.com/zalando/skipper/predicates"
+	"github.com/zalando/skipper/routing"
+)
+
+const (
+	fieldCountry   = "country"
+	fieldContinent = "continent"
+	fieldASN       = "asn"
+)
+
+type spec struct {
+	db *geoip.Database
+}
+
+type predicate struct {
+	db     *geoip.Database
+	field  string
+	values []string
+}
+
+// New creates the GeoIP predicate specification, using the database
+// for the lookups.
+func New(db *geoip.Database) routing.PredicateSpec {
+	return &spec{db: db}
+}
+
+func (*spec) Name() string { return predicates.GeoIPName }
+
+func (s *spec) Create(args []interface{}) (routing.Predicate, error) {
+	if len(args) < 2 {
+		return nil, predicates.ErrInvalidPredicateParameters
+	}
+
+	field, ok := args[0].(string)
+	if !ok {
+		return nil, predicates.ErrInvalidPredicateParameters
+	}
+
+	p := &predicate{db: s.db, field: field}
+	for _, a := range args[1:] {
+		var v string
+		switch field {
+		case fieldCountry, fieldContinent:
+			s, ok := a.(string)
+			if !ok || s == "" {
+				return nil, predicates.ErrInvalidPredicateParameters
+			}
+
+			v = strings.ToUpper(s)
+		case fieldASN:
+			asn, err := parseASN(a)
+			if err != nil {
+				return nil, err
+			}
+
+			v = strconv.FormatUint(asn, 10)
+		default:
+			return nil, predicates.ErrInvalidPredicateParameters
+		}
+
+		p.values = append(p.values, v)
+	}
+
+	return p, nil
+}
+
+// parseASN accepts the autonomous system numbers as numbers, or strings
+// with an optional AS prefix.
+func parseASN(a interface{}) (uint64, error) {
+	switch v := a.(type) {
+	case float64:
+		if v < 1 || v != float64(uint32(v)) {
+			return 0, predicates.ErrInvalidPredicateParameters
+		}
+
+		return uint64(v), nil
+	case string:
+		v = strings.TrimPrefix(strings.ToUpper(v), "AS")
+		asn, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || asn == 0 {
+			return 0, predicates.ErrInvalidPredicateParameters
+		}
+
+		return asn, nil
+	default:
+		return 0, predicates.ErrInvalidPredicateParameters
+	}
+}
+
+func (p *predicate) Match(r *http.Request) bool {
+	rec := p.db.LookupRequest(r)
+
+	var v string
+	switch p.field {
+	case fieldCountry:
+		v = rec.Country
+	case fieldContinent:
+		v = rec.Continent
+	case fieldASN:
+		v = rec.ASNString()
+	}
+
+	return v != "" && slices.Contains(p.values, v)
+}
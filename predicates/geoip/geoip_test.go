@@ -0,0 +1,127 @@
+package geoip
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando/skipper/geoip"
+	"github.com/zalando/skipper/geoip/geoiptest"
+)
+
+func testDatabase(t *testing.T) *geoip.Database {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	require.NoError(t, geoiptest.Database{
+		Networks: map[string]map[string]any{
+			"1.2.3.0/24": {
+				"country":                  map[string]any{"iso_code": "DE"},
+				"continent":                map[string]any{"code": "EU"},
+				"autonomous_system_number": uint32(3320),
+			},
+			"2001:db8::/32": {
+				"country":   map[string]any{"iso_code": "US"},
+				"continent": map[string]any{"code": "NA"},
+			},
+		},
+	}.Write(path))
+
+	db, err := geoip.New(geoip.Options{Files: []string{path}})
+	require.NoError(t, err)
+	t.Cleanup(db.Close)
+	return db
+}
+
+func TestArgs(t *testing.T) {
+	s := New(nil)
+	for _, args := range [][]interface{}{
+		{},
+		{"country"},
+		{"city", "Berlin"},
+		{42, "DE"},
+		{"country", ""},
+		{"country", "DE", 42},
+		{"asn", "ASX"},
+		{"asn", "0"},
+		{"asn", 3.5},
+		{"asn", -1.0},
+		{"asn", true},
+	} {
+		if _, err := s.Create(args); err == nil {
+			t.Errorf("expected error for arguments: %v", args)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	s := New(testDatabase(t))
+	for _, tc := range []struct {
+		name  string
+		args  []interface{}
+		addr  string
+		match bool
+	}{{
+		name:  "country",
+		args:  []interface{}{"country", "AT", "DE"},
+		addr:  "1.2.3.4",
+		match: true,
+	}, {
+		name:  "country case-insensitive",
+		args:  []interface{}{"country", "de"},
+		addr:  "1.2.3.4",
+		match: true,
+	}, {
+		name:  "other country",
+		args:  []interface{}{"country", "AT"},
+		addr:  "1.2.3.4",
+		match: false,
+	}, {
+		name:  "IPv6",
+		args:  []interface{}{"country", "US"},
+		addr:  "2001:db8::1",
+		match: true,
+	}, {
+		name:  "continent",
+		args:  []interface{}{"continent", "EU"},
+		addr:  "1.2.3.4",
+		match: true,
+	}, {
+		name:  "asn with prefix",
+		args:  []interface{}{"asn", "AS3320"},
+		addr:  "1.2.3.4",
+		match: true,
+	}, {
+		name:  "asn as string",
+		args:  []interface{}{"asn", "15169", "3320"},
+		addr:  "1.2.3.4",
+		match: true,
+	}, {
+		name:  "asn as number",
+		args:  []interface{}{"asn", 3320.0},
+		addr:  "1.2.3.4",
+		match: true,
+	}, {
+		name:  "unknown asn",
+		args:  []interface{}{"asn", 3320.0},
+		addr:  "2001:db8::1",
+		match: false,
+	}, {
+		name:  "unknown address",
+		args:  []interface{}{"country", "DE"},
+		addr:  "5.6.7.8",
+		match: false,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := s.Create(tc.args)
+			require.NoError(t, err)
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("X-Forwarded-For", tc.addr)
+			assert.Equal(t, tc.match, p.Match(r))
+		})
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Package graphql implements a predicate to route the GraphQL requests by
+the name or the type of their operation.
+
+The GraphQL query is taken from the query parameters of the GET
+requests, or from the application/json or application/graphql body of
+the POST requests. The body is read up to 1MiB, and it is forwarded to
+the backend unchanged. The requests that are not valid GraphQL requests
+don't match.
+
+Examples:
+
+	// routes the mutations to the write API
+	mutations: Path("/graphql") && GraphQLOperation("type", "mutation") -> "https://write.example.org";
+
+	// routes the operations by their name
+	users: Path("/graphql") && GraphQLOperation("name", "GetUser", "ListUsers") -> "https://users.example.org";
+*/
+package graphql
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/zalando/skipper/graphql"
+	"github.com/zalando/skipper/predicates"
+	"github.com/zalando/skipper/routing"
+)
+
+const (
+	fieldType = "type"
+	fieldName = "name"
+)
+
+var operationTypes = []string{"query", "mutation", "subscription"}
+
+type spec struct{}
+
+type predicate struct {
+	field  string
+	values []string
+}
+
+// NewOperation creates the GraphQLOperation predicate specification.
+func NewOperation() routing.PredicateSpec { return spec{} }
+
+func (spec) Name() string { return predicates.GraphQLOperationName }
+
+func (spec) Create(args []interface{}) (routing.Predicate, error) {
+	if len(args) < 2 {
+		return nil, predicates.ErrInvalidPredicateParameters
+	}
+
+	field, ok := args[0].(string)
+	if !ok || field != fieldType && field != fieldName {
+		return nil, predicates.ErrInvalidPredicateParameters
+	}
+
+	p := &predicate{field: field}
+	for _, a := range args[1:] {
+		v, ok := a.(string)
+		if !ok || v == "" || field == fieldType && !slices.Contains(operationTypes, v) {
+			return nil, predicates.ErrInvalidPredicateParameters
+		}
+
+		p.values = append(p.values, v)
+	}
+
+	return p, nil
+}
+
+func (p *predicate) Match(r *http.Request) bool {
+	req, err := graphql.ParseRequest(r, graphql.DefaultMaxBodySize)
+	if err != nil {
+		return false
+	}
+
+	v := req.Name()
+	if p.field == fieldType {
+		v = req.OperationType()
+	}
+
+	return slices.Contains(p.values, v)
+}
@@ -0,0 +1,90 @@
+package graphql
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestArgs(t *testing.T) {
+	for _, args := range [][]interface{}{
+		nil,
+		{"type"},
+		{"kind", "query"},
+		{"type", "fragment"},
+		{"name", ""},
+		{"name", 42},
+	} {
+		if _, err := NewOperation().Create(args); err == nil {
+			t.Errorf("expected error for arguments: %v", args)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		args     []interface{}
+		method   string
+		body     string
+		query    string
+		expected bool
+	}{{
+		name:     "mutation type",
+		args:     []interface{}{"type", "mutation"},
+		method:   "POST",
+		body:     `{"query": "mutation AddUser { addUser { id } }"}`,
+		expected: true,
+	}, {
+		name:   "query type not matching",
+		args:   []interface{}{"type", "mutation"},
+		method: "POST",
+		body:   `{"query": "{ user { id } }"}`,
+	}, {
+		name:     "any of the types",
+		args:     []interface{}{"type", "query", "subscription"},
+		method:   "GET",
+		query:    "{ user { id } }",
+		expected: true,
+	}, {
+		name:     "name",
+		args:     []interface{}{"name", "GetUser", "ListUsers"},
+		method:   "POST",
+		body:     `{"query": "query ListUsers { users { id } }"}`,
+		expected: true,
+	}, {
+		name:   "anonymous operation",
+		args:   []interface{}{"name", "GetUser"},
+		method: "POST",
+		body:   `{"query": "{ user { id } }"}`,
+	}, {
+		name:   "invalid query",
+		args:   []interface{}{"type", "query"},
+		method: "POST",
+		body:   `{"query": "{ user "}`,
+	}, {
+		name:   "not a GraphQL request",
+		args:   []interface{}{"type", "query"},
+		method: "GET",
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewOperation().Create(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			target := "/graphql"
+			if tt.query != "" {
+				target += "?query=" + url.QueryEscape(tt.query)
+			}
+
+			r := httptest.NewRequest(tt.method, target, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+
+			if m := p.Match(r); m != tt.expected {
+				t.Errorf("expected match: %v, got: %v", tt.expected, m)
+			}
+		})
+	}
+}
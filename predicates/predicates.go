@@ -48,4 +48,10 @@ const (
 	TrafficSegmentName        = "TrafficSegment"
 	ContentLengthBetweenName  = "ContentLengthBetween"
 	OTelBaggageName           = "OTelBaggage"
+	TLSVersionName            = "TLSVersion"
+	SNIName                   = "SNI"
+	JA4Name                   = "JA4"
+	GeoIPName                 = "GeoIP"
+	GraphQLOperationName      = "GraphQLOperation"
+	CanaryName                = "Canary"
 )
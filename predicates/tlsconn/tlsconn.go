@@ -0,0 +1,155 @@
+/*
+Package tlsconn implements predicates to match the properties of the
+TLS connection of the request.
+
+Examples:
+
+	// matches the legacy TLS clients
+	legacy: TLSVersion("1.0", "1.1") -> "https://legacy.example.org";
+
+	// matches the TLS connections with the SNI
+	api: SNI("api.example.org") -> "https://api.example.org";
+
+	// matches the clients with the JA4 fingerprint
+	bot: JA4("t13d1516h2_8daaf6152771_e5627efa2ab1") -> status(403) -> <shunt>;
+
+The JA4 predicate requires the fingerprints captured during the TLS
+handshake, and matches only the requests received on the TLS listener
+of Skipper.
+*/
+package tlsconn
+
+import (
+	"crypto/tls"
+	"net/http"
+	"slices"
+	"strings"
+
+	snet "github.com/zalando/skipper/net"
+	"github.com/zalando/skipper/predicates"
+	"github.com/zalando/skipper/routing"
+)
+
+type (
+	versionSpec struct{}
+	sniSpec     struct{}
+	ja4Spec     struct{}
+
+	versionPredicate struct {
+		versions []uint16
+	}
+
+	sniPredicate struct {
+		names []string
+	}
+
+	ja4Predicate struct {
+		fingerprints []string
+	}
+)
+
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func stringArgs(args []interface{}) ([]string, error) {
+	if len(args) == 0 {
+		return nil, predicates.ErrInvalidPredicateParameters
+	}
+
+	var s []string
+	for _, a := range args {
+		v, ok := a.(string)
+		if !ok || v == "" {
+			return nil, predicates.ErrInvalidPredicateParameters
+		}
+
+		s = append(s, v)
+	}
+
+	return s, nil
+}
+
+// NewTLSVersion creates the TLSVersion predicate specification. It
+// matches the requests received via TLS, whose negotiated version is
+// one of the arguments, 1.0, 1.1, 1.2 or 1.3.
+func NewTLSVersion() routing.PredicateSpec { return versionSpec{} }
+
+func (versionSpec) Name() string { return predicates.TLSVersionName }
+
+func (versionSpec) Create(args []interface{}) (routing.Predicate, error) {
+	s, err := stringArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &versionPredicate{}
+	for _, v := range s {
+		version, ok := versions[v]
+		if !ok {
+			return nil, predicates.ErrInvalidPredicateParameters
+		}
+
+		p.versions = append(p.versions, version)
+	}
+
+	return p, nil
+}
+
+func (p *versionPredicate) Match(r *http.Request) bool {
+	return r.TLS != nil && slices.Contains(p.versions, r.TLS.Version)
+}
+
+// NewSNI creates the SNI predicate specification. It matches the
+// requests received via TLS, whose server name indication equals one
+// of the arguments, case-insensitively.
+func NewSNI() routing.PredicateSpec { return sniSpec{} }
+
+func (sniSpec) Name() string { return predicates.SNIName }
+
+func (sniSpec) Create(args []interface{}) (routing.Predicate, error) {
+	s, err := stringArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sniPredicate{names: s}, nil
+}
+
+func (p *sniPredicate) Match(r *http.Request) bool {
+	if r.TLS == nil || r.TLS.ServerName == "" {
+		return false
+	}
+
+	for _, n := range p.names {
+		if strings.EqualFold(n, r.TLS.ServerName) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewJA4 creates the JA4 predicate specification. It matches the
+// requests, whose TLS ClientHello has one of the JA4 fingerprints of
+// the arguments.
+func NewJA4() routing.PredicateSpec { return ja4Spec{} }
+
+func (ja4Spec) Name() string { return predicates.JA4Name }
+
+func (ja4Spec) Create(args []interface{}) (routing.Predicate, error) {
+	s, err := stringArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ja4Predicate{fingerprints: s}, nil
+}
+
+func (p *ja4Predicate) Match(r *http.Request) bool {
+	h := snet.TLSClientHello(r)
+	return h != nil && slices.Contains(p.fingerprints, h.JA4())
+}
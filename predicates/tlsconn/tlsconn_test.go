@@ -0,0 +1,134 @@
+package tlsconn
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	snet "github.com/zalando/skipper/net"
+	"github.com/zalando/skipper/routing"
+)
+
+func TestArgs(t *testing.T) {
+	for _, tc := range []struct {
+		spec routing.PredicateSpec
+		args []interface{}
+	}{
+		{spec: NewTLSVersion(), args: []interface{}{}},
+		{spec: NewTLSVersion(), args: []interface{}{1.2}},
+		{spec: NewTLSVersion(), args: []interface{}{"1.4"}},
+		{spec: NewTLSVersion(), args: []interface{}{"1.2", "TLS1.3"}},
+		{spec: NewSNI(), args: []interface{}{}},
+		{spec: NewSNI(), args: []interface{}{""}},
+		{spec: NewSNI(), args: []interface{}{"example.org", 42}},
+		{spec: NewJA4(), args: []interface{}{}},
+		{spec: NewJA4(), args: []interface{}{3.14}},
+	} {
+		if _, err := tc.spec.Create(tc.args); err == nil {
+			t.Errorf("expected error for %s arguments: %v", tc.spec.Name(), tc.args)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		spec  routing.PredicateSpec
+		args  []interface{}
+		state *tls.ConnectionState
+		match bool
+	}{{
+		name:  "version without TLS",
+		spec:  NewTLSVersion(),
+		args:  []interface{}{"1.2", "1.3"},
+		match: false,
+	}, {
+		name:  "version matches",
+		spec:  NewTLSVersion(),
+		args:  []interface{}{"1.2", "1.3"},
+		state: &tls.ConnectionState{Version: tls.VersionTLS13},
+		match: true,
+	}, {
+		name:  "version doesn't match",
+		spec:  NewTLSVersion(),
+		args:  []interface{}{"1.0", "1.1"},
+		state: &tls.ConnectionState{Version: tls.VersionTLS12},
+		match: false,
+	}, {
+		name:  "SNI without TLS",
+		spec:  NewSNI(),
+		args:  []interface{}{"example.org"},
+		match: false,
+	}, {
+		name:  "SNI matches case-insensitively",
+		spec:  NewSNI(),
+		args:  []interface{}{"www.example.org", "API.example.org"},
+		state: &tls.ConnectionState{ServerName: "api.example.org"},
+		match: true,
+	}, {
+		name:  "SNI doesn't match",
+		spec:  NewSNI(),
+		args:  []interface{}{"www.example.org"},
+		state: &tls.ConnectionState{ServerName: "api.example.org"},
+		match: false,
+	}, {
+		name:  "no SNI",
+		spec:  NewSNI(),
+		args:  []interface{}{"www.example.org"},
+		state: &tls.ConnectionState{},
+		match: false,
+	}, {
+		name:  "JA4 without recorded ClientHello",
+		spec:  NewJA4(),
+		args:  []interface{}{"t13d1516h2_8daaf6152771_e5627efa2ab1"},
+		state: &tls.ConnectionState{Version: tls.VersionTLS13},
+		match: false,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := tc.spec.Create(tc.args)
+			require.NoError(t, err)
+
+			r := httptest.NewRequest("GET", "https://www.example.org/", nil)
+			r.TLS = tc.state
+			assert.Equal(t, tc.match, p.Match(r))
+		})
+	}
+}
+
+func TestJA4Match(t *testing.T) {
+	var fingerprint string
+	matches := make(chan bool, 1)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fingerprint = snet.TLSClientHello(r).JA4()
+
+		p, err := NewJA4().Create([]interface{}{"t13d1516h2_8daaf6152771_e5627efa2ab1", fingerprint})
+		if err != nil {
+			t.Error(err)
+		}
+
+		other, err := NewJA4().Create([]interface{}{"t13d1516h2_8daaf6152771_e5627efa2ab1"})
+		if err != nil {
+			t.Error(err)
+		}
+
+		matches <- p.Match(r) && !other.Match(r)
+	}))
+
+	ts.Config.TLSConfig = &tls.Config{}
+	(&snet.ClientHelloRecorder{}).Configure(ts.Config)
+	ts.TLS = ts.Config.TLSConfig
+	ts.StartTLS()
+	defer ts.Close()
+
+	rsp, err := ts.Client().Get(ts.URL)
+	require.NoError(t, err)
+	rsp.Body.Close()
+
+	assert.True(t, <-matches)
+	assert.Regexp(t, "^t13i", fingerprint)
+}
@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zalando/skipper/eskip"
+	al "github.com/zalando/skipper/filters/accesslog"
+	flowidFilter "github.com/zalando/skipper/filters/flowid"
+	"github.com/zalando/skipper/logging"
+	snet "github.com/zalando/skipper/net"
+)
+
+const accessLogEmptyValue = "-"
+
+// accessLogContext resolves the placeholders of the access log template.
+// The request and response placeholders are resolved by eskip.Template,
+// the same way as in the filters, and the access log specific ones as
+// path parameters.
+type accessLogContext struct {
+	ctx          *context
+	accessLogger *logging.AccessLogger
+	entry        *logging.AccessEntry
+	response     *http.Response
+
+	// the fields of the access log referenced by the template
+	usedFields map[string]bool
+}
+
+// accessLogLine renders the access log template. The fields of the access
+// log added by the filters, and not referenced by the template, are
+// appended as key=value pairs. Empty values are rendered as "-".
+func accessLogLine(t *eskip.Template, accessLogger *logging.AccessLogger, ctx *context, entry *logging.AccessEntry, responseHeader http.Header, additional map[string]any) string {
+	lc := &accessLogContext{
+		ctx:          ctx,
+		accessLogger: accessLogger,
+		entry:        entry,
+		response:     &http.Response{StatusCode: entry.StatusCode, Header: responseHeader},
+		usedFields:   make(map[string]bool),
+	}
+
+	get := eskip.ContextGetter(lc)
+	line := t.Apply(func(key string) string {
+		var v string
+		if key == "request.rawQuery" {
+			// the query is stripped or masked like in the default format
+			_, v, _ = strings.Cut(lc.requestURI(), "?")
+		} else {
+			v = get(key)
+		}
+
+		if v != "" {
+			return v
+		}
+		return accessLogEmptyValue
+	})
+
+	var keys []string
+	for k, v := range additional {
+		if k != al.KeyMaskedQueryParams && v != nil && !lc.usedFields[k] {
+			keys = append(keys, k)
+		}
+	}
+
+	slices.Sort(keys)
+	for _, k := range keys {
+		v := fmt.Sprint(additional[k])
+		if strings.ContainsAny(v, " \"=") {
+			v = strconv.Quote(v)
+		}
+
+		line += " " + k + "=" + v
+	}
+
+	return line
+}
+
+func (lc *accessLogContext) Request() *http.Request   { return lc.entry.Request }
+func (lc *accessLogContext) Response() *http.Response { return lc.response }
+
+// requestURI returns the request URI with the query stripped or masked
+// like in the default format.
+func (lc *accessLogContext) requestURI() string {
+	additionalData, _ := lc.ctx.stateBag[al.AccessLogAdditionalDataKey].(map[string]interface{})
+	return lc.accessLogger.RequestURI(lc.entry.Request, additionalData)
+}
+
+// PathParam resolves the placeholders not known by eskip.Template.
+func (lc *accessLogContext) PathParam(key string) string {
+	ctx, r := lc.ctx, lc.entry.Request
+
+	if k, ok := strings.CutPrefix(key, "state."); ok {
+		if v, ok := ctx.stateBag[k]; ok && v != nil {
+			return fmt.Sprint(v)
+		}
+		return ""
+	}
+	if k, ok := strings.CutPrefix(key, "accessLog."); ok {
+		lc.usedFields[k] = true
+		additionalData, _ := ctx.stateBag[al.AccessLogAdditionalDataKey].(map[string]interface{})
+		if v, ok := additionalData[k]; ok && v != nil {
+			return fmt.Sprint(v)
+		}
+		return ""
+	}
+
+	switch key {
+	case "request.uri":
+		return lc.requestURI()
+	case "request.proto":
+		return r.Proto
+	case "response.status":
+		return strconv.Itoa(lc.entry.StatusCode)
+	case "response.size":
+		return strconv.FormatInt(lc.entry.ResponseSize, 10)
+	case "route.id":
+		if ctx.route != nil {
+			return ctx.route.Id
+		}
+	case "backend.address":
+		return ctx.backendAddr
+	case "backend.duration":
+		if ctx.backendAddr != "" {
+			return strconv.FormatInt(ctx.backendDuration.Milliseconds(), 10)
+		}
+	case "duration":
+		return strconv.FormatInt(lc.entry.Duration.Milliseconds(), 10)
+	case "timestamp":
+		return lc.entry.RequestTime.Format(time.RFC3339Nano)
+	case "flowId":
+		return r.Header.Get(flowidFilter.HeaderName)
+	case "authUser":
+		return lc.entry.AuthUser
+	case "tls.version":
+		if r.TLS != nil {
+			return tls.VersionName(r.TLS.Version)
+		}
+	case "tls.cipher":
+		if r.TLS != nil {
+			return tls.CipherSuiteName(r.TLS.CipherSuite)
+		}
+	case "tls.serverName":
+		if r.TLS != nil {
+			return r.TLS.ServerName
+		}
+	case "tls.alpn":
+		if r.TLS != nil {
+			return r.TLS.NegotiatedProtocol
+		}
+	case "tls.ja3":
+		if h := snet.TLSClientHello(r); h != nil {
+			return h.JA3()
+		}
+	case "tls.ja4":
+		if h := snet.TLSClientHello(r); h != nil {
+			return h.JA4()
+		}
+	default:
+		return ctx.PathParam(key)
+	}
+
+	return ""
+}
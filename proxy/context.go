@@ -12,9 +12,9 @@ import (
 	"github.com/opentracing/opentracing-go"
 	"github.com/zalando/skipper/filters"
 	"github.com/zalando/skipper/metrics"
+	snet "github.com/zalando/skipper/net"
 	hostPred "github.com/zalando/skipper/predicates/host"
 	"github.com/zalando/skipper/routing"
-	"github.com/zalando/skipper/tracing"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -45,8 +45,10 @@ type context struct {
 	startServe           time.Time
 	clientTraceTime      time.Time
 	metrics              *filterMetrics
+	requestMetrics       metrics.Metrics
 	tracer               opentracing.Tracer
 	initialSpan          opentracing.Span
+	traceID              string
 	proxySpan            opentracing.Span
 	parentSpan           opentracing.Span
 	proxy                *Proxy
@@ -55,6 +57,8 @@ type context struct {
 	logger               filters.FilterContextLogger
 	proxyRequestElapsed  time.Duration
 	proxyResponseElapsed time.Duration
+	backendAddr          string
+	backendDuration      time.Duration
 }
 
 type filterMetrics struct {
@@ -155,6 +159,10 @@ func newContext(
 		c.originalRequest = cloneRequestMetadata(r)
 	}
 
+	if h := snet.TLSClientHello(r); h != nil {
+		c.stateBag[snet.ClientHelloStateBagKey] = h
+	}
+
 	return c
 }
 
@@ -221,9 +229,8 @@ func (c *context) ParentSpan() opentracing.Span        { return c.parentSpan }
 
 func (c *context) Logger() filters.FilterContextLogger {
 	if c.logger == nil {
-		traceID := tracing.GetTraceID(c.initialSpan)
-		if traceID != "" {
-			c.logger = log.WithFields(log.Fields{"trace_id": traceID})
+		if c.traceID != "" {
+			c.logger = log.WithFields(log.Fields{"trace_id": c.traceID})
 		} else {
 			c.logger = log.StandardLogger()
 		}
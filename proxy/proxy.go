@@ -20,6 +20,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unicode/utf8"
 
@@ -45,6 +46,7 @@ import (
 	"github.com/zalando/skipper/ratelimit"
 	"github.com/zalando/skipper/rfc"
 	"github.com/zalando/skipper/routing"
+	"github.com/zalando/skipper/tap"
 	"github.com/zalando/skipper/tracing"
 	otBridge "go.opentelemetry.io/otel/bridge/opentracing"
 	"go.opentelemetry.io/otel/propagation"
@@ -110,6 +112,12 @@ const (
 	// if the reserved characters according to RFC 2616 and RFC 3986
 	// were unescaped by the parser.
 	PatchPath
+
+	// ForwardProxy enables the forward proxy mode. In this mode
+	// CONNECT requests matching routes with a dynamic backend are
+	// tunnelled to the requested destination, and the proxy
+	// specific headers are removed from the outgoing requests.
+	ForwardProxy
 )
 
 // Options are deprecated alias for Flags.
@@ -273,6 +281,11 @@ type Params struct {
 	// If not specified proxy uses global metrics.Default.
 	Metrics metrics.Metrics
 
+	// EnablePrometheusExemplars attaches the trace ID of the request as
+	// exemplar to the latency metrics, when Metrics implement
+	// metrics.ExemplarMetrics.
+	EnablePrometheusExemplars bool
+
 	// PriorityRoutes is an optional list of priority routes to be
 	// used for matching before the general lookup tree.
 	PriorityRoutes []PriorityRoute
@@ -291,6 +304,15 @@ type Params struct {
 	// AccessLogger if set the proxy will be able write access logs
 	AccessLogger *logging.AccessLogger
 
+	// Tap, when set, receives the proxied requests and responses for
+	// the active traffic tap sessions.
+	Tap *tap.Tap
+
+	// AccessLogTemplate, when set, is used to render the access log
+	// lines instead of the format of the AccessLogger. See the
+	// access log documentation for the available placeholders.
+	AccessLogTemplate *eskip.Template
+
 	// EnableCopyStreamPoolExperimental if set to true the Proxy will use a
 	// sync.Pool to reduce memory garbage in copy stream.
 	EnableCopyStreamPoolExperimental bool
@@ -340,6 +362,11 @@ type Params struct {
 	// FlushInterval for copying upgraded connections
 	FlushInterval time.Duration
 
+	// TunnelIdleTimeout closes the CONNECT tunnels of the forward
+	// proxy mode, when no data was copied in either direction for
+	// this duration. When 0, the tunnels are not closed when idle.
+	TunnelIdleTimeout time.Duration
+
 	// Timeout sets the TCP client connection timeout for proxy http connections to the backend
 	Timeout time.Duration
 
@@ -416,6 +443,7 @@ const (
 
 var (
 	errRouteLookupFailed  = &proxyError{err: errRouteLookup}
+	errNoLBEndpoints      = errors.New("no load balancer endpoints available")
 	errCircuitBreakerOpen = &proxyError{
 		err:              errors.New("circuit breaker open"),
 		code:             http.StatusServiceUnavailable,
@@ -456,6 +484,9 @@ func (f Flags) HopHeadersRemoval() bool { return f&HopHeadersRemoval != 0 }
 
 func (f Flags) patchPath() bool { return f&PatchPath != 0 }
 
+// When set, the proxy runs in forward proxy mode.
+func (f Flags) ForwardProxy() bool { return f&ForwardProxy != 0 }
+
 // PriorityRoute are custom route implementations that are matched against
 // each request before the routes in the general lookup tree.
 type PriorityRoute interface {
@@ -470,7 +501,7 @@ type PriorityRoute interface {
 type Proxy struct {
 	experimentalUpgrade      bool
 	experimentalUpgradeAudit bool
-	accessLogDisabled        bool
+	accessLogDisabled        atomic.Bool
 	copyStreamPoolEnabled    bool
 	maxLoops                 int
 	defaultHTTPStatus        int
@@ -482,12 +513,15 @@ type Proxy struct {
 	priorityRoutes           []PriorityRoute
 	flags                    Flags
 	metrics                  metrics.Metrics
+	exemplarMetrics          metrics.ExemplarMetrics
 	quit                     chan struct{}
 	flushInterval            time.Duration
 	breakers                 *circuit.Registry
 	limiters                 *ratelimit.Registry
 	log                      logging.Logger
 	accessLogger             *logging.AccessLogger
+	accessLogTemplate        *eskip.Template
+	tap                      *tap.Tap
 	tracing                  *proxyTracing
 	upgradeAuditLogOut       io.Writer
 	upgradeAuditLogErr       io.Writer
@@ -496,6 +530,9 @@ type Proxy struct {
 	hostname                 string
 	onPanicSometimes         rate.Sometimes
 	cr                       *snet.CertReloader
+	dialContext              func(stdlibcontext.Context, string, string) (net.Conn, error)
+	tunnels                  atomic.Int64
+	tunnelIdleTimeout        time.Duration
 }
 
 // proxyError is used to wrap errors during proxying and to indicate
@@ -639,6 +676,12 @@ func setRequestURLForDynamicBackend(u *url.URL, stateBag map[string]interface{})
 
 func (p *Proxy) selectEndpoint(ctx *context) *routing.LBEndpoint {
 	rt := ctx.route
+	if rt.LBEndpointSource != nil {
+		if rt = rt.LBEndpointSource.Route(); rt == nil {
+			return nil
+		}
+	}
+
 	endpoints := rt.LBEndpoints
 	endpoints = p.fadein.filterFadeIn(endpoints, rt)
 	endpoints = p.healthyEndpoints.filterHealthyEndpoints(ctx, endpoints, p.metrics)
@@ -655,6 +698,20 @@ func (p *Proxy) selectEndpoint(ctx *context) *routing.LBEndpoint {
 	return &e
 }
 
+// requestMetrics returns the metrics measuring the latencies of the
+// request, attaching its trace ID as exemplar when enabled.
+func (p *Proxy) requestMetrics(ctx *context) metrics.Metrics {
+	if p.exemplarMetrics == nil {
+		return p.metrics
+	}
+
+	if ctx.requestMetrics == nil {
+		ctx.requestMetrics = p.exemplarMetrics.WithTraceID(ctx.traceID)
+	}
+
+	return ctx.requestMetrics
+}
+
 // creates an outgoing http request to be forwarded to the route endpoint
 // based on the augmented incoming request
 func (p *Proxy) mapRequest(ctx *context, requestContext stdlibcontext.Context) (*http.Request, routing.Metrics, error) {
@@ -671,6 +728,10 @@ func (p *Proxy) mapRequest(ctx *context, requestContext stdlibcontext.Context) (
 		setRequestURLForDynamicBackend(u, stateBag)
 	case eskip.LBBackend:
 		endpoint := p.selectEndpoint(ctx)
+		if endpoint == nil {
+			return nil, nil, errNoLBEndpoints
+		}
+
 		endpointMetrics = endpoint.Metrics
 		u.Scheme = endpoint.Scheme
 		u.Host = endpoint.Host
@@ -704,6 +765,11 @@ func (p *Proxy) mapRequest(ctx *context, requestContext stdlibcontext.Context) (
 	}
 	rr.Host = host
 
+	if p.flags.ForwardProxy() {
+		rr.Header.Del("Proxy-Authorization")
+		rr.Header.Del("Proxy-Connection")
+	}
+
 	// If there is basic auth configured in the URL we add them as headers
 	if u.User != nil {
 		up := u.User.String()
@@ -893,6 +959,11 @@ func WithParams(p Params) *Proxy {
 		m = metrics.Void
 	}
 
+	var em metrics.ExemplarMetrics
+	if p.EnablePrometheusExemplars {
+		em, _ = m.(metrics.ExemplarMetrics)
+	}
+
 	if p.MaxLoopbacks == 0 {
 		p.MaxLoopbacks = DefaultMaxLoopbacks
 	} else if p.MaxLoopbacks < 0 {
@@ -918,7 +989,7 @@ func WithParams(p Params) *Proxy {
 			maxUnhealthyEndpointsRatio: p.PassiveHealthCheck.MaxUnhealthyEndpointsRatio,
 		}
 	}
-	return &Proxy{
+	proxy := &Proxy{
 		routing:  p.Routing,
 		registry: p.EndpointRegistry,
 		fadein: &fadeIn{
@@ -929,8 +1000,10 @@ func WithParams(p Params) *Proxy {
 		priorityRoutes:           p.PriorityRoutes,
 		flags:                    p.Flags,
 		metrics:                  m,
+		exemplarMetrics:          em,
 		quit:                     quit,
 		flushInterval:            p.FlushInterval,
+		tunnelIdleTimeout:        p.TunnelIdleTimeout,
 		experimentalUpgrade:      p.ExperimentalUpgrade,
 		experimentalUpgradeAudit: p.ExperimentalUpgradeAudit,
 		maxLoops:                 p.MaxLoopbacks,
@@ -938,17 +1011,22 @@ func WithParams(p Params) *Proxy {
 		limiters:                 p.RateLimiters,
 		log:                      log,
 		accessLogger:             p.AccessLogger,
+		accessLogTemplate:        p.AccessLogTemplate,
+		tap:                      p.Tap,
 		defaultHTTPStatus:        defaultHTTPStatus,
 		tracing:                  newProxyTracing(p.OpenTracing),
 		copyStreamPoolEnabled:    p.EnableCopyStreamPoolExperimental,
-		accessLogDisabled:        p.AccessLogDisabled,
 		upgradeAuditLogOut:       os.Stdout,
 		upgradeAuditLogErr:       os.Stderr,
 		clientTLS:                tr.TLSClientConfig,
 		hostname:                 hostname,
 		onPanicSometimes:         rate.Sometimes{First: 3, Interval: 1 * time.Minute},
 		cr:                       cr,
+		dialContext:              tr.DialContext,
 	}
+	proxy.accessLogDisabled.Store(p.AccessLogDisabled)
+
+	return proxy
 }
 
 // applies filters to a request
@@ -1065,7 +1143,9 @@ func (p *Proxy) makeBackendRequest(ctx *context, requestContext stdlibcontext.Co
 	payloadProtocol := getUpgradeRequest(ctx.Request())
 
 	req, endpointMetrics, err := p.mapRequest(ctx, requestContext)
-	if err != nil {
+	if err == errNoLBEndpoints {
+		return nil, &proxyError{err: err, code: http.StatusServiceUnavailable}
+	} else if err != nil {
 		return nil, &proxyError{err: fmt.Errorf("could not map backend request: %w", err)}
 	}
 
@@ -1114,6 +1194,7 @@ func (p *Proxy) makeBackendRequest(ctx *context, requestContext stdlibcontext.Co
 		setTag(ctx.proxySpan, SkipperRouteIDTag, ctx.route.Id).
 		setTag(ctx.proxySpan, NetworkPeerAddressTag, u.Host)
 	p.setCommonSpanInfo(u, req, ctx.proxySpan)
+	ctx.backendAddr = u.Host
 
 	carrier := ot.HTTPHeadersCarrier(req.Header)
 	_ = p.tracing.tracer.Inject(ctx.proxySpan.Context(), ot.HTTPHeaders, carrier)
@@ -1138,7 +1219,13 @@ func (p *Proxy) makeBackendRequest(ctx *context, requestContext stdlibcontext.Co
 	responseStopWatch.Start()
 
 	if endpointMetrics != nil {
-		endpointMetrics.IncRequests(routing.IncRequestsOptions{FailedRoundTrip: err != nil})
+		o := routing.IncRequestsOptions{FailedRoundTrip: err != nil, Duration: time.Since(httpRoundtripTime)}
+		if err == nil {
+			o.StatusCode = response.StatusCode
+		}
+
+		endpointMetrics.IncRequests(o)
+		p.registry.IncRouteResponses(ctx.route.Id, o)
 	}
 	if p.tracing.clientTraceByTag {
 		ctx.proxySpan.SetTag(ClientTraceHTTPRoundTrip, time.Since(httpRoundtripTime).Microseconds())
@@ -1414,6 +1501,15 @@ func (p *Proxy) do(ctx *context, parentSpan ot.Span) (err error) {
 
 		ctx.setResponse(loopCTX.response, p.flags.PreserveOriginal())
 		ctx.proxySpan = loopCTX.proxySpan
+	} else if p.flags.ForwardProxy() && isTunnelRequest(ctx.request) && ctx.route.BackendType == eskip.DynamicBackend {
+		requestStopWatch.Stop()
+		perr := p.makeTunnel(ctx)
+		responseStopWatch.Start()
+		if !perr.handled {
+			p.makeErrorResponse(ctx, perr)
+			p.applyFiltersOnError(ctx, processedFilters)
+		}
+		return perr
 	} else if p.flags.Debug() {
 		requestStopWatch.Stop()
 		debugReq, _, err := p.mapRequest(ctx, ctx.request.Context())
@@ -1512,8 +1608,10 @@ func (p *Proxy) do(ctx *context, parentSpan ot.Span) (err error) {
 		}
 
 		ctx.setResponse(rsp, p.flags.PreserveOriginal())
-		p.metrics.MeasureBackend(ctx.route.Id, backendStart)
-		p.metrics.MeasureBackendHost(ctx.route.Host, backendStart)
+		rm := p.requestMetrics(ctx)
+		rm.MeasureBackend(ctx.route.Id, backendStart)
+		rm.MeasureBackendHost(ctx.route.Host, backendStart)
+		ctx.backendDuration = time.Since(backendStart)
 	}
 
 	addBranding(ctx.response.Header)
@@ -1596,10 +1694,10 @@ func (p *Proxy) serveResponse(ctx *context) {
 		p.tracing.setTag(ctx.proxySpan, StreamBodyEvent, StreamBodyError)
 		p.tracing.logStreamEvent(ctx.proxySpan, StreamBodyEvent, fmt.Sprintf("Failed to stream response: %v", err))
 	} else {
-		p.metrics.MeasureResponse(ctx.response.StatusCode, ctx.request.Method, ctx.route.Id, start)
+		p.requestMetrics(ctx).MeasureResponse(ctx.response.StatusCode, ctx.request.Method, ctx.route.Id, start)
 		p.metrics.MeasureResponseSize(ctx.metricsHost(), n)
 	}
-	p.metrics.MeasureServe(ctx.route.Id, ctx.metricsHost(), ctx.request.Method, ctx.response.StatusCode, ctx.startServe)
+	p.requestMetrics(ctx).MeasureServe(ctx.route.Id, ctx.metricsHost(), ctx.request.Method, ctx.response.StatusCode, ctx.startServe)
 }
 
 func (p *Proxy) errorResponse(ctx *context, err error) {
@@ -1657,7 +1755,7 @@ func (p *Proxy) errorResponse(ctx *context, err error) {
 	if ctx.response.StatusCode == 499 {
 		msgPrefix = "client canceled"
 		logFunc = ctx.Logger().Infof
-		if p.accessLogDisabled {
+		if p.accessLogDisabled.Load() {
 			logFunc = ctx.Logger().Debugf
 		}
 	}
@@ -1695,7 +1793,7 @@ func (p *Proxy) errorResponse(ctx *context, err error) {
 	_, _ = copyStream(ctx.responseWriter, ctx.response.Body)
 	responseStopWatch.Start()
 
-	p.metrics.MeasureServe(
+	p.requestMetrics(ctx).MeasureServe(
 		id,
 		ctx.metricsHost(),
 		ctx.request.Method,
@@ -1733,21 +1831,38 @@ func shouldLog(statusCode int, filter *al.AccessLogFilter) bool {
 	if len(filter.Prefixes) == 0 {
 		return filter.Enable
 	}
-	match := false
-	for _, prefix := range filter.Prefixes {
+	return matchStatusPrefix(statusCode, filter.Prefixes) == filter.Enable
+}
+
+func matchStatusPrefix(statusCode int, prefixes []int) bool {
+	for _, prefix := range prefixes {
 		switch {
 		case prefix < 10:
-			match = (statusCode >= prefix*100 && statusCode < (prefix+1)*100)
+			if statusCode >= prefix*100 && statusCode < (prefix+1)*100 {
+				return true
+			}
 		case prefix < 100:
-			match = (statusCode >= prefix*10 && statusCode < (prefix+1)*10)
+			if statusCode >= prefix*10 && statusCode < (prefix+1)*10 {
+				return true
+			}
 		default:
-			match = statusCode == prefix
+			if statusCode == prefix {
+				return true
+			}
 		}
-		if match {
-			break
+	}
+	return false
+}
+
+// sampleAccessLog applies the first sampling rule matching the status
+// code. Responses without a matching rule are always logged.
+func sampleAccessLog(statusCode int, samples []*al.AccessLogSample) bool {
+	for _, s := range samples {
+		if len(s.Prefixes) == 0 || matchStatusPrefix(statusCode, s.Prefixes) {
+			return rand.Float64() < s.Rate // #nosec
 		}
 	}
-	return match == filter.Enable
+	return true
 }
 
 // ServeHTTP is the proxy http.Handler implementation
@@ -1757,6 +1872,11 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	requestStopWatch, responseStopWatch := newStopWatch(), newStopWatch()
 	requestStopWatch.Start()
 
+	var tapExchange *tap.Exchange
+	if p.tap != nil {
+		tapExchange, w = p.tap.Start(w, r)
+	}
+
 	lw := logging.NewLoggingWriter(w)
 
 	p.metrics.IncCounter("incoming." + r.Proto)
@@ -1784,7 +1904,7 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	defer func() {
 		accessLogEnabled, ok := ctx.stateBag[al.AccessLogEnabledKey].(*al.AccessLogFilter)
 		if !ok {
-			if p.accessLogDisabled {
+			if p.accessLogDisabled.Load() {
 				accessLogEnabled = &disabledAccessLog
 			} else {
 				accessLogEnabled = &enabledAccessLog
@@ -1793,7 +1913,8 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 		statusCode := lw.GetCode()
 
-		if shouldLog(statusCode, accessLogEnabled) {
+		samples, _ := ctx.stateBag[al.AccessLogSampleKey].([]*al.AccessLogSample)
+		if shouldLog(statusCode, accessLogEnabled) && sampleAccessLog(statusCode, samples) {
 			authUser, _ := ctx.stateBag[filterslog.AuthUserKey].(string)
 			entry := &logging.AccessEntry{
 				Request:      r,
@@ -1805,11 +1926,27 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			}
 
 			additionalData, _ := ctx.stateBag[al.AccessLogAdditionalDataKey].(map[string]interface{})
-			if p.accessLogger != nil {
+			if p.accessLogger != nil && p.accessLogTemplate != nil {
+				p.accessLogger.LogAccessLine(r, accessLogLine(p.accessLogTemplate, p.accessLogger, ctx, entry, lw.Header(), additionalData))
+			} else if p.accessLogger != nil {
 				p.accessLogger.LogAccess(entry, additionalData)
 			}
 		}
 
+		if tapExchange != nil {
+			info := tap.Info{
+				Endpoint:        ctx.backendAddr,
+				StatusCode:      statusCode,
+				ResponseSize:    lw.GetBytes(),
+				ResponseHeader:  lw.Header(),
+				BackendDuration: ctx.backendDuration,
+			}
+			if ctx.route != nil {
+				info.RouteID = ctx.route.Id
+			}
+			tapExchange.Finish(info)
+		}
+
 		// This flush is required in I/O error
 		if !ctx.successfulUpgrade {
 			lw.Flush()
@@ -1834,12 +1971,13 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctxWithSpan = propagation.Baggage{}.Extract(ctxWithSpan, propagation.HeaderCarrier(r.Header))
 
 	rCtx := routing.NewContext(ctxWithSpan)
+	traceID := tracing.GetTraceID(span)
 
 	defer pprof.SetGoroutineLabels(rCtx)
 
 	tCtx := pprof.WithLabels(rCtx,
 		pprof.Labels(
-			"trace_id", tracing.GetTraceID(span),
+			"trace_id", traceID,
 			"http.path", r.URL.Path,
 			"http.method", r.Method,
 			"http.host", r.Host,
@@ -1852,6 +1990,7 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx.tracer = p.tracing.tracer
 	ctx.initialSpan = span
 	ctx.parentSpan = span
+	ctx.traceID = traceID
 
 	defer func() {
 		if ctx.response != nil && ctx.response.Body != nil {
@@ -1902,6 +2041,13 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// SetAccessLogDisabled changes the default of the access log, that
+// the routes can override with filters. It allows changing the setting
+// without restarting the proxy.
+func (p *Proxy) SetAccessLogDisabled(disabled bool) {
+	p.accessLogDisabled.Store(disabled)
+}
+
 // Close causes the proxy to stop closing idle
 // connections and, currently, has no other effect.
 // It's primary purpose is to support testing.
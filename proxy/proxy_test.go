@@ -29,11 +29,13 @@ import (
 
 	"github.com/zalando/skipper/eskip"
 	"github.com/zalando/skipper/filters"
+	al "github.com/zalando/skipper/filters/accesslog"
 	"github.com/zalando/skipper/filters/builtin"
 	fscheduler "github.com/zalando/skipper/filters/scheduler"
 	"github.com/zalando/skipper/loadbalancer"
 	"github.com/zalando/skipper/logging"
 	"github.com/zalando/skipper/logging/loggingtest"
+	"github.com/zalando/skipper/metrics"
 	"github.com/zalando/skipper/metrics/metricstest"
 	"github.com/zalando/skipper/routing"
 	"github.com/zalando/skipper/routing/testdataclient"
@@ -2160,6 +2162,184 @@ func TestAccessLogOnFailedRequest(t *testing.T) {
 	}
 }
 
+func TestAccessLogTemplate(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend", "b1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}))
+	defer backend.Close()
+
+	var buf bytes.Buffer
+	al := logging.NewAccessLogger(logging.Options{AccessLogOutput: &buf})
+
+	doc := fmt.Sprintf(`hello: Path("/hello") -> setPath("/") -> "%s"`, backend.URL)
+	tp, err := newTestProxyWithParams(doc, Params{
+		AccessLogger:      al,
+		AccessLogTemplate: eskip.NewTemplate(`${request.method} ${request.uri} ${request.header.X-Foo} ${response.status} ${response.size} ${response.header.X-Backend} ${route.id} ${backend.address} ${state.missing} ${accessLog.missing} ${tls.version}`),
+	})
+	require.NoError(t, err)
+	defer tp.close()
+
+	r := httptest.NewRequest("GET", "/hello?q=1", nil)
+	r.Header.Set("X-Foo", "foo")
+	tp.proxy.ServeHTTP(httptest.NewRecorder(), r)
+
+	backendURL, err := url.Parse(backend.URL)
+	require.NoError(t, err)
+
+	assert.Equal(t, fmt.Sprintf("GET /hello?q=1 foo 201 5 b1 hello %s - - -\n", backendURL.Host), buf.String())
+}
+
+func TestAccessLogTemplateAdditionalData(t *testing.T) {
+	additional := map[string]any{
+		"geoip-country":         "DE",
+		"waf-action":            "block request",
+		"empty":                 nil,
+		al.KeyMaskedQueryParams: map[string]struct{}{"q": {}},
+	}
+
+	ctx := &context{
+		stateBag:   map[string]any{al.AccessLogAdditionalDataKey: additional},
+		pathParams: map[string]string{"name": "foo"},
+	}
+
+	entry := &logging.AccessEntry{
+		Request:    httptest.NewRequest("GET", "/hello/foo?q=1", nil),
+		StatusCode: http.StatusOK,
+	}
+
+	line := accessLogLine(
+		eskip.NewTemplate(`${request.method} ${request.path} ${name} ${response.status} ${accessLog.geoip-country}`),
+		logging.NewAccessLogger(logging.Options{}),
+		ctx,
+		entry,
+		http.Header{},
+		additional,
+	)
+
+	assert.Equal(t, `GET /hello/foo foo 200 DE waf-action="block request"`, line)
+}
+
+func TestAccessLogTemplateQuery(t *testing.T) {
+	template := eskip.NewTemplate(`${request.uri} ${request.rawQuery}`)
+	newContext := func(masked ...string) *context {
+		additional := make(map[string]any)
+		if len(masked) > 0 {
+			m := make(map[string]struct{})
+			for _, k := range masked {
+				m[k] = struct{}{}
+			}
+
+			additional[al.KeyMaskedQueryParams] = m
+		}
+
+		return &context{stateBag: map[string]any{al.AccessLogAdditionalDataKey: additional}}
+	}
+
+	entry := &logging.AccessEntry{Request: httptest.NewRequest("GET", "/hello?token=secret&page=2", nil)}
+	render := func(o logging.Options, ctx *context) string {
+		additional, _ := ctx.stateBag[al.AccessLogAdditionalDataKey].(map[string]any)
+		return accessLogLine(template, logging.NewAccessLogger(o), ctx, entry, http.Header{}, additional)
+	}
+
+	t.Run("unchanged", func(t *testing.T) {
+		assert.Equal(t, "/hello?token=secret&page=2 token=secret&page=2", render(logging.Options{}, newContext()))
+	})
+
+	t.Run("strip query", func(t *testing.T) {
+		assert.Equal(t, "/hello -", render(logging.Options{AccessLogStripQuery: true}, newContext("token")))
+	})
+
+	t.Run("masked query params", func(t *testing.T) {
+		line := render(logging.Options{}, newContext("token"))
+		assert.NotContains(t, line, "secret")
+
+		uri, query, _ := strings.Cut(line, " ")
+		assert.Equal(t, "/hello?"+query, uri)
+
+		params, err := url.ParseQuery(query)
+		require.NoError(t, err)
+		assert.Equal(t, "2", params.Get("page"))
+		assert.NotEmpty(t, params.Get("token"))
+	})
+}
+
+func TestSampleAccessLogWithFilter(t *testing.T) {
+	for _, ti := range []struct {
+		msg          string
+		filter       string
+		responseCode int
+		shouldLog    bool
+	}{
+		{
+			msg:          "sample none",
+			filter:       "sampleAccessLog(0)",
+			responseCode: 200,
+			shouldLog:    false,
+		},
+		{
+			msg:          "sample all",
+			filter:       "sampleAccessLog(1)",
+			responseCode: 200,
+			shouldLog:    true,
+		},
+		{
+			msg:          "sample none of matching",
+			filter:       "sampleAccessLog(0, 2)",
+			responseCode: 201,
+			shouldLog:    false,
+		},
+		{
+			msg:          "not matching are logged",
+			filter:       "sampleAccessLog(0, 2)",
+			responseCode: 500,
+			shouldLog:    true,
+		},
+		{
+			msg:          "first matching rule applies",
+			filter:       "sampleAccessLog(1, 5) -> sampleAccessLog(0)",
+			responseCode: 503,
+			shouldLog:    true,
+		},
+		{
+			msg:          "fallback rule applies",
+			filter:       "sampleAccessLog(1, 5) -> sampleAccessLog(0)",
+			responseCode: 200,
+			shouldLog:    false,
+		},
+		{
+			msg:          "disabled access log is not sampled",
+			filter:       "disableAccessLog() -> sampleAccessLog(1)",
+			responseCode: 200,
+			shouldLog:    false,
+		},
+	} {
+		t.Run(ti.msg, func(t *testing.T) {
+			var buf bytes.Buffer
+			al := logging.NewAccessLogger(logging.Options{
+				AccessLogOutput: &buf})
+
+			doc := fmt.Sprintf(`hello: Path("/hello") -> %s -> status(%d) -> <shunt>`, ti.filter, ti.responseCode)
+
+			tp, err := newTestProxyWithParams(doc, Params{
+				AccessLogger: al,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tp.close()
+
+			r := httptest.NewRequest("GET", "https://www.example.org/hello", nil)
+			tp.proxy.ServeHTTP(httptest.NewRecorder(), r)
+
+			if ti.shouldLog != (buf.Len() != 0) {
+				t.Errorf("failed to sample access log, expected logged: %v, got: %q", ti.shouldLog, buf.String())
+			}
+		})
+	}
+}
+
 func TestHopHeaderRemovalDisabled(t *testing.T) {
 	payload := []byte("Hello World!")
 
@@ -2324,6 +2504,47 @@ func TestProxyFromEmptyContext(t *testing.T) {
 	assert.Nil(t, proxyURL)
 }
 
+type exemplarMetrics struct {
+	*metricstest.MockMetrics
+	calls atomic.Int64
+}
+
+func (m *exemplarMetrics) WithTraceID(string) metrics.Metrics {
+	m.calls.Add(1)
+	return m
+}
+
+func TestPrometheusExemplars(t *testing.T) {
+	for _, tt := range []struct {
+		title   string
+		enabled bool
+		calls   int64
+	}{{
+		title: "disabled",
+	}, {
+		title:   "enabled",
+		enabled: true,
+		calls:   1,
+	}} {
+		t.Run(tt.title, func(t *testing.T) {
+			m := &exemplarMetrics{MockMetrics: &metricstest.MockMetrics{}}
+			tp, err := newTestProxyWithParams(`* -> status(204) -> <shunt>`, Params{
+				Metrics:                   m,
+				EnablePrometheusExemplars: tt.enabled,
+			})
+			require.NoError(t, err)
+			defer tp.close()
+
+			w := httptest.NewRecorder()
+			tp.proxy.ServeHTTP(w, httptest.NewRequest("GET", "https://www.example.org/", nil))
+			require.Equal(t, http.StatusNoContent, w.Code)
+
+			// the metrics with the trace ID are created once per request
+			assert.Equal(t, tt.calls, m.calls.Load())
+		})
+	}
+}
+
 func BenchmarkAccessLogNoFilter(b *testing.B) { benchmarkAccessLog(b, "", 200) }
 func BenchmarkAccessLogDisablePrint(b *testing.B) {
 	benchmarkAccessLog(b, "disableAccessLog(1,3)", 200)
@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultTunnelPort = "443"
+
+	tunnelEstablishedKey   = "tunnel.established"
+	tunnelErrorsKey        = "tunnel.errors"
+	tunnelActiveKey        = "tunnel.active"
+	tunnelDurationKey      = "tunnel.duration"
+	tunnelBytesSentKey     = "tunnel.bytes.sent"
+	tunnelBytesReceivedKey = "tunnel.bytes.received"
+)
+
+var errTunnelHijack = &proxyError{
+	err:  errors.New("CONNECT tunnels are only supported over HTTP/1.x"),
+	code: http.StatusHTTPVersionNotSupported,
+}
+
+// countingWriter counts the bytes written to the wrapped writer, and
+// resets the idle timer of the tunnel, when set.
+type countingWriter struct {
+	w           io.Writer
+	n           atomic.Int64
+	idle        *time.Timer
+	idleTimeout time.Duration
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n.Add(int64(n))
+	if cw.idle != nil {
+		cw.idle.Reset(cw.idleTimeout)
+	}
+	return n, err
+}
+
+func isTunnelRequest(r *http.Request) bool {
+	return r.Method == http.MethodConnect
+}
+
+// tunnelAddress returns the destination of a CONNECT request with the
+// port, defaulting to 443.
+func tunnelAddress(u *url.URL) string {
+	if u.Port() == "" {
+		return net.JoinHostPort(u.Hostname(), defaultTunnelPort)
+	}
+	return u.Host
+}
+
+// makeTunnel serves a CONNECT request in forward proxy mode. It opens
+// a TCP connection to the requested destination, confirms the tunnel
+// to the client and copies data in both directions until either side
+// closes the connection, or no data was copied in either direction for
+// the idle timeout. The returned error is always set, it is marked as
+// handled when the response was sent to the client.
+func (p *Proxy) makeTunnel(ctx *context) *proxyError {
+	u := *ctx.request.URL
+	setRequestURLFromRequest(&u, ctx.request)
+	setRequestURLForDynamicBackend(&u, ctx.StateBag())
+	addr := tunnelAddress(&u)
+
+	backendConn, err := p.dialContext(ctx.request.Context(), "tcp", addr)
+	if err != nil {
+		p.metrics.IncCounter(tunnelErrorsKey)
+		return &proxyError{err: fmt.Errorf("failed to dial tunnel destination %s: %w", addr, err), code: http.StatusBadGateway}
+	}
+	defer backendConn.Close()
+
+	clientConn, clientBuf, err := ctx.ResponseController().Hijack()
+	if err != nil {
+		p.metrics.IncCounter(tunnelErrorsKey)
+		return errTunnelHijack
+	}
+	defer clientConn.Close()
+	// NOTE: from this point forward, we own the connection and we can't use
+	// w.Header(), w.Write(), or w.WriteHeader any more
+	ctx.successfulUpgrade = true
+
+	if _, err := io.WriteString(clientConn, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		p.metrics.IncCounter(tunnelErrorsKey)
+		ctx.Logger().Errorf("Failed to confirm tunnel to %s: %v", addr, err)
+		return &proxyError{handled: true}
+	}
+
+	p.metrics.IncCounter(tunnelEstablishedKey)
+	p.metrics.UpdateGauge(tunnelActiveKey, float64(p.tunnels.Add(1)))
+	start := time.Now()
+	defer func() {
+		p.metrics.UpdateGauge(tunnelActiveKey, float64(p.tunnels.Add(-1)))
+		p.metrics.MeasureSince(tunnelDurationKey, start)
+	}()
+
+	sent := &countingWriter{w: backendConn}
+	received := &countingWriter{w: clientConn}
+	if p.tunnelIdleTimeout > 0 {
+		// closing the connections unblocks both copyAsync
+		idle := time.AfterFunc(p.tunnelIdleTimeout, func() {
+			ctx.Logger().Debugf("closing idle tunnel to %s", addr)
+			clientConn.Close()
+			backendConn.Close()
+		})
+		defer idle.Stop()
+
+		sent.idle, sent.idleTimeout = idle, p.tunnelIdleTimeout
+		received.idle, received.idleTimeout = idle, p.tunnelIdleTimeout
+	}
+
+	done := make(chan struct{}, 2)
+	copyAsync("destination->client", backendConn, received, done)
+	// clientBuf may hold data that the client sent right after the request
+	copyAsync("client->destination", clientBuf, sent, done)
+
+	// Wait for either copyAsync to complete.
+	// Return from this method closes both client and destination connections via defer
+	// and thus unblocks the second copyAsync.
+	<-done
+
+	p.metrics.IncCounterBy(tunnelBytesSentKey, sent.n.Load())
+	p.metrics.IncCounterBy(tunnelBytesReceivedKey, received.n.Load())
+
+	ctx.Logger().Debugf("finished tunnel to %s", addr)
+
+	return &proxyError{handled: true}
+}
@@ -0,0 +1,203 @@
+package proxy_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/proxy"
+	"github.com/zalando/skipper/proxy/proxytest"
+)
+
+func newForwardProxy(t *testing.T, allowedHost string) *proxytest.TestProxy {
+	t.Helper()
+	return newForwardProxyWithParams(t, allowedHost, proxy.Params{})
+}
+
+func newForwardProxyWithParams(t *testing.T, allowedHost string, params proxy.Params) *proxytest.TestProxy {
+	t.Helper()
+
+	routes, err := eskip.Parse(fmt.Sprintf(`
+		allowed: Host("^%s$") -> <dynamic>;
+		denied: * -> status(403) -> <shunt>;
+	`, regexp.QuoteMeta(allowedHost)))
+	require.NoError(t, err)
+
+	params.Flags |= proxy.ForwardProxy
+	p := proxytest.WithParams(builtin.MakeRegistry(), params, routes...)
+	t.Cleanup(func() { p.Close() })
+
+	return p
+}
+
+func TestForwardProxyConnect(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello tunnel"))
+	}))
+	defer backend.Close()
+
+	backendURL, err := url.Parse(backend.URL)
+	require.NoError(t, err)
+
+	p := newForwardProxy(t, backendURL.Host)
+	proxyURL, err := url.Parse(p.URL)
+	require.NoError(t, err)
+
+	client := backend.Client()
+	client.Transport.(*http.Transport).Proxy = http.ProxyURL(proxyURL)
+
+	rsp, err := client.Get(backend.URL)
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+
+	b, err := io.ReadAll(rsp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, rsp.StatusCode)
+	assert.Equal(t, "hello tunnel", string(b))
+}
+
+func TestForwardProxyConnectDenied(t *testing.T) {
+	p := newForwardProxy(t, "allowed.example.org:443")
+	proxyURL, err := url.Parse(p.URL)
+	require.NoError(t, err)
+
+	conn, err := net.Dial("tcp", proxyURL.Host)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = io.WriteString(conn, "CONNECT denied.example.org:443 HTTP/1.1\r\nHost: denied.example.org:443\r\n\r\n")
+	require.NoError(t, err)
+
+	rsp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: http.MethodConnect})
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+
+	assert.Equal(t, http.StatusForbidden, rsp.StatusCode)
+}
+
+func TestForwardProxyConnectUnreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	p := newForwardProxy(t, addr)
+	proxyURL, err := url.Parse(p.URL)
+	require.NoError(t, err)
+
+	conn, err := net.Dial("tcp", proxyURL.Host)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", addr, addr)
+	require.NoError(t, err)
+
+	rsp, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: http.MethodConnect})
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+
+	assert.Equal(t, http.StatusBadGateway, rsp.StatusCode)
+}
+
+func TestForwardProxyConnectIdleTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	// echo destination
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	addr := l.Addr().String()
+	p := newForwardProxyWithParams(t, addr, proxy.Params{TunnelIdleTimeout: 200 * time.Millisecond})
+	proxyURL, err := url.Parse(p.URL)
+	require.NoError(t, err)
+
+	conn, err := net.Dial("tcp", proxyURL.Host)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", addr, addr)
+	require.NoError(t, err)
+
+	br := bufio.NewReader(conn)
+	rsp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+	// the traffic keeps the tunnel open longer than the idle timeout
+	start := time.Now()
+	for range 4 {
+		time.Sleep(100 * time.Millisecond)
+
+		_, err = io.WriteString(conn, "ping")
+		require.NoError(t, err)
+
+		b := make([]byte, 4)
+		_, err = io.ReadFull(br, b)
+		require.NoError(t, err)
+		assert.Equal(t, "ping", string(b))
+	}
+
+	require.Greater(t, time.Since(start), 200*time.Millisecond)
+
+	// the idle tunnel is closed
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestForwardProxyRemovesProxyHeaders(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != "" || r.Header.Get("Proxy-Connection") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	backendURL, err := url.Parse(backend.URL)
+	require.NoError(t, err)
+
+	p := newForwardProxy(t, backendURL.Host)
+
+	req, err := http.NewRequest("GET", backend.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Proxy-Authorization", "Basic Zm9vOmJhcg==")
+	req.Header.Set("Proxy-Connection", "keep-alive")
+
+	proxyURL, err := url.Parse(p.URL)
+	require.NoError(t, err)
+
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	rsp, err := client.Do(req)
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, rsp.StatusCode)
+}
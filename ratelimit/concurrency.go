@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	_ "embed"
+	"encoding/hex"
+	"time"
+)
+
+// Implements acquiring a concurrency lease as a Redis lua script.
+// Redis guarantees that a script is executed in an atomic way,
+// therefore counting and adding the lease can not race.
+//
+//go:embed concurrency.lua
+var concurrencyScript string
+
+const (
+	// DefaultConcurrencyLeaseTTL is the default time after which an
+	// unreleased lease expires, e.g. when the instance holding it
+	// crashed.
+	DefaultConcurrencyLeaseTTL = time.Minute
+
+	concurrencyRedisKeyPrefix = "ccl."
+)
+
+// ConcurrencyLimiter is the interface for cluster concurrency limiter
+// implementations.
+type ConcurrencyLimiter interface {
+	// Acquire tries to acquire a lease for the key. It returns the id
+	// of the lease, when the number of the leases held for the key was
+	// below the maximum.
+	Acquire(ctx context.Context, key string) (lease string, acquired bool, err error)
+
+	// Release releases a lease acquired for the key.
+	Release(ctx context.Context, key, lease string) error
+}
+
+// NewClusterConcurrencyLimiter creates a limiter for the group, that
+// allows max leases per key across all instances. Leases expire after
+// ttl, if not released. Prefers Valkey over Redis when both are
+// configured.
+func NewClusterConcurrencyLimiter(r *Registry, group string, max int, ttl time.Duration) ConcurrencyLimiter {
+	if ttl <= 0 {
+		ttl = DefaultConcurrencyLeaseTTL
+	}
+
+	if r.valkeyRing != nil {
+		return newClusterConcurrencyLimiterValkey(r.valkeyRing, group, max, ttl, time.Now)
+	}
+	return newClusterConcurrencyLimiterRedis(r.redisRing, group, max, ttl, time.Now)
+}
+
+func getConcurrencyKey(group, key string) string {
+	return concurrencyRedisKeyPrefix + getHashedKey(group+"-"+key)
+}
+
+func newLeaseId() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
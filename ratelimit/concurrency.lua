@@ -0,0 +1,22 @@
+local key = KEYS[1]                  -- lease set id
+local max = tonumber(ARGV[1])        -- maximum number of leases (max > 0)
+local lease = ARGV[2]                -- lease id
+local now = tonumber(ARGV[3])        -- current time in milliseconds
+local ttl = tonumber(ARGV[4])        -- lease time to live in milliseconds (ttl > 0)
+
+-- Leases are stored in a sorted set scored by their expiry time.
+-- Expired leases, e.g. of crashed instances, are removed before counting.
+redis.call("ZREMRANGEBYSCORE", key, "-inf", now)
+
+if redis.call("ZCARD", key) >= max then
+    return 0
+end
+
+redis.call("ZADD", key, now + ttl, lease)
+
+-- The set expires with its latest lease.
+if redis.call("PTTL", key) < ttl then
+    redis.call("PEXPIRE", key, ttl)
+end
+
+return 1
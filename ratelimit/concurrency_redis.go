@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+
+	"github.com/zalando/skipper/metrics"
+	"github.com/zalando/skipper/net"
+)
+
+type ClusterConcurrencyLimiter struct {
+	group      string
+	max        int
+	ttl        time.Duration
+	script     *net.RedisScript
+	ringClient *net.RedisRingClient
+	metrics    metrics.Metrics
+	now        func() time.Time
+}
+
+const (
+	concurrencyMetricPrefix         = "concurrency.redis."
+	concurrencyMetricAcquireLatency = concurrencyMetricPrefix + "acquire.latency"
+	concurrencyMetricReleaseLatency = concurrencyMetricPrefix + "release.latency"
+	concurrencyAcquireSpanName      = "redis_concurrency_acquire"
+	concurrencyReleaseSpanName      = "redis_concurrency_release"
+)
+
+func newClusterConcurrencyLimiterRedis(ringClient *net.RedisRingClient, group string, max int, ttl time.Duration, now func() time.Time) *ClusterConcurrencyLimiter {
+	return &ClusterConcurrencyLimiter{
+		group:      group,
+		max:        max,
+		ttl:        ttl,
+		script:     ringClient.NewScript(concurrencyScript),
+		ringClient: ringClient,
+		metrics:    metrics.Default,
+		now:        now,
+	}
+}
+
+// Acquire acquires a lease for the key, when less than max leases are
+// held for it.
+func (l *ClusterConcurrencyLimiter) Acquire(ctx context.Context, key string) (lease string, acquired bool, err error) {
+	now := l.now()
+	span := startSpan(ctx, l.ringClient.StartSpan, concurrencyAcquireSpanName)
+	defer span.Finish()
+	defer l.metrics.MeasureSince(concurrencyMetricAcquireLatency, now)
+
+	lease, err = newLeaseId()
+	if err != nil {
+		return "", false, err
+	}
+
+	r, err := l.ringClient.RunScript(ctx, l.script,
+		[]string{getConcurrencyKey(l.group, key)},
+		l.max,
+		lease,
+		now.UnixMilli(),
+		l.ttl.Milliseconds(),
+	)
+	if err != nil {
+		ext.Error.Set(span, true)
+		return "", false, err
+	}
+
+	if r.(int64) != 1 {
+		return "", false, nil
+	}
+
+	return lease, true, nil
+}
+
+// Release releases the lease of the key.
+func (l *ClusterConcurrencyLimiter) Release(ctx context.Context, key, lease string) error {
+	span := startSpan(ctx, l.ringClient.StartSpan, concurrencyReleaseSpanName)
+	defer span.Finish()
+	defer l.metrics.MeasureSince(concurrencyMetricReleaseLatency, l.now())
+
+	_, err := l.ringClient.ZRem(ctx, getConcurrencyKey(l.group, key), lease)
+	if err != nil {
+		ext.Error.Set(span, true)
+	}
+
+	return err
+}
+
+func startSpan(ctx context.Context, start func(string, ...opentracing.StartSpanOption) opentracing.Span, name string) opentracing.Span {
+	spanOpts := []opentracing.StartSpanOption{opentracing.Tags{
+		string(ext.Component): "skipper",
+		string(ext.SpanKind):  "client",
+	}}
+	if parent := opentracing.SpanFromContext(ctx); parent != nil {
+		spanOpts = append(spanOpts, opentracing.ChildOf(parent.Context()))
+	}
+	return start(name, spanOpts...)
+}
@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/zalando/skipper/net"
+	"github.com/zalando/skipper/net/redistest"
+	"github.com/zalando/skipper/net/valkeytest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testConcurrencyLimiters(t *testing.T, test func(t *testing.T, newLimiter func(max int, ttl time.Duration, now func() time.Time) ConcurrencyLimiter)) {
+	t.Run("redis", func(t *testing.T) {
+		redisAddr, done := redistest.NewTestRedis(t)
+		t.Cleanup(done)
+		ringClient := net.NewRedisRingClient(&net.RedisOptions{Addrs: []string{redisAddr}})
+		t.Cleanup(ringClient.Close)
+
+		test(t, func(max int, ttl time.Duration, now func() time.Time) ConcurrencyLimiter {
+			return newClusterConcurrencyLimiterRedis(ringClient, "agroup", max, ttl, now)
+		})
+	})
+	t.Run("valkey", func(t *testing.T) {
+		valkeyAddr, done := valkeytest.NewTestValkey(t)
+		t.Cleanup(done)
+		ringClient, err := net.NewValkeyRingClient(&net.ValkeyOptions{Addrs: []string{valkeyAddr}})
+		require.NoError(t, err)
+		t.Cleanup(func() { ringClient.Close() })
+
+		test(t, func(max int, ttl time.Duration, now func() time.Time) ConcurrencyLimiter {
+			return newClusterConcurrencyLimiterValkey(ringClient, "agroup", max, ttl, now)
+		})
+	})
+}
+
+func TestConcurrencyLimiterAcquireRelease(t *testing.T) {
+	testConcurrencyLimiters(t, func(t *testing.T, newLimiter func(int, time.Duration, func() time.Time) ConcurrencyLimiter) {
+		ctx := context.Background()
+		l := newLimiter(2, time.Minute, time.Now)
+
+		lease1, acquired, err := l.Acquire(ctx, "akey")
+		require.NoError(t, err)
+		assert.True(t, acquired)
+
+		_, acquired, err = l.Acquire(ctx, "akey")
+		require.NoError(t, err)
+		assert.True(t, acquired)
+
+		_, acquired, err = l.Acquire(ctx, "akey")
+		require.NoError(t, err)
+		assert.False(t, acquired, "limit reached")
+
+		_, acquired, err = l.Acquire(ctx, "otherkey")
+		require.NoError(t, err)
+		assert.True(t, acquired, "other key has its own limit")
+
+		require.NoError(t, l.Release(ctx, "akey", lease1))
+
+		_, acquired, err = l.Acquire(ctx, "akey")
+		require.NoError(t, err)
+		assert.True(t, acquired, "released lease")
+	})
+}
+
+func TestConcurrencyLimiterLeaseExpiry(t *testing.T) {
+	testConcurrencyLimiters(t, func(t *testing.T, newLimiter func(int, time.Duration, func() time.Time) ConcurrencyLimiter) {
+		ctx := context.Background()
+		now := time.Now()
+		l := newLimiter(1, time.Minute, func() time.Time { return now })
+
+		_, acquired, err := l.Acquire(ctx, "akey")
+		require.NoError(t, err)
+		assert.True(t, acquired)
+
+		now = now.Add(59 * time.Second)
+		_, acquired, err = l.Acquire(ctx, "akey")
+		require.NoError(t, err)
+		assert.False(t, acquired, "lease not expired")
+
+		now = now.Add(2 * time.Second)
+		_, acquired, err = l.Acquire(ctx, "akey")
+		require.NoError(t, err)
+		assert.True(t, acquired, "lease expired")
+	})
+}
+
+func TestConcurrencyLimiterError(t *testing.T) {
+	ringClient := net.NewRedisRingClient(&net.RedisOptions{Addrs: []string{"no-such-host.test:123"}})
+	defer ringClient.Close()
+
+	l := newClusterConcurrencyLimiterRedis(ringClient, "agroup", 1, time.Minute, time.Now)
+	_, acquired, err := l.Acquire(context.Background(), "akey")
+
+	assert.Error(t, err)
+	assert.False(t, acquired)
+}
+
+func TestConcurrencyKey(t *testing.T) {
+	assert.NotEqual(t, getConcurrencyKey("group1", "akey"), getConcurrencyKey("group2", "akey"))
+	assert.Equal(t, getConcurrencyKey("group1", "akey"), getConcurrencyKey("group1", "akey"))
+}
@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/valkey-io/valkey-go"
+
+	"github.com/zalando/skipper/metrics"
+	"github.com/zalando/skipper/net"
+)
+
+type ClusterConcurrencyLimiterValkey struct {
+	group      string
+	max        int
+	ttl        time.Duration
+	script     *valkey.Lua
+	ringClient *net.ValkeyRingClient
+	metrics    metrics.Metrics
+	now        func() time.Time
+}
+
+const (
+	concurrencyValkeyMetricPrefix         = "concurrency.valkey."
+	concurrencyValkeyMetricAcquireLatency = concurrencyValkeyMetricPrefix + "acquire.latency"
+	concurrencyValkeyMetricReleaseLatency = concurrencyValkeyMetricPrefix + "release.latency"
+	concurrencyValkeyAcquireSpanName      = "valkey_concurrency_acquire"
+	concurrencyValkeyReleaseSpanName      = "valkey_concurrency_release"
+)
+
+func newClusterConcurrencyLimiterValkey(ringClient *net.ValkeyRingClient, group string, max int, ttl time.Duration, now func() time.Time) *ClusterConcurrencyLimiterValkey {
+	return &ClusterConcurrencyLimiterValkey{
+		group:      group,
+		max:        max,
+		ttl:        ttl,
+		script:     net.NewScript(concurrencyScript),
+		ringClient: ringClient,
+		metrics:    metrics.Default,
+		now:        now,
+	}
+}
+
+// Acquire acquires a lease for the key, when less than max leases are
+// held for it.
+func (l *ClusterConcurrencyLimiterValkey) Acquire(ctx context.Context, key string) (lease string, acquired bool, err error) {
+	now := l.now()
+	span := startSpan(ctx, l.ringClient.StartSpan, concurrencyValkeyAcquireSpanName)
+	defer span.Finish()
+	defer l.metrics.MeasureSince(concurrencyValkeyMetricAcquireLatency, now)
+
+	lease, err = newLeaseId()
+	if err != nil {
+		return "", false, err
+	}
+
+	msg, err := l.ringClient.RunScript(ctx, l.script,
+		[]string{getConcurrencyKey(l.group, key)},
+		strconv.Itoa(l.max),
+		lease,
+		strconv.FormatInt(now.UnixMilli(), 10),
+		strconv.FormatInt(l.ttl.Milliseconds(), 10),
+	)
+	if err != nil {
+		ext.Error.Set(span, true)
+		return "", false, err
+	}
+
+	x, err := msg.ToInt64()
+	if err != nil {
+		ext.Error.Set(span, true)
+		return "", false, err
+	}
+
+	if x != 1 {
+		return "", false, nil
+	}
+
+	return lease, true, nil
+}
+
+// Release releases the lease of the key.
+func (l *ClusterConcurrencyLimiterValkey) Release(ctx context.Context, key, lease string) error {
+	span := startSpan(ctx, l.ringClient.StartSpan, concurrencyValkeyReleaseSpanName)
+	defer span.Finish()
+	defer l.metrics.MeasureSince(concurrencyValkeyMetricReleaseLatency, l.now())
+
+	_, err := l.ringClient.ZRem(ctx, getConcurrencyKey(l.group, key), lease)
+	if err != nil {
+		ext.Error.Set(span, true)
+	}
+
+	return err
+}
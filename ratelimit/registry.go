@@ -145,6 +145,26 @@ func (r *Registry) Close() {
 	})
 }
 
+// UpdateSettings replaces the default settings of the registry used by
+// the global ratelimit facility. Without settings, the global ratelimit
+// is disabled.
+func (r *Registry) UpdateSettings(settings ...Settings) {
+	r.Lock()
+	defer r.Unlock()
+
+	if len(settings) > 0 {
+		r.global = settings[0]
+	} else {
+		r.global = getSwarmRegistryDefaultSettings()
+	}
+}
+
+func (r *Registry) globalSettings() Settings {
+	r.Lock()
+	defer r.Unlock()
+	return r.global
+}
+
 func (r *Registry) get(s Settings) *Ratelimit {
 	r.Lock()
 	defer r.Unlock()
@@ -174,7 +194,7 @@ func (r *Registry) Check(req *http.Request) (Settings, int) {
 		return Settings{}, 0
 	}
 
-	s := r.global
+	s := r.globalSettings()
 
 	rlimit := r.Get(s)
 
@@ -117,3 +117,39 @@ func TestCheck(t *testing.T) {
 		}
 	})
 }
+
+func TestRegistryUpdateSettings(t *testing.T) {
+	r := NewRegistry()
+	defer r.Close()
+
+	req, err := http.NewRequest("GET", "http://update.test:1234/", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	for range 3 {
+		if _, i := r.Check(req); i != 0 {
+			t.Fatalf("Request should not be rate limited without settings: %d", i)
+		}
+	}
+
+	r.UpdateSettings(Settings{
+		Type:          ServiceRatelimit,
+		MaxHits:       1,
+		TimeWindow:    10 * time.Second,
+		CleanInterval: 5 * time.Second,
+	})
+
+	if _, i := r.Check(req); i != 0 {
+		t.Fatalf("First request should not be rate limited: %d", i)
+	}
+	if _, j := r.Check(req); j != 10 {
+		t.Fatalf("Second request should be rate limited after the update: %d", j)
+	}
+
+	r.UpdateSettings()
+
+	if _, i := r.Check(req); i != 0 {
+		t.Fatalf("Request should not be rate limited after removing the settings: %d", i)
+	}
+}
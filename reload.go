@@ -0,0 +1,270 @@
+package skipper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zalando/skipper/circuit"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters/openpolicyagent"
+	"github.com/zalando/skipper/proxy"
+	"github.com/zalando/skipper/ratelimit"
+	"github.com/zalando/skipper/routing"
+)
+
+const defaultConfigReloadCheckInterval = 10 * time.Second
+
+// the options that are applied at runtime by the config reloader. Enabling
+// or disabling the circuit breakers, the ratelimiters or the Open Policy
+// Agent, and the other access log options, require a restart.
+var reloadableOptions = map[string]bool{
+	"DefaultFilters":                true,
+	"BreakerSettings":               true,
+	"RatelimitSettings":             true,
+	"AccessLogDisabled":             true,
+	"OpenPolicyAgentConfigTemplate": true,
+	"OpenPolicyAgentEnvoyMetadata":  true,
+}
+
+// defaultFiltersPreProcessor applies the default filters, that can be
+// replaced at runtime.
+type defaultFiltersPreProcessor struct {
+	current atomic.Pointer[eskip.DefaultFilters]
+}
+
+type configReloader struct {
+	options    Options
+	reload     func() (Options, error)
+	filters    *defaultFiltersPreProcessor
+	routing    *routing.Routing
+	proxy      *proxy.Proxy
+	breakers   *circuit.Registry
+	ratelimits *ratelimit.Registry
+	opa        *openpolicyagent.OpenPolicyAgentRegistry
+}
+
+func newDefaultFiltersPreProcessor(df *eskip.DefaultFilters) *defaultFiltersPreProcessor {
+	p := &defaultFiltersPreProcessor{}
+	p.current.Store(df)
+	return p
+}
+
+func (p *defaultFiltersPreProcessor) Do(routes []*eskip.Route) []*eskip.Route {
+	if df := p.current.Load(); df != nil {
+		return df.Do(routes)
+	}
+
+	return routes
+}
+
+// comparableOption tells whether the values of an option type can be compared
+// between two versions of the options. Types holding functions, channels
+// or interfaces, e.g. custom filters or tracers, are runtime objects that
+// differ on every config load.
+func comparableOption(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return true
+	}
+
+	seen[t] = true
+	switch t.Kind() {
+	case reflect.Func, reflect.Chan, reflect.Interface, reflect.UnsafePointer:
+		return false
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		return comparableOption(t.Elem(), seen)
+	case reflect.Map:
+		return comparableOption(t.Key(), seen) && comparableOption(t.Elem(), seen)
+	case reflect.Struct:
+		for i := range t.NumField() {
+			if !comparableOption(t.Field(i).Type, seen) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// restartRequired returns the names of the changed options, that are
+// applied only on startup.
+func restartRequired(current, next Options) []string {
+	var changed []string
+
+	cv := reflect.ValueOf(current)
+	nv := reflect.ValueOf(next)
+	t := cv.Type()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if reloadableOptions[f.Name] || !comparableOption(f.Type, make(map[reflect.Type]bool)) {
+			continue
+		}
+
+		if !reflect.DeepEqual(cv.Field(i).Interface(), nv.Field(i).Interface()) {
+			changed = append(changed, f.Name)
+		}
+	}
+
+	return changed
+}
+
+// apply applies the options that can change at runtime. It rejects the
+// changes of the other options, that require a restart, and returns an
+// error listing them.
+func (r *configReloader) apply(next Options) error {
+	var (
+		refresh bool
+		opaErr  error
+	)
+
+	rejected := restartRequired(r.options, next)
+
+	if !reflect.DeepEqual(r.options.DefaultFilters, next.DefaultFilters) {
+		log.Info("Config reload: applying default filters")
+		r.filters.current.Store(next.DefaultFilters)
+		r.options.DefaultFilters = next.DefaultFilters
+		refresh = true
+	}
+
+	if !reflect.DeepEqual(r.options.BreakerSettings, next.BreakerSettings) {
+		if r.breakers == nil {
+			// the circuit breakers were disabled on startup
+			rejected = append(rejected, "BreakerSettings")
+		} else {
+			log.Info("Config reload: applying circuit breaker settings")
+			r.breakers.UpdateSettings(next.BreakerSettings...)
+			r.options.BreakerSettings = next.BreakerSettings
+		}
+	}
+
+	if !reflect.DeepEqual(r.options.RatelimitSettings, next.RatelimitSettings) {
+		if r.ratelimits == nil {
+			// the ratelimiters were disabled on startup
+			rejected = append(rejected, "RatelimitSettings")
+		} else {
+			log.Info("Config reload: applying ratelimit settings")
+			r.ratelimits.UpdateSettings(next.RatelimitSettings...)
+			r.options.RatelimitSettings = next.RatelimitSettings
+		}
+	}
+
+	if r.options.AccessLogDisabled != next.AccessLogDisabled {
+		log.Infof("Config reload: applying access log disabled: %v", next.AccessLogDisabled)
+		r.proxy.SetAccessLogDisabled(next.AccessLogDisabled)
+		r.options.AccessLogDisabled = next.AccessLogDisabled
+	}
+
+	if r.opa != nil {
+		// the content of the files can change without changing the
+		// options, the registry checks whether the config changed
+		updated, err := r.opa.UpdateInstanceConfig(next.openPolicyAgentInstanceConfig()...)
+		if err != nil {
+			opaErr = fmt.Errorf("failed to apply the Open Policy Agent config: %w", err)
+		} else {
+			if updated {
+				log.Info("Config reload: applied the Open Policy Agent config")
+				refresh = true
+			}
+
+			r.options.OpenPolicyAgentConfigTemplate = next.OpenPolicyAgentConfigTemplate
+			r.options.OpenPolicyAgentEnvoyMetadata = next.OpenPolicyAgentEnvoyMetadata
+		}
+	} else {
+		// the Open Policy Agent was disabled on startup
+		if r.options.OpenPolicyAgentConfigTemplate != next.OpenPolicyAgentConfigTemplate {
+			rejected = append(rejected, "OpenPolicyAgentConfigTemplate")
+		}
+
+		if r.options.OpenPolicyAgentEnvoyMetadata != next.OpenPolicyAgentEnvoyMetadata {
+			rejected = append(rejected, "OpenPolicyAgentEnvoyMetadata")
+		}
+	}
+
+	if refresh && r.routing != nil {
+		r.routing.Refresh()
+	}
+
+	var err error
+	if len(rejected) > 0 {
+		err = fmt.Errorf("changes of the options %s rejected, restart required to apply them", strings.Join(rejected, ", "))
+	}
+
+	return errors.Join(err, opaErr)
+}
+
+func (r *configReloader) reloadConfig() {
+	next, err := r.reload()
+	if err != nil {
+		log.Errorf("Config reload failed, keeping the current config: %v", err)
+		return
+	}
+
+	if err := r.apply(next); err != nil {
+		log.Errorf("Config reload: %v", err)
+	}
+}
+
+func fileChecksum(name string) []byte {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		log.Errorf("Config reload: failed to read %s: %v", name, err)
+		return nil
+	}
+
+	sum := sha256.Sum256(b)
+	return sum[:]
+}
+
+// run reloads the config on SIGHUP, and when the config file changes.
+func (r *configReloader) run(quit <-chan struct{}) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	var (
+		checksum []byte
+		check    <-chan time.Time
+	)
+
+	if r.options.ConfigReloadFile != "" {
+		interval := r.options.ConfigReloadCheckInterval
+		if interval <= 0 {
+			interval = defaultConfigReloadCheckInterval
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		check = ticker.C
+		checksum = fileChecksum(r.options.ConfigReloadFile)
+	}
+
+	for {
+		select {
+		case <-sighup:
+			log.Info("Config reload: received SIGHUP")
+			r.reloadConfig()
+		case <-check:
+			next := fileChecksum(r.options.ConfigReloadFile)
+			if next == nil || bytes.Equal(next, checksum) {
+				continue
+			}
+
+			log.Infof("Config reload: %s changed", r.options.ConfigReloadFile)
+			checksum = next
+			r.reloadConfig()
+		case <-quit:
+			return
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package skipper
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando/skipper/circuit"
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/filters/openpolicyagent"
+	"github.com/zalando/skipper/proxy"
+	"github.com/zalando/skipper/ratelimit"
+)
+
+func TestReloadRestartRequired(t *testing.T) {
+	current := Options{
+		Address:        ":9090",
+		DefaultFilters: &eskip.DefaultFilters{Append: []*eskip.Filter{{Name: "status", Args: []any{float64(200)}}}},
+		CustomFilters:  []filters.Spec{builtin.NewStatus()},
+		CustomHttpHandlerWrap: func(h http.Handler) http.Handler {
+			return h
+		},
+	}
+
+	next := current
+	next.DefaultFilters = &eskip.DefaultFilters{}
+	next.AccessLogDisabled = true
+	next.CustomFilters = []filters.Spec{builtin.NewStatus()}
+	next.CustomHttpHandlerWrap = func(h http.Handler) http.Handler {
+		return h
+	}
+
+	assert.Empty(t, restartRequired(current, next))
+
+	next.Address = ":9091"
+	next.MaxLoopbacks = 3
+	assert.Equal(t, []string{"Address", "MaxLoopbacks"}, restartRequired(current, next))
+}
+
+func TestReloadApply(t *testing.T) {
+	df := &eskip.DefaultFilters{Append: []*eskip.Filter{{Name: "status", Args: []any{float64(200)}}}}
+	current := Options{
+		DefaultFilters:     df,
+		EnableBreakers:     true,
+		BreakerSettings:    []circuit.BreakerSettings{{Type: circuit.ConsecutiveFailures, Failures: 5}},
+		EnableRatelimiters: true,
+	}
+
+	p := proxy.WithParams(proxy.Params{})
+	defer p.Close()
+
+	r := &configReloader{
+		options:    current,
+		filters:    newDefaultFiltersPreProcessor(df),
+		proxy:      p,
+		breakers:   circuit.NewRegistry(current.BreakerSettings...),
+		ratelimits: ratelimit.NewRegistry(),
+	}
+	defer r.ratelimits.Close()
+
+	next := current
+	next.DefaultFilters = &eskip.DefaultFilters{Prepend: []*eskip.Filter{{Name: "setPath", Args: []any{"/"}}}}
+	next.BreakerSettings = nil
+	next.RatelimitSettings = []ratelimit.Settings{{Type: ratelimit.ClientRatelimit, MaxHits: 10, TimeWindow: time.Second}}
+	next.AccessLogDisabled = true
+
+	require.NoError(t, r.apply(next))
+
+	routes := r.filters.Do([]*eskip.Route{{Id: "r"}})
+	require.Len(t, routes, 1)
+	require.Len(t, routes[0].Filters, 1)
+	assert.Equal(t, "setPath", routes[0].Filters[0].Name)
+
+	assert.Nil(t, r.breakers.Get(circuit.BreakerSettings{Host: "example.org"}))
+
+	assert.Equal(t, next.DefaultFilters, r.options.DefaultFilters)
+	assert.Equal(t, next.BreakerSettings, r.options.BreakerSettings)
+	assert.Equal(t, next.RatelimitSettings, r.options.RatelimitSettings)
+	assert.True(t, r.options.AccessLogDisabled)
+}
+
+func TestReloadApplyRejectsRestartRequired(t *testing.T) {
+	current := Options{
+		Address:            ":9090",
+		EnableRatelimiters: true,
+	}
+
+	p := proxy.WithParams(proxy.Params{})
+	defer p.Close()
+
+	r := &configReloader{
+		options:    current,
+		filters:    newDefaultFiltersPreProcessor(nil),
+		proxy:      p,
+		ratelimits: ratelimit.NewRegistry(),
+	}
+	defer r.ratelimits.Close()
+
+	next := current
+	next.Address = ":9091"
+	next.EnableRatelimiters = false
+	next.EnableBreakers = true
+	next.EnableOpenPolicyAgent = true
+	next.OpenPolicyAgentConfigTemplate = "opaconfig.yaml"
+	next.BreakerSettings = []circuit.BreakerSettings{{Type: circuit.ConsecutiveFailures, Failures: 5}}
+	next.AccessLogDisabled = true
+
+	err := r.apply(next)
+	assert.EqualError(t, err, "changes of the options Address, EnableBreakers, EnableRatelimiters, EnableOpenPolicyAgent, BreakerSettings, OpenPolicyAgentConfigTemplate rejected, restart required to apply them")
+
+	assert.Equal(t, ":9090", r.options.Address)
+	assert.True(t, r.options.EnableRatelimiters)
+	assert.False(t, r.options.EnableBreakers)
+	assert.False(t, r.options.EnableOpenPolicyAgent)
+	assert.Empty(t, r.options.OpenPolicyAgentConfigTemplate)
+	assert.Nil(t, r.options.BreakerSettings)
+	assert.True(t, r.options.AccessLogDisabled, "the reloadable options are applied")
+}
+
+func TestReloadApplyOpenPolicyAgentConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		return path
+	}
+
+	configTemplate := write("opaconfig.yaml", `{"plugins": {"envoy_ext_authz_grpc": {"path": "envoy/authz/allow", "dry-run": false}}}`)
+
+	registry, err := openpolicyagent.NewOpenPolicyAgentRegistry(
+		openpolicyagent.WithOpenPolicyAgentInstanceConfig(openpolicyagent.WithConfigTemplateFile(configTemplate)))
+	require.NoError(t, err)
+	defer registry.Close()
+
+	current := Options{
+		EnableOpenPolicyAgent:         true,
+		OpenPolicyAgentConfigTemplate: configTemplate,
+	}
+
+	p := proxy.WithParams(proxy.Params{})
+	defer p.Close()
+
+	r := &configReloader{
+		options: current,
+		filters: newDefaultFiltersPreProcessor(nil),
+		proxy:   p,
+		opa:     registry,
+	}
+
+	// unchanged
+	require.NoError(t, r.apply(current))
+
+	next := current
+	next.OpenPolicyAgentConfigTemplate = write("opaconfig-dry-run.yaml", `{"plugins": {"envoy_ext_authz_grpc": {"path": "envoy/authz/allow", "dry-run": true}}}`)
+	require.NoError(t, r.apply(next))
+	assert.Equal(t, next.OpenPolicyAgentConfigTemplate, r.options.OpenPolicyAgentConfigTemplate)
+
+	// the changed content of the same file
+	write("opaconfig-dry-run.yaml", `{"services": `)
+	assert.ErrorContains(t, r.apply(next), "failed to apply the Open Policy Agent config")
+
+	missing := next
+	missing.OpenPolicyAgentConfigTemplate = filepath.Join(dir, "missing.yaml")
+	assert.ErrorContains(t, r.apply(missing), "failed to apply the Open Policy Agent config")
+	assert.Equal(t, next.OpenPolicyAgentConfigTemplate, r.options.OpenPolicyAgentConfigTemplate)
+}
+
+func TestReloadConfigKeepsOptionsOnError(t *testing.T) {
+	current := Options{AccessLogDisabled: false}
+	r := &configReloader{
+		options: current,
+		reload: func() (Options, error) {
+			return Options{}, assert.AnError
+		},
+	}
+
+	r.reloadConfig()
+	assert.Equal(t, current, r.options)
+}
@@ -0,0 +1,297 @@
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters"
+	"github.com/zalando/skipper/predicates"
+)
+
+// FindingType identifies the kind of problem reported by Analyze.
+type FindingType string
+
+const (
+	// FindingUnknownFilter is reported for filters missing from the
+	// filter registry.
+	FindingUnknownFilter FindingType = "unknown_filter"
+
+	// FindingInvalidFilterParams is reported when creating a filter
+	// with the given arguments fails.
+	FindingInvalidFilterParams FindingType = "invalid_filter_params"
+
+	// FindingUnknownPredicate is reported for predicates missing from
+	// the predicate specs.
+	FindingUnknownPredicate FindingType = "unknown_predicate"
+
+	// FindingInvalidPredicateParams is reported when creating a
+	// predicate with the given arguments fails.
+	FindingInvalidPredicateParams FindingType = "invalid_predicate_params"
+
+	// FindingInvalidRoute is reported for any other problem, that
+	// prevents the route from being added to the routing table.
+	FindingInvalidRoute FindingType = "invalid_route"
+
+	// FindingShadowedRoute is reported for routes that can never match,
+	// because another route with a higher weight matches all of their
+	// requests.
+	FindingShadowedRoute FindingType = "shadowed_route"
+
+	// FindingAmbiguousRoutes is reported for routes with the same
+	// weight, that can match the same requests, where the winner
+	// depends on the order of the routes.
+	FindingAmbiguousRoutes FindingType = "ambiguous_routes"
+)
+
+// Finding is a problem found by Analyze.
+type Finding struct {
+	Type    FindingType
+	RouteID string
+
+	// Other is the ID of the route shadowing the route, or that
+	// the route is ambiguous with.
+	Other string
+
+	Message string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s: %s", f.RouteID, f.Type, f.Message)
+}
+
+// analyzedLeaf holds the conditions of a valid route in a comparable
+// form, and the path tree nodes that the route is added to.
+type analyzedLeaf struct {
+	leaf       *leafMatcher
+	nodes      []string
+	conditions []string
+}
+
+// Analyze checks route definitions against the filter registry, the
+// predicate specs and the matching options of o, and compares the
+// valid routes using the same weighting rules as the routing table. It
+// reports unknown filters and predicates, invalid arguments, routes
+// that are shadowed by routes with a higher weight, and routes with the
+// same weight, that match the same requests.
+//
+// Only the definitions are checked, the data clients and the
+// preprocessors of o are not used.
+func Analyze(o *Options, defs []*eskip.Route) []Finding {
+	var (
+		findings []Finding
+		leaves   []*analyzedLeaf
+	)
+
+	cpm := mapPredicates(o.Predicates)
+	compiledRxs := make(map[string]*regexp.Regexp)
+	for _, def := range defs {
+		f := analyzeDefinition(o, cpm, def)
+		if len(f) > 0 {
+			findings = append(findings, f...)
+			continue
+		}
+
+		l, err := analyzeLeaf(o, cpm, def, compiledRxs)
+		if err != nil {
+			findings = append(findings, Finding{Type: FindingInvalidRoute, RouteID: def.Id, Message: err.Error()})
+			continue
+		}
+
+		leaves = append(leaves, l)
+	}
+
+	return append(findings, analyzeMatching(leaves)...)
+}
+
+func findingOf(id string, err error) Finding {
+	t := FindingInvalidRoute
+	var defErr invalidDefinitionError
+	if errors.As(err, &defErr) {
+		t = FindingType(defErr.Code())
+	}
+
+	return Finding{Type: t, RouteID: id, Message: err.Error()}
+}
+
+// analyzeDefinition creates every filter and predicate of a route on
+// its own, to report all the problems and not only the first one.
+func analyzeDefinition(o *Options, cpm map[string]PredicateSpec, def *eskip.Route) []Finding {
+	var findings []Finding
+	for _, fd := range def.Filters {
+		f, err := createFilter(o, fd, cpm)
+		if err != nil {
+			findings = append(findings, findingOf(def.Id, err))
+			continue
+		}
+
+		if fc, ok := f.(filters.FilterCloser); ok {
+			fc.Close()
+		}
+	}
+
+	merged, err := mergeLegacyNonTreePredicates(def)
+	if err != nil {
+		return append(findings, findingOf(def.Id, fmt.Errorf("%w: %w", errInvalidPredicateParams, err)))
+	}
+
+	for _, p := range merged.Predicates {
+		if _, _, err := processPredicates(o, cpm, []*eskip.Predicate{p}); err != nil {
+			findings = append(findings, findingOf(def.Id, err))
+		}
+	}
+
+	return findings
+}
+
+// analyzeLeaf processes the route the same way as the routing table,
+// and returns the path tree nodes and the conditions of its leaf.
+func analyzeLeaf(o *Options, cpm map[string]PredicateSpec, def *eskip.Route, rxs map[string]*regexp.Regexp) (*analyzedLeaf, error) {
+	r, err := processRouteDef(o, cpm, def)
+	if err != nil {
+		return nil, err
+	}
+
+	closeFilters(r.Filters)
+
+	l, err := newLeaf(r, rxs)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := normalizePath(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// the nodes mirror how newMatcher adds the leaves to the path tree,
+	// the empty node stands for the root leaves
+	var nodes []string
+	switch {
+	case r.pathSubtree != "":
+		pms := make(map[string]*pathMatcher)
+		addSubtreeLeafsToPath(pms, path, l, o.MatchingOptions)
+		for p := range pms {
+			nodes = append(nodes, p)
+		}
+	case r.path == "":
+		nodes = []string{""}
+	default:
+		if o.MatchingOptions.ignoreTrailingSlash() {
+			path = trimTrailingSlash(path)
+		}
+
+		nodes = []string{path}
+	}
+
+	return &analyzedLeaf{leaf: l, nodes: nodes, conditions: leafConditions(l)}, nil
+}
+
+// leafConditions returns the conditions of a leaf, except for the path
+// and the weight, as sorted strings, that are equal for equal
+// conditions.
+func leafConditions(l *leafMatcher) []string {
+	var c []string
+	if l.method != "" {
+		c = append(c, "Method:"+l.method)
+	}
+
+	for _, rx := range l.hostRxs {
+		c = append(c, "Host:"+rx.String())
+	}
+
+	for _, rx := range l.pathRxs {
+		c = append(c, "PathRegexp:"+rx.String())
+	}
+
+	for k, v := range l.headersExact {
+		c = append(c, "Header:"+k+":"+v)
+	}
+
+	for k, rxs := range l.headersRegexp {
+		for _, rx := range rxs {
+			c = append(c, "HeaderRegexp:"+k+":"+rx.String())
+		}
+	}
+
+	for _, p := range l.route.Route.Predicates {
+		if isTreePredicate(p.Name) || p.Name == predicates.WeightName {
+			continue
+		}
+
+		c = append(c, p.String())
+	}
+
+	sort.Strings(c)
+	return c
+}
+
+// subset tells whether all the items of a are contained by b.
+func subset(a, b []string) bool {
+	for _, ai := range a {
+		if !slices.Contains(b, ai) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sharesNode(a, b *analyzedLeaf) bool {
+	for _, n := range a.nodes {
+		if slices.Contains(b.nodes, n) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// analyzeMatching compares the leaves sharing a path tree node. A
+// route is shadowed, when another route with a higher weight is
+// evaluated on all of its nodes, and all of its conditions are
+// contained by the conditions of the route. Two routes are ambiguous,
+// when they have the same weight, and the conditions of one of them
+// are contained by the conditions of the other.
+func analyzeMatching(leaves []*analyzedLeaf) []Finding {
+	var findings []Finding
+	for i, a := range leaves {
+		for j, b := range leaves {
+			if i == j || !sharesNode(a, b) {
+				continue
+			}
+
+			wa, wb := leafWeight(a.leaf), leafWeight(b.leaf)
+			switch {
+			case wa > wb && subset(b.nodes, a.nodes) && subset(a.conditions, b.conditions):
+				findings = append(findings, Finding{
+					Type:    FindingShadowedRoute,
+					RouteID: b.leaf.route.Id,
+					Other:   a.leaf.route.Id,
+					Message: fmt.Sprintf(
+						"shadowed by route %s with higher weight %d > %d",
+						a.leaf.route.Id,
+						wa,
+						wb,
+					),
+				})
+			case wa == wb && i < j && (subset(a.conditions, b.conditions) || subset(b.conditions, a.conditions)):
+				findings = append(findings, Finding{
+					Type:    FindingAmbiguousRoutes,
+					RouteID: b.leaf.route.Id,
+					Other:   a.leaf.route.Id,
+					Message: fmt.Sprintf(
+						"matches the same requests as route %s with the same weight %d, the winner depends on ordering",
+						a.leaf.route.Id,
+						wa,
+					),
+				})
+			}
+		}
+	}
+
+	return findings
+}
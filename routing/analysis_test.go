@@ -0,0 +1,123 @@
+package routing_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/predicates/query"
+	"github.com/zalando/skipper/predicates/traffic"
+	"github.com/zalando/skipper/routing"
+)
+
+func TestAnalyze(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		routes   string
+		expected []routing.Finding
+	}{{
+		name: "no problems",
+		routes: `
+			r1: Path("/foo") -> <shunt>;
+			r2: Path("/foo") && Method("POST") -> <shunt>;
+			r3: Path("/foo") && Traffic(0.5) -> <shunt>;
+			r4: Host("a.example.org") -> <shunt>;
+			r5: Host("b.example.org") -> <shunt>;
+		`,
+	}, {
+		name: "unknown filters and predicates",
+		routes: `
+			r1: Path("/foo") && Foo("bar") && Traffic(0.5) -> foo() -> setPath("/") -> bar() -> <shunt>;
+		`,
+		expected: []routing.Finding{
+			{Type: routing.FindingUnknownFilter, RouteID: "r1"},
+			{Type: routing.FindingUnknownFilter, RouteID: "r1"},
+			{Type: routing.FindingUnknownPredicate, RouteID: "r1"},
+		},
+	}, {
+		name: "invalid arguments",
+		routes: `
+			r1: Traffic("foo") -> setPath() -> <shunt>;
+			r2: QueryParam() -> status("foo") -> <shunt>;
+		`,
+		expected: []routing.Finding{
+			{Type: routing.FindingInvalidFilterParams, RouteID: "r1"},
+			{Type: routing.FindingInvalidPredicateParams, RouteID: "r1"},
+			{Type: routing.FindingInvalidFilterParams, RouteID: "r2"},
+			{Type: routing.FindingInvalidPredicateParams, RouteID: "r2"},
+		},
+	}, {
+		name: "invalid route",
+		routes: `
+			r1: PathRegexp("(") -> <shunt>;
+		`,
+		expected: []routing.Finding{
+			{Type: routing.FindingInvalidRoute, RouteID: "r1"},
+		},
+	}, {
+		name: "shadowed by weight",
+		routes: `
+			r1: Path("/foo") && Weight(10) -> <shunt>;
+			r2: Path("/foo") && Method("GET") -> <shunt>;
+			r3: Path("/bar") && Method("GET") -> <shunt>;
+		`,
+		expected: []routing.Finding{
+			{Type: routing.FindingShadowedRoute, RouteID: "r2", Other: "r1"},
+		},
+	}, {
+		name: "shadowed by subtree",
+		routes: `
+			r1: PathSubtree("/foo") && Weight(10) -> <shunt>;
+			r2: Path("/foo") && Header("X-Foo", "bar") -> <shunt>;
+			r3: Path("/foo/bar") -> <shunt>;
+		`,
+		expected: []routing.Finding{
+			{Type: routing.FindingShadowedRoute, RouteID: "r2", Other: "r1"},
+		},
+	}, {
+		name: "path does not shadow subtree",
+		routes: `
+			r1: Path("/foo") && Weight(10) -> <shunt>;
+			r2: PathSubtree("/foo") -> <shunt>;
+		`,
+	}, {
+		name: "duplicate priority",
+		routes: `
+			r1: Path("/foo") && Method("GET") -> <shunt>;
+			r2: Path("/foo") && Method("GET") -> <shunt>;
+			r3: Path("/foo") && Method("POST") -> <shunt>;
+		`,
+		expected: []routing.Finding{
+			{Type: routing.FindingAmbiguousRoutes, RouteID: "r2", Other: "r1"},
+		},
+	}, {
+		name: "ambiguous with weight",
+		routes: `
+			r1: Host("example.org") && Weight(1) -> <shunt>;
+			r2: Host("example.org") && Method("GET") -> <shunt>;
+		`,
+		expected: []routing.Finding{
+			{Type: routing.FindingAmbiguousRoutes, RouteID: "r2", Other: "r1"},
+		},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			routes, err := eskip.Parse(tc.routes)
+			require.NoError(t, err)
+
+			findings := routing.Analyze(&routing.Options{
+				FilterRegistry: builtin.MakeRegistry(),
+				Predicates:     []routing.PredicateSpec{traffic.New(), query.New()},
+			}, routes)
+
+			for i := range findings {
+				assert.NotEmpty(t, findings[i].Message)
+				findings[i].Message = ""
+			}
+
+			assert.Equal(t, tc.expected, findings)
+		})
+	}
+}
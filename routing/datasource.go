@@ -169,7 +169,7 @@ func mergeDefs(defsByClient map[DataClient]routeDefs) mergedDefs {
 //
 // The active set of routes from last successful update are used until the
 // next successful update.
-func receiveRouteDefs(o Options, quit <-chan struct{}) <-chan mergedDefs {
+func receiveRouteDefs(o Options, quit, refresh <-chan struct{}) <-chan mergedDefs {
 	in := make(chan *incomingData)
 	out := make(chan mergedDefs)
 	defsByClient := make(map[DataClient]routeDefs)
@@ -183,13 +183,21 @@ func receiveRouteDefs(o Options, quit <-chan struct{}) <-chan mergedDefs {
 			var incoming *incomingData
 			select {
 			case incoming = <-in:
+			case <-refresh:
+				if len(defsByClient) == 0 {
+					continue
+				}
+
+				o.Log.Info("refreshing routes")
 			case <-quit:
 				return
 			}
 
-			incoming.log(o.Log, o.SuppressLogs)
-			c := incoming.client
-			defsByClient[c] = applyIncoming(defsByClient[c], incoming)
+			if incoming != nil {
+				incoming.log(o.Log, o.SuppressLogs)
+				c := incoming.client
+				defsByClient[c] = applyIncoming(defsByClient[c], incoming)
+			}
 
 			select {
 			case out <- mergeDefs(defsByClient):
@@ -611,8 +619,8 @@ func closeFilters(rfs []*RouteFilter) {
 
 // receives the next version of the routing table on the output channel,
 // when an update is received on one of the data clients.
-func receiveRouteMatcher(o Options, out chan<- *routeTable, quit <-chan struct{}) {
-	updates := receiveRouteDefs(o, quit)
+func receiveRouteMatcher(o Options, out chan<- *routeTable, quit, refresh <-chan struct{}) {
+	updates := receiveRouteDefs(o, quit, refresh)
 	var (
 		rt           *routeTable
 		outRelay     chan<- *routeTable
@@ -27,10 +27,59 @@ type Metrics interface {
 
 	IncRequests(o IncRequestsOptions)
 	HealthCheckDropProbability() float64
+
+	Responses() ResponseStats
 }
 
 type IncRequestsOptions struct {
 	FailedRoundTrip bool
+
+	// StatusCode of the backend response, 0 when the round trip failed.
+	StatusCode int
+
+	// Duration of the round trip.
+	Duration time.Duration
+}
+
+// LatencyBuckets are the upper bounds of the buckets counting the
+// round trip durations in ResponseStats. Longer round trips are counted
+// in the last bucket.
+var LatencyBuckets = [...]time.Duration{
+	time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2 * time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
+}
+
+// ResponseStats are the cumulative counts of the round trips to an
+// endpoint, or of a route, since it was added to the registry.
+type ResponseStats struct {
+	Requests int64
+
+	// Errors counts the failed round trips and the responses with 5xx
+	// status codes.
+	Errors int64
+
+	// Latencies counts the round trips by their duration, in the
+	// buckets of LatencyBuckets.
+	Latencies [len(LatencyBuckets)]int64
+}
+
+type responseCounters struct {
+	responses atomic.Int64
+	errors    atomic.Int64
+	latencies [len(LatencyBuckets)]atomic.Int64
 }
 
 type entry struct {
@@ -42,6 +91,35 @@ type entry struct {
 	totalFailedRoundTrips      [2]atomic.Int64
 	curSlot                    atomic.Int64
 	healthCheckDropProbability atomic.Value // float64
+
+	responseCounters
+}
+
+func (c *responseCounters) inc(o IncRequestsOptions) {
+	c.responses.Add(1)
+	if o.FailedRoundTrip || o.StatusCode >= 500 {
+		c.errors.Add(1)
+	}
+
+	i := 0
+	for i < len(LatencyBuckets)-1 && o.Duration > LatencyBuckets[i] {
+		i++
+	}
+
+	c.latencies[i].Add(1)
+}
+
+func (c *responseCounters) stats() ResponseStats {
+	s := ResponseStats{
+		Requests: c.responses.Load(),
+		Errors:   c.errors.Load(),
+	}
+
+	for i := range c.latencies {
+		s.Latencies[i] = c.latencies[i].Load()
+	}
+
+	return s
 }
 
 var _ Metrics = &entry{}
@@ -80,12 +158,18 @@ func (e *entry) IncRequests(o IncRequestsOptions) {
 	if o.FailedRoundTrip {
 		e.totalFailedRoundTrips[curSlot].Add(1)
 	}
+
+	e.inc(o)
 }
 
 func (e *entry) HealthCheckDropProbability() float64 {
 	return e.healthCheckDropProbability.Load().(float64)
 }
 
+func (e *entry) Responses() ResponseStats {
+	return e.stats()
+}
+
 func newEntry() *entry {
 	result := &entry{}
 	result.healthCheckDropProbability.Store(0.0)
@@ -103,8 +187,9 @@ type EndpointRegistry struct {
 
 	quit chan struct{}
 
-	now  func() time.Time
-	data sync.Map // map[string]*entry
+	now    func() time.Time
+	data   sync.Map // map[string]*entry
+	routes sync.Map // map[string]*responseCounters
 }
 
 var _ PostProcessor = &EndpointRegistry{}
@@ -120,8 +205,10 @@ type RegistryOptions struct {
 
 func (r *EndpointRegistry) Do(routes []*Route) []*Route {
 	now := r.now()
+	ids := make(map[string]bool, len(routes))
 
 	for _, route := range routes {
+		ids[route.Id] = true
 		switch route.BackendType {
 		case eskip.LBBackend:
 			for i := range route.LBEndpoints {
@@ -152,6 +239,14 @@ func (r *EndpointRegistry) Do(routes []*Route) []*Route {
 		return true
 	})
 
+	r.routes.Range(func(key, _ any) bool {
+		if !ids[key.(string)] {
+			r.routes.Delete(key)
+		}
+
+		return true
+	})
+
 	return routes
 }
 
@@ -228,6 +323,26 @@ func (r *EndpointRegistry) GetMetrics(hostPort string) Metrics {
 	return e.(*entry)
 }
 
+// IncRouteResponses records a round trip of a route, when the responses
+// of the route are tracked.
+func (r *EndpointRegistry) IncRouteResponses(routeID string, o IncRequestsOptions) {
+	if c, ok := r.routes.Load(routeID); ok {
+		c.(*responseCounters).inc(o)
+	}
+}
+
+// RouteResponses returns the statistics of the round trips of a route.
+// The first call starts tracking the responses of the route, until it
+// is removed from the routing table, and it returns the zero value.
+func (r *EndpointRegistry) RouteResponses(routeID string) ResponseStats {
+	c, ok := r.routes.Load(routeID)
+	if !ok {
+		c, _ = r.routes.LoadOrStore(routeID, &responseCounters{})
+	}
+
+	return c.(*responseCounters).stats()
+}
+
 func (r *EndpointRegistry) allMetrics() map[string]Metrics {
 	result := make(map[string]Metrics)
 	r.data.Range(func(k, v any) bool {
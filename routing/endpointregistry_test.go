@@ -192,6 +192,43 @@ func TestMetricsMethodsDoNotAllocate(t *testing.T) {
 	assert.Equal(t, 0.0, allocs)
 }
 
+func TestResponses(t *testing.T) {
+	r := routing.NewEndpointRegistry(routing.RegistryOptions{})
+	defer r.Close()
+
+	metrics := r.GetMetrics("endpoint.test:80")
+	metrics.IncRequests(routing.IncRequestsOptions{StatusCode: 200, Duration: 3 * time.Millisecond})
+	metrics.IncRequests(routing.IncRequestsOptions{StatusCode: 503, Duration: time.Millisecond})
+	metrics.IncRequests(routing.IncRequestsOptions{FailedRoundTrip: true, Duration: time.Hour})
+	metrics.IncRequests(routing.IncRequestsOptions{StatusCode: 404, Duration: 5 * time.Millisecond})
+
+	var latencies [len(routing.LatencyBuckets)]int64
+	latencies[0] = 1
+	latencies[2] = 2
+	latencies[len(latencies)-1] = 1
+	assert.Equal(t, routing.ResponseStats{Requests: 4, Errors: 2, Latencies: latencies}, metrics.Responses())
+}
+
+func TestRouteResponses(t *testing.T) {
+	r := routing.NewEndpointRegistry(routing.RegistryOptions{})
+	defer r.Close()
+
+	// not tracked yet
+	r.IncRouteResponses("route1", routing.IncRequestsOptions{StatusCode: 200})
+	assert.Equal(t, routing.ResponseStats{}, r.RouteResponses("route1"))
+
+	r.IncRouteResponses("route1", routing.IncRequestsOptions{StatusCode: 500, Duration: time.Hour})
+	r.IncRouteResponses("route2", routing.IncRequestsOptions{StatusCode: 200})
+
+	var latencies [len(routing.LatencyBuckets)]int64
+	latencies[len(latencies)-1] = 1
+	assert.Equal(t, routing.ResponseStats{Requests: 1, Errors: 1, Latencies: latencies}, r.RouteResponses("route1"))
+
+	// the removed routes are not tracked anymore
+	r.Do([]*routing.Route{{Route: eskip.Route{Id: "route2"}}})
+	assert.Equal(t, routing.ResponseStats{}, r.RouteResponses("route1"))
+}
+
 func TestRaceReadWrite(t *testing.T) {
 	r := routing.NewEndpointRegistry(routing.RegistryOptions{})
 	defer r.Close()
@@ -172,6 +172,17 @@ type LBAlgorithm interface {
 	Apply(*LBContext) LBEndpoint
 }
 
+// LBEndpointSource provides the endpoints of load balanced routes
+// whose endpoints are discovered at runtime.
+type LBEndpointSource interface {
+
+	// Route returns a shallow copy of the route with the currently
+	// known endpoints and with the load balancing algorithm
+	// initialized for them. It returns nil when no endpoints are
+	// known.
+	Route() *Route
+}
+
 // LBContext is used to pass data to the load balancer to decide based
 // on that data which endpoint to call from the backends
 type LBContext struct {
@@ -223,6 +234,12 @@ type Route struct {
 	// of a load balanced route.
 	LBAlgorithm LBAlgorithm
 
+	// LBEndpointSource, when set, provides the current endpoints
+	// and load balancing algorithm of a load balanced route with
+	// discovered endpoints, taking precedence over LBEndpoints and
+	// LBAlgorithm.
+	LBEndpointSource LBEndpointSource
+
 	// LBFadeInDuration defines the duration of the fade-in
 	// function to be applied to new LB endpoints associated
 	// with this route.
@@ -258,6 +275,7 @@ type Routing struct {
 	firstLoad         chan struct{}
 	firstLoadSignaled bool
 	quit              chan struct{}
+	refresh           chan struct{}
 	metrics           metrics.Metrics
 }
 
@@ -281,7 +299,7 @@ func New(o Options) *Routing {
 		o.DataClients = slices.Collect(maps.Keys(uniqueClients))
 	}
 
-	r := &Routing{log: o.Log, firstLoad: make(chan struct{}), quit: make(chan struct{})}
+	r := &Routing{log: o.Log, firstLoad: make(chan struct{}), quit: make(chan struct{}), refresh: make(chan struct{}, 1)}
 	r.metrics = o.Metrics
 	if !o.SignalFirstLoad {
 		close(r.firstLoad)
@@ -408,7 +426,7 @@ func (r *Routing) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 func (r *Routing) startReceivingUpdates(o Options) {
 	c := make(chan *routeTable)
-	go receiveRouteMatcher(o, c, r.quit)
+	go receiveRouteMatcher(o, c, r.quit, r.refresh)
 	go func() {
 		for {
 			select {
@@ -481,6 +499,17 @@ func (r *Routing) Get() *RouteLookup {
 	return &RouteLookup{rt: rt}
 }
 
+// Refresh triggers the processing of the current route definitions
+// without waiting for an update from the data clients, e.g. after the
+// configuration of a pre-processor changed.
+func (r *Routing) Refresh() {
+	select {
+	case r.refresh <- struct{}{}:
+	default:
+		// a refresh is already pending
+	}
+}
+
 // Close closes routing, routeTable and stops statemachine for receiving routes.
 func (r *Routing) Close() {
 	close(r.quit)
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"sync/atomic"
 	"testing"
 	"testing/synctest"
 	"time"
@@ -222,6 +223,61 @@ func TestReceivesUpdate(t *testing.T) {
 	}
 }
 
+type pathPrefixPreProcessor struct {
+	prefix atomic.Value
+}
+
+func (p *pathPrefixPreProcessor) Do(routes []*eskip.Route) []*eskip.Route {
+	prefix, _ := p.prefix.Load().(string)
+	result := make([]*eskip.Route, len(routes))
+	for i, r := range routes {
+		rr := *r
+		rr.Path = prefix + r.Path
+		result[i] = &rr
+	}
+
+	return result
+}
+
+func TestRefreshAppliesPreProcessors(t *testing.T) {
+	dc := testdataclient.New([]*eskip.Route{{Id: "route1", Path: "/some-path", Backend: "https://www.example.org"}})
+	defer dc.Close()
+
+	pp := &pathPrefixPreProcessor{}
+	pp.prefix.Store("/v1")
+
+	tl := loggingtest.New()
+	rt := routing.New(routing.Options{
+		FilterRegistry: builtin.MakeRegistry(),
+		PreProcessors:  []routing.PreProcessor{pp},
+		DataClients:    []routing.DataClient{dc},
+		PollTimeout:    pollTimeout,
+		Log:            tl,
+	})
+	tr := &testRouting{tl, rt}
+	defer tr.close()
+
+	if err := tr.waitForRouteSetting(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tr.checkGetRequest("https://www.example.com/v1/some-path"); err != nil {
+		t.Fatal(err)
+	}
+
+	tr.log.Reset()
+	pp.prefix.Store("/v2")
+	rt.Refresh()
+
+	if err := tr.waitForRouteSetting(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tr.checkGetRequest("https://www.example.com/v2/some-path"); err != nil {
+		t.Error(err)
+	}
+}
+
 func TestReceivesDelete(t *testing.T) {
 	dc := testdataclient.New([]*eskip.Route{
 		{Id: "route1", Path: "/some-path", Backend: "https://www.example.org"},
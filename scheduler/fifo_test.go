@@ -83,4 +83,59 @@ func TestFifo(t *testing.T) {
 		fq.close()
 	})
 
+	t.Run("set max concurrency", func(t *testing.T) {
+		fq := NewFifoQueue(Config{
+			MaxConcurrency: 3,
+			MaxQueueSize:   3,
+			Timeout:        20 * time.Millisecond,
+		})
+		ctx := context.Background()
+
+		var done []func()
+		for range 3 {
+			f, err := fq.Wait(ctx)
+			if err != nil {
+				t.Fatalf("Failed to call wait: %v", err)
+			}
+			done = append(done, f)
+		}
+
+		fq.SetMaxConcurrency(1)
+		if fq.MaxConcurrency() != 1 {
+			t.Fatalf("Failed to set max concurrency, got: %d", fq.MaxConcurrency())
+		}
+
+		// the finishing requests keep their permits for the lowered limit
+		done[0]()
+		done[1]()
+		if _, err := fq.Wait(ctx); err != ErrQueueTimeout {
+			t.Fatalf("Failed to get ErrQueueTimeout: %v", err)
+		}
+
+		done[2]()
+		f, err := fq.Wait(ctx)
+		if err != nil {
+			t.Fatalf("Failed to call wait: %v", err)
+		}
+		if _, err := fq.Wait(ctx); err != ErrQueueTimeout {
+			t.Fatalf("Failed to get ErrQueueTimeout: %v", err)
+		}
+
+		fq.SetMaxConcurrency(10)
+		if fq.MaxConcurrency() != 3 {
+			t.Fatalf("Failed to limit max concurrency to the configuration, got: %d", fq.MaxConcurrency())
+		}
+
+		for range 2 {
+			if _, err := fq.Wait(ctx); err != nil {
+				t.Fatalf("Failed to call wait after raising the limit: %v", err)
+			}
+		}
+		f()
+
+		fq.SetMaxConcurrency(0)
+		if fq.MaxConcurrency() != 1 {
+			t.Fatalf("Failed to limit max concurrency to 1, got: %d", fq.MaxConcurrency())
+		}
+	})
 }
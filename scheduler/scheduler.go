@@ -94,6 +94,7 @@ type FifoQueue struct {
 	errorOtherMetricsKey     string
 	errorTimeoutMetricsKey   string
 	queuedRequestsMetricsKey string
+	limitMetricsKey          string
 }
 
 type fifoQueue struct {
@@ -104,6 +105,13 @@ type fifoQueue struct {
 	maxQueueSize   int64
 	maxConcurrency int64
 	closed         bool
+
+	// capacity is the configured maximum concurrency, the size of the
+	// semaphore. The current maxConcurrency may be lower, then the
+	// difference is held from the semaphore, or is pending to be held
+	// when the active requests finish.
+	capacity int64
+	pending  *atomic.Int64
 }
 
 func (fq *fifoQueue) status() QueueStatus {
@@ -140,10 +148,52 @@ func (fq *fifoQueue) reconfigure(c Config) {
 	fq.mu.Lock()
 	defer fq.mu.Unlock()
 	fq.maxConcurrency = int64(c.MaxConcurrency)
+	fq.capacity = int64(c.MaxConcurrency)
 	fq.maxQueueSize = int64(c.MaxQueueSize)
 	fq.timeout = c.Timeout
 	fq.sem = semaphore.NewWeighted(int64(c.MaxConcurrency))
 	fq.counter = new(atomic.Int64)
+	fq.pending = new(atomic.Int64)
+}
+
+// setMaxConcurrency changes the current concurrency limit between 1 and
+// the capacity. Lowering the limit holds permits of the semaphore, or,
+// when they are in use, takes them over from the finishing requests.
+func (fq *fifoQueue) setMaxConcurrency(n int64) {
+	fq.mu.Lock()
+	defer fq.mu.Unlock()
+
+	n = max(1, min(n, fq.capacity))
+	delta := n - fq.maxConcurrency
+	fq.maxConcurrency = n
+
+	for ; delta < 0; delta++ {
+		if !fq.sem.TryAcquire(1) {
+			fq.pending.Add(1)
+		}
+	}
+
+	// cancel the pending permits first, and release the rest
+	for delta > 0 {
+		p := fq.pending.Load()
+		if p == 0 {
+			break
+		}
+
+		if fq.pending.CompareAndSwap(p, p-1) {
+			delta--
+		}
+	}
+
+	if delta > 0 {
+		fq.sem.Release(delta)
+	}
+}
+
+func (fq *fifoQueue) getMaxConcurrency() int64 {
+	fq.mu.RLock()
+	defer fq.mu.RUnlock()
+	return fq.maxConcurrency
 }
 
 func (fq *fifoQueue) wait(ctx context.Context) (func(), error) {
@@ -153,6 +203,7 @@ func (fq *fifoQueue) wait(ctx context.Context) (func(), error) {
 	timeout := fq.timeout
 	sem := fq.sem
 	cnt := fq.counter
+	pending := fq.pending
 	fq.mu.RUnlock()
 
 	// check request context expired
@@ -198,6 +249,12 @@ func (fq *fifoQueue) wait(ctx context.Context) (func(), error) {
 	return func() {
 		// postpone release to Response() filter
 		cnt.Add(-1)
+
+		// keep the permit when the limit was lowered
+		if p := pending.Load(); p > 0 && pending.CompareAndSwap(p, p-1) {
+			return
+		}
+
 		sem.Release(1)
 	}, nil
 
@@ -335,6 +392,19 @@ func (fq *FifoQueue) Reconfigure(c Config) {
 	fq.queue.reconfigure(c)
 }
 
+// SetMaxConcurrency changes the maximum concurrency of the queue
+// between 1 and the MaxConcurrency of its configuration, without
+// resetting its state. The requests being processed are not affected
+// when the limit is lowered.
+func (fq *FifoQueue) SetMaxConcurrency(n int) {
+	fq.queue.setMaxConcurrency(int64(n))
+}
+
+// MaxConcurrency returns the current maximum concurrency of the queue.
+func (fq *FifoQueue) MaxConcurrency() int {
+	return int(fq.queue.getMaxConcurrency())
+}
+
 func (fq *FifoQueue) close() {
 	fq.queue.close()
 }
@@ -423,8 +493,11 @@ func (r *Registry) getFifoQueue(id queueId, c Config) *FifoQueue {
 	return fq
 }
 
-func (r *Registry) newFifoQueue(name string, c Config) *FifoQueue {
-	q := &FifoQueue{
+// NewFifoQueue creates a FIFO queue, that is not maintained by a
+// registry, e.g. for filters that need a queue per request key.
+// Its metrics are not collected.
+func NewFifoQueue(c Config) *FifoQueue {
+	return &FifoQueue{
 		config: c,
 		queue: &fifoQueue{
 			counter:        new(atomic.Int64),
@@ -432,8 +505,14 @@ func (r *Registry) newFifoQueue(name string, c Config) *FifoQueue {
 			maxConcurrency: int64(c.MaxConcurrency),
 			maxQueueSize:   int64(c.MaxQueueSize),
 			timeout:        c.Timeout,
+			capacity:       int64(c.MaxConcurrency),
+			pending:        new(atomic.Int64),
 		},
 	}
+}
+
+func (r *Registry) newFifoQueue(name string, c Config) *FifoQueue {
+	q := NewFifoQueue(c)
 
 	if r.options.EnableRouteFIFOMetrics {
 		if name == "" {
@@ -445,6 +524,7 @@ func (r *Registry) newFifoQueue(name string, c Config) *FifoQueue {
 		q.errorFullMetricsKey = fmt.Sprintf("fifo.%s.error.full", name)
 		q.errorOtherMetricsKey = fmt.Sprintf("fifo.%s.error.other", name)
 		q.errorTimeoutMetricsKey = fmt.Sprintf("fifo.%s.error.timeout", name)
+		q.limitMetricsKey = fmt.Sprintf("fifo.%s.limit", name)
 		q.metrics = r.options.Metrics
 		r.measure()
 	}
@@ -533,7 +613,9 @@ func (r *Registry) deleteUnused(inUse map[queueId]struct{}) {
 	}
 }
 
-// PreProcessor returns routing.PreProcessor that ensures single lifo filter instance per route
+// PreProcessor returns routing.PreProcessor that ensures single lifo filter instance per route,
+// and single fifo or adaptiveConcurrency filter instance per route, because they use the same
+// queue of the route.
 //
 // Registry cannot implement routing.PreProcessor directly due to unfortunate method name clash with routing.PostProcessor
 func (r *Registry) PreProcessor() routing.PreProcessor {
@@ -542,46 +624,46 @@ func (r *Registry) PreProcessor() routing.PreProcessor {
 
 type registryPreProcessor struct{}
 
+func isFifoFilter(name string) bool {
+	return name == filters.FifoName || name == filters.AdaptiveConcurrencyName
+}
+
+func isLifoFilter(name string) bool {
+	return name == filters.LifoName
+}
+
 func (registryPreProcessor) Do(routes []*eskip.Route) []*eskip.Route {
 	for _, r := range routes {
-		lifoCount := 0
-		fifoCount := 0
-		for _, f := range r.Filters {
-			switch f.Name {
-			case filters.FifoName:
-				fifoCount++
-			case filters.LifoName:
-				lifoCount++
-			}
-		}
-		// remove all but last fifo instances
-		if fifoCount > 1 {
-			old := r.Filters
-			r.Filters = make([]*eskip.Filter, 0, len(old)-fifoCount+1)
-			for _, f := range old {
-				if fifoCount > 1 && f.Name == filters.FifoName {
-					log.Debugf("Removing non-last %v from %s", f, r.Id)
-					fifoCount--
-				} else {
-					r.Filters = append(r.Filters, f)
-				}
-			}
+		removeAllButLast(r, isFifoFilter)
+		removeAllButLast(r, isLifoFilter)
+	}
+	return routes
+}
+
+// removeAllButLast removes all but the last of the matching filters of the
+// route.
+func removeAllButLast(r *eskip.Route, match func(string) bool) {
+	count := 0
+	for _, f := range r.Filters {
+		if match(f.Name) {
+			count++
 		}
-		// remove all but last lifo instances
-		if lifoCount > 1 {
-			old := r.Filters
-			r.Filters = make([]*eskip.Filter, 0, len(old)-lifoCount+1)
-			for _, f := range old {
-				if lifoCount > 1 && f.Name == filters.LifoName {
-					log.Debugf("Removing non-last %v from %s", f, r.Id)
-					lifoCount--
-				} else {
-					r.Filters = append(r.Filters, f)
-				}
-			}
+	}
+
+	if count <= 1 {
+		return
+	}
+
+	old := r.Filters
+	r.Filters = make([]*eskip.Filter, 0, len(old)-count+1)
+	for _, f := range old {
+		if count > 1 && match(f.Name) {
+			log.Debugf("Removing non-last %v from %s", f, r.Id)
+			count--
+		} else {
+			r.Filters = append(r.Filters, f)
 		}
 	}
-	return routes
 }
 
 // Do implements routing.PostProcessor and sets the queue for the scheduler filters.
@@ -686,6 +768,7 @@ func (r *Registry) updateMetrics() {
 		s := q.Status()
 		r.options.Metrics.UpdateGauge(q.activeRequestsMetricsKey, float64(s.ActiveRequests))
 		r.options.Metrics.UpdateGauge(q.queuedRequestsMetricsKey, float64(s.QueuedRequests))
+		r.options.Metrics.UpdateGauge(q.limitMetricsKey, float64(q.MaxConcurrency()))
 	}
 
 	for _, q := range r.lifoQueues {
@@ -690,6 +690,16 @@ func TestRegistryPreProcessor(t *testing.T) {
 			input:  `* -> fifo(2, 2, "3s") -> fifo(20, 2, "3s") -> setPath("/foo") -> <shunt>`,
 			expect: `* -> fifo(20, 2, "3s") -> setPath("/foo") -> <shunt>`,
 		},
+		{
+			name:   "fifo and adaptiveConcurrency",
+			input:  `* -> fifo(1, 2, "3s") -> adaptiveConcurrency("vegas", 5) -> setPath("/foo") -> <shunt>`,
+			expect: `* -> adaptiveConcurrency("vegas", 5) -> setPath("/foo") -> <shunt>`,
+		},
+		{
+			name:   "adaptiveConcurrency and fifo",
+			input:  `* -> adaptiveConcurrency() -> lifo() -> fifo(1, 2, "3s") -> setPath("/foo") -> <shunt>`,
+			expect: `* -> lifo() -> fifo(1, 2, "3s") -> setPath("/foo") -> <shunt>`,
+		},
 		{
 			name:   "three lifos",
 			input:  `* -> lifo(777) -> setPath("/foo") -> lifo(999) -> lifo() -> setPath("/bar") -> <shunt>`,
@@ -0,0 +1,898 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp/syntax"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/time/rate"
+
+	"github.com/zalando/skipper/routing"
+)
+
+const (
+	// ChallengeTLSALPN01 answers the challenges of the ACME server on
+	// the TLS listener.
+	ChallengeTLSALPN01 = "tls-alpn-01"
+
+	// ChallengeHTTP01 answers the challenges of the ACME server on the
+	// proxy listener, under /.well-known/acme-challenge/.
+	ChallengeHTTP01 = "http-01"
+
+	// ALPNProto is the protocol of the tls-alpn-01 challenge. The TLS
+	// configs using the Manager need to list it in NextProtos.
+	ALPNProto = acme.ALPNProto
+
+	// DefaultDirectoryURL is the directory of the Let's Encrypt
+	// production environment.
+	DefaultDirectoryURL = acme.LetsEncryptURL
+
+	// DefaultRenewBefore is used when Options.RenewBefore is not set.
+	DefaultRenewBefore = 30 * 24 * time.Hour
+
+	// DefaultCheckInterval is used when Options.CheckInterval is not
+	// set.
+	DefaultCheckInterval = time.Hour
+
+	// DefaultOrderTimeout is used when Options.OrderTimeout is not set.
+	DefaultOrderTimeout = 2 * time.Minute
+
+	// DefaultRetryAfter is used when Options.RetryAfter is not set.
+	DefaultRetryAfter = time.Minute
+
+	http01Path = "/.well-known/acme-challenge/"
+
+	accountKey         = "account-key"
+	certKeyPrefix      = "cert-"
+	http01KeyPrefix    = "http-01-"
+	tlsALPN01KeyPrefix = "tls-alpn-01-"
+
+	// limits the number of the hostnames derived from a single Host
+	// predicate
+	maxHostsPerPattern = 64
+
+	// the challenges provisioned by other replicas are looked up in the
+	// store on unauthenticated requests, so the lookups are limited,
+	// and the missing challenges are not looked up again for a while
+	challengeLookupRate = 10
+	missedChallengeTTL  = time.Second
+)
+
+// Options contains the settings of the Manager.
+type Options struct {
+	// DirectoryURL is the directory of the ACME server. Defaults to
+	// Let's Encrypt.
+	DirectoryURL string
+
+	// Email is the contact address of the ACME account.
+	Email string
+
+	// Store persists the account key, the certificates and the
+	// challenge responses. Required.
+	Store Store
+
+	// Challenge selects the challenge type, tls-alpn-01 or http-01.
+	// Defaults to tls-alpn-01.
+	Challenge string
+
+	// RenewBefore sets how long before their expiry the certificates
+	// are renewed.
+	RenewBefore time.Duration
+
+	// CheckInterval sets how often the certificates are checked for
+	// renewal.
+	CheckInterval time.Duration
+
+	// OrderTimeout limits the duration of obtaining a certificate.
+	OrderTimeout time.Duration
+
+	// RetryAfter sets how long the Manager waits after a failed order
+	// before ordering a certificate for the same host again.
+	RetryAfter time.Duration
+
+	// HTTPClient is used for the requests to the ACME server, e.g. to
+	// trust the CA of a local test server.
+	HTTPClient *http.Client
+}
+
+// Manager obtains and renews certificates from an ACME server for the
+// hostnames used in the Host predicates of the routes. It implements
+// routing.PostProcessor to learn these hostnames.
+//
+// Only the hostnames that can be derived from the Host predicates as
+// literal names are allowed, e.g. Host("^www[.]example[.]org$") allows
+// www.example.org, while Host(/[.]example[.]org$/) allows no hostname.
+//
+// The certificates are obtained on the first TLS handshake of their
+// hostname, and kept in the Store. When multiple replicas share the
+// Store, only one of them orders the certificate of a hostname at a
+// time, and the others use the stored one. The challenges of the orders
+// of the other replicas are looked up in the Store at most 10 times per
+// second, and a missing challenge is not looked up again for a second.
+type Manager struct {
+	options Options
+	now     func() time.Time
+
+	clientMu sync.Mutex
+	client   *acme.Client
+
+	mu       sync.Mutex
+	allowed  map[string]struct{}
+	certs    map[string]*tls.Certificate
+	pending  map[string]*order
+	failed   map[string]time.Time
+	http01   map[string][]byte
+	tlsALPN  map[string]*tls.Certificate
+	missed   map[string]time.Time
+	lookups  *rate.Limiter
+	quit     chan struct{}
+	once     sync.Once
+	checking sync.WaitGroup
+}
+
+type order struct {
+	done chan struct{}
+	cert *tls.Certificate
+	err  error
+}
+
+var _ routing.PostProcessor = (*Manager)(nil)
+
+// New creates a Manager, and starts checking the certificates for
+// renewal. Close stops it.
+func New(o Options) (*Manager, error) {
+	if o.Store == nil {
+		return nil, errors.New("ACME store is required")
+	}
+
+	if o.DirectoryURL == "" {
+		o.DirectoryURL = DefaultDirectoryURL
+	}
+
+	switch o.Challenge {
+	case "":
+		o.Challenge = ChallengeTLSALPN01
+	case ChallengeTLSALPN01, ChallengeHTTP01:
+	default:
+		return nil, fmt.Errorf("unsupported ACME challenge type: %s", o.Challenge)
+	}
+
+	if o.RenewBefore <= 0 {
+		o.RenewBefore = DefaultRenewBefore
+	}
+
+	if o.CheckInterval <= 0 {
+		o.CheckInterval = DefaultCheckInterval
+	}
+
+	if o.OrderTimeout <= 0 {
+		o.OrderTimeout = DefaultOrderTimeout
+	}
+
+	if o.RetryAfter <= 0 {
+		o.RetryAfter = DefaultRetryAfter
+	}
+
+	m := &Manager{
+		options: o,
+		now:     time.Now,
+		allowed: make(map[string]struct{}),
+		certs:   make(map[string]*tls.Certificate),
+		pending: make(map[string]*order),
+		failed:  make(map[string]time.Time),
+		http01:  make(map[string][]byte),
+		tlsALPN: make(map[string]*tls.Certificate),
+		missed:  make(map[string]time.Time),
+		lookups: rate.NewLimiter(challengeLookupRate, challengeLookupRate),
+		quit:    make(chan struct{}),
+	}
+
+	m.checking.Add(1)
+	go m.checkRenewals()
+	return m, nil
+}
+
+// Close stops checking the certificates for renewal.
+func (m *Manager) Close() {
+	m.once.Do(func() {
+		close(m.quit)
+		m.checking.Wait()
+	})
+}
+
+// Do collects the allowed hostnames from the Host predicates of the
+// routes. It doesn't change the routes.
+func (m *Manager) Do(routes []*routing.Route) []*routing.Route {
+	allowed := make(map[string]struct{})
+	for _, r := range routes {
+		for _, rx := range r.HostRegexps {
+			for _, h := range literalHosts(rx) {
+				allowed[h] = struct{}{}
+			}
+		}
+	}
+
+	m.mu.Lock()
+	m.allowed = allowed
+	m.mu.Unlock()
+
+	return routes
+}
+
+// literalHosts returns the hostnames matching the pattern, when the
+// pattern matches only a finite number of hostnames. The optional
+// parts, e.g. the port, are omitted.
+func literalHosts(pattern string) []string {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil
+	}
+
+	names, ok := expand(re.Simplify())
+	if !ok {
+		return nil
+	}
+
+	var hosts []string
+	for _, n := range names {
+		n = strings.TrimSuffix(strings.ToLower(n), ".")
+		if validHost(n) && !slices.Contains(hosts, n) {
+			hosts = append(hosts, n)
+		}
+	}
+
+	return hosts
+}
+
+// expand returns strings matched by the expression. For the optional
+// and repeated parts, only the empty match is used, and it fails, when
+// the matched strings are not enumerable.
+func expand(re *syntax.Regexp) ([]string, bool) {
+	switch re.Op {
+	case syntax.OpEmptyMatch, syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText:
+		return []string{""}, true
+	case syntax.OpLiteral:
+		return []string{string(re.Rune)}, true
+	case syntax.OpCharClass:
+		// e.g. [.]
+		if len(re.Rune) == 2 && re.Rune[0] == re.Rune[1] {
+			return []string{string(re.Rune[0])}, true
+		}
+
+		return nil, false
+	case syntax.OpCapture:
+		return expand(re.Sub[0])
+	case syntax.OpQuest, syntax.OpStar:
+		return []string{""}, true
+	case syntax.OpConcat:
+		result := []string{""}
+		for _, sub := range re.Sub {
+			s, ok := expand(sub)
+			if !ok || len(result)*len(s) > maxHostsPerPattern {
+				return nil, false
+			}
+
+			var next []string
+			for _, prefix := range result {
+				for _, suffix := range s {
+					next = append(next, prefix+suffix)
+				}
+			}
+
+			result = next
+		}
+
+		return result, true
+	case syntax.OpAlternate:
+		var result []string
+		for _, sub := range re.Sub {
+			s, ok := expand(sub)
+			if !ok || len(result)+len(s) > maxHostsPerPattern {
+				return nil, false
+			}
+
+			result = append(result, s...)
+		}
+
+		return result, true
+	default:
+		return nil, false
+	}
+}
+
+// validHost accepts the fully qualified DNS names.
+func validHost(h string) bool {
+	if len(h) > 253 || !strings.Contains(h, ".") {
+		return false
+	}
+
+	for _, label := range strings.Split(h, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+
+		for _, c := range label {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+				return false
+			}
+		}
+	}
+
+	// IP addresses are not supported
+	last := h[strings.LastIndexByte(h, '.')+1:]
+	return strings.IndexFunc(last, func(c rune) bool { return c < '0' || c > '9' }) >= 0
+}
+
+func (m *Manager) isAllowed(host string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.allowed[host]
+	return ok
+}
+
+// WrapGetCertificate returns a function that can be used as
+// [tls.Config.GetCertificate]. It answers the tls-alpn-01 challenges,
+// and otherwise it returns the certificate of next, then, when one of
+// the static certificates supports the client, nothing, so that the
+// static certificate is used, and finally the certificate of the
+// Manager.
+//
+// The config using it needs to list ALPNProto in NextProtos.
+func (m *Manager) WrapGetCertificate(next func(*tls.ClientHelloInfo) (*tls.Certificate, error), static []tls.Certificate) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == acme.ALPNProto {
+			return m.challengeCert(helloContext(hello), hello.ServerName)
+		}
+
+		if next != nil {
+			if cert, err := next(hello); cert != nil || err != nil {
+				return cert, err
+			}
+		}
+
+		for i := range static {
+			if hello.SupportsCertificate(&static[i]) == nil {
+				return nil, nil
+			}
+		}
+
+		return m.GetCertificate(hello)
+	}
+}
+
+// GetCertificate returns the certificate of the hostname of the TLS
+// handshake. When the Manager doesn't have a certificate yet, it
+// obtains one, blocking the handshake. For the hostnames that are not
+// allowed, it returns nothing.
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	host := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	if !m.isAllowed(host) {
+		return nil, nil
+	}
+
+	m.mu.Lock()
+	cert, ok := m.certs[host]
+	m.mu.Unlock()
+	if ok && m.now().Before(cert.Leaf.NotAfter) {
+		return cert, nil
+	}
+
+	return m.obtain(helloContext(hello), host, false)
+}
+
+func helloContext(hello *tls.ClientHelloInfo) context.Context {
+	if ctx := hello.Context(); ctx != nil {
+		return ctx
+	}
+
+	return context.Background()
+}
+
+// obtain returns the certificate of the host, or, when it's missing
+// or due for renewal, orders a new one. Concurrent calls for the same
+// host wait for the same order.
+func (m *Manager) obtain(ctx context.Context, host string, renew bool) (*tls.Certificate, error) {
+	m.mu.Lock()
+	if o, ok := m.pending[host]; ok {
+		m.mu.Unlock()
+		select {
+		case <-o.done:
+			return o.cert, o.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if t, ok := m.failed[host]; ok && m.now().Before(t.Add(m.options.RetryAfter)) {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("ACME order for %s failed recently, retrying after %v", host, t.Add(m.options.RetryAfter))
+	}
+
+	o := &order{done: make(chan struct{})}
+	m.pending[host] = o
+	m.mu.Unlock()
+
+	// the order continues when the handshake was canceled, so that the
+	// next handshake finds the certificate
+	orderCtx, cancel := context.WithTimeout(context.Background(), m.options.OrderTimeout)
+	defer cancel()
+
+	o.cert, o.err = m.load(orderCtx, host, renew)
+
+	m.mu.Lock()
+	delete(m.pending, host)
+	if o.err == nil {
+		m.certs[host] = o.cert
+		delete(m.failed, host)
+	} else {
+		m.failed[host] = m.now()
+	}
+	m.mu.Unlock()
+
+	close(o.done)
+	return o.cert, o.err
+}
+
+// load returns the stored certificate of the host, or orders a new
+// one, while holding the lock of the host.
+func (m *Manager) load(ctx context.Context, host string, renew bool) (*tls.Certificate, error) {
+	cert, err := m.stored(ctx, host)
+	if err == nil && !m.dueForRenewal(cert) {
+		return cert, nil
+	}
+
+	unlock, err := m.options.Store.Lock(ctx, certKeyPrefix+host)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// another replica may have obtained it meanwhile
+	cert, err = m.stored(ctx, host)
+	if err == nil && !m.dueForRenewal(cert) {
+		return cert, nil
+	}
+
+	if renew {
+		log.Infof("Renewing ACME certificate for %s", host)
+	} else {
+		log.Infof("Obtaining ACME certificate for %s", host)
+	}
+
+	data, err := m.order(ctx, host)
+	if err != nil {
+		log.Errorf("Failed to obtain ACME certificate for %s: %v", host, err)
+		return nil, err
+	}
+
+	cert, err = parseCertificate(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.options.Store.Put(ctx, certKeyPrefix+host, data); err != nil {
+		log.Errorf("Failed to store ACME certificate for %s: %v", host, err)
+	}
+
+	return cert, nil
+}
+
+func (m *Manager) stored(ctx context.Context, host string) (*tls.Certificate, error) {
+	data, err := m.options.Store.Get(ctx, certKeyPrefix+host)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := parseCertificate(data)
+	if err != nil {
+		log.Errorf("Invalid ACME certificate stored for %s: %v", host, err)
+		return nil, err
+	}
+
+	return cert, nil
+}
+
+func (m *Manager) dueForRenewal(cert *tls.Certificate) bool {
+	return !m.now().Before(cert.Leaf.NotAfter.Add(-m.options.RenewBefore))
+}
+
+// parseCertificate parses the PEM encoded private key and certificate
+// chain.
+func parseCertificate(data []byte) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cert, nil
+}
+
+func (m *Manager) acmeClient(ctx context.Context) (*acme.Client, error) {
+	m.clientMu.Lock()
+	defer m.clientMu.Unlock()
+
+	if m.client != nil {
+		return m.client, nil
+	}
+
+	key, err := m.accountKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &acme.Client{
+		Key:          key,
+		DirectoryURL: m.options.DirectoryURL,
+		HTTPClient:   m.options.HTTPClient,
+		UserAgent:    "skipper",
+	}
+
+	account := &acme.Account{}
+	if m.options.Email != "" {
+		account.Contact = []string{"mailto:" + m.options.Email}
+	}
+
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, fmt.Errorf("failed to register ACME account: %w", err)
+	}
+
+	m.client = client
+	return client, nil
+}
+
+// accountKey loads the account key from the store, or creates it,
+// while holding the lock of the account, so that the replicas share
+// the same account.
+func (m *Manager) accountKey(ctx context.Context) (*ecdsa.PrivateKey, error) {
+	data, err := m.options.Store.Get(ctx, accountKey)
+	if errors.Is(err, ErrNotFound) {
+		var unlock func()
+		unlock, err = m.options.Store.Lock(ctx, accountKey)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+
+		data, err = m.options.Store.Get(ctx, accountKey)
+		if errors.Is(err, ErrNotFound) {
+			return m.newAccountKey(ctx)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "EC PRIVATE KEY" {
+		return nil, errors.New("invalid ACME account key in store")
+	}
+
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+func (m *Manager) newAccountKey(ctx context.Context) (*ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	if err := m.options.Store.Put(ctx, accountKey, data); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// order obtains a certificate for the host, and returns the PEM
+// encoded private key and certificate chain.
+func (m *Manager) order(ctx context.Context, host string) ([]byte, error) {
+	client, err := m.acmeClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	o, err := client.AuthorizeOrder(ctx, acme.DomainIDs(host))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range o.AuthzURLs {
+		if err := m.authorize(ctx, client, host, u); err != nil {
+			return nil, err
+		}
+	}
+
+	o, err = client.WaitOrder(ctx, o.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: host},
+		DNSNames: []string{host},
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, _, err := client.CreateOrderCert(ctx, o.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	for _, c := range chain {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c})...)
+	}
+
+	return data, nil
+}
+
+func (m *Manager) authorize(ctx context.Context, client *acme.Client, host, authzURL string) error {
+	z, err := client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return err
+	}
+
+	if z.Status != acme.StatusPending {
+		return nil
+	}
+
+	var chal *acme.Challenge
+	for _, c := range z.Challenges {
+		if c.Type == m.options.Challenge {
+			chal = c
+			break
+		}
+	}
+
+	if chal == nil {
+		return fmt.Errorf("ACME server offers no %s challenge for %s", m.options.Challenge, host)
+	}
+
+	cleanup, err := m.provision(ctx, client, host, chal)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if _, err := client.Accept(ctx, chal); err != nil {
+		return err
+	}
+
+	_, err = client.WaitAuthorization(ctx, z.URI)
+	return err
+}
+
+// provision prepares the response of the challenge, and stores it, so
+// that any replica can answer the challenge.
+func (m *Manager) provision(ctx context.Context, client *acme.Client, host string, chal *acme.Challenge) (func(), error) {
+	var key string
+	switch chal.Type {
+	case ChallengeHTTP01:
+		rsp, err := client.HTTP01ChallengeResponse(chal.Token)
+		if err != nil {
+			return nil, err
+		}
+
+		key = http01KeyPrefix + chal.Token
+		if err := m.options.Store.Put(ctx, key, []byte(rsp)); err != nil {
+			return nil, err
+		}
+
+		m.mu.Lock()
+		m.http01[chal.Token] = []byte(rsp)
+		m.mu.Unlock()
+	default:
+		cert, err := client.TLSALPN01ChallengeCert(chal.Token, host)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := encodeCertificate(cert)
+		if err != nil {
+			return nil, err
+		}
+
+		key = tlsALPN01KeyPrefix + host
+		if err := m.options.Store.Put(ctx, key, data); err != nil {
+			return nil, err
+		}
+
+		m.mu.Lock()
+		m.tlsALPN[host] = &cert
+		m.mu.Unlock()
+	}
+
+	return func() {
+		m.mu.Lock()
+		delete(m.http01, chal.Token)
+		delete(m.tlsALPN, host)
+		m.mu.Unlock()
+
+		if err := m.options.Store.Delete(context.Background(), key); err != nil {
+			log.Errorf("Failed to delete ACME challenge %s from store: %v", key, err)
+		}
+	}, nil
+}
+
+func encodeCertificate(cert tls.Certificate) ([]byte, error) {
+	key, ok := cert.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("unsupported challenge certificate key")
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	for _, c := range cert.Certificate {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c})...)
+	}
+
+	return data, nil
+}
+
+// challengeCert returns the tls-alpn-01 challenge certificate of the
+// host, provisioned by this or another replica.
+func (m *Manager) challengeCert(ctx context.Context, host string) (*tls.Certificate, error) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	m.mu.Lock()
+	cert, ok := m.tlsALPN[host]
+	m.mu.Unlock()
+	if ok {
+		return cert, nil
+	}
+
+	if !m.isAllowed(host) {
+		return nil, fmt.Errorf("no ACME challenge for %s", host)
+	}
+
+	data, err := m.lookupChallenge(ctx, tlsALPN01KeyPrefix+host)
+	if err != nil {
+		return nil, fmt.Errorf("no ACME challenge for %s: %w", host, err)
+	}
+
+	return parseCertificate(data)
+}
+
+// lookupChallenge returns the challenge provisioned by another replica
+// from the store, unless it was missing recently, or the lookups
+// exceed their rate.
+func (m *Manager) lookupChallenge(ctx context.Context, key string) ([]byte, error) {
+	now := m.now()
+	m.mu.Lock()
+	missed := now.Before(m.missed[key])
+	m.mu.Unlock()
+
+	if missed {
+		return nil, ErrNotFound
+	}
+
+	if !m.lookups.Allow() {
+		return nil, errors.New("too many ACME challenge lookups")
+	}
+
+	data, err := m.options.Store.Get(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		m.mu.Lock()
+		for k, t := range m.missed {
+			if !now.Before(t) {
+				delete(m.missed, k)
+			}
+		}
+
+		m.missed[key] = now.Add(missedChallengeTTL)
+		m.mu.Unlock()
+	}
+
+	return data, err
+}
+
+// HTTPHandler answers the http-01 challenges, provisioned by this or
+// another replica, and passes the other requests to next.
+func (m *Manager) HTTPHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.URL.Path, http01Path)
+		if !ok || token == "" || strings.Contains(token, "/") || r.Method != "GET" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		m.mu.Lock()
+		rsp, ok := m.http01[token]
+		m.mu.Unlock()
+
+		if !ok {
+			var err error
+			rsp, err = m.lookupChallenge(r.Context(), http01KeyPrefix+token)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write(rsp)
+	})
+}
+
+func (m *Manager) checkRenewals() {
+	defer m.checking.Done()
+
+	ticker := time.NewTicker(m.options.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.quit:
+			return
+		case <-ticker.C:
+			m.renew()
+		}
+	}
+}
+
+// renew renews the certificates that are due, and drops the
+// certificates of the hostnames that are not allowed anymore.
+func (m *Manager) renew() {
+	var due []string
+
+	m.mu.Lock()
+	for host, cert := range m.certs {
+		if _, ok := m.allowed[host]; !ok {
+			delete(m.certs, host)
+			continue
+		}
+
+		if m.dueForRenewal(cert) {
+			due = append(due, host)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, host := range due {
+		select {
+		case <-m.quit:
+			return
+		default:
+		}
+
+		m.obtain(context.Background(), host, true)
+	}
+}
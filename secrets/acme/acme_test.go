@@ -0,0 +1,666 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/acme"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/routing"
+)
+
+var idPeACMEIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+// fakeACME implements the subset of RFC 8555 used by the Manager. It
+// doesn't verify the signatures of the requests, but it validates the
+// challenges by calling the Manager.
+type fakeACME struct {
+	t        *testing.T
+	server   *httptest.Server
+	caCert   *x509.Certificate
+	caKey    *ecdsa.PrivateKey
+	validate func(host, typ, token string) bool
+
+	mu     sync.Mutex
+	orders []*fakeOrder
+	count  atomic.Int64
+}
+
+type fakeOrder struct {
+	host       string
+	token      string
+	authzValid bool
+	cert       []byte
+}
+
+func newFakeACME(t *testing.T) *fakeACME {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake ACME CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+
+	caCert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	f := &fakeACME{t: t, caCert: caCert, caKey: key}
+	f.server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeACME) directoryURL() string {
+	return f.server.URL + "/directory"
+}
+
+func (f *fakeACME) payload(r *http.Request) []byte {
+	var jws struct {
+		Payload string `json:"payload"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		return nil
+	}
+
+	b, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+	return b
+}
+
+func (f *fakeACME) orderJSON(id int, o *fakeOrder) map[string]any {
+	status := "pending"
+	switch {
+	case o.cert != nil:
+		status = "valid"
+	case o.authzValid:
+		status = "ready"
+	}
+
+	rsp := map[string]any{
+		"status":         status,
+		"identifiers":    []map[string]string{{"type": "dns", "value": o.host}},
+		"authorizations": []string{fmt.Sprintf("%s/authz/%d", f.server.URL, id)},
+		"finalize":       fmt.Sprintf("%s/finalize/%d", f.server.URL, id),
+	}
+
+	if o.cert != nil {
+		rsp["certificate"] = fmt.Sprintf("%s/cert/%d", f.server.URL, id)
+	}
+
+	return rsp
+}
+
+func (f *fakeACME) handle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", time.Now().UnixNano()))
+
+	writeJSON := func(status int, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v)
+	}
+
+	var (
+		resource string
+		id       int
+		typ      string
+	)
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	resource = parts[0]
+	if len(parts) > 1 {
+		fmt.Sscan(parts[1], &id)
+	}
+
+	if len(parts) > 2 {
+		typ = parts[2]
+	}
+
+	var o *fakeOrder
+	if len(parts) > 1 {
+		f.mu.Lock()
+		if id < len(f.orders) {
+			o = f.orders[id]
+		}
+		f.mu.Unlock()
+
+		if o == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	}
+
+	switch resource {
+	case "directory":
+		writeJSON(http.StatusOK, map[string]string{
+			"newNonce":   f.server.URL + "/nonce",
+			"newAccount": f.server.URL + "/account",
+			"newOrder":   f.server.URL + "/order",
+		})
+	case "nonce":
+		w.WriteHeader(http.StatusOK)
+	case "account":
+		w.Header().Set("Location", f.server.URL+"/account/0")
+		writeJSON(http.StatusCreated, map[string]string{"status": "valid"})
+	case "order":
+		if o == nil {
+			var req struct {
+				Identifiers []struct{ Value string }
+			}
+
+			if err := json.Unmarshal(f.payload(r), &req); err != nil || len(req.Identifiers) != 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			f.count.Add(1)
+			f.mu.Lock()
+			o = &fakeOrder{host: req.Identifiers[0].Value, token: fmt.Sprintf("token%d", len(f.orders))}
+			id = len(f.orders)
+			f.orders = append(f.orders, o)
+			f.mu.Unlock()
+
+			w.Header().Set("Location", fmt.Sprintf("%s/order/%d", f.server.URL, id))
+			writeJSON(http.StatusCreated, f.orderJSON(id, o))
+			return
+		}
+
+		w.Header().Set("Location", fmt.Sprintf("%s/order/%d", f.server.URL, id))
+		writeJSON(http.StatusOK, f.orderJSON(id, o))
+	case "authz":
+		status := "pending"
+		if o.authzValid {
+			status = "valid"
+		}
+
+		var challenges []map[string]string
+		for _, typ := range []string{ChallengeHTTP01, ChallengeTLSALPN01} {
+			challenges = append(challenges, map[string]string{
+				"type":   typ,
+				"url":    fmt.Sprintf("%s/challenge/%d/%s", f.server.URL, id, typ),
+				"token":  o.token,
+				"status": status,
+			})
+		}
+
+		writeJSON(http.StatusOK, map[string]any{
+			"status":     status,
+			"identifier": map[string]string{"type": "dns", "value": o.host},
+			"challenges": challenges,
+		})
+	case "challenge":
+		if !f.validate(o.host, typ, o.token) {
+			writeJSON(http.StatusForbidden, map[string]string{
+				"type":   "urn:ietf:params:acme:error:unauthorized",
+				"detail": "challenge failed",
+			})
+			return
+		}
+
+		f.mu.Lock()
+		o.authzValid = true
+		f.mu.Unlock()
+
+		writeJSON(http.StatusOK, map[string]string{
+			"type":   typ,
+			"url":    fmt.Sprintf("%s/challenge/%d/%s", f.server.URL, id, typ),
+			"token":  o.token,
+			"status": "valid",
+		})
+	case "finalize":
+		var req struct{ CSR string }
+		if err := json.Unmarshal(f.payload(r), &req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		der, _ := base64.RawURLEncoding.DecodeString(req.CSR)
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil || len(csr.DNSNames) != 1 || csr.DNSNames[0] != o.host {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		cert, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(int64(id) + 100),
+			Subject:      pkix.Name{CommonName: o.host},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			DNSNames:     csr.DNSNames,
+		}, f.caCert, csr.PublicKey, f.caKey)
+		require.NoError(f.t, err)
+
+		f.mu.Lock()
+		o.cert = cert
+		f.mu.Unlock()
+
+		w.Header().Set("Location", fmt.Sprintf("%s/order/%d", f.server.URL, id))
+		writeJSON(http.StatusOK, f.orderJSON(id, o))
+	case "cert":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: o.cert})
+		pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: f.caCert.Raw})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeACME) roots() *x509.CertPool {
+	p := x509.NewCertPool()
+	p.AddCert(f.caCert)
+	return p
+}
+
+// handshake connects to a TLS server using the GetCertificate function,
+// and returns the certificate chain sent by the server.
+func handshake(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error), serverName string, protos ...string) ([]*x509.Certificate, error) {
+	sc, cc := net.Pipe()
+	defer sc.Close()
+	defer cc.Close()
+
+	go func() {
+		s := tls.Server(sc, &tls.Config{
+			GetCertificate: getCertificate,
+			NextProtos:     []string{"h2", "http/1.1", acme.ALPNProto},
+		})
+		s.Handshake()
+		s.Close()
+	}()
+
+	c := tls.Client(cc, &tls.Config{ServerName: serverName, InsecureSkipVerify: true, NextProtos: protos})
+	if err := c.Handshake(); err != nil {
+		return nil, err
+	}
+
+	return c.ConnectionState().PeerCertificates, nil
+}
+
+func validator(t *testing.T, m *Manager) func(host, typ, token string) bool {
+	return func(host, typ, token string) bool {
+		switch typ {
+		case ChallengeHTTP01:
+			rsp := httptest.NewRecorder()
+			m.HTTPHandler(http.NotFoundHandler()).ServeHTTP(rsp, httptest.NewRequest("GET", "http://"+host+http01Path+token, nil))
+			return rsp.Code == http.StatusOK && strings.HasPrefix(rsp.Body.String(), token+".")
+		case ChallengeTLSALPN01:
+			certs, err := handshake(m.WrapGetCertificate(nil, nil), host, acme.ALPNProto)
+			if err != nil {
+				t.Logf("tls-alpn-01 handshake failed: %v", err)
+				return false
+			}
+
+			for _, e := range certs[0].Extensions {
+				if e.Id.Equal(idPeACMEIdentifier) && e.Critical {
+					return len(certs[0].DNSNames) == 1 && certs[0].DNSNames[0] == host
+				}
+			}
+
+			return false
+		default:
+			return false
+		}
+	}
+}
+
+func routesWithHosts(hosts ...string) []*routing.Route {
+	var routes []*routing.Route
+	for _, h := range hosts {
+		routes = append(routes, &routing.Route{Route: eskip.Route{HostRegexps: []string{h}}})
+	}
+
+	return routes
+}
+
+func TestLiteralHosts(t *testing.T) {
+	for _, tt := range []struct {
+		pattern string
+		want    []string
+	}{
+		{`^www[.]example[.]org$`, []string{"www.example.org"}},
+		{`^www\.example\.org$`, []string{"www.example.org"}},
+		{`www\.Example\.org`, []string{"www.example.org"}},
+		{`^(foo[.]example[.]org[.]?(:[0-9]+)?|bar[.]example[.]org[.]?(:[0-9]+)?)$`, []string{"foo.example.org", "bar.example.org"}},
+		{`^(www|api)[.]example[.]org$`, []string{"www.example.org", "api.example.org"}},
+		{`^www.example.org$`, nil},
+		{`[.]example[.]org$`, nil},
+		{`.`, nil},
+		{`^[a-z]+[.]example[.]org$`, nil},
+		{`^localhost$`, nil},
+		{`^10[.]0[.]0[.]1$`, nil},
+		{`^foo_bar[.]example[.]org$`, nil},
+		{`(`, nil},
+	} {
+		t.Run(tt.pattern, func(t *testing.T) {
+			assert.Equal(t, tt.want, literalHosts(tt.pattern))
+		})
+	}
+}
+
+func TestNewManager(t *testing.T) {
+	_, err := New(Options{})
+	assert.Error(t, err, "store required")
+
+	_, err = New(Options{Store: &FileStore{dir: t.TempDir()}, Challenge: "dns-01"})
+	assert.Error(t, err, "unsupported challenge")
+}
+
+func TestObtainCertificate(t *testing.T) {
+	for _, challenge := range []string{ChallengeTLSALPN01, ChallengeHTTP01} {
+		t.Run(challenge, func(t *testing.T) {
+			ca := newFakeACME(t)
+			store, err := NewFileStore(t.TempDir())
+			require.NoError(t, err)
+
+			m, err := New(Options{
+				DirectoryURL: ca.directoryURL(),
+				Email:        "admin@example.org",
+				Store:        store,
+				Challenge:    challenge,
+			})
+			require.NoError(t, err)
+			defer m.Close()
+
+			ca.validate = validator(t, m)
+			m.Do(routesWithHosts(`^www[.]example[.]org$`))
+
+			getCertificate := m.WrapGetCertificate(nil, nil)
+
+			certs, err := handshake(getCertificate, "www.example.org")
+			require.NoError(t, err)
+			require.Len(t, certs, 2)
+
+			_, err = certs[0].Verify(x509.VerifyOptions{DNSName: "www.example.org", Roots: ca.roots()})
+			assert.NoError(t, err)
+
+			_, err = handshake(getCertificate, "www.example.org")
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), ca.count.Load(), "certificate is cached")
+
+			_, err = store.Get(t.Context(), certKeyPrefix+"www.example.org")
+			assert.NoError(t, err, "certificate is stored")
+
+			_, err = store.Get(t.Context(), tlsALPN01KeyPrefix+"www.example.org")
+			assert.ErrorIs(t, err, ErrNotFound, "challenge is removed")
+
+			_, err = handshake(getCertificate, "other.example.org")
+			assert.Error(t, err, "host not allowed")
+			assert.Equal(t, int64(1), ca.count.Load())
+		})
+	}
+}
+
+func TestObtainCertificateFailure(t *testing.T) {
+	ca := newFakeACME(t)
+	ca.validate = func(string, string, string) bool { return false }
+
+	store, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	m, err := New(Options{DirectoryURL: ca.directoryURL(), Store: store})
+	require.NoError(t, err)
+	defer m.Close()
+
+	m.Do(routesWithHosts(`^www[.]example[.]org$`))
+
+	_, err = handshake(m.WrapGetCertificate(nil, nil), "www.example.org")
+	assert.Error(t, err)
+
+	_, err = handshake(m.WrapGetCertificate(nil, nil), "www.example.org")
+	assert.Error(t, err)
+	assert.Equal(t, int64(1), ca.count.Load(), "failed order is not retried immediately")
+}
+
+func TestSharedStore(t *testing.T) {
+	ca := newFakeACME(t)
+	store, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	var managers []*Manager
+	for range 2 {
+		m, err := New(Options{DirectoryURL: ca.directoryURL(), Store: store})
+		require.NoError(t, err)
+		defer m.Close()
+
+		m.Do(routesWithHosts(`^www[.]example[.]org$`))
+		managers = append(managers, m)
+	}
+
+	// any replica can answer the challenge
+	ca.validate = validator(t, managers[1])
+
+	_, err = handshake(managers[0].WrapGetCertificate(nil, nil), "www.example.org")
+	require.NoError(t, err)
+
+	_, err = handshake(managers[1].WrapGetCertificate(nil, nil), "www.example.org")
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(1), ca.count.Load(), "stored certificate is shared")
+
+	k0, err := managers[0].accountKey(t.Context())
+	require.NoError(t, err)
+	k1, err := managers[1].accountKey(t.Context())
+	require.NoError(t, err)
+	assert.True(t, k0.Equal(k1), "account is shared")
+}
+
+func TestRenewal(t *testing.T) {
+	ca := newFakeACME(t)
+	store, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	m, err := New(Options{DirectoryURL: ca.directoryURL(), Store: store})
+	require.NoError(t, err)
+	defer m.Close()
+
+	ca.validate = validator(t, m)
+	m.Do(routesWithHosts(`^www[.]example[.]org$`, `^api[.]example[.]org$`))
+
+	getCertificate := m.WrapGetCertificate(nil, nil)
+	first, err := handshake(getCertificate, "www.example.org")
+	require.NoError(t, err)
+
+	_, err = handshake(getCertificate, "api.example.org")
+	require.NoError(t, err)
+
+	m.renew()
+	assert.Equal(t, int64(2), ca.count.Load(), "not due for renewal")
+
+	// api.example.org is not used anymore
+	m.Do(routesWithHosts(`^www[.]example[.]org$`))
+
+	m.mu.Lock()
+	now := time.Now().Add(70 * 24 * time.Hour)
+	m.now = func() time.Time { return now }
+	m.mu.Unlock()
+
+	m.renew()
+	assert.Equal(t, int64(3), ca.count.Load())
+
+	renewed, err := handshake(getCertificate, "www.example.org")
+	require.NoError(t, err)
+	assert.NotEqual(t, first[0].SerialNumber, renewed[0].SerialNumber)
+}
+
+func TestWrapGetCertificate(t *testing.T) {
+	ca := newFakeACME(t)
+	store, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	m, err := New(Options{DirectoryURL: ca.directoryURL(), Store: store})
+	require.NoError(t, err)
+	defer m.Close()
+
+	ca.validate = validator(t, m)
+	m.Do(routesWithHosts(`^www[.]example[.]org$`, `^static[.]example[.]org$`, `^registry[.]example[.]org$`))
+
+	newCert := func(host string) tls.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+
+		der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(7),
+			Subject:      pkix.Name{CommonName: host},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			DNSNames:     []string{host},
+		}, ca.caCert, key.Public(), ca.caKey)
+		require.NoError(t, err)
+
+		leaf, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+	}
+
+	registryCert := newCert("registry.example.org")
+	next := func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if hello.ServerName == "registry.example.org" {
+			return &registryCert, nil
+		}
+
+		return nil, nil
+	}
+
+	static := []tls.Certificate{newCert("static.example.org")}
+	getCertificate := m.WrapGetCertificate(next, static)
+
+	certs, err := handshake(getCertificate, "registry.example.org")
+	require.NoError(t, err)
+	assert.Equal(t, "registry.example.org", certs[0].Subject.CommonName)
+
+	// the TLS config falls back to the static certificates
+	cert, err := getCertificate(&tls.ClientHelloInfo{
+		ServerName:        "static.example.org",
+		SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+		SupportedVersions: []uint16{tls.VersionTLS13},
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, cert)
+
+	_, err = handshake(getCertificate, "www.example.org")
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(1), ca.count.Load(), "only www.example.org is ordered")
+}
+
+func TestHTTPHandler(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	m, err := New(Options{Store: store})
+	require.NoError(t, err)
+	defer m.Close()
+
+	require.NoError(t, store.Put(t.Context(), http01KeyPrefix+"token", []byte("token.thumbprint")))
+
+	h := m.HTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	for _, tt := range []struct {
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{http01Path + "token", http.StatusOK, "token.thumbprint"},
+		{http01Path + "other", http.StatusTeapot, ""},
+		{http01Path, http.StatusTeapot, ""},
+		{"/foo", http.StatusTeapot, ""},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			rsp := httptest.NewRecorder()
+			h.ServeHTTP(rsp, httptest.NewRequest("GET", "http://www.example.org"+tt.path, nil))
+
+			assert.Equal(t, tt.wantCode, rsp.Code)
+
+			b, _ := io.ReadAll(rsp.Body)
+			assert.Equal(t, tt.wantBody, string(b))
+		})
+	}
+}
+
+type countingStore struct {
+	Store
+	gets atomic.Int64
+}
+
+func (s *countingStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.gets.Add(1)
+	return s.Store.Get(ctx, key)
+}
+
+func TestChallengeLookupLimits(t *testing.T) {
+	fs, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	store := &countingStore{Store: fs}
+	m, err := New(Options{Store: store, Challenge: ChallengeHTTP01})
+	require.NoError(t, err)
+	defer m.Close()
+
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	h := m.HTTPHandler(http.NotFoundHandler())
+	get := func(token string) int {
+		rsp := httptest.NewRecorder()
+		h.ServeHTTP(rsp, httptest.NewRequest("GET", "http://www.example.org"+http01Path+token, nil))
+		return rsp.Code
+	}
+
+	// the missing challenge is not looked up again
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusNotFound, get("missing"))
+	}
+
+	assert.Equal(t, int64(1), store.gets.Load())
+
+	// provisioned by another replica meanwhile
+	require.NoError(t, fs.Put(t.Context(), http01KeyPrefix+"missing", []byte("missing.thumbprint")))
+	assert.Equal(t, http.StatusNotFound, get("missing"))
+
+	now = now.Add(missedChallengeTTL)
+	assert.Equal(t, http.StatusOK, get("missing"))
+	assert.Equal(t, int64(2), store.gets.Load())
+
+	// random tokens don't exceed the rate of the lookups
+	for i := 0; i < 100; i++ {
+		get(fmt.Sprintf("random-%d", i))
+	}
+
+	assert.LessOrEqual(t, store.gets.Load(), int64(2+challengeLookupRate+1))
+}
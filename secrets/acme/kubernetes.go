@@ -0,0 +1,350 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+)
+
+const (
+	// DefaultKubernetesNamespace is the default namespace of the
+	// secrets of the Kubernetes store.
+	DefaultKubernetesNamespace = "kube-system"
+
+	defaultKubernetesURL    = "http://localhost:8001"
+	serviceAccountDir       = "/var/run/secrets/kubernetes.io/serviceaccount/"
+	serviceAccountTokenKey  = "token"
+	serviceAccountRootCAKey = "ca.crt"
+	serviceHostEnvVar       = "KUBERNETES_SERVICE_HOST"
+	servicePortEnvVar       = "KUBERNETES_SERVICE_PORT"
+
+	secretNamePrefix     = "skipper-acme-"
+	secretDataKey        = "data"
+	secretKeyAnnotation  = "skipper.io/acme-key"
+	lockExpiryAnnotation = "skipper.io/acme-lock-expires"
+	lockSecretSuffix     = "-lock"
+	maxSecretNameLength  = 253 - len(lockSecretSuffix)
+)
+
+var secretNameRx = regexp.MustCompile(`^[a-z0-9]([a-z0-9.-]*[a-z0-9])?$`)
+
+// KubernetesStoreOptions contains the settings of the Kubernetes
+// store.
+type KubernetesStoreOptions struct {
+	// KubernetesInCluster uses the service account of the pod to
+	// access the API server.
+	KubernetesInCluster bool
+
+	// KubernetesURL is the address of the API server when not running
+	// in cluster. Defaults to http://localhost:8001, the address of
+	// kubectl proxy.
+	KubernetesURL string
+
+	// Namespace of the secrets. Defaults to kube-system.
+	Namespace string
+}
+
+// KubernetesStore stores the data in Opaque secrets. The locks are
+// secrets, too, created exclusively, and annotated with their expiry,
+// so that the locks of terminated replicas can be taken over.
+//
+// The service account requires the get, create, update and delete
+// permissions for secrets in the namespace.
+type KubernetesStore struct {
+	client  *http.Client
+	apiURL  string
+	token   string
+	ns      string
+	lockTTL time.Duration
+	now     func() time.Time
+}
+
+var _ Store = (*KubernetesStore)(nil)
+
+type secret struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   secretMetadata    `json:"metadata"`
+	Type       string            `json:"type,omitempty"`
+	Data       map[string][]byte `json:"data,omitempty"`
+}
+
+type secretMetadata struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace,omitempty"`
+	ResourceVersion string            `json:"resourceVersion,omitempty"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+}
+
+// NewKubernetesStore creates a KubernetesStore.
+func NewKubernetesStore(o KubernetesStoreOptions) (*KubernetesStore, error) {
+	s := &KubernetesStore{
+		client:  http.DefaultClient,
+		apiURL:  o.KubernetesURL,
+		ns:      o.Namespace,
+		lockTTL: DefaultLockTTL,
+		now:     time.Now,
+	}
+
+	if s.ns == "" {
+		s.ns = DefaultKubernetesNamespace
+	}
+
+	if !o.KubernetesInCluster {
+		if s.apiURL == "" {
+			s.apiURL = defaultKubernetesURL
+		}
+
+		return s, nil
+	}
+
+	host, port := os.Getenv(serviceHostEnvVar), os.Getenv(servicePortEnvVar)
+	if host == "" || port == "" {
+		return nil, errors.New("kubernetes API server URL could not be constructed from env vars")
+	}
+
+	s.apiURL = "https://" + net.JoinHostPort(host, port)
+
+	rootCA, err := os.ReadFile(serviceAccountDir + serviceAccountRootCAKey)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(rootCA) {
+		return nil, errors.New("invalid CA")
+	}
+
+	token, err := os.ReadFile(serviceAccountDir + serviceAccountTokenKey)
+	if err != nil {
+		return nil, err
+	}
+
+	s.token = string(token)
+	s.client = &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				MinVersion: tls.VersionTLS12,
+				RootCAs:    pool,
+			},
+		},
+	}
+
+	return s, nil
+}
+
+// secretName maps the key to a valid secret name. The keys that are
+// not valid names, e.g. the challenge tokens, are hashed.
+func secretName(key string) string {
+	name := secretNamePrefix + key
+	if len(name) <= maxSecretNameLength && secretNameRx.MatchString(name) {
+		return name
+	}
+
+	h := sha256.Sum256([]byte(key))
+	return secretNamePrefix + hex.EncodeToString(h[:20])
+}
+
+func (s *KubernetesStore) url(name string) string {
+	u := s.apiURL + "/api/v1/namespaces/" + s.ns + "/secrets"
+	if name != "" {
+		u += "/" + name
+	}
+
+	return u
+}
+
+func (s *KubernetesStore) do(ctx context.Context, method, url string, body, result any) (int, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, r)
+	if err != nil {
+		return 0, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	rsp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode >= http.StatusBadRequest {
+		io.Copy(io.Discard, rsp.Body)
+		return rsp.StatusCode, nil
+	}
+
+	if result != nil {
+		if err := json.NewDecoder(rsp.Body).Decode(result); err != nil {
+			return rsp.StatusCode, fmt.Errorf("failed to decode secret: %w", err)
+		}
+	}
+
+	return rsp.StatusCode, nil
+}
+
+func (s *KubernetesStore) getSecret(ctx context.Context, name string) (*secret, error) {
+	var sec secret
+	status, err := s.do(ctx, "GET", s.url(name), nil, &sec)
+	switch {
+	case err != nil:
+		return nil, err
+	case status == http.StatusNotFound:
+		return nil, ErrNotFound
+	case status != http.StatusOK:
+		return nil, fmt.Errorf("failed to get secret %s/%s: status %d", s.ns, name, status)
+	}
+
+	return &sec, nil
+}
+
+func (s *KubernetesStore) newSecret(key, name string) *secret {
+	return &secret{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Type:       "Opaque",
+		Metadata: secretMetadata{
+			Name:        name,
+			Namespace:   s.ns,
+			Annotations: map[string]string{secretKeyAnnotation: key},
+		},
+	}
+}
+
+func (s *KubernetesStore) Get(ctx context.Context, key string) ([]byte, error) {
+	sec, err := s.getSecret(ctx, secretName(key))
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := sec.Data[secretDataKey]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return data, nil
+}
+
+// Put creates the secret, or, when it exists, replaces it.
+func (s *KubernetesStore) Put(ctx context.Context, key string, data []byte) error {
+	name := secretName(key)
+	sec := s.newSecret(key, name)
+	sec.Data = map[string][]byte{secretDataKey: data}
+
+	status, err := s.do(ctx, "POST", s.url(""), sec, nil)
+	if err != nil {
+		return err
+	}
+
+	if status == http.StatusConflict {
+		status, err = s.do(ctx, "PUT", s.url(name), sec, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	if status >= http.StatusBadRequest {
+		return fmt.Errorf("failed to store secret %s/%s: status %d", s.ns, name, status)
+	}
+
+	return nil
+}
+
+func (s *KubernetesStore) Delete(ctx context.Context, key string) error {
+	return s.deleteSecret(ctx, secretName(key), "")
+}
+
+// deleteSecret deletes the secret. When the resource version is set,
+// the secret is only deleted when it was not changed meanwhile.
+func (s *KubernetesStore) deleteSecret(ctx context.Context, name, resourceVersion string) error {
+	var body any
+	if resourceVersion != "" {
+		body = map[string]any{"preconditions": map[string]string{"resourceVersion": resourceVersion}}
+	}
+
+	status, err := s.do(ctx, "DELETE", s.url(name), body, nil)
+	switch {
+	case err != nil:
+		return err
+	case status == http.StatusNotFound, status == http.StatusConflict:
+		// deleted or taken by another replica meanwhile
+		return nil
+	case status >= http.StatusBadRequest:
+		return fmt.Errorf("failed to delete secret %s/%s: status %d", s.ns, name, status)
+	}
+
+	return nil
+}
+
+func (s *KubernetesStore) Lock(ctx context.Context, key string) (func(), error) {
+	name := secretName(key) + lockSecretSuffix
+	for {
+		lock := s.newSecret(key, name)
+		lock.Metadata.Annotations[lockExpiryAnnotation] = s.now().Add(s.lockTTL).UTC().Format(time.RFC3339)
+
+		status, err := s.do(ctx, "POST", s.url(""), lock, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		switch status {
+		case http.StatusCreated, http.StatusOK:
+			return func() {
+				// the context of the lock may be done already
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				s.deleteSecret(ctx, name, "")
+			}, nil
+		case http.StatusConflict:
+			if current, err := s.getSecret(ctx, name); err == nil {
+				expires, err := time.Parse(time.RFC3339, current.Metadata.Annotations[lockExpiryAnnotation])
+				if err != nil || s.now().After(expires) {
+					// stale lock of a terminated replica
+					if err := s.deleteSecret(ctx, name, current.Metadata.ResourceVersion); err != nil {
+						return nil, err
+					}
+
+					continue
+				}
+			} else if errors.Is(err, ErrNotFound) {
+				continue
+			}
+		default:
+			return nil, fmt.Errorf("failed to create lock secret %s/%s: status %d", s.ns, name, status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to acquire lock %s: %w", key, ctx.Err())
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultLockTTL is the time after which a lock of a store is
+	// considered stale, e.g. because the replica holding it was
+	// terminated, and can be taken over.
+	DefaultLockTTL = 10 * time.Minute
+
+	// the lock files are kept in a subdirectory, so that they can't
+	// be confused with the data files
+	lockDir        = ".locks"
+	releasedSuffix = ".released"
+)
+
+// ErrNotFound is returned by the stores when the requested key does
+// not exist.
+var ErrNotFound = errors.New("not found in ACME store")
+
+// lockRetryInterval sets how often a store retries to take a lock
+// held by another replica.
+var lockRetryInterval = time.Second
+
+// Store persists the ACME account key, the certificates and the
+// challenge responses, so that they can be shared by the replicas of
+// Skipper, and survive restarts.
+type Store interface {
+	// Get returns the data stored with the key, or ErrNotFound.
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// Put stores the data with the key, replacing the previous data.
+	Put(ctx context.Context, key string, data []byte) error
+
+	// Delete removes the key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+
+	// Lock blocks until it acquires the exclusive lock of the key, or
+	// the context is done. The returned function releases the lock.
+	// The lock is exclusive across all the replicas sharing the store.
+	Lock(ctx context.Context, key string) (func(), error)
+}
+
+// FileStore stores the data in files of a directory. It can be shared
+// by multiple replicas using a shared volume. The locks are files
+// created exclusively in the .locks subdirectory, with increasing
+// generations.
+type FileStore struct {
+	dir     string
+	lockTTL time.Duration
+}
+
+var _ Store = (*FileStore)(nil)
+
+// NewFileStore creates a FileStore in the directory, creating the
+// directory when it doesn't exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	if dir == "" {
+		return nil, errors.New("ACME file store requires a directory")
+	}
+
+	if err := os.MkdirAll(filepath.Join(dir, lockDir), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create ACME store directory %s: %w", dir, err)
+	}
+
+	return &FileStore{dir: dir, lockTTL: DefaultLockTTL}, nil
+}
+
+// fileName maps the key to a file name. The keys used by the Manager
+// consist of hostnames and challenge tokens, and other characters are
+// replaced, too.
+func (s *FileStore) fileName(key string) string {
+	return filepath.Join(s.dir, strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, key))
+}
+
+func (s *FileStore) Get(_ context.Context, key string) ([]byte, error) {
+	b, err := os.ReadFile(s.fileName(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+
+	return b, err
+}
+
+// Put writes the data to a temporary file, and renames it, so that the
+// readers never see partial data.
+func (s *FileStore) Put(_ context.Context, key string, data []byte) error {
+	f, err := os.CreateTemp(s.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := os.Rename(f.Name(), s.fileName(key)); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return nil
+}
+
+func (s *FileStore) Delete(_ context.Context, key string) error {
+	err := os.Remove(s.fileName(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// lockGenerations returns the generations of the lock files of the
+// key, in ascending order.
+func (s *FileStore) lockGenerations(lockName string) ([]int, error) {
+	entries, err := os.ReadDir(filepath.Dir(lockName))
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := filepath.Base(lockName) + "."
+	var generations []int
+	for _, e := range entries {
+		g, ok := strings.CutPrefix(e.Name(), prefix)
+		if !ok {
+			continue
+		}
+
+		if n, err := strconv.Atoi(g); err == nil && n > 0 {
+			generations = append(generations, n)
+		}
+	}
+
+	slices.Sort(generations)
+	return generations, nil
+}
+
+func lockFile(lockName string, generation int) string {
+	return fmt.Sprintf("%s.%d", lockName, generation)
+}
+
+// free tells if the lock file of the generation was released by its
+// holder, or it is stale, e.g. because the replica holding it was
+// terminated.
+func (s *FileStore) free(name string) bool {
+	if _, err := os.Stat(name + releasedSuffix); err == nil {
+		return true
+	}
+
+	fi, err := os.Stat(name)
+	return err != nil || time.Since(fi.ModTime()) > s.lockTTL
+}
+
+// Lock takes the lock by creating the lock file of the next generation
+// exclusively, when the lock file of the current generation is
+// released or stale. Only one of the replicas can create it, so the
+// stale locks are taken over atomically, too. The files of the older
+// generations are deleted by the new holder, and the lock is released
+// by marking the file of its generation as released.
+func (s *FileStore) Lock(ctx context.Context, key string) (func(), error) {
+	lockName := filepath.Join(s.dir, lockDir, filepath.Base(s.fileName(key)))
+	for {
+		generations, err := s.lockGenerations(lockName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read lock files of %s: %w", key, err)
+		}
+
+		current := 0
+		if len(generations) > 0 {
+			current = generations[len(generations)-1]
+		}
+
+		if current == 0 || s.free(lockFile(lockName, current)) {
+			name := lockFile(lockName, current+1)
+			f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+			if err == nil {
+				f.Close()
+
+				// the file of the current generation is kept, so that
+				// the next generation is never created again
+				for _, g := range generations[:max(len(generations)-1, 0)] {
+					os.Remove(lockFile(lockName, g))
+					os.Remove(lockFile(lockName, g) + releasedSuffix)
+				}
+
+				return func() {
+					if err := os.WriteFile(name+releasedSuffix, nil, 0o600); err != nil {
+						log.Errorf("Failed to release lock %s: %v", name, err)
+					}
+				}, nil
+			}
+
+			if !errors.Is(err, os.ErrExist) {
+				return nil, fmt.Errorf("failed to create lock file %s: %w", name, err)
+			}
+
+			// another replica took the lock
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to acquire lock %s: %w", key, ctx.Err())
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package acme
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	lockRetryInterval = 10 * time.Millisecond
+}
+
+// fakeKubernetes implements the secrets API of a namespace.
+type fakeKubernetes struct {
+	mu      sync.Mutex
+	secrets map[string]*secret
+	version int
+}
+
+func newFakeKubernetes(t *testing.T) (*fakeKubernetes, *httptest.Server) {
+	k := &fakeKubernetes{secrets: make(map[string]*secret)}
+	s := httptest.NewServer(http.HandlerFunc(k.handle))
+	t.Cleanup(s.Close)
+	return k, s
+}
+
+func (k *fakeKubernetes) handle(w http.ResponseWriter, r *http.Request) {
+	const prefix = "/api/v1/namespaces/skipper/secrets"
+	name, ok := strings.CutPrefix(r.URL.Path, prefix)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	name = strings.TrimPrefix(name, "/")
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	switch r.Method {
+	case "GET":
+		s, ok := k.secrets[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(s)
+	case "POST", "PUT":
+		var s secret
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		_, exists := k.secrets[s.Metadata.Name]
+		switch {
+		case r.Method == "POST" && exists:
+			w.WriteHeader(http.StatusConflict)
+			return
+		case r.Method == "PUT" && (!exists || s.Metadata.Name != name):
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		k.version++
+		s.Metadata.ResourceVersion = strings.Repeat("1", k.version)
+		k.secrets[s.Metadata.Name] = &s
+
+		if r.Method == "POST" {
+			w.WriteHeader(http.StatusCreated)
+		}
+
+		json.NewEncoder(w).Encode(s)
+	case "DELETE":
+		s, ok := k.secrets[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var options struct {
+			Preconditions struct{ ResourceVersion string }
+		}
+
+		json.NewDecoder(r.Body).Decode(&options)
+		if rv := options.Preconditions.ResourceVersion; rv != "" && rv != s.Metadata.ResourceVersion {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		delete(k.secrets, name)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func testStore(t *testing.T, s Store) {
+	ctx := t.Context()
+
+	_, err := s.Get(ctx, "cert-www.example.org")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, s.Put(ctx, "cert-www.example.org", []byte("foo")))
+	require.NoError(t, s.Put(ctx, "http-01-Ab_Cd-12", []byte("bar")))
+
+	b, err := s.Get(ctx, "cert-www.example.org")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", string(b))
+
+	require.NoError(t, s.Put(ctx, "cert-www.example.org", []byte("baz")))
+	b, err = s.Get(ctx, "cert-www.example.org")
+	require.NoError(t, err)
+	assert.Equal(t, "baz", string(b))
+
+	b, err = s.Get(ctx, "http-01-Ab_Cd-12")
+	require.NoError(t, err)
+	assert.Equal(t, "bar", string(b))
+
+	require.NoError(t, s.Delete(ctx, "cert-www.example.org"))
+	require.NoError(t, s.Delete(ctx, "cert-www.example.org"), "delete missing key")
+
+	_, err = s.Get(ctx, "cert-www.example.org")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	unlock, err := s.Lock(ctx, "cert-www.example.org")
+	require.NoError(t, err)
+
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	_, err = s.Lock(timeout, "cert-www.example.org")
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "locked")
+
+	other, err := s.Lock(ctx, "cert-api.example.org")
+	require.NoError(t, err, "other key")
+	other()
+
+	acquired := make(chan struct{})
+	go func() {
+		unlock, err := s.Lock(ctx, "cert-www.example.org")
+		if err == nil {
+			unlock()
+		}
+
+		close(acquired)
+	}()
+
+	unlock()
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("lock not acquired after unlock")
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	_, err := NewFileStore("")
+	assert.Error(t, err)
+
+	s, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	testStore(t, s)
+
+	lockFiles := func(t *testing.T) []string {
+		entries, err := os.ReadDir(filepath.Join(s.dir, lockDir))
+		require.NoError(t, err)
+
+		var names []string
+		for _, e := range entries {
+			if strings.HasPrefix(e.Name(), "account-key.") {
+				names = append(names, e.Name())
+			}
+		}
+
+		return names
+	}
+
+	t.Run("stale lock", func(t *testing.T) {
+		_, err := s.Lock(t.Context(), "account-key")
+		require.NoError(t, err)
+		require.Equal(t, []string{"account-key.1"}, lockFiles(t))
+
+		stale := time.Now().Add(-2 * DefaultLockTTL)
+		require.NoError(t, os.Chtimes(filepath.Join(s.dir, lockDir, "account-key.1"), stale, stale))
+
+		ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+		defer cancel()
+
+		unlock, err := s.Lock(ctx, "account-key")
+		require.NoError(t, err)
+		unlock()
+
+		unlock, err = s.Lock(ctx, "account-key")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"account-key.2", "account-key.2.released", "account-key.3"}, lockFiles(t))
+		unlock()
+	})
+
+	t.Run("concurrent takeover of a stale lock", func(t *testing.T) {
+		unlock, err := s.Lock(t.Context(), "cert-www.example.org")
+		require.NoError(t, err)
+		unlock()
+
+		generations, err := s.lockGenerations(filepath.Join(s.dir, lockDir, "cert-www.example.org"))
+		require.NoError(t, err)
+
+		stale := time.Now().Add(-2 * DefaultLockTTL)
+		current := filepath.Join(s.dir, lockDir, fmt.Sprintf("cert-www.example.org.%d", generations[len(generations)-1]))
+		require.NoError(t, os.Remove(current+releasedSuffix))
+		require.NoError(t, os.Chtimes(current, stale, stale))
+
+		var (
+			mu      sync.Mutex
+			wg      sync.WaitGroup
+			holders []func()
+		)
+
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+				defer cancel()
+
+				if u, err := s.Lock(ctx, "cert-www.example.org"); err == nil {
+					mu.Lock()
+					holders = append(holders, u)
+					mu.Unlock()
+				}
+			}()
+		}
+
+		wg.Wait()
+		require.Len(t, holders, 1)
+		holders[0]()
+	})
+}
+
+func TestKubernetesStore(t *testing.T) {
+	k, server := newFakeKubernetes(t)
+
+	s, err := NewKubernetesStore(KubernetesStoreOptions{KubernetesURL: server.URL, Namespace: "skipper"})
+	require.NoError(t, err)
+
+	testStore(t, s)
+
+	k.mu.Lock()
+	for name, sec := range k.secrets {
+		assert.True(t, secretNameRx.MatchString(name), name)
+		assert.Equal(t, "Opaque", sec.Type)
+	}
+
+	assert.Contains(t, k.secrets, secretName("http-01-Ab_Cd-12"))
+	k.mu.Unlock()
+
+	t.Run("stale lock", func(t *testing.T) {
+		_, err := s.Lock(t.Context(), "account-key")
+		require.NoError(t, err)
+
+		now := time.Now().Add(2 * DefaultLockTTL)
+		s.now = func() time.Time { return now }
+		defer func() { s.now = time.Now }()
+
+		ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+		defer cancel()
+
+		unlock, err := s.Lock(ctx, "account-key")
+		require.NoError(t, err)
+		unlock()
+
+		k.mu.Lock()
+		assert.NotContains(t, k.secrets, "skipper-acme-account-key-lock")
+		k.mu.Unlock()
+	})
+}
+
+func TestSecretName(t *testing.T) {
+	assert.Equal(t, "skipper-acme-cert-www.example.org", secretName("cert-www.example.org"))
+	assert.Equal(t, "skipper-acme-account-key", secretName("account-key"))
+
+	hashed := secretName("http-01-Ab_Cd")
+	assert.True(t, strings.HasPrefix(hashed, secretNamePrefix))
+	assert.True(t, secretNameRx.MatchString(hashed))
+	assert.NotEqual(t, hashed, secretName("http-01-ab_cd"))
+}
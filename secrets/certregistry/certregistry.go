@@ -1,9 +1,11 @@
 // Package certregistry provides building blocks to have more than one
 // certificate and use SNI to select the right certificate for the
-// request.
+// request. It also allows to trust different client CAs per SNI, and
+// to reject revoked client certificates based on CRLs and OCSP.
 package certregistry
 
 import (
+	"bytes"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
@@ -15,8 +17,21 @@ import (
 // CertRegistry object holds TLS certificates to be used to terminate TLS connections
 // ensuring synchronized access to them.
 type CertRegistry struct {
-	mu     sync.Mutex
-	lookup map[string]*tls.Certificate
+	mu        sync.Mutex
+	lookup    map[string]*tls.Certificate
+	clientCAs map[string]*clientCA
+	stapler   *stapler
+}
+
+type clientCA struct {
+	pem    []byte
+	pool   *x509.CertPool
+	config *tls.Config
+
+	// synced bundles are removed by RemoveUnsyncedClientCAs, when they
+	// were not configured again since the previous call
+	synced bool
+	seen   bool
 }
 
 // NewCertRegistry initializes the certificate registry.
@@ -24,7 +39,8 @@ func NewCertRegistry() *CertRegistry {
 	l := make(map[string]*tls.Certificate)
 
 	return &CertRegistry{
-		lookup: l,
+		lookup:    l,
+		clientCAs: make(map[string]*clientCA),
 	}
 }
 
@@ -48,18 +64,34 @@ func (r *CertRegistry) ConfigureCertificate(host string, cert *tls.Certificate)
 	if found {
 		if cert.Leaf.NotBefore.After(curr.Leaf.NotBefore) {
 			log.Infof("updating certificate in registry - %s", host)
-			r.lookup[host] = cert
+			r.setCertificate(host, cert)
 			return nil
 		} else {
 			return nil
 		}
 	} else {
 		log.Infof("adding certificate to registry - %s", host)
-		r.lookup[host] = cert
+		r.setCertificate(host, cert)
 		return nil
 	}
 }
 
+// setCertificate stores the certificate with its OCSP staple, when
+// stapling is enabled, and starts fetching the staple of a new
+// certificate.
+func (r *CertRegistry) setCertificate(host string, cert *tls.Certificate) {
+	if r.stapler == nil {
+		r.lookup[host] = cert
+		return
+	}
+
+	r.stapler.mu.Lock()
+	r.lookup[host] = r.stapler.withStaple(cert)
+	r.stapler.mu.Unlock()
+
+	r.stapler.triggerStapling()
+}
+
 // GetCertFromHello reads the SNI from a TLS client and returns the appropriate certificate.
 // If no certificate is found for the host it will return nil.
 func (r *CertRegistry) GetCertFromHello(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
@@ -71,3 +103,112 @@ func (r *CertRegistry) GetCertFromHello(hello *tls.ClientHelloInfo) (*tls.Certif
 	}
 	return nil, nil
 }
+
+// ConfigureClientCA sets the PEM encoded CA bundle used to verify the
+// client certificates of the TLS connections with the SNI of the host.
+// It replaces the previously configured bundle of the host.
+func (r *CertRegistry) ConfigureClientCA(host string, pem []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if curr, found := r.clientCAs[host]; found && bytes.Equal(curr.pem, pem) {
+		return nil
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("failed to parse client CA bundle for %s", host)
+	}
+
+	log.Infof("setting client CA in registry - %s", host)
+	r.clientCAs[host] = &clientCA{pem: pem, pool: pool}
+	return nil
+}
+
+// SyncClientCA sets the PEM encoded CA bundle of the host like
+// ConfigureClientCA, for the bundles taken from a data source, e.g.
+// Kubernetes secrets. The bundle is removed by RemoveUnsyncedClientCAs,
+// unless it is set again before. The bundles set with
+// ConfigureClientCA take precedence, and they are not replaced.
+func (r *CertRegistry) SyncClientCA(host string, pem []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	curr, found := r.clientCAs[host]
+	if found && !curr.synced {
+		log.Debugf("keeping configured client CA in registry - %s", host)
+		return nil
+	}
+
+	if found && bytes.Equal(curr.pem, pem) {
+		curr.seen = true
+		return nil
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("failed to parse client CA bundle for %s", host)
+	}
+
+	log.Infof("setting client CA in registry - %s", host)
+	r.clientCAs[host] = &clientCA{pem: pem, pool: pool, synced: true, seen: true}
+	return nil
+}
+
+// RemoveUnsyncedClientCAs removes the bundles set with SyncClientCA,
+// that were not set again since the previous call. It is called after
+// every synchronization with the data source.
+func (r *CertRegistry) RemoveUnsyncedClientCAs() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for host, ca := range r.clientCAs {
+		if !ca.synced {
+			continue
+		}
+
+		if !ca.seen {
+			log.Infof("removing client CA from registry - %s", host)
+			delete(r.clientCAs, host)
+			continue
+		}
+
+		ca.seen = false
+	}
+}
+
+// GetConfigForClient returns a function to be used as
+// [tls.Config.GetConfigForClient]. For the hosts with a client CA
+// bundle, it returns a copy of the base config, that verifies the
+// client certificates with the CAs of the host. When the client
+// authentication policy of the base config doesn't verify the client
+// certificates, the copy verifies them if given, or requires them when
+// the base config requires any certificate. For the other hosts, it
+// returns nil, and the base config is used.
+func (r *CertRegistry) GetConfigForClient(base *tls.Config) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		ca, found := r.clientCAs[hello.ServerName]
+		if !found {
+			return nil, nil
+		}
+
+		if ca.config == nil {
+			c := base.Clone()
+			c.GetConfigForClient = nil
+			c.ClientCAs = ca.pool
+			switch c.ClientAuth {
+			case tls.NoClientCert, tls.RequestClientCert:
+				c.ClientAuth = tls.VerifyClientCertIfGiven
+			case tls.RequireAnyClientCert:
+				c.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+
+			ca.config = c
+		}
+
+		return ca.config, nil
+	}
+}
@@ -0,0 +1,349 @@
+package certregistry
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	// DefaultCRLRefreshInterval is used when RevocationOptions.CRLRefreshInterval is not set.
+	DefaultCRLRefreshInterval = time.Minute
+
+	// DefaultOCSPCacheTTL is used when RevocationOptions.OCSPCacheTTL is not set.
+	DefaultOCSPCacheTTL = time.Hour
+
+	// DefaultOCSPTimeout is used when RevocationOptions.OCSPTimeout is not set.
+	DefaultOCSPTimeout = 3 * time.Second
+
+	maxOCSPResponseSize = 1 << 20
+)
+
+// ErrCertificateRevoked is returned when a certificate of the client
+// certificate chain has been revoked.
+var ErrCertificateRevoked = errors.New("client certificate revoked")
+
+// RevocationOptions contains the settings of the revocation checks of
+// the client certificates.
+type RevocationOptions struct {
+	// CRLFiles contains the paths of the PEM or DER encoded
+	// certificate revocation lists.
+	CRLFiles []string
+
+	// CRLRefreshInterval sets how often the CRL files are reloaded.
+	CRLRefreshInterval time.Duration
+
+	// OCSP enables checking the client certificates with the OCSP
+	// responders listed in the certificates.
+	OCSP bool
+
+	// OCSPCacheTTL sets how long the OCSP responses are cached, when
+	// the response doesn't set an earlier next update.
+	OCSPCacheTTL time.Duration
+
+	// OCSPTimeout sets the timeout of the requests to the OCSP
+	// responders.
+	OCSPTimeout time.Duration
+}
+
+// RevocationChecker rejects the TLS connections whose client
+// certificate chain contains a revoked certificate. The CRL files are
+// reloaded periodically, and the OCSP responses are cached.
+//
+// When the OCSP responder cannot be reached, the certificate is
+// accepted, and the failure is logged. Revocations published in the
+// CRLs are always enforced.
+type RevocationChecker struct {
+	options RevocationOptions
+	client  *http.Client
+	now     func() time.Time
+
+	mu        sync.Mutex
+	crls      []*crl
+	loaded    time.Time
+	reloading bool
+
+	ocspMu    sync.Mutex
+	ocspCache map[string]ocspEntry
+}
+
+type crl struct {
+	list    *x509.RevocationList
+	revoked map[string]struct{}
+
+	mu       sync.Mutex
+	verified map[string]bool
+}
+
+type ocspEntry struct {
+	revoked bool
+	expires time.Time
+}
+
+// NewRevocationChecker creates a RevocationChecker, and loads the
+// configured CRL files. It fails when any of the CRL files cannot be
+// loaded.
+func NewRevocationChecker(o RevocationOptions) (*RevocationChecker, error) {
+	if o.CRLRefreshInterval <= 0 {
+		o.CRLRefreshInterval = DefaultCRLRefreshInterval
+	}
+
+	if o.OCSPCacheTTL <= 0 {
+		o.OCSPCacheTTL = DefaultOCSPCacheTTL
+	}
+
+	if o.OCSPTimeout <= 0 {
+		o.OCSPTimeout = DefaultOCSPTimeout
+	}
+
+	crls, err := loadCRLs(o.CRLFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RevocationChecker{
+		options:   o,
+		client:    &http.Client{Timeout: o.OCSPTimeout},
+		now:       time.Now,
+		crls:      crls,
+		loaded:    time.Now(),
+		ocspCache: make(map[string]ocspEntry),
+	}, nil
+}
+
+func loadCRLs(files []string) ([]*crl, error) {
+	var crls []*crl
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CRL file %s: %w", f, err)
+		}
+
+		ders := [][]byte{b}
+		if bytes.Contains(b, []byte("-----BEGIN")) {
+			ders = nil
+			for block, rest := pem.Decode(b); block != nil; block, rest = pem.Decode(rest) {
+				if block.Type == "X509 CRL" {
+					ders = append(ders, block.Bytes)
+				}
+			}
+
+			if len(ders) == 0 {
+				return nil, fmt.Errorf("no CRL found in file %s", f)
+			}
+		}
+
+		for _, der := range ders {
+			list, err := x509.ParseRevocationList(der)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse CRL file %s: %w", f, err)
+			}
+
+			if !list.NextUpdate.IsZero() && list.NextUpdate.Before(time.Now()) {
+				log.Warnf("CRL in %s is outdated, next update was due at %v", f, list.NextUpdate)
+			}
+
+			c := &crl{
+				list:     list,
+				revoked:  make(map[string]struct{}, len(list.RevokedCertificateEntries)),
+				verified: make(map[string]bool),
+			}
+
+			for _, e := range list.RevokedCertificateEntries {
+				c.revoked[e.SerialNumber.String()] = struct{}{}
+			}
+
+			crls = append(crls, c)
+		}
+	}
+
+	return crls, nil
+}
+
+// currentCRLs returns the loaded CRLs, and starts reloading them in
+// the background when the refresh interval has passed.
+func (c *RevocationChecker) currentCRLs() []*crl {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.options.CRLFiles) > 0 && !c.reloading && c.now().Sub(c.loaded) >= c.options.CRLRefreshInterval {
+		c.reloading = true
+		go c.reloadCRLs()
+	}
+
+	return c.crls
+}
+
+func (c *RevocationChecker) reloadCRLs() {
+	crls, err := loadCRLs(c.options.CRLFiles)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.reloading = false
+	c.loaded = c.now()
+	if err != nil {
+		log.Errorf("Failed to reload CRLs, keeping the previous ones: %v", err)
+		return
+	}
+
+	c.crls = crls
+}
+
+// issuedBy tells whether the CRL was signed by the issuer. The result
+// of the signature check is cached.
+func (l *crl) issuedBy(issuer *x509.Certificate) bool {
+	if !bytes.Equal(l.list.RawIssuer, issuer.RawSubject) {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := string(issuer.Raw)
+	verified, ok := l.verified[key]
+	if !ok {
+		verified = l.list.CheckSignatureFrom(issuer) == nil
+		l.verified[key] = verified
+	}
+
+	return verified
+}
+
+func checkCRLs(crls []*crl, cert, issuer *x509.Certificate) error {
+	serial := cert.SerialNumber.String()
+	for _, l := range crls {
+		if !l.issuedBy(issuer) {
+			continue
+		}
+
+		if _, revoked := l.revoked[serial]; revoked {
+			return fmt.Errorf("%w: serial %s, issuer %s", ErrCertificateRevoked, serial, issuer.Subject)
+		}
+	}
+
+	return nil
+}
+
+func (c *RevocationChecker) checkOCSP(cert, issuer *x509.Certificate) error {
+	if len(cert.OCSPServer) == 0 {
+		return nil
+	}
+
+	key := string(issuer.RawSubject) + "/" + cert.SerialNumber.String()
+	now := c.now()
+
+	c.ocspMu.Lock()
+	e, ok := c.ocspCache[key]
+	c.ocspMu.Unlock()
+
+	if !ok || !now.Before(e.expires) {
+		var err error
+		e, err = c.queryOCSP(cert, issuer)
+		if err != nil {
+			log.Warnf("Failed to check the revocation of the client certificate %s with OCSP: %v", cert.SerialNumber, err)
+			return nil
+		}
+
+		c.ocspMu.Lock()
+		for k, ei := range c.ocspCache {
+			if !now.Before(ei.expires) {
+				delete(c.ocspCache, k)
+			}
+		}
+
+		c.ocspCache[key] = e
+		c.ocspMu.Unlock()
+	}
+
+	if e.revoked {
+		return fmt.Errorf("%w: serial %s, issuer %s (OCSP)", ErrCertificateRevoked, cert.SerialNumber, issuer.Subject)
+	}
+
+	return nil
+}
+
+func (c *RevocationChecker) queryOCSP(cert, issuer *x509.Certificate) (ocspEntry, error) {
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return ocspEntry{}, err
+	}
+
+	var lastErr error
+	for _, server := range cert.OCSPServer {
+		var r *ocsp.Response
+		r, lastErr = c.postOCSP(server, req, cert, issuer)
+		if lastErr != nil {
+			continue
+		}
+
+		expires := c.now().Add(c.options.OCSPCacheTTL)
+		if !r.NextUpdate.IsZero() && r.NextUpdate.Before(expires) {
+			expires = r.NextUpdate
+		}
+
+		return ocspEntry{revoked: r.Status == ocsp.Revoked, expires: expires}, nil
+	}
+
+	return ocspEntry{}, lastErr
+}
+
+func (c *RevocationChecker) postOCSP(server string, req []byte, cert, issuer *x509.Certificate) (*ocsp.Response, error) {
+	rsp, err := c.client.Post(server, "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code from %s: %d", server, rsp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(rsp.Body, maxOCSPResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	return ocsp.ParseResponseForCert(body, cert, issuer)
+}
+
+// VerifyConnection can be used as [tls.Config.VerifyConnection]. It
+// checks every certificate of the verified client certificate chains
+// against the CRLs of its issuer, and, when enabled, the leaf
+// certificate with OCSP. When the client certificate was not verified,
+// e.g. with [tls.RequireAnyClientCert], the check is skipped, because
+// the OCSP responders listed in an unverified certificate are chosen by
+// the client.
+func (c *RevocationChecker) VerifyConnection(cs tls.ConnectionState) error {
+	if len(cs.VerifiedChains) == 0 {
+		return nil
+	}
+
+	crls := c.currentCRLs()
+	for _, chain := range cs.VerifiedChains {
+		for i := 0; i < len(chain)-1; i++ {
+			if err := checkCRLs(crls, chain[i], chain[i+1]); err != nil {
+				return err
+			}
+		}
+
+		if c.options.OCSP && len(chain) > 1 {
+			if err := c.checkOCSP(chain[0], chain[1]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,372 @@
+package certregistry
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) pem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+func (ca *testCA) issue(t *testing.T, serial int64, ocspServer string) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"www.example.org"},
+	}
+
+	if ocspServer != "" {
+		template.OCSPServer = []string{ocspServer}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	require.NoError(t, err)
+
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func (ca *testCA) writeCRL(t *testing.T, path string, serials ...int64) {
+	t.Helper()
+
+	var entries []x509.RevocationListEntry
+	for _, s := range serials {
+		entries = append(entries, x509.RevocationListEntry{SerialNumber: big.NewInt(s), RevocationTime: time.Now()})
+	}
+
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(time.Now().UnixNano()),
+		ThisUpdate:                time.Now(),
+		NextUpdate:                time.Now().Add(time.Hour),
+		RevokedCertificateEntries: entries,
+	}, ca.cert, ca.key)
+	require.NoError(t, err)
+
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0o600)
+	require.NoError(t, err)
+}
+
+func verifiedState(client tls.Certificate, ca *testCA) tls.ConnectionState {
+	return tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{client.Leaf},
+		VerifiedChains:   [][]*x509.Certificate{{client.Leaf, ca.cert}},
+	}
+}
+
+func TestClientCA(t *testing.T) {
+	ca := newTestCA(t, "client CA")
+	cr := NewCertRegistry()
+
+	assert.Error(t, cr.ConfigureClientCA("www.example.org", []byte("foo")))
+	require.NoError(t, cr.ConfigureClientCA("www.example.org", ca.pem()))
+
+	base := &tls.Config{ClientAuth: tls.RequestClientCert}
+	getConfig := cr.GetConfigForClient(base)
+
+	c, err := getConfig(&tls.ClientHelloInfo{ServerName: "other.example.org"})
+	require.NoError(t, err)
+	assert.Nil(t, c, "base config used for other hosts")
+
+	c, err = getConfig(&tls.ClientHelloInfo{ServerName: "www.example.org"})
+	require.NoError(t, err)
+	require.NotNil(t, c)
+	assert.Equal(t, tls.VerifyClientCertIfGiven, c.ClientAuth)
+	assert.True(t, c.ClientCAs.Equal(func() *x509.CertPool {
+		p := x509.NewCertPool()
+		p.AddCert(ca.cert)
+		return p
+	}()))
+
+	cached, _ := getConfig(&tls.ClientHelloInfo{ServerName: "www.example.org"})
+	assert.Same(t, c, cached)
+
+	require.NoError(t, cr.ConfigureClientCA("www.example.org", newTestCA(t, "other CA").pem()))
+	updated, _ := getConfig(&tls.ClientHelloInfo{ServerName: "www.example.org"})
+	assert.NotSame(t, c, updated)
+}
+
+func TestSyncClientCA(t *testing.T) {
+	ca := newTestCA(t, "client CA")
+	configured := newTestCA(t, "configured CA")
+	cr := NewCertRegistry()
+	getConfig := cr.GetConfigForClient(&tls.Config{})
+
+	require.NoError(t, cr.ConfigureClientCA("configured.example.org", configured.pem()))
+	require.NoError(t, cr.SyncClientCA("configured.example.org", ca.pem()))
+	require.NoError(t, cr.SyncClientCA("www.example.org", ca.pem()))
+	assert.Error(t, cr.SyncClientCA("invalid.example.org", []byte("foo")))
+
+	hasConfig := func(host string) bool {
+		c, err := getConfig(&tls.ClientHelloInfo{ServerName: host})
+		require.NoError(t, err)
+		return c != nil
+	}
+
+	cr.RemoveUnsyncedClientCAs()
+	assert.True(t, hasConfig("www.example.org"), "synced since the previous removal")
+
+	require.NoError(t, cr.SyncClientCA("www.example.org", ca.pem()))
+	cr.RemoveUnsyncedClientCAs()
+	assert.True(t, hasConfig("www.example.org"), "synced again")
+
+	cr.RemoveUnsyncedClientCAs()
+	assert.False(t, hasConfig("www.example.org"), "not synced anymore")
+
+	c, err := getConfig(&tls.ClientHelloInfo{ServerName: "configured.example.org"})
+	require.NoError(t, err)
+	require.NotNil(t, c, "configured bundles are kept")
+	assert.True(t, c.ClientCAs.Equal(func() *x509.CertPool {
+		p := x509.NewCertPool()
+		p.AddCert(configured.cert)
+		return p
+	}()), "configured bundles take precedence")
+}
+
+func TestClientCAHandshake(t *testing.T) {
+	ca := newTestCA(t, "client CA")
+	otherCA := newTestCA(t, "other CA")
+	serverCert := otherCA.issue(t, 1000, "")
+
+	dir := t.TempDir()
+	crlFile := filepath.Join(dir, "ca.crl")
+	ca.writeCRL(t, crlFile, 2)
+
+	rc, err := NewRevocationChecker(RevocationOptions{CRLFiles: []string{crlFile}})
+	require.NoError(t, err)
+
+	cr := NewCertRegistry()
+	require.NoError(t, cr.ConfigureClientCA("www.example.org", ca.pem()))
+
+	config := &tls.Config{Certificates: []tls.Certificate{serverCert}, VerifyConnection: rc.VerifyConnection}
+	config.GetConfigForClient = cr.GetConfigForClient(config)
+
+	handshake := func(serverName string, client tls.Certificate) error {
+		sc, cc := net.Pipe()
+		defer sc.Close()
+		defer cc.Close()
+
+		done := make(chan error, 1)
+		go func() {
+			c := tls.Client(cc, &tls.Config{
+				ServerName:         serverName,
+				InsecureSkipVerify: true,
+				// send the certificate even when its CA is not accepted
+				GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					return &client, nil
+				},
+			})
+			err := c.Handshake()
+			if err == nil {
+				// the client learns about the rejection of its
+				// certificate with the first read
+				_, err = c.Read(make([]byte, 1))
+			}
+			done <- err
+		}()
+
+		s := tls.Server(sc, config)
+		err := s.Handshake()
+		if err == nil {
+			s.Close()
+		}
+
+		<-done
+		return err
+	}
+
+	assert.NoError(t, handshake("www.example.org", ca.issue(t, 3, "")), "valid client certificate")
+	assert.Error(t, handshake("www.example.org", ca.issue(t, 2, "")), "revoked client certificate")
+	assert.Error(t, handshake("www.example.org", otherCA.issue(t, 3, "")), "client certificate of another CA")
+}
+
+func TestRevocationCRL(t *testing.T) {
+	ca := newTestCA(t, "client CA")
+	otherCA := newTestCA(t, "other CA")
+
+	dir := t.TempDir()
+	crlFile := filepath.Join(dir, "ca.crl")
+	otherCRLFile := filepath.Join(dir, "other.crl")
+	ca.writeCRL(t, crlFile, 2)
+	otherCA.writeCRL(t, otherCRLFile, 3)
+
+	_, err := NewRevocationChecker(RevocationOptions{CRLFiles: []string{filepath.Join(dir, "missing.crl")}})
+	assert.Error(t, err)
+
+	rc, err := NewRevocationChecker(RevocationOptions{CRLFiles: []string{crlFile, otherCRLFile}})
+	require.NoError(t, err)
+
+	revoked := ca.issue(t, 2, "")
+	valid := ca.issue(t, 3, "")
+
+	assert.ErrorIs(t, rc.VerifyConnection(verifiedState(revoked, ca)), ErrCertificateRevoked)
+	assert.NoError(t, rc.VerifyConnection(verifiedState(valid, ca)), "revoked by other CA only")
+	assert.NoError(t, rc.VerifyConnection(tls.ConnectionState{}), "no client certificate")
+
+	t.Run("unverified chain is not checked", func(t *testing.T) {
+		err := rc.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{revoked.Leaf, ca.cert}})
+		assert.NoError(t, err)
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		ca.writeCRL(t, crlFile, 2, 3)
+
+		now := time.Now().Add(DefaultCRLRefreshInterval)
+		rc.mu.Lock()
+		rc.now = func() time.Time { return now }
+		rc.mu.Unlock()
+
+		require.Eventually(t, func() bool {
+			return rc.VerifyConnection(verifiedState(valid, ca)) != nil
+		}, time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestRevocationOCSP(t *testing.T) {
+	ca := newTestCA(t, "client CA")
+
+	var requests atomic.Int64
+	ocspServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		req, err := ocsp.ParseRequest(b)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if req.SerialNumber.Int64() == 4 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		status := ocsp.Good
+		if req.SerialNumber.Int64() == 2 {
+			status = ocsp.Revoked
+		}
+
+		rsp, err := ocsp.CreateResponse(ca.cert, ca.cert, ocsp.Response{
+			Status:       status,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now(),
+			NextUpdate:   time.Now().Add(time.Hour),
+			RevokedAt:    time.Now(),
+		}, ca.key)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Write(rsp)
+	}))
+	defer ocspServer.Close()
+
+	rc, err := NewRevocationChecker(RevocationOptions{OCSP: true})
+	require.NoError(t, err)
+
+	revoked := ca.issue(t, 2, ocspServer.URL)
+	valid := ca.issue(t, 3, ocspServer.URL)
+	unavailable := ca.issue(t, 4, ocspServer.URL)
+	noResponder := ca.issue(t, 5, "")
+
+	assert.ErrorIs(t, rc.VerifyConnection(verifiedState(revoked, ca)), ErrCertificateRevoked)
+	assert.NoError(t, rc.VerifyConnection(verifiedState(valid, ca)))
+	assert.Equal(t, int64(2), requests.Load())
+
+	t.Run("cached", func(t *testing.T) {
+		assert.ErrorIs(t, rc.VerifyConnection(verifiedState(revoked, ca)), ErrCertificateRevoked)
+		assert.NoError(t, rc.VerifyConnection(verifiedState(valid, ca)))
+		assert.Equal(t, int64(2), requests.Load())
+	})
+
+	t.Run("expired cache", func(t *testing.T) {
+		now := time.Now().Add(2 * time.Hour)
+		rc.now = func() time.Time { return now }
+		defer func() { rc.now = time.Now }()
+
+		assert.NoError(t, rc.VerifyConnection(verifiedState(valid, ca)))
+		assert.Equal(t, int64(3), requests.Load())
+	})
+
+	t.Run("responder failure is accepted", func(t *testing.T) {
+		assert.NoError(t, rc.VerifyConnection(verifiedState(unavailable, ca)))
+	})
+
+	t.Run("unverified chain is not sent to the responder", func(t *testing.T) {
+		other := ca.issue(t, 6, ocspServer.URL)
+		before := requests.Load()
+		assert.NoError(t, rc.VerifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{other.Leaf, ca.cert}}))
+		assert.Equal(t, before, requests.Load())
+	})
+
+	t.Run("no responder", func(t *testing.T) {
+		assert.NoError(t, rc.VerifyConnection(verifiedState(noResponder, ca)))
+	})
+}
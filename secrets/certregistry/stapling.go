@@ -0,0 +1,415 @@
+package certregistry
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/zalando/skipper/metrics"
+)
+
+const (
+	// DefaultOCSPStaplingCheckInterval is used when
+	// OCSPStaplingOptions.CheckInterval is not set.
+	DefaultOCSPStaplingCheckInterval = time.Minute
+
+	ocspStapleMaxAgeMetric   = "tls.ocsp_staple.max_age"
+	ocspStaplesMetric        = "tls.ocsp_staple.staples"
+	ocspStapleFailuresMetric = "tls.ocsp_staple.fetch_failures"
+)
+
+// OCSPStaplingOptions contains the settings of the OCSP stapling of the
+// certificates of the registry.
+type OCSPStaplingOptions struct {
+	// CheckInterval sets how often the staples are checked for
+	// refresh, and how often a failed fetch is retried.
+	CheckInterval time.Duration
+
+	// Timeout sets the timeout of the requests to the OCSP responders.
+	Timeout time.Duration
+
+	// Metrics receives the age of the oldest staple in seconds, the
+	// number of the stapled certificates, and the number of the failed
+	// fetches.
+	Metrics metrics.Metrics
+}
+
+type stapler struct {
+	options OCSPStaplingOptions
+	client  *http.Client
+	now     func() time.Time
+	mu      sync.Mutex
+	staples map[[sha256.Size]byte]*staple
+
+	// certificates not stored in the registry, e.g. static or ACME
+	// certificates, stapled by StapleGetCertificate
+	external map[[sha256.Size]byte]*tls.Certificate
+
+	trigger chan struct{}
+	quit    chan struct{}
+	once    sync.Once
+	done    sync.WaitGroup
+}
+
+type staple struct {
+	raw        []byte
+	thisUpdate time.Time
+	nextUpdate time.Time
+	refresh    time.Time
+}
+
+// EnableOCSPStapling starts fetching the OCSP responses of the
+// configured certificates in the background, and attaches them to the
+// certificates returned by GetCertFromHello. A response is refreshed
+// halfway between its this and next update, and it is dropped when its
+// next update has passed without a successful refresh. Only the
+// responses with good status are stapled. The certificates without an
+// OCSP responder, or without their issuer in the chain, are served
+// without a staple. Close stops the refresh.
+func (r *CertRegistry) EnableOCSPStapling(o OCSPStaplingOptions) {
+	if o.CheckInterval <= 0 {
+		o.CheckInterval = DefaultOCSPStaplingCheckInterval
+	}
+
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultOCSPTimeout
+	}
+
+	if o.Metrics == nil {
+		o.Metrics = metrics.Default
+	}
+
+	s := &stapler{
+		options:  o,
+		client:   &http.Client{Timeout: o.Timeout},
+		now:      time.Now,
+		staples:  make(map[[sha256.Size]byte]*staple),
+		external: make(map[[sha256.Size]byte]*tls.Certificate),
+		trigger:  make(chan struct{}, 1),
+		quit:     make(chan struct{}),
+	}
+
+	r.mu.Lock()
+	r.stapler = s
+	r.mu.Unlock()
+
+	s.done.Add(1)
+	go r.refreshStaples(s)
+}
+
+// Close stops refreshing the OCSP staples.
+func (r *CertRegistry) Close() {
+	r.mu.Lock()
+	s := r.stapler
+	r.mu.Unlock()
+
+	if s != nil {
+		s.once.Do(func() {
+			close(s.quit)
+			s.done.Wait()
+		})
+	}
+}
+
+// StapleGetCertificate returns a function that can be used as
+// [tls.Config.GetCertificate]. It attaches the OCSP staples to the
+// certificates returned by next, or, when next returns nothing, to the
+// static certificate selected the same way as by crypto/tls. The
+// certificates not stored in the registry are stapled after their first
+// use, and their staples are refreshed like the ones of the registry.
+// Without OCSP stapling enabled, the certificates are returned
+// unchanged.
+func (r *CertRegistry) StapleGetCertificate(next func(*tls.ClientHelloInfo) (*tls.Certificate, error), static []tls.Certificate) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		var cert *tls.Certificate
+		if next != nil {
+			var err error
+			if cert, err = next(hello); err != nil {
+				return nil, err
+			}
+		}
+
+		if cert == nil {
+			cert = selectStatic(hello, static)
+		}
+
+		if cert == nil {
+			return nil, nil
+		}
+
+		r.mu.Lock()
+		s := r.stapler
+		stored := r.lookup[hello.ServerName] == cert
+		r.mu.Unlock()
+
+		if s == nil || stored {
+			// the certificates of the registry have their staples
+			return cert, nil
+		}
+
+		return s.stapleExternal(cert), nil
+	}
+}
+
+// selectStatic returns the first static certificate supported by the
+// client, or the first one, like crypto/tls.
+func selectStatic(hello *tls.ClientHelloInfo, static []tls.Certificate) *tls.Certificate {
+	for i := range static {
+		if hello.SupportsCertificate(&static[i]) == nil {
+			return &static[i]
+		}
+	}
+
+	if len(static) > 0 {
+		return &static[0]
+	}
+
+	return nil
+}
+
+// stapleExternal returns the certificate with its current staple, and
+// starts fetching the staple of a new certificate.
+func (s *stapler) stapleExternal(c *tls.Certificate) *tls.Certificate {
+	if !stapleable(c) {
+		return c
+	}
+
+	key := sha256.Sum256(c.Certificate[0])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.external[key]; !ok {
+		s.external[key] = c
+		s.triggerStapling()
+	}
+
+	return s.withStaple(c)
+}
+
+// stapleable tells whether the certificate has an OCSP responder and
+// its issuer in the chain.
+func stapleable(c *tls.Certificate) bool {
+	return c.Leaf != nil && len(c.Leaf.OCSPServer) > 0 && len(c.Certificate) >= 2
+}
+
+// triggerStapling starts fetching the staples of new certificates
+// without waiting for the next check.
+func (s *stapler) triggerStapling() {
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (r *CertRegistry) refreshStaples(s *stapler) {
+	defer s.done.Done()
+
+	ticker := time.NewTicker(s.options.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		r.updateStaples(s)
+
+		select {
+		case <-s.quit:
+			return
+		case <-ticker.C:
+		case <-s.trigger:
+		}
+	}
+}
+
+// updateStaples fetches the missing and outdated OCSP responses, and
+// replaces the certificates of the registry with copies holding the
+// current staples, so that the concurrent handshakes don't see partial
+// updates.
+func (r *CertRegistry) updateStaples(s *stapler) {
+	certs := make(map[[sha256.Size]byte]*tls.Certificate)
+
+	r.mu.Lock()
+	for _, c := range r.lookup {
+		certs[sha256.Sum256(c.Certificate[0])] = c
+	}
+	r.mu.Unlock()
+
+	now := s.now()
+
+	// the external certificates are dropped when they expire, e.g.
+	// the ACME certificates replaced by their renewal
+	s.mu.Lock()
+	for key, c := range s.external {
+		if now.After(c.Leaf.NotAfter) {
+			delete(s.external, key)
+			continue
+		}
+
+		certs[key] = c
+	}
+	s.mu.Unlock()
+
+	for key, c := range certs {
+		s.mu.Lock()
+		st, ok := s.staples[key]
+		s.mu.Unlock()
+
+		if ok && now.Before(st.refresh) {
+			continue
+		}
+
+		fetched, err := s.fetch(c)
+		if err != nil {
+			log.Errorf("Failed to fetch OCSP staple for %s: %v", certName(c), err)
+			s.options.Metrics.IncCounter(ocspStapleFailuresMetric)
+			continue
+		}
+
+		if fetched != nil {
+			s.mu.Lock()
+			s.staples[key] = fetched
+			s.mu.Unlock()
+		}
+	}
+
+	s.mu.Lock()
+	for key, st := range s.staples {
+		if _, ok := certs[key]; !ok || !now.Before(st.nextUpdate) {
+			delete(s.staples, key)
+		}
+	}
+
+	// not per host, to avoid keeping the gauges of the removed
+	// certificates
+	var maxAge time.Duration
+	for _, st := range s.staples {
+		maxAge = max(maxAge, now.Sub(st.thisUpdate))
+	}
+
+	s.options.Metrics.UpdateGauge(ocspStapleMaxAgeMetric, maxAge.Seconds())
+	s.options.Metrics.UpdateGauge(ocspStaplesMetric, float64(len(s.staples)))
+	s.mu.Unlock()
+
+	// same lock order as in ConfigureCertificate
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for host, c := range r.lookup {
+		r.lookup[host] = s.withStaple(c)
+	}
+}
+
+// withStaple returns the certificate with its current staple, or the
+// same certificate, when the staple didn't change. It requires holding
+// the lock of the stapler.
+func (s *stapler) withStaple(c *tls.Certificate) *tls.Certificate {
+	var raw []byte
+	if st, ok := s.staples[sha256.Sum256(c.Certificate[0])]; ok {
+		raw = st.raw
+	}
+
+	if bytes.Equal(c.OCSPStaple, raw) {
+		return c
+	}
+
+	cc := *c
+	cc.OCSPStaple = raw
+	return &cc
+}
+
+// fetch returns the OCSP response of the certificate, or nil, when the
+// certificate can't be stapled.
+func (s *stapler) fetch(c *tls.Certificate) (*staple, error) {
+	if !stapleable(c) {
+		return nil, nil
+	}
+
+	issuer, err := x509.ParseCertificate(c.Certificate[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse issuer: %w", err)
+	}
+
+	req, err := ocsp.CreateRequest(c.Leaf, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, server := range c.Leaf.OCSPServer {
+		var (
+			raw []byte
+			rsp *ocsp.Response
+		)
+
+		raw, rsp, lastErr = s.post(server, req, c.Leaf, issuer)
+		if lastErr != nil {
+			continue
+		}
+
+		if rsp.Status != ocsp.Good {
+			return nil, fmt.Errorf("OCSP status of certificate is not good: %d", rsp.Status)
+		}
+
+		now := s.now()
+		st := &staple{raw: raw, thisUpdate: rsp.ThisUpdate, nextUpdate: rsp.NextUpdate}
+		if st.nextUpdate.IsZero() {
+			st.nextUpdate = now.Add(DefaultOCSPCacheTTL)
+		}
+
+		st.refresh = st.thisUpdate.Add(st.nextUpdate.Sub(st.thisUpdate) / 2)
+		if st.refresh.Before(now) {
+			st.refresh = now.Add(s.options.CheckInterval)
+		}
+
+		return st, nil
+	}
+
+	return nil, lastErr
+}
+
+func (s *stapler) post(server string, req []byte, cert, issuer *x509.Certificate) ([]byte, *ocsp.Response, error) {
+	rsp, err := s.client.Post(server, "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("unexpected status code from %s: %d", server, rsp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(rsp.Body, maxOCSPResponseSize))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parsed, err := ocsp.ParseResponseForCert(body, cert, issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return body, parsed, nil
+}
+
+func certName(c *tls.Certificate) string {
+	if c.Leaf == nil {
+		return "unknown"
+	}
+
+	if len(c.Leaf.DNSNames) > 0 {
+		return c.Leaf.DNSNames[0]
+	}
+
+	return c.Leaf.Subject.CommonName
+}
@@ -0,0 +1,245 @@
+package certregistry
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/zalando/skipper/metrics/metricstest"
+)
+
+type testResponder struct {
+	ca         *testCA
+	requests   atomic.Int64
+	failing    atomic.Bool
+	nextUpdate atomic.Int64
+}
+
+func (r *testResponder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.requests.Add(1)
+	if r.failing.Load() {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	b, err := io.ReadAll(req.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ocspReq, err := ocsp.ParseRequest(b)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	status := ocsp.Good
+	if ocspReq.SerialNumber.Int64() == 2 {
+		status = ocsp.Revoked
+	}
+
+	nextUpdate := time.Now().Add(time.Hour)
+	if d := r.nextUpdate.Load(); d > 0 {
+		nextUpdate = time.Now().Add(time.Duration(d))
+	}
+
+	rsp, err := ocsp.CreateResponse(r.ca.cert, r.ca.cert, ocsp.Response{
+		Status:       status,
+		SerialNumber: ocspReq.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   nextUpdate,
+		RevokedAt:    time.Now(),
+	}, r.ca.key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Write(rsp)
+}
+
+// withChain returns a copy of the certificate with the chain including
+// the CA, like the certificates loaded from secrets.
+func withChain(c tls.Certificate, ca *testCA) *tls.Certificate {
+	c.Certificate = append(c.Certificate, ca.cert.Raw)
+	c.Leaf = nil
+	return &c
+}
+
+func getStaple(cr *CertRegistry, host string) []byte {
+	c, _ := cr.GetCertFromHello(&tls.ClientHelloInfo{ServerName: host})
+	if c == nil {
+		return nil
+	}
+
+	return c.OCSPStaple
+}
+
+func TestOCSPStapling(t *testing.T) {
+	ca := newTestCA(t, "server CA")
+	responder := &testResponder{ca: ca}
+	server := httptest.NewServer(responder)
+	defer server.Close()
+
+	m := &metricstest.MockMetrics{}
+	cr := NewCertRegistry()
+	cr.EnableOCSPStapling(OCSPStaplingOptions{CheckInterval: time.Hour, Metrics: m})
+	defer cr.Close()
+
+	good := withChain(ca.issue(t, 3, server.URL), ca)
+	require.NoError(t, cr.ConfigureCertificate("www.example.org", good))
+	require.NoError(t, cr.ConfigureCertificate("api.example.org", good))
+
+	require.Eventually(t, func() bool {
+		return getStaple(cr, "www.example.org") != nil && getStaple(cr, "api.example.org") != nil
+	}, time.Second, 10*time.Millisecond)
+
+	rsp, err := ocsp.ParseResponse(getStaple(cr, "www.example.org"), ca.cert)
+	require.NoError(t, err)
+	assert.Equal(t, ocsp.Good, rsp.Status)
+	assert.Nil(t, good.OCSPStaple, "configured certificate is not changed")
+	assert.Equal(t, int64(1), responder.requests.Load(), "certificate shared by hosts is fetched once")
+
+	age, ok := m.Gauge("tls.ocsp_staple.max_age")
+	assert.True(t, ok)
+	assert.GreaterOrEqual(t, age, 60.0)
+
+	staples, ok := m.Gauge("tls.ocsp_staple.staples")
+	assert.True(t, ok)
+	assert.Equal(t, 1.0, staples)
+
+	t.Run("revoked", func(t *testing.T) {
+		require.NoError(t, cr.ConfigureCertificate("revoked.example.org", withChain(ca.issue(t, 2, server.URL), ca)))
+		require.Eventually(t, func() bool {
+			var failures int64
+			m.WithCounters(func(c map[string]int64) { failures = c["tls.ocsp_staple.fetch_failures"] })
+			return failures > 0
+		}, time.Second, 10*time.Millisecond)
+
+		assert.Nil(t, getStaple(cr, "revoked.example.org"))
+	})
+
+	t.Run("no responder or issuer", func(t *testing.T) {
+		noResponder := withChain(ca.issue(t, 5, ""), ca)
+		noIssuer := ca.issue(t, 6, server.URL)
+		noIssuer.Leaf = nil
+
+		require.NoError(t, cr.ConfigureCertificate("noresponder.example.org", noResponder))
+		require.NoError(t, cr.ConfigureCertificate("noissuer.example.org", &noIssuer))
+
+		// wait for the triggered update
+		time.Sleep(100 * time.Millisecond)
+		assert.Nil(t, getStaple(cr, "noresponder.example.org"))
+		assert.Nil(t, getStaple(cr, "noissuer.example.org"))
+	})
+}
+
+func TestOCSPStaplingRefresh(t *testing.T) {
+	ca := newTestCA(t, "server CA")
+	responder := &testResponder{ca: ca}
+	responder.nextUpdate.Store(int64(500 * time.Millisecond))
+	server := httptest.NewServer(responder)
+	defer server.Close()
+
+	m := &metricstest.MockMetrics{}
+	cr := NewCertRegistry()
+	cr.EnableOCSPStapling(OCSPStaplingOptions{CheckInterval: 20 * time.Millisecond, Metrics: m})
+	defer cr.Close()
+
+	require.NoError(t, cr.ConfigureCertificate("www.example.org", withChain(ca.issue(t, 3, server.URL), ca)))
+
+	require.Eventually(t, func() bool {
+		return getStaple(cr, "www.example.org") != nil
+	}, time.Second, 10*time.Millisecond)
+
+	// the staple is refreshed, because it is past halfway to its next update
+	require.Eventually(t, func() bool {
+		return responder.requests.Load() > 2
+	}, time.Second, 10*time.Millisecond)
+
+	// the staple is dropped after its next update
+	responder.failing.Store(true)
+	require.Eventually(t, func() bool {
+		return getStaple(cr, "www.example.org") == nil
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// the dropped staple is not measured anymore
+	require.Eventually(t, func() bool {
+		staples, _ := m.Gauge("tls.ocsp_staple.staples")
+		age, _ := m.Gauge("tls.ocsp_staple.max_age")
+		return staples == 0 && age == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestOCSPStaplingExternalCertificates(t *testing.T) {
+	ca := newTestCA(t, "server CA")
+	responder := &testResponder{ca: ca}
+	server := httptest.NewServer(responder)
+	defer server.Close()
+
+	static := ca.issue(t, 3, server.URL)
+	static.Certificate = append(static.Certificate, ca.cert.Raw)
+
+	obtained := ca.issue(t, 4, server.URL)
+	obtained.Certificate = append(obtained.Certificate, ca.cert.Raw)
+
+	hello := &tls.ClientHelloInfo{ServerName: "www.example.org"}
+
+	t.Run("disabled", func(t *testing.T) {
+		getCertificate := NewCertRegistry().StapleGetCertificate(nil, []tls.Certificate{static})
+
+		c, err := getCertificate(hello)
+		require.NoError(t, err)
+		assert.Equal(t, static.Certificate, c.Certificate)
+		assert.Nil(t, c.OCSPStaple)
+	})
+
+	cr := NewCertRegistry()
+	cr.EnableOCSPStapling(OCSPStaplingOptions{CheckInterval: time.Hour, Metrics: &metricstest.MockMetrics{}})
+	defer cr.Close()
+
+	for _, tt := range []struct {
+		title          string
+		getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	}{{
+		title:          "static",
+		getCertificate: cr.StapleGetCertificate(nil, []tls.Certificate{static}),
+	}, {
+		title: "obtained",
+		getCertificate: cr.StapleGetCertificate(func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &obtained, nil
+		}, nil),
+	}} {
+		t.Run(tt.title, func(t *testing.T) {
+			require.Eventually(t, func() bool {
+				c, err := tt.getCertificate(hello)
+				return err == nil && c.OCSPStaple != nil
+			}, time.Second, 10*time.Millisecond)
+		})
+	}
+
+	assert.Nil(t, static.OCSPStaple, "static certificate is not changed")
+	assert.Nil(t, obtained.OCSPStaple, "obtained certificate is not changed")
+
+	t.Run("registry", func(t *testing.T) {
+		require.NoError(t, cr.ConfigureCertificate("api.example.org", withChain(ca.issue(t, 5, server.URL), ca)))
+
+		getCertificate := cr.StapleGetCertificate(cr.GetCertFromHello, nil)
+		c, err := getCertificate(&tls.ClientHelloInfo{ServerName: "api.example.org"})
+		require.NoError(t, err)
+		require.NotNil(t, c)
+
+		cr.stapler.mu.Lock()
+		defer cr.stapler.mu.Unlock()
+		assert.Len(t, cr.stapler.external, 2, "the certificates of the registry are not external")
+	})
+}
@@ -2,6 +2,7 @@ package skipper
 
 import (
 	"context"
+	"crypto"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
@@ -23,11 +24,13 @@ import (
 
 	ot "github.com/opentracing/opentracing-go"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/quic-go/quic-go/http3"
 	log "github.com/sirupsen/logrus"
 	"go.opentelemetry.io/otel"
 	otBridge "go.opentelemetry.io/otel/bridge/opentracing"
 	"go.opentelemetry.io/otel/trace"
 
+	"github.com/zalando/skipper/canary"
 	"github.com/zalando/skipper/circuit"
 	"github.com/zalando/skipper/dataclients/kubernetes"
 	"github.com/zalando/skipper/dataclients/routestring"
@@ -40,7 +43,9 @@ import (
 	"github.com/zalando/skipper/filters/block"
 	"github.com/zalando/skipper/filters/builtin"
 	"github.com/zalando/skipper/filters/cache"
+	canaryfilter "github.com/zalando/skipper/filters/canary"
 	"github.com/zalando/skipper/filters/fadein"
+	geoipfilter "github.com/zalando/skipper/filters/geoip"
 	logfilter "github.com/zalando/skipper/filters/log"
 	"github.com/zalando/skipper/filters/openpolicyagent"
 	"github.com/zalando/skipper/filters/openpolicyagent/opaauthorizerequest"
@@ -49,25 +54,16 @@ import (
 	"github.com/zalando/skipper/filters/shedder"
 	teefilters "github.com/zalando/skipper/filters/tee"
 	tlsfilters "github.com/zalando/skipper/filters/tls"
+	"github.com/zalando/skipper/filters/waf"
+	"github.com/zalando/skipper/geoip"
 	"github.com/zalando/skipper/loadbalancer"
 	"github.com/zalando/skipper/logging"
 	"github.com/zalando/skipper/metrics"
 	skpnet "github.com/zalando/skipper/net"
 	sotel "github.com/zalando/skipper/otel"
-	pauth "github.com/zalando/skipper/predicates/auth"
-	"github.com/zalando/skipper/predicates/content"
-	"github.com/zalando/skipper/predicates/cookie"
-	"github.com/zalando/skipper/predicates/cron"
-	"github.com/zalando/skipper/predicates/forwarded"
-	"github.com/zalando/skipper/predicates/host"
-	"github.com/zalando/skipper/predicates/interval"
-	"github.com/zalando/skipper/predicates/methods"
-	skpotel "github.com/zalando/skipper/predicates/otel"
-	"github.com/zalando/skipper/predicates/primitive"
-	"github.com/zalando/skipper/predicates/query"
-	"github.com/zalando/skipper/predicates/source"
-	"github.com/zalando/skipper/predicates/tee"
-	"github.com/zalando/skipper/predicates/traffic"
+	builtinpredicates "github.com/zalando/skipper/predicates/builtin"
+	canarypredicate "github.com/zalando/skipper/predicates/canary"
+	geoippredicate "github.com/zalando/skipper/predicates/geoip"
 	"github.com/zalando/skipper/proxy"
 	"github.com/zalando/skipper/proxylistener"
 	"github.com/zalando/skipper/queuelistener"
@@ -76,8 +72,10 @@ import (
 	"github.com/zalando/skipper/scheduler"
 	"github.com/zalando/skipper/script"
 	"github.com/zalando/skipper/secrets"
+	"github.com/zalando/skipper/secrets/acme"
 	"github.com/zalando/skipper/secrets/certregistry"
 	"github.com/zalando/skipper/swarm"
+	"github.com/zalando/skipper/tap"
 	"github.com/zalando/skipper/tracing"
 	"github.com/zalando/skipper/validation"
 )
@@ -111,6 +109,21 @@ type Options struct {
 	// Insecure network address skipper should listen on when TLS is enabled
 	InsecureAddress string
 
+	// EnableHTTP3 enables an additional QUIC/HTTP/3 listener when TLS
+	// is enabled. It serves the same proxy handler, shares the TLS
+	// configuration of the TCP listener and is advertised to clients
+	// via the Alt-Svc response header on the TCP listener.
+	EnableHTTP3 bool
+
+	// HTTP3Address is the UDP network address of the HTTP/3
+	// listener. Defaults to the TCP listener address.
+	HTTP3Address string
+
+	// HTTP3UDPBufferSize sets the receive and send buffer sizes in
+	// bytes of the HTTP/3 UDP socket. When not set, the defaults of
+	// the QUIC implementation are used.
+	HTTP3UDPBufferSize int
+
 	// EnableTCPQueue enables controlling the
 	// concurrently processed requests at the TCP listener.
 	EnableTCPQueue bool
@@ -366,6 +379,17 @@ type Options struct {
 	// RouteURLs are URLs pointing to route definitions, in eskip format, with change watching enabled.
 	RoutesURLs []string
 
+	// RoutesURLsKeys are files with PEM encoded public keys. When set,
+	// the routes of RoutesURLs are applied only when their detached
+	// signature, downloaded from the URL with the .sig suffix, is valid
+	// with one of the keys.
+	RoutesURLsKeys []string
+
+	// RoutesURLsSigs are the URLs of the detached signatures of the
+	// RoutesURLs files, in the same order. Defaults to the URLs of the
+	// files with the .sig suffix.
+	RoutesURLsSigs []string
+
 	// InlineRoutes can define routes as eskip text.
 	InlineRoutes string
 
@@ -527,6 +551,40 @@ type Options struct {
 	// Deprecated: Network address for the /metrics endpoint
 	MetricsListener string
 
+	// ConfigReloader, when set, enables changing a subset of the options
+	// without a restart. It is called on SIGHUP, and when the
+	// ConfigReloadFile changes, to get the next version of the options.
+	// DefaultFilters, BreakerSettings, RatelimitSettings and
+	// AccessLogDisabled are applied, changes of the other options are
+	// rejected with an error log, and require a restart.
+	ConfigReloader func() (Options, error)
+
+	// ConfigReloadFile, when set together with ConfigReloader, is checked
+	// for changes periodically.
+	ConfigReloadFile string
+
+	// ConfigReloadCheckInterval sets how often the ConfigReloadFile is
+	// checked for changes. Defaults to 10s.
+	ConfigReloadCheckInterval time.Duration
+
+	// TrafficTapTokenFile is the path to a file containing the bearer
+	// token of the /tap endpoint of the support listener. The endpoint
+	// streaming the live traffic is enabled only when set.
+	TrafficTapTokenFile string
+
+	// TrafficTapMaxDuration limits the duration of the traffic tap
+	// sessions. Defaults to tap.DefaultMaxDuration.
+	TrafficTapMaxDuration time.Duration
+
+	// TrafficTapMaxBodySize limits the number of captured request and
+	// response body bytes. Defaults to tap.DefaultMaxBodySize.
+	TrafficTapMaxBodySize int
+
+	// TrafficTapRedactHeaders are redacted in the traffic tap records in
+	// addition to the Authorization, Proxy-Authorization, Cookie and
+	// Set-Cookie headers.
+	TrafficTapRedactHeaders []string
+
 	// Skipper provides a set of metrics with different keys which are exposed via HTTP in JSON
 	// You can customize those key names with your own prefix
 	MetricsPrefix string
@@ -705,6 +763,12 @@ type Options struct {
 	// AccessLogFormatter, when set is passed along to the underlying Logrus logger for access logs.
 	AccessLogFormatter log.Formatter
 
+	// AccessLogTemplate, when set, defines the format of the access log
+	// lines with ${...} placeholders, e.g. ${request.method} or
+	// ${response.header.Content-Type}. It takes precedence over
+	// AccessLogJSONEnabled and AccessLogFormatter.
+	AccessLogTemplate string
+
 	DebugListener string
 
 	// CertPathTLS is the path of certificate(s) when using TLS,
@@ -720,6 +784,79 @@ type Options struct {
 	// TLS Client Authentication, see [tls.ClientAuthType]
 	TLSClientAuth tls.ClientAuthType
 
+	// TLSClientCAFiles maps SNI host names to the paths of PEM encoded
+	// CA bundles, that are used to verify the client certificates of
+	// the TLS connections to the host, instead of the system CAs. For
+	// these hosts, the client certificates are verified even when
+	// TLSClientAuth doesn't require it. With KubernetesEnableTLS, the
+	// bundles can be set also in the client-ca.crt field of the TLS
+	// secrets.
+	TLSClientCAFiles map[string]string
+
+	// TLSClientCRLFiles contains the paths of PEM or DER encoded
+	// certificate revocation lists. The TLS handshakes with revoked
+	// client certificates are rejected.
+	TLSClientCRLFiles []string
+
+	// TLSClientCRLRefreshInterval sets how often the CRL files are
+	// reloaded. Defaults to 1 minute.
+	TLSClientCRLRefreshInterval time.Duration
+
+	// TLSClientOCSP enables checking the revocation of the client
+	// certificates with the OCSP responders listed in the certificates.
+	TLSClientOCSP bool
+
+	// TLSClientOCSPCacheTTL sets how long the OCSP responses are
+	// cached, unless they require an earlier update. Defaults to 1 hour.
+	TLSClientOCSPCacheTTL time.Duration
+
+	// TLSOCSPStapling enables stapling the OCSP responses to the
+	// certificates of the certificate registry, used by
+	// KubernetesEnableTLS, to the static certificates, and to the ACME
+	// certificates.
+	TLSOCSPStapling bool
+
+	// EnableACME enables obtaining and renewing certificates from an
+	// ACME server, e.g. Let's Encrypt, for the hostnames of the Host
+	// predicates of the routes.
+	EnableACME bool
+
+	// ACMEDirectoryURL is the directory of the ACME server. Defaults to
+	// Let's Encrypt.
+	ACMEDirectoryURL string
+
+	// ACMEEmail is the contact address of the ACME account.
+	ACMEEmail string
+
+	// ACMEChallenge selects the challenge type, tls-alpn-01, answered
+	// on the TLS listener, or http-01, answered on the proxy listener.
+	// Defaults to tls-alpn-01.
+	ACMEChallenge string
+
+	// ACMEStore selects where the certificates are stored, file or
+	// kubernetes. Defaults to file.
+	ACMEStore string
+
+	// ACMEStorePath is the directory of the file store.
+	ACMEStorePath string
+
+	// ACMEKubernetesNamespace is the namespace of the secrets of the
+	// kubernetes store.
+	ACMEKubernetesNamespace string
+
+	// ACMERenewBefore sets how long before their expiry the
+	// certificates are renewed. Defaults to 30 days.
+	ACMERenewBefore time.Duration
+
+	// ACMERootCAFile is a PEM encoded CA bundle to verify the ACME
+	// server with, e.g. of a local test server.
+	ACMERootCAFile string
+
+	acmeManager *acme.Manager
+
+	// staples the OCSP responses, when TLSOCSPStapling is enabled
+	ocspStapler *certregistry.CertRegistry
+
 	// TLS Settings for Proxy Server
 	ProxyTLS *tls.Config
 
@@ -878,6 +1015,22 @@ type Options struct {
 	// timestamp as unix nanoseconds.
 	EnablePrometheusStartLabel bool
 
+	// EnablePrometheusNativeHistograms makes the Prometheus latency
+	// histograms native histograms with sparse, exponential buckets.
+	EnablePrometheusNativeHistograms bool
+
+	// PrometheusNativeHistogramFactor is the maximum growth factor
+	// between two consecutive buckets of the native histograms.
+	PrometheusNativeHistogramFactor float64
+
+	// PrometheusNativeHistogramMaxBuckets limits the number of buckets
+	// of a native histogram.
+	PrometheusNativeHistogramMaxBuckets uint32
+
+	// EnablePrometheusExemplars attaches the trace ID of the request as
+	// exemplar to the Prometheus latency metrics.
+	EnablePrometheusExemplars bool
+
 	// An instance of a Prometheus registry. It allows registering and serving custom metrics when skipper is used as a
 	// library.
 	// A new registry is created if this option is nil.
@@ -1034,6 +1187,37 @@ type Options struct {
 	// MaxMatcherBufferSize sets the maximum read buffer size of blockContent filter defaults to 2MiB
 	MaxMatcherBufferSize uint64
 
+	// WAFMaxBodySize sets the maximum number of bytes of the request
+	// body inspected by the waf filter
+	WAFMaxBodySize int64
+
+	// GeoIPDatabases are the paths of the MaxMind DB files used by the
+	// GeoIP predicate and the geoipHeaders filter. The predicate and
+	// the filter are available only when at least one is set.
+	GeoIPDatabases []string
+
+	// GeoIPClientIP tells which address of the requests is looked up
+	// in the GeoIP databases: source, sourceFromLast or clientIP, like
+	// the Source, SourceFromLast and ClientIP predicates. Defaults to
+	// sourceFromLast.
+	GeoIPClientIP string
+
+	// EnableCanaryAnalysis enables the Canary predicate and the canary
+	// and canaryBaseline filters, that shift the traffic to the canary
+	// routes step by step, or roll them back, based on their error rate
+	// and latency. The state of the canary groups is exposed on the
+	// /canary path of the support listener.
+	EnableCanaryAnalysis bool
+
+	// CanaryMinRequests is the minimum number of the canary requests
+	// in an interval, that is required for the analysis.
+	CanaryMinRequests int
+
+	// CanaryStateFile is the file where the state of the canary groups
+	// is stored, and loaded from on start. When not set, the state is
+	// kept only in memory.
+	CanaryStateFile string
+
 	// EnableSwarm enables skipper fleet communication, required by e.g.
 	// the cluster ratelimiter
 	EnableSwarm bool
@@ -1118,6 +1302,20 @@ type Options struct {
 
 	PassiveHealthCheck map[string]string
 
+	// LBDNSDiscoveryNameservers are the nameservers, in host:port
+	// format, used to resolve the endpoints of the load balanced
+	// backends with dns or srv discovery. Defaults to the
+	// nameservers in /etc/resolv.conf.
+	LBDNSDiscoveryNameservers []string
+
+	// LBDNSDiscoveryMinTTL is the minimum interval between two
+	// resolutions of the endpoints with dns or srv discovery.
+	LBDNSDiscoveryMinTTL time.Duration
+
+	// LBDNSDiscoveryMaxTTL is the maximum interval between two
+	// resolutions of the endpoints with dns or srv discovery.
+	LBDNSDiscoveryMaxTTL time.Duration
+
 	// proxy protocol options
 	EnableProxyProtocol bool
 	ProxyAllowListCIDRs []string
@@ -1248,11 +1446,37 @@ func createDataClients(o Options, cr *certregistry.CertRegistry) ([]routing.Data
 	}
 
 	if len(o.RoutesURLs) > 0 {
-		for _, url := range o.RoutesURLs {
+		var keys []crypto.PublicKey
+		for _, kf := range o.RoutesURLsKeys {
+			data, err := os.ReadFile(kf)
+			if err != nil {
+				return nil, fmt.Errorf("error while reading routes signature keys: %w", err)
+			}
+
+			k, err := eskipfile.ParsePublicKeys(data)
+			if err != nil {
+				return nil, fmt.Errorf("error while parsing routes signature keys from %s: %w", kf, err)
+			}
+
+			keys = append(keys, k...)
+		}
+
+		if len(o.RoutesURLsSigs) > 0 && len(o.RoutesURLsSigs) != len(o.RoutesURLs) {
+			return nil, fmt.Errorf("the number of the routes signature URLs (%d) doesn't match the number of the routes URLs (%d)", len(o.RoutesURLsSigs), len(o.RoutesURLs))
+		}
+
+		for i, url := range o.RoutesURLs {
+			var sigURL string
+			if len(o.RoutesURLsSigs) > 0 {
+				sigURL = o.RoutesURLsSigs[i]
+			}
+
 			client, err := eskipfile.RemoteWatch(&eskipfile.RemoteWatchOptions{
 				RemoteFile:    url,
 				FailOnStartup: true,
 				HTTPTimeout:   o.SourcePollTimeout,
+				SignatureKeys: keys,
+				SignatureURL:  sigURL,
 			})
 			if err != nil {
 				return nil, fmt.Errorf("error while loading routes from url %s: %w", url, err)
@@ -1434,7 +1658,7 @@ func (o *Options) TlsConfig(cr *certregistry.CertRegistry) (*tls.Config, error)
 		return o.ProxyTLS, nil
 	}
 
-	if o.CertPathTLS == "" && o.KeyPathTLS == "" && cr == nil {
+	if o.CertPathTLS == "" && o.KeyPathTLS == "" && cr == nil && o.acmeManager == nil {
 		return nil, nil
 	}
 
@@ -1451,28 +1675,142 @@ func (o *Options) TlsConfig(cr *certregistry.CertRegistry) (*tls.Config, error)
 		config.GetCertificate = cr.GetCertFromHello
 	}
 
-	if o.CertPathTLS == "" && o.KeyPathTLS == "" {
-		return config, nil
-	}
+	if len(o.TLSClientCAFiles) > 0 {
+		if cr == nil {
+			cr = certregistry.NewCertRegistry()
+		}
+
+		for host, f := range o.TLSClientCAFiles {
+			pem, err := os.ReadFile(f)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read client CA file %s: %w", f, err)
+			}
 
-	crts := strings.Split(o.CertPathTLS, ",")
-	keys := strings.Split(o.KeyPathTLS, ",")
+			if err := cr.ConfigureClientCA(host, pem); err != nil {
+				return nil, err
+			}
+		}
+	}
 
-	if len(crts) != len(keys) {
-		return nil, fmt.Errorf("number of certificates does not match number of keys")
+	if cr != nil {
+		config.GetConfigForClient = cr.GetConfigForClient(config)
 	}
 
-	for i := range crts {
-		crt, key := crts[i], keys[i]
-		keypair, err := tls.LoadX509KeyPair(crt, key)
+	if len(o.TLSClientCRLFiles) > 0 || o.TLSClientOCSP {
+		rc, err := certregistry.NewRevocationChecker(certregistry.RevocationOptions{
+			CRLFiles:           o.TLSClientCRLFiles,
+			CRLRefreshInterval: o.TLSClientCRLRefreshInterval,
+			OCSP:               o.TLSClientOCSP,
+			OCSPCacheTTL:       o.TLSClientOCSPCacheTTL,
+		})
 		if err != nil {
-			return nil, fmt.Errorf("failed to load X509 keypair from %s and %s: %w", crt, key, err)
+			return nil, err
 		}
-		config.Certificates = append(config.Certificates, keypair)
+
+		config.VerifyConnection = rc.VerifyConnection
+	}
+
+	if o.CertPathTLS != "" || o.KeyPathTLS != "" {
+		crts := strings.Split(o.CertPathTLS, ",")
+		keys := strings.Split(o.KeyPathTLS, ",")
+
+		if len(crts) != len(keys) {
+			return nil, fmt.Errorf("number of certificates does not match number of keys")
+		}
+
+		for i := range crts {
+			crt, key := crts[i], keys[i]
+			keypair, err := tls.LoadX509KeyPair(crt, key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load X509 keypair from %s and %s: %w", crt, key, err)
+			}
+			config.Certificates = append(config.Certificates, keypair)
+		}
+	}
+
+	if o.acmeManager != nil {
+		// the certificates of the registry and the static certificates
+		// take precedence over the ACME certificates
+		config.GetCertificate = o.acmeManager.WrapGetCertificate(config.GetCertificate, config.Certificates)
+		config.NextProtos = append(config.NextProtos, acme.ALPNProto)
+	}
+
+	if o.ocspStapler != nil {
+		config.GetCertificate = o.ocspStapler.StapleGetCertificate(config.GetCertificate, config.Certificates)
 	}
+
 	return config, nil
 }
 
+// openPolicyAgentInstanceConfig returns the options of the config of the
+// OPA instances, that can change at runtime.
+func (o *Options) openPolicyAgentInstanceConfig() []func(*openpolicyagent.OpenPolicyAgentInstanceConfig) error {
+	opts := []func(*openpolicyagent.OpenPolicyAgentInstanceConfig) error{
+		openpolicyagent.WithConfigTemplateFile(o.OpenPolicyAgentConfigTemplate),
+	}
+
+	if o.OpenPolicyAgentEnvoyMetadata != "" {
+		opts = append(opts, openpolicyagent.WithEnvoyMetadataFile(o.OpenPolicyAgentEnvoyMetadata))
+	}
+
+	return opts
+}
+
+// newACMEManager creates the ACME manager with the configured store.
+func (o *Options) newACMEManager() (*acme.Manager, error) {
+	var (
+		store acme.Store
+		err   error
+	)
+
+	switch o.ACMEStore {
+	case "", "file":
+		store, err = acme.NewFileStore(o.ACMEStorePath)
+	case "kubernetes":
+		store, err = acme.NewKubernetesStore(acme.KubernetesStoreOptions{
+			KubernetesInCluster: o.KubernetesInCluster,
+			KubernetesURL:       o.KubernetesURL,
+			Namespace:           o.ACMEKubernetesNamespace,
+		})
+	default:
+		return nil, fmt.Errorf("unsupported ACME store: %s", o.ACMEStore)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var client *http.Client
+	if o.ACMERootCAFile != "" {
+		pem, err := os.ReadFile(o.ACMERootCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ACME root CA file %s: %w", o.ACMERootCAFile, err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("failed to parse ACME root CA file %s", o.ACMERootCAFile)
+		}
+
+		client = &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			},
+		}
+	}
+
+	return acme.New(acme.Options{
+		DirectoryURL: o.ACMEDirectoryURL,
+		Email:        o.ACMEEmail,
+		Store:        store,
+		Challenge:    o.ACMEChallenge,
+		RenewBefore:  o.ACMERenewBefore,
+		HTTPClient:   client,
+	})
+}
+
 func (o *Options) openTracingTracerInstance() (ot.Tracer, error) {
 	if o.OpenTracingTracer != nil {
 		return o.OpenTracingTracer, nil
@@ -1579,6 +1917,24 @@ func listenAndServeQuit(
 
 	cm.Configure(srv)
 
+	var chr *skpnet.ClientHelloRecorder
+	if serveTLS {
+		chr = &skpnet.ClientHelloRecorder{}
+		chr.Configure(srv)
+	}
+
+	var h3 *http3.Server
+	if o.EnableHTTP3 {
+		if serveTLS {
+			h3 = newHTTP3Server(o, address, tlsConfig, proxy)
+			// the TLS predicates and fingerprints need to match over QUIC, too
+			chr.ConfigureHTTP3(h3)
+			srv.Handler = &altSvcHandler{http3: h3, handler: proxy}
+		} else {
+			log.Warn("HTTP/3 requires TLS, HTTP/3 listener is disabled")
+		}
+	}
+
 	log.Infof("Listen on %v", address)
 
 	l, err := listen(o, address, mtr)
@@ -1615,10 +1971,31 @@ func listenAndServeQuit(
 		if err := srv.Shutdown(context.Background()); err != nil {
 			log.Errorf("Failed to graceful shutdown: %v", err)
 		}
+		if h3 != nil {
+			if err := h3.Shutdown(context.Background()); err != nil {
+				log.Errorf("Failed to graceful shutdown HTTP/3 listener: %v", err)
+			}
+		}
 		close(idleConnsCH)
 	}()
 
 	if serveTLS {
+		if h3 != nil {
+			conn, err := listenUDP(o, h3.Addr)
+			if err != nil {
+				return fmt.Errorf("failed to start HTTP/3 listener: %w", err)
+			}
+			defer conn.Close()
+
+			log.Infof("HTTP/3 listener on %v", h3.Addr)
+
+			go func() {
+				if err := h3.Serve(conn); err != http.ErrServerClosed {
+					log.Errorf("HTTP/3 listener serve failed: %v", err)
+				}
+			}()
+		}
+
 		if o.InsecureAddress != "" {
 			log.Infof("Insecure listener on %v", o.InsecureAddress)
 
@@ -1652,6 +2029,58 @@ func listenAndServeQuit(
 	return nil
 }
 
+// altSvcHandler advertises the HTTP/3 listener on responses served
+// via TLS over TCP.
+type altSvcHandler struct {
+	http3   *http3.Server
+	handler http.Handler
+}
+
+func (h *altSvcHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.TLS != nil && r.ProtoMajor < 3 {
+		// fails only when the HTTP/3 listener is not running
+		_ = h.http3.SetQUICHeaders(w.Header())
+	}
+	h.handler.ServeHTTP(w, r)
+}
+
+func newHTTP3Server(o *Options, address string, tlsConfig *tls.Config, handler http.Handler) *http3.Server {
+	if o.HTTP3Address != "" {
+		address = o.HTTP3Address
+	}
+
+	return &http3.Server{
+		Addr:           address,
+		Handler:        handler,
+		TLSConfig:      http3.ConfigureTLSConfig(tlsConfig),
+		MaxHeaderBytes: o.MaxHeaderBytes,
+		IdleTimeout:    o.IdleTimeoutServer,
+	}
+}
+
+func listenUDP(o *Options, address string) (net.PacketConn, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.HTTP3UDPBufferSize > 0 {
+		if err := conn.SetReadBuffer(o.HTTP3UDPBufferSize); err != nil {
+			log.Warnf("Failed to set UDP receive buffer size to %d: %v", o.HTTP3UDPBufferSize, err)
+		}
+		if err := conn.SetWriteBuffer(o.HTTP3UDPBufferSize); err != nil {
+			log.Warnf("Failed to set UDP send buffer size to %d: %v", o.HTTP3UDPBufferSize, err)
+		}
+	}
+
+	return conn, nil
+}
+
 func proxyListener(ll net.Listener, o *Options) (net.Listener, error) {
 	// PROXY protocol
 	l, err := proxylistener.NewListener(proxylistener.Options{
@@ -1808,6 +2237,11 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 		PrometheusRegistry:                 o.PrometheusRegistry,
 		EnablePrometheusStartLabel:         o.EnablePrometheusStartLabel,
 		DisableCompression:                 o.DisableMetricsCompression,
+
+		EnablePrometheusNativeHistograms:      o.EnablePrometheusNativeHistograms,
+		PrometheusNativeHistogramBucketFactor: o.PrometheusNativeHistogramFactor,
+		PrometheusNativeHistogramMaxBuckets:   o.PrometheusNativeHistogramMaxBuckets,
+		EnablePrometheusExemplars:             o.EnablePrometheusExemplars,
 	}
 
 	mtr := o.MetricsBackend
@@ -1832,6 +2266,30 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 		cr = certregistry.NewCertRegistry()
 	}
 
+	if o.TLSOCSPStapling {
+		if o.ProxyTLS != nil || o.CertPathTLS == "" && o.KeyPathTLS == "" && !o.KubernetesEnableTLS && !o.EnableACME {
+			log.Warn("OCSP stapling has no effect without TLS certificates from -tls-cert, kubernetes or ACME")
+		} else {
+			// the registry staples the static and the ACME
+			// certificates, too
+			o.ocspStapler = cr
+			if o.ocspStapler == nil {
+				o.ocspStapler = certregistry.NewCertRegistry()
+			}
+
+			o.ocspStapler.EnableOCSPStapling(certregistry.OCSPStaplingOptions{Metrics: mtr})
+			defer o.ocspStapler.Close()
+		}
+	}
+
+	if o.EnableACME {
+		o.acmeManager, err = o.newACMEManager()
+		if err != nil {
+			return fmt.Errorf("failed to create ACME manager: %w", err)
+		}
+		defer o.acmeManager.Close()
+	}
+
 	// create data clients
 	dataClients, err := createDataClients(o, cr)
 	if err != nil {
@@ -1984,6 +2442,7 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 		logfilter.NewAuditLog(o.MaxAuditBody),
 		block.NewBlock(o.MaxMatcherBufferSize),
 		block.NewBlockHex(o.MaxMatcherBufferSize),
+		waf.NewWAF(waf.Options{MaxBodySize: o.WAFMaxBodySize}),
 		auth.NewBearerInjector(sp),
 		auth.NewSetRequestHeaderFromSecret(sp),
 		auth.NewJwtValidationWithOptions(tio),
@@ -2217,10 +2676,14 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 			ratelimitfilters.NewClusterClientRateLimit(provider),
 			ratelimitfilters.NewDisableRatelimit(provider),
 			ratelimitfilters.NewBackendRatelimit(),
+			ratelimitfilters.NewConcurrencyLimit(),
 		)
 
 		if redisOptions != nil || valkeyOptions != nil {
-			o.CustomFilters = append(o.CustomFilters, ratelimitfilters.NewClusterLeakyBucketRatelimit(ratelimitRegistry))
+			o.CustomFilters = append(o.CustomFilters,
+				ratelimitfilters.NewClusterLeakyBucketRatelimit(ratelimitRegistry),
+				ratelimitfilters.NewClusterConcurrencyLimit(ratelimitRegistry),
+			)
 		}
 	}
 
@@ -2252,17 +2715,13 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 			oauthConfig.NewGrantCallback(),
 			oauthConfig.NewGrantClaimsQuery(),
 			oauthConfig.NewGrantLogout(),
+			oauthConfig.NewCSRFProtect(),
 		)
 	}
 
 	var opaRegistry *openpolicyagent.OpenPolicyAgentRegistry
 	if o.EnableOpenPolicyAgent {
-		opts := make([]func(*openpolicyagent.OpenPolicyAgentInstanceConfig) error, 0)
-		opts = append(opts,
-			openpolicyagent.WithConfigTemplateFile(o.OpenPolicyAgentConfigTemplate))
-		if o.OpenPolicyAgentEnvoyMetadata != "" {
-			opts = append(opts, openpolicyagent.WithEnvoyMetadataFile(o.OpenPolicyAgentEnvoyMetadata))
-		}
+		opts := o.openPolicyAgentInstanceConfig()
 
 		opaRegistryOpts := []func(*openpolicyagent.OpenPolicyAgentRegistry) error{
 			openpolicyagent.WithMaxRequestBodyBytes(o.OpenPolicyAgentMaxRequestBodySize),
@@ -2322,6 +2781,21 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 		o.CustomFilters = append(o.CustomFilters, lua)
 	}
 
+	if len(o.GeoIPDatabases) > 0 {
+		geoipDB, err := geoip.New(geoip.Options{
+			Files:    o.GeoIPDatabases,
+			ClientIP: o.GeoIPClientIP,
+		})
+		if err != nil {
+			log.Errorf("Failed to load GeoIP databases: %v.", err)
+			return err
+		}
+		defer geoipDB.Close()
+
+		o.CustomFilters = append(o.CustomFilters, geoipfilter.NewHeaders(geoipDB))
+		o.CustomPredicates = append(o.CustomPredicates, geoippredicate.New(geoipDB))
+	}
+
 	if o.MtlsAuthnCA == nil {
 		o.MtlsAuthnCA, err = x509.SystemCertPool()
 		if err != nil {
@@ -2350,34 +2824,7 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 	}
 
 	// include bundled custom predicates
-	o.CustomPredicates = append(o.CustomPredicates,
-		source.New(),
-		source.NewFromLast(),
-		source.NewClientIP(),
-		interval.NewBetween(),
-		interval.NewBefore(),
-		interval.NewAfter(),
-		cron.New(),
-		cookie.New(),
-		query.New(),
-		traffic.New(),
-		traffic.NewSegment(),
-		primitive.NewTrue(),
-		primitive.NewFalse(),
-		primitive.NewShutdown(),
-		pauth.NewJWTPayloadAllKV(),
-		pauth.NewJWTPayloadAnyKV(),
-		pauth.NewJWTPayloadAllKVRegexp(),
-		pauth.NewJWTPayloadAnyKVRegexp(),
-		pauth.NewHeaderSHA256(),
-		methods.New(),
-		tee.New(),
-		forwarded.NewForwardedHost(),
-		forwarded.NewForwardedProto(),
-		host.NewAny(),
-		content.NewContentLengthBetween(),
-		skpotel.NewBaggage(),
-	)
+	o.CustomPredicates = append(o.CustomPredicates, builtinpredicates.Predicates()...)
 
 	// provide default value for wrapper if not defined
 	if o.CustomHttpHandlerWrap == nil {
@@ -2406,6 +2853,28 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 		MinHealthCheckDropProbability: passiveHealthCheck.MinDropProbability,
 		MaxHealthCheckDropProbability: passiveHealthCheck.MaxDropProbability,
 	})
+	var canaryRegistry *canary.Registry
+	if o.EnableCanaryAnalysis {
+		canaryRegistry = canary.NewRegistry(canary.Options{
+			MinRequests:      o.CanaryMinRequests,
+			Metrics:          mtr,
+			EndpointRegistry: endpointRegistry,
+			StateFile:        o.CanaryStateFile,
+		})
+		defer canaryRegistry.Close()
+
+		o.CustomFilters = append(o.CustomFilters, canaryfilter.New(), canaryfilter.NewBaseline())
+		o.CustomPredicates = append(o.CustomPredicates, canarypredicate.New(canaryRegistry))
+	}
+
+	dnsDiscovery := loadbalancer.NewDNSDiscovery(loadbalancer.DNSDiscoveryOptions{
+		Nameservers:      o.LBDNSDiscoveryNameservers,
+		MinTTL:           o.LBDNSDiscoveryMinTTL,
+		MaxTTL:           o.LBDNSDiscoveryMaxTTL,
+		EndpointRegistry: endpointRegistry,
+	})
+	defer dnsDiscovery.Close()
+
 	ro := routing.Options{
 		FilterRegistry:  o.filterRegistry(),
 		MatchingOptions: mo,
@@ -2415,6 +2884,7 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 		UpdateBuffer:    updateBuffer,
 		SuppressLogs:    o.SuppressRouteUpdateLogs,
 		PostProcessors: []routing.PostProcessor{
+			dnsDiscovery,
 			loadbalancer.NewAlgorithmProvider(),
 			endpointRegistry,
 			schedulerRegistry,
@@ -2430,8 +2900,17 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 		ro.PostProcessors = append(ro.PostProcessors, failClosedRatelimitPostProcessor)
 	}
 
-	if o.DefaultFilters != nil {
-		ro.PreProcessors = append(ro.PreProcessors, o.DefaultFilters)
+	if o.acmeManager != nil {
+		ro.PostProcessors = append(ro.PostProcessors, o.acmeManager)
+	}
+
+	if canaryRegistry != nil {
+		ro.PostProcessors = append(ro.PostProcessors, canaryfilter.NewPostProcessor(canaryRegistry))
+	}
+
+	defaultFilters := newDefaultFiltersPreProcessor(o.DefaultFilters)
+	if o.DefaultFilters != nil || o.ConfigReloader != nil {
+		ro.PreProcessors = append(ro.PreProcessors, defaultFilters)
 	}
 
 	if o.CloneRoute != nil {
@@ -2484,15 +2963,37 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 	routing := routing.New(ro)
 	defer routing.Close()
 
+	var trafficTap *tap.Tap
+	if o.TrafficTapTokenFile != "" {
+		token, err := os.ReadFile(o.TrafficTapTokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read traffic tap token: %w", err)
+		}
+
+		trafficTap = tap.New(tap.Options{
+			Token:         strings.TrimSpace(string(token)),
+			MaxDuration:   o.TrafficTapMaxDuration,
+			MaxBodySize:   o.TrafficTapMaxBodySize,
+			RedactHeaders: o.TrafficTapRedactHeaders,
+		})
+	}
+
+	var accessLogTemplate *eskip.Template
+	if o.AccessLogTemplate != "" {
+		accessLogTemplate = eskip.NewTemplate(o.AccessLogTemplate)
+	}
+
 	proxyFlags := proxy.Flags(o.ProxyOptions) | o.ProxyFlags
 	proxyParams := proxy.Params{
 		Routing:                          routing,
 		Flags:                            proxyFlags,
 		Metrics:                          mtr,
+		EnablePrometheusExemplars:        o.EnablePrometheusExemplars,
 		PriorityRoutes:                   o.PriorityRoutes,
 		IdleConnectionsPerHost:           o.IdleConnectionsPerHost,
 		CloseIdleConnsPeriod:             o.CloseIdleConnsPeriod,
 		FlushInterval:                    o.BackendFlushInterval,
+		TunnelIdleTimeout:                o.IdleTimeoutServer,
 		ExperimentalUpgrade:              o.ExperimentalUpgrade,
 		ExperimentalUpgradeAudit:         o.ExperimentalUpgradeAudit,
 		MaxLoopbacks:                     o.MaxLoopbacks,
@@ -2507,6 +3008,8 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 		DisableHTTPKeepalives:            o.DisableHTTPKeepalives,
 		AccessLogDisabled:                o.AccessLogDisabled,
 		AccessLogger:                     accessLogger,
+		AccessLogTemplate:                accessLogTemplate,
+		Tap:                              trafficTap,
 		EnableCopyStreamPoolExperimental: o.EnableCopyStreamPoolExperimental,
 		ClientTLS:                        o.ClientTLS,
 		ClientCertFile:                   o.ClientCertFile,
@@ -2551,6 +3054,14 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 		mux.Handle("/debug/pprof", metricsHandler)
 		mux.Handle("/debug/pprof/", metricsHandler)
 
+		if trafficTap != nil {
+			mux.Handle("/tap", trafficTap)
+		}
+
+		if canaryRegistry != nil {
+			mux.Handle("/canary", canaryRegistry)
+		}
+
 		log.Infof("support listener on %s", supportListener)
 		go func() {
 			/* #nosec */
@@ -2576,6 +3087,23 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 	proxy := proxy.WithParams(proxyParams)
 	defer proxy.Close()
 
+	if o.ConfigReloader != nil {
+		reloader := &configReloader{
+			options:    o,
+			reload:     o.ConfigReloader,
+			filters:    defaultFilters,
+			routing:    routing,
+			proxy:      proxy,
+			breakers:   proxyParams.CircuitBreakers,
+			ratelimits: ratelimitRegistry,
+			opa:        opaRegistry,
+		}
+
+		quitReload := make(chan struct{})
+		defer close(quitReload)
+		go reloader.run(quitReload)
+	}
+
 	for _, startupCheckURL := range o.StatusChecks {
 		for {
 			/* #nosec */
@@ -2612,7 +3140,12 @@ func run(o Options, sig chan os.Signal, idleConnsCH chan struct{}) error {
 		}
 	}
 
-	return listenAndServeQuit(o.CustomHttpHandlerWrap(proxy), &o, sig, idleConnsCH, mtr, cr)
+	var handler http.Handler = proxy
+	if o.acmeManager != nil {
+		handler = o.acmeManager.HTTPHandler(handler)
+	}
+
+	return listenAndServeQuit(o.CustomHttpHandlerWrap(handler), &o, sig, idleConnsCH, mtr, cr)
 }
 
 func ensureExpectedDataclients(o Options, dataClients []routing.DataClient) error {
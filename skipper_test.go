@@ -14,6 +14,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/quic-go/quic-go/http3"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/zalando/skipper/dataclients/routestring"
@@ -228,6 +229,57 @@ func TestOptionsTLSConfig(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, len(c.CipherSuites), 1)
 
+	// ACME
+	o = &Options{EnableACME: true, ACMEStorePath: t.TempDir(), CertPathTLS: "fixtures/test.crt", KeyPathTLS: "fixtures/test.key"}
+	o.acmeManager, err = o.newACMEManager()
+	require.NoError(t, err)
+	defer o.acmeManager.Close()
+
+	c, err = o.TlsConfig(nil)
+	require.NoError(t, err)
+	require.NotNil(t, c.GetCertificate)
+	assert.Equal(t, []tls.Certificate{cert}, c.Certificates)
+	assert.Contains(t, c.NextProtos, "acme-tls/1")
+
+	// ACME without other certificates
+	o = &Options{acmeManager: o.acmeManager}
+	c, err = o.TlsConfig(nil)
+	require.NoError(t, err)
+	require.NotNil(t, c)
+	require.NotNil(t, c.GetCertificate)
+	// OCSP stapling of the static certificates
+	o = &Options{CertPathTLS: "fixtures/test.crt", KeyPathTLS: "fixtures/test.key", ocspStapler: certregistry.NewCertRegistry()}
+	c, err = o.TlsConfig(nil)
+	require.NoError(t, err)
+	require.NotNil(t, c.GetCertificate)
+
+	crt, err := c.GetCertificate(&tls.ClientHelloInfo{ServerName: "www.example.org"})
+	require.NoError(t, err)
+	assert.Equal(t, cert.Certificate, crt.Certificate)
+}
+
+func TestOptionsACMEManager(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		options *Options
+	}{
+		{"missing store path", &Options{}},
+		{"unknown store", &Options{ACMEStore: "redis", ACMEStorePath: t.TempDir()}},
+		{"unknown challenge", &Options{ACMEChallenge: "dns-01", ACMEStorePath: t.TempDir()}},
+		{"missing root CA file", &Options{ACMERootCAFile: "fixtures/notFound.crt", ACMEStorePath: t.TempDir()}},
+		{"invalid root CA file", &Options{ACMERootCAFile: "fixtures/test.key", ACMEStorePath: t.TempDir()}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.options.newACMEManager()
+			t.Logf("ACME manager error: %v", err)
+			require.Error(t, err)
+		})
+	}
+
+	o := &Options{ACMERootCAFile: "fixtures/test.crt", ACMEStorePath: t.TempDir()}
+	m, err := o.newACMEManager()
+	require.NoError(t, err)
+	m.Close()
 }
 
 func TestOptionsTLSConfigInvalidPaths(t *testing.T) {
@@ -359,6 +411,62 @@ func TestHTTPServer(t *testing.T) {
 	}
 }
 
+func TestHTTP3Server(t *testing.T) {
+	MuFindAddress.Lock()
+	a := FindAddress(t)
+	MuFindAddress.Unlock()
+
+	o := Options{
+		Address:     a,
+		EnableHTTP3: true,
+		CertPathTLS: "fixtures/test.crt",
+		KeyPathTLS:  "fixtures/test.key",
+	}
+
+	rt := routing.New(routing.Options{
+		FilterRegistry: builtin.MakeRegistry(),
+		DataClients:    []routing.DataClient{}})
+	defer rt.Close()
+
+	proxy := proxy.WithParams(proxy.Params{
+		Routing: rt,
+		Flags:   proxy.Flags(proxy.OptionsNone),
+		Metrics: &metricstest.MockMetrics{},
+	})
+	defer proxy.Close()
+
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	go listenAndServeQuit(proxy, &o, sigs, done, nil, nil)
+	defer func() {
+		sigs <- syscall.SIGTERM
+		<-done
+	}()
+
+	_, port, err := net.SplitHostPort(a)
+	require.NoError(t, err)
+
+	r, err := waitConnGet("https://" + a)
+	require.NoError(t, err)
+	r.Body.Close()
+
+	assert.Equal(t, http.StatusNotFound, r.StatusCode)
+	assert.Equal(t, `h3=":`+port+`"; ma=2592000`, r.Header.Get("Alt-Svc"))
+
+	h3 := &http3.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	defer h3.Close()
+
+	r, err = waitConn(func() (*http.Response, error) {
+		return (&http.Client{Transport: h3}).Get("https://" + a)
+	})
+	require.NoError(t, err)
+	r.Body.Close()
+
+	assert.Equal(t, http.StatusNotFound, r.StatusCode)
+	assert.Equal(t, 3, r.ProtoMajor)
+	assert.Empty(t, r.Header.Get("Alt-Svc"))
+}
+
 func TestServerShutdownHTTP(t *testing.T) {
 	o := &Options{}
 	testServerShutdown(t, o, "http")
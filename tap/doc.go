@@ -0,0 +1,36 @@
+/*
+Package tap implements a live traffic tap, that streams a bounded sample
+of the proxied requests and responses to a debugging client.
+
+The Tap is an http.Handler, that is served on the support listener. A
+client opens a tap session with a GET request, and receives the matching
+request and response pairs as newline delimited JSON (NDJSON), one
+record per line, until the session expires:
+
+	curl -N -H "Authorization: Bearer $TOKEN" \
+		'localhost:9911/tap?route=my_route&limit=10&duration=30s&body=1024'
+
+The session can be limited to the traffic matching all of the following
+query parameters:
+
+  - route: the route ID
+  - host: the request host, without port
+  - pathPrefix: the prefix of the request path
+  - header: a request header in the form of Name:value, or only Name to
+    match the presence of the header
+
+The session ends when the number of records given by the limit parameter
+were streamed, the duration parameter elapsed, or the client disconnected.
+Both are capped by the configured maximums. The body parameter enables
+capturing the request and response bodies, truncated to the given number
+of bytes.
+
+Records are dropped instead of slowing down the proxy, when the client
+cannot read them fast enough. The values of sensitive headers, like
+Authorization or Cookie, are always redacted.
+
+The proxy calls Start for every request, which is a no-op while there
+are no active sessions, and Finish on the returned Exchange when the
+response was sent.
+*/
+package tap
@@ -0,0 +1,530 @@
+package tap
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Defaults of the Options.
+const (
+	DefaultMaxDuration = 5 * time.Minute
+	DefaultMaxRecords  = 1000
+	DefaultMaxBodySize = 64 << 10
+)
+
+const (
+	defaultDuration = time.Minute
+	defaultLimit    = 100
+
+	// records are dropped when the client falls behind by more than this
+	sessionBufferSize = 32
+
+	redactedValue = "[redacted]"
+)
+
+var defaultRedactHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+}
+
+// Options configures the traffic tap.
+type Options struct {
+
+	// Token is the bearer token, that the clients need to present in
+	// the Authorization header. When empty, every request to the tap
+	// endpoint is rejected.
+	Token string
+
+	// MaxDuration is the maximum lifetime of a tap session. Defaults
+	// to DefaultMaxDuration.
+	MaxDuration time.Duration
+
+	// MaxRecords is the maximum number of records streamed in a tap
+	// session. Defaults to DefaultMaxRecords.
+	MaxRecords int
+
+	// MaxBodySize is the maximum number of body bytes captured of a
+	// request or response. Defaults to DefaultMaxBodySize.
+	MaxBodySize int
+
+	// RedactHeaders are redacted in the records in addition to the
+	// Authorization, Proxy-Authorization, Cookie and Set-Cookie headers.
+	RedactHeaders []string
+}
+
+// Tap manages the active tap sessions. It serves the tap endpoint and
+// captures the traffic for the sessions.
+type Tap struct {
+	options  Options
+	redact   map[string]bool
+	active   atomic.Int64
+	mu       sync.RWMutex
+	sessions map[*session]struct{}
+}
+
+// Info contains the details of a proxied request, that are known only
+// after the response was sent.
+type Info struct {
+	RouteID         string
+	Endpoint        string
+	StatusCode      int
+	ResponseSize    int64
+	ResponseHeader  http.Header
+	BackendDuration time.Duration
+}
+
+// Exchange captures a single request and response while there are
+// active tap sessions.
+type Exchange struct {
+	tap           *Tap
+	start         time.Time
+	method        string
+	uri           string
+	proto         string
+	host          string
+	path          string
+	remoteAddr    string
+	requestHeader http.Header
+	requestBody   *limitedBuffer
+	responseBody  *limitedBuffer
+}
+
+type session struct {
+	routeID     string
+	host        string
+	pathPrefix  string
+	headerName  string
+	headerValue string
+	limit       int
+	duration    time.Duration
+	bodySize    int
+	records     chan []byte
+}
+
+type limitedBuffer struct {
+	mu        sync.Mutex
+	buf       []byte
+	max       int
+	truncated bool
+}
+
+type teeBody struct {
+	io.ReadCloser
+	buf *limitedBuffer
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	buf *limitedBuffer
+}
+
+type recordMessage struct {
+	Method        string      `json:"method,omitempty"`
+	URI           string      `json:"uri,omitempty"`
+	Proto         string      `json:"proto,omitempty"`
+	Host          string      `json:"host,omitempty"`
+	RemoteAddr    string      `json:"remoteAddr,omitempty"`
+	StatusCode    int         `json:"statusCode,omitempty"`
+	Size          int64       `json:"size,omitempty"`
+	Header        http.Header `json:"header"`
+	Body          string      `json:"body,omitempty"`
+	BodyTruncated bool        `json:"bodyTruncated,omitempty"`
+}
+
+type record struct {
+	Timestamp         time.Time     `json:"timestamp"`
+	RouteID           string        `json:"routeId,omitempty"`
+	Endpoint          string        `json:"endpoint,omitempty"`
+	DurationMs        float64       `json:"durationMs"`
+	BackendDurationMs float64       `json:"backendDurationMs,omitempty"`
+	Request           recordMessage `json:"request"`
+	Response          recordMessage `json:"response"`
+}
+
+// New creates a traffic tap.
+func New(o Options) *Tap {
+	if o.MaxDuration <= 0 {
+		o.MaxDuration = DefaultMaxDuration
+	}
+
+	if o.MaxRecords <= 0 {
+		o.MaxRecords = DefaultMaxRecords
+	}
+
+	if o.MaxBodySize <= 0 {
+		o.MaxBodySize = DefaultMaxBodySize
+	}
+
+	redact := make(map[string]bool)
+	for _, h := range append(defaultRedactHeaders, o.RedactHeaders...) {
+		redact[http.CanonicalHeaderKey(h)] = true
+	}
+
+	return &Tap{
+		options:  o,
+		redact:   redact,
+		sessions: make(map[*session]struct{}),
+	}
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := min(len(p), b.max-len(b.buf))
+	b.buf = append(b.buf, p[:n]...)
+	if n < len(p) {
+		b.truncated = true
+	}
+
+	return len(p), nil
+}
+
+func (b *limitedBuffer) bytes(size int) ([]byte, bool) {
+	if b == nil || size == 0 {
+		return nil, false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.buf) > size {
+		return b.buf[:size], true
+	}
+
+	return b.buf, b.truncated
+}
+
+func (b *teeBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	return n, err
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.buf.Write(p[:n])
+	return n, err
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, fmt.Errorf("could not hijack connection")
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func stripPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+func positiveInt(q url.Values, key string, defaultValue, maxValue int) (int, error) {
+	v := q.Get(key)
+	if v == "" {
+		return min(defaultValue, maxValue), nil
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid %s: %q", key, v)
+	}
+
+	return min(i, maxValue), nil
+}
+
+func (t *Tap) newSession(q url.Values) (*session, error) {
+	s := &session{
+		routeID:    q.Get("route"),
+		host:       q.Get("host"),
+		pathPrefix: q.Get("pathPrefix"),
+		records:    make(chan []byte, sessionBufferSize),
+	}
+
+	if h := q.Get("header"); h != "" {
+		name, value, _ := strings.Cut(h, ":")
+		s.headerName = strings.TrimSpace(name)
+		s.headerValue = strings.TrimSpace(value)
+	}
+
+	var err error
+	if s.limit, err = positiveInt(q, "limit", defaultLimit, t.options.MaxRecords); err != nil {
+		return nil, err
+	}
+
+	if s.limit == 0 {
+		return nil, fmt.Errorf("invalid limit: 0")
+	}
+
+	if s.bodySize, err = positiveInt(q, "body", 0, t.options.MaxBodySize); err != nil {
+		return nil, err
+	}
+
+	s.duration = min(defaultDuration, t.options.MaxDuration)
+	if d := q.Get("duration"); d != "" {
+		s.duration, err = time.ParseDuration(d)
+		if err != nil || s.duration <= 0 {
+			return nil, fmt.Errorf("invalid duration: %q", d)
+		}
+
+		s.duration = min(s.duration, t.options.MaxDuration)
+	}
+
+	return s, nil
+}
+
+func (s *session) matches(e *Exchange, info Info) bool {
+	if s.routeID != "" && s.routeID != info.RouteID {
+		return false
+	}
+
+	if s.host != "" && !strings.EqualFold(s.host, stripPort(e.host)) {
+		return false
+	}
+
+	if !strings.HasPrefix(e.path, s.pathPrefix) {
+		return false
+	}
+
+	if s.headerName != "" {
+		values, ok := e.requestHeader[http.CanonicalHeaderKey(s.headerName)]
+		if !ok {
+			return false
+		}
+
+		if s.headerValue != "" && !strings.EqualFold(s.headerValue, strings.Join(values, ",")) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (t *Tap) authorized(r *http.Request) bool {
+	if t.options.Token == "" {
+		return false
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(t.options.Token)) == 1
+}
+
+func (t *Tap) add(s *session) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sessions[s] = struct{}{}
+	t.active.Store(int64(len(t.sessions)))
+}
+
+func (t *Tap) remove(s *session) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.sessions, s)
+	t.active.Store(int64(len(t.sessions)))
+}
+
+// ServeHTTP starts a tap session, and streams the matching records as
+// NDJSON until the session expires.
+func (t *Tap) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !t.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	s, err := t.newSession(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// the session is registered before the response header is sent,
+	// so that the client receives all the traffic after that
+	t.add(s)
+	defer t.remove(s)
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	log.Infof("Traffic tap session started from %s: %s", r.RemoteAddr, r.URL.RawQuery)
+	defer log.Infof("Traffic tap session from %s finished", r.RemoteAddr)
+
+	timer := time.NewTimer(s.duration)
+	defer timer.Stop()
+
+	for n := 0; n < s.limit; n++ {
+		select {
+		case rec := <-s.records:
+			if _, err := w.Write(rec); err != nil {
+				return
+			}
+
+			rc.Flush()
+		case <-timer.C:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// Start returns an Exchange capturing the request, and a response
+// writer capturing the response body when needed. When there are no
+// active sessions, it returns nil and the original response writer.
+func (t *Tap) Start(w http.ResponseWriter, r *http.Request) (*Exchange, http.ResponseWriter) {
+	if t.active.Load() == 0 {
+		return nil, w
+	}
+
+	var bodySize int
+	t.mu.RLock()
+	for s := range t.sessions {
+		bodySize = max(bodySize, s.bodySize)
+	}
+	t.mu.RUnlock()
+
+	e := &Exchange{
+		tap:           t,
+		start:         time.Now(),
+		method:        r.Method,
+		uri:           r.RequestURI,
+		proto:         r.Proto,
+		host:          r.Host,
+		path:          r.URL.Path,
+		remoteAddr:    r.RemoteAddr,
+		requestHeader: r.Header.Clone(),
+	}
+
+	if bodySize > 0 {
+		e.requestBody = &limitedBuffer{max: bodySize}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = &teeBody{ReadCloser: r.Body, buf: e.requestBody}
+		}
+
+		e.responseBody = &limitedBuffer{max: bodySize}
+		w = &responseWriter{ResponseWriter: w, buf: e.responseBody}
+	}
+
+	return e, w
+}
+
+func (t *Tap) redactHeader(h http.Header) http.Header {
+	if h == nil {
+		return http.Header{}
+	}
+
+	h = h.Clone()
+	for name, values := range h {
+		if t.redact[name] {
+			for i := range values {
+				values[i] = redactedValue
+			}
+		}
+	}
+
+	return h
+}
+
+func (e *Exchange) record(s *session, info Info, duration time.Duration) ([]byte, error) {
+	rec := record{
+		Timestamp:  e.start,
+		RouteID:    info.RouteID,
+		Endpoint:   info.Endpoint,
+		DurationMs: float64(duration.Microseconds()) / 1000,
+		Request: recordMessage{
+			Method:     e.method,
+			URI:        e.uri,
+			Proto:      e.proto,
+			Host:       e.host,
+			RemoteAddr: e.remoteAddr,
+			Header:     e.tap.redactHeader(e.requestHeader),
+		},
+		Response: recordMessage{
+			StatusCode: info.StatusCode,
+			Size:       info.ResponseSize,
+			Header:     e.tap.redactHeader(info.ResponseHeader),
+		},
+	}
+
+	if info.Endpoint != "" {
+		rec.BackendDurationMs = float64(info.BackendDuration.Microseconds()) / 1000
+	}
+
+	var body []byte
+	body, rec.Request.BodyTruncated = e.requestBody.bytes(s.bodySize)
+	rec.Request.Body = string(body)
+	body, rec.Response.BodyTruncated = e.responseBody.bytes(s.bodySize)
+	rec.Response.Body = string(body)
+
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(b, '\n'), nil
+}
+
+// Finish sends the record of the exchange to the matching sessions. It
+// is safe to call on a nil Exchange.
+func (e *Exchange) Finish(info Info) {
+	if e == nil {
+		return
+	}
+
+	duration := time.Since(e.start)
+
+	e.tap.mu.RLock()
+	defer e.tap.mu.RUnlock()
+
+	for s := range e.tap.sessions {
+		if !s.matches(e, info) {
+			continue
+		}
+
+		rec, err := e.record(s, info, duration)
+		if err != nil {
+			log.Errorf("Failed to encode traffic tap record: %v", err)
+			continue
+		}
+
+		select {
+		case s.records <- rec:
+		default:
+			// the client is too slow, drop the record
+		}
+	}
+}
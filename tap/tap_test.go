@@ -0,0 +1,201 @@
+package tap_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando/skipper/eskip"
+	"github.com/zalando/skipper/filters/builtin"
+	"github.com/zalando/skipper/proxy"
+	"github.com/zalando/skipper/proxy/proxytest"
+	"github.com/zalando/skipper/tap"
+)
+
+const testToken = "test-token"
+
+type testRecord struct {
+	RouteID  string `json:"routeId"`
+	Endpoint string `json:"endpoint"`
+	Request  struct {
+		Method        string      `json:"method"`
+		URI           string      `json:"uri"`
+		Header        http.Header `json:"header"`
+		Body          string      `json:"body"`
+		BodyTruncated bool        `json:"bodyTruncated"`
+	} `json:"request"`
+	Response struct {
+		StatusCode    int         `json:"statusCode"`
+		Header        http.Header `json:"header"`
+		Body          string      `json:"body"`
+		BodyTruncated bool        `json:"bodyTruncated"`
+	} `json:"response"`
+}
+
+func startTap(t *testing.T, o tap.Options) (*tap.Tap, *httptest.Server, *proxytest.TestProxy) {
+	t.Helper()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Header().Set("X-Backend", "backend")
+		w.Write([]byte("hello from backend"))
+	}))
+	t.Cleanup(backend.Close)
+
+	routes, err := eskip.Parse(`
+		r1: Path("/foo") -> "` + backend.URL + `";
+		r2: Path("/bar") -> status(418) -> <shunt>;
+	`)
+	require.NoError(t, err)
+
+	tp := tap.New(o)
+
+	p := proxytest.WithParams(builtin.MakeRegistry(), proxy.Params{Tap: tp}, routes...)
+	t.Cleanup(func() { p.Close() })
+
+	s := httptest.NewServer(tp)
+	t.Cleanup(s.Close)
+
+	return tp, s, p
+}
+
+func openSession(t *testing.T, tapURL, query string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest("GET", tapURL+"/tap?"+query, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+
+	rsp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { rsp.Body.Close() })
+
+	return rsp
+}
+
+func TestTapUnauthorized(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		token  string
+		header string
+	}{{
+		name:  "no token configured",
+		token: "",
+	}, {
+		name:  "missing authorization",
+		token: testToken,
+	}, {
+		name:   "invalid token",
+		token:  testToken,
+		header: "Bearer invalid",
+	}, {
+		name:   "invalid scheme",
+		token:  testToken,
+		header: "Basic " + testToken,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, s, _ := startTap(t, tap.Options{Token: tc.token})
+
+			req, err := http.NewRequest("GET", s.URL+"/tap", nil)
+			require.NoError(t, err)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+
+			rsp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			rsp.Body.Close()
+
+			assert.Equal(t, http.StatusUnauthorized, rsp.StatusCode)
+		})
+	}
+}
+
+func TestTapInvalidParameters(t *testing.T) {
+	_, s, _ := startTap(t, tap.Options{Token: testToken})
+
+	for _, q := range []string{
+		"limit=0",
+		"limit=foo",
+		"body=-1",
+		"duration=foo",
+		"duration=-1s",
+	} {
+		t.Run(q, func(t *testing.T) {
+			rsp := openSession(t, s.URL, q)
+			assert.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+		})
+	}
+}
+
+func TestTapStreamsMatchingRecords(t *testing.T) {
+	_, s, p := startTap(t, tap.Options{Token: testToken})
+
+	rsp := openSession(t, s.URL, "route=r1&header=X-Debug&limit=2&body=5")
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+	assert.Equal(t, "application/x-ndjson", rsp.Header.Get("Content-Type"))
+
+	for _, path := range []string{"/bar", "/foo", "/foo", "/foo"} {
+		req, err := http.NewRequest("POST", p.URL+path+"?q=1", strings.NewReader("request body"))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer secret")
+		if path == "/foo" {
+			req.Header.Set("X-Debug", "true")
+		}
+
+		prsp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		io.Copy(io.Discard, prsp.Body)
+		prsp.Body.Close()
+	}
+
+	var records []testRecord
+	scanner := bufio.NewScanner(rsp.Body)
+	for scanner.Scan() {
+		var r testRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+		records = append(records, r)
+	}
+
+	require.Len(t, records, 2, "the session should end after the limit")
+	for _, r := range records {
+		assert.Equal(t, "r1", r.RouteID)
+		assert.NotEmpty(t, r.Endpoint)
+		assert.Equal(t, "POST", r.Request.Method)
+		assert.Equal(t, "/foo?q=1", r.Request.URI)
+		assert.Equal(t, "[redacted]", r.Request.Header.Get("Authorization"))
+		assert.Equal(t, "true", r.Request.Header.Get("X-Debug"))
+		assert.Equal(t, "reque", r.Request.Body)
+		assert.True(t, r.Request.BodyTruncated)
+		assert.Equal(t, http.StatusOK, r.Response.StatusCode)
+		assert.Equal(t, "[redacted]", r.Response.Header.Get("Set-Cookie"))
+		assert.Equal(t, "backend", r.Response.Header.Get("X-Backend"))
+		assert.Equal(t, "hello", r.Response.Body)
+		assert.True(t, r.Response.BodyTruncated)
+	}
+}
+
+func TestTapSessionExpires(t *testing.T) {
+	tp, s, p := startTap(t, tap.Options{Token: testToken, MaxDuration: 50 * time.Millisecond})
+
+	rsp := openSession(t, s.URL, "duration=1h")
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+	b, err := io.ReadAll(rsp.Body)
+	require.NoError(t, err)
+	assert.Empty(t, b)
+
+	// without sessions, the requests are not captured
+	w := httptest.NewRecorder()
+	e, rw := tp.Start(w, httptest.NewRequest("GET", p.URL+"/bar", nil))
+	assert.Nil(t, e)
+	assert.Equal(t, w, rw)
+}